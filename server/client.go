@@ -1252,6 +1252,14 @@ func (c *client) publicPermissions() *Permissions {
 	return perms
 }
 
+// subscribePermissions returns the subscribe permissions of the client, empty if not restricted.
+func (c *client) subscribePermissions() *SubjectPermission {
+	if perms := c.publicPermissions(); perms != nil {
+		return perms.Subscribe
+	}
+	return &SubjectPermission{}
+}
+
 func subjectQueueString(sub *subscription) string {
 	if len(sub.queue) == 0 {
 		return string(sub.subject)
@@ -4982,6 +4990,11 @@ func (c *client) processServiceImport(si *serviceImport, acc *Account, msg []byt
 				c.addServerAndClusterInfo(ci)
 			}
 		}
+		// JetStream API requests from the client's own account carry its subscribe permissions,
+		// since they are handled by other servers that can't resolve them.
+		if ci != nil && isSysImport && !hadPrevSi && strings.HasPrefix(to, JSApiPrefix) {
+			ci.SubPerms = c.subscribePermissions()
+		}
 		// Set clientInfo if present.
 		if ci != nil {
 			if b, _ := json.Marshal(ci); b != nil {
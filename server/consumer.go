@@ -64,13 +64,19 @@ type ConsumerInfo struct {
 	NumRedelivered int             `json:"num_redelivered"`
 	NumWaiting     int             `json:"num_waiting"`
 	NumPending     uint64          `json:"num_pending"`
-	Cluster        *ClusterInfo    `json:"cluster,omitempty"`
-	PushBound      bool            `json:"push_bound,omitempty"`
-	Paused         bool            `json:"paused,omitempty"`
-	PauseRemaining time.Duration   `json:"pause_remaining,omitempty"`
+	// NumPendingApprox is set when NumPending is an upper bound, since
+	// a header filter can skip messages that are not yet looked at.
+	NumPendingApprox bool          `json:"num_pending_approx,omitempty"`
+	Cluster          *ClusterInfo  `json:"cluster,omitempty"`
+	PushBound        bool          `json:"push_bound,omitempty"`
+	Paused           bool          `json:"paused,omitempty"`
+	PauseRemaining   time.Duration `json:"pause_remaining,omitempty"`
 	// TimeStamp indicates when the info was gathered
 	TimeStamp      time.Time            `json:"ts"`
 	PriorityGroups []PriorityGroupState `json:"priority_groups,omitempty"`
+	// NumPendingPriority is the number of messages per priority level held back
+	// by a consumer delivering by message priority, these are part of NumPending.
+	NumPendingPriority []uint64 `json:"num_pending_priority,omitempty"`
 }
 
 // consumerInfoClusterResponse is a response used in a cluster to communicate the consumer info
@@ -84,6 +90,11 @@ type PriorityGroupState struct {
 	Group          string    `json:"group"`
 	PinnedClientID string    `json:"pinned_client_id,omitempty"`
 	PinnedTS       time.Time `json:"pinned_ts,omitempty"`
+	// Weight and Delivered are reported for the weighted priority policy.
+	// Delivered is the number of messages delivered to the group since this
+	// server became the consumer leader.
+	Weight    int    `json:"weight,omitempty"`
+	Delivered uint64 `json:"delivered,omitempty"`
 }
 
 type ConsumerConfig struct {
@@ -139,6 +150,30 @@ type ConsumerConfig struct {
 	PriorityGroups []string       `json:"priority_groups,omitempty"`
 	PriorityPolicy PriorityPolicy `json:"priority_policy,omitempty"`
 	PinnedTTL      time.Duration  `json:"priority_timeout,omitempty"`
+	// PriorityWeights is the relative share of deliveries of each priority group
+	// when the PriorityPolicy is weighted. Shares are kept by the consumer leader,
+	// so they are best-effort per leader term and start over on a new leader.
+	PriorityWeights map[string]int `json:"priority_weights,omitempty"`
+
+	// DeadLetter routes messages that exhausted MaxDeliver into another stream.
+	DeadLetter *ConsumerDeadLetter `json:"dead_letter,omitempty"`
+
+	// HeaderFilter is an expression on message headers, messages that do not
+	// match are skipped and do not need to be acknowledged.
+	HeaderFilter string `json:"header_filter,omitempty"`
+
+	// View binds the consumer to a point-in-time view of the stream,
+	// messages after the view's last sequence will not be delivered.
+	View string `json:"view,omitempty"`
+
+	// LagThresholds has the consumer leader send advisories when the consumer
+	// falls behind, and again once it recovered.
+	LagThresholds *ConsumerLagThresholds `json:"lag_thresholds,omitempty"`
+
+	// MsgPriority delivers the message with the lowest Nats-Priority level first instead of in
+	// stream order, picked from a window of up to MsgPriorityWindow undelivered messages.
+	MsgPriority       bool `json:"msg_priority,omitempty"`
+	MsgPriorityWindow int  `json:"msg_priority_window,omitempty"`
 }
 
 // clone performs a deep copy of the ConsumerConfig struct, returning a new clone with
@@ -157,6 +192,17 @@ func (cfg *ConsumerConfig) clone() *ConsumerConfig {
 	if cfg.PriorityGroups != nil {
 		clone.PriorityGroups = slices.Clone(cfg.PriorityGroups)
 	}
+	if cfg.PriorityWeights != nil {
+		clone.PriorityWeights = maps.Clone(cfg.PriorityWeights)
+	}
+	if cfg.DeadLetter != nil {
+		deadLetter := *cfg.DeadLetter
+		clone.DeadLetter = &deadLetter
+	}
+	if cfg.LagThresholds != nil {
+		lagThresholds := *cfg.LagThresholds
+		clone.LagThresholds = &lagThresholds
+	}
 	return &clone
 }
 
@@ -236,6 +282,36 @@ func (a *ConsumerAction) UnmarshalJSON(data []byte) error {
 // ConsumerNakOptions is for optional NAK values, e.g. delay.
 type ConsumerNakOptions struct {
 	Delay time.Duration `json:"delay"`
+	// Reason is kept as the last NAK reason if the message ends up dead-lettered.
+	Reason string `json:"reason,omitempty"`
+}
+
+// ConsumerDeadLetter is where the server copies messages to once they have
+// exhausted MaxDeliver, or optionally when they were terminated.
+type ConsumerDeadLetter struct {
+	// Stream is the stream the copies are expected to be stored in.
+	Stream string `json:"stream"`
+	// Subject the copies are published to. It can contain the {{stream}},
+	// {{consumer}} and {{subject}} placeholders.
+	Subject string `json:"subject"`
+	// OnTerm also copies messages that were terminated with AckTerm.
+	OnTerm bool `json:"on_term,omitempty"`
+	// TermOriginal terminates the original message once it was copied after
+	// exhausting MaxDeliver, removing it from interest or work queue streams.
+	TermOriginal bool `json:"term_original,omitempty"`
+}
+
+// ConsumerLagThresholds are the thresholds a consumer advises about when reached.
+// A threshold recovers once the value dropped to RecoverPercent of the threshold.
+type ConsumerLagThresholds struct {
+	// NumPending is the number of messages left to be delivered.
+	NumPending uint64 `json:"num_pending,omitempty"`
+	// NumAckPending is the number of delivered messages waiting to be acknowledged.
+	NumAckPending int `json:"num_ack_pending,omitempty"`
+	// AckPendingAge is the age of the oldest message waiting to be acknowledged.
+	AckPendingAge time.Duration `json:"ack_pending_age,omitempty"`
+	// RecoverPercent defaults to 80 percent when not set.
+	RecoverPercent int `json:"recover_percent,omitempty"`
 }
 
 // PriorityPolicy determines policy for selecting messages based on priority.
@@ -250,6 +326,8 @@ const (
 	PriorityPinnedClient
 	// Clients with lowest priority will be selected first.
 	PriorityPrioritized
+	// Each priority group gets a share of the messages according to its weight.
+	PriorityWeighted
 )
 
 const (
@@ -257,6 +335,7 @@ const (
 	PriorityOverflowJSONString     = `"overflow"`
 	PriorityPinnedClientJSONString = `"pinned_client"`
 	PriorityPrioritizedJSONString  = `"prioritized"`
+	PriorityWeightedJSONString     = `"weighted"`
 )
 
 var (
@@ -264,6 +343,7 @@ var (
 	PriorityOverflowJSONBytes     = []byte(PriorityOverflowJSONString)
 	PriorityPinnedClientJSONBytes = []byte(PriorityPinnedClientJSONString)
 	PriorityPrioritizedJSONBytes  = []byte(PriorityPrioritizedJSONString)
+	PriorityWeightedJSONBytes     = []byte(PriorityWeightedJSONString)
 )
 
 func (pp PriorityPolicy) String() string {
@@ -274,6 +354,8 @@ func (pp PriorityPolicy) String() string {
 		return PriorityPinnedClientJSONString
 	case PriorityPrioritized:
 		return PriorityPrioritizedJSONString
+	case PriorityWeighted:
+		return PriorityWeightedJSONString
 	default:
 		return PriorityNoneJSONString
 	}
@@ -287,6 +369,8 @@ func (pp PriorityPolicy) MarshalJSON() ([]byte, error) {
 		return PriorityPinnedClientJSONBytes, nil
 	case PriorityPrioritized:
 		return PriorityPrioritizedJSONBytes, nil
+	case PriorityWeighted:
+		return PriorityWeightedJSONBytes, nil
 	case PriorityNone:
 		return PriorityNoneJSONBytes, nil
 	default:
@@ -302,6 +386,8 @@ func (pp *PriorityPolicy) UnmarshalJSON(data []byte) error {
 		*pp = PriorityPinnedClient
 	case PriorityPrioritizedJSONString:
 		*pp = PriorityPrioritized
+	case PriorityWeightedJSONString:
+		*pp = PriorityWeighted
 	case PriorityNoneJSONString:
 		*pp = PriorityNone
 	default:
@@ -416,6 +502,8 @@ const (
 	// reasons to supply when terminating messages using limits
 	ackTermLimitsReason        = "Message deleted by stream limits"
 	ackTermUnackedLimitsReason = "Unacknowledged message was deleted"
+	// reason to supply when terminating messages that were dead-lettered
+	ackTermDeadLetterReason = "Message was dead-lettered"
 )
 
 // Calculate accurate replicas for the consumer config with the parent stream config.
@@ -450,6 +538,8 @@ type consumer struct {
 	sseq              uint64             // next stream sequence
 	subjf             subjectFilters     // subject filters and their sequences
 	filters           *gsl.SimpleSublist // When we have multiple filters we will use LoadNextMsgMulti and pass this in.
+	hf                *headerFilter      // Compiled header filter, if any.
+	vseq              uint64             // Last stream sequence visible through our view, if any.
 	dseq              uint64             // delivered consumer sequence
 	adflr             uint64             // ack delivery floor
 	asflr             uint64             // ack store floor
@@ -473,6 +563,8 @@ type consumer struct {
 	fcPre             string
 	fcSubj            string
 	nextMsgSubj       string
+	partition         int // Partition of a partitioned stream, pull requests are split across all partitions.
+	partitions        int
 	nextMsgReqs       *ipQueue[*nextMsgReq]
 	resetSubj         string
 	maxp              int
@@ -490,6 +582,14 @@ type consumer struct {
 	rdq               []uint64
 	rdqi              avl.SequenceSet
 	rdc               map[uint64]uint64
+	nakr              map[uint64]string         // Last NAK reasons, only kept when dead-lettering.
+	dlSub             *subscription             // PubAcks for dead lettered copies.
+	dlPre             string                    // Reply prefix for dead lettered copies.
+	dlq               map[string]*deadLetterPub // Dead lettered copies waiting for their PubAck.
+	dly               *msgDelays                // Delayed messages held back until they can be delivered.
+	prio              *msgPriorities            // Messages held back by priority level, only used on leaders.
+	lagtmr            *time.Timer               // Lag threshold check timer, only running on leaders.
+	lagging           uint8                     // Lag thresholds currently reached.
 	replies           map[uint64]string
 	pendingDeliveries map[uint64]*jsPubMsg        // Messages that can be delivered after achieving quorum.
 	waitingDeliveries map[string]*waitingDelivery // (Optional) request timeout messages that need to wait for replicated deliveries first.
@@ -562,6 +662,10 @@ type consumer struct {
 	/// pinnedTtl is the remaining time before the current PinId expires.
 	pinnedTtl *time.Timer
 	pinnedTS  time.Time
+	// pgw is the state of each priority group with the weighted policy.
+	// Like the pin id, it is only kept by the leader and is not replicated,
+	// so the weighted shares are best-effort per leader term.
+	pgw map[string]*weightedGroupState
 
 	// If standalone/single-server, the offline reason needs to be stored directly in the consumer.
 	// Otherwise, if clustered it will be part of the consumer assignment.
@@ -607,6 +711,10 @@ const (
 	JsDefaultPinnedTTL = 2 * time.Minute
 )
 
+// Maximum number of messages we hold back while looking for the next message to deliver,
+// before releasing our lock and continuing later.
+const maxHeldMsgsScan = 1000
+
 // Helper function to set consumer config defaults from above.
 func setConsumerConfigDefaults(config *ConsumerConfig, streamCfg *StreamConfig, lim *JSLimitOpts, accLim *JetStreamAccountLimits, pedantic bool) *ApiError {
 	// Setup default of -1, meaning no limit for MaxDeliver.
@@ -764,6 +872,11 @@ func checkConsumerCfg(
 	if _, err := config.AckPolicy.MarshalJSON(); err != nil {
 		return NewJSConsumerAckPolicyInvalidError()
 	}
+	// Delayed messages are held back as pending until they're due, which requires explicit acks.
+	// Only error here if not recovering, like above.
+	if cfg.AllowMsgDelay && !isRecovering && !msgDelayConsumerOk(config) {
+		return NewJSConsumerMsgDelayRequiresAckExplicitError()
+	}
 	if _, err := config.ReplayPolicy.MarshalJSON(); err != nil {
 		return NewJSConsumerReplayPolicyInvalidError()
 	}
@@ -1012,6 +1125,20 @@ func checkConsumerCfg(
 				return NewJSConsumerInvalidGroupNameError()
 			}
 		}
+
+		if config.PriorityPolicy == PriorityWeighted {
+			// Every group needs a weight, and weights are only for known groups.
+			if len(config.PriorityWeights) != len(config.PriorityGroups) {
+				return NewJSConsumerInvalidPriorityWeightsError()
+			}
+			for _, group := range config.PriorityGroups {
+				if w, ok := config.PriorityWeights[group]; !ok || w <= 0 || w > math.MaxInt32 {
+					return NewJSConsumerInvalidPriorityWeightsError()
+				}
+			}
+		} else if len(config.PriorityWeights) > 0 {
+			return NewJSConsumerPriorityWeightsWithoutPolicyError()
+		}
 	} else {
 		// If PriorityPolicy is None or not set, reject if PriorityGroups or PinnedTTL are set
 		if len(config.PriorityGroups) > 0 {
@@ -1020,6 +1147,40 @@ func checkConsumerCfg(
 		if config.PinnedTTL > 0 {
 			return NewJSConsumerPinnedTTLWithoutPriorityPolicyNoneError()
 		}
+		if len(config.PriorityWeights) > 0 {
+			return NewJSConsumerPriorityWeightsWithoutPolicyError()
+		}
+	}
+
+	if dl := config.DeadLetter; dl != nil {
+		if config.AckPolicy == AckNone {
+			return NewJSConsumerDeadLetterInvalidError(errors.New("ack policy none can not dead letter"))
+		}
+		if !isValidName(dl.Stream) {
+			return NewJSConsumerDeadLetterInvalidError(errors.New("stream name is invalid"))
+		}
+		if dl.Stream == cfg.Name {
+			return NewJSConsumerDeadLetterInvalidError(errors.New("stream can not be the consumer's stream"))
+		}
+		if !IsValidPublishSubject(expandDeadLetterSubject(dl.Subject, "s", "c", "subj")) {
+			return NewJSConsumerDeadLetterInvalidError(errors.New("subject is invalid"))
+		}
+	}
+
+	if config.HeaderFilter != _EMPTY_ {
+		if _, err := parseHeaderFilter(config.HeaderFilter); err != nil {
+			return NewJSConsumerHeaderFilterInvalidError(err)
+		}
+	}
+
+	if lt := config.LagThresholds; lt != nil {
+		if err := checkConsumerLagThresholds(lt, config.AckPolicy); err != nil {
+			return NewJSConsumerLagThresholdsInvalidError(err)
+		}
+	}
+
+	if err := checkConsumerMsgPriority(config, cfg); err != nil {
+		return NewJSConsumerMsgPriorityInvalidError(err)
 	}
 
 	// For now don't allow preferred server in placement.
@@ -1309,6 +1470,17 @@ func (mset *stream) addConsumerWithAssignmentAndMode(config *ConsumerConfig, ona
 		return eo, nil
 	}
 
+	// Resolve our view, messages after its last sequence are not visible to us.
+	if config.View != _EMPTY_ {
+		vseq, ok := mset.lookupView(config.View)
+		if !ok {
+			mset.mu.Unlock()
+			_ = o.stop()
+			return nil, NewJSStreamViewNotFoundError()
+		}
+		o.vseq = vseq
+	}
+
 	// Setup our storage if not a direct consumer.
 	if !config.Direct {
 		store, err := mset.store.ConsumerStore(o.name, o.created, config)
@@ -1330,6 +1502,11 @@ func (mset *stream) addConsumerWithAssignmentAndMode(config *ConsumerConfig, ona
 		o.subjf = append(o.subjf, sub)
 	}
 
+	if o.cfg.HeaderFilter != _EMPTY_ {
+		// Already validated when checking the config.
+		o.hf, _ = parseHeaderFilter(o.cfg.HeaderFilter)
+	}
+
 	// If we have multiple filter subjects, create a sublist which we will use
 	// in calling store.LoadNextMsgMulti.
 	if len(o.subjf) <= 1 {
@@ -1448,6 +1625,11 @@ func (mset *stream) addConsumerWithAssignmentAndMode(config *ConsumerConfig, ona
 	o.ackSubj = fmt.Sprintf(jsAckTv2+".*.*.*.*.>", domain, accHash, cfg.Name, o.name)
 
 	o.nextMsgSubj = fmt.Sprintf(JSApiRequestNextT, cfg.Name, o.name)
+	// Pull requests for a consumer of a partitioned stream are served by all its partitions.
+	if cfg.isPartitioned() {
+		o.nextMsgSubj = fmt.Sprintf(JSApiRequestNextT, cfg.partitionedStreamName(), o.name)
+		o.partition, o.partitions = cfg.Partition, cfg.Partitions
+	}
 	o.resetSubj = fmt.Sprintf(JSApiConsumerResetT, cfg.Name, o.name)
 
 	// Check/update the inactive threshold
@@ -1484,6 +1666,10 @@ func (mset *stream) addConsumerWithAssignmentAndMode(config *ConsumerConfig, ona
 	if config.Direct || standalone {
 		o.setLeader(true, 0)
 	}
+	// Mirrors and sources could have missed redactions while they were not connected.
+	if config.Direct {
+		mset.replayRedactions(o)
+	}
 
 	// This is always true in single server mode.
 	if o.IsLeader() {
@@ -1711,6 +1897,9 @@ func (o *consumer) setLeader(isLeader bool, term uint64) error {
 	stopAndClearTimer(&o.dtmr)
 	// Stop any unpause timers. Should only be running on leaders.
 	stopAndClearTimer(&o.uptmr)
+	// Stop checking lag thresholds, the new leader starts over.
+	stopAndClearTimer(&o.lagtmr)
+	o.lagging = 0
 	// Make sure to clear out any re-deliver queues
 	o.stopAndClearPtmr()
 	o.rdc = nil
@@ -1743,6 +1932,12 @@ func (o *consumer) setLeader(isLeader bool, term uint64) error {
 		stopAndClearTimer(&o.gwdtmr)
 	}
 	o.unassignPinId()
+	o.pgw = nil
+	o.nakr = nil
+	o.clearDeadLetterPubs()
+	o.dly.stop()
+	o.dly = nil
+	o.prio = nil
 
 	// Make sure to drain queued up acks.
 	o.ackMsgs.drain()
@@ -1805,6 +2000,12 @@ func (o *consumer) setLeader(isLeader bool, term uint64) error {
 		// Setup initial num pending.
 		o.streamNumPending()
 
+		// Hold back any pending messages that are not due yet.
+		o.restoreDelayedMsgs()
+
+		// Hold back any pending messages that were not delivered by priority yet.
+		o.restorePriorityMsgs()
+
 		// Cleanup lss when we take over in clustered mode.
 		if o.hasSkipListPending() && o.sseq >= o.lss.resume {
 			o.lss = nil
@@ -1880,6 +2081,9 @@ func (o *consumer) setLeader(isLeader bool, term uint64) error {
 		// Update the consumer pause tracking.
 		o.updatePauseState(&o.cfg)
 
+		// Start checking lag thresholds, if any.
+		o.updateLagCheck()
+
 		// If we are not in ReplayInstant mode mark us as in replay state until resolved.
 		if o.cfg.ReplayPolicy != ReplayInstant {
 			o.replay = true
@@ -2183,6 +2387,10 @@ func (o *consumer) updateDeliveryInterest(localInterest bool) bool {
 
 	if interest && !o.active {
 		o.signalNewMessages()
+		// The mirror or source could have missed redactions while it was not subscribed.
+		if o.direct {
+			go mset.replayRedactions(o)
+		}
 	}
 	// Update active status, if not active clear any queue group we captured.
 	if o.active = interest; !o.active {
@@ -2432,6 +2640,11 @@ func (o *consumer) hasMaxDeliveries(seq uint64) bool {
 		// Only send the advisory once.
 		if dc == o.maxdc {
 			o.notifyDeliveryExceeded(seq, dc)
+			var dseq uint64
+			if p, ok := o.pending[seq]; ok && p != nil {
+				dseq = p.Sequence
+			}
+			o.deadLetterMaxDeliveries(seq, dseq, dc)
 		}
 		// Determine if we signal to start flow of messages again.
 		if o.maxp > 0 && len(o.pending) >= o.maxp {
@@ -2459,7 +2672,8 @@ func (o *consumer) hasMaxDeliveries(seq uint64) bool {
 func (o *consumer) forceExpirePending() {
 	var expired []uint64
 	for seq := range o.pending {
-		if !o.onRedeliverQueue(seq) && !o.hasMaxDeliveries(seq) {
+		// Held priority messages were not delivered yet.
+		if !o.onRedeliverQueue(seq) && !o.prio.isHeld(seq) && !o.hasMaxDeliveries(seq) {
 			expired = append(expired, seq)
 		}
 	}
@@ -2575,6 +2789,12 @@ func (acc *Account) checkNewConsumerConfig(cfg, ncfg *ConsumerConfig) error {
 	if cfg.FlowControl != ncfg.FlowControl {
 		return errors.New("flow control can not be updated")
 	}
+	if cfg.View != ncfg.View {
+		return errors.New("view can not be updated")
+	}
+	if cfg.MsgPriority != ncfg.MsgPriority {
+		return errors.New("message priority can not be updated")
+	}
 
 	// Deliver Subject is conditional on if its bound.
 	if cfg.DeliverSubject != ncfg.DeliverSubject {
@@ -2728,10 +2948,21 @@ func (o *consumer) updateConfig(cfg *ConsumerConfig) error {
 		}
 	}
 
+	// Header filter only applies to messages we have not looked at yet.
+	if cfg.HeaderFilter != o.cfg.HeaderFilter {
+		o.hf = nil
+		if cfg.HeaderFilter != _EMPTY_ {
+			o.hf, _ = parseHeaderFilter(cfg.HeaderFilter)
+		}
+	}
+
 	// Record new config for others that do not need special handling.
 	// Allowed but considered no-op, [Description, SampleFrequency, MaxWaiting, HeadersOnly]
 	o.cfg = *cfg
 
+	// Lag thresholds are checked with the new config from now on.
+	o.updateLagCheck()
+
 	if cfg.Sourcing && (!o.srv.JetStreamIsClustered() && o.srv.standAloneMode()) {
 		o.resetStartingSeqLocked(0, _EMPTY_, false, false)
 	}
@@ -2867,7 +3098,10 @@ func (o *consumer) processAck(subject, reply string, hdr int, rmsg []byte) {
 		if buf := msg[len(AckTerm):]; len(buf) > 0 {
 			reason = string(bytes.TrimSpace(buf))
 		}
-		if !o.processTerm(sseq, dseq, dc, reason, reply) {
+		// If dead lettered, the original is only terminated once the copy is stored.
+		if o.deadLetterTerm(sseq, dseq, dc, reason, reply) {
+			skipAckReply = true
+		} else if !o.processTerm(sseq, dseq, dc, reason, reply) {
 			// We handle replies for acks in updateAcks
 			skipAckReply = true
 		}
@@ -2884,7 +3118,7 @@ func (o *consumer) progressUpdate(seq uint64) {
 	o.mu.Lock()
 	defer o.mu.Unlock()
 
-	if p, ok := o.pending[seq]; ok {
+	if p, ok := o.pending[seq]; ok && !o.prio.isHeld(seq) {
 		p.Timestamp = time.Now().UnixNano()
 		// Update store system.
 		o.updateDelivered(p.Sequence, seq, 1, p.Timestamp)
@@ -2998,6 +3232,9 @@ func (o *consumer) resetLocalStartingSeq(seq uint64) bool {
 		recalcPending = false
 	}
 	o.pending, o.rdc = nil, nil
+	o.dly.stop()
+	o.dly = nil
+	o.prio = nil
 	o.rdq = nil
 	o.rdqi.Empty()
 	o.sseq, o.dseq = seq, 1
@@ -3285,6 +3522,13 @@ func (o *consumer) processNak(sseq, dseq, dc uint64, nak []byte) {
 				var nd ConsumerNakOptions
 				if err = json.Unmarshal(arg, &nd); err == nil {
 					d = nd.Delay
+					// Keep the last reason in case this message gets dead-lettered.
+					if nd.Reason != _EMPTY_ && o.cfg.DeadLetter != nil {
+						if o.nakr == nil {
+							o.nakr = make(map[uint64]string)
+						}
+						o.nakr[sseq] = nd.Reason
+					}
 				}
 			} else {
 				d, err = time.ParseDuration(string(arg))
@@ -3559,7 +3803,15 @@ func (o *consumer) infoWithSnapAndReply(snap bool, reply string) *ConsumerInfo {
 
 	priorityGroups := []PriorityGroupState{}
 	// TODO(jrm): when we introduce supporting many priority groups, we need to update assigning `o.currentNuid` for each group.
-	if len(o.cfg.PriorityGroups) > 0 {
+	if o.cfg.PriorityPolicy == PriorityWeighted {
+		for _, group := range o.cfg.PriorityGroups {
+			pgs := PriorityGroupState{Group: group, Weight: o.cfg.PriorityWeights[group]}
+			if gs := o.pgw[group]; gs != nil {
+				pgs.Delivered = gs.delivered
+			}
+			priorityGroups = append(priorityGroups, pgs)
+		}
+	} else if len(o.cfg.PriorityGroups) > 0 {
 		priorityGroups = append(priorityGroups, PriorityGroupState{
 			Group:          o.cfg.PriorityGroups[0],
 			PinnedClientID: o.currentPinId,
@@ -3595,12 +3847,17 @@ func (o *consumer) infoWithSnapAndReply(snap bool, reply string) *ConsumerInfo {
 			Consumer: o.adflr,
 			Stream:   o.asflr,
 		},
-		NumAckPending:  len(o.pending),
+		NumAckPending:  o.numAckPending(),
 		NumRedelivered: len(o.rdc),
-		NumPending:     np,
-		PushBound:      o.isPushMode() && o.active,
-		TimeStamp:      time.Now().UTC(),
-		PriorityGroups: priorityGroups,
+		NumPending:     np + uint64(o.dly.len()+o.prio.len()),
+		// Messages are only matched against the header filter when delivering.
+		NumPendingApprox: o.hf != nil && np > 0,
+		PushBound:        o.isPushMode() && o.active,
+		TimeStamp:        time.Now().UTC(),
+		PriorityGroups:   priorityGroups,
+	}
+	if o.cfg.MsgPriority {
+		info.NumPendingPriority = o.prio.counts()
 	}
 	// Reset redelivered for MaxDeliver 1. Redeliveries are disabled so must not report it (is confusing otherwise).
 	// The state does still keep track of these messages.
@@ -3798,6 +4055,9 @@ func (o *consumer) processAckMsgLocked(sseq, dseq, dc uint64, reply string, doSa
 			o.moveAckFloor(dseq, sseq)
 		}
 		delete(o.rdc, sseq)
+		delete(o.nakr, sseq)
+		o.dly.remove(sseq)
+		o.prio.remove(sseq)
 		o.removeFromRedeliverQueue(sseq)
 	case AckAll, AckFlowControl:
 		// no-op
@@ -3824,6 +4084,9 @@ func (o *consumer) processAckMsgLocked(sseq, dseq, dc uint64, reply string, doSa
 			}
 			delete(o.pending, seq)
 			delete(o.rdc, seq)
+			delete(o.nakr, seq)
+			o.dly.remove(seq)
+			o.prio.remove(seq)
 			o.removeFromRedeliverQueue(seq)
 		}
 		// Determine if smarter to walk all of pending vs the sequence range.
@@ -3936,7 +4199,8 @@ func (o *consumer) isFiltered() bool {
 
 // Check if we need an ack for this store seq.
 // This is called for interest based retention streams to remove messages.
-func (o *consumer) needAck(sseq uint64, subj string) bool {
+// The headers are only used with a subject, when the caller already loaded the message.
+func (o *consumer) needAck(sseq uint64, subj string, hdr []byte) bool {
 	var needAck bool
 	var asflr, osseq uint64
 	var pending map[uint64]*Pending
@@ -3962,6 +4226,24 @@ func (o *consumer) needAck(sseq uint64, subj string) bool {
 			return false
 		}
 	}
+	// Messages that don't match our header filter are never delivered.
+	// Only load the message if the caller did not already.
+	if o.hf != nil {
+		if subj == _EMPTY_ {
+			if o.mset == nil {
+				return false
+			}
+			var smv StoreMsg
+			sm, err := o.mset.store.LoadMsg(sseq, &smv)
+			if err != nil {
+				return false
+			}
+			hdr = sm.hdr
+		}
+		if !o.hf.match(hdr) {
+			return false
+		}
+	}
 	if o.isLeader() {
 		asflr, osseq = o.asflr, o.sseq
 		pending, rdc = o.pending, o.rdc
@@ -4123,6 +4405,7 @@ type waitQueue struct {
 	last   time.Time
 	head   *waitingRequest
 	tail   *waitingRequest
+	groups map[string]int // Number of requests waiting per priority group.
 }
 
 // Create a new ring buffer with at most max items.
@@ -4158,6 +4441,7 @@ func (wq *waitQueue) addPrioritized(wr *waitingRequest) error {
 
 	wq.insertSorted(wr)
 	wq.n++
+	wq.countGroup(wr, 1)
 	wq.last = wr.received
 	return nil
 }
@@ -4183,9 +4467,34 @@ func (wq *waitQueue) add(wr *waitingRequest) error {
 	// Track last active via when we receive a request.
 	wq.last = wr.received
 	wq.n++
+	wq.countGroup(wr, 1)
 	return nil
 }
 
+// Tracks the number of requests waiting for the priority group of wr, if any.
+func (wq *waitQueue) countGroup(wr *waitingRequest, delta int) {
+	if wr.priorityGroup == nil || wr.priorityGroup.Group == _EMPTY_ {
+		return
+	}
+	group := wr.priorityGroup.Group
+	if n := wq.groups[group] + delta; n > 0 {
+		if wq.groups == nil {
+			wq.groups = make(map[string]int)
+		}
+		wq.groups[group] = n
+	} else {
+		delete(wq.groups, group)
+	}
+}
+
+// Returns whether any requests for the priority group are waiting.
+func (wq *waitQueue) hasGroup(group string) bool {
+	if wq == nil {
+		return false
+	}
+	return wq.groups[group] > 0
+}
+
 func (wq *waitQueue) isFull() bool {
 	if wq == nil {
 		return false
@@ -4349,6 +4658,7 @@ func (wq *waitQueue) remove(pre, wr *waitingRequest) {
 		}
 	}
 	wq.n--
+	wq.countGroup(wr, -1)
 }
 
 // Return the map of pending requests keyed by the reply subject.
@@ -4406,6 +4716,106 @@ func (o *consumer) unassignPinId() {
 	}
 }
 
+// weightedGroupState is the state of a priority group with the weighted
+// priority policy.
+type weightedGroupState struct {
+	credit    int64
+	delivered uint64
+}
+
+// Returns whether each of the priority groups, in config order, has requests
+// in the wait queue.
+// Lock should be held.
+func (o *consumer) waitingPriorityGroups() []bool {
+	waiting := make([]bool, len(o.cfg.PriorityGroups))
+	for i, group := range o.cfg.PriorityGroups {
+		waiting[i] = o.waiting.hasGroup(group)
+	}
+	return waiting
+}
+
+// Returns the index of the priority group to serve next with the weighted
+// policy, or -1 if no group has waiting requests. This is a smooth weighted
+// round-robin among the groups with waiting requests, so that the share of a
+// group without requests is redistributed to the others.
+// Lock should be held.
+func (o *consumer) selectWeightedGroup(waiting []bool) int {
+	sel, selCredit := -1, int64(0)
+	for i, group := range o.cfg.PriorityGroups {
+		if !waiting[i] {
+			continue
+		}
+		credit := int64(o.cfg.PriorityWeights[group])
+		if gs := o.pgw[group]; gs != nil {
+			credit += gs.credit
+		}
+		if sel < 0 || credit > selCredit {
+			sel, selCredit = i, credit
+		}
+	}
+	return sel
+}
+
+// Updates the weighted policy state after a message is delivered to a
+// request of the given priority group.
+// Lock should be held.
+func (o *consumer) chargeWeightedGroup(group string) {
+	if o.pgw == nil {
+		o.pgw = make(map[string]*weightedGroupState, len(o.cfg.PriorityGroups))
+	}
+	waiting := o.waitingPriorityGroups()
+	var total int64
+	for i, g := range o.cfg.PriorityGroups {
+		gs := o.pgw[g]
+		if gs == nil {
+			gs = &weightedGroupState{}
+			o.pgw[g] = gs
+		}
+		// Groups without waiting requests do not accumulate credit.
+		if !waiting[i] {
+			gs.credit = 0
+			continue
+		}
+		w := int64(o.cfg.PriorityWeights[g])
+		gs.credit += w
+		total += w
+	}
+	if gs := o.pgw[group]; gs != nil {
+		gs.credit -= total
+		gs.delivered++
+	}
+}
+
+// Cycles the wait queue until its head is the next request of the priority
+// group to serve with the weighted policy, and returns it. Requests without a
+// priority group are only served when no group has waiting requests.
+// Lock should be held.
+func (o *consumer) rotateToWeightedGroup() *waitingRequest {
+	sel := o.selectWeightedGroup(o.waitingPriorityGroups())
+	if sel < 0 {
+		return o.waiting.peek()
+	}
+	group := o.cfg.PriorityGroups[sel]
+	for i, n := 0, o.waiting.len(); i < n; i++ {
+		if wr := o.waiting.peek(); wr.priorityGroup != nil && wr.priorityGroup.Group == group {
+			return wr
+		}
+		o.waiting.cycle()
+	}
+	return o.waiting.peek()
+}
+
+// Pops the request at the head of the wait queue to deliver a message to it.
+// Lock should be held.
+func (o *consumer) popWaiting() *waitingRequest {
+	if o.cfg.PriorityPolicy == PriorityWeighted {
+		if wr := o.waiting.peek(); wr != nil && wr.priorityGroup != nil {
+			o.chargeWeightedGroup(wr.priorityGroup.Group)
+		}
+	}
+	return o.waiting.popOrPopAndRequeue(o.cfg.PriorityPolicy)
+}
+
 // Return next waiting request. This will check for expirations but not noWait or interest.
 // That will be handled by processWaiting.
 // Lock should be held.
@@ -4422,6 +4832,9 @@ func (o *consumer) nextWaiting(sz int) *waitingRequest {
 		if wr == nil {
 			break
 		}
+		if o.cfg.PriorityPolicy == PriorityWeighted {
+			wr = o.rotateToWeightedGroup()
+		}
 
 		if wr.expires.IsZero() || time.Now().Before(wr.expires) {
 			// Track whether this iteration just claimed a new pin for this request.
@@ -4497,7 +4910,7 @@ func (o *consumer) nextWaiting(sz int) *waitingRequest {
 					// notify that we are closing the request.
 					const maxBytesT = "NATS/1.0 409 Message Size Exceeds MaxBytes\r\n%s: %d\r\n%s: %d\r\n\r\n"
 					hdr := fmt.Appendf(nil, maxBytesT, JSPullRequestPendingMsgs, wr.n, JSPullRequestPendingBytes, wr.b)
-					o.outq.send(newJSPubMsg(wr.reply, _EMPTY_, _EMPTY_, hdr, nil, nil, 0))
+					o.sendPullStatus(wr.reply, hdr)
 					// If we just claimed the pin for this request, release it.
 					if assignedPin {
 						o.unassignPinId()
@@ -4513,11 +4926,11 @@ func (o *consumer) nextWaiting(sz int) *waitingRequest {
 			}
 
 			if wr.acc.sl.HasInterest(wr.interest) {
-				return o.waiting.popOrPopAndRequeue(o.cfg.PriorityPolicy)
+				return o.popWaiting()
 			} else if time.Since(wr.received) < defaultGatewayRecentSubExpiration && (o.srv.leafNodeEnabled || o.srv.gateway.enabled) {
-				return o.waiting.popOrPopAndRequeue(o.cfg.PriorityPolicy)
+				return o.popWaiting()
 			} else if o.srv.gateway.enabled && o.srv.hasGatewayInterest(wr.acc.Name, wr.interest) {
-				return o.waiting.popOrPopAndRequeue(o.cfg.PriorityPolicy)
+				return o.popWaiting()
 			}
 		} else {
 			// We do check for expiration in `processWaiting`, but it is possible to hit the expiry here, and not there.
@@ -4532,7 +4945,7 @@ func (o *consumer) nextWaiting(sz int) *waitingRequest {
 			}
 			if !rdWait {
 				hdr := fmt.Appendf(nil, "NATS/1.0 408 Request Timeout\r\n%s: %d\r\n%s: %d\r\n\r\n", JSPullRequestPendingMsgs, wr.n, JSPullRequestPendingBytes, wr.b)
-				o.outq.send(newJSPubMsg(wr.reply, _EMPTY_, _EMPTY_, hdr, nil, nil, 0))
+				o.sendPullStatus(wr.reply, hdr)
 			}
 			o.waiting.removeCurrent()
 			if o.node != nil {
@@ -4545,7 +4958,7 @@ func (o *consumer) nextWaiting(sz int) *waitingRequest {
 		if wr.interest != wr.reply {
 			const intExpT = "NATS/1.0 408 Interest Expired\r\n%s: %d\r\n%s: %d\r\n\r\n"
 			hdr := fmt.Appendf(nil, intExpT, JSPullRequestPendingMsgs, wr.n, JSPullRequestPendingBytes, wr.b)
-			o.outq.send(newJSPubMsg(wr.reply, _EMPTY_, _EMPTY_, hdr, nil, nil, 0))
+			o.sendPullStatus(wr.reply, hdr)
 		}
 		// Remove the current one, no longer valid.
 		o.waiting.removeCurrent()
@@ -4672,7 +5085,7 @@ func (o *consumer) processNextMsgRequest(reply string, msg []byte) {
 
 	sendErr := func(status int, description string) {
 		hdr := fmt.Appendf(nil, "NATS/1.0 %d %s\r\n\r\n", status, description)
-		o.outq.send(newJSPubMsg(reply, _EMPTY_, _EMPTY_, hdr, nil, nil, 0))
+		o.sendPullStatus(reply, hdr)
 	}
 
 	if o.isPushMode() || o.waiting == nil {
@@ -4703,6 +5116,17 @@ func (o *consumer) processNextMsgRequest(reply string, msg []byte) {
 		return
 	}
 
+	// Partitions of a partitioned stream each serve their share of the request.
+	if o.partitions > 0 {
+		if batchSize, maxBytes = o.pullRequestShare(reply, batchSize, maxBytes); batchSize == 0 {
+			return
+		}
+		// Stop before the partition replying with the status does, so it's sent after our messages.
+		if !o.repliesToPull(reply) && !expires.IsZero() && time.Until(expires) > 2*partitionPullMargin {
+			expires = expires.Add(-partitionPullMargin)
+		}
+	}
+
 	if priorityGroup != nil {
 		if (priorityGroup.MinPending != 0 || priorityGroup.MinAckPending != 0) && o.cfg.PriorityPolicy != PriorityOverflow {
 			sendErr(400, "Bad Request - Not a Overflow Priority consumer")
@@ -4851,9 +5275,15 @@ func (o *consumer) incDeliveryCount(sseq uint64) uint64 {
 // Lock should be held.
 func (o *consumer) decDeliveryCount(sseq uint64) {
 	if o.rdc == nil {
-		o.rdc = make(map[uint64]uint64)
+		return
+	}
+	if rdc, ok := o.rdc[sseq]; ok {
+		if rdc <= 1 {
+			delete(o.rdc, sseq)
+		} else {
+			o.rdc[sseq] = rdc - 1
+		}
 	}
-	o.rdc[sseq] -= 1
 }
 
 // send a delivery exceeded advisory.
@@ -4874,6 +5304,246 @@ func (o *consumer) notifyDeliveryExceeded(sseq, dc uint64) {
 	o.sendAdvisory(o.deliveryExcEventT, e)
 }
 
+// expandDeadLetterSubject fills in the placeholders of a dead letter subject.
+func expandDeadLetterSubject(subject, stream, consumer, subj string) string {
+	if !strings.Contains(subject, "{{") {
+		return subject
+	}
+	return strings.NewReplacer("{{stream}}", stream, "{{consumer}}", consumer, "{{subject}}", subj).Replace(subject)
+}
+
+// checkDeadLetterStream checks that the dead letter stream exists and stores the dead letter subject.
+// Names that are invalid, or point to the consumer's own stream, are left for checkConsumerCfg.
+// The consumer name can be empty if not yet known, then it matches any consumer.
+func checkDeadLetterStream(dl *ConsumerDeadLetter, dlcfg *StreamConfig, stream, consumer string) *ApiError {
+	if dl == nil || !isValidName(dl.Stream) || dl.Stream == stream {
+		return nil
+	}
+	if dlcfg == nil {
+		return NewJSConsumerDeadLetterInvalidError(fmt.Errorf("stream %q not found", dl.Stream))
+	}
+	if consumer == _EMPTY_ {
+		consumer = "{{consumer}}"
+	}
+	// Placeholders that are not known yet are turned into wildcards.
+	tokens := strings.Split(expandDeadLetterSubject(dl.Subject, stream, consumer, "{{subject}}"), tsep)
+	for i, tk := range tokens {
+		if tk == "{{subject}}" && i == len(tokens)-1 {
+			tokens[i] = fwcs
+		} else if strings.Contains(tk, "{{") {
+			tokens[i] = pwcs
+		}
+	}
+	subj := strings.Join(tokens, tsep)
+	for _, ssubj := range dlcfg.Subjects {
+		if SubjectsCollide(subj, ssubj) {
+			return nil
+		}
+	}
+	return NewJSConsumerDeadLetterInvalidError(fmt.Errorf("stream %q does not store subject %q", dl.Stream, dl.Subject))
+}
+
+// How long we wait for the dead letter stream to acknowledge a copy.
+const deadLetterPubAckWait = 10 * time.Second
+
+// deadLetterPub is a copy sent to the dead letter stream that we wait on the PubAck for.
+type deadLetterPub struct {
+	sseq   uint64
+	dseq   uint64
+	dc     uint64
+	cause  string // Why the message is dead lettered.
+	term   bool   // Terminate the original once the copy was stored.
+	reason string // Reason to terminate the original with.
+	reply  string // Ack reply to respond to once terminated.
+	tmr    *time.Timer
+}
+
+// deadLetter copies the original message into the dead letter stream, if configured.
+// The copy uses a message ID derived from the stream, consumer and sequence, so it is
+// only stored once even if a new leader routes the same message again.
+// The copy is sent as a request, if the original needs to be terminated that only happens
+// once the dead letter stream acknowledged the copy. Returns if the copy was sent.
+// Lock should be held.
+func (o *consumer) deadLetter(dlp *deadLetterPub, reason string) bool {
+	dl := o.cfg.DeadLetter
+	if dl == nil || o.mset == nil || o.mset.store == nil || o.outq == nil {
+		return false
+	}
+	sseq := dlp.sseq
+	defer delete(o.nakr, sseq)
+
+	var smv StoreMsg
+	sm, err := o.mset.store.LoadMsg(sseq, &smv)
+	if err != nil || sm == nil {
+		return false
+	}
+
+	if o.dlSub == nil {
+		o.dlPre = fmt.Sprintf(jsDeadLetterAckT, o.stream, o.name)
+		if o.dlSub, err = o.subscribeInternal(o.dlPre+".*", o.processDeadLetterAck); err != nil {
+			o.srv.Warnf("JetStream consumer '%s > %s > %s' could not dead letter message %d: %v", o.acc.Name, o.stream, o.name, sseq, err)
+			return false
+		}
+	}
+
+	// Copy, as this is retrieved directly from storage.
+	hdr, msg := copyBytes(sm.hdr), copyBytes(sm.msg)
+
+	// Strip headers that could prevent persisting the copy, or change how it's stored.
+	hdr = removeHeaderIfPrefixPresent(hdr, "Nats-Expected-")
+	hdr = removeHeaderIfPrefixPresent(hdr, "Nats-Batch-")
+	hdr = removeHeaderIfPrefixPresent(hdr, "Nats-Schedule")
+	hdr = removeHeaderIfPrefixPresent(hdr, "Nats-Dead-Letter-")
+	for _, key := range []string{JSMsgId, JSMsgRollup, JSMessageTTL, JSMessageIncr, JSStream, JSSubject, JSSequence, JSTimeStamp} {
+		hdr = removeHeaderIfPresent(hdr, key)
+	}
+
+	// Add headers describing where the message came from.
+	hdr = genHeader(hdr, JSMsgId, fmt.Sprintf("%s.%s.%d", o.stream, o.name, sseq))
+	hdr = genHeader(hdr, JSExpectedStream, dl.Stream)
+	hdr = genHeader(hdr, JSStream, o.stream)
+	hdr = genHeader(hdr, JSSubject, sm.subj)
+	hdr = genHeader(hdr, JSSequence, strconv.FormatUint(sseq, 10))
+	hdr = genHeader(hdr, JSTimeStamp, time.Unix(0, sm.ts).UTC().Format(time.RFC3339Nano))
+	hdr = genHeader(hdr, JSDeadLetterConsumer, o.name)
+	hdr = genHeader(hdr, JSDeadLetterDeliveries, strconv.FormatUint(dlp.dc, 10))
+	hdr = genHeader(hdr, JSDeadLetterCause, dlp.cause)
+	if reason != _EMPTY_ {
+		hdr = genHeader(hdr, JSDeadLetterReason, reason)
+	}
+
+	if o.dlq == nil {
+		o.dlq = make(map[string]*deadLetterPub)
+	}
+	token := nuid.Next()
+	dlp.tmr = time.AfterFunc(deadLetterPubAckWait, func() { o.deadLetterTimeout(token) })
+	o.dlq[token] = dlp
+
+	subj := expandDeadLetterSubject(dl.Subject, o.stream, o.name, sm.subj)
+	o.outq.send(newJSPubMsg(subj, _EMPTY_, o.dlPre+"."+token, hdr, msg, nil, 0))
+	return true
+}
+
+// processDeadLetterAck processes the PubAck for a copy sent to the dead letter stream.
+func (o *consumer) processDeadLetterAck(_ *subscription, c *client, _ *Account, subject, _ string, rmsg []byte) {
+	_, msg := c.msgParts(rmsg)
+	var resp JSPubAckResponse
+	err := json.Unmarshal(msg, &resp)
+	if err == nil {
+		err = resp.ToError()
+	}
+	token := subject[strings.LastIndexByte(subject, btsep)+1:]
+
+	o.mu.Lock()
+	dlp := o.dlq[token]
+	if dlp == nil {
+		o.mu.Unlock()
+		return
+	}
+	delete(o.dlq, token)
+	dlp.tmr.Stop()
+	term := dlp.term
+	if err != nil {
+		term = o.deadLetterFailed(dlp, err)
+	}
+	o.mu.Unlock()
+
+	if term {
+		o.deadLetterTerminate(dlp)
+	}
+}
+
+// deadLetterTimeout gives up on a copy the dead letter stream did not acknowledge in time.
+func (o *consumer) deadLetterTimeout(token string) {
+	o.mu.Lock()
+	dlp := o.dlq[token]
+	if dlp == nil {
+		o.mu.Unlock()
+		return
+	}
+	delete(o.dlq, token)
+	term := o.deadLetterFailed(dlp, errors.New("timed out waiting for the dead letter stream"))
+	o.mu.Unlock()
+
+	if term {
+		o.deadLetterTerminate(dlp)
+	}
+}
+
+// deadLetterFailed sends an advisory for a message that could not be dead lettered.
+// Messages terminated with AckTerm are still terminated, as the client asked for,
+// otherwise the original is either redelivered or stays in the stream.
+// Returns whether the original should be terminated.
+// Lock should be held.
+func (o *consumer) deadLetterFailed(dlp *deadLetterPub, err error) bool {
+	o.srv.Warnf("JetStream consumer '%s > %s > %s' failed to dead letter message %d: %v", o.acc.Name, o.stream, o.name, dlp.sseq, err)
+	e := JSConsumerDeadLetterFailedAdvisory{
+		TypedEvent: TypedEvent{
+			Type: JSConsumerDeadLetterFailedAdvisoryType,
+			ID:   nuid.Next(),
+			Time: time.Now().UTC(),
+		},
+		Stream:      o.stream,
+		Consumer:    o.name,
+		ConsumerSeq: dlp.dseq,
+		StreamSeq:   dlp.sseq,
+		Deliveries:  dlp.dc,
+		Cause:       dlp.cause,
+		Error:       err.Error(),
+		Domain:      o.srv.getOpts().JetStreamDomain,
+	}
+	o.sendAdvisory(JSAdvisoryConsumerDeadLetterFailedPre+"."+o.stream+"."+o.name, e)
+	return dlp.cause == JSDeadLetterCauseTerminated
+}
+
+// deadLetterTerminate terminates the original of a dead lettered message,
+// and responds to the AckTerm if it asked for a reply.
+func (o *consumer) deadLetterTerminate(dlp *deadLetterPub) {
+	if o.processTerm(dlp.sseq, dlp.dseq, dlp.dc, dlp.reason, dlp.reply) && dlp.reply != _EMPTY_ {
+		o.sendAckReply(dlp.reply)
+	}
+}
+
+// Stops waiting for the PubAcks of dead lettered copies.
+// Lock should be held.
+func (o *consumer) clearDeadLetterPubs() {
+	o.unsubscribe(o.dlSub)
+	o.dlSub = nil
+	for _, dlp := range o.dlq {
+		dlp.tmr.Stop()
+	}
+	o.dlq = nil
+}
+
+// deadLetterTerm dead letters a message terminated with AckTerm, if configured.
+// Returns true if the message was dead lettered, the original is then terminated
+// once the copy is stored, or the copy failed.
+func (o *consumer) deadLetterTerm(sseq, dseq, dc uint64, reason, reply string) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if dl := o.cfg.DeadLetter; dl == nil || !dl.OnTerm {
+		return false
+	}
+	// Only if still pending, otherwise it was already acked or terminated.
+	if _, ok := o.pending[sseq]; !ok {
+		return false
+	}
+	dlp := &deadLetterPub{sseq: sseq, dseq: dseq, dc: dc, cause: JSDeadLetterCauseTerminated, term: true, reason: reason, reply: reply}
+	return o.deadLetter(dlp, reason)
+}
+
+// deadLetterMaxDeliveries dead letters a message that exhausted MaxDeliver,
+// and terminates the original once stored if configured.
+// Lock should be held.
+func (o *consumer) deadLetterMaxDeliveries(sseq, dseq, dc uint64) {
+	dl := o.cfg.DeadLetter
+	if dl == nil {
+		return
+	}
+	dlp := &deadLetterPub{sseq: sseq, dseq: dseq, dc: dc, cause: JSDeadLetterCauseMaxDeliveries, term: dl.TermOriginal, reason: ackTermDeadLetterReason}
+	o.deadLetter(dlp, o.nakr[sseq])
+}
+
 // Check if the candidate subject matches a filter if its present.
 // Lock should be held.
 func (o *consumer) isFilteredMatch(subj string) bool {
@@ -4939,6 +5609,11 @@ func (o *consumer) getNextMsg() (*jsPubMsg, uint64, error) {
 				// Only send once
 				if dc == o.maxdc+1 {
 					o.notifyDeliveryExceeded(seq, dc-1)
+					var dseq uint64
+					if p, ok := o.pending[seq]; ok && p != nil {
+						dseq = p.Sequence
+					}
+					o.deadLetterMaxDeliveries(seq, dseq, dc-1)
 				}
 				// Make sure to remove from pending.
 				if p, ok := o.pending[seq]; ok && p != nil {
@@ -4975,14 +5650,36 @@ func (o *consumer) getNextMsg() (*jsPubMsg, uint64, error) {
 		}
 	}
 
+	// Delayed messages that are due are delivered for the first time, they're already pending.
+	for seq := o.dly.nextDue(); seq > 0; seq = o.dly.nextDue() {
+		p, ok := o.pending[seq]
+		if !ok {
+			continue
+		}
+		pmsg := getJSPubMsgFromPool()
+		sm, err := o.mset.store.LoadMsg(seq, &pmsg.StoreMsg)
+		if sm == nil || err != nil {
+			pmsg.returnToPool()
+			// The message was removed in the meantime, it will never be delivered.
+			o.processAckMsgLocked(seq, p.Sequence, 1, _EMPTY_, false, false)
+			continue
+		}
+		o.npc++
+		return pmsg, 1, nil
+	}
+
 	// Check if we have max pending.
+	// Messages we hold back count as well, so deliver the most urgent one if we hold any.
 	if o.maxp > 0 && len(o.pending) >= o.maxp {
+		if o.prio.len() > 0 {
+			return o.nextPriorityMsg()
+		}
 		// maxp only set when ack policy != AckNone and user set MaxAckPending
 		// Stall if we have hit max pending.
 		return nil, 0, errMaxAckPending
 	}
 
-	if o.hasSkipListPending() {
+	for o.hasSkipListPending() {
 		seq := o.lss.seqs[0]
 		if len(o.lss.seqs) == 1 {
 			o.sseq = o.lss.resume
@@ -4999,40 +5696,252 @@ func (o *consumer) getNextMsg() (*jsPubMsg, uint64, error) {
 			pmsg = nil
 		}
 		o.sseq++
+		if o.hf != nil && sm != nil && !o.hf.match(sm.hdr) {
+			pmsg.returnToPool()
+			o.skipHeaderFiltered(seq)
+			continue
+		}
 		return pmsg, 1, err
 	}
 
-	var sseq uint64
-	var err error
-	var sm *StoreMsg
-	var pmsg = getJSPubMsgFromPool()
-
-	// Grab next message applicable to us.
-	filters, subjf, fseq := o.filters, o.subjf, o.sseq
-	// Check if we are multi-filtered or not.
-	if filters != nil {
-		sm, sseq, err = o.mset.store.LoadNextMsgMulti(filters, fseq, &pmsg.StoreMsg)
-	} else if len(subjf) > 0 { // Means single filtered subject since o.filters means > 1.
-		filter, wc := subjf[0].subject, subjf[0].hasWildcard
-		sm, sseq, err = o.mset.store.LoadNextMsg(filter, wc, fseq, &pmsg.StoreMsg)
+	holdDelayed, holdPriority := o.holdsDelayedMsgs(), o.cfg.MsgPriority
+	for held := 0; ; {
+		// Deliver the most urgent message once our priority window is full.
+		if holdPriority && o.prio.len() >= o.msgPriorityWindow() {
+			return o.nextPriorityMsg()
+		}
+		if held > 0 && o.maxp > 0 && len(o.pending) >= o.maxp {
+			if holdPriority {
+				return o.nextPriorityMsg()
+			}
+			return nil, 0, errMaxAckPending
+		}
+		// Don't scan past too many held messages while holding our lock, continue after a signal.
+		if held >= maxHeldMsgsScan {
+			o.signalNewMessages()
+			return nil, 0, ErrStoreEOF
+		}
+		// Nothing after our view's last sequence is visible to us.
+		if o.beyondView(o.sseq) {
+			if holdPriority {
+				return o.nextPriorityMsg()
+			}
+			return nil, 0, ErrStoreEOF
+		}
+
+		var sseq uint64
+		var err error
+		var sm *StoreMsg
+		var pmsg = getJSPubMsgFromPool()
+
+		// Grab next message applicable to us.
+		filters, subjf, fseq := o.filters, o.subjf, o.sseq
+		// Check if we are multi-filtered or not.
+		if filters != nil {
+			sm, sseq, err = o.mset.store.LoadNextMsgMulti(filters, fseq, &pmsg.StoreMsg)
+		} else if len(subjf) > 0 { // Means single filtered subject since o.filters means > 1.
+			filter, wc := subjf[0].subject, subjf[0].hasWildcard
+			sm, sseq, err = o.mset.store.LoadNextMsg(filter, wc, fseq, &pmsg.StoreMsg)
+		} else {
+			// No filter here.
+			sm, sseq, err = o.mset.store.LoadNextMsg(_EMPTY_, false, fseq, &pmsg.StoreMsg)
+		}
+		if sm == nil {
+			pmsg.returnToPool()
+			pmsg = nil
+		} else if o.beyondView(sm.seq) {
+			pmsg.returnToPool()
+			o.sseq = o.vseq + 1
+			if holdPriority {
+				return o.nextPriorityMsg()
+			}
+			return nil, 0, ErrStoreEOF
+		}
+		// Check if we should move our o.sseq.
+		if sseq >= o.sseq {
+			// If we are moving step by step then sseq == o.sseq.
+			// If we have jumped we should update skipped for other replicas.
+			if sseq != o.sseq && err == ErrStoreEOF {
+				o.updateSkipped(sseq + 1)
+			}
+			o.sseq = sseq + 1
+		}
+		// Skip messages that do not match our header filter.
+		if o.hf != nil && sm != nil && !o.hf.match(sm.hdr) {
+			pmsg.returnToPool()
+			o.skipHeaderFiltered(sm.seq)
+			continue
+		}
+		// Hold back delayed messages that are not due yet, and move on to the next one.
+		if holdDelayed && sm != nil && o.holdDelayedMsg(sm) {
+			pmsg.returnToPool()
+			held++
+			continue
+		}
+		// Hold back all messages when delivering by priority, until our window is full or nothing is left.
+		if holdPriority {
+			if sm != nil {
+				o.holdPriorityMsg(sm)
+				pmsg.returnToPool()
+				held++
+				continue
+			}
+			if o.prio.len() > 0 {
+				return o.nextPriorityMsg()
+			}
+		}
+		return pmsg, 1, err
+	}
+}
+
+// beyondView returns whether the stream sequence is after our view's last sequence.
+// Lock should be held.
+func (o *consumer) beyondView(seq uint64) bool {
+	return o.cfg.View != _EMPTY_ && seq > o.vseq
+}
+
+// Returns true if we have a header filter.
+func (o *consumer) hasHeaderFilter() bool {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	return o.hf != nil
+}
+
+// skipHeaderFiltered skips a message that does not match our header filter. It is never delivered,
+// so for interest based streams it's acked like AckNone deliveries are, replicated if we're clustered.
+// needAck reports no interest for it on all replicas, regardless of our ack floors.
+// Lock should be held.
+func (o *consumer) skipHeaderFiltered(seq uint64) {
+	o.npc--
+	if o.retention == LimitsPolicy {
+		return
+	}
+	if mset := o.mset; mset != nil && mset.ackq != nil && (o.node == nil || o.direct) {
+		mset.ackq.push(seq)
 	} else {
-		// No filter here.
-		sm, sseq, err = o.mset.store.LoadNextMsg(_EMPTY_, false, fseq, &pmsg.StoreMsg)
+		o.updateAcks(o.dseq-1, seq, _EMPTY_)
 	}
-	if sm == nil {
-		pmsg.returnToPool()
-		pmsg = nil
+}
+
+// msgDelayConsumerOk returns whether the consumer can be used on a stream with message delays.
+// Delayed messages are tracked as pending until delivered, so they need explicit acks.
+// Direct consumers for mirrors and sources pass messages on, the stream they go to holds them back.
+func msgDelayConsumerOk(config *ConsumerConfig) bool {
+	return config.AckPolicy == AckExplicit || config.Direct
+}
+
+// Returns whether messages that are not due yet are held back by this consumer.
+// Consumers on streams with message delays require explicit acks, except for direct consumers,
+// which pass delayed messages on right away.
+// Lock should be held.
+func (o *consumer) holdsDelayedMsgs() bool {
+	if o.cfg.AckPolicy != AckExplicit || o.mset == nil {
+		return false
+	}
+	o.mset.cfgMu.RLock()
+	defer o.mset.cfgMu.RUnlock()
+	return o.mset.cfg.AllowMsgDelay
+}
+
+// holdDelayedMsg will hold back the message if it's not due yet. The message is tracked as
+// pending so it's part of our replicated state, and the ack floor can't move past it.
+// Returns whether the message was held back.
+// Lock should be held.
+func (o *consumer) holdDelayedMsg(sm *StoreMsg) bool {
+	if len(sm.hdr) == 0 {
+		return false
+	}
+	deliverAt, _ := getMessageDeliverAt(sm.hdr, sm.ts)
+	if deliverAt <= time.Now().UnixNano() {
+		return false
+	}
+	dseq := o.dseq
+	o.dseq++
+	// Backdate the pending timestamp so a new leader redelivers the message
+	// once due, even if it doesn't know it was held back.
+	wait := o.cfg.AckWait
+	if len(o.cfg.BackOff) > 0 {
+		wait = o.cfg.BackOff[0]
+	}
+	ts := deliverAt - int64(o.ackWait(wait))
+	o.updateDelivered(dseq, sm.seq, 1, ts)
+	if o.pending == nil {
+		o.pending = make(map[uint64]*Pending)
+	}
+	o.pending[sm.seq] = &Pending{dseq, ts}
+	o.npc--
+	if o.dly == nil {
+		o.dly = newMsgDelays(o.releaseDelayedMsgs)
+	}
+	o.dly.add(sm.seq, deliverAt)
+	return true
+}
+
+// restoreDelayedMsgs holds back pending messages that are not due yet.
+// Used when becoming leader, since delayed messages are not tracked by our store.
+// Lock should be held.
+func (o *consumer) restoreDelayedMsgs() {
+	if len(o.pending) == 0 || !o.holdsDelayedMsgs() {
+		return
 	}
-	// Check if we should move our o.sseq.
-	if sseq >= o.sseq {
-		// If we are moving step by step then sseq == o.sseq.
-		// If we have jumped we should update skipped for other replicas.
-		if sseq != o.sseq && err == ErrStoreEOF {
-			o.updateSkipped(sseq + 1)
+	var smv StoreMsg
+	now := time.Now().UnixNano()
+	for seq := range o.pending {
+		sm, err := o.mset.store.LoadMsg(seq, &smv)
+		if err != nil || sm == nil || len(sm.hdr) == 0 {
+			continue
+		}
+		if deliverAt, _ := getMessageDeliverAt(sm.hdr, sm.ts); deliverAt > now {
+			if o.dly == nil {
+				o.dly = newMsgDelays(o.releaseDelayedMsgs)
+			}
+			o.dly.add(seq, deliverAt)
 		}
-		o.sseq = sseq + 1
 	}
-	return pmsg, 1, err
+}
+
+// releaseDelayedMsgs is called when delayed messages become due.
+// They are queued up for delivery, but will count as their first delivery.
+func (o *consumer) releaseDelayedMsgs() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.closed || o.dly == nil || !o.isLeader() {
+		return
+	}
+	var released bool
+	o.dly.expire(func(seq uint64) {
+		if _, ok := o.pending[seq]; !ok {
+			return
+		}
+		o.dly.queueDue(seq)
+		released = true
+	})
+	if released {
+		o.signalNewMessages()
+	}
+}
+
+// requeueDueMsg queues up a delayed message again if it could not be delivered after all.
+// Returns false if the message was not a delayed one.
+// Lock should be held.
+func (o *consumer) requeueDueMsg(seq uint64) bool {
+	if o.dly == nil {
+		return false
+	}
+	// Other first deliveries are not pending yet.
+	if _, ok := o.pending[seq]; !ok {
+		return false
+	}
+	o.dly.queueDue(seq)
+	return true
+}
+
+// numAckPending returns the number of messages that are delivered but not acked yet.
+// Delayed and held priority messages are tracked as pending, but are not delivered yet.
+// They do count toward MaxAckPending, which bounds how many messages we hold back.
+// Lock should be held.
+func (o *consumer) numAckPending() int {
+	return max(len(o.pending)-o.dly.len()-o.prio.len(), 0)
 }
 
 // Will check for expiration and lack of interest on waiting requests.
@@ -5082,14 +5991,14 @@ func (o *consumer) processWaiting(eos bool) (int, int, int, time.Time) {
 			// Normally it's a timeout.
 			if expires {
 				hdr := fmt.Appendf(nil, "NATS/1.0 408 Request Timeout\r\n%s: %d\r\n%s: %d\r\n\r\n", JSPullRequestPendingMsgs, wr.n, JSPullRequestPendingBytes, wr.b)
-				o.outq.send(newJSPubMsg(wr.reply, _EMPTY_, _EMPTY_, hdr, nil, nil, 0))
+				o.sendPullStatus(wr.reply, hdr)
 				wr = remove(pre, wr)
 				continue
 			} else if wr.expires.IsZero() || wr.d > 0 {
 				// But if we're NoWait without expiry, we've reached the end of the stream, and we've not delivered any messages.
 				// Return no messages instead, which is the same as if we'd rejected the pull request initially.
 				hdr := fmt.Appendf(nil, "NATS/1.0 404 No Messages\r\n\r\n")
-				o.outq.send(newJSPubMsg(wr.reply, _EMPTY_, _EMPTY_, hdr, nil, nil, 0))
+				o.sendPullStatus(wr.reply, hdr)
 				wr = remove(pre, wr)
 				continue
 			}
@@ -5457,7 +6366,7 @@ func (o *consumer) loopAndGatherMsgs(qch chan struct{}) {
 			o.npc--
 		}
 		// Pre-calculate ackReply
-		ackReply = o.ackReply(pmsg.seq, o.dseq, dc, pmsg.ts, o.numPending())
+		ackReply = o.ackReply(pmsg.seq, o.nextDeliverySeq(pmsg.seq), dc, pmsg.ts, o.numPending())
 
 		// If headers only do not send msg payload.
 		// Add in msg size itself as header.
@@ -5488,6 +6397,12 @@ func (o *consumer) loopAndGatherMsgs(qch chan struct{}) {
 			// Need to also test that this is not going backwards since if
 			// we fail to deliver we can end up here from rdq but we do not
 			// want to decrement o.sseq if that is the case.
+			if dc == 1 && (o.requeuePriorityMsg(pmsg) || o.requeueDueMsg(pmsg.seq)) {
+				// Held back again until the next request, num pending was already adjusted.
+				pmsg.returnToPool()
+				pmsg = nil
+				goto waitForMsgs
+			}
 			if dc == 1 && pmsg.seq == o.sseq-1 {
 				o.sseq--
 				o.npc++
@@ -5542,7 +6457,8 @@ func (o *consumer) loopAndGatherMsgs(qch chan struct{}) {
 		o.deliverMsg(dsubj, ackReply, pmsg, dc, rp)
 
 		// If given request fulfilled batch size, but there are still pending bytes, send information about it.
-		if wrn <= 0 && wrb > 0 {
+		// Partitions only serve their share of the batch, the request completes once all are done.
+		if wrn <= 0 && wrb > 0 && o.partitions == 0 {
 			msg := fmt.Appendf(nil, JsPullRequestRemainingBytesT, JSPullRequestPendingMsgs, wrn, JSPullRequestPendingBytes, wrb)
 			o.outq.send(newJSPubMsg(dsubj, _EMPTY_, _EMPTY_, msg, nil, nil, 0))
 		}
@@ -5716,13 +6632,36 @@ func (o *consumer) calculateNumPending() (npc, npf uint64, err error) {
 	isLastPerSubject := o.cfg.DeliverPolicy == DeliverLastPerSubject
 	filters, subjf := o.filters, o.subjf
 
-	if filters != nil {
-		return o.mset.store.NumPendingMulti(o.sseq, filters, isLastPerSubject)
-	} else if len(subjf) > 0 {
-		filter := subjf[0].subject
-		return o.mset.store.NumPending(o.sseq, filter, isLastPerSubject)
+	numPending := func(sseq uint64) (uint64, uint64, error) {
+		if filters != nil {
+			return o.mset.store.NumPendingMulti(sseq, filters, isLastPerSubject)
+		} else if len(subjf) > 0 {
+			filter := subjf[0].subject
+			return o.mset.store.NumPending(sseq, filter, isLastPerSubject)
+		}
+		return o.mset.store.NumPending(sseq, _EMPTY_, isLastPerSubject)
+	}
+	if o.cfg.View == _EMPTY_ {
+		return numPending(o.sseq)
 	}
-	return o.mset.store.NumPending(o.sseq, _EMPTY_, isLastPerSubject)
+
+	// Messages after our view's last sequence are not pending for us.
+	if o.sseq > o.vseq {
+		return 0, o.vseq, nil
+	}
+	if npc, npf, err = numPending(o.sseq); err != nil || npf <= o.vseq {
+		return npc, npf, err
+	}
+	after, _, err := numPending(o.vseq + 1)
+	if err != nil {
+		return 0, 0, err
+	}
+	if after < npc {
+		npc -= after
+	} else {
+		npc = 0
+	}
+	return npc, o.vseq, nil
 }
 
 func convertToHeadersOnly(pmsg *jsPubMsg) {
@@ -5759,8 +6698,11 @@ func (o *consumer) deliverMsg(dsubj, ackReply string, pmsg *jsPubMsg, dc uint64,
 		return
 	}
 
-	dseq := o.dseq
-	o.dseq++
+	// Messages held back by priority already have their delivery sequence.
+	dseq := o.nextDeliverySeq(pmsg.seq)
+	if dseq == o.dseq {
+		o.dseq++
+	}
 
 	pmsg.dsubj, pmsg.reply, pmsg.o = dsubj, ackReply, o
 	psz := pmsg.size()
@@ -6105,6 +7047,8 @@ func (o *consumer) checkPending() {
 		if seq < fseq || seq <= o.asflr {
 			delete(o.pending, seq)
 			delete(o.rdc, seq)
+			o.dly.remove(seq)
+			o.prio.remove(seq)
 			o.removeFromRedeliverQueue(seq)
 			shouldUpdateState = true
 			// Check if we need to move ack floors.
@@ -6116,6 +7060,10 @@ func (o *consumer) checkPending() {
 			}
 			continue
 		}
+		// Delayed messages are released by their own timer, and held messages were not delivered yet.
+		if o.dly.isDelayed(seq) || o.prio.isHeld(seq) {
+			continue
+		}
 		elapsed, deadline := now-p.Timestamp, ttl
 		if len(o.cfg.BackOff) > 0 {
 			// This is ok even if o.rdc is nil, we would get dc == 0, which is what we want.
@@ -6281,6 +7229,9 @@ func (o *consumer) reconcileStateWithStream(streamLastSeq uint64) {
 		}
 		o.pending = nil
 		o.rdc = nil
+		o.dly.stop()
+		o.dly = nil
+		o.prio = nil
 	}
 
 	// Remove pending entries that are beyond the stream's last sequence
@@ -6332,12 +7283,24 @@ func (o *consumer) selectStartingSeqNo() error {
 	} else {
 		var state StreamState
 		o.mset.store.FastState(&state)
+		// If bound to a view, the stream ends at the view's last sequence for us.
+		isView := o.cfg.View != _EMPTY_
+		if isView && state.LastSeq > o.vseq {
+			state.LastSeq = o.vseq
+		}
 		if o.cfg.OptStartSeq == 0 {
 			if o.cfg.DeliverPolicy == DeliverAll {
 				o.sseq = state.FirstSeq
 			} else if o.cfg.DeliverPolicy == DeliverLast {
 				if o.subjf == nil {
 					o.sseq = state.LastSeq
+				} else if isView {
+					var smv StoreMsg
+					for _, filter := range o.subjf {
+						if sm, _, err := o.mset.store.LoadPrevMsg(filter.subject, filter.hasWildcard, o.vseq, &smv); err == nil && sm.seq > o.sseq {
+							o.sseq = sm.seq
+						}
+					}
 				} else {
 					// If we are partitioned here this will be properly set when we become leader.
 					for _, filter := range o.subjf {
@@ -6369,7 +7332,11 @@ func (o *consumer) selectStartingSeqNo() error {
 					}
 
 					lss := &lastSeqSkipList{resume: state.LastSeq}
-					lss.seqs, _ = o.mset.store.MultiLastSeqs(filters, 0, 0)
+					if !isView {
+						lss.seqs, _ = o.mset.store.MultiLastSeqs(filters, 0, 0)
+					} else if o.vseq > 0 {
+						lss.seqs, _ = o.mset.store.MultiLastSeqs(filters, o.vseq, 0)
+					}
 
 					if len(lss.seqs) == 0 {
 						o.sseq = state.LastSeq
@@ -6600,6 +7567,8 @@ func (o *consumer) purge(sseq uint64, slseq uint64, isWider bool) {
 				}
 				delete(o.pending, seq)
 				delete(o.rdc, seq)
+				o.dly.remove(seq)
+				o.prio.remove(seq)
 				o.updateAcks(p.Sequence, seq, _EMPTY_)
 				// rdq handled below.
 			} else if isWider && store != nil {
@@ -6615,6 +7584,8 @@ func (o *consumer) purge(sseq uint64, slseq uint64, isWider bool) {
 					}
 					delete(o.pending, seq)
 					delete(o.rdc, seq)
+					o.dly.remove(seq)
+					o.prio.remove(seq)
 					o.updateAcks(p.Sequence, seq, _EMPTY_)
 				}
 			}
@@ -6757,6 +7728,7 @@ func (o *consumer) stopWithFlags(dflag, sdflag, doSignal, advisory bool) error {
 	o.resetSub = nil
 	o.fcSubOld = nil
 	o.fcSub = nil
+	o.clearDeadLetterPubs()
 	if o.infoSub != nil {
 		o.srv.sysUnsubscribe(o.infoSub)
 		o.infoSub = nil
@@ -6768,6 +7740,8 @@ func (o *consumer) stopWithFlags(dflag, sdflag, doSignal, advisory bool) error {
 	o.stopAndClearPtmr()
 	stopAndClearTimer(&o.dtmr)
 	stopAndClearTimer(&o.gwdtmr)
+	stopAndClearTimer(&o.lagtmr)
+	o.dly.stop()
 	delivery := o.cfg.DeliverSubject
 	o.waiting = nil
 	// Break us out of the readLoop.
@@ -6959,6 +7933,16 @@ func (o *consumer) switchToEphemeral() {
 	}
 }
 
+// sendPullStatus sends a status in reply to a pull request. Pull requests of a partitioned
+// stream are split across its partitions, only one of them replies with the status,
+// so the client doesn't end the request early.
+func (o *consumer) sendPullStatus(reply string, hdr []byte) {
+	if !o.repliesToPull(reply) {
+		return
+	}
+	o.outq.send(newJSPubMsg(reply, _EMPTY_, _EMPTY_, hdr, nil, nil, 0))
+}
+
 // RequestNextMsgSubject returns the subject to request the next message when in pull or worker mode.
 // Returns empty otherwise.
 func (o *consumer) requestNextMsgSubject() string {
@@ -7037,7 +8021,7 @@ func (o *consumer) processStreamSignal(seq uint64) {
 	}
 	o.mu.Lock()
 	defer o.mu.Unlock()
-	if o.mset == nil {
+	if o.mset == nil || o.beyondView(seq) {
 		return
 	}
 	if seq > o.npf {
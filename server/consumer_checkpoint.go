@@ -0,0 +1,290 @@
+// Copyright 2026 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"cmp"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// ConsumerCheckpoint is a portable representation of a consumer's state.
+// Stream sequences refer to the stream the state was exported from, they can be
+// translated into sequences of a stream that mirrors or sources that stream.
+type ConsumerCheckpoint struct {
+	Stream      string                  `json:"stream"`
+	Consumer    string                  `json:"consumer"`
+	Delivered   CheckpointSequence      `json:"delivered"`
+	AckFloor    CheckpointSequence      `json:"ack_floor"`
+	Pending     []CheckpointPending     `json:"pending,omitempty"`
+	Redelivered []CheckpointRedelivered `json:"redelivered,omitempty"`
+	// TimeStamp indicates when the checkpoint was taken.
+	TimeStamp time.Time `json:"ts"`
+}
+
+// CheckpointSequence is a consumer and origin stream sequence pair. Time is the
+// timestamp of the message in the origin stream, if it was still available.
+type CheckpointSequence struct {
+	Consumer uint64     `json:"consumer_seq"`
+	Stream   uint64     `json:"stream_seq"`
+	Time     *time.Time `json:"ts,omitempty"`
+}
+
+// CheckpointPending is a message that was delivered but not yet acknowledged.
+type CheckpointPending struct {
+	CheckpointSequence
+	Delivered time.Time `json:"delivered"`
+}
+
+// CheckpointRedelivered is a message that was delivered more than once.
+type CheckpointRedelivered struct {
+	Stream uint64 `json:"stream_seq"`
+	Count  uint64 `json:"count"`
+}
+
+// checkpoint returns our state in a portable form.
+func (o *consumer) checkpoint() *ConsumerCheckpoint {
+	o.mu.RLock()
+	mset := o.mset
+	cp := &ConsumerCheckpoint{
+		Stream:    o.stream,
+		Consumer:  o.name,
+		Delivered: CheckpointSequence{Consumer: o.dseq - 1, Stream: o.sseq - 1},
+		AckFloor:  CheckpointSequence{Consumer: o.adflr, Stream: o.asflr},
+		TimeStamp: time.Now().UTC(),
+	}
+	for seq, p := range o.pending {
+		cp.Pending = append(cp.Pending, CheckpointPending{
+			CheckpointSequence: CheckpointSequence{Consumer: p.Sequence, Stream: seq},
+			Delivered:          time.Unix(0, p.Timestamp).UTC(),
+		})
+	}
+	for seq, dc := range o.rdc {
+		cp.Redelivered = append(cp.Redelivered, CheckpointRedelivered{Stream: seq, Count: dc})
+	}
+	o.mu.RUnlock()
+
+	slices.SortFunc(cp.Pending, func(a, b CheckpointPending) int { return cmp.Compare(a.Stream, b.Stream) })
+	slices.SortFunc(cp.Redelivered, func(a, b CheckpointRedelivered) int { return cmp.Compare(a.Stream, b.Stream) })
+
+	if mset == nil {
+		return cp
+	}
+	var smv StoreMsg
+	msgTime := func(seq uint64) *time.Time {
+		if seq == 0 {
+			return nil
+		}
+		sm, err := mset.store.LoadMsg(seq, &smv)
+		if err != nil || sm == nil {
+			return nil
+		}
+		ts := time.Unix(0, sm.ts).UTC()
+		return &ts
+	}
+	cp.Delivered.Time = msgTime(cp.Delivered.Stream)
+	cp.AckFloor.Time = msgTime(cp.AckFloor.Stream)
+	for i := range cp.Pending {
+		cp.Pending[i].Time = msgTime(cp.Pending[i].Stream)
+	}
+	return cp
+}
+
+// translateCheckpoint translates a checkpoint into a consumer state using our sequences.
+// We need to mirror the stream the checkpoint was taken from, or source it, in which case
+// the sequences are mapped using the Nats-Stream-Source header. Pending or redelivered
+// messages that were not sourced, for example due to a subject filter, are dropped.
+// Messages from other sources up to the delivered sequence will not be delivered.
+func (mset *stream) translateCheckpoint(cp *ConsumerCheckpoint) (*ConsumerState, error) {
+	if cp.Stream == _EMPTY_ {
+		return nil, errors.New("checkpoint stream name is required")
+	}
+	if cp.AckFloor.Stream > cp.Delivered.Stream || cp.AckFloor.Consumer > cp.Delivered.Consumer {
+		return nil, errors.New("checkpoint ack floor is beyond delivered")
+	}
+
+	mset.mu.RLock()
+	store, mirror := mset.store, mset.cfg.Mirror
+	var inames map[string]struct{}
+	for _, ssi := range mset.cfg.Sources {
+		if ssi.Name == cp.Stream {
+			if inames == nil {
+				inames = make(map[string]struct{})
+			}
+			inames[ssi.composeIName()] = struct{}{}
+		}
+	}
+	mset.mu.RUnlock()
+
+	isMirror := mirror != nil && mirror.Name == cp.Stream
+	if !isMirror && len(inames) == 0 {
+		return nil, fmt.Errorf("stream does not mirror or source %q", cp.Stream)
+	}
+
+	// The last sequence we received from the origin, we can only import what we have seen.
+	var lseq uint64
+	if isMirror {
+		var ss StreamState
+		store.FastState(&ss)
+		lseq = ss.LastSeq
+	} else {
+		for iname, sss := range store.SourcesState() {
+			if _, ok := inames[iname]; ok {
+				lseq = max(lseq, sss.Seq)
+			}
+		}
+	}
+	if lseq < cp.Delivered.Stream {
+		return nil, fmt.Errorf("stream has not received sequence %d from %q yet", cp.Delivered.Stream, cp.Stream)
+	}
+
+	state := &ConsumerState{
+		Delivered: SequencePair{Consumer: cp.Delivered.Consumer},
+		AckFloor:  SequencePair{Consumer: cp.AckFloor.Consumer},
+	}
+
+	// Our sequences, keyed by the origin sequence, for pending and redelivered messages.
+	seqs := make(map[uint64]uint64, len(cp.Pending)+len(cp.Redelivered))
+	for _, p := range cp.Pending {
+		seqs[p.Stream] = 0
+	}
+	for _, r := range cp.Redelivered {
+		seqs[r.Stream] = 0
+	}
+
+	if isMirror {
+		// Mirrors keep the sequences of the origin stream.
+		state.Delivered.Stream, state.AckFloor.Stream = cp.Delivered.Stream, cp.AckFloor.Stream
+		for oseq := range seqs {
+			seqs[oseq] = oseq
+		}
+	} else if cp.Delivered.Stream > 0 {
+		// Sourced messages are stored in order, so we can stop once we are past delivered.
+		var smv StoreMsg
+		for start := uint64(0); ; {
+			sm, seq, err := store.LoadNextMsg(fwcs, true, start, &smv)
+			if err != nil {
+				break
+			}
+			start = seq + 1
+			shdr := sliceHeader(JSStreamSource, sm.hdr)
+			if len(shdr) == 0 {
+				continue
+			}
+			name, iname, oseq, _ := streamAndSeq(bytesToString(shdr))
+			if _, ok := inames[iname]; !ok && (iname != _EMPTY_ || name != cp.Stream) {
+				continue
+			}
+			if oseq > cp.Delivered.Stream {
+				break
+			}
+			state.Delivered.Stream = seq
+			if oseq <= cp.AckFloor.Stream {
+				state.AckFloor.Stream = seq
+			}
+			if _, ok := seqs[oseq]; ok {
+				seqs[oseq] = seq
+			}
+		}
+	}
+
+	for _, p := range cp.Pending {
+		if seq := seqs[p.Stream]; seq > state.AckFloor.Stream {
+			if state.Pending == nil {
+				state.Pending = make(map[uint64]*Pending)
+			}
+			state.Pending[seq] = &Pending{p.Consumer, p.Delivered.UnixNano()}
+		}
+	}
+	for _, r := range cp.Redelivered {
+		if seq := seqs[r.Stream]; seq > 0 {
+			if state.Redelivered == nil {
+				state.Redelivered = make(map[uint64]uint64)
+			}
+			state.Redelivered[seq] = r.Count
+		}
+	}
+	return state, nil
+}
+
+// importState replaces our state with an imported one.
+// Returns whether the state was applied, in clustered mode that happens once
+// the state is replicated and the reply will be responded to at that point.
+func (o *consumer) importState(state *ConsumerState, reply string) (bool, error) {
+	o.mu.Lock()
+	if o.node != nil {
+		defer o.mu.Unlock()
+		if !o.isLeader() {
+			return false, errors.New("not the consumer leader")
+		}
+		enc := encodeConsumerState(state)
+		b := make([]byte, 1, 1+binary.MaxVarintLen64+len(reply)+len(enc))
+		b[0] = byte(importStateOp)
+		b = binary.AppendUvarint(b, uint64(len(reply)))
+		b = append(b, reply...)
+		b = append(b, enc...)
+		o.propose(b)
+		if reply != _EMPTY_ {
+			if o.rsm == nil {
+				o.rsm = make(map[string]resetRequest, 1)
+			}
+			// Responses to API requests are sent from the system account.
+			o.rsm[reply] = resetRequest{internal: true}
+		}
+		return false, nil
+	}
+	err := o.applyImportedState(state)
+	o.mu.Unlock()
+	if err == nil {
+		o.checkInterestAfterImport()
+	}
+	return err == nil, err
+}
+
+// applyImportedState replaces our state, both stored and in memory.
+// Lock should be held.
+func (o *consumer) applyImportedState(state *ConsumerState) error {
+	if o.store != nil {
+		if err := o.store.Reset(0); err != nil {
+			return err
+		}
+		if err := o.store.Update(state); err != nil {
+			return err
+		}
+	}
+	o.resetLocalStartingSeq(state.Delivered.Stream + 1)
+	o.applyState(state)
+	if len(o.rdc) > 0 {
+		o.checkRedelivered()
+	}
+	if o.isLeader() {
+		o.streamNumPending()
+		o.signalNewMessages()
+	}
+	return nil
+}
+
+// checkInterestAfterImport cleans up messages that lost interest after an import.
+func (o *consumer) checkInterestAfterImport() {
+	o.mu.RLock()
+	mset, retention := o.mset, o.retention
+	o.mu.RUnlock()
+	if mset != nil && retention == InterestPolicy {
+		ss := mset.state()
+		o.checkStateForInterestStream(&ss)
+	}
+}
@@ -0,0 +1,292 @@
+// Copyright 2026 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Limits for header filter expressions, they are evaluated for every
+// message the consumer looks at so we keep them small.
+const (
+	maxHeaderFilterLen   = 4096
+	maxHeaderFilterDepth = 32
+)
+
+// headerFilter is a compiled ConsumerConfig.HeaderFilter expression.
+//
+// The grammar is:
+//
+//	expr    = and { "||" and }
+//	and     = unary { "&&" unary }
+//	unary   = "!" unary | primary
+//	primary = "(" expr ")" | name [ ("==" | "!=") value | "in" "(" value { "," value } ")" ]
+//
+// A bare header name tests whether the header is present. Values are single
+// or double quoted strings, header names and values are compared as is.
+// Only the first value of a header is taken into account.
+type headerFilter struct {
+	root hfNode
+}
+
+type hfNode interface {
+	match(hdr []byte) bool
+}
+
+type hfOr struct{ l, r hfNode }
+type hfAnd struct{ l, r hfNode }
+type hfNot struct{ n hfNode }
+type hfExists struct{ name string }
+
+type hfEqual struct {
+	name, value string
+	negate      bool
+}
+
+type hfIn struct {
+	name   string
+	values []string
+}
+
+func (n *hfOr) match(hdr []byte) bool  { return n.l.match(hdr) || n.r.match(hdr) }
+func (n *hfAnd) match(hdr []byte) bool { return n.l.match(hdr) && n.r.match(hdr) }
+func (n *hfNot) match(hdr []byte) bool { return !n.n.match(hdr) }
+
+func (n *hfExists) match(hdr []byte) bool {
+	return sliceHeader(n.name, hdr) != nil
+}
+
+// A missing header never equals a value, so it always matches "!=".
+func (n *hfEqual) match(hdr []byte) bool {
+	v := sliceHeader(n.name, hdr)
+	if v == nil {
+		return n.negate
+	}
+	return (string(v) == n.value) != n.negate
+}
+
+func (n *hfIn) match(hdr []byte) bool {
+	v := sliceHeader(n.name, hdr)
+	if v == nil {
+		return false
+	}
+	for _, value := range n.values {
+		if string(v) == value {
+			return true
+		}
+	}
+	return false
+}
+
+// match returns whether the message headers satisfy the filter.
+func (hf *headerFilter) match(hdr []byte) bool {
+	return hf.root.match(hdr)
+}
+
+// parseHeaderFilter compiles a header filter expression.
+func parseHeaderFilter(expr string) (*headerFilter, error) {
+	if len(expr) > maxHeaderFilterLen {
+		return nil, fmt.Errorf("expression exceeds %d characters", maxHeaderFilterLen)
+	}
+	p := &hfParser{s: expr}
+	root, err := p.parseOr(0)
+	if err != nil {
+		return nil, err
+	}
+	if p.skipSpace(); p.pos < len(p.s) {
+		return nil, p.errorf("unexpected %q", p.s[p.pos])
+	}
+	return &headerFilter{root: root}, nil
+}
+
+type hfParser struct {
+	s   string
+	pos int
+}
+
+func (p *hfParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("position %d: %s", p.pos, fmt.Sprintf(format, args...))
+}
+
+func (p *hfParser) skipSpace() {
+	for p.pos < len(p.s) && (p.s[p.pos] == ' ' || p.s[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+// accept consumes tok if it is next in the input.
+func (p *hfParser) accept(tok string) bool {
+	p.skipSpace()
+	if strings.HasPrefix(p.s[p.pos:], tok) {
+		p.pos += len(tok)
+		return true
+	}
+	return false
+}
+
+func (p *hfParser) parseOr(depth int) (hfNode, error) {
+	l, err := p.parseAnd(depth)
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("||") {
+		r, err := p.parseAnd(depth)
+		if err != nil {
+			return nil, err
+		}
+		l = &hfOr{l, r}
+	}
+	return l, nil
+}
+
+func (p *hfParser) parseAnd(depth int) (hfNode, error) {
+	l, err := p.parseUnary(depth)
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("&&") {
+		r, err := p.parseUnary(depth)
+		if err != nil {
+			return nil, err
+		}
+		l = &hfAnd{l, r}
+	}
+	return l, nil
+}
+
+func (p *hfParser) parseUnary(depth int) (hfNode, error) {
+	if depth > maxHeaderFilterDepth {
+		return nil, p.errorf("expression nested too deeply")
+	}
+	p.skipSpace()
+	// Make sure not to mistake "!=" for a negation.
+	if strings.HasPrefix(p.s[p.pos:], "!") && !strings.HasPrefix(p.s[p.pos:], "!=") {
+		p.pos++
+		n, err := p.parseUnary(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		return &hfNot{n}, nil
+	}
+	return p.parsePrimary(depth)
+}
+
+func (p *hfParser) parsePrimary(depth int) (hfNode, error) {
+	if p.accept("(") {
+		n, err := p.parseOr(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		if !p.accept(")") {
+			return nil, p.errorf("expected ')'")
+		}
+		return n, nil
+	}
+	name, err := p.parseName()
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case p.accept("=="):
+		v, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		return &hfEqual{name: name, value: v}, nil
+	case p.accept("!="):
+		v, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		return &hfEqual{name: name, value: v, negate: true}, nil
+	case p.acceptKeyword("in"):
+		if !p.accept("(") {
+			return nil, p.errorf("expected '(' after in")
+		}
+		n := &hfIn{name: name}
+		for {
+			v, err := p.parseValue()
+			if err != nil {
+				return nil, err
+			}
+			n.values = append(n.values, v)
+			if p.accept(")") {
+				return n, nil
+			}
+			if !p.accept(",") {
+				return nil, p.errorf("expected ',' or ')'")
+			}
+		}
+	}
+	return &hfExists{name: name}, nil
+}
+
+// acceptKeyword is like accept, but the keyword must not be followed by
+// other name characters.
+func (p *hfParser) acceptKeyword(kw string) bool {
+	p.skipSpace()
+	end := p.pos + len(kw)
+	if !strings.HasPrefix(p.s[p.pos:], kw) || (end < len(p.s) && isHeaderFilterNameChar(p.s[end])) {
+		return false
+	}
+	p.pos = end
+	return true
+}
+
+func isHeaderFilterNameChar(c byte) bool {
+	// Printable ASCII, excluding the header separator and our operators.
+	return c > ' ' && c < 0x7f && !strings.ContainsRune(":()!=,'\"&|", rune(c))
+}
+
+func (p *hfParser) parseName() (string, error) {
+	p.skipSpace()
+	start := p.pos
+	for p.pos < len(p.s) && isHeaderFilterNameChar(p.s[p.pos]) {
+		p.pos++
+	}
+	if start == p.pos {
+		if p.pos == len(p.s) {
+			return _EMPTY_, p.errorf("expected header name")
+		}
+		return _EMPTY_, p.errorf("expected header name, got %q", p.s[p.pos])
+	}
+	return p.s[start:p.pos], nil
+}
+
+func (p *hfParser) parseValue() (string, error) {
+	p.skipSpace()
+	if p.pos == len(p.s) || (p.s[p.pos] != '\'' && p.s[p.pos] != '"') {
+		return _EMPTY_, p.errorf("expected quoted value")
+	}
+	quote := p.s[p.pos]
+	p.pos++
+	var sb strings.Builder
+	for p.pos < len(p.s) {
+		c := p.s[p.pos]
+		p.pos++
+		switch {
+		case c == quote:
+			return sb.String(), nil
+		case c == '\\' && p.pos < len(p.s):
+			sb.WriteByte(p.s[p.pos])
+			p.pos++
+		case c == '\r' || c == '\n':
+			return _EMPTY_, p.errorf("value can not contain line breaks")
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return _EMPTY_, p.errorf("unterminated value")
+}
@@ -0,0 +1,90 @@
+// Copyright 2026 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHeaderFilterMatch(t *testing.T) {
+	hdr := genHeader(nil, "Region", "eu")
+	hdr = genHeader(hdr, "Tier", "gold")
+	hdr = genHeader(hdr, "Empty", _EMPTY_)
+
+	for _, test := range []struct {
+		expr  string
+		match bool
+	}{
+		{expr: "Region", match: true},
+		{expr: "Empty", match: true},
+		{expr: "Missing", match: false},
+		{expr: "!Missing", match: true},
+		{expr: "Region == 'eu'", match: true},
+		{expr: `Region == "us"`, match: false},
+		{expr: "Region != 'us'", match: true},
+		{expr: "Missing != 'us'", match: true},
+		{expr: "Missing == ''", match: false},
+		{expr: "Empty == ''", match: true},
+		{expr: "Region in ('us', 'eu')", match: true},
+		{expr: "Region in ('us')", match: false},
+		{expr: "Missing in ('')", match: false},
+		{expr: "Region == 'eu' && Tier == 'gold'", match: true},
+		{expr: "Region == 'eu' && Tier == 'silver'", match: false},
+		{expr: "Region == 'us' || Tier == 'gold'", match: true},
+		{expr: "Region == 'us' || Tier == 'gold' && Missing", match: false},
+		{expr: "(Region == 'us' || Tier == 'gold') && !Missing", match: true},
+		{expr: "!(Region == 'eu')", match: false},
+		{expr: `Region == 'e\'u'`, match: false},
+		{expr: "  Region==\t'eu'  ", match: true},
+		// Header names are case sensitive.
+		{expr: "region", match: false},
+	} {
+		hf, err := parseHeaderFilter(test.expr)
+		require_NoError(t, err)
+		if hf.match(hdr) != test.match {
+			t.Fatalf("Expected %q to match %v", test.expr, test.match)
+		}
+	}
+
+	// Messages without headers only match negations.
+	hf, err := parseHeaderFilter("!Region")
+	require_NoError(t, err)
+	require_True(t, hf.match(nil))
+}
+
+func TestHeaderFilterParseErrors(t *testing.T) {
+	for _, test := range []struct {
+		expr string
+		err  string
+	}{
+		{expr: _EMPTY_, err: "position 0: expected header name"},
+		{expr: "Region ==", err: "position 9: expected quoted value"},
+		{expr: "Region == eu", err: "position 10: expected quoted value"},
+		{expr: "Region == 'eu", err: "position 13: unterminated value"},
+		{expr: "Region in 'eu'", err: "position 10: expected '(' after in"},
+		{expr: "Region in ('eu' 'us')", err: "position 16: expected ',' or ')'"},
+		{expr: "(Region", err: "position 7: expected ')'"},
+		{expr: "Region Tier", err: "position 7: unexpected 'T'"},
+		{expr: "Region &&", err: "position 9: expected header name"},
+		{expr: "Region = 'eu'", err: "position 7: unexpected '='"},
+		{expr: "&& Region", err: "position 0: expected header name, got '&'"},
+		{expr: strings.Repeat("!", 40) + "Region", err: "position 33: expression nested too deeply"},
+		{expr: strings.Repeat("a", maxHeaderFilterLen+1), err: "expression exceeds 4096 characters"},
+	} {
+		_, err := parseHeaderFilter(test.expr)
+		require_Error(t, err)
+		require_Equal(t, err.Error(), test.err)
+	}
+}
@@ -0,0 +1,169 @@
+// Copyright 2026 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"errors"
+	"math"
+	"time"
+
+	"github.com/nats-io/nuid"
+)
+
+// The consumer leader periodically checks the lag thresholds of the consumer.
+// Once a value reaches its threshold a lagging advisory is sent, and a recovered advisory
+// is sent once the value dropped to the recover percentage of the threshold. The gap
+// between both prevents a flood of advisories when a value hovers around its threshold.
+
+const (
+	// How often the leader checks the lag thresholds.
+	consumerLagCheckInterval = time.Second
+	// Default percentage of a threshold a value needs to drop to before it recovers.
+	consumerLagRecoverPercent = 80
+)
+
+// Lag metrics, as reported in the advisories.
+const (
+	ConsumerLagNumPending    = "num_pending"
+	ConsumerLagNumAckPending = "num_ack_pending"
+	ConsumerLagAckPendingAge = "ack_pending_age"
+)
+
+// Bits for the lag thresholds currently reached.
+const (
+	lagNumPending uint8 = 1 << iota
+	lagNumAckPending
+	lagAckPendingAge
+)
+
+// checkConsumerLagThresholds checks the lag thresholds of a consumer config.
+func checkConsumerLagThresholds(lt *ConsumerLagThresholds, ackPolicy AckPolicy) error {
+	if lt.NumPending == 0 && lt.NumAckPending == 0 && lt.AckPendingAge == 0 {
+		return errors.New("at least one threshold is required")
+	}
+	if lt.NumAckPending < 0 || lt.AckPendingAge < 0 {
+		return errors.New("thresholds can not be negative")
+	}
+	if (lt.NumAckPending > 0 || lt.AckPendingAge > 0) && (ackPolicy == AckNone || ackPolicy == AckFlowControl) {
+		return errors.New("ack pending thresholds require acknowledgements")
+	}
+	if lt.RecoverPercent < 0 || lt.RecoverPercent >= 100 {
+		return errors.New("recover percent must be between 0 and 99")
+	}
+	return nil
+}
+
+// updateLagCheck starts or stops checking the lag thresholds, based on our config and leadership.
+// Lock should be held.
+func (o *consumer) updateLagCheck() {
+	if o.cfg.LagThresholds == nil || !o.isLeader() || o.closed {
+		stopAndClearTimer(&o.lagtmr)
+		o.lagging = 0
+		return
+	}
+	if o.lagtmr == nil {
+		o.lagtmr = time.AfterFunc(consumerLagCheckInterval, o.checkLag)
+	}
+}
+
+// checkLag is called periodically on the leader to check the lag thresholds.
+func (o *consumer) checkLag() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	lt := o.cfg.LagThresholds
+	if lt == nil || o.lagtmr == nil || o.closed || !o.isLeader() {
+		return
+	}
+	o.checkLagThresholds(lt)
+	o.lagtmr.Reset(consumerLagCheckInterval)
+}
+
+// checkLagThresholds sends advisories for the thresholds that were reached or recovered since the last check.
+// Lock should be held.
+func (o *consumer) checkLagThresholds(lt *ConsumerLagThresholds) {
+	pct := lt.RecoverPercent
+	if pct == 0 {
+		pct = consumerLagRecoverPercent
+	}
+	np, _ := o.checkNumPending()
+	nap := o.numAckPending()
+	var age time.Duration
+	if lt.AckPendingAge > 0 {
+		age = o.oldestAckPendingAge()
+	}
+
+	check := func(bit uint8, metric string, value, threshold int64) {
+		lagging := o.lagging&bit != 0
+		switch {
+		case !lagging && threshold > 0 && value >= threshold:
+			o.lagging |= bit
+		case lagging && (threshold == 0 || float64(value) <= float64(threshold)*float64(pct)/100):
+			o.lagging &^= bit
+		default:
+			return
+		}
+		o.sendLagAdvisoryLocked(metric, !lagging, value, threshold, np, nap, age)
+	}
+	check(lagNumPending, ConsumerLagNumPending, int64(min(np, math.MaxInt64)), int64(min(lt.NumPending, math.MaxInt64)))
+	check(lagNumAckPending, ConsumerLagNumAckPending, int64(nap), int64(lt.NumAckPending))
+	check(lagAckPendingAge, ConsumerLagAckPendingAge, int64(age), int64(lt.AckPendingAge))
+}
+
+// oldestAckPendingAge returns how long ago the oldest message waiting to be acknowledged was stored.
+// Lock should be held.
+func (o *consumer) oldestAckPendingAge() time.Duration {
+	if len(o.pending) == 0 || o.mset == nil || o.mset.store == nil {
+		return 0
+	}
+	// Delayed and held priority messages are pending, but not delivered yet.
+	oldest := uint64(math.MaxUint64)
+	for seq := range o.pending {
+		if seq < oldest && !o.dly.isDelayed(seq) && !o.prio.isHeld(seq) {
+			oldest = seq
+		}
+	}
+	if oldest == math.MaxUint64 {
+		return 0
+	}
+	var smv StoreMsg
+	sm, err := o.mset.store.LoadMsg(oldest, &smv)
+	if err != nil || sm == nil {
+		return 0
+	}
+	return max(time.Since(time.Unix(0, sm.ts)), 0)
+}
+
+func (o *consumer) sendLagAdvisoryLocked(metric string, lagging bool, value, threshold int64, np uint64, nap int, age time.Duration) {
+	e := JSConsumerLagAdvisory{
+		TypedEvent: TypedEvent{
+			Type: JSConsumerLagAdvisoryType,
+			ID:   nuid.Next(),
+			Time: time.Now().UTC(),
+		},
+		Account:       o.acc.Name,
+		Stream:        o.stream,
+		Consumer:      o.name,
+		Domain:        o.srv.getOpts().JetStreamDomain,
+		Metric:        metric,
+		Lagging:       lagging,
+		Value:         value,
+		Threshold:     threshold,
+		NumPending:    np,
+		NumAckPending: nap,
+		AckPendingAge: age,
+	}
+
+	subj := JSAdvisoryConsumerLagPre + "." + o.stream + "." + o.name
+	o.sendAdvisory(subj, e)
+}
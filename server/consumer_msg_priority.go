@@ -0,0 +1,247 @@
+// Copyright 2026 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/nats-io/nats-server/v2/server/avl"
+)
+
+// A consumer delivering by message priority looks ahead of its stream sequence, and holds
+// back up to a window of messages. The held message with the lowest Nats-Priority level,
+// and within a level the oldest, is delivered first.
+// Held messages are tracked as pending with a zero timestamp, so they are part of our replicated
+// state and the ack floor can't move past them. A new leader restores them from pending.
+
+const (
+	// JSMessagePriorityMax is the highest, so least urgent, priority level of a message.
+	JSMessagePriorityMax = 9
+	// JSMessagePriorityDefault is the priority level of messages without a Nats-Priority header.
+	JSMessagePriorityDefault = 5
+
+	// Default and maximum number of messages held back to pick the most urgent one from.
+	defaultMsgPriorityWindow = 1000
+	maxMsgPriorityWindow     = 100_000
+)
+
+// checkConsumerMsgPriority checks the message priority settings of a consumer config.
+func checkConsumerMsgPriority(config *ConsumerConfig, cfg *StreamConfig) error {
+	if !config.MsgPriority {
+		if config.MsgPriorityWindow != 0 {
+			return errors.New("window requires message priority")
+		}
+		return nil
+	}
+	if !cfg.AllowMsgPriority {
+		return errors.New("stream does not allow message priority")
+	}
+	if config.DeliverSubject != _EMPTY_ {
+		return errors.New("only pull consumers can deliver by priority")
+	}
+	if config.AckPolicy != AckExplicit {
+		return errors.New("ack policy must be explicit")
+	}
+	if config.MsgPriorityWindow < 0 || config.MsgPriorityWindow > maxMsgPriorityWindow {
+		return fmt.Errorf("window must be between 0 and %d", maxMsgPriorityWindow)
+	}
+	return nil
+}
+
+// msgPriorities tracks the messages a consumer is holding back by their priority level.
+// Not safe for concurrent use, the owner's lock must be held.
+type msgPriorities struct {
+	levels [JSMessagePriorityMax + 1]avl.SequenceSet
+	seqs   map[uint64]int
+}
+
+func newMsgPriorities() *msgPriorities {
+	return &msgPriorities{seqs: make(map[uint64]int)}
+}
+
+// add holds back the message at the given priority level.
+func (mp *msgPriorities) add(seq uint64, level int) {
+	if _, ok := mp.seqs[seq]; ok {
+		return
+	}
+	mp.levels[level].Insert(seq)
+	mp.seqs[seq] = level
+}
+
+// remove stops holding back the message, for example when it was removed from the stream.
+func (mp *msgPriorities) remove(seq uint64) {
+	if mp == nil {
+		return
+	}
+	if level, ok := mp.seqs[seq]; ok {
+		mp.levels[level].Delete(seq)
+		delete(mp.seqs, seq)
+	}
+}
+
+// pop returns the oldest message of the lowest priority level, and no longer holds it back.
+// Returns 0 if no messages are held back.
+func (mp *msgPriorities) pop() uint64 {
+	if mp == nil {
+		return 0
+	}
+	for i := range mp.levels {
+		if mp.levels[i].IsEmpty() {
+			continue
+		}
+		seq, _ := mp.levels[i].MinMax()
+		mp.levels[i].Delete(seq)
+		delete(mp.seqs, seq)
+		return seq
+	}
+	return 0
+}
+
+// isHeld returns whether the message is being held back.
+func (mp *msgPriorities) isHeld(seq uint64) bool {
+	if mp == nil {
+		return false
+	}
+	_, ok := mp.seqs[seq]
+	return ok
+}
+
+// len returns the number of messages being held back.
+func (mp *msgPriorities) len() int {
+	if mp == nil {
+		return 0
+	}
+	return len(mp.seqs)
+}
+
+// counts returns the number of messages being held back per priority level.
+func (mp *msgPriorities) counts() []uint64 {
+	counts := make([]uint64, JSMessagePriorityMax+1)
+	if mp != nil {
+		for i := range mp.levels {
+			counts[i] = uint64(mp.levels[i].Size())
+		}
+	}
+	return counts
+}
+
+// msgPriorityLevel returns the priority level of the message, the default if it has none.
+func msgPriorityLevel(hdr []byte) int {
+	if level, err := getMessagePriority(hdr); err == nil && level >= 0 {
+		return level
+	}
+	return JSMessagePriorityDefault
+}
+
+// Returns the number of messages we hold back to pick the most urgent one from.
+// Lock should be held.
+func (o *consumer) msgPriorityWindow() int {
+	if o.cfg.MsgPriorityWindow > 0 {
+		return o.cfg.MsgPriorityWindow
+	}
+	return defaultMsgPriorityWindow
+}
+
+// holdPriorityMsg holds back the message until it's the most urgent one in our window.
+// Lock should be held.
+func (o *consumer) holdPriorityMsg(sm *StoreMsg) {
+	dseq := o.dseq
+	o.dseq++
+	// A zero timestamp marks the message as not delivered yet.
+	o.updateDelivered(dseq, sm.seq, 1, 0)
+	if o.pending == nil {
+		o.pending = make(map[uint64]*Pending)
+	}
+	o.pending[sm.seq] = &Pending{dseq, 0}
+	o.npc--
+	if o.prio == nil {
+		o.prio = newMsgPriorities()
+	}
+	o.prio.add(sm.seq, msgPriorityLevel(sm.hdr))
+}
+
+// nextDeliverySeq returns the consumer sequence to deliver the message with. A message we
+// held back keeps the sequence it was assigned when we started holding it.
+// Lock should be held.
+func (o *consumer) nextDeliverySeq(sseq uint64) uint64 {
+	if o.cfg.MsgPriority {
+		if p, ok := o.pending[sseq]; ok && p.Timestamp == 0 {
+			return p.Sequence
+		}
+	}
+	return o.dseq
+}
+
+// nextPriorityMsg returns the most urgent message we hold back, to be delivered for the first time.
+// Lock should be held.
+func (o *consumer) nextPriorityMsg() (*jsPubMsg, uint64, error) {
+	for seq := o.prio.pop(); seq > 0; seq = o.prio.pop() {
+		p, ok := o.pending[seq]
+		if !ok {
+			continue
+		}
+		pmsg := getJSPubMsgFromPool()
+		sm, err := o.mset.store.LoadMsg(seq, &pmsg.StoreMsg)
+		if sm == nil || err != nil {
+			pmsg.returnToPool()
+			// The message was removed in the meantime, it will never be delivered.
+			o.processAckMsgLocked(seq, p.Sequence, 1, _EMPTY_, false, false)
+			continue
+		}
+		o.npc++
+		return pmsg, 1, nil
+	}
+	return nil, 0, ErrStoreEOF
+}
+
+// requeuePriorityMsg holds back a message again if it could not be delivered after all.
+// Returns false if the message was not one we held back.
+// Lock should be held.
+func (o *consumer) requeuePriorityMsg(pmsg *jsPubMsg) bool {
+	if !o.cfg.MsgPriority {
+		return false
+	}
+	if p, ok := o.pending[pmsg.seq]; !ok || p.Timestamp != 0 {
+		return false
+	}
+	if o.prio == nil {
+		o.prio = newMsgPriorities()
+	}
+	o.prio.add(pmsg.seq, msgPriorityLevel(pmsg.hdr))
+	return true
+}
+
+// restorePriorityMsgs holds back the pending messages that were not delivered yet.
+// Used when becoming leader, since held messages are only marked in our pending state.
+// Lock should be held.
+func (o *consumer) restorePriorityMsgs() {
+	if len(o.pending) == 0 || !o.cfg.MsgPriority {
+		return
+	}
+	var smv StoreMsg
+	for seq, p := range o.pending {
+		if p.Timestamp != 0 {
+			continue
+		}
+		level := JSMessagePriorityDefault
+		if sm, err := o.mset.store.LoadMsg(seq, &smv); err == nil && sm != nil {
+			level = msgPriorityLevel(sm.hdr)
+		}
+		if o.prio == nil {
+			o.prio = newMsgPriorities()
+		}
+		o.prio.add(seq, level)
+	}
+}
@@ -0,0 +1,167 @@
+// Copyright 2026 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// A stream with consumer subject permissions only allows consumers whose filter subjects are
+// within the subscribe permissions of the user creating them. This allows multiple tenants to
+// share a stream, for example a user only allowed to subscribe to orders.eu.> can only create
+// consumers for orders.eu.>. Streams sourcing from such a stream in the same account are held
+// to the same rules, otherwise sourcing could be used to get around them. Getting messages through
+// the msg get API is held to the same rules, and direct gets are not allowed on such a stream.
+// Requests are handled by the meta leader or the stream leader, which is not the server the user is
+// connected to, so the server the user is connected to sends the permissions it resolved with the request.
+
+// requestSubscribePermissions returns the subscribe permissions of the user that sent the request.
+// A nil permission means the user is not restricted. Returns false if the permissions of the user
+// can not be determined, for example for requests imported from other accounts.
+func requestSubscribePermissions(ci *ClientInfo) (*SubjectPermission, bool) {
+	// Internal requests.
+	if ci == nil {
+		return nil, true
+	}
+	if ci.SubPerms == nil {
+		return nil, false
+	}
+	if len(ci.SubPerms.Allow) == 0 && len(ci.SubPerms.Deny) == 0 {
+		return nil, true
+	}
+	return ci.SubPerms, true
+}
+
+// subjectPermitted returns whether all messages on the subject can be received
+// with the subscribe permissions. Queue permissions don't apply to consumers.
+func subjectPermitted(subject string, sp *SubjectPermission) bool {
+	if sp == nil {
+		return true
+	}
+	if len(sp.Allow) > 0 {
+		var allowed bool
+		for _, allow := range sp.Allow {
+			if strings.ContainsRune(allow, ' ') {
+				continue
+			}
+			if subjectIsSubsetMatch(subject, allow) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return false
+		}
+	}
+	// Any overlap with a deny would let the consumer receive denied messages.
+	for _, deny := range sp.Deny {
+		if strings.ContainsRune(deny, ' ') {
+			continue
+		}
+		if SubjectsCollide(subject, deny) {
+			return false
+		}
+	}
+	return true
+}
+
+// checkConsumerSubjectPermissions checks the filter subjects of a consumer on the stream against
+// the subscribe permissions of the user that sent the request.
+// Without filters the consumer receives all the subjects of the stream.
+func checkConsumerSubjectPermissions(ci *ClientInfo, scfg *StreamConfig, filters []string) *ApiError {
+	if scfg == nil || !scfg.ConsumerSubjectPermissions {
+		return nil
+	}
+	sp, ok := requestSubscribePermissions(ci)
+	if !ok {
+		return NewJSConsumerSubjectPermissionError(errors.New("permissions of user can not be determined"))
+	}
+	if sp == nil {
+		return nil
+	}
+	if len(filters) == 0 {
+		if filters = scfg.Subjects; len(filters) == 0 {
+			filters = []string{fwcs}
+		}
+	}
+	for _, filter := range filters {
+		if !subjectPermitted(filter, sp) {
+			return NewJSConsumerSubjectPermissionError(fmt.Errorf("subject %q not permitted", filter))
+		}
+	}
+	return nil
+}
+
+// msgGetSubjectPermissions returns the subscribe permissions that the subjects of messages got
+// through the msg get API are checked against, nil if not restricted.
+func msgGetSubjectPermissions(ci *ClientInfo, scfg *StreamConfig) (*SubjectPermission, *ApiError) {
+	if !scfg.ConsumerSubjectPermissions {
+		return nil, nil
+	}
+	sp, ok := requestSubscribePermissions(ci)
+	if !ok {
+		return nil, NewJSStreamMsgSubjectPermissionError(errors.New("permissions of user can not be determined"))
+	}
+	return sp, nil
+}
+
+// checkStreamSourcesSubjectPermissions checks the mirror and sources of a stream config that are
+// in the same account against the consumer subject permissions of the streams they source from.
+func (s *Server) checkStreamSourcesSubjectPermissions(ci *ClientInfo, acc *Account, cfg *StreamConfig) *ApiError {
+	sources := cfg.Sources
+	if cfg.Mirror != nil {
+		sources = append([]*StreamSource{cfg.Mirror}, sources...)
+	}
+	for _, ss := range sources {
+		// Streams in other accounts or domains are covered by their exports,
+		// and sourcing through an existing consumer uses its filters.
+		if ss == nil || ss.External != nil || ss.Consumer != nil {
+			continue
+		}
+		var filters []string
+		if ss.FilterSubject != _EMPTY_ {
+			filters = append(filters, ss.FilterSubject)
+		}
+		for _, st := range ss.SubjectTransforms {
+			if st.Source != _EMPTY_ {
+				filters = append(filters, st.Source)
+			}
+		}
+		if err := checkConsumerSubjectPermissions(ci, s.jsStreamConfig(acc, ss.Name), filters); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// jsStreamConfig returns the config of the stream, or nil if it does not exist.
+func (s *Server) jsStreamConfig(acc *Account, name string) *StreamConfig {
+	if js, cc := s.getJetStreamCluster(); js != nil && cc != nil {
+		js.mu.RLock()
+		defer js.mu.RUnlock()
+		if sa := js.streamAssignment(acc.Name, name); sa != nil && sa.Config != nil {
+			cfg := *sa.Config
+			return &cfg
+		}
+		return nil
+	}
+	mset, err := acc.lookupStream(name)
+	if err != nil {
+		return nil
+	}
+	cfg := mset.config()
+	return &cfg
+}
@@ -330,6 +330,9 @@ type ClientInfo struct {
 	MQTTClient string        `json:"client_id,omitempty"` // This is the MQTT client ID
 	Nonce      string        `json:"nonce,omitempty"`
 	Reply      string        `json:"reply,omitempty"` // Original reply subject after a service import (only when needed).
+	// Subscribe permissions of the client, resolved by the server it is connected to.
+	// Only set for JetStream API requests from the client's own account, empty if not restricted.
+	SubPerms *SubjectPermission `json:"sub_perms,omitempty"`
 }
 
 // forAssignmentSnap returns the minimum amount of ClientInfo we need for assignment snapshots.
@@ -349,6 +352,7 @@ func (ci *ClientInfo) forProposal() *ClientInfo {
 	cci := *ci
 	cci.Jwt = _EMPTY_
 	cci.IssuerKey = _EMPTY_
+	cci.SubPerms = nil
 	return &cci
 }
 
@@ -360,6 +364,7 @@ func (ci *ClientInfo) forAdvisory() *ClientInfo {
 	cci := *ci
 	cci.Jwt = _EMPTY_
 	cci.Alternates = nil
+	cci.SubPerms = nil
 	return &cci
 }
 
@@ -45,6 +45,7 @@ import (
 
 	"github.com/antithesishq/antithesis-sdk-go/assert"
 	"github.com/klauspost/compress/s2"
+	"github.com/klauspost/compress/zstd"
 	"github.com/minio/highwayhash"
 	"github.com/nats-io/nats-server/v2/server/ats"
 	"github.com/nats-io/nats-server/v2/server/avl"
@@ -77,6 +78,11 @@ type FileStoreConfig struct {
 	Cipher StoreCipher
 	// Compression is the algorithm to use when compressing.
 	Compression StoreCompression
+	// CompressionLevel is the zstd compression level, zero uses the default.
+	// See CompressWithLevel for how levels map to the zstd encoder.
+	CompressionLevel int
+	// ColdTier is where blocks older than the stream's ColdTierAge are offloaded to.
+	ColdTier ColdTier
 
 	// Internal reference to our server.
 	srv *Server
@@ -109,11 +115,14 @@ func (cipher StoreCipher) String() string {
 	}
 }
 
+// StoreCompression is the algorithm message blocks are compressed with.
+// Only S2 and zstd are implemented, there is no LZ4 support.
 type StoreCompression uint8
 
 const (
 	NoCompression StoreCompression = iota
 	S2Compression
+	ZstdCompression
 )
 
 func (alg StoreCompression) String() string {
@@ -122,6 +131,8 @@ func (alg StoreCompression) String() string {
 		return "None"
 	case S2Compression:
 		return "S2"
+	case ZstdCompression:
+		return "Zstd"
 	default:
 		return "Unknown StoreCompression"
 	}
@@ -132,6 +143,8 @@ func (alg StoreCompression) MarshalJSON() ([]byte, error) {
 	switch alg {
 	case S2Compression:
 		str = "s2"
+	case ZstdCompression:
+		str = "zstd"
 	case NoCompression:
 		str = "none"
 	default:
@@ -148,6 +161,8 @@ func (alg *StoreCompression) UnmarshalJSON(b []byte) error {
 	switch str {
 	case "s2":
 		*alg = S2Compression
+	case "zstd":
+		*alg = ZstdCompression
 	case "none":
 		*alg = NoCompression
 	default:
@@ -224,6 +239,17 @@ type fileStore struct {
 	lpex        time.Time // Last PurgeEx call.
 	dios        *diskIOSemaphore
 	sources     map[string]*StreamSourceState
+	tierTmr     *time.Timer   // Timer to offload blocks to the cold tier.
+	ncold       atomic.Int64  // Number of blocks in the cold tier.
+	ncoldBytes  atomic.Uint64 // User visible bytes of the blocks in the cold tier.
+	coldID      string        // Identity our blocks are kept under in the cold tier.
+	hseq        uint64        // Messages up to and including this sequence are held from limits.
+	cmpTmr      *time.Timer   // Timer to compact sealed blocks to the last value per subject.
+	cmpState    *StreamCompactionState
+	cmpLastSeq  uint64                          // Last sequence of the stream at the last compaction run.
+	cmpWm       uint64                          // Blocks up to this sequence hold at most one message per subject.
+	cmpRevisit  map[uint32]int64                // Blocks below the watermark with delete markers still to age out.
+	cmpcb       func(seq uint64, tcutoff int64) // Proposes compaction instead of running it locally.
 }
 
 // Represents a message store block and its data.
@@ -272,8 +298,12 @@ type msgBlock struct {
 	needKeySync bool // Key file is written once and immutable, cleared after its one sync.
 	noCompact   bool
 	closed      bool
-	ttls        uint64 // How many msgs have TTLs?
-	schedules   uint64 // How many msgs have schedules?
+	cold        bool          // Block data was offloaded to the cold tier.
+	coldDel     bool          // Block data is being deleted from the cold tier.
+	coldWait    chan struct{} // Closed once the block is done being uploaded to or fetched from the cold tier.
+	coldBytes   uint64        // Bytes accounted for in the cold tier.
+	ttls        uint64        // How many msgs have TTLs?
+	schedules   uint64        // How many msgs have schedules?
 
 	// Used to mock write failures.
 	mockWriteErr bool
@@ -610,6 +640,12 @@ func newFileStoreWithCreatedAndMode(fcfg FileStoreConfig, cfg StreamConfig, crea
 		fs.startAgeChk()
 	}
 
+	// Offload blocks to the cold tier if configured.
+	fs.setupColdTier()
+
+	// Compact sealed blocks to the last value per subject if configured.
+	fs.setupCompaction()
+
 	// If we have max msgs per subject make sure the is also enforced.
 	if fs.cfg.MaxMsgsPer > 0 {
 		if err = fs.enforceMsgPerSubjectLimit(false); err != nil {
@@ -748,12 +784,18 @@ func (fs *fileStore) UpdateConfig(cfg *StreamConfig) error {
 	old_cfg := fs.cfg
 	// The reference story has changed here, so this full msg block lock
 	// may not be needed.
+	old_cmp, old_cmpLvl := fs.fcfg.Compression, fs.fcfg.CompressionLevel
 	fs.lockAllMsgBlocks()
 	fs.cfg = new_cfg
+	// New blocks will use the updated compression, existing blocks migrate when rewritten.
+	if cfg.Compression != old_cfg.Compression || cfg.CompressionLevel != old_cfg.CompressionLevel {
+		fs.fcfg.Compression, fs.fcfg.CompressionLevel = cfg.Compression, cfg.CompressionLevel
+	}
 	fs.unlockAllMsgBlocks()
 	if err := fs.writeStreamMeta(); err != nil {
 		fs.lockAllMsgBlocks()
 		fs.cfg = old_cfg
+		fs.fcfg.Compression, fs.fcfg.CompressionLevel = old_cmp, old_cmpLvl
 		fs.unlockAllMsgBlocks()
 		fs.mu.Unlock()
 		return err
@@ -783,6 +825,12 @@ func (fs *fileStore) UpdateConfig(cfg *StreamConfig) error {
 		fs.ageChk = nil
 		fs.ageChkTime = 0
 	}
+	if fs.cfg.ColdTierAge != old_cfg.ColdTierAge {
+		fs.setupColdTier()
+	}
+	if oc, nc := old_cfg.Compaction, fs.cfg.Compaction; (oc == nil) != (nc == nil) || (oc != nil && *oc != *nc) {
+		fs.setupCompaction()
+	}
 
 	if fs.cfg.MaxMsgsPer > 0 && (old_cfg.MaxMsgsPer <= 0 || fs.cfg.MaxMsgsPer < old_cfg.MaxMsgsPer) {
 		if err := fs.enforceMsgPerSubjectLimit(true); err != nil {
@@ -2198,6 +2246,23 @@ func (fs *fileStore) recoverFullState() (rerr error) {
 
 	var index uint32
 	for _, fi := range dirs {
+		// Blocks in the cold tier are kept track of using a marker.
+		if strings.HasSuffix(fi.Name(), coldSuffix) {
+			if n, err := fmt.Sscanf(fi.Name(), coldScan, &index); err == nil && n == 1 {
+				mb, ok := fs.bim[index]
+				if _, err := os.Stat(filepath.Join(mdir, fmt.Sprintf(blkScan, index))); ok && os.IsNotExist(err) {
+					if err = fs.loadColdID(false); err != nil {
+						fs.warn("Could not recover msg block %d from cold tier: %v", index, err)
+					}
+					mb.closed = false
+					mb.markCold()
+				} else {
+					// Either we crashed while offloading and the block is still here, or the block is gone.
+					_ = os.Remove(filepath.Join(mdir, fi.Name()))
+				}
+			}
+			continue
+		}
 		// Ensure it's actually a block file, otherwise fmt.Sscanf also matches %d.blk.tmp
 		if !strings.HasSuffix(fi.Name(), blkSuffix) {
 			continue
@@ -2564,6 +2629,9 @@ func (fs *fileStore) recoverMsgs() error {
 	fs.mu.Lock()
 	defer fs.mu.Unlock()
 
+	// Blocks need to be available locally to rebuild the state.
+	fs.rehydrateColdBlocksOnRecover()
+
 	// Check for any left over purged messages.
 	fs.dios.acquire()
 	if err := fs.recoverPartialPurge(); err != nil {
@@ -5065,7 +5133,7 @@ func (mb *msgBlock) setupWriteCache(buf []byte) error {
 	} else if mb.mfn != _EMPTY_ {
 		fi, _ = os.Stat(mb.mfn)
 	}
-	if fi != nil {
+	if fi != nil || mb.cold {
 		return mb.loadMsgsWithLock()
 	}
 
@@ -5342,6 +5410,9 @@ func (fs *fileStore) storeRawMsg(subj string, hdr, msg []byte, seq uint64, ts, t
 			// Re-check if we're at the limit.
 			continue
 		}
+		if fseq <= fs.hseq {
+			break
+		}
 		if _, err = fs.removeMsgViaLimits(fseq); err != nil && err != ErrStoreMsgNotFound {
 			return err
 		}
@@ -5843,6 +5914,32 @@ func (fs *fileStore) firstSeqForSubj(subj string) (uint64, error) {
 	return 0, nil
 }
 
+// HoldUpTo will hold messages up to and including seq from being removed by limits.
+// A lower sequence, or zero, releases the hold and enforces the limits again.
+func (fs *fileStore) HoldUpTo(seq uint64) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	hseq := fs.hseq
+	fs.hseq = seq
+	if seq >= hseq || fs.isClosed() {
+		return
+	}
+	if err := fs.enforceMsgLimit(); err != nil {
+		fs.warn("Error enforcing message limit after releasing hold: %v", err)
+	}
+	if err := fs.enforceBytesLimit(); err != nil {
+		fs.warn("Error enforcing bytes limit after releasing hold: %v", err)
+	}
+	if fs.cfg.MaxMsgsPer > 0 {
+		if err := fs.enforceMsgPerSubjectLimit(true); err != nil {
+			fs.warn("Error enforcing per subject limit after releasing hold: %v", err)
+		}
+	}
+	if fs.cfg.MaxAge != 0 {
+		fs.resetAgeChk(0)
+	}
+}
+
 // Will check the msg limit and drop firstSeq msg if needed.
 // Lock should be held.
 func (fs *fileStore) enforceMsgLimit() error {
@@ -5852,7 +5949,7 @@ func (fs *fileStore) enforceMsgLimit() error {
 	if fs.cfg.MaxMsgs <= 0 || fs.state.Msgs <= uint64(fs.cfg.MaxMsgs) {
 		return nil
 	}
-	for nmsgs := fs.state.Msgs; nmsgs > uint64(fs.cfg.MaxMsgs); nmsgs = fs.state.Msgs {
+	for nmsgs := fs.state.Msgs; nmsgs > uint64(fs.cfg.MaxMsgs) && fs.state.FirstSeq > fs.hseq; nmsgs = fs.state.Msgs {
 		// If the first block can be removed fully, purge it entirely without needing to walk sequences.
 		if len(fs.blks) > 0 {
 			fmb := fs.blks[0]
@@ -5884,7 +5981,7 @@ func (fs *fileStore) enforceBytesLimit() error {
 	if fs.cfg.MaxBytes <= 0 || fs.state.Bytes <= uint64(fs.cfg.MaxBytes) {
 		return nil
 	}
-	for bs := fs.state.Bytes; bs > uint64(fs.cfg.MaxBytes); bs = fs.state.Bytes {
+	for bs := fs.state.Bytes; bs > uint64(fs.cfg.MaxBytes) && fs.state.FirstSeq > fs.hseq; bs = fs.state.Bytes {
 		// If the first block can be removed fully, purge it entirely without needing to walk sequences.
 		if len(fs.blks) > 0 {
 			fmb := fs.blks[0]
@@ -6034,6 +6131,11 @@ func (fs *fileStore) enforceMsgPerSubjectLimit(fireCallback bool) error {
 					break
 				}
 				first = m.seq + 1
+				// Held messages are the oldest, so leave this subject alone.
+				if m.seq <= fs.hseq {
+					*total = 0
+					break
+				}
 				if removed, _ := fs.removeMsgViaLimits(m.seq); removed {
 					blks[mb] = struct{}{}
 					*total--
@@ -6078,6 +6180,42 @@ func (fs *fileStore) EraseMsg(seq uint64) (bool, error) {
 	return fs.removeMsg(seq, true, false, true)
 }
 
+// RedactMsg will replace the headers of the message and remove its payload.
+// The message keeps its sequence, subject and timestamp, the block holding it is rewritten.
+func (fs *fileStore) RedactMsg(seq uint64, hdr []byte) (bool, error) {
+	fs.mu.Lock()
+	if fs.isClosed() {
+		fs.mu.Unlock()
+		return false, ErrStoreClosed
+	}
+	// Always return previous write errors.
+	if err := fs.werr; err != nil {
+		fs.mu.Unlock()
+		return false, err
+	}
+	mb := fs.selectMsgBlock(seq)
+	if mb == nil {
+		fs.mu.Unlock()
+		return false, nil
+	}
+	mb.mu.Lock()
+	osz, nsz, err := mb.redactMsg(seq, hdr, mb == fs.lmb)
+	mb.mu.Unlock()
+	if err != nil || osz == 0 {
+		fs.mu.Unlock()
+		return false, err
+	}
+	fs.state.Bytes = fs.state.Bytes - osz + nsz
+	fs.dirty++
+	cb := fs.scb
+	fs.mu.Unlock()
+
+	if cb != nil && osz != nsz {
+		cb(0, int64(nsz)-int64(osz), 0, _EMPTY_)
+	}
+	return true, nil
+}
+
 // Convenience function to remove per subject tracking at the filestore level.
 // Lock should be held.
 func (fs *fileStore) removePerSubject(subj string) uint64 {
@@ -6523,17 +6661,9 @@ func (mb *msgBlock) compactWithFloor(floor uint64, fsDmap *interiorDeletes) erro
 	}
 
 	// Handle compression
-	if mb.cmp != NoCompression && len(nbuf) > 0 {
-		originalSize := len(nbuf)
-		var err error
-		if nbuf, err = mb.cmp.Compress(nbuf); err != nil {
-			return err
-		}
-		meta := &CompressionInfo{
-			Algorithm:    mb.cmp,
-			OriginalSize: uint64(originalSize),
-		}
-		nbuf = append(meta.MarshalMetadata(), nbuf...)
+	var err error
+	if nbuf, err = mb.recompressForRewrite(nbuf); err != nil {
+		return err
 	}
 
 	// Check for encryption.
@@ -6800,6 +6930,88 @@ func (mb *msgBlock) eraseMsg(seq uint64, ri, rl int, isLastBlock bool) error {
 	return nil
 }
 
+// Rewrite this message block with the record for seq replaced by one with the given
+// headers and no payload. Returns the old and new record size, both zero if not found.
+// Lock should be held.
+func (mb *msgBlock) redactMsg(seq uint64, hdr []byte, isLastBlock bool) (uint64, uint64, error) {
+	if mb.closed || seq < atomic.LoadUint64(&mb.first.seq) || seq > atomic.LoadUint64(&mb.last.seq) || mb.dmap.Exists(seq) {
+		return 0, 0, nil
+	}
+	// We rewrite the whole block, so make sure any pending writes are on disk.
+	if ld, err := mb.flushPendingMsgsLocked(); err != nil {
+		if ld != nil {
+			go mb.fs.rebuildState(ld)
+		}
+		return 0, 0, err
+	}
+	if mb.cacheNotLoaded() {
+		if err := mb.loadMsgsWithLock(); err != nil {
+			return 0, 0, err
+		}
+	}
+	defer mb.finishedWithCache()
+
+	var smv StoreMsg
+	sm, err := mb.cacheLookupNoCopy(seq, &smv)
+	if err != nil || sm == nil {
+		if err == ErrStoreMsgNotFound || err == errDeletedMsg {
+			err = nil
+		}
+		return 0, 0, err
+	}
+	ri, rl, _, err := mb.slotInfo(int(seq - mb.cache.fseq))
+	if err != nil {
+		return 0, 0, err
+	}
+	osz := fileStoreMsgSizeRaw(len(sm.subj), len(sm.hdr), len(sm.msg))
+	nsz := fileStoreMsgSizeRaw(len(sm.subj), len(hdr), 0)
+
+	// Encode the redacted record, see writeMsgRecordLocked for the format.
+	var le = binary.LittleEndian
+	l := uint32(nsz)
+	if len(hdr) > 0 {
+		l |= hbit
+	}
+	rec := make([]byte, msgHdrSize, nsz)
+	le.PutUint32(rec[0:], l)
+	le.PutUint64(rec[4:], seq)
+	le.PutUint64(rec[12:], uint64(sm.ts))
+	le.PutUint16(rec[20:], uint16(len(sm.subj)))
+	rec = append(rec, sm.subj...)
+	if len(hdr) > 0 {
+		rec = le.AppendUint32(rec, uint32(len(hdr)))
+		rec = append(rec, hdr...)
+	}
+	mb.hh.Reset()
+	mb.hh.Write(rec[4:20])
+	mb.hh.Write(stringToBytes(sm.subj))
+	mb.hh.Write(hdr)
+	rec = mb.hh.Sum(rec)
+
+	buf := mb.cache.buf
+	nbuf := make([]byte, 0, len(buf)-int(rl)+len(rec))
+	nbuf = append(nbuf, buf[:ri]...)
+	nbuf = append(nbuf, rec...)
+	nbuf = append(nbuf, buf[ri+rl:]...)
+
+	// Grab the last checksum before the buffer is encrypted in place.
+	var lchk [8]byte
+	copy(lchk[0:], nbuf[len(nbuf)-checksumSize:])
+	if err := mb.checkAndLoadEncryption(); err != nil {
+		return 0, 0, err
+	}
+	if err := mb.atomicOverwriteFile(nbuf, !isLastBlock); err != nil {
+		return 0, 0, err
+	}
+	mb.lchk = lchk
+	mb.bytes = mb.bytes - osz + nsz
+	mb.noCompact = false
+	// Do not leave the original record around in memory, and clear the cache since the offsets changed.
+	clear(buf[ri : ri+rl])
+	mb.clearCacheAndOffset()
+	return osz, nsz, nil
+}
+
 // Truncate this message block to the tseq and ts.
 // Lock should be held.
 func (mb *msgBlock) truncate(tseq uint64, ts int64) (nmsgs, nbytes uint64, err error) {
@@ -7268,6 +7480,7 @@ func (fs *fileStore) expireMsgs() {
 	minAge := ats.AccessTime() - maxAge
 	rmcb := fs.rmcb
 	pmsgcb := fs.pmsgcb
+	hseq := fs.hseq
 	sdmTTL := int64(fs.cfg.SubjectDeleteMarkerTTL.Seconds())
 	sdmEnabled := sdmTTL > 0
 
@@ -7282,7 +7495,7 @@ func (fs *fileStore) expireMsgs() {
 
 	if maxAge > 0 {
 		var seq uint64
-		for sm, seq, _ = fs.LoadNextMsg(fwcs, true, 0, &smv); sm != nil && sm.ts <= minAge; sm, seq, _ = fs.LoadNextMsg(fwcs, true, seq+1, &smv) {
+		for sm, seq, _ = fs.LoadNextMsg(fwcs, true, 0, &smv); sm != nil && sm.ts <= minAge && seq > hseq; sm, seq, _ = fs.LoadNextMsg(fwcs, true, seq+1, &smv) {
 			if len(sm.hdr) > 0 {
 				if ttl, err := getMessageTTL(sm.hdr); err == nil && ttl < 0 {
 					// The message has a negative TTL, therefore it must "never expire".
@@ -7547,7 +7760,7 @@ func (fs *fileStore) checkMsgs() (*LostStreamData, error) {
 	return fs.ld, firstErr
 }
 
-// Lock should be held.
+// Lock should be held, it is released while fetching a block from the cold tier.
 func (mb *msgBlock) enableForWriting(fip bool) error {
 	if mb == nil {
 		return errNoMsgBlk
@@ -7555,6 +7768,15 @@ func (mb *msgBlock) enableForWriting(fip bool) error {
 	if mb.mfd != nil {
 		return nil
 	}
+	if mb.cold {
+		if err := mb.rehydrate(); err != nil {
+			return err
+		}
+		// Could have been opened while fetching.
+		if mb.mfd != nil {
+			return nil
+		}
+	}
 	mb.fs.dios.acquire()
 	mfd, err := os.OpenFile(mb.mfn, os.O_CREATE|os.O_RDWR, defaultFilePerms)
 	mb.fs.dios.release()
@@ -7940,7 +8162,8 @@ func (fs *fileStore) writeTombstoneNoFlush(seq uint64, ts int64) error {
 // Lock should be held.
 func (mb *msgBlock) recompressOnDiskIfNeeded() error {
 	// If the block has been closed in the meantime, skip.
-	if mb.closed {
+	// Blocks in the cold tier are left as-is.
+	if mb.closed || mb.cold {
 		return nil
 	}
 
@@ -8029,7 +8252,7 @@ func (mb *msgBlock) atomicOverwriteFile(buf []byte, allowCompress bool) error {
 		// it if needed. Note that if the selected algorithm is NoCompression, the
 		// Compress function will just return the input buffer unmodified.
 		originalSize := len(buf)
-		if buf, err = alg.Compress(buf); err != nil {
+		if buf, err = alg.CompressWithLevel(buf, mb.fs.fcfg.CompressionLevel); err != nil {
 			return errorCleanup(fmt.Errorf("failed to compress block: %w", err))
 		}
 
@@ -8078,6 +8301,32 @@ func (mb *msgBlock) atomicOverwriteFile(buf []byte, allowCompress bool) error {
 	return nil
 }
 
+// recompressForRewrite compresses the contents of a compressed block that is being rewritten.
+// The currently configured algorithm is used, such that blocks lazily migrate to it after the
+// compression of the stream was updated. Uncompressed blocks are returned as-is.
+// Lock should be held.
+func (mb *msgBlock) recompressForRewrite(buf []byte) ([]byte, error) {
+	if mb.cmp == NoCompression || len(buf) == 0 {
+		return buf, nil
+	}
+	alg := mb.fs.fcfg.Compression
+	if alg == NoCompression {
+		mb.cmp = alg
+		return buf, nil
+	}
+	originalSize := len(buf)
+	buf, err := alg.CompressWithLevel(buf, mb.fs.fcfg.CompressionLevel)
+	if err != nil {
+		return nil, err
+	}
+	mb.cmp = alg
+	meta := &CompressionInfo{
+		Algorithm:    alg,
+		OriginalSize: uint64(originalSize),
+	}
+	return append(meta.MarshalMetadata(), buf...), nil
+}
+
 // Lock should be held.
 func (mb *msgBlock) decompressIfNeeded(buf []byte) ([]byte, error) {
 	var meta CompressionInfo
@@ -8803,8 +9052,14 @@ func (mb *msgBlock) fssNotLoaded() bool {
 }
 
 // Wrap openBlock for the gated semaphore processing.
-// Lock should be held
+// Lock should be held, it is released while fetching a block from the cold tier.
 func (mb *msgBlock) openBlock() (*os.File, error) {
+	// Bring the block back first if it was offloaded.
+	if mb.cold {
+		if err := mb.rehydrate(); err != nil {
+			return nil, err
+		}
+	}
 	// Gate with concurrent IO semaphore.
 	mb.fs.dios.acquire()
 	f, err := os.Open(mb.mfn)
@@ -8863,12 +9118,20 @@ func (mb *msgBlock) loadBlock(buf []byte) ([]byte, error) {
 	return buf[:n], err
 }
 
-// Lock should be held.
+// Lock should be held, it is released while fetching a block from the cold tier.
 func (mb *msgBlock) loadMsgsWithLock() error {
 	if err := mb.checkAndLoadEncryption(); err != nil {
 		return err
 	}
 
+	// Bring the block back from the cold tier first, the lock is released
+	// while doing so and concurrent loads wait on the same fetch.
+	if mb.cold {
+		if err := mb.rehydrate(); err != nil {
+			return err
+		}
+	}
+
 	// Check to see if we are loading already.
 	if mb.loading {
 		return nil
@@ -9944,6 +10207,8 @@ func (fs *fileStore) FastState(state *StreamState) {
 	}
 	state.Consumers = fs.numConsumers()
 	state.NumSubjects = fs.numSubjects()
+	state.ColdBytes = fs.ncoldBytes.Load()
+	state.Compaction = fs.compactionState()
 	fs.mu.RUnlock()
 }
 
@@ -9953,6 +10218,8 @@ func (fs *fileStore) State() StreamState {
 	state := fs.state
 	state.Consumers = fs.numConsumers()
 	state.NumSubjects = fs.numSubjects()
+	state.ColdBytes = fs.ncoldBytes.Load()
+	state.Compaction = fs.compactionState()
 	state.Deleted = nil // make sure.
 
 	if numDeleted := int((state.LastSeq - state.FirstSeq + 1) - state.Msgs); numDeleted > 0 {
@@ -10585,6 +10852,7 @@ func (fs *fileStore) purgeLocked(fseq uint64) (purged, bytes uint64, err error)
 		// These blocks are being discarded by the purge, so mark them closed.
 		mb.mu.Lock()
 		mb.dirtyCloseWithRemove(false)
+		mb.removeFromColdTier()
 		mb.closed = true
 		mb.mu.Unlock()
 	}
@@ -10936,17 +11204,9 @@ func (fs *fileStore) compactLocked(seq uint64) (purged, bytes uint64, err error)
 			nbuf = append(nbuf, buf...)
 			smb.closeFDsLockedNoCheck()
 			// Check for compression.
-			if smb.cmp != NoCompression && len(nbuf) > 0 {
-				originalSize := len(nbuf)
-				if nbuf, err = smb.cmp.Compress(nbuf); err != nil {
-					smb.mu.Unlock()
-					return purged, bytes, err
-				}
-				meta := &CompressionInfo{
-					Algorithm:    smb.cmp,
-					OriginalSize: uint64(originalSize),
-				}
-				nbuf = append(meta.MarshalMetadata(), nbuf...)
+			if nbuf, err = smb.recompressForRewrite(nbuf); err != nil {
+				smb.mu.Unlock()
+				return purged, bytes, err
 			}
 			// Check for encryption.
 			if smb.bek != nil && len(nbuf) > 0 {
@@ -11051,6 +11311,7 @@ func (fs *fileStore) reset() error {
 	}
 
 	fs.mu.Lock()
+	fs.resetCompactionWatermark()
 
 	var purged, bytes uint64
 	cb := fs.scb
@@ -11225,6 +11486,8 @@ func (fs *fileStore) Truncate(seq uint64) (rerr error) {
 	// Any existing state file will no longer be applicable. We will force write a new one
 	// at the end, after we release the lock.
 	os.Remove(filepath.Join(fs.fcfg.StoreDir, msgDir, streamStreamStateFile))
+	// Sequences after seq will be reused, so compaction has to start over.
+	fs.resetCompactionWatermark()
 
 	var hasLsm bool
 	var lastTime int64
@@ -11624,6 +11887,7 @@ func (mb *msgBlock) dirtyCloseWithRemove(remove bool) error {
 		mb.closed = true
 		// Clear any tracking by subject if we are removing.
 		mb.fss = nil
+		mb.removeFromColdTier()
 		if mb.mfn != _EMPTY_ {
 			if err := os.Remove(mb.mfn); err != nil && !os.IsNotExist(err) {
 				return err
@@ -12034,6 +12298,9 @@ func (fs *fileStore) Delete(inline bool) error {
 	fs.mu.Lock()
 	for _, mb := range fs.blks {
 		mb.dirtyClose()
+		mb.mu.Lock()
+		mb.removeFromColdTier()
+		mb.mu.Unlock()
 	}
 	dmsgs := fs.state.Msgs
 	dbytes := int64(fs.state.Bytes)
@@ -12661,6 +12928,8 @@ func (fs *fileStore) stop(delete, writeState bool) error {
 
 	fs.cancelSyncTimer()
 	fs.cancelAgeChk()
+	clearTimer(&fs.tierTmr)
+	clearTimer(&fs.cmpTmr)
 
 	if writeState {
 		// Write full state if needed. If not dirty this is a no-op.
@@ -14477,6 +14746,45 @@ func (c *CompressionInfo) UnmarshalMetadata(b []byte) (int, error) {
 }
 
 func (alg StoreCompression) Compress(buf []byte) ([]byte, error) {
+	return alg.CompressWithLevel(buf, 0)
+}
+
+// Creating zstd encoders is expensive, especially for the higher levels, so they are pooled per level.
+var zstdEncoderPools [zstd.SpeedBestCompression + 1]sync.Pool
+
+// getZstdEncoder returns an encoder for the given level writing to w.
+// Return it with putZstdEncoder once closed.
+func getZstdEncoder(w io.Writer, elvl zstd.EncoderLevel) (*zstd.Encoder, error) {
+	if enc, ok := zstdEncoderPools[elvl].Get().(*zstd.Encoder); ok {
+		enc.Reset(w)
+		return enc, nil
+	}
+	return zstd.NewWriter(w, zstd.WithEncoderLevel(elvl), zstd.WithEncoderConcurrency(1))
+}
+
+// putZstdEncoder returns a closed encoder to its pool.
+func putZstdEncoder(enc *zstd.Encoder, elvl zstd.EncoderLevel) {
+	// Don't hold on to the output.
+	enc.Reset(nil)
+	zstdEncoderPools[elvl].Put(enc)
+}
+
+// Decoders are pooled as well, as blocks are decompressed every time they are loaded.
+var zstdDecoderPool sync.Pool
+
+// getZstdDecoder returns a decoder, return it to zstdDecoderPool when done.
+func getZstdDecoder() (*zstd.Decoder, error) {
+	if dec, ok := zstdDecoderPool.Get().(*zstd.Decoder); ok {
+		return dec, nil
+	}
+	return zstd.NewReader(nil, zstd.WithDecoderConcurrency(1))
+}
+
+// CompressWithLevel compresses using the given level, which is only used by zstd.
+// A zero level uses the default level of the algorithm.
+// The zstd encoder only implements four of the zstd levels, so levels 1 and 2 use the
+// fastest, 3 to 5 the default, 6 to 9 the better and 10 to 22 the best compression.
+func (alg StoreCompression) CompressWithLevel(buf []byte, level int) ([]byte, error) {
 	if len(buf) < checksumSize {
 		return nil, fmt.Errorf("uncompressed buffer is too short")
 	}
@@ -14488,6 +14796,17 @@ func (alg StoreCompression) Compress(buf []byte) ([]byte, error) {
 		return buf, nil
 	case S2Compression:
 		writer = s2.NewWriter(&output)
+	case ZstdCompression:
+		elvl := zstd.SpeedDefault
+		if level > 0 {
+			elvl = zstd.EncoderLevelFromZstd(level)
+		}
+		enc, err := getZstdEncoder(&output, elvl)
+		if err != nil {
+			return nil, fmt.Errorf("error creating compression writer: %w", err)
+		}
+		defer putZstdEncoder(enc, elvl)
+		writer = enc
 	default:
 		return nil, fmt.Errorf("compression algorithm not known")
 	}
@@ -14529,6 +14848,17 @@ func (alg StoreCompression) Decompress(buf []byte) ([]byte, error) {
 		return buf, nil
 	case S2Compression:
 		reader = io.NopCloser(s2.NewReader(input))
+	case ZstdCompression:
+		dec, err := getZstdDecoder()
+		if err != nil {
+			return nil, fmt.Errorf("error creating compression reader: %w", err)
+		}
+		output, err := dec.DecodeAll(buf[:bodyLen], nil)
+		zstdDecoderPool.Put(dec)
+		if err != nil {
+			return nil, fmt.Errorf("error reading compression reader: %w", err)
+		}
+		return append(output, buf[bodyLen:]...), nil
 	default:
 		return nil, fmt.Errorf("compression algorithm not known")
 	}
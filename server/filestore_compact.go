@@ -0,0 +1,506 @@
+// Copyright 2026 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"maps"
+	"slices"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// Bounds on how often we check for blocks to compact.
+	compactMinInterval = 100 * time.Millisecond
+	compactMaxInterval = time.Minute
+	// Most messages a single run compacts past the last compacted sequence,
+	// so applying a proposed compaction does not hold up the apply loop for long.
+	compactMaxMsgs = 100_000
+)
+
+// A message removed by compaction, kept to call the storage callback without locks held.
+type compactedMsg struct {
+	seq  uint64
+	subj string
+	sz   uint64
+	ts   int64
+	ttl  int64
+	tomb bool
+}
+
+// Returns how often we check for blocks to compact.
+// Lock should be held.
+func (fs *fileStore) compactInterval() time.Duration {
+	return min(max(fs.cfg.Compaction.DirtyAge/4, compactMinInterval), compactMaxInterval)
+}
+
+// Starts or stops last value compaction, based on the config.
+// Lock should be held.
+func (fs *fileStore) setupCompaction() {
+	// Start over, the tombstone age could have changed.
+	fs.resetCompactionWatermark()
+	if fs.cfg.Compaction == nil || fs.cfg.Compaction.DirtyAge <= 0 {
+		clearTimer(&fs.cmpTmr)
+		fs.cmpState = nil
+		return
+	}
+	if fs.cmpState == nil {
+		fs.cmpState = &StreamCompactionState{}
+	}
+	if fs.cmpTmr == nil {
+		fs.cmpTmr = time.AfterFunc(fs.compactInterval(), fs.compactLastValues)
+	} else {
+		fs.cmpTmr.Reset(fs.compactInterval())
+	}
+}
+
+// Returns a copy of the compaction state, nil if compaction is not enabled.
+// Lock should be held.
+func (fs *fileStore) compactionState() *StreamCompactionState {
+	if fs.cmpState == nil {
+		return nil
+	}
+	state := *fs.cmpState
+	return &state
+}
+
+// Registers a callback that is called instead of compacting locally, so a clustered
+// stream can have its leader propose compaction and all replicas compact the same messages.
+func (fs *fileStore) registerCompaction(cb func(seq uint64, tcutoff int64)) {
+	fs.mu.Lock()
+	fs.cmpcb = cb
+	fs.mu.Unlock()
+}
+
+// Resets the compaction watermark, the next run will walk all blocks.
+// Lock should be held.
+func (fs *fileStore) resetCompactionWatermark() {
+	fs.cmpWm, fs.cmpRevisit, fs.cmpLastSeq = 0, nil, 0
+}
+
+// Returns true if a block below the watermark has delete markers that aged out.
+// Lock should be held.
+func (fs *fileStore) hasTombstonesToAge(tcutoff int64) bool {
+	if tcutoff == 0 {
+		return false
+	}
+	for _, ts := range fs.cmpRevisit {
+		if ts <= tcutoff {
+			return true
+		}
+	}
+	return false
+}
+
+// compactLastValues checks for sealed blocks that were last written before the dirty age,
+// and compacts the stream up to the last of those blocks, or has it proposed if registered.
+func (fs *fileStore) compactLastValues() {
+	fs.mu.RLock()
+	if fs.closing || fs.cmpTmr == nil || fs.cmpState == nil || fs.cfg.Compaction == nil || fs.noTrackSubjects() {
+		fs.mu.RUnlock()
+		return
+	}
+	sc, lseq := *fs.cfg.Compaction, fs.state.LastSeq
+	now := time.Now().UnixNano()
+	cutoff := now - int64(sc.DirtyAge)
+	var tcutoff int64
+	if sc.TombstoneAge > 0 {
+		tcutoff = now - int64(sc.TombstoneAge)
+	}
+
+	// Find the newest block that was not written to within the dirty age.
+	var cseq uint64
+	for i := len(fs.blks) - 1; i >= 0; i-- {
+		mb := fs.blks[i]
+		if mb == fs.lmb {
+			continue
+		}
+		mb.mu.RLock()
+		clean, last := mb.last.ts <= cutoff, mb.last.seq
+		mb.mu.RUnlock()
+		if clean {
+			cseq = last
+			break
+		}
+	}
+	// Compact a bounded number of messages per run, and come back sooner for the rest.
+	var capped bool
+	if mseq := max(fs.cmpState.Seq, fs.state.FirstSeq) + compactMaxMsgs; cseq > mseq {
+		cseq, capped = mseq, true
+	}
+	// Nothing changed since the last run, and no tombstones to age out.
+	idle := cseq == 0 || (lseq == fs.cmpLastSeq && cseq <= fs.cmpState.Seq && !fs.hasTombstonesToAge(tcutoff))
+	cb := fs.cmpcb
+	fs.mu.RUnlock()
+
+	if !idle {
+		if cb != nil {
+			cb(cseq, tcutoff)
+		} else {
+			fs.compactLastValuesUpTo(cseq, tcutoff)
+		}
+	}
+	fs.resetCompactTimer(capped)
+}
+
+// compactLastValuesUpTo compacts all messages up to seq, keeping only the last message for each subject.
+// Blocks are compacted from newest to oldest, so a message is removed when its subject was seen in a newer message.
+// Delete markers that are the last message for their subject are removed when older than tcutoff.
+//
+// All messages up to seq are compacted regardless of how they are laid out in blocks, so replicas
+// applying the same proposal compact the same messages. If the last block holds any of them we move
+// on to a new block, and blocks in the cold tier are brought back.
+//
+// Blocks up to the watermark hold at most one message per subject, so only the blocks after it are walked.
+// Below it we only revisit the blocks holding the last value for a subject seen after it,
+// and the blocks with delete markers that aged out.
+func (fs *fileStore) compactLastValuesUpTo(seq uint64, tcutoff int64) {
+	fs.mu.Lock()
+	if fs.closing || fs.cmpState == nil || fs.noTrackSubjects() {
+		fs.mu.Unlock()
+		return
+	}
+	if lmb := fs.lmb; lmb != nil && atomic.LoadUint64(&lmb.first.seq) <= seq && atomic.LoadUint64(&lmb.last.seq) >= atomic.LoadUint64(&lmb.first.seq) {
+		if _, err := fs.newMsgBlockForWrite(); err != nil {
+			fs.warn("Error sealing last msg block for compaction: %v", err)
+		}
+	}
+	lseq, wm := fs.state.LastSeq, fs.cmpWm
+	// Views can hold on to older values for a subject, so walk all blocks while they do.
+	held := fs.hseq > 0
+	if held {
+		wm = 0
+	}
+	var blks []*msgBlock
+	for i := len(fs.blks) - 1; i >= 0; i-- {
+		mb := fs.blks[i]
+		if atomic.LoadUint64(&mb.last.seq) <= wm {
+			break
+		}
+		blks = append(blks, mb)
+	}
+	fs.mu.Unlock()
+
+	seen := make(map[string]struct{})
+	revisit := make(map[uint32]int64)
+	done := true
+	for _, mb := range blks {
+		pending, ok := fs.compactBlock(mb, seen, seq, tcutoff)
+		if pending > 0 {
+			revisit[mb.index] = pending
+		}
+		done = done && ok
+	}
+
+	fs.mu.Lock()
+	if fs.closing || fs.cmpState == nil {
+		fs.mu.Unlock()
+		return
+	}
+	old := make(map[uint32]*msgBlock)
+	if wm > 0 {
+		for index, ts := range fs.cmpRevisit {
+			mb := fs.bim[index]
+			if mb == nil || atomic.LoadUint64(&mb.last.seq) > wm {
+				continue
+			}
+			if ts <= tcutoff {
+				old[index] = mb
+			} else {
+				revisit[index] = ts
+			}
+		}
+		for subj := range seen {
+			mb, err := fs.lastValueBlock(subj, wm)
+			if err != nil {
+				fs.warn("Error loading msg block %d for compaction: %v", mb.index, err)
+				done = false
+			} else if mb != nil {
+				old[mb.index] = mb
+			}
+		}
+	}
+	fs.mu.Unlock()
+
+	// Compact from newest to oldest.
+	for _, index := range slices.Backward(slices.Sorted(maps.Keys(old))) {
+		mb := old[index]
+		pending, ok := fs.compactBlock(mb, seen, seq, tcutoff)
+		if pending > 0 {
+			revisit[mb.index] = pending
+		}
+		done = done && ok
+	}
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if fs.closing || fs.cmpState == nil {
+		return
+	}
+	if len(revisit) == 0 {
+		revisit = nil
+	}
+	fs.cmpRevisit, fs.cmpLastSeq = revisit, lseq
+	if done && !held {
+		fs.cmpWm = max(wm, seq)
+	}
+	fs.cmpState.Seq = max(fs.cmpState.Seq, seq)
+	fs.cmpState.Last = time.Now().UTC()
+}
+
+// lastValueBlock returns the block up to the watermark holding a message for the subject, if any.
+// Since compaction leaves at most one message per subject there, this starts at the first block
+// for the subject, and moves it forward past the blocks that no longer hold the subject.
+// Lock should be held.
+func (fs *fileStore) lastValueBlock(subj string, wm uint64) (*msgBlock, error) {
+	bsubj := stringToBytes(subj)
+	info, ok := fs.psim.Find(bsubj)
+	if !ok {
+		return nil, nil
+	}
+	fblk, advance := info.fblk, true
+	defer func() {
+		if fblk > info.fblk && fblk <= info.lblk {
+			info.fblk = fblk
+		}
+	}()
+	for i := info.fblk; i <= info.lblk; i++ {
+		mb := fs.bim[i]
+		if mb == nil {
+			if advance {
+				fblk = i + 1
+			}
+			continue
+		}
+		if atomic.LoadUint64(&mb.last.seq) > wm {
+			break
+		}
+		mb.mu.Lock()
+		var found bool
+		err := mb.ensurePerSubjectInfoLoaded()
+		if err == nil && mb.fss != nil {
+			_, found = mb.fss.Find(bsubj)
+		}
+		mb.mu.Unlock()
+		if err != nil {
+			return mb, err
+		}
+		if found {
+			return mb, nil
+		}
+		if advance {
+			fblk = i + 1
+		}
+	}
+	return nil, nil
+}
+
+// compactBlock compacts a single block and calls the storage callback for all removed messages.
+// Returns the timestamp of the oldest delete marker left to age out, if any,
+// and false if messages up to seq could not be compacted.
+func (fs *fileStore) compactBlock(mb *msgBlock, seen map[string]struct{}, seq uint64, tcutoff int64) (int64, bool) {
+	// Bring the block back from the cold tier first, without holding our lock.
+	mb.mu.Lock()
+	if mb.cold && !mb.closed {
+		if err := mb.rehydrate(); err != nil {
+			mb.mu.Unlock()
+			fs.warn("Error loading msg block %d for compaction: %v", mb.index, err)
+			return 0, false
+		}
+	}
+	mb.mu.Unlock()
+
+	fs.mu.Lock()
+	if fs.closing {
+		fs.mu.Unlock()
+		return 0, false
+	}
+	// The last block is not compacted, any messages up to seq are left for later.
+	mb.mu.RLock()
+	skipped := (mb == fs.lmb || mb.cold) && atomic.LoadUint64(&mb.first.seq) <= seq
+	mb.mu.RUnlock()
+
+	rm, pending, err := fs.compactBlockLastValues(mb, seen, seq, tcutoff)
+	if len(rm) > 0 && fs.cmpState != nil {
+		for _, m := range rm {
+			fs.cmpState.Msgs++
+			fs.cmpState.Bytes += m.sz
+			if m.tomb {
+				fs.cmpState.Tombstones++
+			}
+		}
+	}
+	cb := fs.scb
+	fs.mu.Unlock()
+
+	if err != nil {
+		fs.warn("Error compacting msg block %d: %v", mb.index, err)
+	}
+	if cb != nil {
+		for _, m := range rm {
+			cb(-1, -int64(m.sz), m.seq, m.subj)
+		}
+	}
+	return pending, err == nil && !skipped
+}
+
+// Schedules the next compaction run, soon if there are more messages to compact.
+func (fs *fileStore) resetCompactTimer(soon bool) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if fs.cmpTmr != nil && fs.cfg.Compaction != nil {
+		if soon {
+			fs.cmpTmr.Reset(compactMinInterval)
+		} else {
+			fs.cmpTmr.Reset(fs.compactInterval())
+		}
+	}
+}
+
+// compactBlockLastValues removes all messages up to maxSeq from the block whose subject was already seen,
+// and rewrites the block once. The subjects of the remaining messages are added to seen.
+// Messages held for views and the last message of the stream are always kept.
+// Returns the removed messages, and the timestamp of the oldest delete marker left to age out.
+// Lock should be held.
+func (fs *fileStore) compactBlockLastValues(mb *msgBlock, seen map[string]struct{}, maxSeq uint64, tcutoff int64) ([]compactedMsg, int64, error) {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+
+	if mb.closed || mb.cold || mb.msgs == 0 {
+		return nil, 0, nil
+	}
+	// Not compacted, but the subjects in the block supersede older messages.
+	if mb == fs.lmb || atomic.LoadUint64(&mb.first.seq) > maxSeq {
+		if err := mb.ensurePerSubjectInfoLoaded(); err != nil {
+			return nil, 0, err
+		}
+		if mb.fss != nil {
+			mb.fss.IterFast(func(bsubj []byte, _ *SimpleState) bool {
+				seen[string(bsubj)] = struct{}{}
+				return true
+			})
+		}
+		return nil, 0, nil
+	}
+	needsCleanup := mb.cache == nil
+	defer func() {
+		if needsCleanup {
+			mb.finishedWithCache()
+		}
+	}()
+	if mb.cacheNotLoaded() {
+		if err := mb.loadMsgsWithLock(); err != nil {
+			return nil, 0, err
+		}
+	}
+	if err := mb.ensurePerSubjectInfoLoaded(); err != nil {
+		return nil, 0, err
+	}
+
+	var rm []compactedMsg
+	var pending int64
+	var smv StoreMsg
+	fseq, lseq := atomic.LoadUint64(&mb.first.seq), atomic.LoadUint64(&mb.last.seq)
+	for seq := lseq; seq >= fseq && seq > 0; seq-- {
+		if mb.dmap.Exists(seq) {
+			continue
+		}
+		sm, err := mb.cacheLookupNoCopy(seq, &smv)
+		if err != nil || sm == nil {
+			continue
+		}
+		_, superseded := seen[sm.subj]
+		if !superseded {
+			seen[copyString(sm.subj)] = struct{}{}
+		}
+		if seq > maxSeq {
+			continue
+		}
+		marker := !superseded && tcutoff > 0 && isSubjectDeleteMarker(sm.hdr)
+		tomb := marker && sm.ts <= tcutoff
+		if (!superseded && !tomb) || seq <= fs.hseq || seq == fs.state.LastSeq {
+			if marker && (pending == 0 || sm.ts < pending) {
+				pending = sm.ts
+			}
+			continue
+		}
+		ttl, _ := getMessageTTL(sm.hdr)
+		rm = append(rm, compactedMsg{
+			seq:  seq,
+			subj: copyString(sm.subj),
+			sz:   fileStoreMsgSizeRaw(len(sm.subj), len(sm.hdr), len(sm.msg)),
+			ts:   sm.ts,
+			ttl:  ttl,
+			tomb: tomb,
+		})
+	}
+	if len(rm) == 0 {
+		return nil, pending, nil
+	}
+
+	// Update the accounting for all removed messages, before rewriting the block once.
+	for _, m := range rm {
+		if fs.state.Msgs > 0 {
+			fs.state.Msgs--
+		}
+		if m.sz < fs.state.Bytes {
+			fs.state.Bytes -= m.sz
+		} else {
+			fs.state.Bytes = 0
+		}
+		if mb.msgs > 0 {
+			mb.msgs--
+		}
+		if m.sz < mb.bytes {
+			mb.bytes -= m.sz
+		} else {
+			mb.bytes = 0
+		}
+		if _, err := mb.removeSeqPerSubject(m.subj, m.seq); err != nil {
+			return rm, pending, err
+		}
+		fs.removePerSubject(m.subj)
+		if fs.ttls != nil && m.ttl > 0 {
+			expires := time.Duration(m.ts) + (time.Second * time.Duration(m.ttl))
+			fs.ttls.Remove(m.seq, int64(expires))
+		}
+		mb.dmap.Insert(m.seq)
+	}
+	fs.dirty++
+	mb.noCompact = false
+
+	isFirst := fs.state.FirstSeq >= fseq && fs.state.FirstSeq <= lseq
+	if mb.msgs == 0 {
+		if err := fs.removeMsgBlock(mb); err != nil {
+			return rm, pending, err
+		}
+	} else {
+		if mb.dmap.Exists(fseq) {
+			mb.dmap.Delete(fseq)
+			mb.selectNextFirst()
+		}
+		if err := mb.compact(); err != nil {
+			return rm, pending, err
+		}
+	}
+	if isFirst {
+		mb.mu.Unlock()
+		err := fs.selectNextFirst()
+		mb.mu.Lock()
+		if err != nil {
+			return rm, pending, err
+		}
+	}
+	return rm, pending, nil
+}
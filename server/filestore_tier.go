@@ -0,0 +1,611 @@
+// Copyright 2026 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nuid"
+)
+
+// ColdTier is a secondary storage backend that sealed message blocks of a file based
+// stream can be offloaded to. Only the block data is offloaded, all indexes are kept locally.
+// Implementations must be safe for concurrent use.
+type ColdTier interface {
+	// Put stores the data under the given name, replacing any existing data.
+	Put(name string, data []byte) error
+	// Get returns the data stored under the given name.
+	Get(name string) ([]byte, error)
+	// Delete removes the data stored under the given name.
+	// Deleting data that does not exist is not an error.
+	Delete(name string) error
+}
+
+// JSColdTierOpts configures the cold tier that message blocks can be offloaded to.
+// At most one of Dir, S3 or Backend should be set.
+type JSColdTierOpts struct {
+	// Dir is a local directory, for example a mount of slower storage.
+	Dir string
+	// S3 is an S3 compatible object store.
+	S3 *S3ColdTierOpts
+	// Backend allows embedders to provide their own implementation.
+	Backend ColdTier `json:"-"`
+}
+
+// S3ColdTierOpts configures an S3 compatible object store as the cold tier.
+type S3ColdTierOpts struct {
+	// Endpoint is the URL of the object store, e.g. https://s3.us-east-1.amazonaws.com.
+	Endpoint string
+	// Region is used for signing requests, defaults to us-east-1.
+	Region string
+	// Bucket is the name of the bucket, which must exist.
+	Bucket string
+	// Prefix is prepended to the names of all objects.
+	Prefix    string
+	AccessKey string
+	SecretKey string `json:"-"`
+}
+
+const (
+	// Marks a block that was offloaded to the cold tier.
+	coldScan   = "%d.cold"
+	coldSuffix = ".cold"
+	// Holds the identity the blocks of a store are kept under in the cold tier.
+	coldIDFile = "cold.id"
+
+	// Bounds on how often we check for blocks to offload.
+	coldTierMinInterval = 100 * time.Millisecond
+	coldTierMaxInterval = time.Minute
+)
+
+var errNoColdTier = errors.New("no cold tier configured")
+
+// newColdTier creates the cold tier from the options, returns nil if none is configured.
+func newColdTier(opts *JSColdTierOpts) (ColdTier, error) {
+	switch {
+	case opts.Backend != nil:
+		return opts.Backend, nil
+	case opts.Dir != _EMPTY_ && opts.S3 != nil:
+		return nil, fmt.Errorf("cold tier can not be both a directory and S3")
+	case opts.Dir != _EMPTY_:
+		return NewDirColdTier(opts.Dir)
+	case opts.S3 != nil:
+		return NewS3ColdTier(opts.S3)
+	}
+	return nil, nil
+}
+
+// prefixedColdTier scopes a cold tier to a single stream.
+type prefixedColdTier struct {
+	ColdTier
+	prefix string
+}
+
+func (t *prefixedColdTier) Put(name string, data []byte) error {
+	return t.ColdTier.Put(path.Join(t.prefix, name), data)
+}
+
+func (t *prefixedColdTier) Get(name string) ([]byte, error) {
+	return t.ColdTier.Get(path.Join(t.prefix, name))
+}
+
+func (t *prefixedColdTier) Delete(name string) error {
+	return t.ColdTier.Delete(path.Join(t.prefix, name))
+}
+
+// coldTierForStream returns the cold tier for the given stream, or nil if none is configured.
+func (js *jetStream) coldTierForStream(account, stream string) ColdTier {
+	if js == nil || js.coldTier == nil {
+		return nil
+	}
+	return &prefixedColdTier{js.coldTier, path.Join(account, stream)}
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Directory based cold tier
+////////////////////////////////////////////////////////////////////////////////
+
+type dirColdTier struct {
+	dir string
+}
+
+// NewDirColdTier returns a cold tier that stores blocks in a local directory.
+func NewDirColdTier(dir string) (ColdTier, error) {
+	if err := os.MkdirAll(dir, defaultDirPerms); err != nil {
+		return nil, fmt.Errorf("could not create cold tier directory - %v", err)
+	}
+	return &dirColdTier{dir: dir}, nil
+}
+
+func (t *dirColdTier) Put(name string, data []byte) error {
+	fn := filepath.Join(t.dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(fn), defaultDirPerms); err != nil {
+		return err
+	}
+	tmp := fn + ".tmp"
+	if err := os.WriteFile(tmp, data, defaultFilePerms); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, fn)
+}
+
+func (t *dirColdTier) Get(name string) ([]byte, error) {
+	return os.ReadFile(filepath.Join(t.dir, filepath.FromSlash(name)))
+}
+
+func (t *dirColdTier) Delete(name string) error {
+	if err := os.Remove(filepath.Join(t.dir, filepath.FromSlash(name))); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// S3 compatible cold tier
+////////////////////////////////////////////////////////////////////////////////
+
+type s3ColdTier struct {
+	endpoint *url.URL
+	opts     S3ColdTierOpts
+	client   *http.Client
+}
+
+// NewS3ColdTier returns a cold tier that stores blocks in an S3 compatible object store.
+// Requests use path style addressing and are signed with AWS signature version 4.
+func NewS3ColdTier(opts *S3ColdTierOpts) (ColdTier, error) {
+	if opts.Endpoint == _EMPTY_ || opts.Bucket == _EMPTY_ {
+		return nil, fmt.Errorf("cold tier S3 requires an endpoint and bucket")
+	}
+	u, err := url.Parse(opts.Endpoint)
+	if err != nil || u.Host == _EMPTY_ {
+		return nil, fmt.Errorf("cold tier S3 endpoint %q is not a valid URL", opts.Endpoint)
+	}
+	t := &s3ColdTier{endpoint: u, opts: *opts, client: &http.Client{Timeout: 30 * time.Second}}
+	if t.opts.Region == _EMPTY_ {
+		t.opts.Region = "us-east-1"
+	}
+	return t, nil
+}
+
+func (t *s3ColdTier) Put(name string, data []byte) error {
+	resp, err := t.do(http.MethodPut, name, data)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return s3Error(resp)
+	}
+	return nil
+}
+
+func (t *s3ColdTier) Get(name string) ([]byte, error) {
+	resp, err := t.do(http.MethodGet, name, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, s3Error(resp)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+func (t *s3ColdTier) Delete(name string) error {
+	resp, err := t.do(http.MethodDelete, name, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusNotFound {
+		return s3Error(resp)
+	}
+	return nil
+}
+
+func (t *s3ColdTier) do(method, name string, body []byte) (*http.Response, error) {
+	u := *t.endpoint
+	u.Path = path.Join("/", u.Path, t.opts.Bucket, t.opts.Prefix, name)
+	u.RawPath = s3URIEncode(u.Path)
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = int64(len(body))
+	s3SignRequest(req, body, t.opts.Region, t.opts.AccessKey, t.opts.SecretKey, time.Now())
+	return t.client.Do(req)
+}
+
+func s3Error(resp *http.Response) error {
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return fmt.Errorf("cold tier S3 request failed: %s: %s", resp.Status, bytes.TrimSpace(msg))
+}
+
+// s3SignRequest signs the request using AWS signature version 4.
+// All headers present on the request are signed, in addition to the host.
+func s3SignRequest(req *http.Request, body []byte, region, accessKey, secretKey string, now time.Time) {
+	now = now.UTC()
+	amzDate, date := now.Format("20060102T150405Z"), now.Format("20060102")
+	payloadHash := sha256.Sum256(body)
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", hex.EncodeToString(payloadHash[:]))
+
+	host := req.Host
+	if host == _EMPTY_ {
+		host = req.URL.Host
+	}
+	headers := map[string]string{"host": host}
+	for k, v := range req.Header {
+		headers[strings.ToLower(k)] = strings.TrimSpace(strings.Join(v, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	var canonical strings.Builder
+	canonical.WriteString(req.Method + "\n")
+	canonical.WriteString(req.URL.EscapedPath() + "\n")
+	canonical.WriteString(req.URL.Query().Encode() + "\n")
+	for _, k := range names {
+		canonical.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+	canonical.WriteString("\n" + signedHeaders + "\n")
+	canonical.WriteString(hex.EncodeToString(payloadHash[:]))
+
+	scope := date + "/" + region + "/s3/aws4_request"
+	canonicalHash := sha256.Sum256([]byte(canonical.String()))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(canonicalHash[:])
+
+	hmacSHA256 := func(key []byte, data string) []byte {
+		h := hmac.New(sha256.New, key)
+		h.Write([]byte(data))
+		return h.Sum(nil)
+	}
+	key := hmacSHA256([]byte("AWS4"+secretKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey, scope, signedHeaders, signature))
+}
+
+// s3URIEncode encodes the path as required for S3, leaving slashes as-is.
+func s3URIEncode(p string) string {
+	var sb strings.Builder
+	for i := 0; i < len(p); i++ {
+		c := p[i]
+		if (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' || c == '/' {
+			sb.WriteByte(c)
+		} else {
+			fmt.Fprintf(&sb, "%%%02X", c)
+		}
+	}
+	return sb.String()
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// Offloading and rehydrating message blocks
+////////////////////////////////////////////////////////////////////////////////
+
+// Returns how often we check for blocks to offload.
+// Lock should be held.
+func (fs *fileStore) coldTierInterval() time.Duration {
+	return min(max(fs.cfg.ColdTierAge/4, coldTierMinInterval), coldTierMaxInterval)
+}
+
+// Starts or stops checking for blocks to offload, based on the config.
+// Lock should be held.
+func (fs *fileStore) setupColdTier() {
+	if fs.cfg.ColdTierAge <= 0 {
+		clearTimer(&fs.tierTmr)
+		return
+	}
+	if fs.fcfg.ColdTier == nil {
+		fs.warn("Cold tier age is set, but no cold tier is configured")
+		return
+	}
+	if err := fs.loadColdID(true); err != nil {
+		fs.warn("Could not set up cold tier: %v", err)
+		return
+	}
+	if fs.tierTmr == nil {
+		fs.tierTmr = time.AfterFunc(fs.coldTierInterval(), fs.offloadColdBlocks)
+	}
+}
+
+// offloadColdBlocks moves all sealed blocks that have not been written
+// or accessed for longer than the cold tier age to the cold tier.
+func (fs *fileStore) offloadColdBlocks() {
+	fs.mu.RLock()
+	if fs.closing || fs.tierTmr == nil {
+		fs.mu.RUnlock()
+		return
+	}
+	tier, cutoff := fs.fcfg.ColdTier, time.Now().UnixNano()-int64(fs.cfg.ColdTierAge)
+	blks := make([]*msgBlock, 0, len(fs.blks))
+	for _, mb := range fs.blks {
+		if mb != fs.lmb {
+			blks = append(blks, mb)
+		}
+	}
+	fs.mu.RUnlock()
+
+	for _, mb := range blks {
+		if err := mb.offloadToColdTier(tier, cutoff); err != nil {
+			fs.warn("Error offloading msg block %d to cold tier: %v", mb.index, err)
+		}
+	}
+
+	fs.mu.Lock()
+	if fs.tierTmr != nil {
+		fs.tierTmr.Reset(fs.coldTierInterval())
+	}
+	fs.mu.Unlock()
+}
+
+// loadColdID loads the identity the blocks of this store are kept under in the cold tier,
+// creating it if asked to. Every replica of a stream offloads its own blocks, and the block
+// indexes of replicas are not guaranteed to line up, so each store has its own identity.
+// It's kept in the store directory, so it doesn't change when the server is renamed.
+// Lock should be held.
+func (fs *fileStore) loadColdID(create bool) error {
+	if fs.coldID != _EMPTY_ {
+		return nil
+	}
+	fn := filepath.Join(fs.fcfg.StoreDir, coldIDFile)
+	fs.dios.acquire()
+	buf, err := os.ReadFile(fn)
+	fs.dios.release()
+	if err == nil {
+		if id := string(bytes.TrimSpace(buf)); id != _EMPTY_ {
+			fs.coldID = id
+			return nil
+		}
+	} else if !os.IsNotExist(err) || !create {
+		return err
+	}
+	id := nuid.Next()
+	if err = writeFileWithSync(fs.dios, fn, []byte(id), defaultFilePerms); err != nil {
+		return err
+	}
+	fs.coldID = id
+	return nil
+}
+
+// Name of the block in the cold tier.
+func (mb *msgBlock) coldName() string {
+	return path.Join(mb.fs.coldID, fmt.Sprintf(blkScan, mb.index))
+}
+
+// Name of the local marker file for a block that's in the cold tier.
+func (mb *msgBlock) coldMarker() string {
+	return filepath.Join(mb.fs.fcfg.StoreDir, msgDir, fmt.Sprintf(coldScan, mb.index))
+}
+
+// Returns whether the block can be offloaded, it needs to be sealed, and last
+// written and accessed before the cutoff.
+// Lock should be held.
+func (mb *msgBlock) offloadable(cutoff int64) bool {
+	return !mb.cold && !mb.coldDel && mb.coldWait == nil && !mb.closed && mb.mfn != _EMPTY_ && mb.msgs > 0 &&
+		mb.last.ts <= cutoff && max(mb.lwts, mb.llts, mb.lrts) <= cutoff && mb.pendingWriteSizeLocked() == 0
+}
+
+// offloadToColdTier moves the block to the cold tier if it was last written and accessed before the cutoff.
+// The block file is replaced by a marker file, all other state is kept.
+// The block is uploaded without holding the lock, and only offloaded if it didn't change meanwhile.
+func (mb *msgBlock) offloadToColdTier(tier ColdTier, cutoff int64) error {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+	if !mb.offloadable(cutoff) {
+		return nil
+	}
+	mb.closeFDsLockedNoCheck()
+	mb.clearCacheAndOffset()
+
+	mb.fs.dios.acquire()
+	fi, err := os.Stat(mb.mfn)
+	var buf []byte
+	if err == nil {
+		buf, err = os.ReadFile(mb.mfn)
+	}
+	mb.fs.dios.release()
+	if err != nil {
+		return err
+	}
+
+	name, done := mb.coldName(), make(chan struct{})
+	mb.coldWait = done
+	mb.mu.Unlock()
+	err = tier.Put(name, buf)
+	mb.mu.Lock()
+	mb.coldWait = nil
+	close(done)
+	if err != nil {
+		return err
+	}
+
+	// The block could have been removed, rewritten or accessed while uploading, try again later.
+	mb.fs.dios.acquire()
+	nfi, serr := os.Stat(mb.mfn)
+	mb.fs.dios.release()
+	if serr != nil || nfi.Size() != fi.Size() || !nfi.ModTime().Equal(fi.ModTime()) || !mb.offloadable(cutoff) {
+		mb.deleteFromColdTier(tier)
+		return nil
+	}
+	// Write the marker before removing the block, if we crash in between the block takes precedence.
+	if err = writeFileWithSync(mb.fs.dios, mb.coldMarker(), nil, defaultFilePerms); err != nil {
+		return err
+	}
+	mb.fs.dios.acquire()
+	err = os.Remove(mb.mfn)
+	mb.fs.dios.release()
+	if err != nil {
+		_ = os.Remove(mb.coldMarker())
+		return err
+	}
+	mb.markCold()
+	return nil
+}
+
+// Marks the block as offloaded, and accounts for it in the cold tier.
+// Lock should be held.
+func (mb *msgBlock) markCold() {
+	mb.cold, mb.coldBytes = true, mb.bytes
+	mb.fs.ncold.Add(1)
+	mb.fs.ncoldBytes.Add(mb.coldBytes)
+}
+
+// Marks the block as no longer offloaded, and removes it from the cold tier accounting.
+// Lock should be held.
+func (mb *msgBlock) clearCold() {
+	mb.fs.ncold.Add(-1)
+	mb.fs.ncoldBytes.Add(^(mb.coldBytes - 1))
+	mb.cold, mb.coldBytes = false, 0
+}
+
+// rehydrate brings the block back from the cold tier, after which it can be used as usual.
+// The block is fetched without holding the lock, concurrent callers wait on the same fetch,
+// and the lock is only reacquired to install the block.
+// Lock should be held, and is released while fetching.
+func (mb *msgBlock) rehydrate() error {
+	for mb.cold {
+		if mb.closed {
+			return errNoMsgBlk
+		}
+		// Wait for a fetch that's already in progress.
+		if wait := mb.coldWait; wait != nil {
+			mb.mu.Unlock()
+			<-wait
+			mb.mu.Lock()
+			continue
+		}
+		tier := mb.fs.fcfg.ColdTier
+		if tier == nil {
+			return errNoColdTier
+		}
+		name, done := mb.coldName(), make(chan struct{})
+		mb.coldWait = done
+		mb.mu.Unlock()
+		buf, err := tier.Get(name)
+		mb.mu.Lock()
+		mb.coldWait = nil
+		close(done)
+		if err != nil {
+			return fmt.Errorf("failed to load msg block %d from cold tier: %w", mb.index, err)
+		}
+		// The block could have been removed meanwhile.
+		if !mb.cold || mb.closed {
+			break
+		}
+		if err = writeFileWithSync(mb.fs.dios, mb.mfn, buf, defaultFilePerms); err != nil {
+			return err
+		}
+		mb.clearCold()
+		_ = os.Remove(mb.coldMarker())
+		// The block will be offloaded again once it's cold, and the deletion is done.
+		mb.deleteFromColdTier(tier)
+		return nil
+	}
+	if mb.closed {
+		return errNoMsgBlk
+	}
+	return nil
+}
+
+// Removes the block from the cold tier, used when the block is removed.
+// Lock should be held.
+func (mb *msgBlock) removeFromColdTier() {
+	if !mb.cold {
+		return
+	}
+	mb.clearCold()
+	_ = os.Remove(mb.coldMarker())
+	if tier := mb.fs.fcfg.ColdTier; tier != nil {
+		mb.deleteFromColdTier(tier)
+	}
+}
+
+// Deletes the block from the cold tier in the background, the block is not
+// offloaded again until the deletion is done.
+// Lock should be held.
+func (mb *msgBlock) deleteFromColdTier(tier ColdTier) {
+	name := mb.coldName()
+	mb.coldDel = true
+	go func() {
+		if err := tier.Delete(name); err != nil {
+			mb.fs.warn("Error removing msg block %d from cold tier: %v", mb.index, err)
+		}
+		mb.mu.Lock()
+		mb.coldDel = false
+		mb.mu.Unlock()
+	}()
+}
+
+// rehydrateColdBlocksOnRecover brings back all blocks from the cold tier before
+// rebuilding the stream state from the blocks.
+// Lock should be held.
+func (fs *fileStore) rehydrateColdBlocksOnRecover() {
+	mdir := filepath.Join(fs.fcfg.StoreDir, msgDir)
+	markers, err := filepath.Glob(filepath.Join(mdir, "*"+coldSuffix))
+	if err != nil || len(markers) == 0 {
+		return
+	}
+	if err = fs.loadColdID(false); err != nil {
+		fs.warn("Could not recover msg blocks from cold tier: %v", err)
+		return
+	}
+	for _, fn := range markers {
+		var index uint32
+		if n, err := fmt.Sscanf(filepath.Base(fn), coldScan, &index); err != nil || n != 1 {
+			continue
+		}
+		mb := &msgBlock{fs: fs, index: index, mfn: filepath.Join(mdir, fmt.Sprintf(blkScan, index))}
+		if _, err := os.Stat(mb.mfn); err == nil {
+			// The block is still available locally, so we crashed while offloading.
+			_ = os.Remove(fn)
+			continue
+		}
+		mb.mu.Lock()
+		mb.markCold()
+		err := mb.rehydrate()
+		if err != nil && mb.cold {
+			mb.clearCold()
+		}
+		mb.mu.Unlock()
+		if err != nil {
+			fs.warn("Could not recover msg block %d from cold tier: %v", index, err)
+		}
+	}
+}
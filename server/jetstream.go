@@ -136,6 +136,18 @@ type jetStream struct {
 	prNewPeers map[string]struct{}
 	prRunning  bool
 
+	// Where sealed message blocks of file based streams can be offloaded to.
+	coldTier ColdTier
+
+	// Transactions across atomic batches of multiple streams, that we take part in.
+	txnMu  sync.Mutex
+	txns   map[string]*batchTxnState
+	txnSub *subscription
+	txnc   *client
+
+	// Results of scrubbing stores and Raft logs in the background.
+	scrub JSScrubStats
+
 	// Some bools regarding general state.
 	metaRecovering bool
 	standAlone     bool
@@ -437,6 +449,14 @@ func (s *Server) enableJetStream(cfg JetStreamConfig) error {
 	atomic.StoreInt64(&js.queueLimit, s.getOpts().JetStreamRequestQueueLimit)
 	atomic.StoreInt64(&js.infoQueueLimit, s.getOpts().JetStreamInfoQueueLimit)
 
+	// Changes are rejected on reload, see diffOptions.
+	opts := s.getOpts()
+	coldTier, err := newColdTier(&opts.JetStreamColdTier)
+	if err != nil {
+		return err
+	}
+	js.coldTier = coldTier
+
 	s.js.Store(js)
 
 	// FIXME(dlc) - Allow memory only operation?
@@ -467,7 +487,7 @@ func (s *Server) enableJetStream(cfg JetStreamConfig) error {
 		s.SetDefaultSystemAccount()
 	}
 
-	opts := s.getOpts()
+	opts = s.getOpts()
 	if !opts.DisableJetStreamBanner {
 		s.Noticef("    _ ___ _____ ___ _____ ___ ___   _   __  __")
 		s.Noticef(" _ | | __|_   _/ __|_   _| _ \\ __| /_\\ |  \\/  |")
@@ -537,6 +557,9 @@ func (s *Server) enableJetStream(cfg JetStreamConfig) error {
 	// Mark when we are up and running.
 	js.setStarted()
 
+	// Start verifying stores and Raft logs in the background, if enabled.
+	js.startScrubber()
+
 	return nil
 }
 
@@ -1048,6 +1071,8 @@ func (s *Server) shutdownJetStream() {
 	}
 	accPurgeSub := js.accountPurge
 	js.accountPurge = nil
+	txnSub, txnc := js.txnSub, js.txnc
+	js.txnSub, js.txnc = nil, nil
 	// Signal we are shutting down.
 	js.shuttingDown = true
 	js.mu.Unlock()
@@ -1055,6 +1080,12 @@ func (s *Server) shutdownJetStream() {
 	if accPurgeSub != nil {
 		s.sysUnsubscribe(accPurgeSub)
 	}
+	if txnSub != nil {
+		s.sysUnsubscribe(txnSub)
+	}
+	if txnc != nil {
+		txnc.closeConnection(ClientClosed)
+	}
 
 	for _, a := range accounts {
 		a.removeJetStream()
@@ -97,6 +97,21 @@ const (
 	JSApiMsgDelete  = "$JS.API.STREAM.MSG.DELETE.*"
 	JSApiMsgDeleteT = "$JS.API.STREAM.MSG.DELETE.%s"
 
+	// JSApiMsgRedact is the endpoint to redact messages of a stream.
+	// Will return JSON response.
+	JSApiMsgRedact  = "$JS.API.STREAM.MSG.REDACT.*"
+	JSApiMsgRedactT = "$JS.API.STREAM.MSG.REDACT.%s"
+
+	// JSApiStreamViewCreate is the endpoint to create a point-in-time view of a stream.
+	// Will return JSON response.
+	JSApiStreamViewCreate  = "$JS.API.STREAM.VIEW.CREATE.*"
+	JSApiStreamViewCreateT = "$JS.API.STREAM.VIEW.CREATE.%s"
+
+	// JSApiStreamViewDelete is the endpoint to delete a point-in-time view of a stream.
+	// Will return JSON response.
+	JSApiStreamViewDelete  = "$JS.API.STREAM.VIEW.DELETE.*.*"
+	JSApiStreamViewDeleteT = "$JS.API.STREAM.VIEW.DELETE.%s.%s"
+
 	// JSApiMsgGet is the template for direct requests for a message by its stream sequence number.
 	// Will return JSON response.
 	JSApiMsgGet  = "$JS.API.STREAM.MSG.GET.*"
@@ -164,6 +179,16 @@ const (
 	JSApiConsumerUnpin  = "$JS.API.CONSUMER.UNPIN.*.*"
 	JSApiConsumerUnpinT = "$JS.API.CONSUMER.UNPIN.%s.%s"
 
+	// JSApiConsumerStateExport is the endpoint to export the state of a consumer in a portable form.
+	// Will return JSON response.
+	JSApiConsumerStateExport  = "$JS.API.CONSUMER.STATE.EXPORT.*.*"
+	JSApiConsumerStateExportT = "$JS.API.CONSUMER.STATE.EXPORT.%s.%s"
+
+	// JSApiConsumerStateImport is the endpoint to import a previously exported consumer state.
+	// Will return JSON response.
+	JSApiConsumerStateImport  = "$JS.API.CONSUMER.STATE.IMPORT.*.*"
+	JSApiConsumerStateImportT = "$JS.API.CONSUMER.STATE.IMPORT.%s.%s"
+
 	// jsRequestNextPre
 	jsRequestNextPre = "$JS.API.CONSUMER.MSG.NEXT."
 
@@ -181,6 +206,11 @@ const (
 	JSApiStreamEvacuatePeer  = "$JS.API.STREAM.PEER.EVACUATE.*"
 	JSApiStreamEvacuatePeerT = "$JS.API.STREAM.PEER.EVACUATE.%s"
 
+	// JSApiStreamPromotePeer is the endpoint to promote a learner of a clustered stream to a voting replica.
+	// Will return JSON response.
+	JSApiStreamPromotePeer  = "$JS.API.STREAM.PEER.PROMOTE.*"
+	JSApiStreamPromotePeerT = "$JS.API.STREAM.PEER.PROMOTE.%s"
+
 	// JSApiStreamCancelMove is the endpoint to cancel an in-progress stream reconfiguration,
 	// rolling the stream back to the config and peers it had before the reconfiguration
 	// started. This is not limited to moves, any in-flight desired state is rolled back,
@@ -258,6 +288,9 @@ const (
 	jsFlowControl   = "$JS.FC.%s.%s.*"
 	jsFlowControlV2 = "$JS.FC.%s.%s.%s.%s.*"
 
+	// jsDeadLetterAckT is the template for PubAcks of messages a consumer dead lettered.
+	jsDeadLetterAckT = "$JS.DLA.%s.%s"
+
 	// JSAdvisoryPrefix is a prefix for all JetStream advisories.
 	JSAdvisoryPrefix = "$JS.EVENT.ADVISORY"
 
@@ -276,6 +309,9 @@ const (
 	// JSAdvisoryConsumerMsgTerminatedPre is a notification published when a message has been terminated.
 	JSAdvisoryConsumerMsgTerminatedPre = "$JS.EVENT.ADVISORY.CONSUMER.MSG_TERMINATED"
 
+	// JSAdvisoryConsumerDeadLetterFailedPre is a notification published when a message could not be dead lettered.
+	JSAdvisoryConsumerDeadLetterFailedPre = "$JS.EVENT.ADVISORY.CONSUMER.DEAD_LETTER_FAILED"
+
 	// JSAdvisoryStreamCreatedPre notification that a stream was created.
 	JSAdvisoryStreamCreatedPre = "$JS.EVENT.ADVISORY.STREAM.CREATED"
 
@@ -300,6 +336,9 @@ const (
 	// JSAdvisoryConsumerUnpinnedPre notification that a consumer was unpinned.
 	JSAdvisoryConsumerUnpinnedPre = "$JS.EVENT.ADVISORY.CONSUMER.UNPINNED"
 
+	// JSAdvisoryConsumerLagPre notification that a consumer reached or recovered from a lag threshold.
+	JSAdvisoryConsumerLagPre = "$JS.EVENT.ADVISORY.CONSUMER.LAG"
+
 	// JSAdvisoryStreamSnapshotCreatePre notification that a snapshot was created.
 	JSAdvisoryStreamSnapshotCreatePre = "$JS.EVENT.ADVISORY.STREAM.SNAPSHOT_CREATE"
 
@@ -324,6 +363,9 @@ const (
 	// JSAdvisoryStreamBatchAbandonedPre notification that a stream's batch was abandoned.
 	JSAdvisoryStreamBatchAbandonedPre = "$JS.EVENT.ADVISORY.STREAM.BATCH_ABANDONED"
 
+	// JSAdvisoryStreamMsgRedactedPre notification that a stream message was redacted.
+	JSAdvisoryStreamMsgRedactedPre = "$JS.EVENT.ADVISORY.STREAM.MSG_REDACTED"
+
 	// JSAdvisoryConsumerLeaderElectedPre notification that a replicated consumer has elected a leader.
 	JSAdvisoryConsumerLeaderElectedPre = "$JS.EVENT.ADVISORY.CONSUMER.LEADER_ELECTED"
 
@@ -333,6 +375,9 @@ const (
 	// JSAdvisoryServerOutOfStorage notification that a server has no more storage.
 	JSAdvisoryServerOutOfStorage = "$JS.EVENT.ADVISORY.SERVER.OUT_OF_STORAGE"
 
+	// JSAdvisoryStoreCorruption notification that a server found a corrupt block in a store or Raft log.
+	JSAdvisoryStoreCorruption = "$JS.EVENT.ADVISORY.SERVER.STORE_CORRUPTION"
+
 	// JSAdvisoryServerRemoved notification that a server has been removed from the system.
 	JSAdvisoryServerRemoved = "$JS.EVENT.ADVISORY.SERVER.REMOVED"
 
@@ -557,6 +602,28 @@ type JSApiConsumerUnpinResponse struct {
 
 const JSApiConsumerUnpinResponseType = "io.nats.jetstream.api.v1.consumer_unpin_response"
 
+// JSApiConsumerStateExportResponse holds the exported state of a consumer.
+type JSApiConsumerStateExportResponse struct {
+	ApiResponse
+	Checkpoint *ConsumerCheckpoint `json:"checkpoint,omitempty"`
+}
+
+const JSApiConsumerStateExportResponseType = "io.nats.jetstream.api.v1.consumer_state_export_response"
+
+// JSApiConsumerStateImportRequest is for importing an exported consumer state into
+// a consumer on a stream that mirrors or sources the stream it was exported from.
+type JSApiConsumerStateImportRequest struct {
+	Checkpoint *ConsumerCheckpoint `json:"checkpoint"`
+}
+
+// JSApiConsumerStateImportResponse holds the consumer info after the import.
+type JSApiConsumerStateImportResponse struct {
+	ApiResponse
+	*ConsumerInfo
+}
+
+const JSApiConsumerStateImportResponseType = "io.nats.jetstream.api.v1.consumer_state_import_response"
+
 // JSApiStreamUpdateResponse for updating a stream.
 type JSApiStreamUpdateResponse struct {
 	ApiResponse
@@ -578,6 +645,46 @@ type JSApiMsgDeleteResponse struct {
 
 const JSApiMsgDeleteResponseType = "io.nats.jetstream.api.v1.stream_msg_delete_response"
 
+// JSApiMsgRedactRequest redacts a message, removing its payload and the given headers.
+// The message keeps its sequence, subject and timestamp.
+type JSApiMsgRedactRequest struct {
+	Seq     uint64   `json:"seq"`
+	Headers []string `json:"headers,omitempty"`
+	// Reason is included in the advisory for the redaction.
+	Reason string `json:"reason,omitempty"`
+}
+
+type JSApiMsgRedactResponse struct {
+	ApiResponse
+	Success bool `json:"success,omitempty"`
+}
+
+const JSApiMsgRedactResponseType = "io.nats.jetstream.api.v1.stream_msg_redact_response"
+
+// JSApiStreamViewCreateRequest is for creating a point-in-time view of a stream.
+// The view ends at Seq, or right before the first message at or after Time.
+// Without either the view ends at the last message of the stream.
+type JSApiStreamViewCreateRequest struct {
+	Seq  uint64     `json:"seq,omitempty"`
+	Time *time.Time `json:"time,omitempty"`
+	// TTL is how long the view stays open, defaults to 5 minutes.
+	TTL time.Duration `json:"ttl,omitempty"`
+}
+
+type JSApiStreamViewCreateResponse struct {
+	ApiResponse
+	*StreamViewInfo
+}
+
+const JSApiStreamViewCreateResponseType = "io.nats.jetstream.api.v1.stream_view_create_response"
+
+type JSApiStreamViewDeleteResponse struct {
+	ApiResponse
+	Success bool `json:"success,omitempty"`
+}
+
+const JSApiStreamViewDeleteResponseType = "io.nats.jetstream.api.v1.stream_view_delete_response"
+
 type JSApiStreamSnapshotRequest struct {
 	// Subject to deliver the chunks to for the snapshot.
 	DeliverSubject string `json:"deliver_subject"`
@@ -640,6 +747,20 @@ type JSApiStreamRemovePeerResponse struct {
 
 const JSApiStreamRemovePeerResponseType = "io.nats.jetstream.api.v1.stream_remove_peer_response"
 
+// JSApiStreamPromotePeerRequest is the required promote peer request.
+type JSApiStreamPromotePeerRequest struct {
+	// Server name or peer ID of the learner to be promoted.
+	Peer string `json:"peer"`
+}
+
+// JSApiStreamPromotePeerResponse is the response to a promote peer request.
+type JSApiStreamPromotePeerResponse struct {
+	ApiResponse
+	Success bool `json:"success,omitempty"`
+}
+
+const JSApiStreamPromotePeerResponseType = "io.nats.jetstream.api.v1.stream_promote_peer_response"
+
 // JSApiStreamLeaderStepDownResponse is the response to a leader stepdown request.
 type JSApiStreamLeaderStepDownResponse struct {
 	ApiResponse
@@ -755,6 +876,12 @@ type JSApiMsgGetRequest struct {
 	UpToTime *time.Time `json:"up_to_time,omitempty"`
 	// Only return the message payload, excluding headers if present.
 	NoHeaders bool `json:"no_hdr,omitempty"`
+	// Only return messages visible through this view of the stream. Views are only known
+	// to the stream itself, mirrors serving direct gets should be bounded by UpToSeq instead.
+	View string `json:"view,omitempty"`
+	// Only serve the request once the stream has applied at least this sequence. Replicas serving
+	// direct gets wait for a short time, and forward the request to the leader if still behind.
+	MinLastSeq uint64 `json:"min_last_seq,omitempty"`
 }
 
 type JSApiMsgGetResponse struct {
@@ -1028,6 +1155,11 @@ func (s *Server) setJetStreamExportSubs() error {
 		return err
 	}
 
+	// Votes and decisions for transactions across atomic batches.
+	if err := js.setupBatchTxnSubs(); err != nil {
+		return err
+	}
+
 	if err := s.SystemAccount().AddServiceExport(jsAllAPI, nil); err != nil {
 		s.Warnf("Error setting up jetstream service exports: %v", err)
 		return err
@@ -1047,10 +1179,14 @@ func (s *Server) setJetStreamExportSubs() error {
 		{JSApiStreamRestore, s.jsStreamRestoreRequest},
 		{JSApiStreamRemovePeer, s.jsStreamRemovePeerRequest},
 		{JSApiStreamEvacuatePeer, s.jsStreamEvacuatePeerRequest},
+		{JSApiStreamPromotePeer, s.jsStreamPromotePeerRequest},
 		{JSApiStreamCancelMove, s.jsStreamCancelMoveRequest},
 		{JSApiStreamLeaderStepDown, s.jsStreamLeaderStepDownRequest},
 		{JSApiConsumerLeaderStepDown, s.jsConsumerLeaderStepDownRequest},
 		{JSApiMsgDelete, s.jsMsgDeleteRequest},
+		{JSApiMsgRedact, s.jsMsgRedactRequest},
+		{JSApiStreamViewCreate, s.jsStreamViewCreateRequest},
+		{JSApiStreamViewDelete, s.jsStreamViewDeleteRequest},
 		{JSApiMsgGet, s.jsMsgGetRequest},
 		{JSApiConsumerCreateEx, s.jsConsumerCreateRequest},
 		{JSApiConsumerCreate, s.jsConsumerCreateRequest},
@@ -1058,6 +1194,7 @@ func (s *Server) setJetStreamExportSubs() error {
 		{JSApiConsumerDelete, s.jsConsumerDeleteRequest},
 		{JSApiConsumerPause, s.jsConsumerPauseRequest},
 		{JSApiConsumerUnpin, s.jsConsumerUnpinRequest},
+		{JSApiConsumerStateImport, s.jsConsumerStateImportRequest},
 	}
 	infopairs := []struct {
 		subject string
@@ -1070,6 +1207,7 @@ func (s *Server) setJetStreamExportSubs() error {
 		{JSApiConsumers, s.jsConsumerNamesRequest},
 		{JSApiConsumerList, s.jsConsumerListRequest},
 		{JSApiConsumerInfo, s.jsConsumerInfoRequest},
+		{JSApiConsumerStateExport, s.jsConsumerStateExportRequest},
 	}
 
 	js.mu.Lock()
@@ -1517,6 +1655,13 @@ func (s *Server) jsStreamCreateRequest(sub *subscription, c *client, _ *Account,
 		return
 	}
 
+	// Partitions are created by the server, along with their partitioned stream.
+	if cfg.Partition != 0 {
+		resp.Error = NewJSStreamPartitionOperationError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+
 	// If we are told to do mirror direct but are not mirroring, error.
 	if cfg.MirrorDirect && cfg.Mirror == nil {
 		resp.Error = NewJSStreamInvalidConfigError(fmt.Errorf("stream has no mirror but does have mirror direct"))
@@ -1524,6 +1669,12 @@ func (s *Server) jsStreamCreateRequest(sub *subscription, c *client, _ *Account,
 		return
 	}
 
+	if apiErr := s.checkStreamSourcesSubjectPermissions(ci, acc, &cfg.StreamConfig); apiErr != nil {
+		resp.Error = apiErr
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+
 	// Hand off to cluster for processing.
 	if s.JetStreamIsClustered() {
 		s.jsClusteredStreamRequest(ci, acc, subject, reply, rmsg, &cfg)
@@ -1610,6 +1761,13 @@ func (s *Server) jsStreamUpdateRequest(sub *subscription, c *client, _ *Account,
 		return
 	}
 
+	// Partitions are updated through their partitioned stream.
+	if ncfg.Partition != 0 {
+		resp.Error = NewJSStreamPartitionOperationError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+
 	cfg, apiErr := s.checkStreamCfg(&ncfg.StreamConfig, acc, ncfg.Pedantic)
 	if apiErr != nil {
 		resp.Error = apiErr
@@ -1624,6 +1782,12 @@ func (s *Server) jsStreamUpdateRequest(sub *subscription, c *client, _ *Account,
 		return
 	}
 
+	if apiErr := s.checkStreamSourcesSubjectPermissions(ci, acc, &cfg); apiErr != nil {
+		resp.Error = apiErr
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+
 	// Handle clustered version here.
 	if s.JetStreamIsClustered() {
 		s.jsClusteredStreamUpdateRequest(ci, acc, subject, reply, copyBytes(rmsg), &cfg, ncfg.Pedantic)
@@ -2090,6 +2254,12 @@ func (s *Server) jsStreamInfoRequest(sub *subscription, c *client, a *Account, s
 		return
 	}
 
+	// We might have been replaced as leader without knowing it yet, in which case the new leader answers.
+	if err := mset.waitForLinearizableRead(); err != nil {
+		s.Debugf("Not answering stream info for '%s > %s': %v", acc.Name, streamName, err)
+		return
+	}
+
 	// Report the config as requested, the stream can still be running at its origin.
 	config := js.targetStreamConfig(mset, mset.config())
 	resp.StreamInfo = &StreamInfo{
@@ -2152,6 +2322,8 @@ func (s *Server) jsStreamInfoRequest(sub *subscription, c *client, a *Account, s
 	if mset.hasCatchupPeers() {
 		mset.checkClusterInfo(resp.StreamInfo.Cluster)
 	}
+	// Aggregate the state of all partitions if we are a partitioned stream.
+	s.addPartitionsInfo(acc, resp.StreamInfo)
 
 	s.sendAPIResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(resp))
 }
@@ -2577,6 +2749,24 @@ func (s *Server) jsStreamRemapPeerRequest(_ *subscription, c *client, _ *Account
 		isMember = isGroupMember(nodeName)
 	}
 
+	// A learner is not a member, but gets replaced the same way.
+	if !isMember {
+		learner := getHash(req.Peer)
+		if !sa.Group.isLearner(learner) {
+			learner = req.Peer
+		}
+		if sa.Group.isLearner(learner) {
+			if !js.replaceStreamLearnerLocked(sa, learner) {
+				resp.Error = NewJSPeerRemapError()
+				s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+				return
+			}
+			resp.Success = true
+			s.sendAPIResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(resp))
+			return
+		}
+	}
+
 	// Make sure we are a member.
 	if !isMember {
 		resp.Error = NewJSClusterPeerNotMemberError()
@@ -2595,6 +2785,104 @@ func (s *Server) jsStreamRemapPeerRequest(_ *subscription, c *client, _ *Account
 	s.sendAPIResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(resp))
 }
 
+// Request to promote a learner of a clustered stream to a voting replica.
+func (s *Server) jsStreamPromotePeerRequest(_ *subscription, c *client, _ *Account, subject, reply string, rmsg []byte) {
+	if c == nil || !s.JetStreamEnabled() {
+		return
+	}
+	ci, acc, hdr, msg, err := s.getRequestInfo(c, rmsg)
+	if err != nil {
+		s.Warnf(badAPIRequestT, msg)
+		return
+	}
+
+	// Have extra token for this one.
+	name := tokenAt(subject, 6)
+
+	var resp = JSApiStreamPromotePeerResponse{ApiResponse: ApiResponse{Type: JSApiStreamPromotePeerResponseType}}
+
+	// If we are not in clustered mode this is a failed request.
+	if !s.JetStreamIsClustered() {
+		resp.Error = NewJSClusterRequiredError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+
+	js, cc := s.getJetStreamCluster()
+	if js == nil || cc == nil {
+		return
+	}
+	if js.isLeaderless() {
+		resp.Error = NewJSClusterNotAvailError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+
+	js.mu.RLock()
+	isLeader, sa := cc.isLeader(), js.streamAssignmentOrInflight(acc.Name, name)
+	js.mu.RUnlock()
+
+	// Make sure we are meta leader.
+	if !isLeader {
+		return
+	}
+
+	if errorOnRequiredApiLevel(hdr) {
+		resp.Error = NewJSRequiredApiLevelError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+
+	if hasJS, doErr := acc.checkJetStream(); !hasJS {
+		if doErr {
+			resp.Error = NewJSNotEnabledForAccountError()
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		}
+		return
+	}
+	if isEmptyRequest(msg) {
+		resp.Error = NewJSBadRequestError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+
+	var req JSApiStreamPromotePeerRequest
+	if err := s.unmarshalRequest(c, acc, subject, msg, &req); err != nil {
+		resp.Error = NewJSInvalidJSONError(err)
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+	if req.Peer == _EMPTY_ {
+		resp.Error = NewJSBadRequestError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+
+	if sa == nil {
+		// No stream present.
+		resp.Error = NewJSStreamNotFoundError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+
+	js.mu.Lock()
+	defer js.mu.Unlock()
+
+	// Peer here is either a peer ID or a server name, convert to node name.
+	nodeName := getHash(req.Peer)
+	if !sa.Group.isLearner(nodeName) {
+		nodeName = req.Peer
+	}
+	if apiErr := js.promoteStreamLearnerLocked(acc, sa, nodeName); apiErr != nil {
+		resp.Error = apiErr
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+
+	resp.Success = true
+	s.sendAPIResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(resp))
+}
+
 // Request to have the metaleader remove a peer from the system.
 func (s *Server) jsLeaderServerRemoveRequest(sub *subscription, c *client, _ *Account, subject, reply string, rmsg []byte) {
 	if c == nil || !s.JetStreamEnabled() {
@@ -3621,6 +3909,229 @@ func (s *Server) jsMsgDeleteRequest(sub *subscription, c *client, _ *Account, su
 	s.sendAPIResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(resp))
 }
 
+// Request to redact a message.
+func (s *Server) jsMsgRedactRequest(sub *subscription, c *client, _ *Account, subject, reply string, rmsg []byte) {
+	if c == nil || !s.JetStreamEnabled() {
+		return
+	}
+	ci, acc, hdr, msg, err := s.getRequestInfo(c, rmsg)
+	if err != nil {
+		s.Warnf(badAPIRequestT, msg)
+		return
+	}
+
+	var resp = JSApiMsgRedactResponse{ApiResponse: ApiResponse{Type: JSApiMsgRedactResponseType}}
+
+	// Redactions are proposed by the stream leader, like views.
+	mset, apiErr := s.lookupStreamForViewRequest(acc, subject, hdr)
+	if mset == nil {
+		if apiErr != nil {
+			resp.Error = apiErr
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		}
+		return
+	}
+	if isEmptyRequest(msg) {
+		resp.Error = NewJSBadRequestError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+	var req JSApiMsgRedactRequest
+	if err := s.unmarshalRequest(c, acc, subject, msg, &req); err != nil {
+		resp.Error = NewJSInvalidJSONError(err)
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+	if req.Seq == 0 {
+		resp.Error = NewJSStreamMsgRedactInvalidError(errors.New("sequence is required"))
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+	if err := checkRedactHeaders(req.Headers); err != nil {
+		resp.Error = NewJSStreamMsgRedactInvalidError(err)
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+	mset.cfgMu.RLock()
+	sealed := mset.cfg.Sealed
+	mset.cfgMu.RUnlock()
+	if sealed {
+		resp.Error = NewJSStreamSealedError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+
+	r := &streamMsgRedact{
+		Client:  ci,
+		Stream:  mset.name(),
+		Seq:     req.Seq,
+		Headers: req.Headers,
+		Reason:  req.Reason,
+		Time:    time.Now().UTC(),
+		Subject: subject,
+		Reply:   reply,
+	}
+	if s.JetStreamIsClustered() {
+		s.jsClusteredMsgRedactRequest(mset, r)
+		return
+	}
+
+	if ok, err := mset.applyRedaction(r, true); err != nil {
+		resp.Error = NewJSStreamMsgRedactFailedError(err, Unless(err))
+	} else if !ok {
+		resp.Error = NewJSSequenceNotFoundError(req.Seq)
+	} else {
+		resp.Success = true
+	}
+	s.sendAPIResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(resp))
+}
+
+// lookupStreamForViewRequest returns the stream for a view request if we should handle it.
+// Returns no stream and no error if the request should not be responded to by us.
+func (s *Server) lookupStreamForViewRequest(acc *Account, subject string, hdr []byte) (*stream, *ApiError) {
+	stream := tokenAt(subject, 6)
+
+	// If we are in clustered mode we need to be the stream leader to proceed.
+	if s.JetStreamIsClustered() {
+		js, cc := s.getJetStreamCluster()
+		if js == nil || cc == nil {
+			return nil, nil
+		}
+		if js.isLeaderless() {
+			return nil, NewJSClusterNotAvailError()
+		}
+
+		js.mu.RLock()
+		isLeader, sa := cc.isLeader(), js.streamAssignment(acc.Name, stream)
+		js.mu.RUnlock()
+
+		if sa == nil {
+			if isLeader {
+				return nil, NewJSStreamNotFoundError()
+			}
+			return nil, nil
+		}
+		if js.isGroupLeaderless(sa.Group) {
+			return nil, NewJSClusterNotAvailError()
+		}
+		// Views are added by the stream leader, since it needs to resolve the sequence.
+		if !acc.JetStreamIsStreamLeader(stream) {
+			return nil, nil
+		}
+	}
+
+	if errorOnRequiredApiLevel(hdr) {
+		return nil, NewJSRequiredApiLevelError()
+	}
+
+	if hasJS, doErr := acc.checkJetStream(); !hasJS {
+		if doErr {
+			return nil, NewJSNotEnabledForAccountError()
+		}
+		return nil, nil
+	}
+
+	mset, err := acc.lookupStream(stream)
+	if err != nil {
+		return nil, NewJSStreamNotFoundError(Unless(err))
+	}
+	if mset.offlineReason != _EMPTY_ {
+		// Just let the request time out.
+		return nil, nil
+	}
+	return mset, nil
+}
+
+// Request to create a point-in-time view of a stream.
+func (s *Server) jsStreamViewCreateRequest(sub *subscription, c *client, _ *Account, subject, reply string, rmsg []byte) {
+	if c == nil || !s.JetStreamEnabled() {
+		return
+	}
+	ci, acc, hdr, msg, err := s.getRequestInfo(c, rmsg)
+	if err != nil {
+		s.Warnf(badAPIRequestT, msg)
+		return
+	}
+
+	var resp = JSApiStreamViewCreateResponse{ApiResponse: ApiResponse{Type: JSApiStreamViewCreateResponseType}}
+
+	mset, apiErr := s.lookupStreamForViewRequest(acc, subject, hdr)
+	if mset == nil {
+		if apiErr != nil {
+			resp.Error = apiErr
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		}
+		return
+	}
+
+	var req JSApiStreamViewCreateRequest
+	if !isEmptyRequest(msg) {
+		if err := s.unmarshalRequest(c, acc, subject, msg, &req); err != nil {
+			resp.Error = NewJSInvalidJSONError(err)
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+			return
+		}
+	}
+
+	vi, err := mset.newView(&req)
+	if err != nil {
+		resp.Error = NewJSStreamViewCreateError(err, Unless(err))
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+
+	if s.JetStreamIsClustered() {
+		s.jsClusteredStreamViewRequest(ci, mset, addStreamViewOp, vi, subject, reply)
+		return
+	}
+
+	mset.addView(vi)
+	resp.StreamViewInfo = vi
+	s.sendAPIResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(resp))
+}
+
+// Request to delete a point-in-time view of a stream.
+func (s *Server) jsStreamViewDeleteRequest(sub *subscription, c *client, _ *Account, subject, reply string, rmsg []byte) {
+	if c == nil || !s.JetStreamEnabled() {
+		return
+	}
+	ci, acc, hdr, msg, err := s.getRequestInfo(c, rmsg)
+	if err != nil {
+		s.Warnf(badAPIRequestT, msg)
+		return
+	}
+
+	var resp = JSApiStreamViewDeleteResponse{ApiResponse: ApiResponse{Type: JSApiStreamViewDeleteResponseType}}
+
+	mset, apiErr := s.lookupStreamForViewRequest(acc, subject, hdr)
+	if mset == nil {
+		if apiErr != nil {
+			resp.Error = apiErr
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		}
+		return
+	}
+
+	id := tokenAt(subject, 7)
+	if _, ok := mset.lookupView(id); !ok {
+		resp.Error = NewJSStreamViewNotFoundError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+
+	if s.JetStreamIsClustered() {
+		s.jsClusteredStreamViewRequest(ci, mset, removeStreamViewOp, &StreamViewInfo{ID: id}, subject, reply)
+		return
+	}
+
+	if mset.removeView(id) {
+		resp.Success = true
+	} else {
+		resp.Error = NewJSStreamViewNotFoundError()
+	}
+	s.sendAPIResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(resp))
+}
+
 // Request to get a raw stream message.
 func (s *Server) jsMsgGetRequest(sub *subscription, c *client, _ *Account, subject, reply string, rmsg []byte) {
 	if c == nil || !s.JetStreamEnabled() {
@@ -3738,6 +4249,44 @@ func (s *Server) jsMsgGetRequest(sub *subscription, c *client, _ *Account, subje
 		return
 	}
 
+	// With consumer subject permissions, only messages on subjects the user can subscribe to.
+	scfg := mset.config()
+	sp, apiErr := msgGetSubjectPermissions(ci, &scfg)
+	if apiErr == nil && sp != nil {
+		if filter := req.LastFor + req.NextFor; filter != _EMPTY_ && !subjectPermitted(filter, sp) {
+			apiErr = NewJSStreamMsgSubjectPermissionError(fmt.Errorf("subject %q not permitted", filter))
+		}
+	}
+	if apiErr != nil {
+		resp.Error = apiErr
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+
+	// We might have been replaced as leader without knowing it yet, in which case the new leader answers.
+	if err := mset.waitForLinearizableRead(); err != nil {
+		s.Debugf("Not answering message get for '%s > %s': %v", acc.Name, stream, err)
+		return
+	}
+
+	// If bound to a view, messages after the view's sequence are not visible.
+	var vseq uint64
+	if req.View != _EMPTY_ {
+		var ok bool
+		if vseq, ok = mset.lookupView(req.View); !ok {
+			resp.Error = NewJSStreamViewNotFoundError()
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+			return
+		}
+	}
+
+	// We could have just become leader and not have applied everything yet.
+	if req.MinLastSeq > 0 && mset.lastSeq() < req.MinLastSeq {
+		resp.Error = NewJSStreamMinLastSeqError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+
 	var svp StoreMsg
 	var sm *StoreMsg
 
@@ -3753,18 +4302,30 @@ func (s *Server) jsMsgGetRequest(sub *subscription, c *client, _ *Account, subje
 		seq = req.Seq
 	}
 
-	if seq > 0 && req.NextFor == _EMPTY_ {
+	if req.View != _EMPTY_ && vseq == 0 {
+		err = ErrStoreMsgNotFound
+	} else if seq > 0 && req.NextFor == _EMPTY_ {
 		sm, err = mset.store.LoadMsg(seq, &svp)
 	} else if req.NextFor != _EMPTY_ {
 		sm, _, err = mset.store.LoadNextMsg(req.NextFor, subjectHasWildcard(req.NextFor), seq, &svp)
+	} else if req.View != _EMPTY_ {
+		sm, _, err = mset.store.LoadPrevMsg(req.LastFor, subjectHasWildcard(req.LastFor), vseq, &svp)
 	} else {
 		sm, err = mset.store.LoadLastMsg(req.LastFor, &svp)
 	}
+	if err == nil && req.View != _EMPTY_ && sm.seq > vseq {
+		err = ErrStoreMsgNotFound
+	}
 	if err != nil {
 		resp.Error = NewJSNoMessageFoundError()
 		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
 		return
 	}
+	if sp != nil && !subjectPermitted(sm.subj, sp) {
+		resp.Error = NewJSStreamMsgSubjectPermissionError(fmt.Errorf("subject %q not permitted", sm.subj))
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
 	resp.Message = &StoredMsg{
 		Subject:  sm.subj,
 		Sequence: sm.seq,
@@ -3921,6 +4482,175 @@ func (s *Server) jsConsumerUnpinRequest(sub *subscription, c *client, _ *Account
 	s.sendAPIResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(resp))
 }
 
+// lookupConsumerForStateRequest looks up the consumer for a state export or import request.
+// Returns no consumer and no error if the request should be left to the consumer leader.
+func (s *Server) lookupConsumerForStateRequest(acc *Account, subject string, hdr []byte) (*consumer, *ApiError) {
+	stream, consumer := tokenAt(subject, 6), tokenAt(subject, 7)
+
+	if s.JetStreamIsClustered() {
+		// Check to make sure the stream is assigned.
+		js, cc := s.getJetStreamCluster()
+		if js == nil || cc == nil {
+			return nil, nil
+		}
+
+		// First check if the stream and consumer is there.
+		js.mu.RLock()
+		sa := js.streamAssignment(acc.Name, stream)
+		if sa == nil {
+			js.mu.RUnlock()
+			return nil, NewJSStreamNotFoundError()
+		}
+		if sa.unsupported != nil {
+			js.mu.RUnlock()
+			// Just let the request time out.
+			return nil, nil
+		}
+
+		ca, ok := sa.consumers[consumer]
+		if !ok || ca == nil {
+			js.mu.RUnlock()
+			return nil, NewJSConsumerNotFoundError()
+		}
+		if ca.unsupported != nil {
+			js.mu.RUnlock()
+			// Just let the request time out.
+			return nil, nil
+		}
+		js.mu.RUnlock()
+
+		// Then check if we are the leader.
+		mset, err := acc.lookupStream(stream)
+		if err != nil {
+			return nil, nil
+		}
+		o := mset.lookupConsumer(consumer)
+		if o == nil || !o.isLeader() {
+			return nil, nil
+		}
+	}
+
+	if errorOnRequiredApiLevel(hdr) {
+		return nil, NewJSRequiredApiLevelError()
+	}
+
+	if hasJS, doErr := acc.checkJetStream(); !hasJS {
+		if doErr {
+			return nil, NewJSNotEnabledForAccountError()
+		}
+		return nil, nil
+	}
+
+	mset, err := acc.lookupStream(stream)
+	if err != nil {
+		return nil, NewJSStreamNotFoundError()
+	}
+	if mset.offlineReason != _EMPTY_ {
+		// Just let the request time out.
+		return nil, nil
+	}
+	o := mset.lookupConsumer(consumer)
+	if o == nil {
+		return nil, NewJSConsumerNotFoundError()
+	}
+	if o.offlineReason != _EMPTY_ {
+		// Just let the request time out.
+		return nil, nil
+	}
+	return o, nil
+}
+
+// Request to export the state of a consumer.
+func (s *Server) jsConsumerStateExportRequest(sub *subscription, c *client, _ *Account, subject, reply string, rmsg []byte) {
+	if c == nil || !s.JetStreamEnabled() {
+		return
+	}
+
+	ci, acc, hdr, msg, err := s.getRequestInfo(c, rmsg)
+	if err != nil {
+		s.Warnf(badAPIRequestT, msg)
+		return
+	}
+
+	var resp = JSApiConsumerStateExportResponse{ApiResponse: ApiResponse{Type: JSApiConsumerStateExportResponseType}}
+
+	o, apiErr := s.lookupConsumerForStateRequest(acc, subject, hdr)
+	if apiErr != nil {
+		resp.Error = apiErr
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+	if o == nil {
+		return
+	}
+	resp.Checkpoint = o.checkpoint()
+	s.sendAPIResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(resp))
+}
+
+// Request to import a previously exported consumer state.
+func (s *Server) jsConsumerStateImportRequest(sub *subscription, c *client, _ *Account, subject, reply string, rmsg []byte) {
+	if c == nil || !s.JetStreamEnabled() {
+		return
+	}
+
+	ci, acc, hdr, msg, err := s.getRequestInfo(c, rmsg)
+	if err != nil {
+		s.Warnf(badAPIRequestT, msg)
+		return
+	}
+
+	var resp = JSApiConsumerStateImportResponse{ApiResponse: ApiResponse{Type: JSApiConsumerStateImportResponseType}}
+
+	o, apiErr := s.lookupConsumerForStateRequest(acc, subject, hdr)
+	if apiErr != nil {
+		resp.Error = apiErr
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+	if o == nil {
+		return
+	}
+
+	var req JSApiConsumerStateImportRequest
+	if err := json.Unmarshal(msg, &req); err != nil {
+		resp.Error = NewJSInvalidJSONError(err)
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+	if req.Checkpoint == nil {
+		resp.Error = NewJSInvalidJSONError(errors.New("checkpoint not specified"))
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+
+	mset := o.getStream()
+	if mset == nil {
+		resp.Error = NewJSStreamNotFoundError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+	state, err := mset.translateCheckpoint(req.Checkpoint)
+	if err == nil && o.config().AckPolicy == AckNone && len(state.Pending) > 0 {
+		err = errors.New("consumer does not track pending messages")
+	}
+	if err != nil {
+		resp.Error = NewJSConsumerStateImportError(err)
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+	applied, err := o.importState(state, reply)
+	if err != nil {
+		resp.Error = NewJSConsumerStateImportError(err)
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+	// In clustered mode the response is sent once the state has been replicated.
+	if applied {
+		resp.ConsumerInfo = setDynamicConsumerInfoMetadata(o.info())
+		s.sendAPIResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(resp))
+	}
+}
+
 // Request to purge a stream.
 func (s *Server) jsStreamPurgeRequest(sub *subscription, c *client, _ *Account, subject, reply string, rmsg []byte) {
 	if c == nil || !s.JetStreamEnabled() {
@@ -4035,6 +4765,12 @@ func (s *Server) jsStreamPurgeRequest(sub *subscription, c *client, _ *Account,
 		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
 		return
 	}
+	// Open views reference messages that a purge would remove.
+	if mset.hasViews() {
+		resp.Error = NewJSStreamPurgeFailedError(errors.New("stream has open views"))
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
 
 	if s.JetStreamIsClustered() {
 		s.jsClusteredStreamPurgeRequest(ci, acc, mset, stream, subject, reply, rmsg, purgeRequest)
@@ -4922,6 +5658,27 @@ func (s *Server) jsConsumerCreateRequest(sub *subscription, c *client, a *Accoun
 		return
 	}
 
+	// Direct consumers are checked as well, since clients can ask for them. The ones streams create
+	// for their mirror and sources come from the internal client of the stream, which is not restricted.
+	filters := req.Config.FilterSubjects
+	if req.Config.FilterSubject != _EMPTY_ {
+		filters = append([]string{req.Config.FilterSubject}, filters...)
+	}
+	if apiErr := checkConsumerSubjectPermissions(ci, s.jsStreamConfig(acc, streamName), filters); apiErr != nil {
+		resp.Error = apiErr
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		return
+	}
+
+	// The dead letter stream needs to be there to store the copies.
+	if dl := req.Config.DeadLetter; dl != nil {
+		if apiErr := checkDeadLetterStream(dl, s.jsStreamConfig(acc, dl.Stream), streamName, consumerName); apiErr != nil {
+			resp.Error = apiErr
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+			return
+		}
+	}
+
 	if isClustered && !direct {
 		s.jsClusteredConsumerRequest(ci, acc, subject, reply, hdr, msg, &req)
 		return
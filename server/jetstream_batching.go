@@ -434,6 +434,30 @@ func copyCounterSources(src CounterSources) CounterSources {
 	return dst
 }
 
+// stageMsgId checks the id used for duplicate detection against the staged and stored ids,
+// and stages it if it's not a duplicate.
+func (diff *batchStagedDiff) stageMsgId(mset *stream, msgId string) (uint64, *ApiError, error) {
+	// Dedupe if staged.
+	if _, ok := diff.msgIds[msgId]; ok {
+		return 0, NewJSAtomicPublishContainsDuplicateMessageError(), errMsgIdDuplicate
+	}
+	mset.ddMu.Lock()
+	defer mset.ddMu.Unlock()
+	if dde := mset.checkMsgId(msgId); dde != nil {
+		// Should not return an invalid sequence, in that case error.
+		if dde.seq > 0 {
+			return dde.seq, NewJSAtomicPublishContainsDuplicateMessageError(), errMsgIdDuplicate
+		}
+		return 0, NewJSStreamDuplicateMessageConflictError(), errMsgIdDuplicate
+	}
+	if diff.msgIds == nil {
+		diff.msgIds = map[string]struct{}{msgId: {}}
+	} else {
+		diff.msgIds[msgId] = struct{}{}
+	}
+	return 0, nil, nil
+}
+
 func (diff *batchStagedDiff) commit(mset *stream) {
 	if len(diff.msgIds) > 0 {
 		ts := time.Now().UnixNano()
@@ -531,7 +555,7 @@ func (batch *batchApply) rejectBatchState(mset *stream) {
 // mset.clMu lock must be held.
 func checkMsgHeadersPreClusteredProposal(
 	diff *batchStagedDiff, mset *stream, subject, rsubject string, hdr []byte, msg []byte, sourced bool, name string,
-	jsa *jsAccount, allowRollup, denyPurge, allowTTL, allowMsgCounter, allowMsgSchedules bool,
+	jsa *jsAccount, allowRollup, denyPurge, allowTTL, allowMsgCounter, allowMsgSchedules, allowMsgDelay, allowMsgPriority bool,
 	discard DiscardPolicy, discardNewPer bool, maxMsgSize int, maxMsgs int64, maxMsgsPer int64, maxBytes int64,
 ) ([]byte, []byte, uint64, *ApiError, error) {
 	var incr *big.Int
@@ -543,6 +567,14 @@ func checkMsgHeadersPreClusteredProposal(
 		return hdr, msg, 0, NewJSStreamStoreFailedError(ErrMsgTooLarge), ErrMsgTooLarge
 	}
 
+	// Validate against the schemas, sourced messages are exempt.
+	if !sourced {
+		if err := mset.schemas.Load().validate(subject, msg); err != nil {
+			apiErr := NewJSStreamSchemaValidationFailedError(err)
+			return hdr, msg, 0, apiErr, apiErr
+		}
+	}
+
 	// Some header checks must be checked pre proposal.
 	if len(hdr) > 0 {
 		// Since we encode header len as u16 make sure we do not exceed.
@@ -597,30 +629,28 @@ func checkMsgHeadersPreClusteredProposal(
 				return hdr, msg, 0, NewJSMessageTTLInvalidError(), err
 			}
 		}
+		// Delayed messages are rejected entirely if delays are not enabled on the stream, or if the delay is invalid.
+		if deliverAt, err := getMessageDeliverAt(hdr, time.Now().UnixNano()); !sourced && (deliverAt != 0 || err != nil) {
+			if !allowMsgDelay {
+				return hdr, msg, 0, NewJSMessageDelayDisabledError(), errMsgDelayDisabled
+			} else if err != nil {
+				return hdr, msg, 0, NewJSMessageDelayInvalidError(), err
+			}
+		}
+		// Messages with a priority are rejected entirely if priorities are not enabled on the stream, or if the level is invalid.
+		if prio, err := getMessagePriority(hdr); !sourced && (prio >= 0 || err != nil) {
+			if !allowMsgPriority {
+				return hdr, msg, 0, NewJSMessagePriorityDisabledError(), errMsgPriorityDisabled
+			} else if err != nil {
+				return hdr, msg, 0, NewJSMessagePriorityInvalidError(), err
+			}
+		}
 		// Check for MsgIds here at the cluster level to avoid excessive CLFS accounting.
 		// Will help during restarts.
 		if msgId := getMsgId(hdr); msgId != _EMPTY_ {
-			// Dedupe if staged.
-			if _, ok = diff.msgIds[msgId]; ok {
-				return hdr, msg, 0, NewJSAtomicPublishContainsDuplicateMessageError(), errMsgIdDuplicate
-			}
-			mset.ddMu.Lock()
-			if dde := mset.checkMsgId(msgId); dde != nil {
-				seq := dde.seq
-				mset.ddMu.Unlock()
-				// Should not return an invalid sequence, in that case error.
-				if seq > 0 {
-					return hdr, msg, seq, NewJSAtomicPublishContainsDuplicateMessageError(), errMsgIdDuplicate
-				} else {
-					return hdr, msg, 0, NewJSStreamDuplicateMessageConflictError(), errMsgIdDuplicate
-				}
+			if seq, apiErr, err := diff.stageMsgId(mset, msgId); err != nil {
+				return hdr, msg, seq, apiErr, err
 			}
-			if diff.msgIds == nil {
-				diff.msgIds = map[string]struct{}{msgId: {}}
-			} else {
-				diff.msgIds[msgId] = struct{}{}
-			}
-			mset.ddMu.Unlock()
 		}
 
 		// Non-sourced messages aren't allowed to have the stream source header.
@@ -630,6 +660,15 @@ func checkMsgHeadersPreClusteredProposal(
 		}
 	}
 
+	// Without a MsgId we may dedupe on the message contents instead.
+	if getMsgId(hdr) == _EMPTY_ {
+		if ddId := mset.contentDedupeId(subject, hdr, msg); ddId != _EMPTY_ {
+			if seq, apiErr, err := diff.stageMsgId(mset, ddId); err != nil {
+				return hdr, msg, seq, apiErr, err
+			}
+		}
+	}
+
 	// Apply increment for counter.
 	// But only if it's allowed for this stream. This can happen when we store verbatim for a sourced stream.
 	if incr == nil && allowMsgCounter {
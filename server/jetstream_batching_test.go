@@ -22,6 +22,7 @@ import (
 	"fmt"
 	"math"
 	"math/big"
+	"os"
 	"strconv"
 	"strings"
 	"sync"
@@ -1671,7 +1672,7 @@ func TestJetStreamAtomicBatchPublishStageAndCommit(t *testing.T) {
 				if m.rsubject != _EMPTY_ {
 					rsubject = m.rsubject
 				}
-				_, _, _, _, err = checkMsgHeadersPreClusteredProposal(diff, mset, m.subject, rsubject, hdr, m.msg, false, "TEST", nil, test.allowRollup, test.denyPurge, test.allowTTL, test.allowMsgCounter, test.allowMsgSchedules, discard, discardNewPer, -1, maxMsgs, maxMsgsPer, maxBytes)
+				_, _, _, _, err = checkMsgHeadersPreClusteredProposal(diff, mset, m.subject, rsubject, hdr, m.msg, false, "TEST", nil, test.allowRollup, test.denyPurge, test.allowTTL, test.allowMsgCounter, test.allowMsgSchedules, false, false, discard, discardNewPer, -1, maxMsgs, maxMsgsPer, maxBytes)
 				if m.err != nil {
 					require_Error(t, err, m.err)
 				} else if err != nil {
@@ -1744,7 +1745,7 @@ func TestJetStreamCounterNullSourcesHeaderDoesNotPanic(t *testing.T) {
 	hdr = genHeader(hdr, JSStreamSource, "O1 1 > > foo.1")
 	diff := &batchStagedDiff{}
 	mset.clMu.Lock()
-	_, _, _, _, err = checkMsgHeadersPreClusteredProposal(diff, mset, "foo", "foo", hdr, []byte(`{"val":"5"}`), true, "M", nil, false, false, false, true, false, DiscardOld, false, -1, -1, -1, -1)
+	_, _, _, _, err = checkMsgHeadersPreClusteredProposal(diff, mset, "foo", "foo", hdr, []byte(`{"val":"5"}`), true, "M", nil, false, false, false, true, false, false, false, DiscardOld, false, -1, -1, -1, -1)
 	mset.clMu.Unlock()
 	require_NoError(t, err)
 	require_Equal(t, diff.counter["foo"].sources["O1"]["foo.1"], "5")
@@ -1819,7 +1820,7 @@ func TestJetStreamCounterStagingDoesNotCorruptCommittedTotal(t *testing.T) {
 	msg := []byte(`{"val":"5"}`)
 	diff := &batchStagedDiff{}
 	mset.clMu.Lock()
-	_, _, _, _, err = checkMsgHeadersPreClusteredProposal(diff, mset, "foo", "foo", hdr, msg, true, "TEST", nil, false, false, false, true, false, DiscardOld, false, -1, -1, -1, -1)
+	_, _, _, _, err = checkMsgHeadersPreClusteredProposal(diff, mset, "foo", "foo", hdr, msg, true, "TEST", nil, false, false, false, true, false, false, false, DiscardOld, false, -1, -1, -1, -1)
 	mset.clMu.Unlock()
 	require_NoError(t, err)
 
@@ -5274,3 +5275,539 @@ func TestJetStreamFastBatchPublishLimits(t *testing.T) {
 	t.Run("R1", func(t *testing.T) { test(t, 1) })
 	t.Run("R3", func(t *testing.T) { test(t, 3) })
 }
+
+func TestJetStreamAtomicBatchPublishTxn(t *testing.T) {
+	test := func(t *testing.T, nc *nats.Conn, js nats.JetStreamContext, replicas int) {
+		for _, name := range []string{"ORDERS", "PAYMENTS"} {
+			_, err := jsStreamCreate(t, nc, &StreamConfig{
+				Name:               name,
+				Subjects:           []string{strings.ToLower(name)},
+				Storage:            FileStorage,
+				Replicas:           replicas,
+				AllowAtomicPublish: true,
+			})
+			require_NoError(t, err)
+		}
+		inbox := nats.NewInbox()
+		sub, err := nc.SubscribeSync(inbox + ".*")
+		require_NoError(t, err)
+		defer sub.Unsubscribe()
+
+		// Stages a batch of two messages per stream, and commits them as part of the transaction.
+		// The hdrs allow setting additional headers on the commit message per stream.
+		commit := func(txnId, txnStreams string, streams []string, hdrs map[string]nats.Header) map[string]*JSPubAckResponse {
+			t.Helper()
+			for _, name := range streams {
+				m := nats.NewMsg(strings.ToLower(name))
+				m.Header.Set("Nats-Batch-Id", txnId)
+				m.Header.Set("Nats-Batch-Sequence", "1")
+				rmsg, err := nc.RequestMsg(m, time.Second)
+				require_NoError(t, err)
+				require_Len(t, len(rmsg.Data), 0)
+			}
+			for _, name := range streams {
+				m := nats.NewMsg(strings.ToLower(name))
+				m.Reply = inbox + "." + name
+				m.Header.Set("Nats-Batch-Id", txnId)
+				m.Header.Set("Nats-Batch-Sequence", "2")
+				m.Header.Set("Nats-Batch-Commit", "1")
+				m.Header.Set("Nats-Batch-Txn", txnId)
+				m.Header.Set("Nats-Batch-Txn-Streams", txnStreams)
+				for k, v := range hdrs[name] {
+					m.Header[k] = v
+				}
+				require_NoError(t, nc.PublishMsg(m))
+			}
+			acks := make(map[string]*JSPubAckResponse)
+			for range streams {
+				rmsg, err := sub.NextMsg(3 * batchTxnTimeout)
+				require_NoError(t, err)
+				var pubAck JSPubAckResponse
+				require_NoError(t, json.Unmarshal(rmsg.Data, &pubAck))
+				acks[tokenAt(rmsg.Subject, 3)] = &pubAck
+			}
+			return acks
+		}
+		requireMsgs := func(name string, msgs uint64) {
+			t.Helper()
+			checkFor(t, 2*time.Second, 100*time.Millisecond, func() error {
+				si, err := js.StreamInfo(name)
+				if err != nil {
+					return err
+				}
+				if si.State.Msgs != msgs {
+					return fmt.Errorf("expected %d msgs in %q, got %d", msgs, name, si.State.Msgs)
+				}
+				return nil
+			})
+		}
+
+		// All streams prepared, so all commit.
+		acks := commit("txn1", "ORDERS,PAYMENTS", []string{"ORDERS", "PAYMENTS"}, nil)
+		for _, name := range []string{"ORDERS", "PAYMENTS"} {
+			require_NoError(t, acks[name].ToError())
+			require_Equal(t, acks[name].BatchSize, 2)
+			requireMsgs(name, 2)
+		}
+
+		// One stream fails its consistency checks, so all abort.
+		acks = commit("txn2", "ORDERS,PAYMENTS", []string{"ORDERS", "PAYMENTS"}, map[string]nats.Header{
+			"PAYMENTS": {"Nats-Expected-Last-Sequence": []string{"100"}},
+		})
+		require_Error(t, acks["PAYMENTS"].Error, NewJSStreamWrongLastSequenceError(3))
+		require_Error(t, acks["ORDERS"].Error, NewJSAtomicPublishTxnAbortedError(errors.New("stream \"PAYMENTS\" failed: last sequence mismatch: 100 vs 3")))
+		requireMsgs("ORDERS", 2)
+		requireMsgs("PAYMENTS", 2)
+
+		// Not all streams are prepared in time, so all abort.
+		start := time.Now()
+		acks = commit("txn3", "ORDERS,PAYMENTS", []string{"PAYMENTS"}, nil)
+		require_True(t, time.Since(start) >= batchTxnTimeout)
+		require_Error(t, acks["PAYMENTS"].Error, NewJSAtomicPublishTxnAbortedError(errBatchTxnTimeout))
+		requireMsgs("PAYMENTS", 2)
+
+		// The stream must be part of the transaction.
+		acks = commit("txn4", "ORDERS,OTHER", []string{"PAYMENTS"}, nil)
+		require_Error(t, acks["PAYMENTS"].Error, NewJSAtomicPublishInvalidTxnError(errors.New("transaction does not include stream \"PAYMENTS\"")))
+		requireMsgs("PAYMENTS", 2)
+	}
+
+	t.Run("R1", func(t *testing.T) {
+		s := RunBasicJetStreamServer(t)
+		defer s.Shutdown()
+		nc, js := jsClientConnect(t, s)
+		defer nc.Close()
+		test(t, nc, js, 1)
+	})
+	t.Run("R3", func(t *testing.T) {
+		c := createJetStreamClusterExplicit(t, "R3S", 3)
+		defer c.shutdown()
+		nc, js := jsClientConnect(t, c.randomServer())
+		defer nc.Close()
+		test(t, nc, js, 3)
+	})
+}
+
+func TestJetStreamAtomicBatchPublishTxnHoldsProposals(t *testing.T) {
+	test := func(t *testing.T, c *cluster, nc *nats.Conn, js nats.JetStreamContext, replicas int) {
+		for _, name := range []string{"ORDERS", "PAYMENTS"} {
+			_, err := jsStreamCreate(t, nc, &StreamConfig{
+				Name:               name,
+				Subjects:           []string{strings.ToLower(name)},
+				Storage:            FileStorage,
+				Replicas:           replicas,
+				AllowAtomicPublish: true,
+			})
+			require_NoError(t, err)
+		}
+		inbox := nats.NewInbox()
+		sub, err := nc.SubscribeSync(inbox + ".*")
+		require_NoError(t, err)
+		defer sub.Unsubscribe()
+
+		stage := func(name string) {
+			t.Helper()
+			m := nats.NewMsg(strings.ToLower(name))
+			m.Header.Set("Nats-Batch-Id", "txn")
+			m.Header.Set("Nats-Batch-Sequence", "1")
+			rmsg, err := nc.RequestMsg(m, time.Second)
+			require_NoError(t, err)
+			require_Len(t, len(rmsg.Data), 0)
+		}
+		commit := func(name string) {
+			t.Helper()
+			m := nats.NewMsg(strings.ToLower(name))
+			m.Reply = inbox + "." + name
+			m.Header.Set("Nats-Batch-Id", "txn")
+			m.Header.Set("Nats-Batch-Sequence", "2")
+			m.Header.Set("Nats-Batch-Commit", "1")
+			m.Header.Set("Nats-Batch-Txn", "txn")
+			m.Header.Set("Nats-Batch-Txn-Streams", "ORDERS,PAYMENTS")
+			require_NoError(t, nc.PublishMsg(m))
+		}
+		stage("ORDERS")
+		stage("PAYMENTS")
+
+		// Prepare the batch for PAYMENTS, a purge must wait for the transaction to be decided.
+		commit("PAYMENTS")
+		time.Sleep(250 * time.Millisecond)
+		purged := make(chan error, 1)
+		go func() {
+			purged <- js.PurgeStream("PAYMENTS")
+		}()
+		select {
+		case err := <-purged:
+			t.Fatalf("Purge was not held while prepared: %v", err)
+		case <-time.After(500 * time.Millisecond):
+		}
+
+		commit("ORDERS")
+		for range 2 {
+			rmsg, err := sub.NextMsg(3 * batchTxnTimeout)
+			require_NoError(t, err)
+			var pubAck JSPubAckResponse
+			require_NoError(t, json.Unmarshal(rmsg.Data, &pubAck))
+			require_NoError(t, pubAck.ToError())
+			require_Equal(t, pubAck.BatchSize, 2)
+		}
+		select {
+		case err := <-purged:
+			require_NoError(t, err)
+		case <-time.After(2 * time.Second):
+			t.Fatal("Purge did not complete after the transaction was decided")
+		}
+
+		// The batch was committed, and the purge did not change the stream while prepared.
+		si, err := js.StreamInfo("PAYMENTS")
+		require_NoError(t, err)
+		require_Equal(t, si.State.LastSeq, 2)
+		si, err = js.StreamInfo("ORDERS")
+		require_NoError(t, err)
+		require_Equal(t, si.State.Msgs, 2)
+
+		// The decision is logged in the coordinating stream, so all of its replicas know about it.
+		if c != nil {
+			checkFor(t, 2*time.Second, 100*time.Millisecond, func() error {
+				for _, s := range c.servers {
+					mset, err := s.globalAccount().lookupStream("ORDERS")
+					if err != nil {
+						return err
+					}
+					if d := mset.batchTxnDecision("txn"); d == nil || !d.Commit {
+						return fmt.Errorf("transaction not decided on %s", s)
+					}
+				}
+				return nil
+			})
+		}
+	}
+
+	t.Run("R1", func(t *testing.T) {
+		s := RunBasicJetStreamServer(t)
+		defer s.Shutdown()
+		nc, js := jsClientConnect(t, s)
+		defer nc.Close()
+		test(t, nil, nc, js, 1)
+	})
+	t.Run("R3", func(t *testing.T) {
+		c := createJetStreamClusterExplicit(t, "R3S", 3)
+		defer c.shutdown()
+		nc, js := jsClientConnect(t, c.randomServer())
+		defer nc.Close()
+		test(t, c, nc, js, 3)
+	})
+}
+
+func TestJetStreamAtomicBatchPublishTxnQueriesCoordinator(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	js := s.getJetStream()
+	txn := &batchTxn{id: "txn", streams: []string{"ORDERS", "PAYMENTS"}}
+	qch := make(chan struct{})
+	decided := make(chan error, 1)
+	go func() {
+		decided <- js.awaitBatchTxn(globalAccountName, "PAYMENTS", txn, nil, qch)
+	}()
+
+	// The coordinating stream doesn't exist, but we never abort by ourselves after voting to commit.
+	select {
+	case err := <-decided:
+		t.Fatalf("Transaction decided without coordinator: %v", err)
+	case <-time.After(2*batchTxnTimeout + 250*time.Millisecond):
+	}
+
+	// Once the coordinator is available, our next vote gets the decision.
+	nc, _ := jsClientConnect(t, s)
+	defer nc.Close()
+	_, err := jsStreamCreate(t, nc, &StreamConfig{Name: "ORDERS", Storage: FileStorage, AllowAtomicPublish: true})
+	require_NoError(t, err)
+	js.sendBatchTxnVote(globalAccountName, "ORDERS", txn, nil)
+	select {
+	case err := <-decided:
+		require_NoError(t, err)
+	case <-time.After(2 * batchTxnTimeout):
+		t.Fatal("Transaction was not decided")
+	}
+
+	// Without a coordinator, the wait is bounded and the outcome is unknown.
+	txn = &batchTxn{id: "txn2", streams: []string{"OTHER", "PAYMENTS"}}
+	start := time.Now()
+	require_Error(t, js.awaitBatchTxn(globalAccountName, "PAYMENTS", txn, nil, qch), errBatchTxnUnknown)
+	if elapsed := time.Since(start); elapsed < maxBatchTxnWait || elapsed > maxBatchTxnWait+2*batchTxnTimeout {
+		t.Fatalf("Unexpected wait of %v", elapsed)
+	}
+
+	// A stream that is closed stops waiting.
+	txn = &batchTxn{id: "txn3", streams: []string{"OTHER", "PAYMENTS"}}
+	go func() {
+		decided <- js.awaitBatchTxn(globalAccountName, "PAYMENTS", txn, nil, qch)
+	}()
+	close(qch)
+	select {
+	case err := <-decided:
+		require_Error(t, err, errStreamClosed)
+	case <-time.After(time.Second):
+		t.Fatal("Did not stop waiting")
+	}
+}
+
+func TestJetStreamAtomicBatchPublishTxnDecisionKept(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+	sd := s.JetStreamConfig().StoreDir
+
+	nc, _ := jsClientConnect(t, s)
+	defer nc.Close()
+	_, err := jsStreamCreate(t, nc, &StreamConfig{Name: "ORDERS", Storage: FileStorage, AllowAtomicPublish: true})
+	require_NoError(t, err)
+
+	// All streams voted to commit.
+	js := s.getJetStream()
+	txn := &batchTxn{id: "txn", streams: []string{"ORDERS", "PAYMENTS"}}
+	js.sendBatchTxnVote(globalAccountName, "PAYMENTS", txn, nil)
+	require_NoError(t, js.awaitBatchTxn(globalAccountName, "ORDERS", txn, nil, nil))
+	nc.Close()
+
+	// After a restart, the coordinator still knows the decision, and doesn't abort on a late vote.
+	s.Shutdown()
+	s = RunJetStreamServerOnPort(-1, sd)
+	defer s.Shutdown()
+	acc, err := s.lookupAccount(globalAccountName)
+	require_NoError(t, err)
+	mset, err := acc.lookupStream("ORDERS")
+	require_NoError(t, err)
+	d := mset.batchTxnDecision("txn")
+	require_NotNil(t, d)
+	require_True(t, d.Commit)
+
+	js = s.getJetStream()
+	require_NoError(t, js.awaitBatchTxn(globalAccountName, "PAYMENTS", txn, nil, nil))
+
+	// The first decision is final.
+	cd, err := mset.storeBatchTxnDecision(newBatchTxnDecision("txn", errBatchTxnTimeout), true)
+	require_NoError(t, err)
+	require_True(t, cd.Commit)
+}
+
+func TestJetStreamAtomicBatchPublishTxnPreparedKept(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+	sd := s.JetStreamConfig().StoreDir
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+	for _, name := range []string{"ORDERS", "PAYMENTS"} {
+		_, err := jsStreamCreate(t, nc, &StreamConfig{Name: name, Subjects: []string{strings.ToLower(name)}, Storage: FileStorage, AllowAtomicPublish: true})
+		require_NoError(t, err)
+	}
+	acc, err := s.lookupAccount(globalAccountName)
+	require_NoError(t, err)
+	mset, err := acc.lookupStream("ORDERS")
+	require_NoError(t, err)
+	_, err = mset.storeBatchTxnDecision(newBatchTxnDecision("txn", nil), true)
+	require_NoError(t, err)
+
+	// The first message of the prepared batch was stored before a restart, the second wasn't.
+	_, err = js.Publish("payments", []byte("1"))
+	require_NoError(t, err)
+	mset, err = acc.lookupStream("PAYMENTS")
+	require_NoError(t, err)
+	p := &batchTxnPrepared{Txn: "txn", Streams: []string{"ORDERS", "PAYMENTS"}, Batch: "txn", Seq: 1,
+		Msgs: []*batchTxnMsg{{Subj: "payments", Msg: []byte("1")}, {Subj: "payments", Msg: []byte("2")}}}
+	fn := mset.batchTxnPreparedPath()
+	b, err := json.Marshal(p)
+	require_NoError(t, err)
+	require_NoError(t, os.WriteFile(fn, b, defaultFilePerms))
+	nc.Close()
+
+	// After a restart, the batch is committed from its record once the decision is learned.
+	s.Shutdown()
+	s = RunJetStreamServerOnPort(-1, sd)
+	defer s.Shutdown()
+	nc, js = jsClientConnect(t, s)
+	defer nc.Close()
+	acc, err = s.lookupAccount(globalAccountName)
+	require_NoError(t, err)
+	mset, err = acc.lookupStream("PAYMENTS")
+	require_NoError(t, err)
+	checkFor(t, 3*batchTxnTimeout, 100*time.Millisecond, func() error {
+		if mset.batchTxnPrepared() != nil {
+			return errors.New("batch still prepared")
+		}
+		return nil
+	})
+	_, err = os.Stat(fn)
+	require_True(t, os.IsNotExist(err))
+	si, err := js.StreamInfo("PAYMENTS")
+	require_NoError(t, err)
+	require_Equal(t, si.State.Msgs, 2)
+	sm, err := js.GetMsg("PAYMENTS", 2)
+	require_NoError(t, err)
+	require_Equal(t, string(sm.Data), "2")
+
+	// Writes continue once resolved.
+	_, err = js.Publish("payments", nil)
+	require_NoError(t, err)
+}
+
+func TestJetStreamAtomicBatchPublishTxnInDoubt(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+	_, err := jsStreamCreate(t, nc, &StreamConfig{Name: "PAYMENTS", Subjects: []string{"payments"}, Storage: FileStorage, AllowAtomicPublish: true})
+	require_NoError(t, err)
+
+	m := nats.NewMsg("payments")
+	m.Header.Set("Nats-Batch-Id", "txn")
+	m.Header.Set("Nats-Batch-Sequence", "1")
+	_, err = nc.RequestMsg(m, time.Second)
+	require_NoError(t, err)
+
+	// The coordinator doesn't exist, so the outcome is unknown.
+	m = nats.NewMsg("payments")
+	m.Header.Set("Nats-Batch-Id", "txn")
+	m.Header.Set("Nats-Batch-Sequence", "2")
+	m.Header.Set("Nats-Batch-Commit", "1")
+	m.Header.Set("Nats-Batch-Txn", "txn")
+	m.Header.Set("Nats-Batch-Txn-Streams", "ORDERS,PAYMENTS")
+	rmsg, err := nc.RequestMsg(m, maxBatchTxnWait+3*batchTxnTimeout)
+	require_NoError(t, err)
+	var pubAck JSPubAckResponse
+	require_NoError(t, json.Unmarshal(rmsg.Data, &pubAck))
+	require_Error(t, pubAck.ToError(), NewJSStreamGeneralError(errBatchTxnUnknown))
+
+	// The batch is still prepared, and other writes are rejected while in doubt.
+	acc, err := s.lookupAccount(globalAccountName)
+	require_NoError(t, err)
+	mset, err := acc.lookupStream("PAYMENTS")
+	require_NoError(t, err)
+	require_NotNil(t, mset.batchTxnPrepared())
+	_, err = os.Stat(mset.batchTxnPreparedPath())
+	require_NoError(t, err)
+	_, err = js.Publish("payments", nil)
+	require_Error(t, err)
+	require_Contains(t, err.Error(), errBatchTxnInDoubt.Error())
+
+	// Once the coordinator decided to commit, the batch is committed as a whole.
+	_, err = jsStreamCreate(t, nc, &StreamConfig{Name: "ORDERS", Storage: FileStorage, AllowAtomicPublish: true})
+	require_NoError(t, err)
+	coord, err := acc.lookupStream("ORDERS")
+	require_NoError(t, err)
+	_, err = coord.storeBatchTxnDecision(newBatchTxnDecision("txn", nil), true)
+	require_NoError(t, err)
+	checkFor(t, 3*batchTxnTimeout, 100*time.Millisecond, func() error {
+		if mset.batchTxnPrepared() != nil {
+			return errors.New("batch still prepared")
+		}
+		return nil
+	})
+	si, err := js.StreamInfo("PAYMENTS")
+	require_NoError(t, err)
+	require_Equal(t, si.State.Msgs, 2)
+	_, err = js.Publish("payments", nil)
+	require_NoError(t, err)
+}
+
+func TestJetStreamClusterAtomicBatchPublishTxnPreparedReplicated(t *testing.T) {
+	c := createJetStreamClusterExplicit(t, "R3S", 3)
+	defer c.shutdown()
+	nc, js := jsClientConnect(t, c.randomServer())
+	defer nc.Close()
+
+	for _, name := range []string{"ORDERS", "PAYMENTS"} {
+		_, err := jsStreamCreate(t, nc, &StreamConfig{Name: name, Subjects: []string{strings.ToLower(name)}, Storage: FileStorage, Replicas: 3, AllowAtomicPublish: true})
+		require_NoError(t, err)
+	}
+	m := nats.NewMsg("payments")
+	m.Header.Set("Nats-Batch-Id", "txn")
+	m.Header.Set("Nats-Batch-Sequence", "1")
+	_, err := nc.RequestMsg(m, time.Second)
+	require_NoError(t, err)
+	m = nats.NewMsg("payments")
+	m.Header.Set("Nats-Batch-Id", "txn")
+	m.Header.Set("Nats-Batch-Sequence", "2")
+	m.Header.Set("Nats-Batch-Commit", "1")
+	m.Header.Set("Nats-Batch-Txn", "txn")
+	m.Header.Set("Nats-Batch-Txn-Streams", "ORDERS,PAYMENTS")
+	require_NoError(t, nc.PublishMsg(m))
+
+	// The record of the prepared batch is logged, so all replicas have it.
+	checkFor(t, 2*time.Second, 50*time.Millisecond, func() error {
+		for _, s := range c.servers {
+			mset, err := s.globalAccount().lookupStream("PAYMENTS")
+			if err != nil {
+				return err
+			}
+			if p := mset.batchTxnPrepared(); p == nil || len(p.Msgs) != 2 {
+				return fmt.Errorf("batch not prepared on %s", s)
+			}
+		}
+		return nil
+	})
+
+	// A new leader resolves the batch. It didn't vote, so the transaction aborts.
+	sl := c.streamLeader(globalAccountName, "PAYMENTS")
+	require_NoError(t, sl.JetStreamStepdownStream(globalAccountName, "PAYMENTS"))
+	c.waitOnStreamLeader(globalAccountName, "PAYMENTS")
+	checkFor(t, 3*batchTxnTimeout, 100*time.Millisecond, func() error {
+		for _, s := range c.servers {
+			mset, err := s.globalAccount().lookupStream("PAYMENTS")
+			if err != nil {
+				return err
+			}
+			if mset.batchTxnPrepared() != nil {
+				return fmt.Errorf("batch still prepared on %s", s)
+			}
+		}
+		return nil
+	})
+	coord, err := c.streamLeader(globalAccountName, "ORDERS").globalAccount().lookupStream("ORDERS")
+	require_NoError(t, err)
+	d := coord.batchTxnDecision("txn")
+	require_NotNil(t, d)
+	require_False(t, d.Commit)
+
+	_, err = js.Publish("payments", nil)
+	require_NoError(t, err)
+	si, err := js.StreamInfo("PAYMENTS")
+	require_NoError(t, err)
+	require_Equal(t, si.State.Msgs, 1)
+}
+
+func TestJetStreamAtomicBatchPublishTxnDecisionsSnapshot(t *testing.T) {
+	ds := []*batchTxnDecision{
+		newBatchTxnDecision("a", nil),
+		newBatchTxnDecision("b", errBatchTxnTimeout),
+	}
+	ms, err := newMemStore(&StreamConfig{Name: "TEST", Subjects: []string{"foo"}, Storage: MemoryStorage})
+	require_NoError(t, err)
+	defer ms.Stop()
+	_, _, err = ms.StoreMsg("foo", nil, nil, 0)
+	require_NoError(t, err)
+	enc, err := ms.EncodedStreamState(0, false)
+	require_NoError(t, err)
+
+	p := &batchTxnPrepared{Txn: "c", Streams: []string{"A", "B"}, Batch: "c", Msgs: []*batchTxnMsg{{Subj: "foo", Msg: []byte("ok")}}}
+	snap := encodeTxnSnapshot(&batchTxnSnapshot{Decisions: ds, Prepared: p}, encodeViewsSnapshot([]StreamViewInfo{{ID: "v", Seq: 1}}, enc))
+	rs, err := decodeStreamSnapshot(snap)
+	require_NoError(t, err)
+	require_Equal(t, rs.LastSeq, 1)
+	require_Len(t, len(rs.Views), 1)
+	require_Len(t, len(rs.txnDecisions), 2)
+	require_True(t, rs.txnDecisions[0].Commit)
+	require_False(t, rs.txnDecisions[1].Commit)
+	require_Equal(t, rs.txnDecisions[1].Error, errBatchTxnTimeout.Error())
+	require_NotNil(t, rs.txnPrepared)
+	require_Equal(t, rs.txnPrepared.Txn, "c")
+	require_Len(t, len(rs.txnPrepared.Msgs), 1)
+	require_Equal(t, string(rs.txnPrepared.Msgs[0].Msg), "ok")
+
+	// Only the prepared batch.
+	rs, err = decodeStreamSnapshot(encodeTxnSnapshot(&batchTxnSnapshot{Prepared: p}, enc))
+	require_NoError(t, err)
+	require_Len(t, len(rs.txnDecisions), 0)
+	require_NotNil(t, rs.txnPrepared)
+}
@@ -0,0 +1,1017 @@
+// Copyright 2026 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// An atomic batch can be part of a transaction across multiple streams in the same account.
+// The commit message of each batch carries the transaction ID and the streams in the transaction.
+// Once the stream leader has run the consistency checks for its batch, the batch is prepared and
+// the leader votes to commit to the coordinator, which is the leader of the first stream listed.
+// When all streams voted to commit, the coordinator decides to commit and every stream commits its batch.
+// If any stream fails to prepare its batch, or not all streams are prepared within the transaction
+// timeout, the coordinator decides to abort and every stream abandons its batch.
+//
+// The coordinator keeps its decision in the first stream before sending it. Clustered streams log it,
+// and include it in their snapshots, other file based streams write it to disk. The first decision kept
+// is final, so a new leader, or the same one after a restart, gives the same answer. Decisions are kept
+// well beyond the time a stream waits for the decision, so a stream that voted to commit always learns
+// the decision while waiting, and the coordinator never aborts a transaction that may have committed.
+// A stream that voted to commit keeps voting again to query the coordinator until the transaction is decided.
+//
+// Before voting to commit, a stream keeps a record of its prepared batch. Clustered streams log it, and include it
+// in their snapshots, other file based streams write it to disk. The batch is committed from this record once
+// decided, so a new leader, or the same one after a restart, still commits or abandons the batch as a whole.
+// While a batch is prepared, the stream doesn't accept other writes, so the consistency checks of the batch
+// still hold when committing. No locks are held while waiting for the decision, other writes wait for the batch
+// to be resolved, bounded by maxBatchTxnWait. If the decision can't be learned in time, the stream asks the
+// coordinator to abort, and if that isn't answered either, the publisher is told the outcome is unknown.
+// The stream then keeps resolving the batch in the background, and rejects inbound messages in the meantime.
+
+const (
+	// Time the coordinator waits for all streams in a transaction to be prepared,
+	// and how often a prepared stream queries the coordinator for the decision.
+	batchTxnTimeout = 2 * time.Second
+	// Maximum time a prepared stream waits for the decision before giving up, and other writes wait for it.
+	maxBatchTxnWait = 5 * batchTxnTimeout
+	// Time a decided transaction is kept in memory, the coordinating stream keeps the decision itself.
+	batchTxnDecidedTTL = 10 * batchTxnTimeout
+	// Time the coordinating stream keeps a decision, well beyond the maximum wait of the streams.
+	batchTxnDecisionRetention = 12 * maxBatchTxnWait
+	// Maximum number of streams in a transaction.
+	maxBatchTxnStreams = 16
+	// File with the decisions of the transactions coordinated by a stream, for file based streams.
+	batchTxnDecisionsFile = "txn.json"
+	// File with the record of a batch prepared as part of a transaction, for unreplicated file based streams.
+	batchTxnPreparedFile = "txn-prepared.json"
+	// Identifies a clustered stream snapshot that is prefixed with the state of transactions.
+	streamTxnSnapshotMagic = uint8(44)
+
+	jsBatchTxnAll       = "$JSC.TXN.*.*"
+	jsBatchTxnVoteT     = "$JSC.TXN.V.%s"
+	jsBatchTxnDecisionT = "$JSC.TXN.D.%s"
+)
+
+var (
+	errBatchTxnTimeout = errors.New("transaction timed out")
+	errBatchTxnGaveUp  = errors.New("stream stopped waiting for the decision")
+	errBatchTxnUnknown = errors.New("transaction outcome unknown, the prepared batch is committed or abandoned once decided")
+	errBatchTxnInDoubt = errors.New("stream has a prepared transaction with an unknown outcome")
+	errBatchTxnPending = errors.New("stream has a prepared transaction that was not resolved in time")
+	errBatchTxnNotKept = errors.New("prepared batch could not be kept")
+)
+
+// batchTxn is the transaction a batch is part of, as parsed from its commit message.
+type batchTxn struct {
+	id      string
+	streams []string
+}
+
+// getBatchTxn returns the transaction from the headers of a commit message.
+// Returns nil if the batch is not part of a transaction.
+func getBatchTxn(hdr []byte, stream string) (*batchTxn, error) {
+	id := sliceHeader(JSBatchTxn, hdr)
+	if id == nil {
+		return nil, nil
+	}
+	if len(id) == 0 || len(id) > 64 {
+		return nil, errors.New("transaction ID is invalid")
+	}
+	txn := &batchTxn{id: string(id)}
+	if streams := sliceHeader(JSBatchTxnStreams, hdr); len(streams) > 0 {
+		txn.streams = strings.Split(string(streams), ",")
+	}
+	if len(txn.streams) < 2 || len(txn.streams) > maxBatchTxnStreams {
+		return nil, fmt.Errorf("transaction requires 2 to %d streams", maxBatchTxnStreams)
+	}
+	for i, name := range txn.streams {
+		if !isValidName(name) || slices.Contains(txn.streams[:i], name) {
+			return nil, fmt.Errorf("transaction stream %q is invalid", name)
+		}
+	}
+	if !slices.Contains(txn.streams, stream) {
+		return nil, fmt.Errorf("transaction does not include stream %q", stream)
+	}
+	return txn, nil
+}
+
+// batchTxnVote is sent by a stream leader to the coordinator once its batch was
+// prepared, or with an error if it could not be prepared.
+type batchTxnVote struct {
+	Txn     string   `json:"txn"`
+	Streams []string `json:"streams"`
+	Stream  string   `json:"stream"`
+	Error   string   `json:"error,omitempty"`
+}
+
+// batchTxnDecision is kept in the first stream by the coordinator, and sent once kept.
+type batchTxnDecision struct {
+	Txn    string `json:"txn"`
+	Commit bool   `json:"commit"`
+	Error  string `json:"error,omitempty"`
+	Time   int64  `json:"ts,omitempty"`
+}
+
+func newBatchTxnDecision(txnId string, err error) *batchTxnDecision {
+	d := &batchTxnDecision{Txn: txnId, Commit: err == nil, Time: time.Now().UnixNano()}
+	if err != nil {
+		d.Error = err.Error()
+	}
+	return d
+}
+
+// abortErr returns why the transaction was aborted, nil if committed.
+func (d *batchTxnDecision) abortErr() error {
+	if d.Commit {
+		return nil
+	}
+	return errors.New(d.Error)
+}
+
+func (d *batchTxnDecision) expired(now time.Time) bool {
+	return now.Sub(time.Unix(0, d.Time)) > batchTxnDecisionRetention
+}
+
+// batchTxnState tracks a transaction on this server, either because we lead one of its streams
+// and are waiting for the decision, because we are the coordinator, or because we applied its decision.
+type batchTxnState struct {
+	streams  []string
+	coord    bool
+	mset     *stream             // The coordinating stream, only set for the coordinator.
+	votes    map[string]struct{} // Prepared streams, only used by the coordinator.
+	proposed bool                // The coordinator proposed its decision, and waits for it to be applied.
+	decided  bool
+	err      error         // Why the transaction was aborted, nil if committed.
+	done     chan struct{} // Closed once decided.
+	timer    *time.Timer   // Timeout for the coordinator, or cleanup once decided.
+}
+
+func batchTxnKey(accName, txnId string) string {
+	return accName + " " + txnId
+}
+
+// setupBatchTxnSubs subscribes to the votes and decisions of transactions.
+func (js *jetStream) setupBatchTxnSubs() error {
+	// Use our own client, so we receive the votes and decisions sent by this server as well.
+	c := js.srv.createInternalJetStreamClient()
+	c.registerWithAccount(js.srv.SystemAccount())
+	sub, err := js.srv.systemSubscribe(jsBatchTxnAll, _EMPTY_, false, c, js.processBatchTxnMsg)
+	if err != nil {
+		c.closeConnection(ClientClosed)
+		return err
+	}
+	js.mu.Lock()
+	js.txnSub, js.txnc = sub, c
+	js.mu.Unlock()
+	return nil
+}
+
+// batchTxnStateLocked returns the state of a transaction, creating it if needed.
+// Lock should be held.
+func (js *jetStream) batchTxnStateLocked(accName, txnId string, streams []string, coord bool) *batchTxnState {
+	key := batchTxnKey(accName, txnId)
+	st := js.txns[key]
+	if st == nil {
+		st = &batchTxnState{streams: streams, done: make(chan struct{})}
+		if js.txns == nil {
+			js.txns = make(map[string]*batchTxnState)
+		}
+		js.txns[key] = st
+	}
+	if st.streams == nil {
+		st.streams = streams
+	}
+	if coord && !st.coord {
+		st.coord, st.votes = true, make(map[string]struct{})
+		if !st.decided {
+			if st.timer == nil {
+				st.timer = time.AfterFunc(batchTxnTimeout, func() { js.expireBatchTxn(accName, txnId, st) })
+			} else {
+				st.timer.Reset(batchTxnTimeout)
+			}
+		}
+	}
+	return st
+}
+
+// decideBatchTxnLocked decides the transaction as the coordinator. If the coordinating stream is replicated,
+// the decision is proposed and only takes effect once applied. Otherwise it takes effect once kept.
+// Lock should be held.
+func (js *jetStream) decideBatchTxnLocked(accName, txnId string, st *batchTxnState, err error) {
+	if st.decided || st.proposed {
+		return
+	}
+	d := newBatchTxnDecision(txnId, err)
+	if st.mset.IsClustered() {
+		st.proposed, st.err = true, err
+		st.mset.proposeBatchTxnDecision(d)
+		return
+	}
+	d, kerr := st.mset.storeBatchTxnDecision(d, true)
+	if kerr != nil {
+		// Not decided, we try again once the coordinator times out.
+		js.srv.Warnf("Error keeping transaction decision for '%s > %s': %v", accName, st.mset.name(), kerr)
+		return
+	}
+	js.setBatchTxnDecidedLocked(accName, txnId, st, d.abortErr())
+	js.sendBatchTxnDecision(accName, d)
+}
+
+// setBatchTxnDecidedLocked marks the transaction as decided, and releases the streams waiting for it.
+// Lock should be held.
+func (js *jetStream) setBatchTxnDecidedLocked(accName, txnId string, st *batchTxnState, err error) {
+	st.decided, st.proposed, st.err = true, false, err
+	close(st.done)
+	// Keep the decided transaction around for a while, for late decisions and votes.
+	if st.timer == nil {
+		st.timer = time.AfterFunc(batchTxnDecidedTTL, func() { js.expireBatchTxn(accName, txnId, st) })
+	} else {
+		st.timer.Reset(batchTxnDecidedTTL)
+	}
+}
+
+// applyBatchTxnDecision applies a decision logged by the coordinator. The first decision applied is final,
+// and is sent to the other streams if we lead the coordinating stream.
+func (js *jetStream) applyBatchTxnDecision(mset *stream, d *batchTxnDecision, isLeader bool) {
+	// Only kept in memory, the log and our snapshots keep it otherwise.
+	d, _ = mset.storeBatchTxnDecision(d, false)
+	accName := mset.accName()
+
+	js.txnMu.Lock()
+	defer js.txnMu.Unlock()
+	if st := js.txns[batchTxnKey(accName, d.Txn)]; st != nil && !st.decided {
+		js.setBatchTxnDecidedLocked(accName, d.Txn, st, d.abortErr())
+	}
+	if isLeader {
+		js.sendBatchTxnDecision(accName, d)
+	}
+}
+
+// proposeBatchTxnDecision logs the decision of a transaction we coordinate.
+func (mset *stream) proposeBatchTxnDecision(d *batchTxnDecision) {
+	mset.mu.RLock()
+	defer mset.mu.RUnlock()
+	if node := mset.node; node != nil && mset.isLeader() {
+		node.Propose(mset.term, encodeBatchTxnDecision(d))
+	}
+}
+
+func (js *jetStream) sendBatchTxnDecision(accName string, d *batchTxnDecision) {
+	js.srv.sendInternalMsgLocked(fmt.Sprintf(jsBatchTxnDecisionT, accName), _EMPTY_, nil, d)
+}
+
+// batchTxnDecision returns the decision of a transaction coordinated by this stream, nil if not decided.
+func (mset *stream) batchTxnDecision(txnId string) *batchTxnDecision {
+	mset.txnDecMu.Lock()
+	defer mset.txnDecMu.Unlock()
+	if d := mset.txnDecisions[txnId]; d != nil && !d.expired(time.Now()) {
+		return d
+	}
+	return nil
+}
+
+// storeBatchTxnDecision keeps the decision of a transaction coordinated by this stream, and returns
+// the decision that is kept, since the first one is final. Decisions past their retention are dropped.
+// If persist is set, the decisions are written to disk for file based streams, and if that fails
+// the decision is not kept.
+func (mset *stream) storeBatchTxnDecision(d *batchTxnDecision, persist bool) (*batchTxnDecision, error) {
+	var fn string
+	if persist {
+		fn = mset.batchTxnDecisionsPath()
+	}
+	now := time.Now()
+
+	mset.txnDecMu.Lock()
+	defer mset.txnDecMu.Unlock()
+	if cd := mset.txnDecisions[d.Txn]; cd != nil && !cd.expired(now) {
+		return cd, nil
+	}
+	if mset.txnDecisions == nil {
+		mset.txnDecisions = make(map[string]*batchTxnDecision)
+	}
+	for txnId, cd := range mset.txnDecisions {
+		if cd.expired(now) {
+			delete(mset.txnDecisions, txnId)
+		}
+	}
+	mset.txnDecisions[d.Txn] = d
+	if fn == _EMPTY_ {
+		return d, nil
+	}
+	b, _ := json.Marshal(mset.batchTxnDecisionsLocked())
+	if err := writeFileWithSync(mset.srv.diskIOSemaphore(), fn, b, defaultFilePerms); err != nil {
+		delete(mset.txnDecisions, d.Txn)
+		return nil, err
+	}
+	return d, nil
+}
+
+// batchTxnDecisions returns the decisions kept by this stream, ordered by transaction.
+func (mset *stream) batchTxnDecisions() []*batchTxnDecision {
+	mset.txnDecMu.Lock()
+	defer mset.txnDecMu.Unlock()
+	return mset.batchTxnDecisionsLocked()
+}
+
+// Lock should be held.
+func (mset *stream) batchTxnDecisionsLocked() []*batchTxnDecision {
+	now := time.Now()
+	ds := make([]*batchTxnDecision, 0, len(mset.txnDecisions))
+	for _, d := range mset.txnDecisions {
+		if !d.expired(now) {
+			ds = append(ds, d)
+		}
+	}
+	slices.SortFunc(ds, func(a, b *batchTxnDecision) int { return strings.Compare(a.Txn, b.Txn) })
+	return ds
+}
+
+// restoreBatchTxnDecisions adds the decisions from a snapshot, or from disk.
+// Decisions we already have are kept, since the first one is final.
+func (mset *stream) restoreBatchTxnDecisions(ds []*batchTxnDecision) {
+	for _, d := range ds {
+		mset.storeBatchTxnDecision(d, false)
+	}
+}
+
+// Returns where the decisions of transactions are kept, empty for memory based streams.
+func (mset *stream) batchTxnDecisionsPath() string {
+	mset.mu.RLock()
+	defer mset.mu.RUnlock()
+	if mset.cfg.Storage != FileStorage || mset.jsa == nil {
+		return _EMPTY_
+	}
+	return filepath.Join(mset.jsa.storeDir, streamsDir, mset.cfg.Name, batchTxnDecisionsFile)
+}
+
+// loadBatchTxnDecisions loads the decisions of transactions, when kept on disk.
+func (mset *stream) loadBatchTxnDecisions() {
+	fn := mset.batchTxnDecisionsPath()
+	if fn == _EMPTY_ {
+		return
+	}
+	buf, err := os.ReadFile(fn)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			mset.srv.Warnf("Error reading transaction decisions for '%s > %s': %v", mset.account(), mset.name(), err)
+		}
+		return
+	}
+	var ds []*batchTxnDecision
+	if err := json.Unmarshal(buf, &ds); err != nil {
+		mset.srv.Warnf("Error decoding transaction decisions for '%s > %s': %v", mset.account(), mset.name(), err)
+		return
+	}
+	mset.restoreBatchTxnDecisions(ds)
+}
+
+// batchTxnSnapshot is the state of transactions in a clustered stream snapshot, since it is not part of the store's state.
+type batchTxnSnapshot struct {
+	Decisions []*batchTxnDecision `json:"decisions,omitempty"`
+	Prepared  *batchTxnPrepared   `json:"prepared,omitempty"`
+}
+
+// encodeTxnSnapshot prefixes a clustered stream snapshot with the state of transactions.
+func encodeTxnSnapshot(ts *batchTxnSnapshot, snap []byte) []byte {
+	b, _ := json.Marshal(ts)
+	buf := make([]byte, 0, 1+binary.MaxVarintLen64+len(b)+len(snap))
+	buf = append(buf, streamTxnSnapshotMagic)
+	buf = binary.AppendUvarint(buf, uint64(len(b)))
+	buf = append(buf, b...)
+	return append(buf, snap...)
+}
+
+// decodeTxnSnapshot returns the state of transactions from a clustered stream snapshot if any,
+// and the remaining snapshot.
+func decodeTxnSnapshot(data []byte) (*batchTxnSnapshot, []byte, error) {
+	if len(data) == 0 || data[0] != streamTxnSnapshotMagic {
+		return nil, data, nil
+	}
+	l, n := binary.Uvarint(data[1:])
+	if n <= 0 || uint64(len(data)-1-n) < l {
+		return nil, nil, ErrCorruptStreamState
+	}
+	var ts batchTxnSnapshot
+	start := 1 + n
+	if err := json.Unmarshal(data[start:start+int(l)], &ts); err != nil {
+		return nil, nil, ErrCorruptStreamState
+	}
+	return &ts, data[start+int(l):], nil
+}
+
+// expireBatchTxn aborts the transaction if the coordinator did not decide in time, and removes it once decided.
+func (js *jetStream) expireBatchTxn(accName, txnId string, st *batchTxnState) {
+	js.txnMu.Lock()
+	defer js.txnMu.Unlock()
+	if !st.decided {
+		if !st.coord {
+			return
+		}
+		// If we no longer lead the coordinating stream, the new leader decides.
+		if st.mset == nil || !st.mset.IsLeader() {
+			st.coord, st.votes, st.proposed = false, nil, false
+			return
+		}
+		err := errBatchTxnTimeout
+		if st.proposed {
+			// Our decision was not applied in time, propose it again.
+			err, st.proposed = st.err, false
+		}
+		js.decideBatchTxnLocked(accName, txnId, st, err)
+		if !st.decided {
+			st.timer.Reset(batchTxnTimeout)
+		}
+		return
+	}
+	if key := batchTxnKey(accName, txnId); js.txns[key] == st {
+		delete(js.txns, key)
+	}
+}
+
+// sendBatchTxnVote sends our vote to the coordinator of the transaction.
+// A nil error votes to commit.
+func (js *jetStream) sendBatchTxnVote(accName, stream string, txn *batchTxn, err error) {
+	v := &batchTxnVote{Txn: txn.id, Streams: txn.streams, Stream: stream}
+	if err != nil {
+		v.Error = err.Error()
+	}
+	js.srv.sendInternalMsgLocked(fmt.Sprintf(jsBatchTxnVoteT, accName), _EMPTY_, nil, v)
+}
+
+// awaitBatchTxn votes for our prepared batch, and waits for the transaction to be decided.
+// Returns nil if all streams were prepared and the batch should be committed.
+// Since other streams could have committed, we don't abort by ourselves after voting to commit,
+// but vote again to query the coordinator. If not decided within the maximum wait, we ask the coordinator
+// to abort instead, and return errBatchTxnUnknown if that isn't answered either.
+// A non-nil verr asks the coordinator to abort right away, if not yet decided.
+// No locks should be held.
+func (js *jetStream) awaitBatchTxn(accName, stream string, txn *batchTxn, verr error, qch <-chan struct{}) error {
+	js.txnMu.Lock()
+	st := js.batchTxnStateLocked(accName, txn.id, txn.streams, false)
+	js.txnMu.Unlock()
+
+	stopWaiting := func(err error) error {
+		js.txnMu.Lock()
+		defer js.txnMu.Unlock()
+		if st.decided {
+			return st.err
+		}
+		if key := batchTxnKey(accName, txn.id); !st.coord && js.txns[key] == st {
+			delete(js.txns, key)
+		}
+		return err
+	}
+
+	deadline := time.Now().Add(maxBatchTxnWait)
+	ticker := time.NewTicker(batchTxnTimeout)
+	defer ticker.Stop()
+	for {
+		js.sendBatchTxnVote(accName, stream, txn, verr)
+		select {
+		case <-st.done:
+			return st.err
+		case <-qch:
+			return stopWaiting(errStreamClosed)
+		case <-ticker.C:
+		}
+		if time.Now().After(deadline) {
+			if verr != nil {
+				return stopWaiting(errBatchTxnUnknown)
+			}
+			// Aborts if not yet decided, otherwise answered with the decision.
+			verr = errBatchTxnGaveUp
+		}
+	}
+}
+
+// processBatchTxnMsg processes votes and decisions of transactions.
+func (js *jetStream) processBatchTxnMsg(_ *subscription, _ *client, _ *Account, subject, _ string, msg []byte) {
+	tokens := strings.Split(subject, tsep)
+	if len(tokens) != 4 {
+		return
+	}
+	accName := tokens[3]
+	switch tokens[2] {
+	case "V":
+		var v batchTxnVote
+		if err := json.Unmarshal(msg, &v); err != nil || len(v.Streams) == 0 {
+			return
+		}
+		js.processBatchTxnVote(accName, &v)
+	case "D":
+		var d batchTxnDecision
+		if err := json.Unmarshal(msg, &d); err != nil {
+			return
+		}
+		js.txnMu.Lock()
+		defer js.txnMu.Unlock()
+		if st := js.txns[batchTxnKey(accName, d.Txn)]; st != nil && !st.coord && !st.decided {
+			js.setBatchTxnDecidedLocked(accName, d.Txn, st, d.abortErr())
+		}
+	}
+}
+
+// processBatchTxnVote collects the votes as the coordinator of a transaction,
+// and decides once all streams are prepared or any of them failed.
+// Votes are answered with the decision if already decided.
+func (js *jetStream) processBatchTxnVote(accName string, v *batchTxnVote) {
+	// Only the leader of the first stream coordinates the transaction.
+	acc, err := js.srv.lookupAccount(accName)
+	if err != nil {
+		return
+	}
+	mset, err := acc.lookupStream(v.Streams[0])
+	if err != nil || !mset.isLeader() {
+		return
+	}
+	// The decision is kept by the stream, so we can answer after a restart or as a new leader.
+	if d := mset.batchTxnDecision(v.Txn); d != nil {
+		js.sendBatchTxnDecision(accName, d)
+		return
+	}
+
+	js.txnMu.Lock()
+	defer js.txnMu.Unlock()
+	st := js.batchTxnStateLocked(accName, v.Txn, v.Streams, true)
+	st.mset = mset
+	if st.decided {
+		js.sendBatchTxnDecision(accName, newBatchTxnDecision(v.Txn, st.err))
+		return
+	}
+	if !slices.Equal(st.streams, v.Streams) {
+		js.decideBatchTxnLocked(accName, v.Txn, st, fmt.Errorf("stream %q has different transaction streams", v.Stream))
+	} else if v.Error != _EMPTY_ {
+		js.decideBatchTxnLocked(accName, v.Txn, st, fmt.Errorf("stream %q failed: %s", v.Stream, v.Error))
+	} else if slices.Contains(st.streams, v.Stream) {
+		st.votes[v.Stream] = struct{}{}
+		if len(st.votes) == len(st.streams) {
+			js.decideBatchTxnLocked(accName, v.Txn, st, nil)
+		}
+	}
+}
+
+// batchTxnPrepared is the record of a batch prepared as part of a transaction, kept before voting to commit.
+// It holds the checked, and possibly rewritten, messages of the batch, which are stored once committed.
+type batchTxnPrepared struct {
+	Txn     string         `json:"txn"`
+	Streams []string       `json:"streams"`
+	Batch   string         `json:"batch"`
+	Seq     uint64         `json:"seq,omitempty"` // First sequence of the batch, only for unreplicated streams.
+	Msgs    []*batchTxnMsg `json:"msgs"`
+
+	applied  chan struct{}    // Closed once logged, only for the leader that proposed it.
+	resolved chan struct{}    // Closed once committed or abandoned.
+	decided  bool             // The decision is known, only used by the leader resolving the batch.
+	err      error            // Why the transaction was aborted, nil if committed.
+	resolve  *batchTxnResolve // Last resolution proposed by the leader, proposed again until applied.
+	term     uint64           // Term of the resolution proposed by the leader.
+}
+
+type batchTxnMsg struct {
+	Subj string `json:"subj"`
+	Hdr  []byte `json:"hdr,omitempty"`
+	Msg  []byte `json:"msg,omitempty"`
+}
+
+// batchTxnResolve is logged by the leader of a clustered stream to resolve its prepared batch.
+// If committed, the batch is stored from the prepared record once applied, following LastSeq.
+type batchTxnResolve struct {
+	Txn     string `json:"txn"`
+	Commit  bool   `json:"commit"`
+	Reply   string `json:"reply,omitempty"`
+	LastSeq uint64 `json:"lseq,omitempty"`
+	Time    int64  `json:"ts,omitempty"`
+}
+
+func (p *batchTxnPrepared) txn() *batchTxn {
+	return &batchTxn{id: p.Txn, streams: p.Streams}
+}
+
+// closeBatchTxnGate holds other writes to the stream while our batch is prepared.
+// Returns errBatchTxnInDoubt if a batch prepared before is not resolved yet.
+func (mset *stream) closeBatchTxnGate() error {
+	mset.txnMu.Lock()
+	defer mset.txnMu.Unlock()
+	if mset.txnGate != nil {
+		return errBatchTxnInDoubt
+	}
+	mset.txnGate = make(chan struct{})
+	return nil
+}
+
+// openBatchTxnGate lets other writes continue if our batch could not be prepared.
+func (mset *stream) openBatchTxnGate() {
+	mset.txnMu.Lock()
+	defer mset.txnMu.Unlock()
+	mset.txnDecMu.Lock()
+	prepared := mset.txnPrep != nil
+	mset.txnDecMu.Unlock()
+	if !prepared {
+		mset.openBatchTxnGateLocked()
+	}
+}
+
+// Lock should be held.
+func (mset *stream) openBatchTxnGateLocked() {
+	if mset.txnGate != nil {
+		close(mset.txnGate)
+		mset.txnGate = nil
+	}
+}
+
+// lockBatchTxnGate waits for a prepared batch to be resolved before writing to the stream from outside
+// the ingest loop, and returns with txnMu read locked, so no batch is prepared until the write is done.
+// The wait is bounded by maxBatchTxnWait, errBatchTxnPending is returned if not resolved in time.
+// No locks should be held.
+func (mset *stream) lockBatchTxnGate() error {
+	var timer *time.Timer
+	for {
+		mset.txnMu.RLock()
+		gate := mset.txnGate
+		if gate == nil {
+			return nil
+		}
+		mset.txnMu.RUnlock()
+		if timer == nil {
+			timer = time.NewTimer(maxBatchTxnWait)
+			defer timer.Stop()
+		}
+		select {
+		case <-gate:
+		case <-timer.C:
+			return errBatchTxnPending
+		}
+	}
+}
+
+// batchTxnInDoubt returns whether a prepared batch is being resolved outside the ingest loop.
+// Inbound messages are rejected in the meantime.
+func (mset *stream) batchTxnInDoubt() bool {
+	mset.txnMu.RLock()
+	defer mset.txnMu.RUnlock()
+	return mset.txnGate != nil
+}
+
+// rejectBatchTxnInDoubt responds to an inbound message rejected while a prepared batch is in doubt.
+func (mset *stream) rejectBatchTxnInDoubt(reply string, mt *msgTrace) {
+	apiErr := NewJSStreamGeneralError(errBatchTxnInDoubt)
+	if mt != nil {
+		mt.sendEventFromJetStream(apiErr)
+	}
+	mset.mu.RLock()
+	canRespond := !mset.cfg.NoAck && len(reply) > 0
+	name, outq := mset.cfg.Name, mset.outq
+	mset.mu.RUnlock()
+	if canRespond {
+		buf, _ := json.Marshal(&JSPubAckResponse{PubAck: &PubAck{Stream: name}, Error: apiErr})
+		outq.sendMsg(reply, buf)
+	}
+}
+
+// prepareBatchTxn keeps the record of our prepared batch before voting to commit. Clustered streams log it
+// and wait for it to be applied, other file based streams write it to disk.
+// No locks should be held.
+func (mset *stream) prepareBatchTxn(p *batchTxnPrepared) error {
+	p.resolved = make(chan struct{})
+	mset.mu.RLock()
+	node, term, qch := mset.node, mset.term, mset.qch
+	mset.mu.RUnlock()
+
+	if node == nil {
+		if fn := mset.batchTxnPreparedPath(); fn != _EMPTY_ {
+			b, _ := json.Marshal(p)
+			if err := writeFileWithSync(mset.srv.diskIOSemaphore(), fn, b, defaultFilePerms); err != nil {
+				return err
+			}
+		}
+		mset.txnDecMu.Lock()
+		mset.txnPrep, mset.txnResolving = p, true
+		mset.txnDecMu.Unlock()
+		return nil
+	}
+
+	p.applied = make(chan struct{})
+	mset.txnDecMu.Lock()
+	mset.txnPrepWait = p
+	mset.txnDecMu.Unlock()
+	err := node.Propose(term, encodeBatchTxnPrepared(p))
+	if err == nil {
+		select {
+		case <-p.applied:
+			return nil
+		case <-qch:
+			err = errStreamClosed
+		case <-time.After(batchTxnTimeout):
+			err = errBatchTxnNotKept
+		}
+	}
+	mset.txnDecMu.Lock()
+	defer mset.txnDecMu.Unlock()
+	if mset.txnPrepWait == p {
+		mset.txnPrepWait = nil
+	}
+	// Could have been applied just now. If applied later on, it's resolved like after a leader change.
+	if mset.txnPrep == p {
+		return nil
+	}
+	return err
+}
+
+// applyBatchTxnPrepared keeps the record of a prepared batch logged by the leader.
+// If we lead the stream but didn't propose it ourselves, the batch is resolved in the background.
+func (mset *stream) applyBatchTxnPrepared(p *batchTxnPrepared, isLeader bool) {
+	mset.txnDecMu.Lock()
+	if w := mset.txnPrepWait; w != nil && w.Txn == p.Txn {
+		mset.txnPrep, mset.txnPrepWait, mset.txnResolving = w, nil, true
+		close(w.applied)
+		mset.txnDecMu.Unlock()
+		return
+	}
+	if cp := mset.txnPrep; cp == nil || cp.Txn != p.Txn {
+		p.resolved = make(chan struct{})
+		mset.txnPrep = p
+	}
+	mset.txnDecMu.Unlock()
+	if isLeader {
+		mset.resumeBatchTxn()
+	}
+}
+
+// batchTxnPrepared returns our prepared batch, nil if none.
+func (mset *stream) batchTxnPrepared() *batchTxnPrepared {
+	mset.txnDecMu.Lock()
+	defer mset.txnDecMu.Unlock()
+	return mset.txnPrep
+}
+
+// restoreBatchTxnPrepared sets our prepared batch from a snapshot. If the snapshot has none,
+// a batch we still had prepared was resolved, and is part of the snapshot if committed.
+func (mset *stream) restoreBatchTxnPrepared(p *batchTxnPrepared) {
+	mset.txnDecMu.Lock()
+	cp := mset.txnPrep
+	if p != nil && (cp == nil || cp.Txn != p.Txn) {
+		p.resolved = make(chan struct{})
+		mset.txnPrep = p
+	}
+	mset.txnDecMu.Unlock()
+	if p == nil && cp != nil {
+		mset.setBatchTxnResolved(cp)
+	}
+}
+
+// setBatchTxnResolved removes our prepared batch once committed or abandoned, and lets other writes continue.
+func (mset *stream) setBatchTxnResolved(p *batchTxnPrepared) {
+	mset.txnMu.Lock()
+	defer mset.txnMu.Unlock()
+	mset.txnDecMu.Lock()
+	defer mset.txnDecMu.Unlock()
+	if mset.txnPrep != p {
+		return
+	}
+	mset.txnPrep, mset.txnResolving = nil, false
+	close(p.resolved)
+	mset.openBatchTxnGateLocked()
+}
+
+// resumeBatchTxn resolves our prepared batch in the background, after a restart or as a new leader.
+// Other writes are held until resolved.
+func (mset *stream) resumeBatchTxn() {
+	mset.txnMu.Lock()
+	mset.txnDecMu.Lock()
+	p := mset.txnPrep
+	if p == nil || mset.txnResolving {
+		mset.txnDecMu.Unlock()
+		mset.txnMu.Unlock()
+		return
+	}
+	mset.txnResolving = true
+	if mset.txnGate == nil {
+		mset.txnGate = make(chan struct{})
+	}
+	mset.txnDecMu.Unlock()
+	mset.txnMu.Unlock()
+	mset.startBatchTxnResolver(p)
+}
+
+// startBatchTxnResolver resolves our prepared batch in the background, the caller should be resolving it.
+func (mset *stream) startBatchTxnResolver(p *batchTxnPrepared) {
+	mset.mu.RLock()
+	accName, name := mset.acc.Name, mset.cfg.Name
+	mset.mu.RUnlock()
+	mset.srv.startGoRoutine(func() { mset.resolveBatchTxnInBackground(p) },
+		pprofLabels{
+			"type":    "txn",
+			"account": accName,
+			"stream":  name,
+		},
+	)
+}
+
+// resolveBatchTxnInBackground keeps resolving our prepared batch for as long as we lead the stream.
+// Unless the decision is known, we ask the coordinator to abort, since we may not have voted to commit.
+func (mset *stream) resolveBatchTxnInBackground(p *batchTxnPrepared) {
+	s := mset.srv
+	defer s.grWG.Done()
+	defer func() {
+		mset.txnDecMu.Lock()
+		if mset.txnPrep == p {
+			mset.txnResolving = false
+		}
+		mset.txnDecMu.Unlock()
+	}()
+
+	txn := p.txn()
+	for {
+		mset.mu.RLock()
+		js, accName, name, qch, isLeader := mset.js, mset.acc.Name, mset.cfg.Name, mset.qch, mset.isLeader()
+		mset.mu.RUnlock()
+		if !isLeader {
+			return
+		}
+		if !p.decided {
+			err := js.awaitBatchTxn(accName, name, txn, errBatchTxnGaveUp, qch)
+			if err == errStreamClosed {
+				return
+			} else if err == errBatchTxnUnknown {
+				continue
+			}
+			p.decided, p.err = true, err
+		}
+		err := mset.resolveBatchTxn(p, _EMPTY_, nil)
+		if err == nil || err == errStreamClosed || err == errNotLeader {
+			return
+		}
+		s.RateLimitWarnf("Error resolving prepared batch of transaction %q for '%s > %s': %v", p.Txn, accName, name, err)
+		select {
+		case <-qch:
+			return
+		case <-time.After(batchTxnTimeout):
+		}
+	}
+}
+
+// resolveBatchTxn commits or abandons our prepared batch once the transaction is decided. Clustered streams
+// log the resolution and wait for it to be applied, other streams store the batch and remove the record.
+// Since the decision is final, this is retried until it succeeds. The reply gets the response once committed.
+// No locks should be held.
+func (mset *stream) resolveBatchTxn(p *batchTxnPrepared, reply string, diff *batchStagedDiff) error {
+	mset.mu.RLock()
+	node, term, qch, isLeader := mset.node, mset.term, mset.qch, mset.isLeader()
+	mset.mu.RUnlock()
+
+	if node == nil {
+		if p.err == nil {
+			if err := mset.commitBatchTxnPrepared(p, reply); err != nil {
+				return err
+			}
+		}
+		if fn := mset.batchTxnPreparedPath(); fn != _EMPTY_ {
+			if err := os.Remove(fn); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+		mset.setBatchTxnResolved(p)
+		return nil
+	}
+
+	if !isLeader {
+		return errNotLeader
+	}
+	// Propose the same resolution again while we lead in the same term, a resolution applied before
+	// is ignored, so the batch is stored at most once.
+	r := p.resolve
+	if r == nil || p.term != term {
+		r = &batchTxnResolve{Txn: p.Txn, Commit: p.err == nil, Reply: reply}
+		if r.Commit {
+			// The batch follows the messages proposed so far, since it's stored once applied.
+			mset.mu.RLock()
+			mset.clMu.Lock()
+			if mset.clseq == 0 || mset.clseq < mset.lseq+mset.clfs {
+				recalculateClusteredSeq(mset, false)
+			}
+			r.LastSeq, r.Time = mset.clseq, time.Now().UnixNano()
+			mset.clseq += uint64(len(p.Msgs))
+			if diff != nil {
+				diff.commit(mset)
+			}
+			mset.clMu.Unlock()
+			mset.mu.RUnlock()
+		}
+		p.resolve, p.term = r, term
+	}
+	if err := node.Propose(term, encodeBatchTxnResolve(r)); err != nil {
+		return err
+	}
+	select {
+	case <-p.resolved:
+		return nil
+	case <-qch:
+		return errStreamClosed
+	case <-time.After(batchTxnTimeout):
+		return errBatchTxnPending
+	}
+}
+
+// commitBatchTxnPrepared stores our prepared batch, for unreplicated streams.
+// Messages stored before a failure or restart are skipped, since nothing else is written while prepared.
+// Lock should not be held.
+func (mset *stream) commitBatchTxnPrepared(p *batchTxnPrepared, reply string) error {
+	// Ensure the whole batch is fully isolated, and reads can only happen after the full batch is committed.
+	mset.isolateMu.Lock()
+	defer mset.isolateMu.Unlock()
+	mset.mu.RLock()
+	lseq := mset.lseq
+	mset.mu.RUnlock()
+	for i, m := range p.Msgs {
+		if p.Seq+uint64(i) <= lseq {
+			continue
+		}
+		var _reply string
+		if i == len(p.Msgs)-1 {
+			_reply = reply
+		}
+		if err := mset.processJetStreamMsg(m.Subj, _reply, m.Hdr, m.Msg, 0, 0, nil, false, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyBatchTxnResolve commits or abandons the prepared batch logged by the leader. If committed,
+// the batch is stored like a batch proposed as a whole, a resolution applied before is ignored.
+func (js *jetStream) applyBatchTxnResolve(mset *stream, r *batchTxnResolve, isRecovering bool) error {
+	p := mset.batchTxnPrepared()
+	if p == nil || p.Txn != r.Txn {
+		return nil
+	}
+	if r.Commit {
+		// Ensure the whole batch is fully isolated, and reads can only happen after the full batch is committed.
+		mset.isolateMu.Lock()
+		for i, m := range p.Msgs {
+			var reply string
+			if i == len(p.Msgs)-1 {
+				reply = r.Reply
+			}
+			esm := encodeStreamMsg(m.Subj, reply, m.Hdr, m.Msg, r.LastSeq+uint64(i), r.Time, false)
+			if err := js.applyStreamMsgOp(mset, streamMsgOp, esm[1:], isRecovering, false); err != nil {
+				mset.isolateMu.Unlock()
+				return err
+			}
+		}
+		mset.isolateMu.Unlock()
+	}
+	mset.setBatchTxnResolved(p)
+	return nil
+}
+
+// Returns where our prepared batch is kept, empty for memory based streams.
+func (mset *stream) batchTxnPreparedPath() string {
+	mset.mu.RLock()
+	defer mset.mu.RUnlock()
+	if mset.cfg.Storage != FileStorage || mset.jsa == nil {
+		return _EMPTY_
+	}
+	return filepath.Join(mset.jsa.storeDir, streamsDir, mset.cfg.Name, batchTxnPreparedFile)
+}
+
+// loadBatchTxnPrepared loads our prepared batch, when kept on disk. It's resolved once we lead the stream.
+func (mset *stream) loadBatchTxnPrepared() {
+	fn := mset.batchTxnPreparedPath()
+	if fn == _EMPTY_ {
+		return
+	}
+	buf, err := os.ReadFile(fn)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			mset.srv.Warnf("Error reading prepared batch for '%s > %s': %v", mset.account(), mset.name(), err)
+		}
+		return
+	}
+	var p batchTxnPrepared
+	if err := json.Unmarshal(buf, &p); err != nil {
+		mset.srv.Warnf("Error decoding prepared batch for '%s > %s': %v", mset.account(), mset.name(), err)
+		return
+	}
+	mset.restoreBatchTxnPrepared(&p)
+}
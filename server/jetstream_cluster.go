@@ -173,6 +173,20 @@ const (
 	batchCommitMsgOp
 	// Consumer rest to specific starting sequence.
 	resetSeqOp
+	// Consumer state imported from a checkpoint.
+	importStateOp
+	// Point-in-time stream views.
+	addStreamViewOp
+	removeStreamViewOp
+	// Message redaction.
+	redactMsgOp
+	// Last value compaction.
+	compactStreamOp
+	// Decision of a transaction across atomic batches, logged by the coordinator.
+	batchTxnDecisionOp
+	// Batch prepared as part of a transaction, and its resolution once decided.
+	batchTxnPreparedOp
+	batchTxnResolveOp
 )
 
 // raftGroups are controlled by the metagroup controller.
@@ -187,6 +201,8 @@ type raftGroup struct {
 	// Excluded peers are evacuated and can't be added to this group as part of the meta
 	// leader's reconciliation. Cleared when this group is at the configured replicas.
 	Excluded []string `json:"excluded,omitempty"`
+	// Learners follow the log of the group without being peers, and don't count towards quorum.
+	Learners []string `json:"learners,omitempty"`
 	// Desired holds the target placement while this group is being moved or
 	// scaled; it is nil when the group is stable.
 	Desired *desiredRaftGroup `json:"desired,omitempty"`
@@ -733,6 +749,33 @@ type streamMsgDelete struct {
 	Reply   string      `json:"reply"`
 }
 
+// streamMsgRedact is what the stream leader will replicate when redacting a message.
+type streamMsgRedact struct {
+	Client  *ClientInfo `json:"client,omitempty"`
+	Stream  string      `json:"stream"`
+	Seq     uint64      `json:"seq"`
+	Headers []string    `json:"headers,omitempty"`
+	Reason  string      `json:"reason,omitempty"`
+	Time    time.Time   `json:"time"`
+	Subject string      `json:"subject"`
+	Reply   string      `json:"reply"`
+}
+
+// streamCompact is what the stream leader will replicate to compact the stream up to a sequence.
+type streamCompact struct {
+	Seq             uint64 `json:"seq"`
+	TombstoneCutoff int64  `json:"tombstone_cutoff,omitempty"`
+}
+
+// streamViewUpdate is what the stream leader will replicate when adding or removing a view.
+type streamViewUpdate struct {
+	Client  *ClientInfo    `json:"client,omitempty"`
+	Stream  string         `json:"stream"`
+	View    StreamViewInfo `json:"view"`
+	Subject string         `json:"subject"`
+	Reply   string         `json:"reply"`
+}
+
 const (
 	defaultStoreDirName  = "_js_"
 	defaultMetaGroupName = "_meta_"
@@ -1159,16 +1202,20 @@ func (js *jetStream) isConsumerHealthy(mset *stream, consumer string, ca *consum
 }
 
 // subjectsOverlap checks all existing stream assignments for the account cross-cluster for subject overlap
+// Partitions of the same partitioned stream share their subjects and do not overlap.
 // Use only for clustered JetStream
 // Read lock should be held.
-func (js *jetStream) subjectsOverlap(acc string, subjects []string, osa *streamAssignment) bool {
+func (js *jetStream) subjectsOverlap(acc string, cfg *StreamConfig, osa *streamAssignment) bool {
 	for sa := range js.streamAssignmentsOrInflightSeq(acc) {
 		// can't overlap yourself, assume osa pre-checked for deep equal if passed
 		if osa != nil && sa.Config.Name == osa.Config.Name {
 			continue
 		}
+		if samePartitionedStream(sa.Config, cfg) {
+			continue
+		}
 		for _, subj := range sa.Config.Subjects {
-			for _, tsubj := range subjects {
+			for _, tsubj := range cfg.Subjects {
 				if SubjectsCollide(tsubj, subj) {
 					return true
 				}
@@ -1303,6 +1350,7 @@ func (js *jetStream) setupMetaGroup() error {
 	js.srv.optsMu.RLock()
 	syncAlways := js.srv.opts.SyncAlways
 	syncInterval := js.srv.opts.SyncInterval
+	rtf, rc := js.srv.opts.raftTransport, js.srv.opts.raftClock
 	js.srv.optsMu.RUnlock()
 	fs, err := newFileStoreWithCreated(
 		FileStoreConfig{StoreDir: storeDir, BlockSize: defaultMetaFSBlkSize, AsyncFlush: false, SyncAlways: syncAlways, SyncInterval: syncInterval, srv: s},
@@ -1316,7 +1364,7 @@ func (js *jetStream) setupMetaGroup() error {
 		return err
 	}
 
-	cfg := &RaftConfig{Name: defaultMetaGroupName, Store: storeDir, Log: fs, Recovering: true}
+	cfg := &RaftConfig{Name: defaultMetaGroupName, Store: storeDir, Log: fs, Recovering: true, NewTransport: rtf, Clock: rc}
 
 	// If we are soliciting leafnode connections and we are sharing a system account and do not disable it with a hint,
 	// we want to move to observer mode so that we extend the solicited cluster or supercluster but do not form our own.
@@ -2831,6 +2879,7 @@ func (rg *raftGroup) copyGroup() *raftGroup {
 	cg := *rg
 	cg.Peers = copyStrings(rg.Peers)
 	cg.Excluded = copyStrings(rg.Excluded)
+	cg.Learners = copyStrings(rg.Learners)
 	if rg.Desired != nil {
 		cd := *rg.Desired
 		cd.Peers = copyStrings(rg.Desired.Peers)
@@ -3072,6 +3121,8 @@ func (js *jetStream) processRemovePeer(peer string) {
 		}
 		if sa.Group.isMember(peer) || (sa.Group.Desired != nil && slices.Contains(sa.Group.Desired.Peers, peer)) {
 			js.removePeerFromStreamLocked(sa, peer, peerRemoval{remove: true})
+		} else if sa.Group.isLearner(peer) {
+			js.replaceStreamLearnerLocked(sa, peer)
 		}
 	}
 }
@@ -3430,7 +3481,7 @@ func (rg *raftGroup) setPreferred(s *Server) {
 }
 
 // createRaftGroup is called to spin up this raft group if needed.
-func (js *jetStream) createRaftGroup(accName string, rg *raftGroup, recovering bool, storage StorageType, labels pprofLabels) (RaftNode, error) {
+func (js *jetStream) createRaftGroup(accName string, rg *raftGroup, recovering bool, storage StorageType, lease bool, labels pprofLabels) (RaftNode, error) {
 	// js.mu protects the lookup/registration of raft groups so that two parallel
 	// calls for the same identifier can't end up creating duplicate instances.
 	// It is released around blocking work (waiting for a previous instance to
@@ -3444,8 +3495,8 @@ func (js *jetStream) createRaftGroup(accName string, rg *raftGroup, recovering b
 		return nil, NewJSClusterNotActiveError()
 	}
 
-	// If this is a single peer raft group or we are not a member return.
-	if (rg.Desired == nil && len(rg.Peers) <= 1) || !rg.isMember(cc.meta.ID()) {
+	// If this is a single peer raft group or we are not a member or learner return.
+	if (rg.Desired == nil && len(rg.Peers) <= 1) || !rg.isMemberOrLearner(cc.meta.ID()) {
 		// Nothing to do here.
 		return nil, nil
 	}
@@ -3514,8 +3565,8 @@ retry:
 
 	n, err := func() (RaftNode, error) {
 		var store StreamStore
+		opts := s.getOpts()
 		if storage == FileStorage {
-			opts := s.getOpts()
 			fs, err := newFileStoreWithCreated(
 				FileStoreConfig{StoreDir: storeDir, BlockSize: defaultMediumBlockSize, AsyncFlush: false, SyncAlways: opts.SyncAlways, SyncInterval: opts.SyncInterval, srv: s},
 				StreamConfig{Name: rgName, Storage: FileStorage, Metadata: labels},
@@ -3537,7 +3588,7 @@ retry:
 			store = ms
 		}
 
-		cfg := &RaftConfig{Name: rgName, Store: storeDir, Log: store, Track: true, Managed: true, Recovering: recovering, ScaleUp: rgScaleUp}
+		cfg := &RaftConfig{Name: rgName, Store: storeDir, Log: store, Track: true, Managed: true, Recovering: recovering, ScaleUp: rgScaleUp, Lease: lease, NewTransport: opts.raftTransport, Clock: opts.raftClock}
 
 		if _, err := readPeerState(s.diskIOSemaphore(), storeDir); err != nil {
 			s.bootstrapRaftNode(cfg, rgPeers, true)
@@ -3698,6 +3749,10 @@ func prepareStreamRecovery(mset *stream, n RaftNode) error {
 		if err != nil {
 			return err
 		}
+		// The views opened before the snapshot are not in the log anymore.
+		mset.restoreViews(snap.Views)
+		mset.restoreBatchTxnDecisions(snap.txnDecisions)
+		mset.restoreBatchTxnPrepared(snap.txnPrepared)
 	}
 	return mset.prepareForWALReplay(snap)
 }
@@ -3986,6 +4041,19 @@ func (js *jetStream) monitorStream(mset *stream, sa *streamAssignment, sendSnaps
 	}
 	defer stopDirectMonitoring()
 
+	// Learners never campaign, so they won't get a leader change to start direct access monitoring on.
+	js.mu.RLock()
+	isLearner := sa.Group.isLearner(n.ID())
+	js.mu.RUnlock()
+	if isLearner && mset != nil {
+		mset.mu.RLock()
+		ad, md := mset.cfg.AllowDirect, mset.cfg.MirrorDirect
+		mset.mu.RUnlock()
+		if ad || md {
+			startDirectAccessMonitoring()
+		}
+	}
+
 	// For checking interest state if applicable.
 	var cist *time.Ticker
 	var cistc <-chan time.Time
@@ -4139,7 +4207,8 @@ func (js *jetStream) monitorStream(mset *stream, sa *streamAssignment, sendSnaps
 
 			// Check about snapshotting
 			// If we have at least min entries to compact, go ahead and try to snapshot/compact.
-			if ne >= compactNumMin || nb > compactSizeMin || mset.getCLFS() > pclfs {
+			// Also after a redaction, so the original payload doesn't stay in our log.
+			if ne >= compactNumMin || nb > compactSizeMin || mset.getCLFS() > pclfs || (mset != nil && mset.redactSnap.Swap(false)) {
 				doSnapshot(false)
 			}
 
@@ -4802,8 +4871,9 @@ func (mset *stream) resetClusteredState(err error) bool {
 		}
 	}
 
-	// Preserve our current state and messages unless we have a first sequence mismatch.
-	shouldDelete := err == errFirstSequenceMismatch
+	// Preserve our current state and messages unless we have a first sequence mismatch,
+	// or the store is corrupt.
+	shouldDelete := err == errFirstSequenceMismatch || err == errStoreCorrupt
 
 	// Need to do the rest in a separate Go routine.
 	go func() {
@@ -5089,7 +5159,7 @@ func (js *jetStream) applyStreamEntries(mset *stream, ce *CommittedEntry, isReco
 					return 0, err
 				}
 				mset.clearAllPreAcksInRange(first, lseq)
-				mset.lseq = lseq
+				mset.setLastSeq(lseq)
 				mset.mu.Unlock()
 				mset.isolateMu.Unlock()
 
@@ -5187,6 +5257,141 @@ func (js *jetStream) applyStreamEntries(mset *stream, ce *CommittedEntry, isReco
 						s.sendAPIResponse(sp.Client, mset.account(), sp.Subject, sp.Reply, _EMPTY_, s.jsonResponse(resp))
 					}
 				}
+			case addStreamViewOp, removeStreamViewOp:
+				vu, err := decodeStreamViewUpdate(buf[1:])
+				if err != nil {
+					if node := mset.raftNode(); node != nil {
+						s := js.srv
+						s.Errorf("JetStream cluster could not decode stream view update for '%s > %s' [%s]",
+							mset.account(), mset.name(), node.Group())
+					}
+					return 0, err
+				}
+
+				// Views that expired in the meantime, for example on replay, will not be added.
+				var ok bool
+				if op == addStreamViewOp {
+					ok = mset.addView(&vu.View)
+				} else {
+					ok = mset.removeView(vu.View.ID)
+				}
+
+				// Expired views are removed without a reply.
+				if node := mset.raftNode(); node != nil && node.Leader() && !isRecovering && vu.Reply != _EMPTY_ {
+					s := js.server()
+					if op == addStreamViewOp {
+						var resp = JSApiStreamViewCreateResponse{ApiResponse: ApiResponse{Type: JSApiStreamViewCreateResponseType}}
+						if !ok {
+							resp.Error = NewJSStreamViewCreateError(errors.New("view expired"))
+							s.sendAPIErrResponse(vu.Client, mset.account(), vu.Subject, vu.Reply, _EMPTY_, s.jsonResponse(resp))
+						} else {
+							resp.StreamViewInfo = &vu.View
+							s.sendAPIResponse(vu.Client, mset.account(), vu.Subject, vu.Reply, _EMPTY_, s.jsonResponse(resp))
+						}
+					} else {
+						var resp = JSApiStreamViewDeleteResponse{ApiResponse: ApiResponse{Type: JSApiStreamViewDeleteResponseType}}
+						if !ok {
+							resp.Error = NewJSStreamViewNotFoundError()
+							s.sendAPIErrResponse(vu.Client, mset.account(), vu.Subject, vu.Reply, _EMPTY_, s.jsonResponse(resp))
+						} else {
+							resp.Success = true
+							s.sendAPIResponse(vu.Client, mset.account(), vu.Subject, vu.Reply, _EMPTY_, s.jsonResponse(resp))
+						}
+					}
+				}
+			case redactMsgOp:
+				r, err := decodeMsgRedact(buf[1:])
+				if err != nil {
+					if node := mset.raftNode(); node != nil {
+						s := js.srv
+						s.Errorf("JetStream cluster could not decode redact msg for '%s > %s' [%s]",
+							mset.account(), mset.name(), node.Group())
+					}
+					return 0, err
+				}
+
+				isLeader := !isRecovering
+				if node := mset.raftNode(); node == nil || !node.Leader() {
+					isLeader = false
+				}
+				s := js.server()
+				ok, err := mset.applyRedaction(r, isLeader)
+				if err != nil && !isRecovering {
+					s.Debugf("JetStream cluster failed to redact stream msg %d from '%s > %s': %v",
+						r.Seq, mset.account(), r.Stream, err)
+				}
+
+				// Redactions from the stream we mirror or source from have no one to respond to.
+				if isLeader && r.Reply != _EMPTY_ {
+					var resp = JSApiMsgRedactResponse{ApiResponse: ApiResponse{Type: JSApiMsgRedactResponseType}}
+					if err != nil {
+						resp.Error = NewJSStreamMsgRedactFailedError(err, Unless(err))
+						s.sendAPIErrResponse(r.Client, mset.account(), r.Subject, r.Reply, _EMPTY_, s.jsonResponse(resp))
+					} else if !ok {
+						resp.Error = NewJSSequenceNotFoundError(r.Seq)
+						s.sendAPIErrResponse(r.Client, mset.account(), r.Subject, r.Reply, _EMPTY_, s.jsonResponse(resp))
+					} else {
+						resp.Success = true
+						s.sendAPIResponse(r.Client, mset.account(), r.Subject, r.Reply, _EMPTY_, s.jsonResponse(resp))
+					}
+				}
+			case compactStreamOp:
+				sc, err := decodeStreamCompact(buf[1:])
+				if err != nil {
+					if node := mset.raftNode(); node != nil {
+						s := js.srv
+						s.Errorf("JetStream cluster could not decode compaction for '%s > %s' [%s]",
+							mset.account(), mset.name(), node.Group())
+					}
+					return 0, err
+				}
+				// The leader bounds how many messages a proposal covers, so this is done inline.
+				if fs, ok := mset.store.(*fileStore); ok {
+					fs.compactLastValuesUpTo(sc.Seq, sc.TombstoneCutoff)
+				}
+			case batchTxnDecisionOp:
+				d, err := decodeBatchTxnDecision(buf[1:])
+				if err != nil {
+					if node := mset.raftNode(); node != nil {
+						s := js.srv
+						s.Errorf("JetStream cluster could not decode transaction decision for '%s > %s' [%s]",
+							mset.account(), mset.name(), node.Group())
+					}
+					return 0, err
+				}
+				isLeader := !isRecovering
+				if node := mset.raftNode(); node == nil || !node.Leader() {
+					isLeader = false
+				}
+				js.applyBatchTxnDecision(mset, d, isLeader)
+			case batchTxnPreparedOp:
+				p, err := decodeBatchTxnPrepared(buf[1:])
+				if err != nil {
+					if node := mset.raftNode(); node != nil {
+						s := js.srv
+						s.Errorf("JetStream cluster could not decode prepared batch for '%s > %s' [%s]",
+							mset.account(), mset.name(), node.Group())
+					}
+					return 0, err
+				}
+				isLeader := !isRecovering
+				if node := mset.raftNode(); node == nil || !node.Leader() {
+					isLeader = false
+				}
+				mset.applyBatchTxnPrepared(p, isLeader)
+			case batchTxnResolveOp:
+				r, err := decodeBatchTxnResolve(buf[1:])
+				if err != nil {
+					if node := mset.raftNode(); node != nil {
+						s := js.srv
+						s.Errorf("JetStream cluster could not decode transaction resolution for '%s > %s' [%s]",
+							mset.account(), mset.name(), node.Group())
+					}
+					return 0, err
+				}
+				if err := js.applyBatchTxnResolve(mset, r, isRecovering); err != nil {
+					return 0, err
+				}
 			default:
 				return 0, fmt.Errorf("unknown stream entry op type: %v", op)
 			}
@@ -5349,7 +5554,7 @@ func (js *jetStream) applyStreamMsgOp(mset *stream, op entryOp, mbuf []byte, isR
 			return err
 		}
 		mset.mu.Lock()
-		mset.lseq = last
+		mset.setLastSeq(last)
 		mset.clearAllPreAcks(last)
 		mset.mu.Unlock()
 		return nil
@@ -5563,6 +5768,10 @@ func (js *jetStream) processStreamLeaderChange(mset *stream, isLeader bool, term
 
 	// Tell stream to switch leader status.
 	mset.setLeader(isLeader, term)
+	// Views could have expired while we were not the leader, only the leader proposes removing them.
+	if isLeader {
+		mset.expireViews()
+	}
 
 	if !isLeader || hasResponded {
 		return
@@ -5792,7 +6001,11 @@ func (js *jetStream) processStreamAssignment(sa *streamAssignment) {
 	}
 	var isMember bool
 	if sa.Group != nil && ourID != _EMPTY_ {
-		isMember = sa.Group.isMember(ourID)
+		// Learners run the stream as well, but never respond.
+		isMember = sa.Group.isMemberOrLearner(ourID)
+		if sa.Group.isLearner(ourID) {
+			sa.markResponded()
+		}
 	}
 
 	if s == nil || noMeta {
@@ -5916,9 +6129,9 @@ func (js *jetStream) processUpdateStreamAssignment(sa *streamAssignment) {
 
 	ourID := cc.meta.ID()
 
-	var isMember bool
+	var isMember, isLearner bool
 	if sa.Group != nil {
-		isMember = sa.Group.isMember(ourID)
+		isMember, isLearner = sa.Group.isMemberOrLearner(ourID), sa.Group.isLearner(ourID)
 	}
 
 	accStreams := cc.streams[accName]
@@ -5949,8 +6162,10 @@ func (js *jetStream) processUpdateStreamAssignment(sa *streamAssignment) {
 	accStreams[stream] = sa
 	cc.streams[accName] = accStreams
 
-	// Make sure we respond if we are a member.
-	if isMember {
+	// Make sure we respond if we are a member, learners never respond.
+	if isLearner {
+		sa.markResponded()
+	} else if isMember {
 		sa.clearResponded()
 	} else {
 		// Make sure to clean up any old node in case this stream moves back here.
@@ -6086,7 +6301,7 @@ func (js *jetStream) processClusterUpdateStream(acc *Account, osa, sa *streamAss
 				mset.startClusterSubs()
 				mset.mu.Unlock()
 
-				js.createRaftGroup(acc.GetName(), rg, recovering, storage, pprofLabels{
+				js.createRaftGroup(acc.GetName(), rg, recovering, storage, cfg.LinearizableReads, pprofLabels{
 					"type":    "stream",
 					"account": mset.accName(),
 					"stream":  mset.name(),
@@ -6214,14 +6429,14 @@ func (js *jetStream) processClusterCreateStream(acc *Account, sa *streamAssignme
 	s, rg, created := js.srv, sa.Group, sa.Created
 	alreadyRunning := rg.node != nil
 	newCfg := sa.Config.atDesiredOrigin(rg)
-	storage := sa.Config.Storage
+	storage, lease := sa.Config.Storage, sa.Config.LinearizableReads
 	restore := sa.Restore
 	recovering := sa.recovering
 	hadErr := sa.err != nil
 	js.mu.RUnlock()
 
 	// Process the raft group and make sure it's running if needed.
-	_, err := js.createRaftGroup(acc.GetName(), rg, recovering, storage, pprofLabels{
+	_, err := js.createRaftGroup(acc.GetName(), rg, recovering, storage, lease, pprofLabels{
 		"type":    "stream",
 		"account": acc.Name,
 		"stream":  sa.Config.Name,
@@ -6925,7 +7140,7 @@ func (js *jetStream) processClusterCreateConsumer(oca, ca *consumerAssignment, s
 		storage = MemoryStorage
 	}
 	// No-op if R1.
-	js.createRaftGroup(accName, rg, recovering, storage, pprofLabels{
+	js.createRaftGroup(accName, rg, recovering, storage, false, pprofLabels{
 		"type":     "consumer",
 		"account":  mset.accName(),
 		"stream":   ca.Stream,
@@ -8101,6 +8316,32 @@ func (js *jetStream) applyConsumerEntries(o *consumer, ce *CommittedEntry, isLea
 						}
 					}
 				}
+			case importStateOp:
+				state, reply, err := decodeImportStateUpdate(buf[1:])
+				if err != nil {
+					return err
+				}
+				o.mu.Lock()
+				if err = o.applyImportedState(state); err != nil {
+					s, acc, mset, name := o.srv, o.acc, o.mset, o.name
+					o.mu.Unlock()
+					if s != nil && mset != nil {
+						s.Warnf("Consumer '%s > %s > %s' error on applying imported state: %v", acc, mset.name(), name, err)
+					}
+					break
+				}
+				var respond bool
+				if _, ok := o.rsm[reply]; ok && o.isLeader() {
+					delete(o.rsm, reply)
+					respond = true
+				}
+				o.mu.Unlock()
+				o.checkInterestAfterImport()
+				if respond {
+					var resp = JSApiConsumerStateImportResponse{ApiResponse: ApiResponse{Type: JSApiConsumerStateImportResponseType}}
+					resp.ConsumerInfo = setDynamicConsumerInfoMetadata(o.info())
+					js.srv.sendInternalAccountMsg(nil, reply, js.srv.jsonResponse(&resp))
+				}
 			case addPendingRequest:
 				o.mu.Lock()
 				if !o.isLeader() {
@@ -8237,6 +8478,21 @@ func decodeResetUpdate(buf []byte) (sseq uint64, reply string, err error) {
 	return binary.LittleEndian.Uint64(buf[:8]), string(buf[8:]), nil
 }
 
+var errBadImportStateUpdate = errors.New("jetstream cluster bad replicated import state update")
+
+func decodeImportStateUpdate(buf []byte) (*ConsumerState, string, error) {
+	rl, n := binary.Uvarint(buf)
+	if n <= 0 || uint64(len(buf)-n) < rl {
+		return nil, _EMPTY_, errBadImportStateUpdate
+	}
+	reply := string(buf[n : n+int(rl)])
+	state, err := decodeConsumerState(buf[n+int(rl):])
+	if err != nil {
+		return nil, _EMPTY_, err
+	}
+	return state, reply, nil
+}
+
 func (js *jetStream) processConsumerLeaderChange(o *consumer, isLeader bool, term uint64) error {
 	return js.processConsumerLeaderChangeWithAssignment(o, nil, isLeader, term)
 }
@@ -8816,6 +9072,8 @@ func (rg *raftGroup) reconcileDesiredState(reconcile desiredAssignmentUpdate, re
 	ng := rg.copyGroup()
 	prevPeers := ng.Peers
 	ng.Peers = reconcile.MetaPeers
+	// A learner that is promoted is no longer one once it's part of the peers.
+	ng.Learners = slices.DeleteFunc(ng.Learners, func(peer string) bool { return slices.Contains(ng.Peers, peer) })
 
 	// Compare on sorted copies, so we don't clobber the peer ordering.
 	desiredPeers := copyStrings(rg.Desired.Peers)
@@ -9828,7 +10086,12 @@ func (js *jetStream) createGroupForStream(ci *ClientInfo, cfg *StreamConfig) (*r
 			errs.accumulate(err)
 			continue
 		}
-		return &raftGroup{Name: groupNameForStream(peers, cfg.Storage), Storage: cfg.Storage, Peers: peers, Cluster: cn}, nil
+		rg := &raftGroup{Name: groupNameForStream(peers, cfg.Storage), Storage: cfg.Storage, Peers: peers, Cluster: cn}
+		if rg.Learners, err = cc.selectStreamLearners(cfg, rg, nil); err != nil {
+			errs.accumulate(err)
+			continue
+		}
+		return rg, nil
 	}
 	return nil, errs
 }
@@ -9865,6 +10128,15 @@ func (js *jetStream) jsClusteredStreamLimitsCheck(acc *Account, cfg *StreamConfi
 	}
 
 	numStreams, reservations := js.tieredStreamAndReservationCount(acc.Name, tier, cfg)
+	// Partitions that are not assigned yet will be created along with the stream.
+	for i, psa := range js.partitionAssignments(acc.Name, cfg) {
+		if i != cfg.Partition && psa == nil {
+			numStreams++
+			if cfg.MaxBytes > 0 {
+				reservations = addSaturate(reservations, accountReservation(tier, cfg.Replicas, cfg.MaxBytes))
+			}
+		}
+	}
 	if selectedLimits.MaxStreams > 0 && numStreams >= selectedLimits.MaxStreams {
 		return NewJSMaximumStreamsLimitError()
 	}
@@ -9929,7 +10201,7 @@ func (s *Server) jsClusteredStreamRequest(ci *ClientInfo, acc *Account, subject,
 	}
 
 	// Check for subject collisions here.
-	if js.subjectsOverlap(acc.Name, cfg.Subjects, self) {
+	if js.subjectsOverlap(acc.Name, cfg, self) {
 		resp.Error = NewJSStreamSubjectOverlapError()
 		s.sendAPIErrResponse(ci, acc, subject, reply, string(rmsg), s.jsonResponse(&resp))
 		return
@@ -9964,15 +10236,55 @@ func (s *Server) jsClusteredStreamRequest(ci *ClientInfo, acc *Account, subject,
 	if self != nil {
 		created = self.Created
 	}
+	// Assign the other partitions if we are partitioned, an equal assignment is kept.
+	var psas []*streamAssignment
+	for i, osa := range js.partitionAssignments(acc.Name, cfg) {
+		if i == cfg.Partition {
+			continue
+		}
+		psa := &streamAssignment{Config: cfg.partitionConfig(i), Subject: subject, Client: ci, Created: created}
+		if osa != nil {
+			copyStreamMetadata(psa.Config, osa.Config)
+			if !reflect.DeepEqual(osa.Config, psa.Config) {
+				resp.Error = NewJSStreamNameExistError()
+				s.sendAPIErrResponse(ci, acc, subject, reply, string(rmsg), s.jsonResponse(&resp))
+				return
+			}
+			psa.Group, psa.Sync, psa.Created = osa.Group, osa.Sync, osa.Created
+		} else {
+			prg, err := js.createGroupForStream(ci, psa.Config)
+			if err != nil {
+				resp.Error = NewJSClusterNoPeersError(err)
+				s.sendAPIErrResponse(ci, acc, subject, reply, string(rmsg), s.jsonResponse(&resp))
+				return
+			}
+			prg.setPreferred(s)
+			psa.Group, psa.Sync = prg, syncSubjForStream()
+		}
+		psas = append(psas, psa)
+	}
+
 	// Sync subject for post snapshot sync.
 	sa := &streamAssignment{Group: rg, Sync: syncSubject, Config: cfg, Subject: subject, Reply: reply, Client: ci, Created: created}
-	if err := cc.meta.Propose(cc.term, encodeAddStreamAssignment(sa)); err != nil {
+	// Only the first partition responds to the client.
+	entries := [][]byte{encodeAddStreamAssignment(sa)}
+	for _, psa := range psas {
+		entries = append(entries, encodeAddStreamAssignment(psa))
+	}
+	if err := cc.proposeAll(entries); err != nil {
+		if len(psas) > 0 {
+			resp.Error = NewJSStreamCreateError(err, Unless(err))
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(rmsg), s.jsonResponse(&resp))
+		}
 		return
 	}
 	// On success, add this as an inflight proposal so we can apply limits
 	// on concurrent create requests while this stream assignment has
 	// possibly not been processed yet.
 	cc.trackInflightStreamProposal(acc.Name, sa, false)
+	for _, psa := range psas {
+		cc.trackInflightStreamProposal(acc.Name, psa, false)
+	}
 }
 
 var (
@@ -10103,6 +10415,13 @@ func (s *Server) jsClusteredStreamUpdateRequestLocked(ci *ClientInfo, acc *Accou
 		return
 	}
 
+	// Partitions are updated through their partitioned stream, but can be moved off a peer.
+	if osa.Config.Partition != 0 && len(peerSet) == 0 {
+		resp.Error = NewJSStreamPartitionOperationError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(rmsg), s.jsonResponse(&resp))
+		return
+	}
+
 	// Don't allow updating if all peers are offline.
 	if s.allPeersOffline(osa.Group) {
 		resp.Error = NewJSStreamOfflineError()
@@ -10137,7 +10456,7 @@ func (s *Server) jsClusteredStreamUpdateRequestLocked(ci *ClientInfo, acc *Accou
 	}
 
 	// Check for subject collisions here.
-	if js.subjectsOverlap(acc.Name, newCfg.Subjects, osa) {
+	if js.subjectsOverlap(acc.Name, newCfg, osa) {
 		resp.Error = NewJSStreamSubjectOverlapError()
 		s.sendAPIErrResponse(ci, acc, subject, reply, string(rmsg), s.jsonResponse(&resp))
 		return
@@ -10168,6 +10487,22 @@ func (s *Server) jsClusteredStreamUpdateRequestLocked(ci *ClientInfo, acc *Accou
 		}
 	}
 
+	// Enabling message delays requires all consumers to ack explicitly.
+	if newCfg.AllowMsgDelay && !osa.Config.AllowMsgDelay {
+		var errorConsumers []string
+		for ca := range js.consumerAssignmentsOrInflightSeq(acc.Name, newCfg.Name) {
+			if ca.Config != nil && !msgDelayConsumerOk(ca.Config) {
+				errorConsumers = append(errorConsumers, ca.Name)
+			}
+		}
+		if len(errorConsumers) > 0 {
+			err := fmt.Errorf("message delays require explicit ack policy for consumers: %s", strings.Join(errorConsumers, ", "))
+			resp.Error = NewJSStreamUpdateError(err)
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(rmsg), s.jsonResponse(&resp))
+			return
+		}
+	}
+
 	// Check for a move request.
 	var isMoveRequest bool
 	if lPeerSet := len(peerSet); lPeerSet > 0 {
@@ -10179,6 +10514,13 @@ func (s *Server) jsClusteredStreamUpdateRequestLocked(ci *ClientInfo, acc *Accou
 	// Check for replica changes.
 	isReplicaChange := newCfg.Replicas != osa.Config.Replicas
 
+	// The partitions of a partitioned stream are placed when created.
+	if newCfg.isPartitioned() && len(peerSet) == 0 && (isMoveRequest || isReplicaChange) {
+		resp.Error = NewJSStreamUpdateError(errors.New("partitioned streams can not be moved or scaled"))
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(rmsg), s.jsonResponse(&resp))
+		return
+	}
+
 	// Combining a move and a scale in a single update is not allowed.
 	if isMoveRequest && isReplicaChange {
 		resp.Error = NewJSStreamMoveAndScaleError()
@@ -10230,9 +10572,13 @@ func (s *Server) jsClusteredStreamUpdateRequestLocked(ci *ClientInfo, acc *Accou
 				return
 			}
 			// Overwrite to the new group, but MUST keep the same group name.
-			name := rg.Name
+			// Keep our learners where possible, they're placed on their own.
+			name, learners := rg.Name, rg.learners()
 			rg = nrg
 			rg.Name = name
+			if learners, err := cc.selectStreamLearners(newCfg, rg, learners); err == nil {
+				rg.Learners = learners
+			}
 		} else {
 			if len(rg.Peers) == 1 {
 				rg.Preferred = peerSet[0]
@@ -10268,7 +10614,8 @@ func (s *Server) jsClusteredStreamUpdateRequestLocked(ci *ClientInfo, acc *Accou
 					rg.Cluster = ci.Cluster
 				}
 			}
-			peers, err := cc.selectPeerGroup(newCfg.Replicas, rg.Cluster, newCfg, currentPeers, 0, nil)
+			// Learners are promoted explicitly, don't select them as peers.
+			peers, err := cc.selectPeerGroup(newCfg.Replicas, rg.Cluster, newCfg, currentPeers, 0, rg.Learners)
 			if err != nil {
 				resp.Error = NewJSClusterNoPeersError(err)
 				s.sendAPIErrResponse(ci, acc, subject, reply, string(rmsg), s.jsonResponse(&resp))
@@ -10295,6 +10642,13 @@ func (s *Server) jsClusteredStreamUpdateRequestLocked(ci *ClientInfo, acc *Accou
 		rg.Preferred = _EMPTY_
 	}
 
+	// Place or remove learners if their number or placement changed.
+	if apiErr := cc.updateStreamLearners(osa.Config, newCfg, osa.Group, rg); apiErr != nil {
+		resp.Error = apiErr
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(rmsg), s.jsonResponse(&resp))
+		return
+	}
+
 	// If we're the first to specify an origin for desired state, capture it.
 	rg.populateOrigin(osa)
 
@@ -10306,10 +10660,38 @@ func (s *Server) jsClusteredStreamUpdateRequestLocked(ci *ClientInfo, acc *Accou
 		syncSubject = syncSubjForStream()
 	}
 	sa := &streamAssignment{Group: rg, Sync: syncSubject, Created: osa.Created, Config: newCfg, Subject: subject, Reply: reply, Client: ci}
-	if err := meta.Propose(cc.term, encodeUpdateStreamAssignment(sa)); err != nil {
+
+	// Update the other partitions as well, only the first partition responds to the client.
+	var psas []*streamAssignment
+	if len(peerSet) == 0 {
+		for i, psa := range js.partitionAssignments(acc.Name, newCfg) {
+			if psa == nil {
+				continue
+			}
+			prg := psa.copyGroup().Group
+			if prg.Desired == nil {
+				prg.ScaleUp = false
+			}
+			prg.Preferred = _EMPTY_
+			prg = prg.withRetentionChange(psa, newCfg.Retention)
+			psas = append(psas, &streamAssignment{Group: prg, Sync: psa.Sync, Created: psa.Created, Config: newCfg.partitionConfig(i), Subject: subject, Client: ci})
+		}
+	}
+	entries := [][]byte{encodeUpdateStreamAssignment(sa)}
+	for _, psa := range psas {
+		entries = append(entries, encodeUpdateStreamAssignment(psa))
+	}
+	if err := cc.proposeAll(entries); err != nil {
+		if len(psas) > 0 {
+			resp.Error = NewJSStreamUpdateError(err, Unless(err))
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(rmsg), s.jsonResponse(&resp))
+		}
 		return
 	}
 	cc.trackInflightStreamProposal(acc.Name, sa, false)
+	for _, psa := range psas {
+		cc.trackInflightStreamProposal(acc.Name, psa, false)
+	}
 }
 
 func (s *Server) jsClusteredStreamDeleteRequest(ci *ClientInfo, acc *Account, stream, subject, reply string, rmsg []byte) {
@@ -10333,11 +10715,39 @@ func (s *Server) jsClusteredStreamDeleteRequest(ci *ClientInfo, acc *Account, st
 		return
 	}
 
+	// Partitions are deleted along with their partitioned stream.
+	if osa.Config.Partition != 0 {
+		var resp = JSApiStreamDeleteResponse{ApiResponse: ApiResponse{Type: JSApiStreamDeleteResponseType}}
+		resp.Error = NewJSStreamPartitionOperationError()
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(rmsg), s.jsonResponse(&resp))
+		return
+	}
+
 	sa := &streamAssignment{Group: osa.Group, Config: osa.Config, Subject: subject, Reply: reply, Client: ci, Created: osa.Created}
-	if err := cc.meta.Propose(cc.term, encodeDeleteStreamAssignment(sa)); err != nil {
+
+	// Delete the other partitions as well, only the first partition responds to the client.
+	var dsas []*streamAssignment
+	for _, psa := range js.partitionAssignments(acc.Name, osa.Config) {
+		if psa != nil {
+			dsas = append(dsas, &streamAssignment{Group: psa.Group, Config: psa.Config, Subject: subject, Client: ci, Created: psa.Created})
+		}
+	}
+	entries := [][]byte{encodeDeleteStreamAssignment(sa)}
+	for _, dsa := range dsas {
+		entries = append(entries, encodeDeleteStreamAssignment(dsa))
+	}
+	if err := cc.proposeAll(entries); err != nil {
+		if len(dsas) > 0 {
+			var resp = JSApiStreamDeleteResponse{ApiResponse: ApiResponse{Type: JSApiStreamDeleteResponseType}}
+			resp.Error = NewJSStreamDeleteError(err, Unless(err))
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(rmsg), s.jsonResponse(&resp))
+		}
 		return
 	}
 	cc.trackInflightStreamProposal(acc.Name, sa, true)
+	for _, dsa := range dsas {
+		cc.trackInflightStreamProposal(acc.Name, dsa, true)
+	}
 }
 
 // Process a clustered purge request.
@@ -10367,6 +10777,14 @@ func (s *Server) jsClusteredStreamPurgeRequest(
 	if n := sa.Group.node; n != nil {
 		sp := encodeStreamPurge(&streamPurge{Stream: stream, LastSeq: mset.state().LastSeq, Subject: subject, Reply: reply, Client: ci, Request: preq})
 		js.mu.Unlock()
+		// Wait for a prepared batch to be resolved.
+		if err := mset.lockBatchTxnGate(); err != nil {
+			resp := JSApiStreamPurgeResponse{ApiResponse: ApiResponse{Type: JSApiStreamPurgeResponseType}}
+			resp.Error = NewJSStreamGeneralError(err)
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(rmsg), s.jsonResponse(&resp))
+			return
+		}
+		defer mset.txnMu.RUnlock()
 		mset.mu.RLock()
 		term := mset.term
 		mset.mu.RUnlock()
@@ -10406,6 +10824,12 @@ func (s *Server) jsClusteredStreamRestoreRequest(
 		s.sendAPIErrResponse(ci, acc, subject, reply, string(rmsg), s.jsonResponse(&resp))
 		return
 	}
+	// A snapshot holds a single partition only.
+	if cfg.isPartitioned() {
+		resp.Error = NewJSStreamRestoreError(errors.New("partitioned streams can not be restored"))
+		s.sendAPIErrResponse(ci, acc, subject, reply, string(rmsg), s.jsonResponse(&resp))
+		return
+	}
 
 	js.mu.Lock()
 	defer js.mu.Unlock()
@@ -10961,10 +11385,33 @@ func (s *Server) jsClusteredConsumerDeleteRequest(ci *ClientInfo, acc *Account,
 		return
 	}
 	ca := &consumerAssignment{Group: oca.Group, Stream: stream, Name: consumer, Config: oca.Config, Subject: subject, Reply: reply, Client: ci, Created: oca.Created}
-	if err := cc.meta.Propose(cc.term, encodeDeleteConsumerAssignment(ca)); err != nil {
+
+	// Delete the consumer from the other partitions as well, only the first partition responds to the client.
+	var dcas []*consumerAssignment
+	if sa.Config.Partition == 0 {
+		for _, psa := range js.partitionAssignments(acc.Name, sa.Config) {
+			if psa == nil || psa.consumers[consumer] == nil {
+				continue
+			}
+			pca := psa.consumers[consumer]
+			dcas = append(dcas, &consumerAssignment{Group: pca.Group, Stream: pca.Stream, Name: consumer, Config: pca.Config, Subject: subject, Client: ci, Created: pca.Created})
+		}
+	}
+	entries := [][]byte{encodeDeleteConsumerAssignment(ca)}
+	for _, dca := range dcas {
+		entries = append(entries, encodeDeleteConsumerAssignment(dca))
+	}
+	if err := cc.proposeAll(entries); err != nil {
+		if len(dcas) > 0 {
+			resp.Error = NewJSStreamGeneralError(err, Unless(err))
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(rmsg), s.jsonResponse(&resp))
+		}
 		return
 	}
 	cc.trackInflightConsumerProposal(acc.Name, stream, ca, true)
+	for _, dca := range dcas {
+		cc.trackInflightConsumerProposal(acc.Name, dca.Stream, dca, true)
+	}
 }
 
 func encodeMsgDelete(md *streamMsgDelete) []byte {
@@ -10980,6 +11427,106 @@ func decodeMsgDelete(buf []byte) (*streamMsgDelete, error) {
 	return &md, err
 }
 
+func encodeStreamViewUpdate(op entryOp, vu *streamViewUpdate) []byte {
+	var bb bytes.Buffer
+	bb.WriteByte(byte(op))
+	json.NewEncoder(&bb).Encode(vu)
+	return bb.Bytes()
+}
+
+func decodeStreamViewUpdate(buf []byte) (*streamViewUpdate, error) {
+	var vu streamViewUpdate
+	err := json.Unmarshal(buf, &vu)
+	return &vu, err
+}
+
+// jsClusteredStreamViewRequest proposes adding or removing a view, the response is sent once applied.
+func (s *Server) jsClusteredStreamViewRequest(ci *ClientInfo, mset *stream, op entryOp, vi *StreamViewInfo, subject, reply string) {
+	mset.mu.RLock()
+	node, term, stream := mset.node, mset.term, mset.cfg.Name
+	mset.mu.RUnlock()
+	if node == nil {
+		return
+	}
+	node.Propose(term, encodeStreamViewUpdate(op, &streamViewUpdate{View: *vi, Stream: stream, Subject: subject, Reply: reply, Client: ci}))
+}
+
+func encodeMsgRedact(r *streamMsgRedact) []byte {
+	var bb bytes.Buffer
+	bb.WriteByte(byte(redactMsgOp))
+	json.NewEncoder(&bb).Encode(r)
+	return bb.Bytes()
+}
+
+func decodeMsgRedact(buf []byte) (*streamMsgRedact, error) {
+	var r streamMsgRedact
+	err := json.Unmarshal(buf, &r)
+	return &r, err
+}
+
+func encodeStreamCompact(sc *streamCompact) []byte {
+	var bb bytes.Buffer
+	bb.WriteByte(byte(compactStreamOp))
+	json.NewEncoder(&bb).Encode(sc)
+	return bb.Bytes()
+}
+
+func decodeStreamCompact(buf []byte) (*streamCompact, error) {
+	var sc streamCompact
+	err := json.Unmarshal(buf, &sc)
+	return &sc, err
+}
+
+func encodeBatchTxnDecision(d *batchTxnDecision) []byte {
+	var bb bytes.Buffer
+	bb.WriteByte(byte(batchTxnDecisionOp))
+	json.NewEncoder(&bb).Encode(d)
+	return bb.Bytes()
+}
+
+func decodeBatchTxnDecision(buf []byte) (*batchTxnDecision, error) {
+	var d batchTxnDecision
+	err := json.Unmarshal(buf, &d)
+	return &d, err
+}
+
+func encodeBatchTxnPrepared(p *batchTxnPrepared) []byte {
+	var bb bytes.Buffer
+	bb.WriteByte(byte(batchTxnPreparedOp))
+	json.NewEncoder(&bb).Encode(p)
+	return bb.Bytes()
+}
+
+func decodeBatchTxnPrepared(buf []byte) (*batchTxnPrepared, error) {
+	var p batchTxnPrepared
+	err := json.Unmarshal(buf, &p)
+	return &p, err
+}
+
+func encodeBatchTxnResolve(r *batchTxnResolve) []byte {
+	var bb bytes.Buffer
+	bb.WriteByte(byte(batchTxnResolveOp))
+	json.NewEncoder(&bb).Encode(r)
+	return bb.Bytes()
+}
+
+func decodeBatchTxnResolve(buf []byte) (*batchTxnResolve, error) {
+	var r batchTxnResolve
+	err := json.Unmarshal(buf, &r)
+	return &r, err
+}
+
+// jsClusteredMsgRedactRequest proposes redacting a message, the response is sent once applied.
+func (s *Server) jsClusteredMsgRedactRequest(mset *stream, r *streamMsgRedact) {
+	mset.mu.RLock()
+	node, term := mset.node, mset.term
+	mset.mu.RUnlock()
+	if node == nil {
+		return
+	}
+	node.Propose(term, encodeMsgRedact(r))
+}
+
 func (s *Server) jsClusteredMsgDeleteRequest(ci *ClientInfo, acc *Account, mset *stream, stream, subject, reply string, req *JSApiMsgDeleteRequest, rmsg []byte) {
 	js, cc := s.getJetStreamCluster()
 	if js == nil || cc == nil {
@@ -10998,6 +11545,14 @@ func (s *Server) jsClusteredMsgDeleteRequest(ci *ClientInfo, acc *Account, mset
 	if n := sa.Group.node; n != nil {
 		md := encodeMsgDelete(&streamMsgDelete{Seq: req.Seq, NoErase: req.NoErase, Stream: stream, Subject: subject, Reply: reply, Client: ci})
 		js.mu.Unlock()
+		// Wait for a prepared batch to be resolved.
+		if err := mset.lockBatchTxnGate(); err != nil {
+			resp := JSApiMsgDeleteResponse{ApiResponse: ApiResponse{Type: JSApiMsgDeleteResponseType}}
+			resp.Error = NewJSStreamMsgDeleteFailedError(err)
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(rmsg), s.jsonResponse(&resp))
+			return
+		}
+		defer mset.txnMu.RUnlock()
 		mset.mu.RLock()
 		term := mset.term
 		mset.mu.RUnlock()
@@ -11455,6 +12010,13 @@ func (s *Server) jsClusteredConsumerRequest(ci *ClientInfo, acc *Account, subjec
 		rBefore := nca.Config.replicas(sa.Config)
 		rAfter := cfg.replicas(sa.Config)
 
+		// Consumers of a partitioned stream are placed on each partition when created.
+		if rBefore != rAfter && sa.Config.isPartitioned() {
+			resp.Error = NewJSConsumerCreateError(errors.New("consumers of partitioned streams can not be scaled"))
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+			return
+		}
+
 		if rBefore < rAfter {
 			newPeerSet := nca.Group.Peers
 			// Scale up by adding new members from the stream peer set that are not yet in the consumer peer set.
@@ -11502,11 +12064,54 @@ func (s *Server) jsClusteredConsumerRequest(ci *ClientInfo, acc *Account, subjec
 		ca = nca
 	}
 
-	// Do formal proposal.
-	if err := cc.meta.Propose(cc.term, encodeAddConsumerAssignment(ca)); err != nil {
+	// Consumers of a partitioned stream are created on all its partitions.
+	var pcas []*consumerAssignment
+	if sa.Config.isPartitioned() && sa.Config.Partition == 0 && !cfg.Direct && !cfg.Sourcing {
+		if cfg.View != _EMPTY_ {
+			resp.Error = NewJSConsumerCreateError(errors.New("consumers of partitioned streams can not use a view"))
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+			return
+		}
+		for _, psa := range js.partitionAssignments(acc.Name, sa.Config) {
+			if psa == nil {
+				continue
+			}
+			pca := js.consumerAssignmentOrInflight(acc.Name, psa.Config.Name, ca.Name)
+			if pca == nil {
+				prg, err := cc.createGroupForConsumer(cfg, psa)
+				if err != nil {
+					resp.Error = NewJSInsufficientResourcesError()
+					s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+					return
+				}
+				prg.setPreferred(s)
+				prg.Cluster = psa.Group.Cluster
+				pca = &consumerAssignment{Group: prg, Stream: psa.Config.Name, Name: ca.Name, Created: ca.Created}
+			} else {
+				pca = pca.copyGroup()
+				pca.Reply = _EMPTY_
+			}
+			pca.Config, pca.Subject, pca.Client = cfg.clone(), subject, ci
+			pcas = append(pcas, pca)
+		}
+	}
+
+	// Do formal proposal. Only the first partition responds to the client.
+	entries := [][]byte{encodeAddConsumerAssignment(ca)}
+	for _, pca := range pcas {
+		entries = append(entries, encodeAddConsumerAssignment(pca))
+	}
+	if err := cc.proposeAll(entries); err != nil {
+		if len(pcas) > 0 {
+			resp.Error = NewJSConsumerCreateError(err, Unless(err))
+			s.sendAPIErrResponse(ci, acc, subject, reply, string(msg), s.jsonResponse(&resp))
+		}
 		return
 	}
 	cc.trackInflightConsumerProposal(acc.Name, stream, ca, false)
+	for _, pca := range pcas {
+		cc.trackInflightConsumerProposal(acc.Name, pca.Stream, pca, false)
+	}
 }
 
 func encodeAddConsumerAssignment(ca *consumerAssignment) []byte {
@@ -11804,6 +12409,30 @@ type streamSnapshot struct {
 }
 
 func decodeStreamSnapshot(data []byte) (*StreamReplicatedState, error) {
+	txns, data, err := decodeTxnSnapshot(data)
+	if err != nil {
+		return nil, err
+	}
+	if txns != nil {
+		state, err := decodeStreamSnapshot(data)
+		if err != nil {
+			return nil, err
+		}
+		state.txnDecisions, state.txnPrepared = txns.Decisions, txns.Prepared
+		return state, nil
+	}
+	views, data, err := decodeViewsSnapshot(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(views) > 0 {
+		state, err := decodeStreamSnapshot(data)
+		if err != nil {
+			return nil, err
+		}
+		state.Views = views
+		return state, nil
+	}
 	if IsEncodedStreamState(data) {
 		return DecodeStreamState(data)
 	}
@@ -11844,6 +12473,14 @@ func (mset *stream) stateSnapshotLocked() []byte {
 		if err != nil {
 			return nil
 		}
+		// Only prefixed with views when there are any, so peers that don't know about views can still decode it.
+		if views := mset.viewInfos(); len(views) > 0 {
+			snap = encodeViewsSnapshot(views, snap)
+		}
+		// Same for the decisions of transactions we coordinate, and our prepared batch.
+		if ds, p := mset.batchTxnDecisions(), mset.batchTxnPrepared(); len(ds) > 0 || p != nil {
+			snap = encodeTxnSnapshot(&batchTxnSnapshot{Decisions: ds, Prepared: p}, snap)
+		}
 		return snap
 	}
 
@@ -11873,6 +12510,14 @@ const streamLagWarnThreshold = 10_000
 
 // processClusteredInboundMsg will propose the inbound message to the underlying raft group.
 func (mset *stream) processClusteredInboundMsg(subject, reply string, hdr, msg []byte, mt *msgTrace, sourced bool) (retErr error) {
+	// Sourced messages don't come through the ingest loop, so wait for a prepared batch to be resolved.
+	if sourced {
+		if err := mset.lockBatchTxnGate(); err != nil {
+			return err
+		}
+		defer mset.txnMu.RUnlock()
+	}
+
 	// For possible error response.
 	var response []byte
 
@@ -11881,8 +12526,8 @@ func (mset *stream) processClusteredInboundMsg(subject, reply string, hdr, msg [
 	name, stype := mset.cfg.Name, mset.cfg.Storage
 	discard, discardNewPer, maxMsgs, maxMsgsPer, maxBytes := mset.cfg.Discard, mset.cfg.DiscardNewPer, mset.cfg.MaxMsgs, mset.cfg.MaxMsgsPer, mset.cfg.MaxBytes
 	s, js, jsa, st, r, tierName, outq, node, term := mset.srv, mset.js, mset.jsa, mset.cfg.Storage, mset.cfg.Replicas, mset.tier, mset.outq, mset.node, mset.term
-	maxMsgSize, lseq := int(mset.cfg.MaxMsgSize), mset.lseq
-	isLeader, isSealed, allowRollup, denyPurge, allowTTL, allowMsgCounter, allowMsgSchedules := mset.isLeader(), mset.cfg.Sealed, mset.cfg.AllowRollup, mset.cfg.DenyPurge, mset.cfg.AllowMsgTTL, mset.cfg.AllowMsgCounter, mset.cfg.AllowMsgSchedules
+	maxMsgSize, lseq, irl := int(mset.cfg.MaxMsgSize), mset.lseq, mset.irl.Load()
+	isLeader, isSealed, allowRollup, denyPurge, allowTTL, allowMsgCounter, allowMsgSchedules, allowMsgDelay, allowMsgPriority := mset.isLeader(), mset.cfg.Sealed, mset.cfg.AllowRollup, mset.cfg.DenyPurge, mset.cfg.AllowMsgTTL, mset.cfg.AllowMsgCounter, mset.cfg.AllowMsgSchedules, mset.cfg.AllowMsgDelay, mset.cfg.AllowMsgPriority
 
 	// Apply the input subject transform if any
 	csubject := subject
@@ -11971,6 +12616,22 @@ func (mset *stream) processClusteredInboundMsg(subject, reply string, hdr, msg [
 		return err
 	}
 
+	// Check the ingest rate limit, sourced messages are exempt.
+	if irl != nil && !sourced && !irl.allow(csubject) {
+		// With discard old we drop the message without responding.
+		if discard != DiscardNew {
+			return errIngestRateLimited
+		}
+		apiErr := NewJSStreamIngestRateExceededError()
+		if canRespond {
+			var resp = &JSPubAckResponse{PubAck: &PubAck{Stream: name}}
+			resp.Error = apiErr
+			response, _ = json.Marshal(resp)
+			outq.send(newJSPubMsg(reply, _EMPTY_, _EMPTY_, nil, response, nil, 0))
+		}
+		return apiErr
+	}
+
 	// Proceed with proposing this message.
 
 	// We only use mset.clseq for clustering and in case we run ahead of actual commits.
@@ -11986,7 +12647,7 @@ func (mset *stream) processClusteredInboundMsg(subject, reply string, hdr, msg [
 		err    error
 	)
 	diff := &batchStagedDiff{}
-	if hdr, msg, dseq, apiErr, err = checkMsgHeadersPreClusteredProposal(diff, mset, csubject, subject, hdr, msg, sourced, name, jsa, allowRollup, denyPurge, allowTTL, allowMsgCounter, allowMsgSchedules, discard, discardNewPer, maxMsgSize, maxMsgs, maxMsgsPer, maxBytes); err != nil {
+	if hdr, msg, dseq, apiErr, err = checkMsgHeadersPreClusteredProposal(diff, mset, csubject, subject, hdr, msg, sourced, name, jsa, allowRollup, denyPurge, allowTTL, allowMsgCounter, allowMsgSchedules, allowMsgDelay, allowMsgPriority, discard, discardNewPer, maxMsgSize, maxMsgs, maxMsgsPer, maxBytes); err != nil {
 		mset.clMu.Unlock()
 		if err == errMsgIdDuplicate && dseq > 0 {
 			var buf [256]byte
@@ -12062,7 +12723,7 @@ func (mset *stream) processSnapshotDeletes(snap *StreamReplicatedState) error {
 			return err
 		}
 		mset.store.FastState(&state)
-		mset.lseq = state.LastSeq
+		mset.setLastSeq(state.LastSeq)
 		mset.clearAllPreAcksBelowFloor(state.FirstSeq)
 		didReset = true
 	}
@@ -12205,6 +12866,10 @@ var (
 func (mset *stream) processSnapshot(snap *StreamReplicatedState, index uint64) (e error) {
 	// Adopt the leader's sourcing state, we can't always derive it locally.
 	mset.store.ApplySourcesState(snap.Sources)
+	// Same for the open views, they are not part of the store state.
+	mset.restoreViews(snap.Views)
+	mset.restoreBatchTxnDecisions(snap.txnDecisions)
+	mset.restoreBatchTxnPrepared(snap.txnPrepared)
 
 	// Update any deletes, etc.
 	if err := mset.processSnapshotDeletes(snap); err != nil {
@@ -12553,7 +13218,7 @@ func (mset *stream) processCatchupMsg(msg []byte) (uint64, error) {
 			return 0, errCatchupWrongSeqForSkip
 		}
 		mset.clearAllPreAcksInRange(dr.First, lseq)
-		mset.lseq = lseq
+		mset.setLastSeq(lseq)
 		mset.mu.Unlock()
 		return lseq, nil
 	}
@@ -12573,7 +13238,7 @@ func (mset *stream) processCatchupMsg(msg []byte) (uint64, error) {
 
 	mset.mu.Lock()
 	st := mset.cfg.Storage
-	if mset.hasAllPreAcks(seq, subj) {
+	if mset.hasAllPreAcks(seq, subj, hdr) {
 		mset.clearAllPreAcks(seq)
 		// Mark this to be skipped
 		subj, ts = _EMPTY_, 0
@@ -12599,20 +13264,25 @@ func (mset *stream) processCatchupMsg(msg []byte) (uint64, error) {
 		}
 	} else if err := mset.store.StoreRawMsg(subj, hdr, msg, seq, ts, ttl, false); err != nil {
 		return 0, err
+	} else if len(msg) == 0 && len(sliceHeader(JSRedacted, hdr)) > 0 {
+		// Redacted before we caught up, keep track of it for our mirrors and sources.
+		mset.trackRedacted(seq)
 	}
 
 	mset.mu.Lock()
 	defer mset.mu.Unlock()
 	// Update our lseq.
-	mset.lseq = seq
+	mset.setLastSeq(seq)
 
 	// Check for MsgId and if we have one here make sure to update our internal map.
-	if len(hdr) > 0 {
-		if msgId := getMsgId(hdr); msgId != _EMPTY_ {
-			mset.ddMu.Lock()
-			mset.storeMsgIdLocked(&ddentry{msgId, seq, ts})
-			mset.ddMu.Unlock()
-		}
+	msgId := getMsgId(hdr)
+	if msgId == _EMPTY_ && subj != _EMPTY_ && mset.cfg.Mirror == nil {
+		msgId = mset.contentDedupeId(subj, hdr, msg)
+	}
+	if msgId != _EMPTY_ {
+		mset.ddMu.Lock()
+		mset.storeMsgIdLocked(&ddentry{msgId, seq, ts})
+		mset.ddMu.Unlock()
 	}
 
 	return seq, nil
@@ -12672,7 +13342,7 @@ func (js *jetStream) clusterInfo(rg *raftGroup) *ClusterInfo {
 	// contention on Raft locks can't happen while holding JS lock.
 	n := rg.node
 	rgName := rg.Name
-	rgPeers := copyStrings(rg.Peers)
+	rgPeers, rgLearners := copyStrings(rg.Peers), rg.learners()
 	var (
 		desired      *DesiredClusterInfo
 		desiredPeers []string
@@ -12715,6 +13385,41 @@ func (js *jetStream) clusterInfo(rg *raftGroup) *ClusterInfo {
 		RaftGroup: rgName,
 	}
 
+	now := time.Now()
+	peerInfo := func(rp *Peer) *PeerInfo {
+		var lastSeen time.Duration
+		if now.After(rp.Last) && !rp.Last.IsZero() {
+			lastSeen = now.Sub(rp.Last)
+		}
+		current := rp.Current
+		if current && lastSeen > lostQuorumInterval {
+			current = false
+		}
+		// Create a peer info with common settings if the peer has not been seen
+		// yet (which can happen after the whole cluster is stopped and only some
+		// of the nodes are restarted).
+		pi := &PeerInfo{
+			Current: current,
+			Offline: true,
+			Active:  lastSeen,
+			Lag:     rp.Lag,
+			Peer:    rp.ID,
+		}
+		// If node is found, complete/update the settings.
+		if sir, ok := s.nodeToInfo.Load(rp.ID); ok && sir != nil {
+			si := sir.(nodeInfo)
+			pi.Name, pi.Offline, pi.cluster = si.name, si.offline, si.cluster
+		} else {
+			// If not, then add a name that indicates that the server name
+			// is unknown at this time, and clear the lag since it is misleading
+			// (the node may not have that much lag).
+			// Note: We return now the Peer ID in PeerInfo, so the "(peerID: %s)"
+			// would technically not be required, but keeping it for now.
+			pi.Name, pi.Lag = fmt.Sprintf("Server name unknown at this time (peerID: %s)", rp.ID), 0
+		}
+		return pi
+	}
+
 	id := s.Node()
 	if n != nil {
 		ci.Leader = s.serverNameForNode(n.GroupLeader())
@@ -12727,41 +13432,10 @@ func (js *jetStream) clusterInfo(rg *raftGroup) *ClusterInfo {
 			id = _EMPTY_
 		}
 
-		now := time.Now()
 		for _, rp := range n.Peers() {
 			// The peer is either in the actual or desired peer set.
 			if rp.ID != id && (slices.Contains(rgPeers, rp.ID) || slices.Contains(desiredPeers, rp.ID)) {
-				var lastSeen time.Duration
-				if now.After(rp.Last) && !rp.Last.IsZero() {
-					lastSeen = now.Sub(rp.Last)
-				}
-				current := rp.Current
-				if current && lastSeen > lostQuorumInterval {
-					current = false
-				}
-				// Create a peer info with common settings if the peer has not been seen
-				// yet (which can happen after the whole cluster is stopped and only some
-				// of the nodes are restarted).
-				pi := &PeerInfo{
-					Current: current,
-					Offline: true,
-					Active:  lastSeen,
-					Lag:     rp.Lag,
-					Peer:    rp.ID,
-				}
-				// If node is found, complete/update the settings.
-				if sir, ok := s.nodeToInfo.Load(rp.ID); ok && sir != nil {
-					si := sir.(nodeInfo)
-					pi.Name, pi.Offline, pi.cluster = si.name, si.offline, si.cluster
-				} else {
-					// If not, then add a name that indicates that the server name
-					// is unknown at this time, and clear the lag since it is misleading
-					// (the node may not have that much lag).
-					// Note: We return now the Peer ID in PeerInfo, so the "(peerID: %s)"
-					// would technically not be required, but keeping it for now.
-					pi.Name, pi.Lag = fmt.Sprintf("Server name unknown at this time (peerID: %s)", rp.ID), 0
-				}
-				ci.Replicas = append(ci.Replicas, pi)
+				ci.Replicas = append(ci.Replicas, peerInfo(rp))
 			}
 		}
 	}
@@ -12803,14 +13477,30 @@ func (js *jetStream) clusterInfo(rg *raftGroup) *ClusterInfo {
 		pi.Pending = n != nil
 		ci.Replicas = append(ci.Replicas, pi)
 	}
+	// Learners are not peers, so only known if they've been following our log.
+	for _, peer := range rgLearners {
+		if peer == id {
+			continue
+		}
+		var rp *Peer
+		if n != nil {
+			rp = n.ObservedPeer(peer)
+		}
+		if rp != nil {
+			ci.Learners = append(ci.Learners, peerInfo(rp))
+		} else {
+			ci.Learners = append(ci.Learners, generatePeer(peer))
+		}
+	}
 	// Order the result based on the name so that we get something consistent
 	// when doing repeated stream info in the CLI, etc...
 	slices.SortFunc(ci.Replicas, func(i, j *PeerInfo) int { return cmp.Compare(i.Name, j.Name) })
+	slices.SortFunc(ci.Learners, func(i, j *PeerInfo) int { return cmp.Compare(i.Name, j.Name) })
 	return ci
 }
 
 func (mset *stream) checkClusterInfo(ci *ClusterInfo) {
-	for _, r := range ci.Replicas {
+	for _, r := range slices.Concat(ci.Replicas, ci.Learners) {
 		peer := getHash(r.Name)
 		if lag := mset.lagForCatchupPeer(peer); lag > 0 {
 			r.Current = false
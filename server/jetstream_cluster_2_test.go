@@ -9020,10 +9020,15 @@ func TestJetStreamClusterSelectPeerToAdd(t *testing.T) {
 			peers[id] = &lps{ts: ts}
 			s.nodeToInfo.Store(id, nodeInfo{})
 		}
-		for id := range observed {
+		var ops map[string]*lps
+		for id, ts := range observed {
+			if ops == nil {
+				ops = make(map[string]*lps, len(observed))
+			}
+			ops[id] = &lps{ts: ts}
 			s.nodeToInfo.Store(id, nodeInfo{})
 		}
-		return &raft{peers: peers, observed: observed}
+		return &raft{peers: peers, observed: ops}
 	}
 	selectFor := func(n *raft, candidates []string) string {
 		var current []*Peer
@@ -6177,7 +6177,7 @@ func TestJetStreamClusterParallelCreateRaftGroup(t *testing.T) {
 		go func() {
 			wg.Done()
 			defer finish.Done()
-			if n, rerr := sjs.createRaftGroup(acc.GetName(), rg, false, storage, pprofLabels{}); rerr == nil {
+			if n, rerr := sjs.createRaftGroup(acc.GetName(), rg, false, storage, false, pprofLabels{}); rerr == nil {
 				mu.Lock()
 				nodes = append(nodes, n)
 				mu.Unlock()
@@ -6279,7 +6279,7 @@ func TestJetStreamClusterParallelCreateRaftGroupHighConcurrency(t *testing.T) {
 			defer done.Done()
 			ready.Done()
 			<-start
-			n, rerr := sjs.createRaftGroup(acc.GetName(), rg, false, storage, pprofLabels{})
+			n, rerr := sjs.createRaftGroup(acc.GetName(), rg, false, storage, false, pprofLabels{})
 			mu.Lock()
 			nodes = append(nodes, n)
 			errs = append(errs, rerr)
@@ -6350,7 +6350,7 @@ func TestJetStreamClusterParallelCreateRaftGroupHAAssetsLimit(t *testing.T) {
 			defer done.Done()
 			ready.Done()
 			<-start
-			n, _ := sjs.createRaftGroup(acc.GetName(), rg, false, FileStorage, pprofLabels{})
+			n, _ := sjs.createRaftGroup(acc.GetName(), rg, false, FileStorage, false, pprofLabels{})
 			if n != nil {
 				mu.Lock()
 				nodes = append(nodes, n)
@@ -9034,3 +9034,984 @@ func TestJetStreamClusterStreamSnapshots(t *testing.T) {
 		})
 	}
 }
+
+func TestJetStreamClusterPartitionedStream(t *testing.T) {
+	c := createJetStreamClusterExplicit(t, "R3S", 3)
+	defer c.shutdown()
+
+	nc, js := jsClientConnect(t, c.randomServer())
+	defer nc.Close()
+
+	cfg := &StreamConfig{
+		Name:       "TEST",
+		Subjects:   []string{"foo.>"},
+		Storage:    FileStorage,
+		Replicas:   3,
+		Partitions: 3,
+	}
+	_, err := jsStreamCreate(t, nc, cfg)
+	require_NoError(t, err)
+	// Creating again is idempotent.
+	_, err = jsStreamCreate(t, nc, cfg)
+	require_NoError(t, err)
+	for i := range 3 {
+		c.waitOnStreamLeader(globalAccountName, partitionStreamName("TEST", i))
+	}
+
+	// Partitions can not be created, updated or deleted directly.
+	_, err = jsStreamCreate(t, nc, &StreamConfig{Name: "X", Subjects: []string{"x"}, Storage: FileStorage, Partitions: 3, Partition: 1})
+	require_Error(t, err, NewJSStreamPartitionOperationError())
+	pcfg := cfg.partitionConfig(1)
+	pcfg.Description = "partition"
+	_, err = jsStreamUpdate(t, nc, pcfg)
+	require_Error(t, err, NewJSStreamPartitionOperationError())
+	require_Error(t, js.DeleteStream("TEST#1"), NewJSStreamPartitionOperationError())
+	// Partitioning can not be changed.
+	ucfg := *cfg
+	ucfg.Partitions = 4
+	_, err = jsStreamUpdate(t, nc, &ucfg)
+	require_Error(t, err, errors.New("can not change partitions"))
+	ucfg = *cfg
+	ucfg.Partition = 1
+	_, err = jsStreamUpdate(t, nc, &ucfg)
+	require_Error(t, err, NewJSStreamPartitionOperationError())
+
+	// Subscribe before creating the consumer, so its partitions all deliver to us.
+	sub, err := nc.SubscribeSync("deliver")
+	require_NoError(t, err)
+	defer sub.Unsubscribe()
+	_, err = js.AddConsumer("TEST", &nats.ConsumerConfig{Durable: "C", DeliverSubject: "deliver", AckPolicy: nats.AckNonePolicy})
+	require_NoError(t, err)
+	for i := range 3 {
+		c.waitOnConsumerLeader(globalAccountName, partitionStreamName("TEST", i), "C")
+	}
+
+	// Every message is stored by exactly one partition.
+	const numMsgs, numSubjects = 120, 12
+	streams := make(map[string]int)
+	for i := range numMsgs {
+		pa, err := js.Publish(fmt.Sprintf("foo.%d", i%numSubjects), []byte(strconv.Itoa(i)))
+		require_NoError(t, err)
+		streams[pa.Stream]++
+	}
+	require_Len(t, len(streams), 3)
+
+	// Messages from all partitions are delivered, in order for each partition.
+	last := make(map[string]int)
+	for range numMsgs {
+		m, err := sub.NextMsg(2 * time.Second)
+		require_NoError(t, err)
+		n, err := strconv.Atoi(string(m.Data))
+		require_NoError(t, err)
+		if l, ok := last[m.Subject]; ok && n <= l {
+			t.Fatalf("Expected message %d on %q after %d", n, m.Subject, l)
+		}
+		last[m.Subject] = n
+	}
+	require_Len(t, len(last), numSubjects)
+
+	// Only the first partition receives the messages on the stream subjects, the others
+	// only those routed to them.
+	for i := range 3 {
+		sl := c.streamLeader(globalAccountName, partitionStreamName("TEST", i))
+		mset, err := sl.globalAccount().lookupStream(partitionStreamName("TEST", i))
+		require_NoError(t, err)
+		mset.mu.RLock()
+		subjects := mset.ingestSubjects(&mset.cfg)
+		mset.mu.RUnlock()
+		if i == 0 {
+			require_Equal(t, strings.Join(subjects, ","), "foo.>")
+		} else {
+			require_Equal(t, strings.Join(subjects, ","), fmt.Sprintf("$JS.PART.TEST.%d.>", i))
+		}
+	}
+
+	// Pull requests are served by all partitions.
+	psub, err := js.PullSubscribe(_EMPTY_, "P", nats.BindStream("TEST"), nats.AckExplicit())
+	require_NoError(t, err)
+	defer psub.Unsubscribe()
+	for i := range 3 {
+		c.waitOnConsumerLeader(globalAccountName, partitionStreamName("TEST", i), "P")
+	}
+	pulled := make(map[string]int)
+	for len(pulled) < numMsgs {
+		msgs, err := psub.Fetch(numMsgs, nats.MaxWait(2*time.Second))
+		require_NoError(t, err)
+		for _, m := range msgs {
+			pulled[string(m.Data)]++
+			require_NoError(t, m.AckSync())
+		}
+	}
+	require_Len(t, len(pulled), numMsgs)
+	for data, n := range pulled {
+		if n != 1 {
+			t.Fatalf("Expected message %s to be pulled once, got %d", data, n)
+		}
+	}
+
+	// Stream info aggregates the state of all partitions.
+	rmsg, err := nc.Request(fmt.Sprintf(JSApiStreamInfoT, "TEST"), nil, 5*time.Second)
+	require_NoError(t, err)
+	var resp JSApiStreamInfoResponse
+	require_NoError(t, json.Unmarshal(rmsg.Data, &resp))
+	require_True(t, resp.Error == nil)
+	require_Equal(t, resp.State.Msgs, numMsgs)
+	require_Equal(t, resp.State.NumSubjects, numSubjects)
+	require_Len(t, len(resp.Partitions), 3)
+	for i, pi := range resp.Partitions {
+		require_Equal(t, pi.Name, partitionStreamName("TEST", i))
+		require_Equal(t, pi.State.Msgs, uint64(streams[pi.Name]))
+		require_NotNil(t, pi.Cluster)
+	}
+
+	// A pull request is split across the partitions, so never gets more messages than asked for.
+	for i := range 30 {
+		_, err = js.Publish(fmt.Sprintf("foo.%d", i%numSubjects), []byte(strconv.Itoa(numMsgs+i)))
+		require_NoError(t, err)
+	}
+	inbox := nats.NewInbox()
+	rsub, err := nc.SubscribeSync(inbox)
+	require_NoError(t, err)
+	defer rsub.Unsubscribe()
+	req := fmt.Sprintf(`{"batch":4,"expires":%d}`, time.Second)
+	require_NoError(t, nc.PublishRequest(fmt.Sprintf(JSApiRequestNextT, "TEST", "P"), inbox, []byte(req)))
+	var received, statuses int
+	for {
+		m, err := rsub.NextMsg(2 * time.Second)
+		if err == nats.ErrTimeout {
+			break
+		}
+		require_NoError(t, err)
+		if m.Header.Get("Status") != _EMPTY_ {
+			statuses++
+			continue
+		}
+		received++
+		require_NoError(t, m.AckSync())
+	}
+	require_Equal(t, received, 4)
+	require_Equal(t, statuses, 0)
+
+	// Updates apply to all partitions.
+	ucfg = *cfg
+	ucfg.Description = "partitioned"
+	_, err = jsStreamUpdate(t, nc, &ucfg)
+	require_NoError(t, err)
+	checkFor(t, 2*time.Second, 100*time.Millisecond, func() error {
+		for i := range 3 {
+			si, err := js.StreamInfo(partitionStreamName("TEST", i))
+			if err != nil {
+				return err
+			}
+			if si.Config.Description != "partitioned" {
+				return fmt.Errorf("expected partition %d to be updated", i)
+			}
+		}
+		return nil
+	})
+	// But they can't be scaled.
+	ucfg.Replicas = 1
+	_, err = jsStreamUpdate(t, nc, &ucfg)
+	require_Error(t, err, errors.New("partitioned streams can not be moved or scaled"))
+
+	// Deleting the consumer deletes it from all partitions.
+	require_NoError(t, js.DeleteConsumer("TEST", "C"))
+	checkFor(t, 2*time.Second, 100*time.Millisecond, func() error {
+		for i := range 3 {
+			if _, err := js.ConsumerInfo(partitionStreamName("TEST", i), "C"); err == nil {
+				return fmt.Errorf("expected consumer to be deleted from partition %d", i)
+			}
+		}
+		return nil
+	})
+
+	// Deleting the stream deletes all partitions.
+	require_NoError(t, js.DeleteStream("TEST"))
+	checkFor(t, 2*time.Second, 100*time.Millisecond, func() error {
+		for i := range 3 {
+			if _, err := js.StreamInfo(partitionStreamName("TEST", i)); err == nil {
+				return fmt.Errorf("expected partition %d to be deleted", i)
+			}
+		}
+		return nil
+	})
+}
+
+func TestJetStreamClusterDirectGetMinLastSeq(t *testing.T) {
+	c := createJetStreamClusterExplicit(t, "R3S", 3)
+	defer c.shutdown()
+
+	nc, js := jsClientConnect(t, c.randomServer())
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{
+		Name:        "TEST",
+		Subjects:    []string{"foo"},
+		Replicas:    3,
+		AllowDirect: true,
+	})
+	require_NoError(t, err)
+	_, err = js.Publish("foo", []byte("1"))
+	require_NoError(t, err)
+	c.waitOnAllCurrent()
+
+	// Only have a single follower serve direct gets.
+	fs := c.randomNonStreamLeader(globalAccountName, "TEST")
+	mset, err := fs.globalAccount().lookupStream("TEST")
+	require_NoError(t, err)
+	for _, s := range c.servers {
+		smset, err := s.globalAccount().lookupStream("TEST")
+		require_NoError(t, err)
+		checkFor(t, 5*time.Second, 100*time.Millisecond, func() error {
+			smset.mu.Lock()
+			defer smset.mu.Unlock()
+			if smset.directSub == nil {
+				return errors.New("not serving direct gets yet")
+			}
+			if s != fs {
+				smset.unsubscribeToDirect()
+			}
+			return nil
+		})
+	}
+	getSubj := fmt.Sprintf(JSDirectMsgGetT, "TEST")
+	checkFor(t, 5*time.Second, 100*time.Millisecond, func() error {
+		if r := fs.globalAccount().sl.Match(getSubj); len(r.qsubs) != 1 || len(r.qsubs[0]) != 1 {
+			return errors.New("other replicas still serving direct gets")
+		}
+		return nil
+	})
+	fnc := natsConnect(t, fs.ClientURL())
+	defer fnc.Close()
+
+	getMsg := func(req *JSApiMsgGetRequest) *nats.Msg {
+		t.Helper()
+		b, err := json.Marshal(req)
+		require_NoError(t, err)
+		m, err := fnc.Request(getSubj, b, 2*time.Second)
+		require_NoError(t, err)
+		return m
+	}
+
+	// Hold back the follower, so it is behind on the PubAck we get.
+	require_NoError(t, mset.raftNode().PauseApply())
+	pa, err := js.Publish("foo", []byte("2"))
+	require_NoError(t, err)
+	require_Equal(t, pa.Sequence, 2)
+
+	// Without a minimum last sequence the follower serves a stale read.
+	m := getMsg(&JSApiMsgGetRequest{LastFor: "foo"})
+	require_Equal(t, m.Header.Get(JSSequence), "1")
+
+	// The follower waits, and forwards the request to the leader.
+	m = getMsg(&JSApiMsgGetRequest{LastFor: "foo", MinLastSeq: pa.Sequence})
+	require_Equal(t, m.Header.Get(JSSequence), "2")
+	require_Equal(t, string(m.Data), "2")
+	m = getMsg(&JSApiMsgGetRequest{Seq: 2, MinLastSeq: pa.Sequence})
+	require_Equal(t, string(m.Data), "2")
+
+	// The follower serves the request once it applied the sequence.
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		mset.raftNode().ResumeApply()
+	}()
+	m = getMsg(&JSApiMsgGetRequest{LastFor: "foo", MinLastSeq: pa.Sequence})
+	require_Equal(t, m.Header.Get(JSSequence), "2")
+	mset.dgwMu.Lock()
+	waits := len(mset.dgWaits)
+	mset.dgwMu.Unlock()
+	require_Equal(t, waits, 0)
+
+	// Nobody applied this sequence yet.
+	m = getMsg(&JSApiMsgGetRequest{LastFor: "foo", MinLastSeq: 100})
+	require_Equal(t, m.Header.Get("Status"), "412")
+
+	// Waiting requests are also served once the sequence comes in through catchup.
+	require_NoError(t, mset.raftNode().PauseApply())
+	pa, err = js.Publish("foo", []byte("3"))
+	require_NoError(t, err)
+	require_Equal(t, pa.Sequence, 3)
+	start := time.Now()
+	errCh := make(chan error, 1)
+	go func() {
+		for mset.dgWaiting.Load() == 0 {
+			time.Sleep(5 * time.Millisecond)
+		}
+		_, err := mset.processCatchupMsg(encodeStreamMsg("foo", _EMPTY_, nil, []byte("3"), 3, time.Now().UnixNano(), false))
+		errCh <- err
+	}()
+	m = getMsg(&JSApiMsgGetRequest{LastFor: "foo", MinLastSeq: pa.Sequence})
+	require_Equal(t, m.Header.Get(JSSequence), "3")
+	require_LessThan(t, time.Since(start), directGetMinSeqWait)
+	require_NoError(t, <-errCh)
+}
+
+func TestJetStreamClusterStreamLinearizableReads(t *testing.T) {
+	c := createJetStreamClusterExplicit(t, "R3S", 3)
+	defer c.shutdown()
+
+	nc, js := jsClientConnect(t, c.randomServer())
+	defer nc.Close()
+
+	cfg := &StreamConfig{
+		Name:              "TEST",
+		Subjects:          []string{"foo"},
+		Storage:           FileStorage,
+		Replicas:          3,
+		LinearizableReads: true,
+	}
+	_, err := jsStreamCreate(t, nc, cfg)
+	require_NoError(t, err)
+	c.waitOnStreamLeader(globalAccountName, "TEST")
+
+	pa, err := js.Publish("foo", []byte("1"))
+	require_NoError(t, err)
+
+	si, err := js.StreamInfo("TEST")
+	require_NoError(t, err)
+	require_Equal(t, si.State.Msgs, 1)
+	m, err := js.GetMsg("TEST", pa.Sequence)
+	require_NoError(t, err)
+	require_Equal(t, string(m.Data), "1")
+
+	// The reads were served under a leader lease, only enabled for this stream.
+	sl := c.streamLeader(globalAccountName, "TEST")
+	mset, err := sl.globalAccount().lookupStream("TEST")
+	require_NoError(t, err)
+	require_True(t, mset.raftNode().Lease())
+	for _, s := range c.servers {
+		if s == sl {
+			continue
+		}
+		mset, err = s.globalAccount().lookupStream("TEST")
+		require_NoError(t, err)
+		require_False(t, mset.raftNode().Lease())
+	}
+
+	// Can't be changed on update.
+	cfg.LinearizableReads = false
+	_, err = jsStreamUpdate(t, nc, cfg)
+	require_Error(t, err, NewJSStreamInvalidConfigError(errors.New("stream configuration update can not change linearizable reads")))
+}
+
+func TestJetStreamClusterStreamLearners(t *testing.T) {
+	c := createJetStreamClusterExplicit(t, "R5S", 5)
+	defer c.shutdown()
+
+	nc, js := jsClientConnect(t, c.randomServer())
+	defer nc.Close()
+
+	// Learners need a replicated stream with limits retention.
+	cfg := &StreamConfig{Name: "TEST", Subjects: []string{"foo"}, Storage: FileStorage, Replicas: 1, Learners: 1}
+	_, err := jsStreamCreate(t, nc, cfg)
+	require_Error(t, err, NewJSStreamInvalidConfigError(errors.New("learners require a replicated stream")))
+	cfg.Replicas, cfg.Retention = 3, WorkQueuePolicy
+	_, err = jsStreamCreate(t, nc, cfg)
+	require_Error(t, err, NewJSStreamInvalidConfigError(errors.New("learners require limits retention")))
+
+	cfg.Retention, cfg.AllowDirect = LimitsPolicy, true
+	_, err = jsStreamCreate(t, nc, cfg)
+	require_NoError(t, err)
+	c.waitOnStreamLeader(globalAccountName, "TEST")
+
+	streamInfo := func() *StreamInfo {
+		t.Helper()
+		resp, err := nc.Request(fmt.Sprintf(JSApiStreamInfoT, "TEST"), nil, time.Second)
+		require_NoError(t, err)
+		var si JSApiStreamInfoResponse
+		require_NoError(t, json.Unmarshal(resp.Data, &si))
+		require_True(t, si.Error == nil)
+		return si.StreamInfo
+	}
+
+	// The learner is reported apart from the replicas.
+	var learner string
+	checkFor(t, 5*time.Second, 100*time.Millisecond, func() error {
+		ci := streamInfo().Cluster
+		if len(ci.Learners) != 1 || !ci.Learners[0].Current {
+			return fmt.Errorf("expected a current learner, got %+v", ci.Learners)
+		}
+		learner = ci.Learners[0].Name
+		if len(ci.Replicas) != 2 {
+			return fmt.Errorf("expected 2 replicas, got %d", len(ci.Replicas))
+		}
+		return nil
+	})
+	ci := streamInfo().Cluster
+	require_NotEqual(t, ci.Leader, learner)
+	for _, r := range ci.Replicas {
+		require_NotEqual(t, r.Name, learner)
+	}
+
+	// The learner follows the log, and serves direct gets, without being a peer.
+	for range 10 {
+		_, err = js.Publish("foo", []byte("ok"))
+		require_NoError(t, err)
+	}
+	ls := c.serverByName(learner)
+	lmset, err := ls.globalAccount().lookupStream("TEST")
+	require_NoError(t, err)
+	checkFor(t, 5*time.Second, 100*time.Millisecond, func() error {
+		if msgs := lmset.state().Msgs; msgs != 10 {
+			return fmt.Errorf("expected 10 messages on learner, got %d", msgs)
+		}
+		lmset.mu.RLock()
+		defer lmset.mu.RUnlock()
+		if lmset.directSub == nil {
+			return errors.New("learner not serving direct gets yet")
+		}
+		return nil
+	})
+	sl := c.streamLeader(globalAccountName, "TEST")
+	mset, err := sl.globalAccount().lookupStream("TEST")
+	require_NoError(t, err)
+	for _, p := range mset.raftNode().Peers() {
+		require_NotEqual(t, p.ID, ls.NodeName())
+	}
+
+	// The learner doesn't count towards quorum, so with a follower and
+	// the learner down writes still go through.
+	fs := c.randomNonStreamLeader(globalAccountName, "TEST")
+	for fs == ls {
+		fs = c.randomNonStreamLeader(globalAccountName, "TEST")
+	}
+	// Stay connected to the leader while the others are down.
+	nc.Close()
+	nc, js = jsClientConnect(t, sl)
+	defer nc.Close()
+	fs.Shutdown()
+	ls.Shutdown()
+	_, err = js.Publish("foo", []byte("ok"))
+	require_NoError(t, err)
+	fs = c.restartServer(fs)
+	ls = c.restartServer(ls)
+	c.waitOnLeader()
+	c.waitOnStreamCurrent(fs, globalAccountName, "TEST")
+
+	// Only learners can be promoted.
+	promote := func(peer string) *ApiError {
+		t.Helper()
+		req, err := json.Marshal(&JSApiStreamPromotePeerRequest{Peer: peer})
+		require_NoError(t, err)
+		resp, err := nc.Request(fmt.Sprintf(JSApiStreamPromotePeerT, "TEST"), req, 2*time.Second)
+		require_NoError(t, err)
+		var ppResp JSApiStreamPromotePeerResponse
+		require_NoError(t, json.Unmarshal(resp.Data, &ppResp))
+		require_Equal(t, ppResp.Success, ppResp.Error == nil)
+		return ppResp.Error
+	}
+	require_Error(t, promote(sl.Name()), NewJSClusterPeerNotLearnerError())
+
+	// Promoting the learner scales the stream up with it as a voting replica.
+	require_True(t, promote(learner) == nil)
+	checkFor(t, 20*time.Second, 250*time.Millisecond, func() error {
+		si := streamInfo()
+		if si.Config.Replicas != 4 || si.Config.Learners != 0 {
+			return fmt.Errorf("expected R4 without learners, got R%d with %d learners", si.Config.Replicas, si.Config.Learners)
+		}
+		if len(si.Cluster.Learners) != 0 {
+			return fmt.Errorf("expected no learners, got %d", len(si.Cluster.Learners))
+		}
+		names := []string{si.Cluster.Leader}
+		for _, r := range si.Cluster.Replicas {
+			if !r.Current {
+				return fmt.Errorf("replica %q not current", r.Name)
+			}
+			names = append(names, r.Name)
+		}
+		if len(names) != 4 || !slices.Contains(names, learner) {
+			return fmt.Errorf("expected learner in replicas, got %v", names)
+		}
+		return nil
+	})
+	c.waitOnStreamLeader(globalAccountName, "TEST")
+	sl = c.streamLeader(globalAccountName, "TEST")
+	mset, err = sl.globalAccount().lookupStream("TEST")
+	require_NoError(t, err)
+	checkFor(t, 5*time.Second, 100*time.Millisecond, func() error {
+		if peers := mset.raftNode().Peers(); len(peers) != 4 {
+			return fmt.Errorf("expected 4 peers, got %d", len(peers))
+		}
+		return nil
+	})
+	sa := mset.streamAssignment()
+	require_Len(t, len(sa.Group.Learners), 0)
+	require_True(t, sa.Group.isMember(ls.NodeName()))
+}
+
+func TestJetStreamClusterSimScenarios(t *testing.T) {
+	runSimScenarios(t, func(t *testing.T, seed int64) {
+		sim := newRaftSim(seed)
+		defer sim.stop()
+		c := createJetStreamClusterSim(t, sim, "R3S", 3)
+		defer c.shutdown()
+
+		nc, js := jsClientConnect(t, c.randomServer())
+		defer nc.Close()
+
+		_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}, Replicas: 3})
+		require_NoError(t, err)
+		_, err = js.AddConsumer("TEST", &nats.ConsumerConfig{Durable: "C", AckPolicy: nats.AckExplicitPolicy})
+		require_NoError(t, err)
+		sub, err := js.PullSubscribe("foo", "C", nats.Bind("TEST", "C"))
+		require_NoError(t, err)
+
+		w := watchLeaders(func() []RaftNode { return jsRaftNodes(c.servers) })
+		rng := rand.New(rand.NewSource(seed))
+		ids := serverPeerNames(c.servers)
+		for round := range 3 {
+			t.Logf("Round %d: %s", round, randomSimFault(sim, rng, ids))
+			// Errors are expected while faults are active.
+			for deadline := time.Now().Add(time.Duration(500+rng.Intn(2000)) * time.Millisecond); time.Now().Before(deadline); {
+				js.Publish("foo", nil, nats.AckWait(250*time.Millisecond))
+				msgs, _ := sub.Fetch(1, nats.MaxWait(50*time.Millisecond))
+				for _, msg := range msgs {
+					msg.AckSync(nats.AckWait(250 * time.Millisecond))
+				}
+			}
+			healSim(sim)
+		}
+
+		// Once healed, all replicas must end up with the same state.
+		c.waitOnStreamLeader(globalAccountName, "TEST")
+		c.waitOnConsumerLeader(globalAccountName, "TEST", "C")
+		checkFor(t, 10*time.Second, 250*time.Millisecond, func() error {
+			_, err := js.Publish("foo", nil)
+			return err
+		})
+		checkFor(t, 10*time.Second, 100*time.Millisecond, func() error {
+			var sstate *StreamState
+			var dstate *ConsumerState
+			for _, s := range c.servers {
+				mset, err := s.globalAccount().lookupStream("TEST")
+				if err != nil {
+					return err
+				}
+				state := mset.state()
+				if sstate == nil {
+					sstate = &state
+				} else if state.Msgs != sstate.Msgs || state.FirstSeq != sstate.FirstSeq || state.LastSeq != sstate.LastSeq {
+					return fmt.Errorf("stream state on %s differs: %+v vs %+v", s, state, *sstate)
+				}
+				o := mset.lookupConsumer("C")
+				if o == nil {
+					return fmt.Errorf("consumer not found on %s", s)
+				}
+				cstate, err := o.store.State()
+				if err != nil {
+					return err
+				}
+				if dstate == nil {
+					dstate = cstate
+				} else if cstate.Delivered != dstate.Delivered || cstate.AckFloor != dstate.AckFloor {
+					return fmt.Errorf("consumer state on %s differs: %+v vs %+v", s, cstate, dstate)
+				}
+			}
+			return nil
+		})
+		require_NoError(t, w.stop())
+	})
+}
+
+func TestJetStreamClusterScrubRepairsCorruptReplica(t *testing.T) {
+	c := createJetStreamClusterExplicit(t, "R3S", 3)
+	defer c.shutdown()
+
+	nc, js := jsClientConnect(t, c.randomServer())
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}, Storage: nats.FileStorage, Replicas: 3})
+	require_NoError(t, err)
+	c.waitOnStreamLeader(globalAccountName, "TEST")
+
+	for range 100 {
+		_, err = js.Publish("foo", []byte("ok"))
+		require_NoError(t, err)
+	}
+	c.waitOnAllCurrent()
+
+	// Seal the block on a follower, and corrupt it on disk.
+	rs := c.randomNonStreamLeader(globalAccountName, "TEST")
+	mset, err := rs.globalAccount().lookupStream("TEST")
+	require_NoError(t, err)
+	fs := mset.store.(*fileStore)
+	fs.mu.Lock()
+	_, err = fs.newMsgBlockForWrite()
+	mb := fs.blks[0]
+	fs.mu.Unlock()
+	require_NoError(t, err)
+	buf, err := os.ReadFile(mb.mfn)
+	require_NoError(t, err)
+	buf[len(buf)/2] ^= 0xff
+	require_NoError(t, os.WriteFile(mb.mfn, buf, defaultFilePerms))
+
+	snc, _ := jsClientConnect(t, rs, nats.UserInfo("admin", "s3cr3t!"))
+	defer snc.Close()
+	sub, err := snc.SubscribeSync(JSAdvisoryStoreCorruption)
+	require_NoError(t, err)
+	require_NoError(t, snc.Flush())
+
+	sjs := rs.getJetStream()
+	require_True(t, sjs.scrubPass(0))
+
+	msg, err := sub.NextMsg(time.Second)
+	require_NoError(t, err)
+	var adv JSStoreCorruptionAdvisory
+	require_NoError(t, json.Unmarshal(msg.Data, &adv))
+	require_Equal(t, adv.Type, JSStoreCorruptionAdvisoryType)
+	require_Equal(t, adv.Server, rs.Name())
+	require_Equal(t, adv.Stream, "TEST")
+	require_Equal(t, adv.Group, _EMPTY_)
+	require_Equal(t, adv.Block, mb.index)
+	require_True(t, adv.Repaired)
+
+	jsz, err := rs.Jsz(nil)
+	require_NoError(t, err)
+	require_NotNil(t, jsz.Scrub)
+	require_Equal(t, jsz.Scrub.Passes, 1)
+	require_Equal(t, jsz.Scrub.Corrupt, 1)
+	require_Equal(t, jsz.Scrub.Repaired, 1)
+	require_Len(t, len(jsz.Scrub.Findings), 1)
+	require_Equal(t, jsz.Scrub.Findings[0].Stream, "TEST")
+
+	// The replica gets the messages back from the leader.
+	checkFor(t, 10*time.Second, 200*time.Millisecond, func() error {
+		mset, err := rs.globalAccount().lookupStream("TEST")
+		if err != nil {
+			return err
+		}
+		if state := mset.state(); state.Msgs != 100 {
+			return fmt.Errorf("expected 100 msgs, got %d", state.Msgs)
+		}
+		return nil
+	})
+
+	// And the next pass is clean.
+	require_True(t, sjs.scrubPass(0))
+	jsz, err = rs.Jsz(nil)
+	require_NoError(t, err)
+	require_Equal(t, jsz.Scrub.Passes, 2)
+	require_Equal(t, jsz.Scrub.Corrupt, 1)
+}
+
+func TestJetStreamClusterScrubLeaderStepsDownBeforeRepair(t *testing.T) {
+	c := createJetStreamClusterExplicit(t, "R3S", 3)
+	defer c.shutdown()
+
+	nc, js := jsClientConnect(t, c.randomServer())
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}, Storage: nats.FileStorage, Replicas: 3})
+	require_NoError(t, err)
+	c.waitOnStreamLeader(globalAccountName, "TEST")
+
+	for range 100 {
+		_, err = js.Publish("foo", []byte("ok"))
+		require_NoError(t, err)
+	}
+	c.waitOnAllCurrent()
+
+	// Seal the block on the leader, and corrupt it on disk.
+	sl := c.streamLeader(globalAccountName, "TEST")
+	mset, err := sl.globalAccount().lookupStream("TEST")
+	require_NoError(t, err)
+	fs := mset.store.(*fileStore)
+	fs.mu.Lock()
+	_, err = fs.newMsgBlockForWrite()
+	mb := fs.blks[0]
+	fs.mu.Unlock()
+	require_NoError(t, err)
+	buf, err := os.ReadFile(mb.mfn)
+	require_NoError(t, err)
+	buf[len(buf)/2] ^= 0xff
+	require_NoError(t, os.WriteFile(mb.mfn, buf, defaultFilePerms))
+
+	// The leader doesn't reset itself, but hands off leadership.
+	sjs := sl.getJetStream()
+	require_True(t, sjs.scrubPass(0))
+	jsz, err := sl.Jsz(nil)
+	require_NoError(t, err)
+	require_Equal(t, jsz.Scrub.Corrupt, 1)
+	require_Equal(t, jsz.Scrub.Repaired, 0)
+	require_Equal(t, mset.state().Msgs, 100)
+
+	c.waitOnStreamLeader(globalAccountName, "TEST")
+	require_NotEqual(t, c.streamLeader(globalAccountName, "TEST"), sl)
+
+	// Now as a follower, it is repaired by the new leader.
+	checkFor(t, 10*time.Second, 200*time.Millisecond, func() error {
+		if !mset.raftNode().Current() {
+			return errors.New("not current yet")
+		}
+		return nil
+	})
+	require_True(t, sjs.scrubPass(0))
+	jsz, err = sl.Jsz(nil)
+	require_NoError(t, err)
+	require_Equal(t, jsz.Scrub.Corrupt, 2)
+	require_Equal(t, jsz.Scrub.Repaired, 1)
+
+	checkFor(t, 10*time.Second, 200*time.Millisecond, func() error {
+		mset, err := sl.globalAccount().lookupStream("TEST")
+		if err != nil {
+			return err
+		}
+		if state := mset.state(); state.Msgs != 100 {
+			return fmt.Errorf("expected 100 msgs, got %d", state.Msgs)
+		}
+		return nil
+	})
+}
+
+func TestJetStreamClusterScrubRepairsCorruptConsumerLog(t *testing.T) {
+	c := createJetStreamClusterExplicit(t, "R3S", 3)
+	defer c.shutdown()
+
+	nc, js := jsClientConnect(t, c.randomServer())
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}, Storage: nats.FileStorage, Replicas: 3})
+	require_NoError(t, err)
+	c.waitOnStreamLeader(globalAccountName, "TEST")
+	_, err = js.AddConsumer("TEST", &nats.ConsumerConfig{Durable: "C", AckPolicy: nats.AckExplicitPolicy, Replicas: 3})
+	require_NoError(t, err)
+	c.waitOnConsumerLeader(globalAccountName, "TEST", "C")
+
+	for range 10 {
+		_, err = js.Publish("foo", []byte("ok"))
+		require_NoError(t, err)
+	}
+	sub, err := js.PullSubscribe("foo", "C")
+	require_NoError(t, err)
+	msgs, err := sub.Fetch(10)
+	require_NoError(t, err)
+	for _, m := range msgs {
+		require_NoError(t, m.AckSync())
+	}
+	c.waitOnAllCurrent()
+
+	// Seal the block of the consumer's Raft log on a follower, and corrupt it on disk.
+	rs := c.randomNonConsumerLeader(globalAccountName, "TEST", "C")
+	mset, err := rs.globalAccount().lookupStream("TEST")
+	require_NoError(t, err)
+	o := mset.lookupConsumer("C")
+	require_NotNil(t, o)
+	fs := o.raftNode().(*raft).wal.(*fileStore)
+	fs.mu.Lock()
+	_, err = fs.newMsgBlockForWrite()
+	mb := fs.blks[0]
+	fs.mu.Unlock()
+	require_NoError(t, err)
+	buf, err := os.ReadFile(mb.mfn)
+	require_NoError(t, err)
+	buf[len(buf)/2] ^= 0xff
+	require_NoError(t, os.WriteFile(mb.mfn, buf, defaultFilePerms))
+
+	sjs := rs.getJetStream()
+	require_True(t, sjs.scrubPass(0))
+	jsz, err := rs.Jsz(nil)
+	require_NoError(t, err)
+	require_Equal(t, jsz.Scrub.Corrupt, 1)
+	require_Equal(t, jsz.Scrub.Repaired, 1)
+	require_Len(t, len(jsz.Scrub.Findings), 1)
+	require_Equal(t, jsz.Scrub.Findings[0].Consumer, "C")
+	require_True(t, jsz.Scrub.Findings[0].Repaired)
+
+	// The replica is caught up by the leader, with the consumer state intact.
+	checkFor(t, 10*time.Second, 200*time.Millisecond, func() error {
+		if !o.raftNode().Current() {
+			return errors.New("not current yet")
+		}
+		state, err := o.store.State()
+		if err != nil {
+			return err
+		}
+		if state.AckFloor.Stream != 10 {
+			return fmt.Errorf("expected ack floor 10, got %d", state.AckFloor.Stream)
+		}
+		return nil
+	})
+
+	// And the next pass is clean.
+	require_True(t, sjs.scrubPass(0))
+	jsz, err = rs.Jsz(nil)
+	require_NoError(t, err)
+	require_Equal(t, jsz.Scrub.Corrupt, 1)
+}
+
+func TestJetStreamClusterCompactionProposedByLeader(t *testing.T) {
+	c := createJetStreamClusterExplicit(t, "R3S", 3)
+	defer c.shutdown()
+
+	nc, js := jsClientConnect(t, c.randomServer())
+	defer nc.Close()
+
+	_, err := jsStreamCreate(t, nc, &StreamConfig{
+		Name:       "TEST",
+		Subjects:   []string{"foo.*"},
+		Storage:    FileStorage,
+		Replicas:   3,
+		Compaction: &StreamCompaction{DirtyAge: 100 * time.Millisecond},
+	})
+	require_NoError(t, err)
+	c.waitOnStreamLeader(globalAccountName, "TEST")
+	sl := c.streamLeader(globalAccountName, "TEST")
+
+	// Publishes and waits for all replicas to store the messages.
+	publish := func(seq uint64) {
+		t.Helper()
+		for i := range 10 {
+			_, err := js.Publish(fmt.Sprintf("foo.%d", i%5), nil)
+			require_NoError(t, err)
+		}
+		checkFor(t, 5*time.Second, 100*time.Millisecond, func() error {
+			for _, s := range c.servers {
+				mset, err := s.globalAccount().lookupStream("TEST")
+				if err != nil {
+					return err
+				}
+				if lseq := mset.lastSeq(); lseq != seq {
+					return fmt.Errorf("expected last seq %d, got %d", seq, lseq)
+				}
+			}
+			return nil
+		})
+	}
+	// Seals the last block, on the leader only or on all replicas.
+	seal := func(leader bool) {
+		t.Helper()
+		for _, s := range c.servers {
+			if (s == sl) != leader {
+				continue
+			}
+			mset, err := s.globalAccount().lookupStream("TEST")
+			require_NoError(t, err)
+			fs := mset.store.(*fileStore)
+			fs.mu.Lock()
+			_, err = fs.newMsgBlockForWrite()
+			fs.mu.Unlock()
+			require_NoError(t, err)
+		}
+	}
+
+	// Blocks end at different sequences on the replicas.
+	publish(10)
+	seal(false)
+	publish(20)
+	seal(false)
+	seal(true)
+	_, err = js.Publish("foo.0", nil)
+	require_NoError(t, err)
+
+	// All replicas removed the same messages.
+	checkFor(t, 10*time.Second, 200*time.Millisecond, func() error {
+		for _, s := range c.servers {
+			mset, err := s.globalAccount().lookupStream("TEST")
+			if err != nil {
+				return err
+			}
+			var seqs []uint64
+			var smv StoreMsg
+			for seq := uint64(1); seq <= 21; seq++ {
+				if _, err := mset.store.LoadMsg(seq, &smv); err == nil {
+					seqs = append(seqs, seq)
+				}
+			}
+			if !slices.Equal(seqs, []uint64{17, 18, 19, 20, 21}) {
+				return fmt.Errorf("unexpected msgs on %s: %v", s, seqs)
+			}
+		}
+		return nil
+	})
+}
+
+func TestJetStreamClusterStreamViewsSnapshotAndExpiry(t *testing.T) {
+	c := createJetStreamClusterExplicit(t, "R3S", 3)
+	defer c.shutdown()
+
+	nc, js := jsClientConnect(t, c.randomServer())
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{
+		Name:     "TEST",
+		Subjects: []string{"foo"},
+		Replicas: 3,
+	})
+	require_NoError(t, err)
+	for range 5 {
+		_, err = js.Publish("foo", nil)
+		require_NoError(t, err)
+	}
+
+	createView := func(ttl time.Duration) string {
+		t.Helper()
+		b, err := json.Marshal(JSApiStreamViewCreateRequest{TTL: ttl})
+		require_NoError(t, err)
+		msg, err := nc.Request(fmt.Sprintf(JSApiStreamViewCreateT, "TEST"), b, 2*time.Second)
+		require_NoError(t, err)
+		var resp JSApiStreamViewCreateResponse
+		require_NoError(t, json.Unmarshal(msg.Data, &resp))
+		require_True(t, resp.Error == nil)
+		return resp.ID
+	}
+	checkViews := func(ids ...string) {
+		t.Helper()
+		checkFor(t, 5*time.Second, 100*time.Millisecond, func() error {
+			for _, s := range c.servers {
+				mset, err := s.globalAccount().lookupStream("TEST")
+				if err != nil {
+					return err
+				}
+				views := mset.viewInfos()
+				if len(views) != len(ids) {
+					return fmt.Errorf("expected %d views on %s, got %d", len(ids), s, len(views))
+				}
+				for _, id := range ids {
+					if _, ok := mset.lookupView(id); !ok {
+						return fmt.Errorf("view %q not found on %s", id, s)
+					}
+				}
+			}
+			return nil
+		})
+	}
+
+	view := createView(time.Minute)
+	checkViews(view)
+
+	// Views are part of the stream snapshot.
+	sl := c.streamLeader(globalAccountName, "TEST")
+	mset, err := sl.globalAccount().lookupStream("TEST")
+	require_NoError(t, err)
+	snap, err := decodeStreamSnapshot(mset.stateSnapshot())
+	require_NoError(t, err)
+	require_Len(t, len(snap.Views), 1)
+	require_Equal(t, snap.Views[0].ID, view)
+	require_Equal(t, snap.LastSeq, 5)
+
+	// A follower recovering from its snapshot still has the view.
+	rs := c.randomNonStreamLeader(globalAccountName, "TEST")
+	mset, err = rs.globalAccount().lookupStream("TEST")
+	require_NoError(t, err)
+	require_NoError(t, mset.raftNode().InstallSnapshot(mset.stateSnapshot(), true))
+	rs.Shutdown()
+	rs = c.restartServer(rs)
+	c.waitOnStreamCurrent(rs, globalAccountName, "TEST")
+	checkViews(view)
+
+	// Expiry is proposed by the leader, so all replicas remove the view.
+	expiring := createView(500 * time.Millisecond)
+	checkViews(view, expiring)
+	time.Sleep(500 * time.Millisecond)
+	checkViews(view)
+
+	// A new leader expires the views that are past due.
+	expiring = createView(500 * time.Millisecond)
+	checkViews(view, expiring)
+	sl = c.streamLeader(globalAccountName, "TEST")
+	sl.Shutdown()
+	c.waitOnStreamLeader(globalAccountName, "TEST")
+	sl = c.restartServer(sl)
+	c.waitOnStreamCurrent(sl, globalAccountName, "TEST")
+	checkViews(view)
+}
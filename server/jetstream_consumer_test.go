@@ -10685,6 +10685,42 @@ func TestWaitQueuePopAndRequeue(t *testing.T) {
 	})
 }
 
+func TestWaitQueueCountsPriorityGroups(t *testing.T) {
+	wq := newWaitQueue(10)
+	reqs := []waitingRequest{
+		{priorityGroup: &PriorityGroup{Group: "A"}, reply: "a1", n: 1},
+		{priorityGroup: &PriorityGroup{Group: "B"}, reply: "b1", n: 2},
+		{priorityGroup: &PriorityGroup{Group: "A"}, reply: "a2", n: 1},
+		{reply: "none", n: 1},
+	}
+	for i := range reqs {
+		require_NoError(t, wq.add(&reqs[i]))
+	}
+	require_Equal(t, wq.groups["A"], 2)
+	require_Equal(t, wq.groups["B"], 1)
+	require_Len(t, len(wq.groups), 2)
+
+	// Cycling and requeueing keeps the counts.
+	wq.cycle()
+	require_Equal(t, wq.peek().reply, "b1")
+	wq.pop()
+	require_Equal(t, wq.groups["B"], 1)
+
+	// Fully served requests are no longer counted.
+	for _, reply := range []string{"a2", "none", "a1", "b1"} {
+		require_Equal(t, wq.peek().reply, reply)
+		if reply == "none" {
+			wq.cycle()
+		} else {
+			wq.pop()
+		}
+	}
+	require_False(t, wq.hasGroup("A"))
+	require_False(t, wq.hasGroup("B"))
+	require_Len(t, len(wq.groups), 0)
+	require_Equal(t, wq.len(), 1)
+}
+
 func TestJetStreamConsumerPrioritized(t *testing.T) {
 
 	s := RunBasicJetStreamServer(t)
@@ -10878,6 +10914,178 @@ func TestJetStreamConsumerPrioritized(t *testing.T) {
 	})
 }
 
+func TestJetStreamConsumerWeightedConfig(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}})
+	require_NoError(t, err)
+
+	for _, test := range []struct {
+		name    string
+		policy  PriorityPolicy
+		groups  []string
+		weights map[string]int
+		errCode ErrorIdentifier
+	}{
+		{"missing weights", PriorityWeighted, []string{"A", "B"}, nil, JSConsumerInvalidPriorityWeightsErr},
+		{"missing group weight", PriorityWeighted, []string{"A", "B"}, map[string]int{"A": 1}, JSConsumerInvalidPriorityWeightsErr},
+		{"unknown group weight", PriorityWeighted, []string{"A"}, map[string]int{"A": 1, "B": 1}, JSConsumerInvalidPriorityWeightsErr},
+		{"zero weight", PriorityWeighted, []string{"A", "B"}, map[string]int{"A": 1, "B": 0}, JSConsumerInvalidPriorityWeightsErr},
+		{"not weighted", PriorityPrioritized, []string{"A"}, map[string]int{"A": 1}, JSConsumerPriorityWeightsWithoutPolicy},
+		{"no policy", PriorityNone, nil, map[string]int{"A": 1}, JSConsumerPriorityWeightsWithoutPolicy},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			req, err := json.Marshal(CreateConsumerRequest{
+				Stream: "TEST",
+				Config: ConsumerConfig{
+					Durable:         "C",
+					AckPolicy:       AckExplicit,
+					PriorityPolicy:  test.policy,
+					PriorityGroups:  test.groups,
+					PriorityWeights: test.weights,
+				},
+			})
+			require_NoError(t, err)
+			rmsg, err := nc.Request(fmt.Sprintf(JSApiDurableCreateT, "TEST", "C"), req, 5*time.Second)
+			require_NoError(t, err)
+			var resp JSApiConsumerCreateResponse
+			require_NoError(t, json.Unmarshal(rmsg.Data, &resp))
+			require_NotNil(t, resp.Error)
+			require_Equal(t, resp.Error.ErrCode, ApiErrors[test.errCode].ErrCode)
+		})
+	}
+}
+
+func TestJetStreamConsumerWeighted(t *testing.T) {
+	test := func(t *testing.T, s *Server, replicas int) {
+		nc, js := jsClientConnect(t, s)
+		defer nc.Close()
+
+		_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}, Replicas: replicas})
+		require_NoError(t, err)
+
+		weights := map[string]int{"A": 70, "B": 20, "C": 10}
+		req, err := json.Marshal(CreateConsumerRequest{
+			Stream: "TEST",
+			Config: ConsumerConfig{
+				Durable:         "C",
+				AckPolicy:       AckNone,
+				PriorityPolicy:  PriorityWeighted,
+				PriorityGroups:  []string{"A", "B", "C"},
+				PriorityWeights: weights,
+				Replicas:        replicas,
+			},
+		})
+		require_NoError(t, err)
+		rmsg, err := nc.Request(fmt.Sprintf(JSApiDurableCreateT, "TEST", "C"), req, 5*time.Second)
+		require_NoError(t, err)
+		var resp JSApiConsumerCreateResponse
+		require_NoError(t, json.Unmarshal(rmsg.Data, &resp))
+		require_True(t, resp.Error == nil)
+		require_Equal(t, resp.Config.PriorityPolicy, PriorityWeighted)
+		require_True(t, reflect.DeepEqual(resp.Config.PriorityWeights, weights))
+
+		consumerInfo := func(t *testing.T) *ConsumerInfo {
+			t.Helper()
+			rmsg, err := nc.Request(fmt.Sprintf(JSApiConsumerInfoT, "TEST", "C"), nil, 5*time.Second)
+			require_NoError(t, err)
+			var resp JSApiConsumerInfoResponse
+			require_NoError(t, json.Unmarshal(rmsg.Data, &resp))
+			require_True(t, resp.Error == nil)
+			return resp.ConsumerInfo
+		}
+
+		pull := func(t *testing.T, group string, batch int) *nats.Subscription {
+			t.Helper()
+			inbox := nats.NewInbox()
+			sub, err := nc.SubscribeSync(inbox)
+			require_NoError(t, err)
+			req, err := json.Marshal(JSApiConsumerGetNextRequest{
+				Batch:         batch,
+				Expires:       10 * time.Second,
+				PriorityGroup: PriorityGroup{Group: group},
+			})
+			require_NoError(t, err)
+			require_NoError(t, nc.PublishRequest(fmt.Sprintf(JSApiRequestNextT, "TEST", "C"), inbox, req))
+			return sub
+		}
+
+		waitForNWaiting := func(t *testing.T, n int) {
+			t.Helper()
+			checkFor(t, 2*time.Second, 10*time.Millisecond, func() error {
+				if got := consumerInfo(t).NumWaiting; got != n {
+					return fmt.Errorf("expected %d waiting requests, got %d", n, got)
+				}
+				return nil
+			})
+		}
+
+		received := func(t *testing.T, sub *nats.Subscription) int {
+			t.Helper()
+			n, _, err := sub.Pending()
+			require_NoError(t, err)
+			return n
+		}
+
+		publish := func(t *testing.T, n int) {
+			t.Helper()
+			for i := 0; i < n; i++ {
+				_, err := js.Publish("foo", nil)
+				require_NoError(t, err)
+			}
+		}
+
+		// All groups are waiting, each gets its share of the messages.
+		subA, subB, subC := pull(t, "A", 100), pull(t, "B", 100), pull(t, "C", 100)
+		waitForNWaiting(t, 3)
+		publish(t, 100)
+		checkFor(t, 2*time.Second, 10*time.Millisecond, func() error {
+			if a, b, c := received(t, subA), received(t, subB), received(t, subC); a != 70 || b != 20 || c != 10 {
+				return fmt.Errorf("expected 70/20/10 deliveries, got %d/%d/%d", a, b, c)
+			}
+			return nil
+		})
+
+		ci := consumerInfo(t)
+		require_Len(t, len(ci.PriorityGroups), 3)
+		for _, pg := range ci.PriorityGroups {
+			require_Equal(t, pg.Weight, weights[pg.Group])
+			require_Equal(t, pg.Delivered, uint64(pg.Weight))
+		}
+
+		// Without waiting requests for B, its share is redistributed.
+		subB.Unsubscribe()
+		subA.Unsubscribe()
+		subC.Unsubscribe()
+		waitForNWaiting(t, 0)
+		subA, subC = pull(t, "A", 100), pull(t, "C", 100)
+		waitForNWaiting(t, 2)
+		publish(t, 80)
+		checkFor(t, 2*time.Second, 10*time.Millisecond, func() error {
+			if a, c := received(t, subA), received(t, subC); a != 70 || c != 10 {
+				return fmt.Errorf("expected 70/10 deliveries, got %d/%d", a, c)
+			}
+			return nil
+		})
+	}
+
+	t.Run("R1", func(t *testing.T) {
+		s := RunBasicJetStreamServer(t)
+		defer s.Shutdown()
+		test(t, s, 1)
+	})
+
+	t.Run("R3", func(t *testing.T) {
+		c := createJetStreamClusterExplicit(t, "R3S", 3)
+		defer c.shutdown()
+		test(t, c.randomServer(), 3)
+	})
+}
+
 func TestJetStreamConsumerMaxDeliverUnderflow(t *testing.T) {
 	s := RunBasicJetStreamServer(t)
 	defer s.Shutdown()
@@ -13387,3 +13595,1036 @@ func TestJetStreamConsumerCreateCollisionPreservesExistingConsumerQueues(t *test
 	require_True(t, ok)
 	require_Equal(t, v.(*ipQueue[*nextMsgReq]), o.nextMsgReqs)
 }
+
+func TestJetStreamConsumerDeadLetterConfig(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}})
+	require_NoError(t, err)
+	_, err = js.AddStream(&nats.StreamConfig{Name: "DLQ", Subjects: []string{"dlq.>"}})
+	require_NoError(t, err)
+
+	for _, test := range []struct {
+		desc string
+		cfg  ConsumerConfig
+		err  string
+	}{
+		{
+			desc: "missing-stream",
+			cfg:  ConsumerConfig{Durable: "C", AckPolicy: AckExplicit, DeadLetter: &ConsumerDeadLetter{Stream: "NOPE", Subject: "dlq.x"}},
+			err:  `stream "NOPE" not found`,
+		},
+		{
+			desc: "subject-not-stored",
+			cfg:  ConsumerConfig{Durable: "C", AckPolicy: AckExplicit, DeadLetter: &ConsumerDeadLetter{Stream: "DLQ", Subject: "other.{{subject}}"}},
+			err:  `stream "DLQ" does not store subject "other.{{subject}}"`,
+		},
+		{
+			desc: "ack-none",
+			cfg:  ConsumerConfig{Durable: "C", AckPolicy: AckNone, DeadLetter: &ConsumerDeadLetter{Stream: "DLQ", Subject: "dlq.x"}},
+			err:  "ack policy none can not dead letter",
+		},
+		{
+			desc: "no-stream",
+			cfg:  ConsumerConfig{Durable: "C", AckPolicy: AckExplicit, DeadLetter: &ConsumerDeadLetter{Subject: "dlq"}},
+			err:  "stream name is invalid",
+		},
+		{
+			desc: "same-stream",
+			cfg:  ConsumerConfig{Durable: "C", AckPolicy: AckExplicit, DeadLetter: &ConsumerDeadLetter{Stream: "TEST", Subject: "dlq"}},
+			err:  "stream can not be the consumer's stream",
+		},
+		{
+			desc: "wildcard-subject",
+			cfg:  ConsumerConfig{Durable: "C", AckPolicy: AckExplicit, DeadLetter: &ConsumerDeadLetter{Stream: "DLQ", Subject: "dlq.*"}},
+			err:  "subject is invalid",
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			_, err := jsConsumerCreate(t, nc, "TEST", test.cfg, false)
+			require_Error(t, err, NewJSConsumerDeadLetterInvalidError(errors.New(test.err)))
+		})
+	}
+
+	// Placeholders are fine.
+	_, err = jsConsumerCreate(t, nc, "TEST", ConsumerConfig{
+		Durable:    "C",
+		AckPolicy:  AckExplicit,
+		DeadLetter: &ConsumerDeadLetter{Stream: "DLQ", Subject: "dlq.{{stream}}.{{consumer}}.{{subject}}"},
+	}, false)
+	require_NoError(t, err)
+}
+
+func TestJetStreamConsumerDeadLetter(t *testing.T) {
+	test := func(t *testing.T, replicas int) {
+		var s *Server
+		if replicas == 1 {
+			s = RunBasicJetStreamServer(t)
+			defer s.Shutdown()
+		} else {
+			c := createJetStreamClusterExplicit(t, "R3S", replicas)
+			defer c.shutdown()
+			s = c.randomServer()
+		}
+
+		nc, js := jsClientConnect(t, s)
+		defer nc.Close()
+
+		_, err := js.AddStream(&nats.StreamConfig{
+			Name:      "TEST",
+			Subjects:  []string{"foo.>"},
+			Retention: nats.WorkQueuePolicy,
+			Replicas:  replicas,
+		})
+		require_NoError(t, err)
+		_, err = js.AddStream(&nats.StreamConfig{Name: "DLQ", Subjects: []string{"dlq.>"}, Replicas: replicas})
+		require_NoError(t, err)
+
+		_, err = jsConsumerCreate(t, nc, "TEST", ConsumerConfig{
+			Durable:    "C",
+			AckPolicy:  AckExplicit,
+			AckWait:    time.Second,
+			MaxDeliver: 2,
+			Replicas:   replicas,
+			DeadLetter: &ConsumerDeadLetter{
+				Stream:       "DLQ",
+				Subject:      "dlq.{{consumer}}.{{subject}}",
+				OnTerm:       true,
+				TermOriginal: true,
+			},
+		}, false)
+		require_NoError(t, err)
+
+		m := nats.NewMsg("foo.a")
+		m.Header.Set("X", "1")
+		m.Data = []byte("a")
+		_, err = js.PublishMsg(m)
+		require_NoError(t, err)
+		_, err = js.Publish("foo.b", []byte("b"))
+		require_NoError(t, err)
+
+		sub, err := js.PullSubscribe(_EMPTY_, "C", nats.Bind("TEST", "C"))
+		require_NoError(t, err)
+		defer sub.Unsubscribe()
+
+		msgs, err := sub.Fetch(2)
+		require_NoError(t, err)
+		require_Len(t, len(msgs), 2)
+		require_NoError(t, msgs[0].Respond([]byte(`-NAK {"reason":"bad payload"}`)))
+		require_NoError(t, msgs[1].Respond([]byte("+TERM invalid")))
+
+		// The NAK'd message gets redelivered once more, after which MaxDeliver is reached.
+		msgs, err = sub.Fetch(1)
+		require_NoError(t, err)
+		require_Equal(t, msgs[0].Subject, "foo.a")
+		require_NoError(t, msgs[0].Respond([]byte(`-NAK {"reason":"still bad"}`)))
+
+		checkFor(t, 5*time.Second, 50*time.Millisecond, func() error {
+			// Requesting more messages makes sure the redelivery is attempted.
+			sub.Fetch(1, nats.MaxWait(100*time.Millisecond))
+			si, err := js.StreamInfo("DLQ")
+			if err != nil {
+				return err
+			}
+			if si.State.Msgs != 2 {
+				return fmt.Errorf("expected 2 dead-lettered messages, got %d", si.State.Msgs)
+			}
+			return nil
+		})
+
+		rm, err := js.GetLastMsg("DLQ", "dlq.C.foo.a")
+		require_NoError(t, err)
+		require_Equal(t, string(rm.Data), "a")
+		require_Equal(t, rm.Header.Get("X"), "1")
+		require_Equal(t, rm.Header.Get(JSStream), "TEST")
+		require_Equal(t, rm.Header.Get(JSSubject), "foo.a")
+		require_Equal(t, rm.Header.Get(JSSequence), "1")
+		require_Equal(t, rm.Header.Get(JSDeadLetterConsumer), "C")
+		require_Equal(t, rm.Header.Get(JSDeadLetterDeliveries), "2")
+		require_Equal(t, rm.Header.Get(JSDeadLetterCause), JSDeadLetterCauseMaxDeliveries)
+		require_Equal(t, rm.Header.Get(JSDeadLetterReason), "still bad")
+
+		rm, err = js.GetLastMsg("DLQ", "dlq.C.foo.b")
+		require_NoError(t, err)
+		require_Equal(t, string(rm.Data), "b")
+		require_Equal(t, rm.Header.Get(JSSequence), "2")
+		require_Equal(t, rm.Header.Get(JSDeadLetterDeliveries), "1")
+		require_Equal(t, rm.Header.Get(JSDeadLetterCause), JSDeadLetterCauseTerminated)
+		require_Equal(t, rm.Header.Get(JSDeadLetterReason), "invalid")
+
+		// Both the terminated and the dead-lettered original are removed from the work queue.
+		checkFor(t, 2*time.Second, 50*time.Millisecond, func() error {
+			si, err := js.StreamInfo("TEST")
+			if err != nil {
+				return err
+			}
+			if si.State.Msgs != 0 {
+				return fmt.Errorf("expected no messages, got %d", si.State.Msgs)
+			}
+			return nil
+		})
+	}
+
+	t.Run("R1", func(t *testing.T) { test(t, 1) })
+	t.Run("R3", func(t *testing.T) { test(t, 3) })
+}
+
+func TestJetStreamConsumerDeadLetterNotStored(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}, Retention: nats.WorkQueuePolicy})
+	require_NoError(t, err)
+	_, err = js.AddStream(&nats.StreamConfig{Name: "DLQ", Subjects: []string{"dlq"}})
+	require_NoError(t, err)
+
+	_, err = jsConsumerCreate(t, nc, "TEST", ConsumerConfig{
+		Durable:    "C",
+		AckPolicy:  AckExplicit,
+		AckWait:    250 * time.Millisecond,
+		MaxDeliver: 3,
+		DeadLetter: &ConsumerDeadLetter{Stream: "DLQ", Subject: "dlq", OnTerm: true, TermOriginal: true},
+	}, false)
+	require_NoError(t, err)
+
+	// The dead letter stream will reject the copies.
+	cfg := &StreamConfig{Name: "DLQ", Subjects: []string{"dlq"}, Storage: FileStorage, Sealed: true}
+	_, err = jsStreamUpdate(t, nc, cfg)
+	require_NoError(t, err)
+
+	asub, err := nc.SubscribeSync(JSAdvisoryConsumerDeadLetterFailedPre + ".TEST.C")
+	require_NoError(t, err)
+	defer asub.Unsubscribe()
+	require_NoError(t, nc.Flush())
+	checkAdvisory := func(seq uint64, cause string) {
+		t.Helper()
+		msg, err := asub.NextMsg(2 * time.Second)
+		require_NoError(t, err)
+		var e JSConsumerDeadLetterFailedAdvisory
+		require_NoError(t, json.Unmarshal(msg.Data, &e))
+		require_Equal(t, e.Type, JSConsumerDeadLetterFailedAdvisoryType)
+		require_Equal(t, e.StreamSeq, seq)
+		require_Equal(t, e.Cause, cause)
+		require_True(t, e.Error != _EMPTY_)
+	}
+
+	_, err = js.Publish("foo", []byte("ok"))
+	require_NoError(t, err)
+
+	sub, err := js.PullSubscribe(_EMPTY_, "C", nats.Bind("TEST", "C"))
+	require_NoError(t, err)
+	defer sub.Unsubscribe()
+
+	// A terminated message is still terminated, and the AckTerm is replied to.
+	msgs, err := sub.Fetch(1)
+	require_NoError(t, err)
+	_, err = nc.Request(msgs[0].Reply, AckTerm, 2*time.Second)
+	require_NoError(t, err)
+	checkAdvisory(1, JSDeadLetterCauseTerminated)
+	_, err = sub.Fetch(1, nats.MaxWait(500*time.Millisecond))
+	require_Error(t, err, nats.ErrTimeout)
+	si, err := js.StreamInfo("TEST")
+	require_NoError(t, err)
+	require_Equal(t, si.State.Msgs, 0)
+
+	// A message that exhausted MaxDeliver stays in the stream.
+	_, err = js.Publish("foo", []byte("ok"))
+	require_NoError(t, err)
+	for range 3 {
+		msgs, err = sub.Fetch(1, nats.MaxWait(2*time.Second))
+		require_NoError(t, err)
+		require_NoError(t, msgs[0].Nak())
+	}
+	_, err = sub.Fetch(1, nats.MaxWait(500*time.Millisecond))
+	require_Error(t, err, nats.ErrTimeout)
+
+	checkAdvisory(2, JSDeadLetterCauseMaxDeliveries)
+	si, err = js.StreamInfo("TEST")
+	require_NoError(t, err)
+	require_Equal(t, si.State.Msgs, 1)
+	si, err = js.StreamInfo("DLQ")
+	require_NoError(t, err)
+	require_Equal(t, si.State.Msgs, 0)
+}
+
+func TestJetStreamConsumerHeaderFilterConfig(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}})
+	require_NoError(t, err)
+
+	_, err = jsConsumerCreate(t, nc, "TEST", ConsumerConfig{Durable: "C", AckPolicy: AckExplicit, HeaderFilter: "Region =="}, false)
+	require_Error(t, err, NewJSConsumerHeaderFilterInvalidError(errors.New("position 9: expected quoted value")))
+
+	_, err = jsConsumerCreate(t, nc, "TEST", ConsumerConfig{Durable: "C", AckPolicy: AckExplicit, HeaderFilter: "Region == 'eu'"}, false)
+	require_NoError(t, err)
+
+	// The filter can be updated.
+	_, err = jsConsumerCreate(t, nc, "TEST", ConsumerConfig{Durable: "C", AckPolicy: AckExplicit, HeaderFilter: "Region in ('eu', 'us')"}, false)
+	require_NoError(t, err)
+	_, err = jsConsumerCreate(t, nc, "TEST", ConsumerConfig{Durable: "C", AckPolicy: AckExplicit, HeaderFilter: "Region in"}, false)
+	require_Error(t, err, NewJSConsumerHeaderFilterInvalidError(errors.New("position 9: expected '(' after in")))
+}
+
+func TestJetStreamConsumerHeaderFilter(t *testing.T) {
+	test := func(t *testing.T, replicas int) {
+		var s *Server
+		var servers []*Server
+		if replicas == 1 {
+			s = RunBasicJetStreamServer(t)
+			defer s.Shutdown()
+			servers = []*Server{s}
+		} else {
+			c := createJetStreamClusterExplicit(t, "R3S", replicas)
+			defer c.shutdown()
+			s, servers = c.randomServer(), c.servers
+		}
+
+		nc, js := jsClientConnect(t, s)
+		defer nc.Close()
+
+		_, err := js.AddStream(&nats.StreamConfig{
+			Name:      "TEST",
+			Subjects:  []string{"foo"},
+			Retention: nats.InterestPolicy,
+			Replicas:  replicas,
+		})
+		require_NoError(t, err)
+
+		_, err = jsConsumerCreate(t, nc, "TEST", ConsumerConfig{
+			Durable:      "C",
+			AckPolicy:    AckExplicit,
+			Replicas:     replicas,
+			HeaderFilter: "Region == 'eu' && !Test",
+		}, false)
+		require_NoError(t, err)
+
+		publish := func(region string, test bool) {
+			t.Helper()
+			m := nats.NewMsg("foo")
+			if region != _EMPTY_ {
+				m.Header.Set("Region", region)
+			}
+			if test {
+				m.Header.Set("Test", "1")
+			}
+			_, err := js.PublishMsg(m)
+			require_NoError(t, err)
+		}
+		publish("us", false)
+		publish("eu", false)
+		publish(_EMPTY_, false)
+		publish("eu", true)
+		publish("eu", false)
+		publish("us", false)
+
+		// Num pending is an upper bound until the messages have been looked at.
+		var ci JSApiConsumerInfoResponse
+		resp, err := nc.Request(fmt.Sprintf(JSApiConsumerInfoT, "TEST", "C"), nil, time.Second)
+		require_NoError(t, err)
+		require_NoError(t, json.Unmarshal(resp.Data, &ci))
+		require_True(t, ci.ConsumerInfo != nil)
+		require_Equal(t, ci.NumPending, 6)
+		require_True(t, ci.NumPendingApprox)
+
+		sub, err := js.PullSubscribe(_EMPTY_, "C", nats.Bind("TEST", "C"))
+		require_NoError(t, err)
+		defer sub.Unsubscribe()
+
+		msgs, err := sub.Fetch(10, nats.MaxWait(250*time.Millisecond))
+		require_NoError(t, err)
+		require_Len(t, len(msgs), 2)
+		for i, seq := range []uint64{2, 5} {
+			meta, err := msgs[i].Metadata()
+			require_NoError(t, err)
+			require_Equal(t, meta.Sequence.Stream, seq)
+			require_Equal(t, meta.Sequence.Consumer, uint64(i+1))
+			require_NoError(t, msgs[i].AckSync())
+		}
+		// Nothing else matches, this makes sure the last message has been looked at.
+		_, err = sub.Fetch(1, nats.MaxWait(250*time.Millisecond))
+		require_Error(t, err, nats.ErrTimeout)
+
+		resp, err = nc.Request(fmt.Sprintf(JSApiConsumerInfoT, "TEST", "C"), nil, time.Second)
+		require_NoError(t, err)
+		ci = JSApiConsumerInfoResponse{}
+		require_NoError(t, json.Unmarshal(resp.Data, &ci))
+		require_Equal(t, ci.NumPending, 0)
+		require_False(t, ci.NumPendingApprox)
+		require_Equal(t, ci.NumAckPending, 0)
+
+		// Skipped messages count as acknowledged, so nothing is left in the interest stream on any replica.
+		checkFor(t, 2*time.Second, 50*time.Millisecond, func() error {
+			for _, s := range servers {
+				mset, err := s.globalAccount().lookupStream("TEST")
+				if err != nil {
+					return err
+				}
+				if state := mset.state(); state.Msgs != 0 {
+					return fmt.Errorf("expected no messages on %s, got %d", s.Name(), state.Msgs)
+				}
+			}
+			return nil
+		})
+	}
+
+	t.Run("R1", func(t *testing.T) { test(t, 1) })
+	t.Run("R3", func(t *testing.T) { test(t, 3) })
+}
+
+func TestJetStreamConsumerHeaderFilterNeedAckUsesLoadedHeaders(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}, Retention: nats.InterestPolicy})
+	require_NoError(t, err)
+	_, err = jsConsumerCreate(t, nc, "TEST", ConsumerConfig{
+		Durable:      "C",
+		AckPolicy:    AckExplicit,
+		HeaderFilter: "Region == 'eu'",
+	}, false)
+	require_NoError(t, err)
+
+	mset, err := s.globalAccount().lookupStream("TEST")
+	require_NoError(t, err)
+	o := mset.lookupConsumer("C")
+	require_NotNil(t, o)
+
+	// The message is not in the store, so needAck can only go by the headers it's given.
+	eu, us := genHeader(nil, "Region", "eu"), genHeader(nil, "Region", "us")
+	require_True(t, o.needAck(1, "foo", eu))
+	require_False(t, o.needAck(1, "foo", us))
+	require_False(t, o.needAck(1, _EMPTY_, nil))
+
+	// Without a subject the message is loaded from the store.
+	m := nats.NewMsg("foo")
+	m.Header.Set("Region", "eu")
+	_, err = js.PublishMsg(m)
+	require_NoError(t, err)
+	require_True(t, o.needAck(1, _EMPTY_, nil))
+}
+
+func TestJetStreamConsumerStateExportImport(t *testing.T) {
+	test := func(t *testing.T, replicas int) {
+		var s *Server
+		if replicas == 1 {
+			s = RunBasicJetStreamServer(t)
+			defer s.Shutdown()
+		} else {
+			c := createJetStreamClusterExplicit(t, "R3S", replicas)
+			defer c.shutdown()
+			s = c.randomServer()
+		}
+
+		nc, js := jsClientConnect(t, s)
+		defer nc.Close()
+
+		_, err := js.AddStream(&nats.StreamConfig{Name: "ORIGIN", Subjects: []string{"foo"}, Replicas: replicas})
+		require_NoError(t, err)
+		for range 10 {
+			_, err = js.Publish("foo", nil)
+			require_NoError(t, err)
+		}
+
+		cfg := ConsumerConfig{Durable: "C", AckPolicy: AckExplicit, AckWait: 250 * time.Millisecond, Replicas: replicas}
+		_, err = jsConsumerCreate(t, nc, "ORIGIN", cfg, false)
+		require_NoError(t, err)
+
+		// Acknowledge all but the 4th message.
+		sub, err := js.PullSubscribe(_EMPTY_, "C", nats.Bind("ORIGIN", "C"))
+		require_NoError(t, err)
+		defer sub.Unsubscribe()
+		msgs, err := sub.Fetch(5)
+		require_NoError(t, err)
+		require_Len(t, len(msgs), 5)
+		for i, msg := range msgs {
+			if i != 3 {
+				require_NoError(t, msg.AckSync())
+			}
+		}
+
+		var eresp JSApiConsumerStateExportResponse
+		resp, err := nc.Request(fmt.Sprintf(JSApiConsumerStateExportT, "ORIGIN", "C"), nil, time.Second)
+		require_NoError(t, err)
+		require_NoError(t, json.Unmarshal(resp.Data, &eresp))
+		require_True(t, eresp.Error == nil)
+		cp := eresp.Checkpoint
+		require_True(t, cp != nil)
+		require_Equal(t, cp.Stream, "ORIGIN")
+		require_Equal(t, cp.Delivered.Stream, 5)
+		require_Equal(t, cp.AckFloor.Stream, 3)
+		require_Len(t, len(cp.Pending), 1)
+		require_Equal(t, cp.Pending[0].Stream, 4)
+		require_Equal(t, cp.Pending[0].Consumer, 4)
+		require_True(t, cp.Pending[0].Time != nil)
+
+		importState := func(stream string) *JSApiConsumerStateImportResponse {
+			t.Helper()
+			req, err := json.Marshal(JSApiConsumerStateImportRequest{Checkpoint: cp})
+			require_NoError(t, err)
+			resp, err := nc.Request(fmt.Sprintf(JSApiConsumerStateImportT, stream, "C"), req, 2*time.Second)
+			require_NoError(t, err)
+			var iresp JSApiConsumerStateImportResponse
+			require_NoError(t, json.Unmarshal(resp.Data, &iresp))
+			return &iresp
+		}
+
+		// The target stream has messages of its own, so sequences need to be translated.
+		_, err = js.AddStream(&nats.StreamConfig{Name: "TARGET", Subjects: []string{"bar"}, Replicas: replicas})
+		require_NoError(t, err)
+		for range 3 {
+			_, err = js.Publish("bar", nil)
+			require_NoError(t, err)
+		}
+		_, err = jsConsumerCreate(t, nc, "TARGET", cfg, false)
+		require_NoError(t, err)
+
+		// Can't import before the origin is sourced.
+		iresp := importState("TARGET")
+		require_Error(t, iresp.Error, NewJSConsumerStateImportError(errors.New(`stream does not mirror or source "ORIGIN"`)))
+
+		_, err = js.UpdateStream(&nats.StreamConfig{
+			Name:     "TARGET",
+			Subjects: []string{"bar"},
+			Sources:  []*nats.StreamSource{{Name: "ORIGIN"}},
+			Replicas: replicas,
+		})
+		require_NoError(t, err)
+		checkFor(t, 2*time.Second, 50*time.Millisecond, func() error {
+			if si, err := js.StreamInfo("TARGET"); err != nil {
+				return err
+			} else if si.State.Msgs != 13 {
+				return fmt.Errorf("expected 13 messages, got %d", si.State.Msgs)
+			}
+			return nil
+		})
+
+		iresp = importState("TARGET")
+		require_True(t, iresp.Error == nil)
+		require_True(t, iresp.ConsumerInfo != nil)
+		require_Equal(t, iresp.Delivered.Consumer, 5)
+		require_Equal(t, iresp.Delivered.Stream, 8)
+		require_Equal(t, iresp.AckFloor.Consumer, 3)
+		require_Equal(t, iresp.AckFloor.Stream, 6)
+		require_Equal(t, iresp.NumAckPending, 1)
+		require_Equal(t, iresp.NumPending, 5)
+
+		// The pending message gets redelivered, followed by the remaining messages.
+		tsub, err := js.PullSubscribe(_EMPTY_, "C", nats.Bind("TARGET", "C"))
+		require_NoError(t, err)
+		defer tsub.Unsubscribe()
+		var seqs []uint64
+		for len(seqs) < 6 {
+			msgs, err = tsub.Fetch(6-len(seqs), nats.MaxWait(2*time.Second))
+			require_NoError(t, err)
+			for _, msg := range msgs {
+				meta, err := msg.Metadata()
+				require_NoError(t, err)
+				seqs = append(seqs, meta.Sequence.Stream)
+			}
+		}
+		slices.Sort(seqs)
+		require_True(t, slices.Equal(seqs, []uint64{7, 9, 10, 11, 12, 13}))
+
+		// Mirrors keep the sequences of the origin.
+		_, err = js.AddStream(&nats.StreamConfig{Name: "MIRROR", Mirror: &nats.StreamSource{Name: "ORIGIN"}, Replicas: replicas})
+		require_NoError(t, err)
+		checkFor(t, 2*time.Second, 50*time.Millisecond, func() error {
+			if si, err := js.StreamInfo("MIRROR"); err != nil {
+				return err
+			} else if si.State.Msgs != 10 {
+				return fmt.Errorf("expected 10 messages, got %d", si.State.Msgs)
+			}
+			return nil
+		})
+		_, err = jsConsumerCreate(t, nc, "MIRROR", cfg, false)
+		require_NoError(t, err)
+		iresp = importState("MIRROR")
+		require_True(t, iresp.Error == nil)
+		require_Equal(t, iresp.Delivered.Stream, 5)
+		require_Equal(t, iresp.AckFloor.Stream, 3)
+		require_Equal(t, iresp.NumAckPending, 1)
+		require_Equal(t, iresp.NumPending, 5)
+	}
+
+	t.Run("R1", func(t *testing.T) { test(t, 1) })
+	t.Run("R3", func(t *testing.T) { test(t, 3) })
+}
+
+func TestJetStreamConsumerLagThresholdsConfig(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}})
+	require_NoError(t, err)
+
+	for _, test := range []struct {
+		cfg ConsumerConfig
+		err string
+	}{
+		{ConsumerConfig{AckPolicy: AckExplicit, LagThresholds: &ConsumerLagThresholds{}}, "at least one threshold is required"},
+		{ConsumerConfig{AckPolicy: AckExplicit, LagThresholds: &ConsumerLagThresholds{NumAckPending: -1}}, "thresholds can not be negative"},
+		{ConsumerConfig{AckPolicy: AckNone, LagThresholds: &ConsumerLagThresholds{NumAckPending: 10}}, "ack pending thresholds require acknowledgements"},
+		{ConsumerConfig{AckPolicy: AckExplicit, LagThresholds: &ConsumerLagThresholds{NumPending: 10, RecoverPercent: 100}}, "recover percent must be between 0 and 99"},
+	} {
+		test.cfg.Durable = "C"
+		_, err = jsConsumerCreate(t, nc, "TEST", test.cfg, false)
+		require_Error(t, err, NewJSConsumerLagThresholdsInvalidError(errors.New(test.err)))
+	}
+
+	_, err = jsConsumerCreate(t, nc, "TEST", ConsumerConfig{Durable: "C", AckPolicy: AckNone, LagThresholds: &ConsumerLagThresholds{NumPending: 10}}, false)
+	require_NoError(t, err)
+
+	// The thresholds can be updated.
+	_, err = jsConsumerCreate(t, nc, "TEST", ConsumerConfig{Durable: "C", AckPolicy: AckNone, LagThresholds: &ConsumerLagThresholds{NumPending: 100}}, false)
+	require_NoError(t, err)
+	_, err = jsConsumerCreate(t, nc, "TEST", ConsumerConfig{Durable: "C", AckPolicy: AckNone}, false)
+	require_NoError(t, err)
+}
+
+func TestJetStreamConsumerLagAdvisories(t *testing.T) {
+	test := func(t *testing.T, replicas int) {
+		var s *Server
+		if replicas == 1 {
+			s = RunBasicJetStreamServer(t)
+			defer s.Shutdown()
+		} else {
+			c := createJetStreamClusterExplicit(t, "R3S", replicas)
+			defer c.shutdown()
+			s = c.randomServer()
+		}
+
+		nc, js := jsClientConnect(t, s)
+		defer nc.Close()
+
+		_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}, Replicas: replicas})
+		require_NoError(t, err)
+
+		csub, err := nc.SubscribeSync(JSAdvisoryConsumerLagPre + ".TEST.C")
+		require_NoError(t, err)
+		defer csub.Unsubscribe()
+		dsub, err := nc.SubscribeSync(JSAdvisoryConsumerLagPre + ".TEST.D")
+		require_NoError(t, err)
+		defer dsub.Unsubscribe()
+		require_NoError(t, nc.Flush())
+
+		_, err = jsConsumerCreate(t, nc, "TEST", ConsumerConfig{
+			Durable:       "C",
+			AckPolicy:     AckExplicit,
+			LagThresholds: &ConsumerLagThresholds{NumPending: 10, NumAckPending: 5, RecoverPercent: 50},
+		}, false)
+		require_NoError(t, err)
+		_, err = jsConsumerCreate(t, nc, "TEST", ConsumerConfig{
+			Durable:       "D",
+			AckPolicy:     AckExplicit,
+			LagThresholds: &ConsumerLagThresholds{AckPendingAge: 500 * time.Millisecond},
+		}, false)
+		require_NoError(t, err)
+
+		nextAdvisory := func(sub *nats.Subscription, metric string, lagging bool) *JSConsumerLagAdvisory {
+			t.Helper()
+			msg, err := sub.NextMsg(5 * time.Second)
+			require_NoError(t, err)
+			var adv JSConsumerLagAdvisory
+			require_NoError(t, json.Unmarshal(msg.Data, &adv))
+			require_Equal(t, adv.Type, JSConsumerLagAdvisoryType)
+			require_Equal(t, adv.Stream, "TEST")
+			require_Equal(t, adv.Metric, metric)
+			require_Equal(t, adv.Lagging, lagging)
+			return &adv
+		}
+
+		for range 10 {
+			_, err = js.Publish("foo", nil)
+			require_NoError(t, err)
+		}
+		adv := nextAdvisory(csub, ConsumerLagNumPending, true)
+		require_Equal(t, adv.Consumer, "C")
+		require_Equal(t, adv.Value, 10)
+		require_Equal(t, adv.Threshold, 10)
+		require_Equal(t, adv.NumPending, 10)
+
+		// Delivering messages recovers num pending, but they are now waiting for acks.
+		sub, err := js.PullSubscribe("foo", "C", nats.Bind("TEST", "C"))
+		require_NoError(t, err)
+		defer sub.Unsubscribe()
+		msgs, err := sub.Fetch(6, nats.MaxWait(2*time.Second))
+		require_NoError(t, err)
+		require_Len(t, len(msgs), 6)
+		nextAdvisory(csub, ConsumerLagNumPending, false)
+		adv = nextAdvisory(csub, ConsumerLagNumAckPending, true)
+		require_True(t, adv.Value >= 5)
+
+		// Below the threshold, but not recovered yet.
+		for _, msg := range msgs[:3] {
+			require_NoError(t, msg.AckSync())
+		}
+		time.Sleep(2 * consumerLagCheckInterval)
+		_, err = csub.NextMsg(100 * time.Millisecond)
+		require_Error(t, err, nats.ErrTimeout)
+
+		require_NoError(t, msgs[3].AckSync())
+		adv = nextAdvisory(csub, ConsumerLagNumAckPending, false)
+		require_Equal(t, adv.Value, 2)
+		require_Equal(t, adv.NumAckPending, 2)
+
+		// The oldest message waiting for an ack gets too old.
+		dsubs, err := js.PullSubscribe("foo", "D", nats.Bind("TEST", "D"))
+		require_NoError(t, err)
+		defer dsubs.Unsubscribe()
+		msgs, err = dsubs.Fetch(1, nats.MaxWait(2*time.Second))
+		require_NoError(t, err)
+		adv = nextAdvisory(dsub, ConsumerLagAckPendingAge, true)
+		require_Equal(t, adv.Consumer, "D")
+		require_True(t, adv.AckPendingAge >= 500*time.Millisecond)
+		require_NoError(t, msgs[0].AckSync())
+		adv = nextAdvisory(dsub, ConsumerLagAckPendingAge, false)
+		require_Equal(t, adv.Value, 0)
+	}
+
+	t.Run("R1", func(t *testing.T) { test(t, 1) })
+	t.Run("R3", func(t *testing.T) { test(t, 3) })
+}
+
+func TestJetStreamConsumerMsgPriorityConfig(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo"}})
+	require_NoError(t, err)
+
+	// Priorities need to be allowed by the stream.
+	m := nats.NewMsg("foo")
+	m.Header.Set(JSMessagePriority, "1")
+	_, err = js.PublishMsg(m)
+	require_Error(t, err, NewJSMessagePriorityDisabledError())
+	_, err = jsConsumerCreate(t, nc, "TEST", ConsumerConfig{Durable: "C", AckPolicy: AckExplicit, MsgPriority: true}, false)
+	require_Error(t, err, NewJSConsumerMsgPriorityInvalidError(errors.New("stream does not allow message priority")))
+
+	_, err = jsStreamUpdate(t, nc, &StreamConfig{Name: "TEST", Subjects: []string{"foo"}, Storage: FileStorage, AllowMsgPriority: true})
+	require_NoError(t, err)
+	_, err = jsStreamUpdate(t, nc, &StreamConfig{Name: "TEST", Subjects: []string{"foo"}, Storage: FileStorage})
+	require_Error(t, err, NewJSStreamInvalidConfigError(errors.New("message priority can not be disabled")))
+
+	for _, prio := range []string{"10", "-1", "a", "01"} {
+		m.Header.Set(JSMessagePriority, prio)
+		_, err = js.PublishMsg(m)
+		require_Error(t, err, NewJSMessagePriorityInvalidError())
+	}
+	m.Header.Set(JSMessagePriority, "9")
+	_, err = js.PublishMsg(m)
+	require_NoError(t, err)
+
+	for _, test := range []struct {
+		cfg ConsumerConfig
+		err string
+	}{
+		{ConsumerConfig{AckPolicy: AckExplicit, MsgPriorityWindow: 10}, "window requires message priority"},
+		{ConsumerConfig{AckPolicy: AckExplicit, MsgPriority: true, DeliverSubject: "deliver"}, "only pull consumers can deliver by priority"},
+		{ConsumerConfig{AckPolicy: AckAll, MsgPriority: true}, "ack policy must be explicit"},
+		{ConsumerConfig{AckPolicy: AckExplicit, MsgPriority: true, MsgPriorityWindow: maxMsgPriorityWindow + 1}, "window must be between 0 and 100000"},
+	} {
+		test.cfg.Durable = "C"
+		_, err = jsConsumerCreate(t, nc, "TEST", test.cfg, false)
+		require_Error(t, err, NewJSConsumerMsgPriorityInvalidError(errors.New(test.err)))
+	}
+
+	_, err = jsConsumerCreate(t, nc, "TEST", ConsumerConfig{Durable: "C", AckPolicy: AckExplicit, MsgPriority: true}, false)
+	require_NoError(t, err)
+	_, err = jsConsumerCreate(t, nc, "TEST", ConsumerConfig{Durable: "C", AckPolicy: AckExplicit, MsgPriority: true, MsgPriorityWindow: 10}, false)
+	require_NoError(t, err)
+	_, err = jsConsumerCreate(t, nc, "TEST", ConsumerConfig{Durable: "C", AckPolicy: AckExplicit}, false)
+	require_Error(t, err, NewJSConsumerCreateError(errors.New("message priority can not be updated")))
+}
+
+func TestJetStreamConsumerMsgPriority(t *testing.T) {
+	test := func(t *testing.T, replicas int) {
+		var s *Server
+		var c *cluster
+		if replicas == 1 {
+			s = RunBasicJetStreamServer(t)
+			defer s.Shutdown()
+		} else {
+			c = createJetStreamClusterExplicit(t, "R3S", replicas)
+			defer c.shutdown()
+			s = c.randomServer()
+		}
+
+		nc, js := jsClientConnect(t, s)
+		defer nc.Close()
+
+		_, err := jsStreamCreate(t, nc, &StreamConfig{
+			Name:             "TEST",
+			Subjects:         []string{"jobs"},
+			Retention:        WorkQueuePolicy,
+			Storage:          FileStorage,
+			Replicas:         replicas,
+			AllowMsgPriority: true,
+		})
+		require_NoError(t, err)
+
+		publish := func(prio string) {
+			t.Helper()
+			m := nats.NewMsg("jobs")
+			if prio != _EMPTY_ {
+				m.Header.Set(JSMessagePriority, prio)
+			}
+			_, err := js.PublishMsg(m)
+			require_NoError(t, err)
+		}
+		// Sequences 1-6, without a priority a message is at the default level.
+		for _, prio := range []string{_EMPTY_, "9", "1", "5", "0", "1"} {
+			publish(prio)
+		}
+
+		_, err = jsConsumerCreate(t, nc, "TEST", ConsumerConfig{Durable: "C", AckPolicy: AckExplicit, MsgPriority: true, Replicas: replicas}, false)
+		require_NoError(t, err)
+		sub, err := js.PullSubscribe("jobs", "C", nats.Bind("TEST", "C"))
+		require_NoError(t, err)
+		defer sub.Unsubscribe()
+
+		next := func() uint64 {
+			t.Helper()
+			msgs, err := sub.Fetch(1, nats.MaxWait(2*time.Second))
+			require_NoError(t, err)
+			require_Len(t, len(msgs), 1)
+			meta, err := msgs[0].Metadata()
+			require_NoError(t, err)
+			require_Equal(t, meta.NumDelivered, 1)
+			// Messages keep the consumer sequence they got when held back, in stream order here.
+			require_Equal(t, meta.Sequence.Consumer, meta.Sequence.Stream)
+			require_NoError(t, msgs[0].AckSync())
+			return meta.Sequence.Stream
+		}
+
+		require_Equal(t, next(), 5)
+		ci, err := js.ConsumerInfo("TEST", "C")
+		require_NoError(t, err)
+		require_Equal(t, ci.NumPending, 5)
+		require_Equal(t, ci.NumAckPending, 0)
+		var info ConsumerInfo
+		resp, err := nc.Request(fmt.Sprintf(JSApiConsumerInfoT, "TEST", "C"), nil, time.Second)
+		require_NoError(t, err)
+		require_NoError(t, json.Unmarshal(resp.Data, &info))
+		require_True(t, slices.Equal(info.NumPendingPriority, []uint64{0, 2, 0, 0, 0, 2, 0, 0, 0, 1}))
+
+		require_Equal(t, next(), 3)
+
+		// Urgent jobs jump the queue.
+		publish("0")
+		require_Equal(t, next(), 7)
+
+		// A new leader continues delivering by priority.
+		if c != nil {
+			_, err = nc.Request(fmt.Sprintf(JSApiConsumerLeaderStepDownT, "TEST", "C"), nil, 5*time.Second)
+			require_NoError(t, err)
+			c.waitOnConsumerLeader(globalAccountName, "TEST", "C")
+		}
+		for _, seq := range []uint64{6, 1, 4, 2} {
+			require_Equal(t, next(), seq)
+		}
+		ci, err = js.ConsumerInfo("TEST", "C")
+		require_NoError(t, err)
+		require_Equal(t, ci.Delivered.Consumer, 7)
+		require_Equal(t, ci.Delivered.Stream, 7)
+
+		// All jobs are done.
+		checkFor(t, 2*time.Second, 100*time.Millisecond, func() error {
+			si, err := js.StreamInfo("TEST")
+			if err != nil {
+				return err
+			}
+			if si.State.Msgs != 0 {
+				return fmt.Errorf("expected no messages, got %d", si.State.Msgs)
+			}
+			return nil
+		})
+	}
+
+	t.Run("R1", func(t *testing.T) { test(t, 1) })
+	t.Run("R3", func(t *testing.T) { test(t, 3) })
+}
+
+func TestJetStreamConsumerSubjectPermissions(t *testing.T) {
+	tmpl := strings.Replace(jsClusterAccountsTempl, `ONE { users = [ { user: "one", pass: "p" } ]; jetstream: enabled }`, `
+		ONE {
+			users = [
+				{ user: "one", pass: "p" }
+				{ user: "eu", pass: "p", permissions: { subscribe: ["orders.eu.>", "_INBOX.>"] } }
+				{ user: "noeu", pass: "p", permissions: { subscribe: { deny: "orders.eu.secret" } } }
+			]
+			jetstream: enabled
+		}`, 1)
+
+	test := func(t *testing.T, replicas int) {
+		var s *Server
+		if replicas == 1 {
+			conf := createConfFile(t, []byte(fmt.Sprintf(tmpl, "S", t.TempDir(), "C", 0, _EMPTY_)))
+			s, _ = RunServerWithConfig(conf)
+			defer s.Shutdown()
+		} else {
+			c := createJetStreamClusterWithTemplate(t, tmpl, "R3S", replicas)
+			defer c.shutdown()
+			// Connect to a server that is not the meta leader, which handles the requests.
+			s = c.randomNonLeader()
+		}
+
+		nc := natsConnect(t, s.ClientURL(), nats.UserInfo("one", "p"))
+		defer nc.Close()
+		ncEU := natsConnect(t, s.ClientURL(), nats.UserInfo("eu", "p"))
+		defer ncEU.Close()
+		ncNoEU := natsConnect(t, s.ClientURL(), nats.UserInfo("noeu", "p"))
+		defer ncNoEU.Close()
+
+		cfg := &StreamConfig{
+			Name:                       "ORDERS",
+			Subjects:                   []string{"orders.>"},
+			Storage:                    FileStorage,
+			Replicas:                   replicas,
+			ConsumerSubjectPermissions: true,
+		}
+		_, err := jsStreamCreate(t, nc, cfg)
+		require_NoError(t, err)
+
+		notPermitted := func(subject string) error {
+			return NewJSConsumerSubjectPermissionError(fmt.Errorf("subject %q not permitted", subject))
+		}
+
+		// Only the subjects the user can subscribe to.
+		_, err = jsConsumerCreate(t, ncEU, "ORDERS", ConsumerConfig{Durable: "EU", FilterSubject: "orders.eu.>"}, false)
+		require_NoError(t, err)
+		_, err = jsConsumerCreate(t, ncEU, "ORDERS", ConsumerConfig{Durable: "ALL", FilterSubject: "orders.>"}, false)
+		require_Error(t, err, notPermitted("orders.>"))
+		_, err = jsConsumerCreate(t, ncEU, "ORDERS", ConsumerConfig{Durable: "ALL"}, false)
+		require_Error(t, err, notPermitted("orders.>"))
+		_, err = jsConsumerCreate(t, ncEU, "ORDERS", ConsumerConfig{Durable: "MULTI", FilterSubjects: []string{"orders.eu.a", "orders.us.a"}}, false)
+		require_Error(t, err, notPermitted("orders.us.a"))
+
+		// Filters can't overlap with denied subjects.
+		_, err = jsConsumerCreate(t, ncNoEU, "ORDERS", ConsumerConfig{Durable: "US", FilterSubject: "orders.us.>"}, false)
+		require_NoError(t, err)
+		_, err = jsConsumerCreate(t, ncNoEU, "ORDERS", ConsumerConfig{Durable: "EUW", FilterSubject: "orders.eu.*"}, false)
+		require_Error(t, err, notPermitted("orders.eu.*"))
+
+		// Asking for a direct consumer, like mirrors and sources use, doesn't get around the check.
+		j, err := json.Marshal(CreateConsumerRequest{Stream: "ORDERS", Config: ConsumerConfig{Direct: true, DeliverSubject: "_INBOX.x"}})
+		require_NoError(t, err)
+		rmsg, err := ncEU.Request(fmt.Sprintf(JSApiConsumerCreateT, "ORDERS"), j, 3*time.Second)
+		require_NoError(t, err)
+		var ccResp JSApiConsumerCreateResponse
+		require_NoError(t, json.Unmarshal(rmsg.Data, &ccResp))
+		require_NotNil(t, ccResp.Error)
+		require_Error(t, ccResp.Error, notPermitted("orders.>"))
+
+		// Users without subscribe permissions are not restricted.
+		_, err = jsConsumerCreate(t, nc, "ORDERS", ConsumerConfig{Durable: "ALL"}, false)
+		require_NoError(t, err)
+
+		// Sourcing from the stream is held to the same rules.
+		_, err = jsStreamCreate(t, ncEU, &StreamConfig{
+			Name:     "S",
+			Storage:  FileStorage,
+			Replicas: replicas,
+			Sources:  []*StreamSource{{Name: "ORDERS"}},
+		})
+		require_Error(t, err, notPermitted("orders.>"))
+		_, err = jsStreamCreate(t, ncEU, &StreamConfig{
+			Name:     "S",
+			Storage:  FileStorage,
+			Replicas: replicas,
+			Sources:  []*StreamSource{{Name: "ORDERS", FilterSubject: "orders.eu.>"}},
+		})
+		require_NoError(t, err)
+
+		// The consumer the stream creates for its source is not restricted by the user.
+		js, err := nc.JetStream()
+		require_NoError(t, err)
+		_, err = js.Publish("orders.eu.1", nil)
+		require_NoError(t, err)
+		checkFor(t, 5*time.Second, 100*time.Millisecond, func() error {
+			si, err := js.StreamInfo("S")
+			if err != nil {
+				return err
+			}
+			if si.State.Msgs != 1 {
+				return fmt.Errorf("expected 1 sourced msg, got %d", si.State.Msgs)
+			}
+			return nil
+		})
+		_, err = jsStreamUpdate(t, ncEU, &StreamConfig{
+			Name:     "S",
+			Storage:  FileStorage,
+			Replicas: replicas,
+			Sources:  []*StreamSource{{Name: "ORDERS", SubjectTransforms: []SubjectTransformConfig{{Source: "orders.us.>", Destination: "us.>"}}}},
+		})
+		require_Error(t, err, notPermitted("orders.us.>"))
+
+		// Getting messages is held to the same rules.
+		_, err = js.Publish("orders.us.1", nil)
+		require_NoError(t, err)
+		jsEU, err := ncEU.JetStream()
+		require_NoError(t, err)
+		rsm, err := jsEU.GetMsg("ORDERS", 1)
+		require_NoError(t, err)
+		require_Equal(t, rsm.Subject, "orders.eu.1")
+		_, err = jsEU.GetMsg("ORDERS", 2)
+		require_True(t, err != nil && strings.Contains(err.Error(), `message subject not permitted: subject "orders.us.1" not permitted`))
+		_, err = jsEU.GetLastMsg("ORDERS", "orders.us.1")
+		require_True(t, err != nil && strings.Contains(err.Error(), `message subject not permitted: subject "orders.us.1" not permitted`))
+		_, err = js.GetMsg("ORDERS", 2)
+		require_NoError(t, err)
+
+		// Direct gets don't go through the permissions of the user.
+		cfg.AllowDirect = true
+		_, err = jsStreamUpdate(t, nc, cfg)
+		require_Error(t, err, NewJSStreamInvalidConfigError(errors.New("consumer subject permissions can not be used with direct get")))
+		cfg.AllowDirect = false
+
+		// Without consumer subject permissions, the filter subjects are not restricted.
+		cfg.ConsumerSubjectPermissions = false
+		_, err = jsStreamUpdate(t, nc, cfg)
+		require_NoError(t, err)
+		_, err = jsConsumerCreate(t, ncEU, "ORDERS", ConsumerConfig{Durable: "ALL"}, false)
+		require_NoError(t, err)
+	}
+
+	t.Run("R1", func(t *testing.T) { test(t, 1) })
+	t.Run("R3", func(t *testing.T) { test(t, 3) })
+}
+
+func TestJetStreamConsumerSubjectPermissionsUnresolved(t *testing.T) {
+	cfg := &StreamConfig{Name: "ORDERS", Subjects: []string{"orders.>"}, ConsumerSubjectPermissions: true}
+
+	// Internal requests are not restricted.
+	require_True(t, checkConsumerSubjectPermissions(nil, cfg, nil) == nil)
+	// Without the permissions resolved by the server the user is connected to, the request is denied,
+	// also for users without a name like token users, or users authorized through auth callout.
+	for _, ci := range []*ClientInfo{{}, {User: "[REDACTED]"}, {User: "one", Account: "ONE"}} {
+		require_Error(t, checkConsumerSubjectPermissions(ci, cfg, nil), NewJSConsumerSubjectPermissionError(errors.New("permissions of user can not be determined")))
+	}
+	// Resolved permissions, empty if not restricted.
+	require_True(t, checkConsumerSubjectPermissions(&ClientInfo{SubPerms: &SubjectPermission{}}, cfg, nil) == nil)
+	sp := &SubjectPermission{Allow: []string{"orders.eu.>"}}
+	require_True(t, checkConsumerSubjectPermissions(&ClientInfo{SubPerms: sp}, cfg, []string{"orders.eu.1"}) == nil)
+	require_Error(t, checkConsumerSubjectPermissions(&ClientInfo{SubPerms: sp}, cfg, nil), NewJSConsumerSubjectPermissionError(errors.New(`subject "orders.>" not permitted`)))
+}
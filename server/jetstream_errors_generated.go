@@ -23,6 +23,9 @@ const (
 	// JSAtomicPublishInvalidBatchIDErr atomic publish batch ID is invalid
 	JSAtomicPublishInvalidBatchIDErr ErrorIdentifier = 10179
 
+	// JSAtomicPublishInvalidTxnErrF atomic publish transaction is invalid: {err}
+	JSAtomicPublishInvalidTxnErrF ErrorIdentifier = 10240
+
 	// JSAtomicPublishMissingSeqErr atomic publish sequence is missing
 	JSAtomicPublishMissingSeqErr ErrorIdentifier = 10175
 
@@ -32,6 +35,9 @@ const (
 	// JSAtomicPublishTooManyInflight atomic publish too many inflight
 	JSAtomicPublishTooManyInflight ErrorIdentifier = 10210
 
+	// JSAtomicPublishTxnAbortedErrF atomic publish transaction aborted: {err}
+	JSAtomicPublishTxnAbortedErrF ErrorIdentifier = 10241
+
 	// JSAtomicPublishUnsupportedHeaderBatchErr atomic publish unsupported header used: {header}
 	JSAtomicPublishUnsupportedHeaderBatchErr ErrorIdentifier = 10177
 
@@ -71,6 +77,9 @@ const (
 	// JSClusterNotLeaderErr JetStream cluster can not handle request
 	JSClusterNotLeaderErr ErrorIdentifier = 10009
 
+	// JSClusterPeerNotLearnerErr peer not a learner
+	JSClusterPeerNotLearnerErr ErrorIdentifier = 10249
+
 	// JSClusterPeerNotMemberErr peer not a member
 	JSClusterPeerNotMemberErr ErrorIdentifier = 10040
 
@@ -134,6 +143,9 @@ const (
 	// JSConsumerCreateFilterSubjectMismatchErr Consumer create request did not match filtered subject from create subject
 	JSConsumerCreateFilterSubjectMismatchErr ErrorIdentifier = 10131
 
+	// JSConsumerDeadLetterInvalidErrF consumer dead letter configuration is invalid: {err}
+	JSConsumerDeadLetterInvalidErrF ErrorIdentifier = 10231
+
 	// JSConsumerDeliverCycleErr consumer deliver subject forms a cycle
 	JSConsumerDeliverCycleErr ErrorIdentifier = 10081
 
@@ -188,6 +200,9 @@ const (
 	// JSConsumerHBRequiresPushErr consumer idle heartbeat requires a push based consumer
 	JSConsumerHBRequiresPushErr ErrorIdentifier = 10088
 
+	// JSConsumerHeaderFilterInvalidErrF consumer header filter is invalid: {err}
+	JSConsumerHeaderFilterInvalidErrF ErrorIdentifier = 10235
+
 	// JSConsumerInactiveThresholdExcess consumer inactive threshold exceeds system limit of {limit}
 	JSConsumerInactiveThresholdExcess ErrorIdentifier = 10153
 
@@ -203,12 +218,18 @@ const (
 	// JSConsumerInvalidPriorityGroupErr Provided priority group does not exist for this consumer
 	JSConsumerInvalidPriorityGroupErr ErrorIdentifier = 10160
 
+	// JSConsumerInvalidPriorityWeightsErr consumer priority weights must be set for each priority group and be positive
+	JSConsumerInvalidPriorityWeightsErr ErrorIdentifier = 10228
+
 	// JSConsumerInvalidResetErr invalid reset: {err}
 	JSConsumerInvalidResetErr ErrorIdentifier = 10204
 
 	// JSConsumerInvalidSamplingErrF failed to parse consumer sampling configuration: {err}
 	JSConsumerInvalidSamplingErrF ErrorIdentifier = 10095
 
+	// JSConsumerLagThresholdsInvalidErrF consumer lag thresholds are invalid: {err}
+	JSConsumerLagThresholdsInvalidErrF ErrorIdentifier = 10244
+
 	// JSConsumerMaxDeliverBackoffErr max deliver is required to be > length of backoff values
 	JSConsumerMaxDeliverBackoffErr ErrorIdentifier = 10116
 
@@ -233,6 +254,12 @@ const (
 	// JSConsumerMetadataLengthErrF consumer metadata exceeds maximum size of {limit}
 	JSConsumerMetadataLengthErrF ErrorIdentifier = 10135
 
+	// JSConsumerMsgDelayRequiresAckExplicitErr consumer requires explicit ack policy on a stream with message delays
+	JSConsumerMsgDelayRequiresAckExplicitErr ErrorIdentifier = 10250
+
+	// JSConsumerMsgPriorityInvalidErrF consumer message priority is invalid: {err}
+	JSConsumerMsgPriorityInvalidErrF ErrorIdentifier = 10247
+
 	// JSConsumerMultipleFiltersNotAllowed consumer with multiple subject filters cannot use subject based API
 	JSConsumerMultipleFiltersNotAllowed ErrorIdentifier = 10137
 
@@ -269,6 +296,9 @@ const (
 	// JSConsumerPriorityPolicyWithoutGroup Setting PriorityPolicy requires at least one PriorityGroup to be set
 	JSConsumerPriorityPolicyWithoutGroup ErrorIdentifier = 10159
 
+	// JSConsumerPriorityWeightsWithoutPolicy PriorityWeights can only be set when PriorityPolicy is weighted
+	JSConsumerPriorityWeightsWithoutPolicy ErrorIdentifier = 10229
+
 	// JSConsumerPullNotDurableErr consumer in pull mode requires a durable name
 	JSConsumerPullNotDurableErr ErrorIdentifier = 10085
 
@@ -299,12 +329,18 @@ const (
 	// JSConsumerSmallHeartbeatErr consumer idle heartbeat needs to be >= 100ms
 	JSConsumerSmallHeartbeatErr ErrorIdentifier = 10083
 
+	// JSConsumerStateImportErrF consumer state import failed: {err}
+	JSConsumerStateImportErrF ErrorIdentifier = 10236
+
 	// JSConsumerStoreFailedErrF error creating store for consumer: {err}
 	JSConsumerStoreFailedErrF ErrorIdentifier = 10104
 
 	// JSConsumerStreamIdentityMismatchF consumer's stream identity does not match: {msg}
 	JSConsumerStreamIdentityMismatchF ErrorIdentifier = 10225
 
+	// JSConsumerSubjectPermissionErrF consumer subject not permitted: {err}
+	JSConsumerSubjectPermissionErrF ErrorIdentifier = 10248
+
 	// JSConsumerWQConsumerNotDeliverAllErr consumer must be deliver all on workqueue stream
 	JSConsumerWQConsumerNotDeliverAllErr ErrorIdentifier = 10101
 
@@ -338,6 +374,12 @@ const (
 	// JSMessageCounterBrokenErr message counter is broken
 	JSMessageCounterBrokenErr ErrorIdentifier = 10172
 
+	// JSMessageDelayDisabledErr per-message delay is disabled
+	JSMessageDelayDisabledErr ErrorIdentifier = 10232
+
+	// JSMessageDelayInvalidErr invalid per-message delay
+	JSMessageDelayInvalidErr ErrorIdentifier = 10233
+
 	// JSMessageIncrDisabledErr message counters is disabled
 	JSMessageIncrDisabledErr ErrorIdentifier = 10168
 
@@ -350,6 +392,12 @@ const (
 	// JSMessageIncrPayloadErr message counter has payload
 	JSMessageIncrPayloadErr ErrorIdentifier = 10170
 
+	// JSMessagePriorityDisabledErr per-message priority is disabled
+	JSMessagePriorityDisabledErr ErrorIdentifier = 10245
+
+	// JSMessagePriorityInvalidErr invalid per-message priority
+	JSMessagePriorityInvalidErr ErrorIdentifier = 10246
+
 	// JSMessageSchedulesDisabledErr message schedules is disabled
 	JSMessageSchedulesDisabledErr ErrorIdentifier = 10188
 
@@ -551,6 +599,9 @@ const (
 	// JSStreamInfoMaxSubjectsErr subject details would exceed maximum allowed
 	JSStreamInfoMaxSubjectsErr ErrorIdentifier = 10117
 
+	// JSStreamIngestRateExceededErr stream ingest rate limit exceeded
+	JSStreamIngestRateExceededErr ErrorIdentifier = 10230
+
 	// JSStreamInvalidConfigF Stream configuration validation error string ({err})
 	JSStreamInvalidConfigF ErrorIdentifier = 10052
 
@@ -590,6 +641,15 @@ const (
 	// JSStreamMsgDeleteFailedF Generic message deletion failure error string ({err})
 	JSStreamMsgDeleteFailedF ErrorIdentifier = 10057
 
+	// JSStreamMsgRedactFailedF Generic message redaction failure error string ({err})
+	JSStreamMsgRedactFailedF ErrorIdentifier = 10243
+
+	// JSStreamMsgRedactInvalidErrF message redaction request is invalid: {err}
+	JSStreamMsgRedactInvalidErrF ErrorIdentifier = 10242
+
+	// JSStreamMsgSubjectPermissionErrF message subject not permitted: {err}
+	JSStreamMsgSubjectPermissionErrF ErrorIdentifier = 10251
+
 	// JSStreamNameContainsPathSeparatorsErr Stream name can not contain path separators
 	JSStreamNameContainsPathSeparatorsErr ErrorIdentifier = 10128
 
@@ -611,6 +671,9 @@ const (
 	// JSStreamOfflineReasonErrF stream is offline: {err}
 	JSStreamOfflineReasonErrF ErrorIdentifier = 10194
 
+	// JSStreamPartitionOperationErr operation not allowed on a stream partition, use the partitioned stream
+	JSStreamPartitionOperationErr ErrorIdentifier = 10239
+
 	// JSStreamPurgeFailedF Generic stream purge failure error string ({err})
 	JSStreamPurgeFailedF ErrorIdentifier = 10110
 
@@ -632,6 +695,9 @@ const (
 	// JSStreamRollupFailedF Generic stream rollup failure error string ({err})
 	JSStreamRollupFailedF ErrorIdentifier = 10111
 
+	// JSStreamSchemaValidationFailedErr message failed schema validation: {err}
+	JSStreamSchemaValidationFailedErr ErrorIdentifier = 10234
+
 	// JSStreamSealedErr invalid operation on sealed stream
 	JSStreamSealedErr ErrorIdentifier = 10109
 
@@ -668,6 +734,12 @@ const (
 	// JSStreamUpdateErrF Generic stream update error string ({err})
 	JSStreamUpdateErrF ErrorIdentifier = 10069
 
+	// JSStreamViewCreateErrF stream view create failed: {err}
+	JSStreamViewCreateErrF ErrorIdentifier = 10238
+
+	// JSStreamViewNotFoundErr stream view not found
+	JSStreamViewNotFoundErr ErrorIdentifier = 10237
+
 	// JSStreamWrongLastMsgIDErrF wrong last msg ID: {id}
 	JSStreamWrongLastMsgIDErrF ErrorIdentifier = 10070
 
@@ -692,9 +764,11 @@ var (
 		JSAtomicPublishIncompleteBatchErr:            {Code: 400, ErrCode: 10176, Description: "atomic publish batch is incomplete"},
 		JSAtomicPublishInvalidBatchCommitErr:         {Code: 400, ErrCode: 10200, Description: "atomic publish batch commit is invalid"},
 		JSAtomicPublishInvalidBatchIDErr:             {Code: 400, ErrCode: 10179, Description: "atomic publish batch ID is invalid"},
+		JSAtomicPublishInvalidTxnErrF:                {Code: 400, ErrCode: 10240, Description: "atomic publish transaction is invalid: {err}"},
 		JSAtomicPublishMissingSeqErr:                 {Code: 400, ErrCode: 10175, Description: "atomic publish sequence is missing"},
 		JSAtomicPublishTooLargeBatchErrF:             {Code: 400, ErrCode: 10199, Description: "atomic publish batch is too large: {size}"},
 		JSAtomicPublishTooManyInflight:               {Code: 429, ErrCode: 10210, Description: "atomic publish too many inflight"},
+		JSAtomicPublishTxnAbortedErrF:                {Code: 400, ErrCode: 10241, Description: "atomic publish transaction aborted: {err}"},
 		JSAtomicPublishUnsupportedHeaderBatchErr:     {Code: 400, ErrCode: 10177, Description: "atomic publish unsupported header used: {header}"},
 		JSBadRequestErr:                              {Code: 400, ErrCode: 10003, Description: "bad request"},
 		JSBatchPublishDisabledErr:                    {Code: 400, ErrCode: 10205, Description: "batch publish is disabled"},
@@ -708,6 +782,7 @@ var (
 		JSClusterNotAssignedErr:                      {Code: 500, ErrCode: 10007, Description: "JetStream cluster not assigned to this server"},
 		JSClusterNotAvailErr:                         {Code: 503, ErrCode: 10008, Description: "JetStream system temporarily unavailable"},
 		JSClusterNotLeaderErr:                        {Code: 500, ErrCode: 10009, Description: "JetStream cluster can not handle request"},
+		JSClusterPeerNotLearnerErr:                   {Code: 400, ErrCode: 10249, Description: "peer not a learner"},
 		JSClusterPeerNotMemberErr:                    {Code: 400, ErrCode: 10040, Description: "peer not a member"},
 		JSClusterRequiredErr:                         {Code: 503, ErrCode: 10010, Description: "JetStream clustering support required"},
 		JSClusterRescueErr:                           {Code: 400, ErrCode: 10224, Description: "JetStream system rescue not applied: {err}"},
@@ -729,6 +804,7 @@ var (
 		JSConsumerCreateDurableAndNameMismatch:       {Code: 400, ErrCode: 10132, Description: "Consumer Durable and Name have to be equal if both are provided"},
 		JSConsumerCreateErrF:                         {Code: 500, ErrCode: 10012, Description: "{err}"},
 		JSConsumerCreateFilterSubjectMismatchErr:     {Code: 400, ErrCode: 10131, Description: "Consumer create request did not match filtered subject from create subject"},
+		JSConsumerDeadLetterInvalidErrF:              {Code: 400, ErrCode: 10231, Description: "consumer dead letter configuration is invalid: {err}"},
 		JSConsumerDeliverCycleErr:                    {Code: 400, ErrCode: 10081, Description: "consumer deliver subject forms a cycle"},
 		JSConsumerDeliverToWildcardsErr:              {Code: 400, ErrCode: 10079, Description: "consumer deliver subject has wildcards"},
 		JSConsumerDescriptionTooLongErrF:             {Code: 400, ErrCode: 10107, Description: "consumer description is too long, maximum allowed is {max}"},
@@ -747,13 +823,16 @@ var (
 		JSConsumerFCRequiresPushErr:                  {Code: 400, ErrCode: 10089, Description: "consumer flow control requires a push based consumer"},
 		JSConsumerFilterNotSubsetErr:                 {Code: 400, ErrCode: 10093, Description: "consumer filter subject is not a valid subset of the interest subjects"},
 		JSConsumerHBRequiresPushErr:                  {Code: 400, ErrCode: 10088, Description: "consumer idle heartbeat requires a push based consumer"},
+		JSConsumerHeaderFilterInvalidErrF:            {Code: 400, ErrCode: 10235, Description: "consumer header filter is invalid: {err}"},
 		JSConsumerInactiveThresholdExcess:            {Code: 400, ErrCode: 10153, Description: "consumer inactive threshold exceeds system limit of {limit}"},
 		JSConsumerInvalidDeliverSubject:              {Code: 400, ErrCode: 10112, Description: "invalid push consumer deliver subject"},
 		JSConsumerInvalidGroupNameErr:                {Code: 400, ErrCode: 10162, Description: "Valid priority group name must match A-Z, a-z, 0-9, -_/=)+ and may not exceed 16 characters"},
 		JSConsumerInvalidPolicyErrF:                  {Code: 400, ErrCode: 10094, Description: "{err}"},
 		JSConsumerInvalidPriorityGroupErr:            {Code: 400, ErrCode: 10160, Description: "Provided priority group does not exist for this consumer"},
+		JSConsumerInvalidPriorityWeightsErr:          {Code: 400, ErrCode: 10228, Description: "consumer priority weights must be set for each priority group and be positive"},
 		JSConsumerInvalidResetErr:                    {Code: 400, ErrCode: 10204, Description: "invalid reset: {err}"},
 		JSConsumerInvalidSamplingErrF:                {Code: 400, ErrCode: 10095, Description: "failed to parse consumer sampling configuration: {err}"},
+		JSConsumerLagThresholdsInvalidErrF:           {Code: 400, ErrCode: 10244, Description: "consumer lag thresholds are invalid: {err}"},
 		JSConsumerMaxDeliverBackoffErr:               {Code: 400, ErrCode: 10116, Description: "max deliver is required to be > length of backoff values"},
 		JSConsumerMaxPendingAckExcessErrF:            {Code: 400, ErrCode: 10121, Description: "consumer max ack pending exceeds system limit of {limit}"},
 		JSConsumerMaxPendingAckPolicyRequiredErr:     {Code: 400, ErrCode: 10082, Description: "consumer requires ack policy for max ack pending"},
@@ -762,6 +841,8 @@ var (
 		JSConsumerMaxRequestExpiresTooSmall:          {Code: 400, ErrCode: 10115, Description: "consumer max request expires needs to be >= 1ms"},
 		JSConsumerMaxWaitingNegativeErr:              {Code: 400, ErrCode: 10087, Description: "consumer max waiting needs to be positive"},
 		JSConsumerMetadataLengthErrF:                 {Code: 400, ErrCode: 10135, Description: "consumer metadata exceeds maximum size of {limit}"},
+		JSConsumerMsgDelayRequiresAckExplicitErr:     {Code: 400, ErrCode: 10250, Description: "consumer requires explicit ack policy on a stream with message delays"},
+		JSConsumerMsgPriorityInvalidErrF:             {Code: 400, ErrCode: 10247, Description: "consumer message priority is invalid: {err}"},
 		JSConsumerMultipleFiltersNotAllowed:          {Code: 400, ErrCode: 10137, Description: "consumer with multiple subject filters cannot use subject based API"},
 		JSConsumerNameContainsPathSeparatorsErr:      {Code: 400, ErrCode: 10127, Description: "Consumer name can not contain path separators"},
 		JSConsumerNameExistErr:                       {Code: 400, ErrCode: 10013, Description: "consumer name already in use"},
@@ -774,6 +855,7 @@ var (
 		JSConsumerPinnedTTLWithoutPriorityPolicyNone: {Code: 400, ErrCode: 10197, Description: "PinnedTTL cannot be set when PriorityPolicy is none"},
 		JSConsumerPriorityGroupWithPolicyNone:        {Code: 400, ErrCode: 10196, Description: "consumer can not have priority groups when policy is none"},
 		JSConsumerPriorityPolicyWithoutGroup:         {Code: 400, ErrCode: 10159, Description: "Setting PriorityPolicy requires at least one PriorityGroup to be set"},
+		JSConsumerPriorityWeightsWithoutPolicy:       {Code: 400, ErrCode: 10229, Description: "PriorityWeights can only be set when PriorityPolicy is weighted"},
 		JSConsumerPullNotDurableErr:                  {Code: 400, ErrCode: 10085, Description: "consumer in pull mode requires a durable name"},
 		JSConsumerPullRequiresAckErr:                 {Code: 400, ErrCode: 10084, Description: "consumer in pull mode requires explicit ack policy on workqueue stream"},
 		JSConsumerPullWithRateLimitErr:               {Code: 400, ErrCode: 10086, Description: "consumer in pull mode can not have rate limit set"},
@@ -784,8 +866,10 @@ var (
 		JSConsumerReplicasExceedsStream:              {Code: 400, ErrCode: 10126, Description: "consumer config replica count exceeds parent stream"},
 		JSConsumerReplicasShouldMatchStream:          {Code: 400, ErrCode: 10134, Description: "consumer config replicas must match interest retention stream's replicas"},
 		JSConsumerSmallHeartbeatErr:                  {Code: 400, ErrCode: 10083, Description: "consumer idle heartbeat needs to be >= 100ms"},
+		JSConsumerStateImportErrF:                    {Code: 400, ErrCode: 10236, Description: "consumer state import failed: {err}"},
 		JSConsumerStoreFailedErrF:                    {Code: 500, ErrCode: 10104, Description: "error creating store for consumer: {err}"},
 		JSConsumerStreamIdentityMismatchF:            {Code: 400, ErrCode: 10225, Description: "consumer's stream identity does not match: {msg}"},
+		JSConsumerSubjectPermissionErrF:              {Code: 400, ErrCode: 10248, Description: "consumer subject not permitted: {err}"},
 		JSConsumerWQConsumerNotDeliverAllErr:         {Code: 400, ErrCode: 10101, Description: "consumer must be deliver all on workqueue stream"},
 		JSConsumerWQConsumerNotUniqueErr:             {Code: 400, ErrCode: 10100, Description: "filtered consumer not unique on workqueue stream"},
 		JSConsumerWQMultipleUnfilteredErr:            {Code: 400, ErrCode: 10099, Description: "multiple non-filtered consumers not allowed on workqueue stream"},
@@ -797,10 +881,14 @@ var (
 		JSMaximumStreamsLimitErr:                     {Code: 400, ErrCode: 10027, Description: "maximum number of streams reached"},
 		JSMemoryResourcesExceededErr:                 {Code: 500, ErrCode: 10028, Description: "insufficient memory resources available"},
 		JSMessageCounterBrokenErr:                    {Code: 400, ErrCode: 10172, Description: "message counter is broken"},
+		JSMessageDelayDisabledErr:                    {Code: 400, ErrCode: 10232, Description: "per-message delay is disabled"},
+		JSMessageDelayInvalidErr:                     {Code: 400, ErrCode: 10233, Description: "invalid per-message delay"},
 		JSMessageIncrDisabledErr:                     {Code: 400, ErrCode: 10168, Description: "message counters is disabled"},
 		JSMessageIncrInvalidErr:                      {Code: 400, ErrCode: 10171, Description: "message counter increment is invalid"},
 		JSMessageIncrMissingErr:                      {Code: 400, ErrCode: 10169, Description: "message counter increment is missing"},
 		JSMessageIncrPayloadErr:                      {Code: 400, ErrCode: 10170, Description: "message counter has payload"},
+		JSMessagePriorityDisabledErr:                 {Code: 400, ErrCode: 10245, Description: "per-message priority is disabled"},
+		JSMessagePriorityInvalidErr:                  {Code: 400, ErrCode: 10246, Description: "invalid per-message priority"},
 		JSMessageSchedulesDisabledErr:                {Code: 400, ErrCode: 10188, Description: "message schedules is disabled"},
 		JSMessageSchedulesPatternInvalidErr:          {Code: 400, ErrCode: 10189, Description: "message schedules pattern is invalid"},
 		JSMessageSchedulesRollupInvalidErr:           {Code: 400, ErrCode: 10192, Description: "message schedules invalid rollup"},
@@ -868,6 +956,7 @@ var (
 		JSStreamGeneralErrorF:                        {Code: 500, ErrCode: 10051, Description: "{err}"},
 		JSStreamHeaderExceedsMaximumErr:              {Code: 400, ErrCode: 10097, Description: "header size exceeds maximum allowed of 64k"},
 		JSStreamInfoMaxSubjectsErr:                   {Code: 500, ErrCode: 10117, Description: "subject details would exceed maximum allowed"},
+		JSStreamIngestRateExceededErr:                {Code: 429, ErrCode: 10230, Description: "stream ingest rate limit exceeded"},
 		JSStreamInvalidConfigF:                       {Code: 500, ErrCode: 10052, Description: "{err}"},
 		JSStreamInvalidErr:                           {Code: 500, ErrCode: 10096, Description: "stream not valid"},
 		JSStreamInvalidExternalDeliverySubjErrF:      {Code: 400, ErrCode: 10024, Description: "stream external delivery prefix {prefix} must not contain wildcards"},
@@ -881,6 +970,9 @@ var (
 		JSStreamMoveAndScaleErr:                      {Code: 400, ErrCode: 10123, Description: "can not move and scale a stream in a single update"},
 		JSStreamMoveInProgressErr:                    {Code: 400, ErrCode: 10124, Description: "stream move already in progress"},
 		JSStreamMsgDeleteFailedF:                     {Code: 500, ErrCode: 10057, Description: "{err}"},
+		JSStreamMsgRedactFailedF:                     {Code: 500, ErrCode: 10243, Description: "{err}"},
+		JSStreamMsgRedactInvalidErrF:                 {Code: 400, ErrCode: 10242, Description: "message redaction request is invalid: {err}"},
+		JSStreamMsgSubjectPermissionErrF:             {Code: 403, ErrCode: 10251, Description: "message subject not permitted: {err}"},
 		JSStreamNameContainsPathSeparatorsErr:        {Code: 400, ErrCode: 10128, Description: "Stream name can not contain path separators"},
 		JSStreamNameExistErr:                         {Code: 400, ErrCode: 10058, Description: "stream name already in use with a different configuration"},
 		JSStreamNameExistRestoreFailedErr:            {Code: 400, ErrCode: 10130, Description: "stream name already in use, cannot restore"},
@@ -888,6 +980,7 @@ var (
 		JSStreamNotMatchErr:                          {Code: 400, ErrCode: 10060, Description: "expected stream does not match"},
 		JSStreamOfflineErr:                           {Code: 500, ErrCode: 10118, Description: "stream is offline"},
 		JSStreamOfflineReasonErrF:                    {Code: 500, ErrCode: 10194, Description: "stream is offline: {err}"},
+		JSStreamPartitionOperationErr:                {Code: 400, ErrCode: 10239, Description: "operation not allowed on a stream partition, use the partitioned stream"},
 		JSStreamPurgeFailedF:                         {Code: 500, ErrCode: 10110, Description: "{err}"},
 		JSStreamReconfigureInProgressErr:             {Code: 400, ErrCode: 10226, Description: "stream reconfiguration already in progress"},
 		JSStreamReconfigureNotInProgressErr:          {Code: 400, ErrCode: 10129, Description: "stream reconfiguration not in progress"},
@@ -895,6 +988,7 @@ var (
 		JSStreamReplicasNotUpdatableErr:              {Code: 400, ErrCode: 10061, Description: "Replicas configuration can not be updated"},
 		JSStreamRestoreErrF:                          {Code: 500, ErrCode: 10062, Description: "restore failed: {err}"},
 		JSStreamRollupFailedF:                        {Code: 500, ErrCode: 10111, Description: "{err}"},
+		JSStreamSchemaValidationFailedErr:            {Code: 400, ErrCode: 10234, Description: "message failed schema validation: {err}"},
 		JSStreamSealedErr:                            {Code: 400, ErrCode: 10109, Description: "invalid operation on sealed stream"},
 		JSStreamSequenceNotMatchErr:                  {Code: 503, ErrCode: 10063, Description: "expected stream sequence does not match"},
 		JSStreamSnapshotErrF:                         {Code: 500, ErrCode: 10064, Description: "snapshot failed: {err}"},
@@ -907,6 +1001,8 @@ var (
 		JSStreamTransformInvalidDestination:          {Code: 400, ErrCode: 10156, Description: "stream transform: {err}"},
 		JSStreamTransformInvalidSource:               {Code: 400, ErrCode: 10155, Description: "stream transform source: {err}"},
 		JSStreamUpdateErrF:                           {Code: 500, ErrCode: 10069, Description: "{err}"},
+		JSStreamViewCreateErrF:                       {Code: 400, ErrCode: 10238, Description: "stream view create failed: {err}"},
+		JSStreamViewNotFoundErr:                      {Code: 404, ErrCode: 10237, Description: "stream view not found"},
 		JSStreamWrongLastMsgIDErrF:                   {Code: 400, ErrCode: 10070, Description: "wrong last msg ID: {id}"},
 		JSStreamWrongLastSequenceConstantErr:         {Code: 400, ErrCode: 10164, Description: "wrong last sequence"},
 		JSStreamWrongLastSequenceErrF:                {Code: 400, ErrCode: 10071, Description: "wrong last sequence: {seq}"},
@@ -997,6 +1093,22 @@ func NewJSAtomicPublishInvalidBatchIDError(opts ...ErrorOption) *ApiError {
 	return ApiErrors[JSAtomicPublishInvalidBatchIDErr]
 }
 
+// NewJSAtomicPublishInvalidTxnError creates a new JSAtomicPublishInvalidTxnErrF error: "atomic publish transaction is invalid: {err}"
+func NewJSAtomicPublishInvalidTxnError(err error, opts ...ErrorOption) *ApiError {
+	eopts := parseOpts(opts)
+	if ae, ok := eopts.err.(*ApiError); ok {
+		return ae
+	}
+
+	e := ApiErrors[JSAtomicPublishInvalidTxnErrF]
+	args := e.toReplacerArgs([]interface{}{"{err}", err})
+	return &ApiError{
+		Code:        e.Code,
+		ErrCode:     e.ErrCode,
+		Description: strings.NewReplacer(args...).Replace(e.Description),
+	}
+}
+
 // NewJSAtomicPublishMissingSeqError creates a new JSAtomicPublishMissingSeqErr error: "atomic publish sequence is missing"
 func NewJSAtomicPublishMissingSeqError(opts ...ErrorOption) *ApiError {
 	eopts := parseOpts(opts)
@@ -1033,6 +1145,22 @@ func NewJSAtomicPublishTooManyInflightError(opts ...ErrorOption) *ApiError {
 	return ApiErrors[JSAtomicPublishTooManyInflight]
 }
 
+// NewJSAtomicPublishTxnAbortedError creates a new JSAtomicPublishTxnAbortedErrF error: "atomic publish transaction aborted: {err}"
+func NewJSAtomicPublishTxnAbortedError(err error, opts ...ErrorOption) *ApiError {
+	eopts := parseOpts(opts)
+	if ae, ok := eopts.err.(*ApiError); ok {
+		return ae
+	}
+
+	e := ApiErrors[JSAtomicPublishTxnAbortedErrF]
+	args := e.toReplacerArgs([]interface{}{"{err}", err})
+	return &ApiError{
+		Code:        e.Code,
+		ErrCode:     e.ErrCode,
+		Description: strings.NewReplacer(args...).Replace(e.Description),
+	}
+}
+
 // NewJSAtomicPublishUnsupportedHeaderBatchError creates a new JSAtomicPublishUnsupportedHeaderBatchErr error: "atomic publish unsupported header used: {header}"
 func NewJSAtomicPublishUnsupportedHeaderBatchError(header interface{}, opts ...ErrorOption) *ApiError {
 	eopts := parseOpts(opts)
@@ -1175,6 +1303,16 @@ func NewJSClusterNotLeaderError(opts ...ErrorOption) *ApiError {
 	return ApiErrors[JSClusterNotLeaderErr]
 }
 
+// NewJSClusterPeerNotLearnerError creates a new JSClusterPeerNotLearnerErr error: "peer not a learner"
+func NewJSClusterPeerNotLearnerError(opts ...ErrorOption) *ApiError {
+	eopts := parseOpts(opts)
+	if ae, ok := eopts.err.(*ApiError); ok {
+		return ae
+	}
+
+	return ApiErrors[JSClusterPeerNotLearnerErr]
+}
+
 // NewJSClusterPeerNotMemberError creates a new JSClusterPeerNotMemberErr error: "peer not a member"
 func NewJSClusterPeerNotMemberError(opts ...ErrorOption) *ApiError {
 	eopts := parseOpts(opts)
@@ -1397,6 +1535,22 @@ func NewJSConsumerCreateFilterSubjectMismatchError(opts ...ErrorOption) *ApiErro
 	return ApiErrors[JSConsumerCreateFilterSubjectMismatchErr]
 }
 
+// NewJSConsumerDeadLetterInvalidError creates a new JSConsumerDeadLetterInvalidErrF error: "consumer dead letter configuration is invalid: {err}"
+func NewJSConsumerDeadLetterInvalidError(err error, opts ...ErrorOption) *ApiError {
+	eopts := parseOpts(opts)
+	if ae, ok := eopts.err.(*ApiError); ok {
+		return ae
+	}
+
+	e := ApiErrors[JSConsumerDeadLetterInvalidErrF]
+	args := e.toReplacerArgs([]interface{}{"{err}", err})
+	return &ApiError{
+		Code:        e.Code,
+		ErrCode:     e.ErrCode,
+		Description: strings.NewReplacer(args...).Replace(e.Description),
+	}
+}
+
 // NewJSConsumerDeliverCycleError creates a new JSConsumerDeliverCycleErr error: "consumer deliver subject forms a cycle"
 func NewJSConsumerDeliverCycleError(opts ...ErrorOption) *ApiError {
 	eopts := parseOpts(opts)
@@ -1583,6 +1737,22 @@ func NewJSConsumerHBRequiresPushError(opts ...ErrorOption) *ApiError {
 	return ApiErrors[JSConsumerHBRequiresPushErr]
 }
 
+// NewJSConsumerHeaderFilterInvalidError creates a new JSConsumerHeaderFilterInvalidErrF error: "consumer header filter is invalid: {err}"
+func NewJSConsumerHeaderFilterInvalidError(err error, opts ...ErrorOption) *ApiError {
+	eopts := parseOpts(opts)
+	if ae, ok := eopts.err.(*ApiError); ok {
+		return ae
+	}
+
+	e := ApiErrors[JSConsumerHeaderFilterInvalidErrF]
+	args := e.toReplacerArgs([]interface{}{"{err}", err})
+	return &ApiError{
+		Code:        e.Code,
+		ErrCode:     e.ErrCode,
+		Description: strings.NewReplacer(args...).Replace(e.Description),
+	}
+}
+
 // NewJSConsumerInactiveThresholdExcessError creates a new JSConsumerInactiveThresholdExcess error: "consumer inactive threshold exceeds system limit of {limit}"
 func NewJSConsumerInactiveThresholdExcessError(limit interface{}, opts ...ErrorOption) *ApiError {
 	eopts := parseOpts(opts)
@@ -1645,6 +1815,16 @@ func NewJSConsumerInvalidPriorityGroupError(opts ...ErrorOption) *ApiError {
 	return ApiErrors[JSConsumerInvalidPriorityGroupErr]
 }
 
+// NewJSConsumerInvalidPriorityWeightsError creates a new JSConsumerInvalidPriorityWeightsErr error: "consumer priority weights must be set for each priority group and be positive"
+func NewJSConsumerInvalidPriorityWeightsError(opts ...ErrorOption) *ApiError {
+	eopts := parseOpts(opts)
+	if ae, ok := eopts.err.(*ApiError); ok {
+		return ae
+	}
+
+	return ApiErrors[JSConsumerInvalidPriorityWeightsErr]
+}
+
 // NewJSConsumerInvalidResetError creates a new JSConsumerInvalidResetErr error: "invalid reset: {err}"
 func NewJSConsumerInvalidResetError(err error, opts ...ErrorOption) *ApiError {
 	eopts := parseOpts(opts)
@@ -1677,6 +1857,22 @@ func NewJSConsumerInvalidSamplingError(err error, opts ...ErrorOption) *ApiError
 	}
 }
 
+// NewJSConsumerLagThresholdsInvalidError creates a new JSConsumerLagThresholdsInvalidErrF error: "consumer lag thresholds are invalid: {err}"
+func NewJSConsumerLagThresholdsInvalidError(err error, opts ...ErrorOption) *ApiError {
+	eopts := parseOpts(opts)
+	if ae, ok := eopts.err.(*ApiError); ok {
+		return ae
+	}
+
+	e := ApiErrors[JSConsumerLagThresholdsInvalidErrF]
+	args := e.toReplacerArgs([]interface{}{"{err}", err})
+	return &ApiError{
+		Code:        e.Code,
+		ErrCode:     e.ErrCode,
+		Description: strings.NewReplacer(args...).Replace(e.Description),
+	}
+}
+
 // NewJSConsumerMaxDeliverBackoffError creates a new JSConsumerMaxDeliverBackoffErr error: "max deliver is required to be > length of backoff values"
 func NewJSConsumerMaxDeliverBackoffError(opts ...ErrorOption) *ApiError {
 	eopts := parseOpts(opts)
@@ -1775,6 +1971,32 @@ func NewJSConsumerMetadataLengthError(limit interface{}, opts ...ErrorOption) *A
 	}
 }
 
+// NewJSConsumerMsgDelayRequiresAckExplicitError creates a new JSConsumerMsgDelayRequiresAckExplicitErr error: "consumer requires explicit ack policy on a stream with message delays"
+func NewJSConsumerMsgDelayRequiresAckExplicitError(opts ...ErrorOption) *ApiError {
+	eopts := parseOpts(opts)
+	if ae, ok := eopts.err.(*ApiError); ok {
+		return ae
+	}
+
+	return ApiErrors[JSConsumerMsgDelayRequiresAckExplicitErr]
+}
+
+// NewJSConsumerMsgPriorityInvalidError creates a new JSConsumerMsgPriorityInvalidErrF error: "consumer message priority is invalid: {err}"
+func NewJSConsumerMsgPriorityInvalidError(err error, opts ...ErrorOption) *ApiError {
+	eopts := parseOpts(opts)
+	if ae, ok := eopts.err.(*ApiError); ok {
+		return ae
+	}
+
+	e := ApiErrors[JSConsumerMsgPriorityInvalidErrF]
+	args := e.toReplacerArgs([]interface{}{"{err}", err})
+	return &ApiError{
+		Code:        e.Code,
+		ErrCode:     e.ErrCode,
+		Description: strings.NewReplacer(args...).Replace(e.Description),
+	}
+}
+
 // NewJSConsumerMultipleFiltersNotAllowedError creates a new JSConsumerMultipleFiltersNotAllowed error: "consumer with multiple subject filters cannot use subject based API"
 func NewJSConsumerMultipleFiltersNotAllowedError(opts ...ErrorOption) *ApiError {
 	eopts := parseOpts(opts)
@@ -1907,6 +2129,16 @@ func NewJSConsumerPriorityPolicyWithoutGroupError(opts ...ErrorOption) *ApiError
 	return ApiErrors[JSConsumerPriorityPolicyWithoutGroup]
 }
 
+// NewJSConsumerPriorityWeightsWithoutPolicyError creates a new JSConsumerPriorityWeightsWithoutPolicy error: "PriorityWeights can only be set when PriorityPolicy is weighted"
+func NewJSConsumerPriorityWeightsWithoutPolicyError(opts ...ErrorOption) *ApiError {
+	eopts := parseOpts(opts)
+	if ae, ok := eopts.err.(*ApiError); ok {
+		return ae
+	}
+
+	return ApiErrors[JSConsumerPriorityWeightsWithoutPolicy]
+}
+
 // NewJSConsumerPullNotDurableError creates a new JSConsumerPullNotDurableErr error: "consumer in pull mode requires a durable name"
 func NewJSConsumerPullNotDurableError(opts ...ErrorOption) *ApiError {
 	eopts := parseOpts(opts)
@@ -2007,6 +2239,22 @@ func NewJSConsumerSmallHeartbeatError(opts ...ErrorOption) *ApiError {
 	return ApiErrors[JSConsumerSmallHeartbeatErr]
 }
 
+// NewJSConsumerStateImportError creates a new JSConsumerStateImportErrF error: "consumer state import failed: {err}"
+func NewJSConsumerStateImportError(err error, opts ...ErrorOption) *ApiError {
+	eopts := parseOpts(opts)
+	if ae, ok := eopts.err.(*ApiError); ok {
+		return ae
+	}
+
+	e := ApiErrors[JSConsumerStateImportErrF]
+	args := e.toReplacerArgs([]interface{}{"{err}", err})
+	return &ApiError{
+		Code:        e.Code,
+		ErrCode:     e.ErrCode,
+		Description: strings.NewReplacer(args...).Replace(e.Description),
+	}
+}
+
 // NewJSConsumerStoreFailedError creates a new JSConsumerStoreFailedErrF error: "error creating store for consumer: {err}"
 func NewJSConsumerStoreFailedError(err error, opts ...ErrorOption) *ApiError {
 	eopts := parseOpts(opts)
@@ -2039,6 +2287,22 @@ func NewJSConsumerStreamIdentityMismatchError(msg interface{}, opts ...ErrorOpti
 	}
 }
 
+// NewJSConsumerSubjectPermissionError creates a new JSConsumerSubjectPermissionErrF error: "consumer subject not permitted: {err}"
+func NewJSConsumerSubjectPermissionError(err error, opts ...ErrorOption) *ApiError {
+	eopts := parseOpts(opts)
+	if ae, ok := eopts.err.(*ApiError); ok {
+		return ae
+	}
+
+	e := ApiErrors[JSConsumerSubjectPermissionErrF]
+	args := e.toReplacerArgs([]interface{}{"{err}", err})
+	return &ApiError{
+		Code:        e.Code,
+		ErrCode:     e.ErrCode,
+		Description: strings.NewReplacer(args...).Replace(e.Description),
+	}
+}
+
 // NewJSConsumerWQConsumerNotDeliverAllError creates a new JSConsumerWQConsumerNotDeliverAllErr error: "consumer must be deliver all on workqueue stream"
 func NewJSConsumerWQConsumerNotDeliverAllError(opts ...ErrorOption) *ApiError {
 	eopts := parseOpts(opts)
@@ -2155,6 +2419,26 @@ func NewJSMessageCounterBrokenError(opts ...ErrorOption) *ApiError {
 	return ApiErrors[JSMessageCounterBrokenErr]
 }
 
+// NewJSMessageDelayDisabledError creates a new JSMessageDelayDisabledErr error: "per-message delay is disabled"
+func NewJSMessageDelayDisabledError(opts ...ErrorOption) *ApiError {
+	eopts := parseOpts(opts)
+	if ae, ok := eopts.err.(*ApiError); ok {
+		return ae
+	}
+
+	return ApiErrors[JSMessageDelayDisabledErr]
+}
+
+// NewJSMessageDelayInvalidError creates a new JSMessageDelayInvalidErr error: "invalid per-message delay"
+func NewJSMessageDelayInvalidError(opts ...ErrorOption) *ApiError {
+	eopts := parseOpts(opts)
+	if ae, ok := eopts.err.(*ApiError); ok {
+		return ae
+	}
+
+	return ApiErrors[JSMessageDelayInvalidErr]
+}
+
 // NewJSMessageIncrDisabledError creates a new JSMessageIncrDisabledErr error: "message counters is disabled"
 func NewJSMessageIncrDisabledError(opts ...ErrorOption) *ApiError {
 	eopts := parseOpts(opts)
@@ -2195,6 +2479,26 @@ func NewJSMessageIncrPayloadError(opts ...ErrorOption) *ApiError {
 	return ApiErrors[JSMessageIncrPayloadErr]
 }
 
+// NewJSMessagePriorityDisabledError creates a new JSMessagePriorityDisabledErr error: "per-message priority is disabled"
+func NewJSMessagePriorityDisabledError(opts ...ErrorOption) *ApiError {
+	eopts := parseOpts(opts)
+	if ae, ok := eopts.err.(*ApiError); ok {
+		return ae
+	}
+
+	return ApiErrors[JSMessagePriorityDisabledErr]
+}
+
+// NewJSMessagePriorityInvalidError creates a new JSMessagePriorityInvalidErr error: "invalid per-message priority"
+func NewJSMessagePriorityInvalidError(opts ...ErrorOption) *ApiError {
+	eopts := parseOpts(opts)
+	if ae, ok := eopts.err.(*ApiError); ok {
+		return ae
+	}
+
+	return ApiErrors[JSMessagePriorityInvalidErr]
+}
+
 // NewJSMessageSchedulesDisabledError creates a new JSMessageSchedulesDisabledErr error: "message schedules is disabled"
 func NewJSMessageSchedulesDisabledError(opts ...ErrorOption) *ApiError {
 	eopts := parseOpts(opts)
@@ -2961,6 +3265,16 @@ func NewJSStreamInfoMaxSubjectsError(opts ...ErrorOption) *ApiError {
 	return ApiErrors[JSStreamInfoMaxSubjectsErr]
 }
 
+// NewJSStreamIngestRateExceededError creates a new JSStreamIngestRateExceededErr error: "stream ingest rate limit exceeded"
+func NewJSStreamIngestRateExceededError(opts ...ErrorOption) *ApiError {
+	eopts := parseOpts(opts)
+	if ae, ok := eopts.err.(*ApiError); ok {
+		return ae
+	}
+
+	return ApiErrors[JSStreamIngestRateExceededErr]
+}
+
 // NewJSStreamInvalidConfigError creates a new JSStreamInvalidConfigF error: "{err}"
 func NewJSStreamInvalidConfigError(err error, opts ...ErrorOption) *ApiError {
 	eopts := parseOpts(opts)
@@ -3115,6 +3429,54 @@ func NewJSStreamMsgDeleteFailedError(err error, opts ...ErrorOption) *ApiError {
 	}
 }
 
+// NewJSStreamMsgRedactFailedError creates a new JSStreamMsgRedactFailedF error: "{err}"
+func NewJSStreamMsgRedactFailedError(err error, opts ...ErrorOption) *ApiError {
+	eopts := parseOpts(opts)
+	if ae, ok := eopts.err.(*ApiError); ok {
+		return ae
+	}
+
+	e := ApiErrors[JSStreamMsgRedactFailedF]
+	args := e.toReplacerArgs([]interface{}{"{err}", err})
+	return &ApiError{
+		Code:        e.Code,
+		ErrCode:     e.ErrCode,
+		Description: strings.NewReplacer(args...).Replace(e.Description),
+	}
+}
+
+// NewJSStreamMsgRedactInvalidError creates a new JSStreamMsgRedactInvalidErrF error: "message redaction request is invalid: {err}"
+func NewJSStreamMsgRedactInvalidError(err error, opts ...ErrorOption) *ApiError {
+	eopts := parseOpts(opts)
+	if ae, ok := eopts.err.(*ApiError); ok {
+		return ae
+	}
+
+	e := ApiErrors[JSStreamMsgRedactInvalidErrF]
+	args := e.toReplacerArgs([]interface{}{"{err}", err})
+	return &ApiError{
+		Code:        e.Code,
+		ErrCode:     e.ErrCode,
+		Description: strings.NewReplacer(args...).Replace(e.Description),
+	}
+}
+
+// NewJSStreamMsgSubjectPermissionError creates a new JSStreamMsgSubjectPermissionErrF error: "message subject not permitted: {err}"
+func NewJSStreamMsgSubjectPermissionError(err error, opts ...ErrorOption) *ApiError {
+	eopts := parseOpts(opts)
+	if ae, ok := eopts.err.(*ApiError); ok {
+		return ae
+	}
+
+	e := ApiErrors[JSStreamMsgSubjectPermissionErrF]
+	args := e.toReplacerArgs([]interface{}{"{err}", err})
+	return &ApiError{
+		Code:        e.Code,
+		ErrCode:     e.ErrCode,
+		Description: strings.NewReplacer(args...).Replace(e.Description),
+	}
+}
+
 // NewJSStreamNameContainsPathSeparatorsError creates a new JSStreamNameContainsPathSeparatorsErr error: "Stream name can not contain path separators"
 func NewJSStreamNameContainsPathSeparatorsError(opts ...ErrorOption) *ApiError {
 	eopts := parseOpts(opts)
@@ -3191,6 +3553,16 @@ func NewJSStreamOfflineReasonError(err error, opts ...ErrorOption) *ApiError {
 	}
 }
 
+// NewJSStreamPartitionOperationError creates a new JSStreamPartitionOperationErr error: "operation not allowed on a stream partition, use the partitioned stream"
+func NewJSStreamPartitionOperationError(opts ...ErrorOption) *ApiError {
+	eopts := parseOpts(opts)
+	if ae, ok := eopts.err.(*ApiError); ok {
+		return ae
+	}
+
+	return ApiErrors[JSStreamPartitionOperationErr]
+}
+
 // NewJSStreamPurgeFailedError creates a new JSStreamPurgeFailedF error: "{err}"
 func NewJSStreamPurgeFailedError(err error, opts ...ErrorOption) *ApiError {
 	eopts := parseOpts(opts)
@@ -3279,6 +3651,22 @@ func NewJSStreamRollupFailedError(err error, opts ...ErrorOption) *ApiError {
 	}
 }
 
+// NewJSStreamSchemaValidationFailedError creates a new JSStreamSchemaValidationFailedErr error: "message failed schema validation: {err}"
+func NewJSStreamSchemaValidationFailedError(err error, opts ...ErrorOption) *ApiError {
+	eopts := parseOpts(opts)
+	if ae, ok := eopts.err.(*ApiError); ok {
+		return ae
+	}
+
+	e := ApiErrors[JSStreamSchemaValidationFailedErr]
+	args := e.toReplacerArgs([]interface{}{"{err}", err})
+	return &ApiError{
+		Code:        e.Code,
+		ErrCode:     e.ErrCode,
+		Description: strings.NewReplacer(args...).Replace(e.Description),
+	}
+}
+
 // NewJSStreamSealedError creates a new JSStreamSealedErr error: "invalid operation on sealed stream"
 func NewJSStreamSealedError(opts ...ErrorOption) *ApiError {
 	eopts := parseOpts(opts)
@@ -3441,6 +3829,32 @@ func NewJSStreamUpdateError(err error, opts ...ErrorOption) *ApiError {
 	}
 }
 
+// NewJSStreamViewCreateError creates a new JSStreamViewCreateErrF error: "stream view create failed: {err}"
+func NewJSStreamViewCreateError(err error, opts ...ErrorOption) *ApiError {
+	eopts := parseOpts(opts)
+	if ae, ok := eopts.err.(*ApiError); ok {
+		return ae
+	}
+
+	e := ApiErrors[JSStreamViewCreateErrF]
+	args := e.toReplacerArgs([]interface{}{"{err}", err})
+	return &ApiError{
+		Code:        e.Code,
+		ErrCode:     e.ErrCode,
+		Description: strings.NewReplacer(args...).Replace(e.Description),
+	}
+}
+
+// NewJSStreamViewNotFoundError creates a new JSStreamViewNotFoundErr error: "stream view not found"
+func NewJSStreamViewNotFoundError(opts ...ErrorOption) *ApiError {
+	eopts := parseOpts(opts)
+	if ae, ok := eopts.err.(*ApiError); ok {
+		return ae
+	}
+
+	return ApiErrors[JSStreamViewNotFoundErr]
+}
+
 // NewJSStreamWrongLastMsgIDError creates a new JSStreamWrongLastMsgIDErrF error: "wrong last msg ID: {id}"
 func NewJSStreamWrongLastMsgIDError(id interface{}, opts ...ErrorOption) *ApiError {
 	eopts := parseOpts(opts)
@@ -162,6 +162,23 @@ type JSConsumerDeliveryTerminatedAdvisory struct {
 // JSConsumerDeliveryTerminatedAdvisoryType is the schema type for JSConsumerDeliveryTerminatedAdvisory
 const JSConsumerDeliveryTerminatedAdvisoryType = "io.nats.jetstream.advisory.v1.terminated"
 
+// JSConsumerDeadLetterFailedAdvisory is an advisory informing that a message could
+// not be copied into the dead letter stream of the consumer
+type JSConsumerDeadLetterFailedAdvisory struct {
+	TypedEvent
+	Stream      string `json:"stream"`
+	Consumer    string `json:"consumer"`
+	ConsumerSeq uint64 `json:"consumer_seq"`
+	StreamSeq   uint64 `json:"stream_seq"`
+	Deliveries  uint64 `json:"deliveries"`
+	Cause       string `json:"cause"`
+	Error       string `json:"error"`
+	Domain      string `json:"domain,omitempty"`
+}
+
+// JSConsumerDeadLetterFailedAdvisoryType is the schema type for JSConsumerDeadLetterFailedAdvisory
+const JSConsumerDeadLetterFailedAdvisoryType = "io.nats.jetstream.advisory.v1.dead_letter_failed"
+
 // JSSnapshotCreateAdvisory is an advisory sent after a snapshot is successfully started
 type JSSnapshotCreateAdvisory struct {
 	TypedEvent
@@ -273,8 +290,29 @@ var (
 	BatchLarge              BatchAbandonReason = "large"
 	BatchIncomplete         BatchAbandonReason = "incomplete"
 	BatchRequirementsNotMet BatchAbandonReason = "unsupported"
+	// The transaction the batch is part of was aborted.
+	BatchTxnAborted BatchAbandonReason = "txn_aborted"
+	// The record of the prepared batch could not be kept, so the transaction aborts.
+	BatchTxnFailed BatchAbandonReason = "txn_failed"
 )
 
+// JSStreamMsgRedactedAdvisoryType is sent when a stream message is redacted.
+const JSStreamMsgRedactedAdvisoryType = "io.nats.jetstream.advisory.v1.stream_msg_redacted"
+
+// JSStreamMsgRedactedAdvisory indicates that a stream message was redacted.
+// Client is not set when the redaction came from the stream we mirror or source from.
+type JSStreamMsgRedactedAdvisory struct {
+	TypedEvent
+	Account  string      `json:"account,omitempty"`
+	Stream   string      `json:"stream"`
+	Sequence uint64      `json:"seq"`
+	Subject  string      `json:"subject"`
+	Headers  []string    `json:"headers,omitempty"`
+	Reason   string      `json:"reason,omitempty"`
+	Client   *ClientInfo `json:"client,omitempty"`
+	Domain   string      `json:"domain,omitempty"`
+}
+
 // JSConsumerLeaderElectedAdvisoryType is sent when the system elects a leader for a consumer.
 const JSConsumerLeaderElectedAdvisoryType = "io.nats.jetstream.advisory.v1.consumer_leader_elected"
 
@@ -330,6 +368,27 @@ type JSConsumerGroupUnpinnedAdvisory struct {
 	Reason string `json:"reason"`
 }
 
+// JSConsumerLagAdvisoryType is sent when a consumer reaches or recovers from a lag threshold.
+const JSConsumerLagAdvisoryType = "io.nats.jetstream.advisory.v1.consumer_lag"
+
+// JSConsumerLagAdvisory indicates that a consumer is lagging behind, or recovered.
+type JSConsumerLagAdvisory struct {
+	TypedEvent
+	Account  string `json:"account,omitempty"`
+	Stream   string `json:"stream"`
+	Consumer string `json:"consumer"`
+	Domain   string `json:"domain,omitempty"`
+	// one of "num_pending", "num_ack_pending" or "ack_pending_age", the age is in nanoseconds
+	Metric    string `json:"metric"`
+	Lagging   bool   `json:"lagging"`
+	Value     int64  `json:"value"`
+	Threshold int64  `json:"threshold"`
+	// The consumer's state at the time of the advisory.
+	NumPending    uint64        `json:"num_pending"`
+	NumAckPending int           `json:"num_ack_pending"`
+	AckPendingAge time.Duration `json:"ack_pending_age,omitempty"`
+}
+
 // JSServerOutOfStorageAdvisoryType is sent when the server is out of storage space.
 const JSServerOutOfStorageAdvisoryType = "io.nats.jetstream.advisory.v1.server_out_of_space"
 
@@ -343,6 +402,28 @@ type JSServerOutOfSpaceAdvisory struct {
 	Domain   string `json:"domain,omitempty"`
 }
 
+// JSStoreCorruptionAdvisoryType is sent when scrubbing finds a corrupt block in a store or Raft log.
+const JSStoreCorruptionAdvisoryType = "io.nats.jetstream.advisory.v1.store_corruption"
+
+// JSStoreCorruptionAdvisory indicates that a block of a stream store or Raft log is corrupt,
+// and whether the replica was reset to repair it from the leader.
+type JSStoreCorruptionAdvisory struct {
+	TypedEvent
+	Server   string `json:"server"`
+	ServerID string `json:"server_id"`
+	Account  string `json:"account,omitempty"`
+	Stream   string `json:"stream,omitempty"`
+	Consumer string `json:"consumer,omitempty"`
+	Group    string `json:"group,omitempty"`
+	Block    uint32 `json:"block"`
+	FirstSeq uint64 `json:"first_seq"`
+	LastSeq  uint64 `json:"last_seq"`
+	Error    string `json:"error"`
+	Repaired bool   `json:"repaired"`
+	Cluster  string `json:"cluster"`
+	Domain   string `json:"domain,omitempty"`
+}
+
 // JSServerRemovedAdvisoryType is sent when the server has been removed and JS disabled.
 const JSServerRemovedAdvisoryType = "io.nats.jetstream.advisory.v1.server_removed"
 
@@ -2330,3 +2330,56 @@ func TestJetStreamAccountResolverNoFetchIfNotMember(t *testing.T) {
 	}
 	require_LessThan(t, time.Since(start), 100*time.Millisecond)
 }
+
+func TestJetStreamJWTConsumerSubjectPermissions(t *testing.T) {
+	_, sysPub := createKey(t)
+	sysJwt := encodeClaim(t, jwt.NewAccountClaims(sysPub), sysPub)
+	accKp, accPub := createKey(t)
+	skKp, skPub := createKey(t)
+	aClaim := jwt.NewAccountClaims(accPub)
+	aClaim.Limits.JetStreamLimits = jwt.JetStreamLimits{MemoryStorage: -1, DiskStorage: -1, Streams: -1, Consumer: -1}
+	// Users signed by the scoped signing key get their permissions from the scope template.
+	scope := jwt.NewUserScope()
+	scope.Key = skPub
+	scope.Template.Sub.Allow.Add("orders.{{tag(region)}}.>", "_INBOX.>")
+	aClaim.SigningKeys.AddScopedSigner(scope)
+	accJwt := encodeClaim(t, aClaim, accPub)
+
+	conf := createConfFile(t, []byte(fmt.Sprintf(`
+		listen: 127.0.0.1:-1
+		jetstream: {store_dir: %q}
+		operator: %s
+		system_account: %s
+		resolver: MEMORY
+		resolver_preload: {
+			%s: %s
+			%s: %s
+		}
+	`, t.TempDir(), ojwt, sysPub, sysPub, sysJwt, accPub, accJwt)))
+	s, _ := RunServerWithConfig(conf)
+	defer s.Shutdown()
+
+	nc := natsConnect(t, s.ClientURL(), createUserCredsEx(t, jwt.NewUserClaims("admin"), accKp))
+	defer nc.Close()
+	uc := jwt.NewUserClaims("eu")
+	uc.IssuerAccount = accPub
+	uc.UserPermissionLimits = jwt.UserPermissionLimits{}
+	uc.Tags.Add("region:eu")
+	ncEU := natsConnect(t, s.ClientURL(), createUserCredsEx(t, uc, skKp))
+	defer ncEU.Close()
+
+	_, err := jsStreamCreate(t, nc, &StreamConfig{
+		Name:                       "ORDERS",
+		Subjects:                   []string{"orders.>"},
+		Storage:                    FileStorage,
+		ConsumerSubjectPermissions: true,
+	})
+	require_NoError(t, err)
+
+	_, err = jsConsumerCreate(t, ncEU, "ORDERS", ConsumerConfig{Durable: "EU", FilterSubject: "orders.eu.>"}, false)
+	require_NoError(t, err)
+	_, err = jsConsumerCreate(t, ncEU, "ORDERS", ConsumerConfig{Durable: "US", FilterSubject: "orders.us.>"}, false)
+	require_Error(t, err, NewJSConsumerSubjectPermissionError(errors.New(`subject "orders.us.>" not permitted`)))
+	_, err = jsConsumerCreate(t, nc, "ORDERS", ConsumerConfig{Durable: "US", FilterSubject: "orders.us.>"}, false)
+	require_NoError(t, err)
+}
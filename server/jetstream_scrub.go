@@ -0,0 +1,411 @@
+// Copyright 2026 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/minio/highwayhash"
+	"github.com/nats-io/nuid"
+)
+
+// The scrubber verifies the checksums of the message blocks of file based streams and Raft logs
+// in the background, reading at most the configured number of bytes per second. Only sealed blocks
+// are verified, the last block is still being written to. Corruption is reported in /jsz and with
+// an advisory. For replicated streams the replica is reset, so it gets a snapshot from the leader
+// and catches up, instead of the corruption surfacing on a later catchup or restart. The Raft
+// logs of replicated consumers and the meta layer are reset the same way.
+
+var (
+	errStoreCorrupt   = errors.New("store corruption detected")
+	errRaftLogCorrupt = errors.New("raft log corruption detected")
+)
+
+// Time between scrubbing passes.
+var scrubPassInterval = time.Minute
+
+// Most recent findings we keep for reporting.
+const scrubMaxFindings = 10
+
+// JSScrubStats has the results of scrubbing the stores and Raft logs of this server.
+type JSScrubStats struct {
+	Rate     int64             `json:"rate"`
+	Passes   uint64            `json:"passes"`
+	Blocks   uint64            `json:"blocks"`
+	Bytes    uint64            `json:"bytes"`
+	Corrupt  uint64            `json:"corrupt"`
+	Repaired uint64            `json:"repaired"`
+	LastPass *time.Time        `json:"last_pass,omitempty"`
+	Findings []*JSScrubFinding `json:"findings,omitempty"`
+}
+
+// JSScrubFinding is a corrupt block found while scrubbing.
+type JSScrubFinding struct {
+	Time     time.Time `json:"time"`
+	Account  string    `json:"account,omitempty"`
+	Stream   string    `json:"stream,omitempty"`
+	Consumer string    `json:"consumer,omitempty"`
+	// Group is set for the Raft log of the group, otherwise it's the store of the stream.
+	Group    string `json:"group,omitempty"`
+	Block    uint32 `json:"block"`
+	FirstSeq uint64 `json:"first_seq"`
+	LastSeq  uint64 `json:"last_seq"`
+	Error    string `json:"error"`
+	Repaired bool   `json:"repaired"`
+}
+
+// verify checks the checksums of all records in the block as stored on disk, without changing
+// the block like rebuilding its state would. The block lock is only held to load the block, it's
+// decrypted, decompressed and hashed with our own cipher and hash. Returns the number of bytes read.
+func (mb *msgBlock) verify() (int, error) {
+	fs := mb.fs
+	fs.mu.RLock()
+	key := sha256.Sum256(fs.hashKeyForBlock(mb.index))
+	fs.mu.RUnlock()
+	hh, err := highwayhash.NewDigest64(key[:])
+	if err != nil {
+		return 0, err
+	}
+
+	mb.mu.Lock()
+	if mb.closed || mb.cold {
+		mb.mu.Unlock()
+		return 0, nil
+	}
+	if err := mb.checkAndLoadEncryption(); err != nil {
+		mb.mu.Unlock()
+		return 0, err
+	}
+	var bek cipher.Stream
+	if mb.bek != nil {
+		if bek, err = genBlockEncryptionKey(fs.fcfg.Cipher, mb.seed, mb.nonce); err != nil {
+			mb.mu.Unlock()
+			return 0, err
+		}
+	}
+	mfn := mb.mfn
+	buf, err := mb.loadBlock(nil)
+	mb.mu.Unlock()
+
+	defer recycleMsgBlockBuf(buf)
+	if err != nil {
+		// Removed in the meantime.
+		if err == errNoBlkData {
+			return 0, nil
+		}
+		return 0, err
+	}
+	n := len(buf)
+	if bek != nil {
+		bek.XORKeyStream(buf, buf)
+	}
+	if buf, err = mb.decompressIfNeeded(buf); err != nil {
+		return n, err
+	}
+
+	var le = binary.LittleEndian
+	var hb [highwayhash.Size64]byte
+	for index, lbuf := uint32(0), uint32(len(buf)); index < lbuf; {
+		if index+msgHdrSize > lbuf {
+			return n, errBadMsg{mfn, fmt.Sprintf("message overrun (index %d lbuf %d)", index, lbuf)}
+		}
+		hdr := buf[index : index+msgHdrSize]
+		rl, slen := le.Uint32(hdr[0:]), int(le.Uint16(hdr[20:]))
+		hasHeaders := rl&hbit != 0
+		rl &^= hbit
+		shlen := slen
+		if hasHeaders {
+			shlen += 4
+		}
+		dlen := int(rl) - msgHdrSize
+		if dlen < 0 || shlen > (dlen-recordHashSize) || dlen > int(rl) || index+rl > lbuf || rl > rlBadThresh {
+			return n, errBadMsg{mfn, fmt.Sprintf("sanity check failed (dlen %d slen %d rl %d index %d lbuf %d)", dlen, slen, rl, index, lbuf)}
+		}
+		data := buf[index+msgHdrSize : index+rl]
+		hh.Reset()
+		hh.Write(hdr[4:20])
+		hh.Write(data[:slen])
+		if hasHeaders {
+			hh.Write(data[slen+4 : dlen-recordHashSize])
+		} else {
+			hh.Write(data[slen : dlen-recordHashSize])
+		}
+		if !bytes.Equal(hh.Sum(hb[:0]), data[len(data)-recordHashSize:]) {
+			return n, errBadMsg{mfn, fmt.Sprintf("invalid checksum (index %d)", index)}
+		}
+		index += rl
+	}
+	return n, nil
+}
+
+// scrubNext verifies the first sealed block with an index after the given one.
+// Returns the block, or nil if there are no more, and the number of bytes read.
+func (fs *fileStore) scrubNext(after uint32) (*msgBlock, int, error) {
+	fs.mu.RLock()
+	var mb *msgBlock
+	for _, b := range fs.blks {
+		if b.index > after && b != fs.lmb {
+			mb = b
+			break
+		}
+	}
+	fs.mu.RUnlock()
+	if mb == nil || fs.isClosed() {
+		return nil, 0, nil
+	}
+	n, err := mb.verify()
+	return mb, n, err
+}
+
+// scrubTarget is a store or Raft log to scrub.
+type scrubTarget struct {
+	fs       *fileStore
+	account  string
+	stream   string
+	consumer string
+	group    string
+	// The stream to reset, for its store or Raft log.
+	mset *stream
+	// The Raft log to reset, for consumers and the meta layer.
+	node *raft
+}
+
+// scrubTargets returns all file based stores and Raft logs of this server.
+func (js *jetStream) scrubTargets() []*scrubTarget {
+	var targets []*scrubTarget
+	walTarget := func(n RaftNode, t scrubTarget) {
+		if rn, ok := n.(*raft); ok {
+			if fs, ok := rn.wal.(*fileStore); ok {
+				t.fs, t.group, t.node = fs, rn.group, rn
+				targets = append(targets, &t)
+			}
+		}
+	}
+	if mg := js.getMetaGroup(); mg != nil {
+		walTarget(mg, scrubTarget{})
+	}
+
+	js.mu.RLock()
+	accounts := make([]*jsAccount, 0, len(js.accounts))
+	for _, jsa := range js.accounts {
+		accounts = append(accounts, jsa)
+	}
+	js.mu.RUnlock()
+
+	for _, jsa := range accounts {
+		jsa.mu.RLock()
+		streams := make([]*stream, 0, len(jsa.streams))
+		for _, mset := range jsa.streams {
+			streams = append(streams, mset)
+		}
+		jsa.mu.RUnlock()
+
+		for _, mset := range streams {
+			accName, name := mset.accName(), mset.name()
+			if fs, ok := mset.Store().(*fileStore); ok {
+				targets = append(targets, &scrubTarget{fs: fs, account: accName, stream: name, mset: mset})
+			}
+			if n := mset.raftNode(); n != nil {
+				walTarget(n, scrubTarget{account: accName, stream: name, mset: mset})
+			}
+			for _, o := range mset.getConsumers() {
+				if n := o.raftNode(); n != nil {
+					walTarget(n, scrubTarget{account: accName, stream: name, consumer: o.String()})
+				}
+			}
+		}
+	}
+	return targets
+}
+
+// runScrubber scrubs all stores and Raft logs, pass after pass, until JetStream is shut down.
+func (js *jetStream) runScrubber(rate int64) {
+	s := js.srv
+	defer s.grWG.Done()
+
+	t := time.NewTimer(scrubPassInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-s.quitCh:
+			return
+		case <-t.C:
+		}
+		if js.disabled.Load() || js.isShuttingDown() {
+			return
+		}
+		if !js.scrubPass(rate) {
+			return
+		}
+		t.Reset(scrubPassInterval)
+	}
+}
+
+// scrubPass scrubs all stores and Raft logs once, reading at most rate bytes per second.
+// Zero means unthrottled. Returns false if the server is shutting down.
+func (js *jetStream) scrubPass(rate int64) bool {
+	s := js.srv
+	for _, t := range js.scrubTargets() {
+		for after := uint32(0); ; {
+			mb, n, err := t.fs.scrubNext(after)
+			if mb == nil {
+				break
+			}
+			after = mb.index
+			js.mu.Lock()
+			js.scrub.Blocks++
+			js.scrub.Bytes += uint64(n)
+			js.mu.Unlock()
+			if err != nil {
+				js.scrubFound(t, mb, err)
+				// The store or Raft log is reset, or we report it once per pass.
+				break
+			}
+			if rate > 0 && n > 0 {
+				select {
+				case <-s.quitCh:
+					return false
+				case <-time.After(time.Duration(int64(n) * int64(time.Second) / rate)):
+				}
+			}
+		}
+	}
+	now := time.Now().UTC()
+	js.mu.Lock()
+	js.scrub.Passes++
+	js.scrub.LastPass = &now
+	js.mu.Unlock()
+	return true
+}
+
+// scrubFound reports a corrupt block, and repairs it if we're a replica of a replicated stream.
+func (js *jetStream) scrubFound(t *scrubTarget, mb *msgBlock, err error) {
+	s := js.srv
+	f := &JSScrubFinding{
+		Time:     time.Now().UTC(),
+		Account:  t.account,
+		Stream:   t.stream,
+		Consumer: t.consumer,
+		Group:    t.group,
+		Block:    mb.index,
+		FirstSeq: atomic.LoadUint64(&mb.first.seq),
+		LastSeq:  atomic.LoadUint64(&mb.last.seq),
+		Error:    err.Error(),
+	}
+	what := fmt.Sprintf("stream '%s > %s'", t.account, t.stream)
+	if t.group != _EMPTY_ {
+		what = fmt.Sprintf("Raft group '%s'", t.group)
+	}
+	s.Errorf("JetStream scrubbing found corrupt block %d (seq %d-%d) for %s: %v", f.Block, f.FirstSeq, f.LastSeq, what, err)
+
+	// Resetting wipes our copy, so only do so if there's another replica we know is
+	// leading and that we're current with. A leader hands off, and is repaired next pass.
+	canReset := func(node RaftNode) bool {
+		switch leader := node.GroupLeader(); {
+		case node.Leader():
+			s.Warnf("Stepping down as leader of %s to get it repaired by another replica", what)
+			node.StepDown()
+		case leader == _EMPTY_ || leader == node.ID() || !node.Current():
+			s.Warnf("Not resetting %s, no current leader to get a snapshot from", what)
+		default:
+			return true
+		}
+		return false
+	}
+
+	// Streams without other replicas are only reported.
+	if mset := t.mset; mset != nil && mset.isClustered() {
+		mset.mu.RLock()
+		replicas := mset.cfg.Replicas
+		mset.mu.RUnlock()
+		if node := mset.raftNode(); replicas > 1 && node != nil && canReset(node) {
+			rerr := errStoreCorrupt
+			if t.group != _EMPTY_ {
+				rerr = errRaftLogCorrupt
+			}
+			s.Warnf("Resetting %s to get a snapshot from the leader", what)
+			f.Repaired = mset.resetClusteredState(rerr)
+		}
+	} else if node := t.node; node != nil && t.mset == nil && !node.IsDeleted() && canReset(node) {
+		// The Raft log of a consumer or the meta layer. Only the log is discarded, the leader
+		// catches us up with a snapshot of the consumer state or the meta layer assignments.
+		s.Warnf("Resetting %s to get a snapshot from the leader", what)
+		node.resetLog()
+		f.Repaired = true
+	}
+
+	js.mu.Lock()
+	js.scrub.Corrupt++
+	if f.Repaired {
+		js.scrub.Repaired++
+	}
+	js.scrub.Findings = append(js.scrub.Findings, f)
+	if l := len(js.scrub.Findings); l > scrubMaxFindings {
+		js.scrub.Findings = append([]*JSScrubFinding(nil), js.scrub.Findings[l-scrubMaxFindings:]...)
+	}
+	js.mu.Unlock()
+
+	s.publishAdvisory(nil, JSAdvisoryStoreCorruption, &JSStoreCorruptionAdvisory{
+		TypedEvent: TypedEvent{
+			Type: JSStoreCorruptionAdvisoryType,
+			ID:   nuid.Next(),
+			Time: f.Time,
+		},
+		Server:   s.Name(),
+		ServerID: s.ID(),
+		Account:  f.Account,
+		Stream:   f.Stream,
+		Consumer: f.Consumer,
+		Group:    f.Group,
+		Block:    f.Block,
+		FirstSeq: f.FirstSeq,
+		LastSeq:  f.LastSeq,
+		Error:    f.Error,
+		Repaired: f.Repaired,
+		Cluster:  s.cachedClusterName(),
+		Domain:   s.getOpts().JetStreamDomain,
+	})
+}
+
+// scrubStats returns the results of scrubbing, nil if it's not enabled.
+func (js *jetStream) scrubStats() *JSScrubStats {
+	js.mu.RLock()
+	defer js.mu.RUnlock()
+	if js.scrub.Rate == 0 && js.scrub.Passes == 0 {
+		return nil
+	}
+	stats := js.scrub
+	stats.Findings = append([]*JSScrubFinding(nil), js.scrub.Findings...)
+	return &stats
+}
+
+// startScrubber starts scrubbing in the background, if enabled.
+func (js *jetStream) startScrubber() {
+	s := js.srv
+	rate := s.getOpts().JetStreamScrubRate
+	if rate <= 0 {
+		return
+	}
+	js.mu.Lock()
+	js.scrub.Rate = rate
+	js.mu.Unlock()
+	s.startGoRoutine(func() { js.runScrubber(rate) })
+}
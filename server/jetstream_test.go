@@ -26048,7 +26048,7 @@ func TestJetStreamStreamSubjectsOverlapDataRace(t *testing.T) {
 			default:
 			}
 			jsa.mu.RLock()
-			jsa.subjectsOverlap([]string{"b.>"}, nil)
+			jsa.subjectsOverlap(&StreamConfig{Subjects: []string{"b.>"}}, nil)
 			jsa.mu.RUnlock()
 		}
 	}()
@@ -26642,3 +26642,1166 @@ func TestJetStreamRemoveConsumerOnlyRemovesMatchingInstance(t *testing.T) {
 	require_Equal(t, mset.csl.Count(), 0)
 	require_Len(t, len(mset.cList), 0)
 }
+
+func TestJetStreamStreamIngestRateLimit(t *testing.T) {
+	test := func(t *testing.T, storage StorageType, replicas int) {
+		var s *Server
+		if replicas == 1 {
+			s = RunBasicJetStreamServer(t)
+			defer s.Shutdown()
+		} else {
+			c := createJetStreamClusterExplicit(t, "R3S", replicas)
+			defer c.shutdown()
+			s = c.randomServer()
+		}
+
+		nc, js := jsClientConnect(t, s)
+		defer nc.Close()
+
+		rateLimited := func(stream string) uint64 {
+			t.Helper()
+			msg, err := nc.Request(fmt.Sprintf(JSApiStreamInfoT, stream), nil, time.Second)
+			require_NoError(t, err)
+			var si JSApiStreamInfoResponse
+			require_NoError(t, json.Unmarshal(msg.Data, &si))
+			require_True(t, si.Error == nil)
+			return si.State.RateLimited
+		}
+
+		// Per subject limit with discard new rejects.
+		_, err := jsStreamCreate(t, nc, &StreamConfig{
+			Name:     "TEST",
+			Subjects: []string{"sensor.>", "other"},
+			Storage:  storage,
+			Replicas: replicas,
+			Discard:  DiscardNew,
+			IngestRateLimit: &StreamIngestRateLimit{
+				MaxMsgsPerSubjectPerSec: 1,
+				Subjects:                []string{"sensor.>"},
+				Burst:                   5,
+			},
+		})
+		require_NoError(t, err)
+
+		for range 5 {
+			_, err = js.Publish("sensor.a", nil)
+			require_NoError(t, err)
+		}
+		_, err = js.Publish("sensor.a", nil)
+		require_Error(t, err, NewJSStreamIngestRateExceededError())
+
+		// Other subjects have their own bucket, or are not limited at all.
+		_, err = js.Publish("sensor.b", nil)
+		require_NoError(t, err)
+		for range 10 {
+			_, err = js.Publish("other", nil)
+			require_NoError(t, err)
+		}
+
+		si, err := js.StreamInfo("TEST")
+		require_NoError(t, err)
+		require_Equal(t, si.State.Msgs, 16)
+		require_Equal(t, rateLimited("TEST"), 1)
+
+		// Stream wide limit with discard old drops without responding.
+		_, err = jsStreamCreate(t, nc, &StreamConfig{
+			Name:     "OLD",
+			Subjects: []string{"old.>"},
+			Storage:  storage,
+			Replicas: replicas,
+			Discard:  DiscardOld,
+			IngestRateLimit: &StreamIngestRateLimit{
+				MaxMsgsPerSec: 1,
+				Burst:         2,
+			},
+		})
+		require_NoError(t, err)
+
+		_, err = js.Publish("old.a", nil)
+		require_NoError(t, err)
+		_, err = js.Publish("old.b", nil)
+		require_NoError(t, err)
+		_, err = js.Publish("old.c", nil, nats.AckWait(250*time.Millisecond))
+		require_Error(t, err, nats.ErrTimeout)
+
+		si, err = js.StreamInfo("OLD")
+		require_NoError(t, err)
+		require_Equal(t, si.State.Msgs, 2)
+		require_Equal(t, rateLimited("OLD"), 1)
+	}
+
+	for _, storage := range []StorageType{FileStorage, MemoryStorage} {
+		t.Run(storage.String(), func(t *testing.T) {
+			t.Run("R1", func(t *testing.T) { test(t, storage, 1) })
+			t.Run("R3", func(t *testing.T) { test(t, storage, 3) })
+		})
+	}
+}
+
+func TestJetStreamStreamIngestRateLimitConfig(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, _ := jsClientConnect(t, s)
+	defer nc.Close()
+
+	for _, test := range []struct {
+		desc string
+		cfg  *StreamConfig
+		err  string
+	}{
+		{
+			desc: "no-rate",
+			cfg:  &StreamConfig{Name: "TEST", Storage: FileStorage, IngestRateLimit: &StreamIngestRateLimit{Burst: 10}},
+			err:  "ingest rate limit requires max msgs per second or max msgs per subject per second > 0",
+		},
+		{
+			desc: "subjects-without-per-subject-rate",
+			cfg:  &StreamConfig{Name: "TEST", Storage: FileStorage, IngestRateLimit: &StreamIngestRateLimit{MaxMsgsPerSec: 10, Subjects: []string{"foo"}}},
+			err:  "ingest rate limit subjects require max msgs per subject per second > 0",
+		},
+		{
+			desc: "invalid-subject",
+			cfg:  &StreamConfig{Name: "TEST", Storage: FileStorage, IngestRateLimit: &StreamIngestRateLimit{MaxMsgsPerSubjectPerSec: 10, Subjects: []string{"foo..bar"}}},
+			err:  "ingest rate limit subject \"foo..bar\" is not a valid subject",
+		},
+		{
+			desc: "mirror",
+			cfg:  &StreamConfig{Name: "TEST", Storage: FileStorage, Mirror: &StreamSource{Name: "O"}, IngestRateLimit: &StreamIngestRateLimit{MaxMsgsPerSec: 10}},
+			err:  "stream mirrors can not have an ingest rate limit",
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			_, err := jsStreamCreate(t, nc, test.cfg)
+			require_Error(t, err, NewJSStreamInvalidConfigError(errors.New(test.err)))
+		})
+	}
+}
+
+func TestJetStreamStreamIngestRateLimitMaxSubjects(t *testing.T) {
+	il := newIngestLimiter(&StreamIngestRateLimit{MaxMsgsPerSubjectPerSec: 1})
+	for i := 0; i < ingestLimiterMaxSubjects; i++ {
+		require_True(t, il.allow(fmt.Sprintf("foo.%d", i)))
+	}
+	require_Len(t, len(il.subjects), ingestLimiterMaxSubjects)
+	require_False(t, il.allow("foo.0"))
+
+	// New subjects share a limiter once the maximum is reached.
+	require_True(t, il.allow("bar.1"))
+	require_False(t, il.allow("bar.2"))
+	require_Len(t, len(il.subjects), ingestLimiterMaxSubjects)
+	require_Equal(t, il.numLimited(), 2)
+}
+
+func TestJetStreamMessageDelay(t *testing.T) {
+	test := func(t *testing.T, storage StorageType, replicas int) {
+		var s *Server
+		if replicas == 1 {
+			s = RunBasicJetStreamServer(t)
+			defer s.Shutdown()
+		} else {
+			c := createJetStreamClusterExplicit(t, "R3S", replicas)
+			defer c.shutdown()
+			s = c.randomServer()
+		}
+
+		nc, js := jsClientConnect(t, s)
+		defer nc.Close()
+
+		_, err := jsStreamCreate(t, nc, &StreamConfig{
+			Name:          "TEST",
+			Subjects:      []string{"foo"},
+			Storage:       storage,
+			Replicas:      replicas,
+			AllowMsgDelay: true,
+		})
+		require_NoError(t, err)
+
+		_, err = jsConsumerCreate(t, nc, "TEST", ConsumerConfig{
+			Durable:   "C",
+			AckPolicy: AckExplicit,
+			AckWait:   250 * time.Millisecond,
+			Replicas:  replicas,
+		}, false)
+		require_NoError(t, err)
+
+		m := nats.NewMsg("foo")
+		m.Header.Set(JSMessageDelay, "1500ms")
+		m.Data = []byte("delayed")
+		_, err = js.PublishMsg(m)
+		require_NoError(t, err)
+
+		// A deliver at time in the past is delivered right away.
+		m = nats.NewMsg("foo")
+		m.Header.Set(JSMessageDeliverAt, time.Now().Add(-time.Second).Format(time.RFC3339Nano))
+		m.Data = []byte("past")
+		_, err = js.PublishMsg(m)
+		require_NoError(t, err)
+		_, err = js.Publish("foo", []byte("now"))
+		require_NoError(t, err)
+		start := time.Now()
+
+		sub, err := js.PullSubscribe(_EMPTY_, "C", nats.Bind("TEST", "C"))
+		require_NoError(t, err)
+		defer sub.Unsubscribe()
+
+		msgs, err := sub.Fetch(2, nats.MaxWait(time.Second))
+		require_NoError(t, err)
+		require_Len(t, len(msgs), 2)
+		require_Equal(t, string(msgs[0].Data), "past")
+		require_Equal(t, string(msgs[1].Data), "now")
+
+		// The delayed message is still pending, and not waiting for an ack.
+		ci, err := js.ConsumerInfo("TEST", "C")
+		require_NoError(t, err)
+		require_Equal(t, ci.NumPending, 1)
+		require_Equal(t, ci.NumAckPending, 2)
+		for _, msg := range msgs {
+			require_NoError(t, msg.AckSync())
+		}
+
+		// Not delivered before it's due, also not after the AckWait passed.
+		_, err = sub.Fetch(1, nats.MaxWait(500*time.Millisecond))
+		require_Error(t, err, nats.ErrTimeout)
+
+		msgs, err = sub.Fetch(1, nats.MaxWait(3*time.Second))
+		require_NoError(t, err)
+		require_Len(t, len(msgs), 1)
+		require_Equal(t, string(msgs[0].Data), "delayed")
+		require_True(t, time.Since(start) >= time.Second)
+		meta, err := msgs[0].Metadata()
+		require_NoError(t, err)
+		require_Equal(t, meta.NumDelivered, 1)
+		ci, err = js.ConsumerInfo("TEST", "C")
+		require_NoError(t, err)
+		require_Equal(t, ci.NumAckPending, 1)
+		require_Equal(t, ci.NumRedelivered, 0)
+		require_NoError(t, msgs[0].AckSync())
+
+		ci, err = js.ConsumerInfo("TEST", "C")
+		require_NoError(t, err)
+		require_Equal(t, ci.NumPending, 0)
+		require_Equal(t, ci.NumAckPending, 0)
+		require_Equal(t, ci.AckFloor.Stream, 3)
+	}
+
+	for _, storage := range []StorageType{FileStorage, MemoryStorage} {
+		t.Run(storage.String(), func(t *testing.T) {
+			t.Run("R1", func(t *testing.T) { test(t, storage, 1) })
+			t.Run("R3", func(t *testing.T) { test(t, storage, 3) })
+		})
+	}
+}
+
+func TestJetStreamMessageDelayMaxAckPending(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	_, err := jsStreamCreate(t, nc, &StreamConfig{Name: "TEST", Subjects: []string{"foo"}, Storage: FileStorage, AllowMsgDelay: true})
+	require_NoError(t, err)
+	_, err = jsConsumerCreate(t, nc, "TEST", ConsumerConfig{Durable: "C", AckPolicy: AckExplicit, MaxAckPending: 2}, false)
+	require_NoError(t, err)
+
+	for range 2 {
+		m := nats.NewMsg("foo")
+		m.Header.Set(JSMessageDelay, "1s")
+		m.Data = []byte("delayed")
+		_, err = js.PublishMsg(m)
+		require_NoError(t, err)
+	}
+	_, err = js.Publish("foo", []byte("now"))
+	require_NoError(t, err)
+
+	sub, err := js.PullSubscribe(_EMPTY_, "C", nats.Bind("TEST", "C"))
+	require_NoError(t, err)
+	defer sub.Unsubscribe()
+
+	// Held back messages count toward MaxAckPending.
+	_, err = sub.Fetch(1, nats.MaxWait(500*time.Millisecond))
+	require_Error(t, err, nats.ErrTimeout)
+
+	msgs, err := sub.Fetch(2, nats.MaxWait(3*time.Second))
+	require_NoError(t, err)
+	require_Len(t, len(msgs), 2)
+	for _, msg := range msgs {
+		require_Equal(t, string(msg.Data), "delayed")
+		meta, err := msg.Metadata()
+		require_NoError(t, err)
+		require_Equal(t, meta.NumDelivered, 1)
+		require_NoError(t, msg.AckSync())
+	}
+
+	msgs, err = sub.Fetch(1, nats.MaxWait(time.Second))
+	require_NoError(t, err)
+	require_Len(t, len(msgs), 1)
+	require_Equal(t, string(msgs[0].Data), "now")
+}
+
+func TestJetStreamMessageDelayInvalid(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	_, err := jsStreamCreate(t, nc, &StreamConfig{Name: "DISABLED", Subjects: []string{"disabled"}, Storage: FileStorage})
+	require_NoError(t, err)
+
+	m := nats.NewMsg("disabled")
+	m.Header.Set(JSMessageDelay, "1s")
+	_, err = js.PublishMsg(m)
+	require_Error(t, err, NewJSMessageDelayDisabledError())
+
+	cfg := &StreamConfig{Name: "TEST", Subjects: []string{"foo"}, Storage: FileStorage, AllowMsgDelay: true}
+	_, err = jsStreamCreate(t, nc, cfg)
+	require_NoError(t, err)
+
+	for _, test := range []struct {
+		desc string
+		hdr  nats.Header
+	}{
+		{desc: "bad-duration", hdr: nats.Header{JSMessageDelay: []string{"soon"}}},
+		{desc: "negative-duration", hdr: nats.Header{JSMessageDelay: []string{"-1s"}}},
+		{desc: "bad-time", hdr: nats.Header{JSMessageDeliverAt: []string{"tomorrow"}}},
+		{desc: "both", hdr: nats.Header{JSMessageDelay: []string{"1s"}, JSMessageDeliverAt: []string{time.Now().Format(time.RFC3339)}}},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			_, err = js.PublishMsg(&nats.Msg{Subject: "foo", Header: test.hdr})
+			require_Error(t, err, NewJSMessageDelayInvalidError())
+		})
+	}
+
+	// Message delays can not be disabled once enabled.
+	cfg.AllowMsgDelay = false
+	_, err = jsStreamUpdate(t, nc, cfg)
+	require_Error(t, err, NewJSStreamInvalidConfigError(errors.New("message delays can not be disabled")))
+
+	// Delayed messages can only be held back by consumers with explicit acks.
+	for _, ackPolicy := range []AckPolicy{AckNone, AckAll} {
+		_, err = jsConsumerCreate(t, nc, "TEST", ConsumerConfig{Durable: "C", AckPolicy: ackPolicy}, false)
+		require_Error(t, err, NewJSConsumerMsgDelayRequiresAckExplicitError())
+	}
+	_, err = jsConsumerCreate(t, nc, "TEST", ConsumerConfig{Durable: "C", AckPolicy: AckExplicit}, false)
+	require_NoError(t, err)
+
+	// Neither can message delays be enabled with such consumers.
+	_, err = jsConsumerCreate(t, nc, "DISABLED", ConsumerConfig{Durable: "C", AckPolicy: AckNone}, false)
+	require_NoError(t, err)
+	_, err = jsStreamUpdate(t, nc, &StreamConfig{Name: "DISABLED", Subjects: []string{"disabled"}, Storage: FileStorage, AllowMsgDelay: true})
+	require_Error(t, err, NewJSStreamUpdateError(errors.New("message delays require explicit ack policy for consumers: C")))
+}
+
+func TestJetStreamStreamCompressionZstd(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	cfg := &StreamConfig{Name: "TEST", Subjects: []string{"foo"}, Storage: FileStorage, Compression: S2Compression}
+	_, err := jsStreamCreate(t, nc, cfg)
+	require_NoError(t, err)
+
+	// A compression level requires zstd.
+	cfg.CompressionLevel = 3
+	_, err = jsStreamUpdate(t, nc, cfg)
+	require_Error(t, err, NewJSStreamInvalidConfigError(errors.New("compression level requires zstd compression")))
+
+	cfg.Compression, cfg.CompressionLevel = ZstdCompression, 23
+	_, err = jsStreamUpdate(t, nc, cfg)
+	require_Error(t, err, NewJSStreamInvalidConfigError(errors.New("compression level must be between 1 and 22")))
+
+	// Stream can be updated from S2 to zstd.
+	_, err = js.Publish("foo", []byte("s2"))
+	require_NoError(t, err)
+	cfg.CompressionLevel = 19
+	ncfg, err := jsStreamUpdate(t, nc, cfg)
+	require_NoError(t, err)
+	require_Equal(t, ncfg.Compression, ZstdCompression)
+	require_Equal(t, ncfg.CompressionLevel, 19)
+	_, err = js.Publish("foo", []byte("zstd"))
+	require_NoError(t, err)
+
+	for seq, data := range []string{"s2", "zstd"} {
+		msg, err := js.GetMsg("TEST", uint64(seq+1))
+		require_NoError(t, err)
+		require_Equal(t, string(msg.Data), data)
+	}
+}
+
+func TestJetStreamStreamColdTier(t *testing.T) {
+	tierDir := t.TempDir()
+	conf := createConfFile(t, []byte(fmt.Sprintf(`
+		listen: 127.0.0.1:-1
+		jetstream {
+			store_dir: %q
+			cold_tier { dir: %q }
+		}
+	`, t.TempDir(), tierDir)))
+	s, _ := RunServerWithConfig(conf)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	// Only file storage can be tiered.
+	cfg := &StreamConfig{Name: "TEST", Subjects: []string{"foo"}, Storage: MemoryStorage, ColdTierAge: 100 * time.Millisecond}
+	_, err := jsStreamCreate(t, nc, cfg)
+	require_Error(t, err, NewJSStreamInvalidConfigError(errors.New("cold tier requires file storage")))
+
+	cfg.Storage, cfg.MaxBytes = FileStorage, 100_000
+	_, err = jsStreamCreate(t, nc, cfg)
+	require_NoError(t, err)
+
+	msg := bytes.Repeat([]byte("Z"), 4096)
+	for range 20 {
+		_, err = js.Publish("foo", msg)
+		require_NoError(t, err)
+	}
+
+	checkFor(t, 5*time.Second, 100*time.Millisecond, func() error {
+		resp, err := nc.Request(fmt.Sprintf(JSApiStreamInfoT, "TEST"), nil, time.Second)
+		if err != nil {
+			return err
+		}
+		var si JSApiStreamInfoResponse
+		require_NoError(t, json.Unmarshal(resp.Data, &si))
+		require_True(t, si.StreamInfo != nil)
+		state := si.State
+		if state.ColdBytes == 0 || state.ColdBytes >= state.Bytes {
+			return fmt.Errorf("expected hot and cold bytes, got %d of %d cold", state.ColdBytes, state.Bytes)
+		}
+		return nil
+	})
+	// Blocks are kept per store, replicas each offload their own.
+	mset, err := s.globalAccount().lookupStream("TEST")
+	require_NoError(t, err)
+	fs := mset.store.(*fileStore)
+	fs.mu.RLock()
+	id := fs.coldID
+	fs.mu.RUnlock()
+	require_True(t, id != _EMPTY_)
+	_, err = os.Stat(filepath.Join(tierDir, globalAccountName, "TEST", id, fmt.Sprintf(blkScan, 1)))
+	require_NoError(t, err)
+
+	msg1, err := js.GetMsg("TEST", 1)
+	require_NoError(t, err)
+	require_True(t, bytes.Equal(msg1.Data, msg))
+}
+
+func TestJetStreamStreamSchemaValidation(t *testing.T) {
+	test := func(t *testing.T, storage StorageType, replicas int) {
+		var s *Server
+		if replicas == 1 {
+			s = RunBasicJetStreamServer(t)
+			defer s.Shutdown()
+		} else {
+			c := createJetStreamClusterExplicit(t, "R3S", replicas)
+			defer c.shutdown()
+			s = c.randomServer()
+		}
+
+		nc, js := jsClientConnect(t, s)
+		defer nc.Close()
+
+		schemaRejected := func() uint64 {
+			t.Helper()
+			msg, err := nc.Request(fmt.Sprintf(JSApiStreamInfoT, "TEST"), nil, time.Second)
+			require_NoError(t, err)
+			var si JSApiStreamInfoResponse
+			require_NoError(t, json.Unmarshal(msg.Data, &si))
+			require_True(t, si.Error == nil)
+			return si.State.SchemaRejected
+		}
+
+		cfg := &StreamConfig{
+			Name:     "TEST",
+			Subjects: []string{"orders.>", "raw"},
+			Storage:  storage,
+			Replicas: replicas,
+			Schemas: []*StreamSchema{{
+				Subjects:   []string{"orders.>"},
+				Type:       JSONSchemaType,
+				Definition: []byte(`{"type": "object", "required": ["id"], "properties": {"id": {"type": "integer"}}}`),
+			}},
+		}
+		_, err := jsStreamCreate(t, nc, cfg)
+		require_NoError(t, err)
+
+		_, err = js.Publish("orders.new", []byte(`{"id": 1}`))
+		require_NoError(t, err)
+		_, err = js.Publish("orders.new", []byte(`{"id": "1"}`))
+		require_Error(t, err, NewJSStreamSchemaValidationFailedError(errors.New("$.id: expected integer, got string")))
+		_, err = js.Publish("orders.new", []byte(`{}`))
+		require_Error(t, err, NewJSStreamSchemaValidationFailedError(errors.New(`$: missing required property "id"`)))
+		// Subjects not bound to a schema are not validated.
+		_, err = js.Publish("raw", []byte("anything"))
+		require_NoError(t, err)
+
+		si, err := js.StreamInfo("TEST")
+		require_NoError(t, err)
+		require_Equal(t, si.State.Msgs, 2)
+		require_Equal(t, schemaRejected(), 2)
+
+		// Changing the schema keeps the count.
+		cfg.Schemas[0].Definition = []byte(`{"type": "object"}`)
+		_, err = jsStreamUpdate(t, nc, cfg)
+		require_NoError(t, err)
+		_, err = js.Publish("orders.new", []byte(`{}`))
+		require_NoError(t, err)
+		_, err = js.Publish("orders.new", []byte(`[]`))
+		require_Error(t, err, NewJSStreamSchemaValidationFailedError(errors.New("$: expected object, got array")))
+		require_Equal(t, schemaRejected(), 3)
+
+		// Removing the schema stops validation.
+		cfg.Schemas = nil
+		_, err = jsStreamUpdate(t, nc, cfg)
+		require_NoError(t, err)
+		_, err = js.Publish("orders.new", []byte(`[]`))
+		require_NoError(t, err)
+		require_Equal(t, schemaRejected(), 0)
+	}
+
+	for _, storage := range []StorageType{FileStorage, MemoryStorage} {
+		t.Run(storage.String(), func(t *testing.T) {
+			t.Run("R1", func(t *testing.T) { test(t, storage, 1) })
+			t.Run("R3", func(t *testing.T) { test(t, storage, 3) })
+		})
+	}
+}
+
+func TestJetStreamStreamSchemaValidationConfig(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, _ := jsClientConnect(t, s)
+	defer nc.Close()
+
+	for _, test := range []struct {
+		desc string
+		cfg  *StreamConfig
+		err  string
+	}{
+		{
+			desc: "unknown-type",
+			cfg:  &StreamConfig{Name: "TEST", Storage: FileStorage, Schemas: []*StreamSchema{{Type: "avro"}}},
+			err:  `invalid schema: schema 0: unknown schema type "avro"`,
+		},
+		{
+			desc: "invalid-definition",
+			cfg:  &StreamConfig{Name: "TEST", Storage: FileStorage, Schemas: []*StreamSchema{{Type: JSONSchemaType, Definition: []byte(`{"type": 1}`)}}},
+			err:  "invalid schema: schema 0: #/type: must be a string or array of strings",
+		},
+		{
+			desc: "invalid-subject",
+			cfg:  &StreamConfig{Name: "TEST", Storage: FileStorage, Schemas: []*StreamSchema{{Subjects: []string{"foo..bar"}, Type: JSONSchemaType, Definition: []byte(`true`)}}},
+			err:  "schema subject \"foo..bar\" is not a valid subject",
+		},
+		{
+			desc: "mirror",
+			cfg:  &StreamConfig{Name: "TEST", Storage: FileStorage, Mirror: &StreamSource{Name: "O"}, Schemas: []*StreamSchema{{Type: JSONSchemaType, Definition: []byte(`true`)}}},
+			err:  "stream mirrors can not have schemas",
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			_, err := jsStreamCreate(t, nc, test.cfg)
+			require_Error(t, err, NewJSStreamInvalidConfigError(errors.New(test.err)))
+		})
+	}
+}
+
+func TestJetStreamStreamContentDedupe(t *testing.T) {
+	test := func(t *testing.T, storage StorageType, replicas int) {
+		var s *Server
+		var c *cluster
+		if replicas == 1 {
+			s = RunBasicJetStreamServer(t)
+			defer s.Shutdown()
+		} else {
+			c = createJetStreamClusterExplicit(t, "R3S", replicas)
+			defer c.shutdown()
+			s = c.randomServer()
+		}
+
+		nc, js := jsClientConnect(t, s)
+		defer nc.Close()
+
+		_, err := jsStreamCreate(t, nc, &StreamConfig{
+			Name:          "TEST",
+			Subjects:      []string{"foo", "bar"},
+			Storage:       storage,
+			Replicas:      replicas,
+			ContentDedupe: &StreamContentDedupe{Headers: []string{"Tenant"}},
+		})
+		require_NoError(t, err)
+
+		publish := func(subj, tenant, data string, opts ...nats.PubOpt) *nats.PubAck {
+			t.Helper()
+			m := nats.NewMsg(subj)
+			m.Data = []byte(data)
+			if tenant != _EMPTY_ {
+				m.Header.Set("Tenant", tenant)
+			}
+			pa, err := js.PublishMsg(m, opts...)
+			require_NoError(t, err)
+			return pa
+		}
+
+		pa := publish("foo", _EMPTY_, "hello")
+		require_Equal(t, pa.Sequence, 1)
+		pa = publish("foo", _EMPTY_, "hello")
+		require_Equal(t, pa.Sequence, 1)
+		require_True(t, pa.Duplicate)
+
+		// The subject, payload and selected headers make up the hash.
+		require_False(t, publish("bar", _EMPTY_, "hello").Duplicate)
+		require_False(t, publish("foo", _EMPTY_, "world").Duplicate)
+		require_False(t, publish("foo", "acme", "hello").Duplicate)
+		require_True(t, publish("foo", "acme", "hello").Duplicate)
+
+		// Messages with a msgId are deduplicated on the id only.
+		require_False(t, publish("foo", _EMPTY_, "hello", nats.MsgId("1")).Duplicate)
+		require_True(t, publish("foo", _EMPTY_, "other", nats.MsgId("1")).Duplicate)
+
+		si, err := js.StreamInfo("TEST")
+		require_NoError(t, err)
+		require_Equal(t, si.State.Msgs, 5)
+
+		// Survives a leader change.
+		if c != nil {
+			_, err = nc.Request(fmt.Sprintf(JSApiStreamLeaderStepDownT, "TEST"), nil, time.Second)
+			require_NoError(t, err)
+			c.waitOnStreamLeader(globalAccountName, "TEST")
+			pa = publish("foo", _EMPTY_, "hello")
+			require_Equal(t, pa.Sequence, 1)
+			require_True(t, pa.Duplicate)
+		}
+	}
+
+	for _, storage := range []StorageType{FileStorage, MemoryStorage} {
+		t.Run(storage.String(), func(t *testing.T) {
+			t.Run("R1", func(t *testing.T) { test(t, storage, 1) })
+			t.Run("R3", func(t *testing.T) { test(t, storage, 3) })
+		})
+	}
+}
+
+func TestJetStreamStreamContentDedupeRecover(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	_, err := jsStreamCreate(t, nc, &StreamConfig{
+		Name:          "TEST",
+		Subjects:      []string{"foo"},
+		Storage:       FileStorage,
+		ContentDedupe: &StreamContentDedupe{},
+	})
+	require_NoError(t, err)
+	_, err = js.Publish("foo", []byte("hello"))
+	require_NoError(t, err)
+
+	sd := s.JetStreamConfig().StoreDir
+	nc.Close()
+	s.Shutdown()
+	s = RunJetStreamServerOnPort(-1, sd)
+	defer s.Shutdown()
+
+	nc, js = jsClientConnect(t, s)
+	defer nc.Close()
+
+	pa, err := js.Publish("foo", []byte("hello"))
+	require_NoError(t, err)
+	require_Equal(t, pa.Sequence, 1)
+	require_True(t, pa.Duplicate)
+}
+
+func TestJetStreamStreamContentDedupeConfig(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, _ := jsClientConnect(t, s)
+	defer nc.Close()
+
+	for _, test := range []struct {
+		desc string
+		cfg  *StreamConfig
+		err  string
+	}{
+		{
+			desc: "invalid-header",
+			cfg:  &StreamConfig{Name: "TEST", Storage: FileStorage, ContentDedupe: &StreamContentDedupe{Headers: []string{"a b"}}},
+			err:  `content dedupe header "a b" is not valid`,
+		},
+		{
+			desc: "mirror",
+			cfg:  &StreamConfig{Name: "TEST", Storage: FileStorage, Mirror: &StreamSource{Name: "O"}, ContentDedupe: &StreamContentDedupe{}},
+			err:  "stream mirrors can not have content dedupe",
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			_, err := jsStreamCreate(t, nc, test.cfg)
+			require_Error(t, err, NewJSStreamInvalidConfigError(errors.New(test.err)))
+		})
+	}
+}
+
+func TestJetStreamStreamViews(t *testing.T) {
+	test := func(t *testing.T, replicas int) {
+		var s *Server
+		if replicas == 1 {
+			s = RunBasicJetStreamServer(t)
+			defer s.Shutdown()
+		} else {
+			c := createJetStreamClusterExplicit(t, "R3S", replicas)
+			defer c.shutdown()
+			s = c.randomServer()
+		}
+
+		nc, js := jsClientConnect(t, s)
+		defer nc.Close()
+
+		_, err := js.AddStream(&nats.StreamConfig{
+			Name:        "TEST",
+			Subjects:    []string{"foo.*"},
+			MaxMsgs:     10,
+			AllowDirect: true,
+			Replicas:    replicas,
+		})
+		require_NoError(t, err)
+		for i := range 5 {
+			_, err = js.Publish(fmt.Sprintf("foo.%d", i%2), nil)
+			require_NoError(t, err)
+		}
+
+		createView := func(req JSApiStreamViewCreateRequest) *JSApiStreamViewCreateResponse {
+			t.Helper()
+			b, err := json.Marshal(req)
+			require_NoError(t, err)
+			msg, err := nc.Request(fmt.Sprintf(JSApiStreamViewCreateT, "TEST"), b, 2*time.Second)
+			require_NoError(t, err)
+			var resp JSApiStreamViewCreateResponse
+			require_NoError(t, json.Unmarshal(msg.Data, &resp))
+			return &resp
+		}
+		deleteView := func(id string) *JSApiStreamViewDeleteResponse {
+			t.Helper()
+			msg, err := nc.Request(fmt.Sprintf(JSApiStreamViewDeleteT, "TEST", id), nil, 2*time.Second)
+			require_NoError(t, err)
+			var resp JSApiStreamViewDeleteResponse
+			require_NoError(t, json.Unmarshal(msg.Data, &resp))
+			return &resp
+		}
+		msgGet := func(req JSApiMsgGetRequest) *JSApiMsgGetResponse {
+			t.Helper()
+			b, err := json.Marshal(req)
+			require_NoError(t, err)
+			msg, err := nc.Request(fmt.Sprintf(JSApiMsgGetT, "TEST"), b, time.Second)
+			require_NoError(t, err)
+			var resp JSApiMsgGetResponse
+			require_NoError(t, json.Unmarshal(msg.Data, &resp))
+			return &resp
+		}
+
+		// Views by time end right before the first message at or after that time.
+		mresp := msgGet(JSApiMsgGetRequest{Seq: 3})
+		require_True(t, mresp.Error == nil)
+		vresp := createView(JSApiStreamViewCreateRequest{Time: &mresp.Message.Time})
+		require_True(t, vresp.Error == nil)
+		require_Equal(t, vresp.Seq, 2)
+		require_True(t, deleteView(vresp.ID).Success)
+
+		// Views expire.
+		vresp = createView(JSApiStreamViewCreateRequest{TTL: 100 * time.Millisecond})
+		require_True(t, vresp.Error == nil)
+		checkFor(t, 2*time.Second, 50*time.Millisecond, func() error {
+			if dresp := deleteView(vresp.ID); dresp.Error == nil {
+				return errors.New("view did not expire")
+			}
+			return nil
+		})
+
+		// A view of the current stream.
+		vresp = createView(JSApiStreamViewCreateRequest{})
+		require_True(t, vresp.Error == nil)
+		require_Equal(t, vresp.Seq, 5)
+		view := vresp.ID
+
+		// Limits don't remove messages held by the view.
+		for range 10 {
+			_, err = js.Publish("foo.0", nil)
+			require_NoError(t, err)
+		}
+		si, err := js.StreamInfo("TEST")
+		require_NoError(t, err)
+		require_Equal(t, si.State.Msgs, 15)
+		require_Equal(t, si.State.FirstSeq, 1)
+
+		// Neither do purges.
+		err = js.PurgeStream("TEST")
+		require_Error(t, err)
+		require_Contains(t, err.Error(), "stream has open views")
+
+		// Consumers bound to the view only see messages up to its sequence.
+		_, err = jsConsumerCreate(t, nc, "TEST", ConsumerConfig{Durable: "B", View: "BAD", AckPolicy: AckExplicit, Replicas: replicas}, false)
+		require_Error(t, err, NewJSStreamViewNotFoundError())
+		_, err = jsConsumerCreate(t, nc, "TEST", ConsumerConfig{Durable: "C", View: view, AckPolicy: AckExplicit, Replicas: replicas}, false)
+		require_NoError(t, err)
+		ci, err := js.ConsumerInfo("TEST", "C")
+		require_NoError(t, err)
+		require_Equal(t, ci.NumPending, 5)
+
+		sub, err := js.PullSubscribe(_EMPTY_, "C", nats.Bind("TEST", "C"))
+		require_NoError(t, err)
+		defer sub.Unsubscribe()
+		var seqs []uint64
+		for {
+			msgs, err := sub.Fetch(10, nats.MaxWait(250*time.Millisecond))
+			if err == nats.ErrTimeout {
+				break
+			}
+			require_NoError(t, err)
+			for _, msg := range msgs {
+				meta, err := msg.Metadata()
+				require_NoError(t, err)
+				seqs = append(seqs, meta.Sequence.Stream)
+				require_NoError(t, msg.AckSync())
+			}
+		}
+		require_True(t, reflect.DeepEqual(seqs, []uint64{1, 2, 3, 4, 5}))
+		ci, err = js.ConsumerInfo("TEST", "C")
+		require_NoError(t, err)
+		require_Equal(t, ci.NumPending, 0)
+
+		// Direct and msg gets bound to the view.
+		mresp = msgGet(JSApiMsgGetRequest{Seq: 6, View: view})
+		require_Error(t, mresp.ToError(), NewJSNoMessageFoundError())
+		mresp = msgGet(JSApiMsgGetRequest{LastFor: "foo.0", View: view})
+		require_True(t, mresp.Error == nil)
+		require_Equal(t, mresp.Message.Sequence, 5)
+		mresp = msgGet(JSApiMsgGetRequest{Seq: 1, View: "BAD"})
+		require_Error(t, mresp.ToError(), NewJSStreamViewNotFoundError())
+
+		msg, err := nc.Request(fmt.Sprintf(JSDirectMsgGetT, "TEST"), []byte(fmt.Sprintf(`{"seq":6,"view":%q}`, view)), time.Second)
+		require_NoError(t, err)
+		require_Equal(t, msg.Header.Get("Status"), "404")
+		msg, err = nc.Request(fmt.Sprintf(JSDirectGetLastBySubjectT, "TEST", "foo.0"), []byte(fmt.Sprintf(`{"view":%q}`, view)), time.Second)
+		require_NoError(t, err)
+		require_Equal(t, msg.Header.Get(JSSequence), "5")
+
+		reply := nats.NewInbox()
+		bsub, err := nc.SubscribeSync(reply)
+		require_NoError(t, err)
+		defer bsub.Unsubscribe()
+		require_NoError(t, nc.PublishRequest(fmt.Sprintf(JSDirectMsgGetT, "TEST"), reply, []byte(fmt.Sprintf(`{"seq":1,"batch":100,"view":%q}`, view))))
+		for i := uint64(1); i <= 5; i++ {
+			msg, err = bsub.NextMsg(time.Second)
+			require_NoError(t, err)
+			require_Equal(t, msg.Header.Get(JSSequence), strconv.FormatUint(i, 10))
+			require_Equal(t, msg.Header.Get(JSNumPending), strconv.FormatUint(5-i, 10))
+		}
+		// End of batch.
+		msg, err = bsub.NextMsg(time.Second)
+		require_NoError(t, err)
+		require_Equal(t, msg.Header.Get("Status"), "204")
+
+		// Deleting the view releases the held messages.
+		require_True(t, deleteView(view).Success)
+		require_Error(t, deleteView(view).ToError(), NewJSStreamViewNotFoundError())
+		checkFor(t, 2*time.Second, 50*time.Millisecond, func() error {
+			si, err := js.StreamInfo("TEST")
+			if err != nil {
+				return err
+			}
+			if si.State.Msgs != 10 || si.State.FirstSeq != 6 {
+				return fmt.Errorf("expected 10 msgs from 6, got %d from %d", si.State.Msgs, si.State.FirstSeq)
+			}
+			return nil
+		})
+		require_NoError(t, js.PurgeStream("TEST"))
+	}
+
+	t.Run("R1", func(t *testing.T) { test(t, 1) })
+	t.Run("R3", func(t *testing.T) { test(t, 3) })
+}
+
+func TestJetStreamMsgRedact(t *testing.T) {
+	test := func(t *testing.T, replicas int) {
+		var s *Server
+		if replicas == 1 {
+			s = RunBasicJetStreamServer(t)
+			defer s.Shutdown()
+		} else {
+			c := createJetStreamClusterExplicit(t, "R3S", replicas)
+			defer c.shutdown()
+			s = c.randomServer()
+		}
+
+		nc, js := jsClientConnect(t, s)
+		defer nc.Close()
+
+		_, err := js.AddStream(&nats.StreamConfig{
+			Name:       "TEST",
+			Subjects:   []string{"foo.*"},
+			DenyDelete: true,
+			Replicas:   replicas,
+		})
+		require_NoError(t, err)
+		_, err = js.AddStream(&nats.StreamConfig{
+			Name:     "M",
+			Mirror:   &nats.StreamSource{Name: "TEST"},
+			Storage:  nats.MemoryStorage,
+			Replicas: replicas,
+		})
+		require_NoError(t, err)
+		_, err = js.AddStream(&nats.StreamConfig{
+			Name:     "S",
+			Sources:  []*nats.StreamSource{{Name: "TEST"}},
+			Replicas: replicas,
+		})
+		require_NoError(t, err)
+
+		for i := 1; i <= 3; i++ {
+			m := nats.NewMsg(fmt.Sprintf("foo.%d", i))
+			m.Header.Set("Email", fmt.Sprintf("user%d@example.com", i))
+			m.Header.Set("Trace", "abc")
+			m.Data = []byte("personal data")
+			_, err = js.PublishMsg(m)
+			require_NoError(t, err)
+		}
+		// Make sure the mirror and source received the messages before we redact.
+		for _, name := range []string{"M", "S"} {
+			checkFor(t, 5*time.Second, 100*time.Millisecond, func() error {
+				si, err := js.StreamInfo(name)
+				if err != nil {
+					return err
+				}
+				if si.State.Msgs != 3 {
+					return fmt.Errorf("expected 3 msgs in %q, got %d", name, si.State.Msgs)
+				}
+				return nil
+			})
+		}
+
+		asub, err := nc.SubscribeSync(JSAdvisoryStreamMsgRedactedPre + ".>")
+		require_NoError(t, err)
+		defer asub.Unsubscribe()
+		require_NoError(t, nc.Flush())
+
+		redact := func(req JSApiMsgRedactRequest) *JSApiMsgRedactResponse {
+			t.Helper()
+			b, err := json.Marshal(req)
+			require_NoError(t, err)
+			msg, err := nc.Request(fmt.Sprintf(JSApiMsgRedactT, "TEST"), b, 2*time.Second)
+			require_NoError(t, err)
+			var resp JSApiMsgRedactResponse
+			require_NoError(t, json.Unmarshal(msg.Data, &resp))
+			return &resp
+		}
+		checkRedacted := func(t *testing.T, m *nats.RawStreamMsg) {
+			t.Helper()
+			require_Equal(t, m.Subject, "foo.2")
+			require_Len(t, len(m.Data), 0)
+			require_Equal(t, m.Header.Get("Email"), _EMPTY_)
+			require_Equal(t, m.Header.Get("Trace"), "abc")
+			require_Equal(t, m.Header.Get(JSRedactedHeaders), "Email")
+			_, err := time.Parse(time.RFC3339Nano, m.Header.Get(JSRedacted))
+			require_NoError(t, err)
+		}
+
+		require_Error(t, redact(JSApiMsgRedactRequest{}).ToError(), NewJSStreamMsgRedactInvalidError(errors.New("sequence is required")))
+		require_Error(t, redact(JSApiMsgRedactRequest{Seq: 2, Headers: []string{"Nats-Msg-Id"}}).ToError(),
+			NewJSStreamMsgRedactInvalidError(errors.New(`header "Nats-Msg-Id" can not be redacted`)))
+		require_Error(t, redact(JSApiMsgRedactRequest{Seq: 100}).ToError(), NewJSSequenceNotFoundError(100))
+
+		// Redactions are allowed even if deletes are not.
+		osm, err := js.GetMsg("TEST", 2)
+		require_NoError(t, err)
+		resp := redact(JSApiMsgRedactRequest{Seq: 2, Headers: []string{"Email"}, Reason: "erasure request"})
+		require_True(t, resp.Success)
+		sm, err := js.GetMsg("TEST", 2)
+		require_NoError(t, err)
+		checkRedacted(t, sm)
+		require_Equal(t, sm.Time, osm.Time)
+		sm, err = js.GetMsg("TEST", 3)
+		require_NoError(t, err)
+		require_Equal(t, string(sm.Data), "personal data")
+
+		// The advisory holds who redacted the message, the mirror and source send their own.
+		streams := make(map[string]struct{})
+		for range 3 {
+			msg, err := asub.NextMsg(2 * time.Second)
+			require_NoError(t, err)
+			var adv JSStreamMsgRedactedAdvisory
+			require_NoError(t, json.Unmarshal(msg.Data, &adv))
+			require_Equal(t, adv.Type, JSStreamMsgRedactedAdvisoryType)
+			require_Equal(t, adv.Subject, "foo.2")
+			require_Equal(t, strings.Join(adv.Headers, ","), "Email")
+			if adv.Stream == "TEST" {
+				require_Equal(t, adv.Sequence, 2)
+				require_Equal(t, adv.Reason, "erasure request")
+				require_NotNil(t, adv.Client)
+			} else {
+				require_True(t, adv.Client == nil)
+			}
+			streams[adv.Stream] = struct{}{}
+		}
+		require_Len(t, len(streams), 3)
+
+		// The mirror and the source redacted their copy.
+		sm, err = js.GetMsg("M", 2)
+		require_NoError(t, err)
+		checkRedacted(t, sm)
+		sm, err = js.GetLastMsg("S", "foo.2")
+		require_NoError(t, err)
+		checkRedacted(t, sm)
+		require_True(t, strings.HasPrefix(sm.Header.Get(JSStreamSource), "TEST 2 "))
+
+		// Mirroring continues as usual.
+		_, err = js.Publish("foo.4", []byte("more data"))
+		require_NoError(t, err)
+		checkFor(t, 5*time.Second, 100*time.Millisecond, func() error {
+			_, err := js.GetMsg("M", 4)
+			return err
+		})
+	}
+
+	t.Run("R1", func(t *testing.T) { test(t, 1) })
+	t.Run("R3", func(t *testing.T) { test(t, 3) })
+}
+
+func TestJetStreamMsgRedactReplayedToMirrorsAndSources(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "TEST", Subjects: []string{"foo.*"}})
+	require_NoError(t, err)
+	_, err = js.AddStream(&nats.StreamConfig{Name: "M", Mirror: &nats.StreamSource{Name: "TEST"}})
+	require_NoError(t, err)
+	_, err = js.AddStream(&nats.StreamConfig{Name: "S", Sources: []*nats.StreamSource{{Name: "TEST"}}})
+	require_NoError(t, err)
+
+	for i := 1; i <= 3; i++ {
+		m := nats.NewMsg(fmt.Sprintf("foo.%d", i))
+		m.Header.Set("Email", fmt.Sprintf("user%d@example.com", i))
+		m.Data = []byte("personal data")
+		_, err = js.PublishMsg(m)
+		require_NoError(t, err)
+	}
+	for _, name := range []string{"M", "S"} {
+		checkFor(t, 5*time.Second, 100*time.Millisecond, func() error {
+			si, err := js.StreamInfo(name)
+			if err != nil {
+				return err
+			}
+			if si.State.Msgs != 3 {
+				return fmt.Errorf("expected 3 msgs in %q, got %d", name, si.State.Msgs)
+			}
+			return nil
+		})
+	}
+
+	// Redact as a follower would, so the mirror and source are not told about it.
+	mset, err := s.globalAccount().lookupStream("TEST")
+	require_NoError(t, err)
+	ok, err := mset.applyRedaction(&streamMsgRedact{Stream: "TEST", Seq: 2, Headers: []string{"Email"}, Time: time.Now()}, false)
+	require_NoError(t, err)
+	require_True(t, ok)
+	sm, err := js.GetMsg("M", 2)
+	require_NoError(t, err)
+	require_Equal(t, string(sm.Data), "personal data")
+
+	// The redacted messages are kept across restarts.
+	sd := s.JetStreamConfig().StoreDir
+	nc.Close()
+	s.Shutdown()
+	s = RunJetStreamServerOnPort(-1, sd)
+	defer s.Shutdown()
+	nc, js = jsClientConnect(t, s)
+	defer nc.Close()
+	// Once reconnected, the mirror and source redact their copy.
+	checkFor(t, 10*time.Second, 200*time.Millisecond, func() error {
+		for _, name := range []string{"M", "S"} {
+			sm, err := js.GetLastMsg(name, "foo.2")
+			if err != nil {
+				return err
+			}
+			if len(sm.Data) > 0 || sm.Header.Get("Email") != _EMPTY_ {
+				return fmt.Errorf("expected msg in %q to be redacted", name)
+			}
+			if sm.Header.Get(JSRedactedHeaders) != "Email" {
+				return fmt.Errorf("expected redacted headers in %q, got %q", name, sm.Header.Get(JSRedactedHeaders))
+			}
+		}
+		return nil
+	})
+	sm, err = js.GetMsg("M", 3)
+	require_NoError(t, err)
+	require_Equal(t, string(sm.Data), "personal data")
+}
+
+func TestJetStreamMsgRedactSourcedMsgSeq(t *testing.T) {
+	s := RunBasicJetStreamServer(t)
+	defer s.Shutdown()
+
+	nc, js := jsClientConnect(t, s)
+	defer nc.Close()
+
+	_, err := js.AddStream(&nats.StreamConfig{Name: "A", Subjects: []string{"a"}})
+	require_NoError(t, err)
+	_, err = js.AddStream(&nats.StreamConfig{Name: "B", Subjects: []string{"b"}})
+	require_NoError(t, err)
+	_, err = js.AddStream(&nats.StreamConfig{Name: "S", Sources: []*nats.StreamSource{{Name: "A"}, {Name: "B"}}})
+	require_NoError(t, err)
+
+	for range 50 {
+		_, err = js.Publish("a", nil)
+		require_NoError(t, err)
+		_, err = js.Publish("b", nil)
+		require_NoError(t, err)
+	}
+	checkFor(t, 5*time.Second, 100*time.Millisecond, func() error {
+		si, err := js.StreamInfo("S")
+		if err != nil {
+			return err
+		}
+		if si.State.Msgs != 100 {
+			return fmt.Errorf("expected 100 msgs, got %d", si.State.Msgs)
+		}
+		return nil
+	})
+
+	mset, err := s.globalAccount().lookupStream("S")
+	require_NoError(t, err)
+	mset.mu.RLock()
+	var iname string
+	for name, si := range mset.sources {
+		if si.name == "A" {
+			iname = name
+		}
+	}
+	mset.mu.RUnlock()
+	require_NotEqual(t, iname, _EMPTY_)
+
+	// Every message from A is found, regardless of how they're interleaved with B.
+	var smv StoreMsg
+	for sseq := uint64(1); sseq <= 50; sseq++ {
+		seq := mset.sourcedMsgSeq(iname, sseq)
+		require_NotEqual(t, seq, 0)
+		sm, err := mset.store.LoadMsg(seq, &smv)
+		require_NoError(t, err)
+		require_Equal(t, sm.subj, "a")
+		_, name, ssseq, _ := streamAndSeq(string(sliceHeader(JSStreamSource, sm.hdr)))
+		require_Equal(t, name, iname)
+		require_Equal(t, ssseq, sseq)
+	}
+	require_Equal(t, mset.sourcedMsgSeq(iname, 51), 0)
+}
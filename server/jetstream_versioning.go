@@ -87,6 +87,66 @@ func setStaticStreamMetadata(cfg *StreamConfig) {
 		requires(4)
 	}
 
+	// Ingest rate limits were added in v2.15 and require API level 5.
+	if cfg.IngestRateLimit != nil {
+		requires(5)
+	}
+
+	// Zstd compression was added in v2.15 and requires API level 5.
+	if cfg.Compression == ZstdCompression {
+		requires(5)
+	}
+
+	// Delayed message delivery was added in v2.15 and requires API level 5.
+	if cfg.AllowMsgDelay {
+		requires(5)
+	}
+
+	// Message priority was added in v2.15 and requires API level 5.
+	if cfg.AllowMsgPriority {
+		requires(5)
+	}
+
+	// Consumer subject permissions were added in v2.15 and require API level 5.
+	if cfg.ConsumerSubjectPermissions {
+		requires(5)
+	}
+
+	// Linearizable reads were added in v2.15 and require API level 5.
+	if cfg.LinearizableReads {
+		requires(5)
+	}
+
+	// Learner replicas were added in v2.15 and require API level 5.
+	if cfg.Learners > 0 {
+		requires(5)
+	}
+
+	// Tiered storage was added in v2.15 and requires API level 5.
+	if cfg.ColdTierAge > 0 {
+		requires(5)
+	}
+
+	// Schema validation was added in v2.15 and requires API level 5.
+	if len(cfg.Schemas) > 0 {
+		requires(5)
+	}
+
+	// Content based deduplication was added in v2.15 and requires API level 5.
+	if cfg.ContentDedupe != nil {
+		requires(5)
+	}
+
+	// Last value compaction was added in v2.15 and requires API level 5.
+	if cfg.Compaction != nil {
+		requires(5)
+	}
+
+	// Partitioned streams were added in v2.15 and require API level 5.
+	if cfg.Partitions > 0 {
+		requires(5)
+	}
+
 	cfg.Metadata[JSRequiredLevelMetadataKey] = strconv.Itoa(requiredApiLevel)
 }
 
@@ -168,6 +228,26 @@ func setStaticConsumerMetadata(cfg *ConsumerConfig) {
 		requires(4)
 	}
 
+	// Added in 2.15
+	if cfg.PriorityPolicy == PriorityWeighted {
+		requires(5)
+	}
+	if cfg.DeadLetter != nil {
+		requires(5)
+	}
+	if cfg.HeaderFilter != _EMPTY_ {
+		requires(5)
+	}
+	if cfg.View != _EMPTY_ {
+		requires(5)
+	}
+	if cfg.LagThresholds != nil {
+		requires(5)
+	}
+	if cfg.MsgPriority {
+		requires(5)
+	}
+
 	cfg.Metadata[JSRequiredLevelMetadataKey] = strconv.Itoa(requiredApiLevel)
 }
 
@@ -112,6 +112,66 @@ func TestJetStreamSetStaticStreamMetadata(t *testing.T) {
 			cfg:              &StreamConfig{AllowBatchPublish: true},
 			expectedMetadata: metadataAtLevel("4"),
 		},
+		{
+			desc:             "IngestRateLimit",
+			cfg:              &StreamConfig{IngestRateLimit: &StreamIngestRateLimit{MaxMsgsPerSec: 10}},
+			expectedMetadata: metadataAtLevel("5"),
+		},
+		{
+			desc:             "ZstdCompression",
+			cfg:              &StreamConfig{Compression: ZstdCompression},
+			expectedMetadata: metadataAtLevel("5"),
+		},
+		{
+			desc:             "AllowMsgDelay",
+			cfg:              &StreamConfig{AllowMsgDelay: true},
+			expectedMetadata: metadataAtLevel("5"),
+		},
+		{
+			desc:             "AllowMsgPriority",
+			cfg:              &StreamConfig{AllowMsgPriority: true},
+			expectedMetadata: metadataAtLevel("5"),
+		},
+		{
+			desc:             "ConsumerSubjectPermissions",
+			cfg:              &StreamConfig{ConsumerSubjectPermissions: true},
+			expectedMetadata: metadataAtLevel("5"),
+		},
+		{
+			desc:             "LinearizableReads",
+			cfg:              &StreamConfig{LinearizableReads: true},
+			expectedMetadata: metadataAtLevel("5"),
+		},
+		{
+			desc:             "Learners",
+			cfg:              &StreamConfig{Learners: 1},
+			expectedMetadata: metadataAtLevel("5"),
+		},
+		{
+			desc:             "ColdTierAge",
+			cfg:              &StreamConfig{ColdTierAge: time.Hour},
+			expectedMetadata: metadataAtLevel("5"),
+		},
+		{
+			desc:             "Schemas",
+			cfg:              &StreamConfig{Schemas: []*StreamSchema{{Type: JSONSchemaType, Definition: []byte(`true`)}}},
+			expectedMetadata: metadataAtLevel("5"),
+		},
+		{
+			desc:             "ContentDedupe",
+			cfg:              &StreamConfig{ContentDedupe: &StreamContentDedupe{}},
+			expectedMetadata: metadataAtLevel("5"),
+		},
+		{
+			desc:             "Compaction",
+			cfg:              &StreamConfig{Compaction: &StreamCompaction{DirtyAge: time.Hour}},
+			expectedMetadata: metadataAtLevel("5"),
+		},
+		{
+			desc:             "Partitions",
+			cfg:              &StreamConfig{Partitions: 3},
+			expectedMetadata: metadataAtLevel("5"),
+		},
 	} {
 		t.Run(test.desc, func(t *testing.T) {
 			setStaticStreamMetadata(test.cfg)
@@ -259,6 +319,36 @@ func TestJetStreamSetStaticConsumerMetadata(t *testing.T) {
 			cfg:              &ConsumerConfig{AckPolicy: AckFlowControl},
 			expectedMetadata: metadataAtLevel("4"),
 		},
+		{
+			desc:             "Weighted",
+			cfg:              &ConsumerConfig{PriorityPolicy: PriorityWeighted, PriorityGroups: []string{"a"}, PriorityWeights: map[string]int{"a": 1}},
+			expectedMetadata: metadataAtLevel("5"),
+		},
+		{
+			desc:             "DeadLetter",
+			cfg:              &ConsumerConfig{DeadLetter: &ConsumerDeadLetter{Stream: "DLQ", Subject: "dlq"}},
+			expectedMetadata: metadataAtLevel("5"),
+		},
+		{
+			desc:             "HeaderFilter",
+			cfg:              &ConsumerConfig{HeaderFilter: "Region == 'eu'"},
+			expectedMetadata: metadataAtLevel("5"),
+		},
+		{
+			desc:             "View",
+			cfg:              &ConsumerConfig{View: "VIEW"},
+			expectedMetadata: metadataAtLevel("5"),
+		},
+		{
+			desc:             "LagThresholds",
+			cfg:              &ConsumerConfig{LagThresholds: &ConsumerLagThresholds{NumPending: 100}},
+			expectedMetadata: metadataAtLevel("5"),
+		},
+		{
+			desc:             "MsgPriority",
+			cfg:              &ConsumerConfig{MsgPriority: true},
+			expectedMetadata: metadataAtLevel("5"),
+		},
 	} {
 		t.Run(test.desc, func(t *testing.T) {
 			setStaticConsumerMetadata(test.cfg)
@@ -53,6 +53,7 @@ type memStore struct {
 	scheduling  *MsgScheduling
 	sdm         *SDMMeta
 	sources     map[string]*StreamSourceState
+	hseq        uint64 // Messages up to and including this sequence are held from limits.
 }
 
 func newMemStore(cfg *StreamConfig) (*memStore, error) {
@@ -190,6 +191,33 @@ func (ms *memStore) UpdateConfig(cfg *StreamConfig) error {
 	return nil
 }
 
+// HoldUpTo will hold messages up to and including seq from being removed by limits.
+// A lower sequence, or zero, releases the hold and enforces the limits again.
+func (ms *memStore) HoldUpTo(seq uint64) {
+	ms.mu.Lock()
+	hseq := ms.hseq
+	ms.hseq = seq
+	if seq >= hseq {
+		ms.mu.Unlock()
+		return
+	}
+	ms.enforceMsgLimit()
+	ms.enforceBytesLimit()
+	if ms.maxp > 0 {
+		lm := uint64(ms.maxp)
+		ms.fss.IterFast(func(subj []byte, ss *SimpleState) bool {
+			if ss.Msgs > lm {
+				ms.enforcePerSubjectLimit(bytesToString(subj), ss)
+			}
+			return true
+		})
+	}
+	if ms.cfg.MaxAge != 0 {
+		ms.resetAgeChk(0)
+	}
+	ms.mu.Unlock()
+}
+
 // Lock should be held.
 func (ms *memStore) recoverTTLState() {
 	ms.ttls = thw.NewHashWheel()
@@ -1238,6 +1266,9 @@ func (ms *memStore) enforcePerSubjectLimit(subj string, ss *SimpleState) {
 		if ss.firstNeedsUpdate || ss.lastNeedsUpdate {
 			ms.recalculateForSubj(subj, ss)
 		}
+		if ss.First <= ms.hseq {
+			break
+		}
 		if !ms.removeMsg(ss.First, false) {
 			break
 		}
@@ -1253,7 +1284,7 @@ func (ms *memStore) enforceMsgLimit() {
 	if ms.cfg.MaxMsgs <= 0 || ms.state.Msgs <= uint64(ms.cfg.MaxMsgs) {
 		return
 	}
-	for nmsgs := ms.state.Msgs; nmsgs > uint64(ms.cfg.MaxMsgs); nmsgs = ms.state.Msgs {
+	for nmsgs := ms.state.Msgs; nmsgs > uint64(ms.cfg.MaxMsgs) && ms.state.FirstSeq > ms.hseq; nmsgs = ms.state.Msgs {
 		ms.deleteFirstMsgOrPanic()
 	}
 }
@@ -1267,7 +1298,7 @@ func (ms *memStore) enforceBytesLimit() {
 	if ms.cfg.MaxBytes <= 0 || ms.state.Bytes <= uint64(ms.cfg.MaxBytes) {
 		return
 	}
-	for bs := ms.state.Bytes; bs > uint64(ms.cfg.MaxBytes); bs = ms.state.Bytes {
+	for bs := ms.state.Bytes; bs > uint64(ms.cfg.MaxBytes) && ms.state.FirstSeq > ms.hseq; bs = ms.state.Bytes {
 		ms.deleteFirstMsgOrPanic()
 	}
 }
@@ -1377,6 +1408,7 @@ func (ms *memStore) expireMsgs() {
 	minAge := time.Now().UnixNano() - maxAge
 	rmcb := ms.rmcb
 	pmsgcb := ms.pmsgcb
+	hseq := ms.hseq
 	sdmTTL := int64(ms.cfg.SubjectDeleteMarkerTTL.Seconds())
 	sdmEnabled := sdmTTL > 0
 
@@ -1391,7 +1423,7 @@ func (ms *memStore) expireMsgs() {
 
 	if maxAge > 0 {
 		var seq uint64
-		for sm, seq, _ = ms.LoadNextMsg(fwcs, true, 0, &smv); sm != nil && sm.ts <= minAge; sm, seq, _ = ms.LoadNextMsg(fwcs, true, seq+1, &smv) {
+		for sm, seq, _ = ms.LoadNextMsg(fwcs, true, 0, &smv); sm != nil && sm.ts <= minAge && seq > hseq; sm, seq, _ = ms.LoadNextMsg(fwcs, true, seq+1, &smv) {
 			if len(sm.hdr) > 0 {
 				if ttl, err := getMessageTTL(sm.hdr); err == nil && ttl < 0 {
 					// The message has a negative TTL, therefore it must "never expire".
@@ -2204,6 +2236,35 @@ func (ms *memStore) EraseMsg(seq uint64) (bool, error) {
 	return removed, nil
 }
 
+// RedactMsg will replace the headers of the message and remove its payload.
+// The message keeps its sequence, subject and timestamp.
+func (ms *memStore) RedactMsg(seq uint64, hdr []byte) (bool, error) {
+	ms.mu.Lock()
+	sm, ok := ms.msgs[seq]
+	if !ok {
+		ms.mu.Unlock()
+		return false, nil
+	}
+	osz := memStoreMsgSize(sm.subj, sm.hdr, sm.msg)
+	nsm := &StoreMsg{subj: sm.subj, buf: copyBytes(hdr), seq: sm.seq, ts: sm.ts}
+	if len(nsm.buf) > 0 {
+		nsm.hdr = nsm.buf
+	}
+	nsm.msg = nsm.buf[len(nsm.buf):]
+	ms.msgs[seq] = nsm
+	// Overwrite the original contents.
+	crand.Read(sm.buf)
+	nsz := memStoreMsgSize(nsm.subj, nsm.hdr, nsm.msg)
+	ms.state.Bytes = ms.state.Bytes - osz + nsz
+	cb := ms.scb
+	ms.mu.Unlock()
+
+	if cb != nil && osz != nsz {
+		cb(0, int64(nsz)-int64(osz), 0, _EMPTY_)
+	}
+	return true, nil
+}
+
 // Performs logic to update first sequence number.
 // Lock should be held.
 func (ms *memStore) updateFirstSeq(seq uint64) {
@@ -3122,6 +3122,7 @@ type JSInfo struct {
 	Messages        uint64           `json:"messages"`
 	Bytes           uint64           `json:"bytes"`
 	Meta            *MetaClusterInfo `json:"meta_cluster,omitempty"`
+	Scrub           *JSScrubStats    `json:"scrub,omitempty"`
 	AccountDetails  []*AccountDetail `json:"account_details,omitempty"`
 	Total           int              `json:"total"`
 }
@@ -3346,6 +3347,7 @@ func (s *Server) Jsz(opts *JSzOptions) (*JSInfo, error) {
 	}
 
 	jsi.JetStreamStats = *js.usageStats()
+	jsi.Scrub = js.scrubStats()
 
 	// If a specific account is requested, track the index.
 	filterIdx := -1
@@ -4242,14 +4244,28 @@ type RaftzGroup struct {
 	IPQApplyLen   int                       `json:"ipq_apply_len"`
 	WAL           StreamState               `json:"wal"`
 	WALError      error                     `json:"wal_error,omitempty"`
+	MaxInflight   int                       `json:"max_inflight,omitempty"`
+	Inflight      int                       `json:"inflight,omitempty"`
+	Batches       *RaftzGroupBatches        `json:"batches,omitempty"`
 	Peers         map[string]RaftzGroupPeer `json:"peers"`
 }
 
+// RaftzGroupBatches has the sizes of the append entries the leader sent for proposals.
+type RaftzGroupBatches struct {
+	Count      uint64  `json:"count"`
+	Entries    uint64  `json:"entries"`
+	Bytes      uint64  `json:"bytes"`
+	AvgEntries float64 `json:"avg_entries"`
+	MaxEntries int     `json:"max_entries"`
+	Held       uint64  `json:"held,omitempty"`
+}
+
 type RaftzGroupPeer struct {
 	Name                string `json:"name"`
 	Known               bool   `json:"known"`
 	LastReplicatedIndex uint64 `json:"last_replicated_index,omitempty"`
 	LastSeen            string `json:"last_seen,omitempty"`
+	Inflight            int    `json:"inflight,omitempty"`
 }
 
 type RaftzStatus map[string]map[string]RaftzGroup
@@ -4351,9 +4367,24 @@ func (s *Server) Raftz(opts *RaftzOptions) *RaftzStatus {
 			IPQRespLen:    n.resp.len(),
 			IPQApplyLen:   n.apply.len(),
 			WALError:      n.werr,
+			MaxInflight:   n.maxInflight,
 			Peers:         map[string]RaftzGroupPeer{},
 		}
 		n.wal.FastState(&info.WAL)
+		isLeader := n.State() == Leader
+		if isLeader {
+			info.Inflight = n.inflight(n.commit)
+		}
+		if b := n.batches; b.count > 0 {
+			info.Batches = &RaftzGroupBatches{
+				Count:      b.count,
+				Entries:    b.entries,
+				Bytes:      b.bytes,
+				AvgEntries: float64(b.entries) / float64(b.count),
+				MaxEntries: b.max,
+				Held:       b.held,
+			}
+		}
 		for id, p := range n.peers {
 			if id == n.id {
 				continue
@@ -4367,6 +4398,9 @@ func (s *Server) Raftz(opts *RaftzOptions) *RaftzStatus {
 			if !p.ts.IsZero() {
 				peer.LastSeen = time.Since(p.ts).String()
 			}
+			if isLeader {
+				peer.Inflight = n.inflight(p.li)
+			}
 			info.Peers[id] = peer
 		}
 		n.RUnlock()
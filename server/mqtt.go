@@ -38,6 +38,7 @@ import (
 )
 
 // References to "spec" here is from https://docs.oasis-open.org/mqtt/mqtt/v3.1.1/os/mqtt-v3.1.1-os.pdf
+// unless specified otherwise. MQTT 5 specific code lives in mqtt_v5.go.
 
 const (
 	mqttPacketConnect    = byte(0x10)
@@ -246,6 +247,7 @@ var (
 	errMQTTInvalidRetainedMessage     = errors.New("invalid retained message")
 	errMQTTSessionCollision           = errors.New("stored session does not match client ID")
 	errMQTTInvalidPublishLength       = errors.New("invalid publish message, variable header exceeds remaining length")
+	errMQTTPublishNotAuthorized       = errors.New("not authorized to publish")
 )
 
 type srvMQTT struct {
@@ -271,6 +273,7 @@ type mqttAccountSessionManager struct {
 	rmsCache   *sync.Map                              // map[subject]mqttRetainedMsg
 	jsa        mqttJSA
 	domainTk   string // Domain (with trailing "."), or possibly empty. This is added to session subject.
+	msgTTL     bool   // Sessions and messages streams allow per-message TTLs, used for MQTT 5 expiry.
 }
 
 type mqttJSAResponse struct {
@@ -345,15 +348,26 @@ type mqttSession struct {
 	tmaxack  int
 	clean    bool
 	domainTk string
+
+	// MQTT 5 session expiry interval in seconds, 0 for MQTT 3.1.1 sessions.
+	expiry uint32
+	// When the client disconnected, used to detect an expired session.
+	disconnected time.Time
+	// MQTT 5 "Receive Maximum" of the current client, 0 if not set.
+	recvMax uint16
+	// MQTT 5 subscription options, keyed like `subs`.
+	subOpts map[string]*mqttSubOpts
 }
 
 type mqttPersistedSession struct {
-	Origin string                     `json:"origin,omitempty"`
-	ID     string                     `json:"id,omitempty"`
-	Clean  bool                       `json:"clean,omitempty"`
-	Subs   map[string]byte            `json:"subs,omitempty"`
-	Cons   map[string]*ConsumerConfig `json:"cons,omitempty"`
-	PubRel *ConsumerConfig            `json:"pubrel,omitempty"`
+	Origin  string                     `json:"origin,omitempty"`
+	ID      string                     `json:"id,omitempty"`
+	Clean   bool                       `json:"clean,omitempty"`
+	Subs    map[string]byte            `json:"subs,omitempty"`
+	Cons    map[string]*ConsumerConfig `json:"cons,omitempty"`
+	PubRel  *ConsumerConfig            `json:"pubrel,omitempty"`
+	Expiry  uint32                     `json:"expiry,omitempty"`
+	SubOpts map[string]*mqttSubOpts    `json:"subopts,omitempty"`
 }
 
 type mqttRetainedMsg struct {
@@ -397,6 +411,10 @@ type mqttSub struct {
 	// '*' or '*/'.  It is set up at the time of subscription and is immutable
 	// after that.
 	reserved bool
+
+	// MQTT 5 subscription identifier and "No Local" option. Guarded like qos.
+	subID   int
+	noLocal bool
 }
 
 type mqtt struct {
@@ -414,6 +432,15 @@ type mqtt struct {
 	// downgradeQOS2Sub tells the MQTT client to downgrade QoS2 SUBSCRIBE
 	// requests to QoS1.
 	downgradeQoS2Sub bool
+
+	// MQTT 5 state, all set when processing the CONNECT packet and only
+	// accessed from the readLoop, except for v5 and maxPacket which are
+	// immutable after that.
+	v5          bool
+	cidAssigned bool              // The server assigned the client ID.
+	maxPacket   uint32            // Maximum packet size accepted by the client.
+	aliases     map[uint16][]byte // Inbound topic aliases.
+	props       mqttProperties    // Properties of the packet being processed.
 }
 
 type mqttPending struct {
@@ -426,6 +453,10 @@ type mqttConnectProto struct {
 	rd    time.Duration
 	will  *mqttWill
 	flags byte
+
+	// MQTT 5 only.
+	expiry  uint32 // Session expiry interval requested by the client.
+	recvMax uint16 // Receive maximum.
 }
 
 type mqttIOReader interface {
@@ -452,6 +483,10 @@ type mqttWill struct {
 	message []byte
 	qos     byte
 	retain  bool
+	// MQTT 5 will properties, see mqttPublish.
+	hdr   []byte
+	reply []byte
+	ttl   int64
 }
 
 type mqttFilter struct {
@@ -459,6 +494,12 @@ type mqttFilter struct {
 	qos    byte
 	// Used only for tracing and should not be used after parsing of (un)sub protocols.
 	ttopic []byte
+	// MQTT 5 only: shared subscription group, subscription identifier and
+	// subscription options.
+	queue   string
+	subID   int
+	noLocal bool
+	rh      byte
 }
 
 type mqttPublish struct {
@@ -469,6 +510,11 @@ type mqttPublish struct {
 	sz      int
 	pi      uint16
 	flags   byte
+	// MQTT 5 only: NATS header lines converted from the PUBLISH properties,
+	// reply subject from the response topic and message expiry in seconds.
+	hdr   []byte
+	reply []byte
+	ttl   int64
 }
 
 // When we re-encode incoming MQTT PUBLISH messages for NATS delivery, we add
@@ -506,6 +552,17 @@ const (
 	// NATS headers to store the original MQTT subject and the subject mapping.
 	mqttNatsHeaderSubject = "Nmqtt-Subject"
 	mqttNatsHeaderMapped  = "Nmqtt-Mapped"
+
+	// NATS headers converted from MQTT 5 PUBLISH properties. User properties
+	// are converted to headers of the same name, and the content type to the
+	// "Content-Type" header.
+	mqttNatsHeaderFormat      = "Nmqtt-Format"
+	mqttNatsHeaderExpires     = "Nmqtt-Expires"
+	mqttNatsHeaderReply       = "Nmqtt-Reply"
+	mqttNatsHeaderCorrelation = "Nmqtt-Correlation"
+	mqttNatsHeaderContentType = "Content-Type"
+	// Client ID hash of the MQTT 5 publisher, for the "No Local" option.
+	mqttNatsHeaderOrigin = "Nmqtt-Origin"
 )
 
 type mqttParsedPublishNATSHeader struct {
@@ -821,7 +878,7 @@ func (c *client) mqttParse(buf []byte) error {
 			}
 			break
 		}
-		if err = mqttCheckRemainingLength(pt, pl); err != nil {
+		if err = mqttCheckRemainingLength(pt, pl, c.mqtt.v5); err != nil {
 			break
 		}
 
@@ -830,9 +887,10 @@ func (c *client) mqttParse(buf []byte) error {
 		// PUBREC, PUBCOMP.
 		case mqttPacketPubAck:
 			var pi uint16
-			pi, err = mqttParsePIPacket(r)
+			var rc byte
+			pi, rc, err = c.mqttParseAckPacket(r, pl)
 			if trace {
-				c.traceInOp("PUBACK", errOrTrace(err, fmt.Sprintf("pi=%v", pi)))
+				c.traceInOp("PUBACK", errOrTrace(err, mqttAckTrace(pi, rc)))
 			}
 			if err == nil {
 				err = c.mqttProcessPubAck(pi)
@@ -840,19 +898,27 @@ func (c *client) mqttParse(buf []byte) error {
 
 		case mqttPacketPubRec:
 			var pi uint16
-			pi, err = mqttParsePIPacket(r)
+			var rc byte
+			pi, rc, err = c.mqttParseAckPacket(r, pl)
 			if trace {
-				c.traceInOp("PUBREC", errOrTrace(err, fmt.Sprintf("pi=%v", pi)))
+				c.traceInOp("PUBREC", errOrTrace(err, mqttAckTrace(pi, rc)))
 			}
 			if err == nil {
-				err = c.mqttProcessPubRec(pi)
+				// An MQTT 5 PUBREC with a failure reason code ends the QoS 2
+				// exchange, spec [MQTT-4.3.3-4] does not apply.
+				if rc >= mqttRCUnspecifiedError {
+					err = c.mqttProcessPubAck(pi)
+				} else {
+					err = c.mqttProcessPubRec(pi)
+				}
 			}
 
 		case mqttPacketPubComp:
 			var pi uint16
-			pi, err = mqttParsePIPacket(r)
+			var rc byte
+			pi, rc, err = c.mqttParseAckPacket(r, pl)
 			if trace {
-				c.traceInOp("PUBCOMP", errOrTrace(err, fmt.Sprintf("pi=%v", pi)))
+				c.traceInOp("PUBCOMP", errOrTrace(err, mqttAckTrace(pi, rc)))
 			}
 			if err == nil {
 				c.mqttProcessPubComp(pi)
@@ -875,9 +941,10 @@ func (c *client) mqttParse(buf []byte) error {
 
 		case mqttPacketPubRel:
 			var pi uint16
-			pi, err = mqttParsePIPacket(r)
+			var rc byte
+			pi, rc, err = c.mqttParseAckPacket(r, pl)
 			if trace {
-				c.traceInOp("PUBREL", errOrTrace(err, fmt.Sprintf("pi=%v", pi)))
+				c.traceInOp("PUBREL", errOrTrace(err, mqttAckTrace(pi, rc)))
 			}
 			if err == nil {
 				err = s.mqttProcessPubRel(c, pi, trace)
@@ -916,7 +983,7 @@ func (c *client) mqttParse(buf []byte) error {
 				}
 			}
 			if err == nil {
-				c.mqttEnqueueUnsubAck(pi)
+				c.mqttEnqueueUnsubAck(pi, filters)
 			}
 
 		// Packets that we get both as a receiver and sender: PING, CONNECT, DISCONNECT
@@ -964,16 +1031,30 @@ func (c *client) mqttParse(buf []byte) error {
 			}
 
 		case mqttPacketDisconnect:
+			var rc byte
+			if c.mqtt.v5 {
+				rc, err = c.mqttParseDisconnect(r, pl)
+			}
 			if trace {
-				c.traceInOp("DISCONNECT", nil)
+				var t []byte
+				if c.mqtt.v5 {
+					t = errOrTrace(err, fmt.Sprintf("rc=0x%02x", rc))
+				}
+				c.traceInOp("DISCONNECT", t)
+			}
+			if err != nil {
+				break
 			}
-			// Normal disconnect, we need to discard the will.
+			// Normal disconnect, we need to discard the will, unless a MQTT 5
+			// client asks for it to be published.
 			// Spec [MQTT-3.1.2-8]
-			c.mu.Lock()
-			if c.mqtt.cp != nil {
-				c.mqtt.cp.will = nil
+			if rc != mqttRCDisconnectWithWill {
+				c.mu.Lock()
+				if c.mqtt.cp != nil {
+					c.mqtt.cp.will = nil
+				}
+				c.mu.Unlock()
 			}
-			c.mu.Unlock()
 			s.mqttHandleClosedClient(c)
 			c.closeConnection(ClientClosed)
 			return nil
@@ -985,6 +1066,10 @@ func (c *client) mqttParse(buf []byte) error {
 	if err == nil && rd > 0 {
 		r.reader.SetReadDeadline(time.Now().Add(rd))
 	}
+	// Let a MQTT 5 client know why the connection is being closed.
+	if err != nil && connected && c.mqtt.v5 && !errors.Is(err, ErrConnectionClosed) {
+		c.mqttEnqueueDisconnect(mqttReasonCodeForError(err))
+	}
 	return err
 }
 
@@ -1007,15 +1092,25 @@ func mqttCheckFixedHeaderFlags(packetType, flags byte) error {
 	return nil
 }
 
-func mqttCheckRemainingLength(packetType byte, pl int) error {
+func mqttCheckRemainingLength(packetType byte, pl int, v5 bool) error {
 	var expected int
 	switch packetType {
 	case mqttPacketConnect, mqttPacketPub, mqttPacketSub, mqttPacketUnsub:
 		return nil
 	case mqttPacketPubAck, mqttPacketPubRec, mqttPacketPubRel, mqttPacketPubComp:
 		expected = 2
-	case mqttPacketPing, mqttPacketDisconnect:
+		// MQTT 5 acks may have a reason code and properties.
+		if v5 && pl > expected {
+			return nil
+		}
+	case mqttPacketPing:
+		expected = 0
+	case mqttPacketDisconnect:
 		expected = 0
+		// MQTT 5 DISCONNECT may have a reason code and properties.
+		if v5 {
+			return nil
+		}
 	default:
 		return nil
 	}
@@ -1061,8 +1156,14 @@ func (s *Server) mqttHandleClosedClient(c *client) {
 	asm.mu.Lock()
 	// Clear the client from the session, but session may stay.
 	sess.mu.Lock()
+	wasBound := sess.c == c
 	sess.c = nil
 	doClean := sess.clean
+	// A MQTT 5 session with a finite expiry interval starts expiring now.
+	expires := wasBound && !doClean && sess.expiry > 0 && sess.expiry != mqttSessionExpiryNever
+	if expires {
+		sess.disconnected = time.Now()
+	}
 	sess.mu.Unlock()
 	// If it was a clean session, then we remove from the account manager,
 	// and we will call clear() outside of any lock.
@@ -1078,6 +1179,12 @@ func (s *Server) mqttHandleClosedClient(c *client) {
 		if err := sess.clear(true); err != nil {
 			c.Errorf(err.Error())
 		}
+	} else if expires {
+		// Store the session record again, this time with a TTL so that it
+		// is removed from the stream when the session expires.
+		if err := sess.save(); err != nil {
+			c.Errorf(err.Error())
+		}
 	}
 
 	// Now handle the "will". This function will be a no-op if there is no "will" to send.
@@ -1397,23 +1504,43 @@ func (s *Server) mqttCreateAccountSessionManager(acc *Account, quitCh chan struc
 		return si, nil
 	}
 
+	// MQTT 5 session and message expiry use per-message TTLs in the sessions
+	// and messages streams. Streams created by older versions are updated
+	// to allow them, and if that fails, expiry is not supported.
+	as.msgTTL = true
+	allowMsgTTL := func(si *StreamInfo, txt string) {
+		if si == nil || si.Config.AllowMsgTTL {
+			return
+		}
+		cfg := si.Config
+		cfg.AllowMsgTTL = true
+		if _, err := jsa.updateStream(&cfg); err != nil {
+			s.Warnf("Unable to enable message TTLs on MQTT %s stream for account %q, MQTT 5 expiry will not be supported: %v",
+				txt, accName, err)
+			as.msgTTL = false
+		}
+	}
+
 	if si, err := lookupStream(mqttSessStreamName, "sessions"); err != nil {
 		return nil, err
 	} else if si == nil {
 		// Create the stream for the sessions.
 		cfg := &StreamConfig{
-			Name:       mqttSessStreamName,
-			Subjects:   []string{mqttSessStreamSubjectPrefix + as.domainTk + ">"},
-			Storage:    FileStorage,
-			Retention:  LimitsPolicy,
-			Replicas:   replicas,
-			MaxMsgsPer: 1,
+			Name:        mqttSessStreamName,
+			Subjects:    []string{mqttSessStreamSubjectPrefix + as.domainTk + ">"},
+			Storage:     FileStorage,
+			Retention:   LimitsPolicy,
+			Replicas:    replicas,
+			MaxMsgsPer:  1,
+			AllowMsgTTL: true,
 		}
 		if _, created, err := jsa.createStream(cfg); err == nil && created {
 			as.transferUniqueSessStreamsToMuxed(s)
 		} else if isErrorOtherThan(err, JSStreamNameExistErr) {
 			return nil, fmt.Errorf("create sessions stream for account %q: %v", accName, err)
 		}
+	} else {
+		allowMsgTTL(si, "sessions")
 	}
 
 	if si, err := lookupStream(mqttStreamName, "messages"); err != nil {
@@ -1421,15 +1548,18 @@ func (s *Server) mqttCreateAccountSessionManager(acc *Account, quitCh chan struc
 	} else if si == nil {
 		// Create the stream for the messages.
 		cfg := &StreamConfig{
-			Name:      mqttStreamName,
-			Subjects:  []string{mqttStreamSubjectPrefix + ">"},
-			Storage:   FileStorage,
-			Retention: InterestPolicy,
-			Replicas:  replicas,
+			Name:        mqttStreamName,
+			Subjects:    []string{mqttStreamSubjectPrefix + ">"},
+			Storage:     FileStorage,
+			Retention:   InterestPolicy,
+			Replicas:    replicas,
+			AllowMsgTTL: true,
 		}
 		if _, _, err := jsa.createStream(cfg); isErrorOtherThan(err, JSStreamNameExistErr) {
 			return nil, fmt.Errorf("create messages stream for account %q: %v", accName, err)
 		}
+	} else {
+		allowMsgTTL(si, "messages")
 	}
 
 	if si, err := lookupStream(mqttQoS2IncomingMsgsStreamName, "QoS2 incoming messages"); err != nil {
@@ -2220,6 +2350,7 @@ func (as *mqttAccountSessionManager) processSessionPersist(_ *subscription, pc *
 		// nothing will be done with regards to cleaning up the session,
 		// such as deleting stream, etc..
 		sess.c = nil
+		ec.mqttEnqueueDisconnect(mqttRCSessionTakenOver)
 		// Remove in separate go routine.
 		go ec.closeConnection(DuplicateClientID)
 	}
@@ -2524,14 +2655,16 @@ func (as *mqttAccountSessionManager) removeSession(sess *mqttSession, lock bool)
 // waiting.
 func (sess *mqttSession) processQOS12Sub(
 	c *client, // subscribing client.
-	subject, sid []byte, isReserved bool, qos byte, jsDurName string, h msgHandler, // subscription parameters.
+	subject, queue, sid []byte, isReserved bool, qos byte, jsDurName string, h msgHandler, // subscription parameters.
+	so *mqttSubOpts, // MQTT 5 subscription options, can be nil.
 ) (*subscription, error) {
-	return sess.processSub(c, subject, sid, isReserved, qos, jsDurName, h, false, nil, false, nil)
+	return sess.processSub(c, subject, queue, sid, isReserved, qos, jsDurName, h, so, false, nil, false, nil)
 }
 
 func (sess *mqttSession) processSub(
 	c *client, // subscribing client.
-	subject, sid []byte, isReserved bool, qos byte, jsDurName string, h msgHandler, // subscription parameters.
+	subject, queue, sid []byte, isReserved bool, qos byte, jsDurName string, h msgHandler, // subscription parameters.
+	so *mqttSubOpts, // MQTT 5 subscription options, can be nil.
 	initShadow bool, // do we need to scan for shadow subscriptions? (not for QOS1+)
 	rms map[string]*mqttRetainedMsg, // preloaded rms (can be empty, or missing items if errors)
 	trace bool, // trace serialized retained messages in the log?
@@ -2550,7 +2683,7 @@ func (sess *mqttSession) processSub(
 	sess.subsMu.Lock()
 	defer sess.subsMu.Unlock()
 
-	sub, err := c.processSub(subject, nil, sid, h, false)
+	sub, err := c.processSub(subject, queue, sid, h, false)
 	if err != nil {
 		// c.processSub already called c.Errorf(), so no need here.
 		return nil, err
@@ -2573,6 +2706,11 @@ func (sess *mqttSession) processSub(
 		ss.mqtt.jsDur = jsDurName
 		// A (re)configured subscription is live; clear any prior teardown mark.
 		ss.mqtt.closed = false
+		if so != nil {
+			ss.mqtt.subID, ss.mqtt.noLocal = so.ID, so.NoLocal
+		} else {
+			ss.mqtt.subID, ss.mqtt.noLocal = 0, false
+		}
 	}
 
 	if len(rms) > 0 {
@@ -2644,7 +2782,7 @@ func (as *mqttAccountSessionManager) processSubs(sess *mqttSession, c *client,
 		}
 
 		// Find retained messages.
-		if fromSubProto {
+		if fromSubProto && sess.sendRetainedOnSubscribe(f) {
 			as.addRetainedSubjectsForSubject(rmSubjects, f.filter)
 			if need, subject, _ := fwc(f.filter); need {
 				as.addRetainedSubjectsForSubject(rmSubjects, subject)
@@ -2678,9 +2816,18 @@ func (as *mqttAccountSessionManager) processSubs(sess *mqttSession, c *client,
 		}
 		subject := f.filter
 		bsubject := []byte(subject)
-		sid := subject
-		bsid := bsubject
+		sid := mqttSessionSubKey(f.queue, subject)
+		bsid := []byte(sid)
+		var bqueue []byte
+		if f.queue != _EMPTY_ {
+			bqueue = []byte(f.queue)
+		}
 		isReserved := isMQTTReservedSubscription(subject)
+		so := f.subOpts()
+		frms := rms
+		if !fromSubProto || !sess.sendRetainedOnSubscribe(f) {
+			frms = nil
+		}
 
 		var jscons *ConsumerConfig
 		var jssub *subscription
@@ -2695,10 +2842,10 @@ func (as *mqttAccountSessionManager) processSubs(sess *mqttSession, c *client,
 		as.mu.Lock()
 		sess.mu.Lock()
 		sub, err = sess.processSub(c,
-			bsubject, bsid, isReserved, f.qos, // main subject
+			bsubject, bqueue, bsid, isReserved, f.qos, // main subject
 			_EMPTY_, mqttDeliverMsgCbQoS0, // no jsDur for QOS0
-			processShadowSubs,
-			rms, trace, as)
+			so, processShadowSubs,
+			frms, trace, as)
 		sess.mu.Unlock()
 		as.mu.Unlock()
 
@@ -2712,7 +2859,7 @@ func (as *mqttAccountSessionManager) processSubs(sess *mqttSession, c *client,
 		// subscriptions of QoS >= 1. But if a JS consumer already exists and
 		// the subscription for same subject is now a QoS==0, then the JS
 		// consumer will be deleted.
-		jscons, jssub, err = sess.processJSConsumer(c, subject, sid, f.qos, fromSubProto)
+		jscons, jssub, err = sess.processJSConsumer(c, subject, f.queue, sid, f.qos, so, fromSubProto)
 		if err != nil {
 			f.qos = mqttSubAckFailure
 			sess.cleanupFailedSub(c, sub, jscons, jssub)
@@ -2721,6 +2868,7 @@ func (as *mqttAccountSessionManager) processSubs(sess *mqttSession, c *client,
 
 		// Process the wildcard subject if needed.
 		if need, fwcsubject, fwcsid := fwc(subject); need {
+			fwcsid = mqttSessionSubKey(f.queue, fwcsid)
 			var fwjscons *ConsumerConfig
 			var fwjssub *subscription
 			var fwcsub *subscription
@@ -2729,10 +2877,10 @@ func (as *mqttAccountSessionManager) processSubs(sess *mqttSession, c *client,
 			as.mu.Lock()
 			sess.mu.Lock()
 			fwcsub, err = sess.processSub(c,
-				[]byte(fwcsubject), []byte(fwcsid), isReserved, f.qos, // FWC (top-level wildcard) subject
+				[]byte(fwcsubject), bqueue, []byte(fwcsid), isReserved, f.qos, // FWC (top-level wildcard) subject
 				_EMPTY_, mqttDeliverMsgCbQoS0, // no jsDur for QOS0
-				processShadowSubs,
-				rms, trace, as)
+				so, processShadowSubs,
+				frms, trace, as)
 			sess.mu.Unlock()
 			as.mu.Unlock()
 			if err != nil {
@@ -2742,7 +2890,7 @@ func (as *mqttAccountSessionManager) processSubs(sess *mqttSession, c *client,
 				continue
 			}
 
-			fwjscons, fwjssub, err = sess.processJSConsumer(c, fwcsubject, fwcsid, f.qos, fromSubProto)
+			fwjscons, fwjssub, err = sess.processJSConsumer(c, fwcsubject, f.queue, fwcsid, f.qos, so, fromSubProto)
 			if err != nil {
 				// c.processSub already called c.Errorf(), so no need here.
 				f.qos = mqttSubAckFailure
@@ -2813,7 +2961,11 @@ func (as *mqttAccountSessionManager) serializeRetainedMsgsForSub(rms map[string]
 		// Need to use the subject for the retained message, not the `sub` subject.
 		// We can find the published retained message in rm.sub.subject.
 		// Set the RETAIN flag: [MQTT-3.3.1-8].
-		flags, headerBytes := mqttMakePublishHeader(pi, qos, false, true, []byte(rm.Topic), len(rm.Msg))
+		var props []byte
+		if c.mqtt.v5 {
+			props, _ = mqttNATSToPublishProperties(nil, _EMPTY_, sub.mqtt.subID)
+		}
+		flags, headerBytes := mqttMakePublishHeaderWithProps(pi, qos, false, true, []byte(rm.Topic), props, len(rm.Msg))
 		c.mu.Lock()
 		sub.mqtt.prm = append(sub.mqtt.prm, headerBytes, rm.Msg)
 		c.mu.Unlock()
@@ -3144,6 +3296,8 @@ func (as *mqttAccountSessionManager) createOrRestoreSession(clientID string, opt
 	sess.subs = ps.Subs
 	sess.cons = ps.Cons
 	sess.pubRelConsumer = ps.PubRel
+	sess.expiry = ps.Expiry
+	sess.subOpts = ps.SubOpts
 	as.addSession(sess, true)
 	return sess, true, nil
 }
@@ -3358,27 +3512,43 @@ func mqttSessionCreate(jsa *mqttJSA, id, idHash string, seq uint64, opts *Option
 func (sess *mqttSession) save() error {
 	sess.mu.Lock()
 	ps := mqttPersistedSession{
-		Origin: sess.jsa.id,
-		ID:     sess.id,
-		Clean:  sess.clean,
-		Subs:   sess.subs,
-		Cons:   sess.cons,
-		PubRel: sess.pubRelConsumer,
+		Origin:  sess.jsa.id,
+		ID:      sess.id,
+		Clean:   sess.clean,
+		Subs:    sess.subs,
+		Cons:    sess.cons,
+		PubRel:  sess.pubRelConsumer,
+		Expiry:  sess.expiry,
+		SubOpts: sess.subOpts,
 	}
 	b, _ := json.Marshal(&ps)
 
 	domainTk, cidHash := sess.domainTk, sess.idHash
 	seq := sess.seq
+	// When the client is gone, the record of a MQTT 5 session expires with
+	// the session.
+	var ttl uint32
+	if sess.c == nil && sess.expiry != mqttSessionExpiryNever {
+		ttl = sess.expiry
+	}
 	sess.mu.Unlock()
 
 	var hdr int
-	if seq != 0 {
+	if seq != 0 || ttl > 0 {
 		bb := bytes.Buffer{}
 		bb.WriteString(hdrLine)
-		bb.WriteString(JSExpectedLastSubjSeq)
-		bb.WriteString(":")
-		bb.WriteString(strconv.FormatInt(int64(seq), 10))
-		bb.WriteString(CR_LF)
+		if seq != 0 {
+			bb.WriteString(JSExpectedLastSubjSeq)
+			bb.WriteString(":")
+			bb.WriteString(strconv.FormatInt(int64(seq), 10))
+			bb.WriteString(CR_LF)
+		}
+		if ttl > 0 {
+			bb.WriteString(JSMessageTTL)
+			bb.WriteString(":")
+			bb.WriteString(strconv.FormatUint(uint64(ttl), 10))
+			bb.WriteString(CR_LF)
+		}
 		bb.WriteString(CR_LF)
 		hdr = bb.Len()
 		bb.Write(b)
@@ -3415,13 +3585,17 @@ func (sess *mqttSession) clear(noWait bool) error {
 	}
 	for sid, cc := range sess.cons {
 		delete(sess.cons, sid)
-		durs = append(durs, cc.Durable)
+		// See deleteConsumer() for shared subscriptions.
+		if cc.DeliverGroup == _EMPTY_ {
+			durs = append(durs, cc.Durable)
+		}
 	}
 	if sess.pubRelConsumer != nil {
 		pubRelDur = sess.pubRelConsumer.Durable
 	}
 
 	sess.subs = nil
+	sess.subOpts = nil
 	sess.pendingPublish = nil
 	sess.pendingPubRel = nil
 	sess.cpending = nil
@@ -3467,20 +3641,33 @@ func (sess *mqttSession) update(filters []*mqttFilter, add bool) error {
 	// Evaluate if we need to persist anything.
 	var needUpdate bool
 	for _, f := range filters {
+		key := mqttSessionSubKey(f.queue, f.filter)
 		if add {
 			if f.qos == mqttSubAckFailure {
 				continue
 			}
-			if qos, ok := sess.subs[f.filter]; !ok || qos != f.qos {
+			if qos, ok := sess.subs[key]; !ok || qos != f.qos {
 				if sess.subs == nil {
 					sess.subs = make(map[string]byte)
 				}
-				sess.subs[f.filter] = f.qos
+				sess.subs[key] = f.qos
+				needUpdate = true
+			}
+			if so := f.subOpts(); !so.equal(sess.subOpts[key]) {
+				if so == nil {
+					delete(sess.subOpts, key)
+				} else {
+					if sess.subOpts == nil {
+						sess.subOpts = make(map[string]*mqttSubOpts)
+					}
+					sess.subOpts[key] = so
+				}
 				needUpdate = true
 			}
 		} else {
-			if _, ok := sess.subs[f.filter]; ok {
-				delete(sess.subs, f.filter)
+			if _, ok := sess.subs[key]; ok {
+				delete(sess.subs, key)
+				delete(sess.subOpts, key)
 				needUpdate = true
 			}
 		}
@@ -3606,8 +3793,13 @@ func (sess *mqttSession) trackPublish(jsDur, jsAckSubject string) (uint16, bool)
 		// We should have a pending JS ACK for this PI.
 		ack = sess.pendingPublish[pi]
 	} else {
-		// sess.maxp will always have a value > 0.
-		if len(sess.pendingPublish) >= int(sess.maxp) {
+		// sess.maxp will always have a value > 0. A MQTT 5 client may ask for
+		// a lower limit with the "Receive Maximum" property.
+		maxp := sess.maxp
+		if sess.recvMax > 0 && sess.recvMax < maxp {
+			maxp = sess.recvMax
+		}
+		if len(sess.pendingPublish) >= int(maxp) {
 			// Indicate that we did not assign a packet identifier.
 			// The caller will not send the message to the subscription
 			// and JS will redeliver later, based on consumer's AckWait.
@@ -3728,7 +3920,11 @@ func (sess *mqttSession) untrackPubRel(pi uint16) (jsAckSubject string) {
 func (sess *mqttSession) deleteConsumer(cc *ConsumerConfig) {
 	sess.mu.Lock()
 	sess.tmaxack -= cc.MaxAckPending
-	sess.jsa.deleteConsumer(mqttStreamName, cc.Durable, true)
+	// Consumers of shared subscriptions may be used by other sessions and
+	// are removed by the server once inactive.
+	if cc.DeliverGroup == _EMPTY_ {
+		sess.jsa.deleteConsumer(mqttStreamName, cc.Durable, true)
+	}
 	sess.mu.Unlock()
 }
 
@@ -3761,9 +3957,10 @@ func (c *client) mqttParseConnect(r *mqttReader, hasMappings bool) (byte, *mqttC
 		return 0, nil, err
 	}
 	// Spec [MQTT-3.1.2-2]
-	if level != mqttProtoLevel {
+	if level != mqttProtoLevel && level != mqttProtoLevel5 {
 		return mqttConnAckRCUnacceptableProtocolVersion, nil, fmt.Errorf("unacceptable protocol version of %v", level)
 	}
+	c.mqtt.v5 = level == mqttProtoLevel5
 
 	cp := &mqttConnectProto{}
 	// Connect flags
@@ -3822,6 +4019,12 @@ func (c *client) mqttParseConnect(r *mqttReader, hasMappings bool) (byte, *mqttC
 		cp.rd = time.Duration(float64(ka)*1.5) * time.Second
 	}
 
+	if c.mqtt.v5 {
+		if rc, err := c.mqttParseConnectProperties(r, cp); err != nil {
+			return rc, nil, err
+		}
+	}
+
 	// Payload starts here and order is mandated by:
 	// Spec [MQTT-3.1.3-1]: client ID, will topic, will message, username, password
 
@@ -3832,11 +4035,14 @@ func (c *client) mqttParseConnect(r *mqttReader, hasMappings bool) (byte, *mqttC
 	}
 	// Spec [MQTT-3.1.3-7]
 	if c.mqtt.cid == _EMPTY_ {
-		if cp.flags&mqttConnFlagCleanSession == 0 {
+		// MQTT 5 does not require the clean start flag, and the assigned
+		// client ID is returned in the CONNACK, spec [MQTT-3.1.3-7].
+		if cp.flags&mqttConnFlagCleanSession == 0 && !c.mqtt.v5 {
 			return mqttConnAckRCIdentifierRejected, nil, errMQTTCIDEmptyNeedsCleanFlag
 		}
 		// Spec [MQTT-3.1.3-6]
 		c.mqtt.cid = nuid.Next()
+		c.mqtt.cidAssigned = c.mqtt.v5
 	}
 	// Spec [MQTT-3.1.3-4] and [MQTT-3.1.3-9]
 	if err := mqttValidateString(c.mqtt.cid, "client ID"); err != nil {
@@ -3852,6 +4058,17 @@ func (c *client) mqttParseConnect(r *mqttReader, hasMappings bool) (byte, *mqttC
 			qos:    wqos,
 			retain: wretain,
 		}
+		// MQTT 5 will properties come before the will topic.
+		if c.mqtt.v5 {
+			props := &c.mqtt.props
+			if err := r.readProperties(mqttPropCtxWill, props); err != nil {
+				return 0, nil, err
+			}
+			cp.will.hdr, cp.will.reply, cp.will.ttl, err = mqttPublishPropertiesToNATS(props, getHash(c.mqtt.cid))
+			if err != nil {
+				return 0, nil, err
+			}
+		}
 		var topic []byte
 		// Need to make a copy since we need to hold to this topic after the
 		// parsing of this protocol.
@@ -4046,7 +4263,18 @@ CHECK:
 	}()
 
 	// Is the client requesting a clean session or not.
-	cleanSess := cp.flags&mqttConnFlagCleanSession != 0
+	cleanStart := cp.flags&mqttConnFlagCleanSession != 0
+	cleanSess := cleanStart
+	var expiry uint32
+	if c.mqtt.v5 {
+		// In MQTT 5, "clean start" only discards the existing session, and
+		// the lifetime of the session is controlled by its expiry interval.
+		expiry = cp.expiry
+		if expiry > 0 && !asm.msgTTL {
+			expiry = mqttSessionExpiryNever
+		}
+		cleanSess = expiry == 0
+	}
 	// Session present? Assume false, will be set to true only when applicable.
 	sessp := false
 	// Do we have an existing session for this client ID
@@ -4068,9 +4296,10 @@ CHECK:
 		}
 	}
 	if exists {
-		// Clear the session if client wants a clean session.
+		// Clear the session if client wants a clean session, or if the MQTT 5
+		// session has expired.
 		// Also, Spec [MQTT-3.2.2-1]: don't report session present
-		if cleanSess || es.clean {
+		if cleanStart || es.clean || es.expired() {
 			// Spec [MQTT-3.1.2-6]: If CleanSession is set to 1, the Client and
 			// Server MUST discard any previous Session and start a new one.
 			// This Session lasts as long as the Network Connection. State data
@@ -4093,6 +4322,7 @@ CHECK:
 		ec := es.c
 		es.c = c
 		es.clean = cleanSess
+		es.expiry, es.recvMax, es.disconnected = expiry, cp.recvMax, time.Time{}
 		// Clear this flag so we resubscribe to PUBREL subject is needed.
 		es.pubRelSubscribed = false
 		es.mu.Unlock()
@@ -4106,6 +4336,7 @@ CHECK:
 			asm.addSessToFlappers(cid)
 			asm.mu.Unlock()
 			c.Warnf("Replacing old client %q since both have the same client ID %q", ec, cid)
+			ec.mqttEnqueueDisconnect(mqttRCSessionTakenOver)
 			// Close old client in separate go routine
 			go ec.closeConnection(DuplicateClientID)
 		}
@@ -4114,6 +4345,7 @@ CHECK:
 		// it MUST set Session Present to 0 in the CONNACK packet.
 		es.mu.Lock()
 		es.c, es.clean = c, cleanSess
+		es.expiry, es.recvMax = expiry, cp.recvMax
 		es.mu.Unlock()
 		// Now add this new session into the account sessions
 		asm.addSession(es, true)
@@ -4138,8 +4370,8 @@ CHECK:
 	// Process possible saved subscriptions.
 	if l := len(es.subs); l > 0 {
 		filters := make([]*mqttFilter, 0, l)
-		for subject, qos := range es.subs {
-			filters = append(filters, &mqttFilter{filter: subject, qos: qos})
+		for key, qos := range es.subs {
+			filters = append(filters, mqttFilterFromSessionSub(key, qos, es.subOpts[key]))
 		}
 		if _, err := asm.processSubs(es, c, filters, false, trace); err != nil {
 			return err
@@ -4149,6 +4381,10 @@ CHECK:
 }
 
 func (c *client) mqttEnqueueConnAck(rc byte, sessionPresent bool) {
+	if c.mqtt.v5 {
+		c.mqttEnqueueConnAckV5(rc, sessionPresent)
+		return
+	}
 	proto := [4]byte{mqttPacketConnectAck, 2, 0, rc}
 	c.mu.Lock()
 	// Spec [MQTT-3.2.2-4]. If return code is different from 0, then
@@ -4182,6 +4418,9 @@ func (s *Server) mqttHandleWill(c *client) {
 		msg:     will.message,
 		sz:      len(will.message),
 		flags:   will.qos << 1,
+		hdr:     will.hdr,
+		reply:   will.reply,
+		ttl:     will.ttl,
 	}
 	if will.retain {
 		pp.flags |= mqttPubFlagRetain
@@ -4215,37 +4454,49 @@ func (c *client) mqttParsePub(r *mqttReader, pl int, pp *mqttPublish, hasMapping
 	if err != nil {
 		return err
 	}
-	if len(pp.topic) == 0 {
-		return errMQTTTopicIsEmpty
-	}
-	if err := mqttValidateTopic(pp.topic, "topic"); err != nil {
-		return err
-	}
-	// Convert the topic to a NATS subject. This call will also check that
-	// there is no MQTT wildcards (Spec [MQTT-3.3.2-2] and [MQTT-4.7.1-1])
-	// Note that this may not result in a copy if there is no conversion.
-	// It is good because after the message is processed we won't have a
-	// reference to the buffer and we save a copy.
-	pp.subject, err = mqttTopicToNATSPubSubject(pp.topic)
-	if err != nil {
-		return err
-	}
+	pp.hdr, pp.reply, pp.ttl = nil, nil, 0
 
-	// Check for subject mapping.
-	if hasMappings {
-		// For selectMappedSubject to work, we need to have c.pa.subject set.
-		// If there is a change, c.pa.mapped will be set after the call.
-		c.pa.subject = pp.subject
-		if changed := c.selectMappedSubject(); changed {
-			// We need to keep track of the NATS subject/mapped in the `pp` structure.
-			pp.subject = c.pa.subject
-			pp.mapped = c.pa.mapped
-			// We also now need to map the original MQTT topic to the new topic
-			// based on the new subject.
-			pp.topic = natsSubjectToMQTTTopic(pp.subject)
+	processTopic := func() error {
+		if len(pp.topic) == 0 {
+			return errMQTTTopicIsEmpty
+		}
+		if err := mqttValidateTopic(pp.topic, "topic"); err != nil {
+			return err
+		}
+		// Convert the topic to a NATS subject. This call will also check that
+		// there is no MQTT wildcards (Spec [MQTT-3.3.2-2] and [MQTT-4.7.1-1])
+		// Note that this may not result in a copy if there is no conversion.
+		// It is good because after the message is processed we won't have a
+		// reference to the buffer and we save a copy.
+		pp.subject, err = mqttTopicToNATSPubSubject(pp.topic)
+		if err != nil {
+			return err
+		}
+
+		// Check for subject mapping.
+		if hasMappings {
+			// For selectMappedSubject to work, we need to have c.pa.subject set.
+			// If there is a change, c.pa.mapped will be set after the call.
+			c.pa.subject = pp.subject
+			if changed := c.selectMappedSubject(); changed {
+				// We need to keep track of the NATS subject/mapped in the `pp` structure.
+				pp.subject = c.pa.subject
+				pp.mapped = c.pa.mapped
+				// We also now need to map the original MQTT topic to the new topic
+				// based on the new subject.
+				pp.topic = natsSubjectToMQTTTopic(pp.subject)
+			}
+			// Reset those now.
+			c.pa.subject, c.pa.mapped = nil, nil
+		}
+		return nil
+	}
+	// With MQTT 5, the topic may be empty and replaced by a topic alias found
+	// in the properties, so the topic is processed after those.
+	if !c.mqtt.v5 {
+		if err := processTopic(); err != nil {
+			return err
 		}
-		// Reset those now.
-		c.pa.subject, c.pa.mapped = nil, nil
 	}
 
 	if qos > 0 {
@@ -4260,6 +4511,15 @@ func (c *client) mqttParsePub(r *mqttReader, pl int, pp *mqttPublish, hasMapping
 		pp.pi = 0
 	}
 
+	if c.mqtt.v5 {
+		if err := c.mqttParsePublishProperties(r, pp); err != nil {
+			return err
+		}
+		if err := processTopic(); err != nil {
+			return err
+		}
+	}
+
 	// The message payload will be the total packet length minus
 	// what we have consumed for the variable header
 	payloadSize := pl - (r.pos - start)
@@ -4331,6 +4591,11 @@ func mqttComputeNatsMsgSize(pp *mqttPublish, encodePP bool) int {
 				len(pp.mapped) + 2 // 2 for CRLF
 		}
 	}
+	// MQTT 5 headers.
+	size += len(pp.hdr)
+	if pp.ttl > 0 {
+		size += len(mqttNatsHeaderExpires) + 1 + 20 + 2 // ':', int64 and CRLF
+	}
 	return size
 }
 
@@ -4373,6 +4638,16 @@ func mqttNewDeliverableMessage(pp *mqttPublish, encodePP bool) (natsMsg []byte,
 		}
 	}
 
+	// Headers converted from MQTT 5 properties, with the message expiration
+	// time computed now.
+	if pp.ttl > 0 {
+		buf.WriteString(mqttNatsHeaderExpires)
+		buf.WriteByte(':')
+		buf.WriteString(strconv.FormatInt(time.Now().Unix()+pp.ttl, 10))
+		buf.WriteString(_CRLF_)
+	}
+	buf.Write(pp.hdr)
+
 	// End of header
 	buf.WriteString(_CRLF_)
 
@@ -4435,6 +4710,11 @@ func (s *Server) mqttProcessPub(c *client, pp *mqttPublish, trace bool) error {
 		err := s.mqttInitiateMsgDelivery(c, pp)
 		if err == nil {
 			c.mqttEnqueuePubResponse(mqttPacketPubAck, pp.pi, trace)
+		} else if c.mqtt.v5 {
+			// MQTT 5 allows to report the failure to the client instead of
+			// closing the connection.
+			c.mqttEnqueuePubResponseWithRC(mqttPacketPubAck, pp.pi, mqttPubReasonCode(err), trace)
+			err = nil
 		}
 		return err
 
@@ -4445,9 +4725,17 @@ func (s *Server) mqttProcessPub(c *client, pp *mqttPublish, trace bool) error {
 		// Message before sending the PUBREC or PUBCOMP. When its original
 		// sender receives the PUBREC packet, ownership of the Application
 		// Message is transferred to the receiver.
-		err := s.mqttStoreQoS2MsgOnce(c, pp)
+		var err error
+		if c.mqtt.v5 && !c.pubAllowed(bytesToString(pp.subject)) {
+			err = errMQTTPublishNotAuthorized
+		} else {
+			err = s.mqttStoreQoS2MsgOnce(c, pp)
+		}
 		if err == nil {
 			c.mqttEnqueuePubResponse(mqttPacketPubRec, pp.pi, trace)
+		} else if c.mqtt.v5 {
+			c.mqttEnqueuePubResponseWithRC(mqttPacketPubRec, pp.pi, mqttPubReasonCode(err), trace)
+			err = nil
 		}
 		return err
 
@@ -4468,7 +4756,7 @@ func (s *Server) mqttInitiateMsgDelivery(c *client, pp *mqttPublish) error {
 
 	c.pa.subject = pp.subject
 	c.pa.mapped = pp.mapped
-	c.pa.reply = nil
+	c.pa.reply = pp.reply
 	c.pa.hdr = headerLen
 	c.pa.hdb = []byte(strconv.FormatInt(int64(c.pa.hdr), 10))
 	c.pa.size = len(natsMsg)
@@ -4485,13 +4773,18 @@ func (s *Server) mqttInitiateMsgDelivery(c *client, pp *mqttPublish) error {
 	}()
 
 	_, permIssue := c.processInboundClientMsg(natsMsg)
+	qos := mqttGetQoS(pp.flags)
 	if permIssue {
+		// A MQTT 5 client is told with the PUBACK reason code.
+		if c.mqtt.v5 && qos == 1 {
+			return errMQTTPublishNotAuthorized
+		}
 		return nil
 	}
 
 	// If QoS 0 messages don't need to be stored, other (1 and 2) do. Store them
 	// JetStream under "$MQTT.msgs.<delivery-subject>"
-	if qos := mqttGetQoS(pp.flags); qos == 0 {
+	if qos == 0 {
 		return nil
 	}
 
@@ -4502,6 +4795,11 @@ func (s *Server) mqttInitiateMsgDelivery(c *client, pp *mqttPublish) error {
 	// see addToPCD and writeLoop for details).
 	c.flushClients(0)
 
+	// MQTT 5 message expiry, the stored message is removed when it expires.
+	if pp.ttl > 0 && c.mqtt.asm.msgTTL {
+		natsMsg, headerLen = mqttAddTTLHeader(natsMsg, headerLen, pp.ttl)
+	}
+
 	_, err := c.mqtt.sess.jsa.storeMsg(mqttStreamSubjectPrefix+string(c.pa.subject), headerLen, natsMsg)
 
 	return err
@@ -4575,6 +4873,10 @@ func (s *Server) mqttProcessPubRel(c *client, pi uint16, trace bool) error {
 		pi:      pi,
 		flags:   flags,
 	}
+	// Restore the MQTT 5 properties, the message is dropped if it expired.
+	if !mqttRestorePublishHeaders(pp, stored.Header) {
+		return nil
+	}
 
 	return s.mqttInitiateMsgDelivery(c, pp)
 }
@@ -4828,9 +5130,19 @@ func pubAllowed(perms *mqttPerm, subject string) bool {
 }
 
 func (c *client) mqttEnqueuePubResponse(packetType byte, pi uint16, trace bool) {
-	proto := [4]byte{packetType, 0x2, 0, 0}
+	c.mqttEnqueuePubResponseWithRC(packetType, pi, mqttRCSuccess, trace)
+}
+
+// Same as mqttEnqueuePubResponse, but with a MQTT 5 reason code, which is
+// only sent if it is not success.
+func (c *client) mqttEnqueuePubResponseWithRC(packetType byte, pi uint16, rc byte, trace bool) {
+	proto := [5]byte{packetType, 0x2, 0, 0, rc}
 	proto[2] = byte(pi >> 8)
 	proto[3] = byte(pi)
+	pl := 4
+	if rc != mqttRCSuccess {
+		proto[1], pl = 0x3, 5
+	}
 
 	// Bits 3,2,1 and 0 of the fixed header in the PUBREL Control Packet are
 	// reserved and MUST be set to 0,0,1 and 0 respectively. The Server MUST treat
@@ -4840,7 +5152,7 @@ func (c *client) mqttEnqueuePubResponse(packetType byte, pi uint16, trace bool)
 	}
 
 	c.mu.Lock()
-	c.enqueueProto(proto[:4])
+	c.enqueueProto(proto[:pl])
 	c.mu.Unlock()
 
 	if trace {
@@ -4855,7 +5167,7 @@ func (c *client) mqttEnqueuePubResponse(packetType byte, pi uint16, trace bool)
 		case mqttPacketPubComp:
 			name = "PUBCOMP"
 		}
-		c.traceOutOp(name, []byte(fmt.Sprintf("pi=%v", pi)))
+		c.traceOutOp(name, []byte(mqttAckTrace(pi, rc)))
 	}
 }
 
@@ -5000,6 +5312,18 @@ func (c *client) mqttParseSubsOrUnsubs(r *mqttReader, b byte, pl int, sub bool)
 		return 0, nil, err
 	}
 	end := r.pos + (pl - 2)
+	var subID int
+	if c.mqtt.v5 {
+		ctx := mqttPropCtxUnsubscribe
+		if sub {
+			ctx = mqttPropCtxSubscribe
+		}
+		props := &c.mqtt.props
+		if err := r.readProperties(ctx, props); err != nil {
+			return 0, nil, err
+		}
+		subID = props.subID
+	}
 	var filters []*mqttFilter
 	for r.pos < end {
 		// Don't make a copy now because, this will happen during conversion
@@ -5015,26 +5339,46 @@ func (c *client) mqttParseSubsOrUnsubs(r *mqttReader, b byte, pl int, sub bool)
 		if err := mqttValidateTopic(topic, "topic filter"); err != nil {
 			return 0, nil, err
 		}
-		var qos byte
+		f := &mqttFilter{ttopic: topic, subID: subID}
+		// MQTT 5 shared subscriptions, "$share/<group>/<filter>".
+		ftopic := topic
+		if c.mqtt.v5 {
+			group, gfilter, shared, err := mqttParseSharedFilter(topic)
+			if err != nil {
+				c.Errorf("invalid topic %q: %v", topic, err)
+				ftopic = nil
+			} else if shared {
+				f.queue, ftopic = string(group), gfilter
+			}
+		}
 		// We are going to report if we had an error during the conversion,
 		// but we don't fail the parsing. When processing the sub, we will
 		// have an error then, and the processing of subs code will send
 		// the proper mqttSubAckFailure flag for this given subscription.
-		filter, err := mqttFilterToNATSSubject(topic)
-		if err != nil {
-			c.Errorf("invalid topic %q: %v", topic, err)
+		if ftopic != nil {
+			filter, err := mqttFilterToNATSSubject(ftopic)
+			if err != nil {
+				c.Errorf("invalid topic %q: %v", topic, err)
+			}
+			f.filter = string(filter)
 		}
 		if sub {
-			qos, err = r.readByte("QoS")
+			var opts byte
+			opts, err = r.readByte("QoS")
 			if err != nil {
 				return 0, nil, err
 			}
+			f.qos = opts
+			if c.mqtt.v5 {
+				if err := f.setSubscriptionOptions(opts); err != nil {
+					return 0, nil, err
+				}
+			}
 			// Spec [MQTT-3-8.3-4].
-			if qos > 2 {
-				return 0, nil, fmt.Errorf("subscribe QoS value must be 0, 1 or 2, got %v", qos)
+			if f.qos > 2 {
+				return 0, nil, fmt.Errorf("subscribe QoS value must be 0, 1 or 2, got %v", f.qos)
 			}
 		}
-		f := &mqttFilter{ttopic: topic, filter: string(filter), qos: qos}
 		filters = append(filters, f)
 	}
 	// Spec [MQTT-3.8.3-3], [MQTT-3.10.3-2]
@@ -5097,10 +5441,11 @@ func mqttDeliverMsgCbQoS0(sub *subscription, pc *client, _ *Account, subject, re
 	// [MQTT-4.7.2-1].
 	sess.subsMu.RLock()
 	subQoS := sub.mqtt.qos
+	subID, noLocal := sub.mqtt.subID, sub.mqtt.noLocal
 	ignore := mqttMustIgnoreForReservedSub(sub, subject)
 	sess.subsMu.RUnlock()
 
-	if ignore {
+	if ignore || (noLocal && pc == cc) {
 		return
 	}
 
@@ -5142,8 +5487,22 @@ func mqttDeliverMsgCbQoS0(sub *subscription, pc *client, _ *Account, subject, re
 		topic = natsSubjectStrToMQTTTopic(subject)
 	}
 
+	var props []byte
+	if cc.mqtt.v5 {
+		var ok bool
+		if noLocal && mqttIsFromSession(hdr, sess.idHash) {
+			return
+		}
+		if props, ok = mqttNATSToPublishProperties(hdr, reply, subID); !ok {
+			return
+		}
+		if cc.mqttExceedsMaxPacket(0, topic, props, msg) {
+			return
+		}
+	}
+
 	// Message never has a packet identifier nor is marked as duplicate.
-	pc.mqttEnqueuePublishMsgTo(cc, sub, 0, 0, false, topic, msg)
+	pc.mqttEnqueuePublishMsgTo(cc, sub, 0, 0, false, topic, msg, props)
 }
 
 // This is the callback attached to a JS durable subscription for a MQTT QoS 1+
@@ -5153,6 +5512,12 @@ func mqttDeliverMsgCbQoS0(sub *subscription, pc *client, _ *Account, subject, re
 // the message contains a NATS/MQTT header that indicates that this is a
 // published QoS1+ message.
 func mqttDeliverMsgCbQoS12(sub *subscription, pc *client, _ *Account, subject, reply string, rmsg []byte) {
+	// Queue subscriptions (MQTT 5 shared subscriptions) are invoked with the
+	// consumer's delivery subject, the stream subject is the deliver subject
+	// of the producer.
+	if len(sub.queue) > 0 && len(pc.pa.deliver) > 0 {
+		subject = string(pc.pa.deliver)
+	}
 	// Message on foo.bar is stored under $MQTT.msgs.foo.bar, so the subject has to be
 	// at least as long as the stream subject prefix "$MQTT.msgs.", and after removing
 	// the prefix, has to be at least 1 character long.
@@ -5218,6 +5583,27 @@ func mqttDeliverMsgCbQoS12(sub *subscription, pc *client, _ *Account, subject, r
 		return
 	}
 
+	originalTopic := natsSubjectStrToMQTTTopic(strippedSubj)
+
+	// For MQTT 5, messages that are not to be delivered to this subscription
+	// are acknowledged so that they are not redelivered.
+	var props []byte
+	if cc.mqtt.v5 {
+		var ok bool
+		if sub.mqtt.noLocal && mqttIsFromSession(hdr, sess.idHash) {
+			sess.mu.Unlock()
+			sess.jsa.sendAck(reply)
+			return
+		}
+		// The reply is the JS ack subject, not a response topic.
+		props, ok = mqttNATSToPublishProperties(hdr, _EMPTY_, sub.mqtt.subID)
+		if !ok || cc.mqttExceedsMaxPacket(qos, originalTopic, props, msg) {
+			sess.mu.Unlock()
+			sess.jsa.sendAck(reply)
+			return
+		}
+	}
+
 	pi, dup := sess.trackPublish(sub.mqtt.jsDur, reply)
 	sess.mu.Unlock()
 
@@ -5228,8 +5614,7 @@ func mqttDeliverMsgCbQoS12(sub *subscription, pc *client, _ *Account, subject, r
 		return
 	}
 
-	originalTopic := natsSubjectStrToMQTTTopic(strippedSubj)
-	pc.mqttEnqueuePublishMsgTo(cc, sub, pi, qos, dup, originalTopic, msg)
+	pc.mqttEnqueuePublishMsgTo(cc, sub, pi, qos, dup, originalTopic, msg, props)
 }
 
 func mqttDeliverPubRelCb(sub *subscription, pc *client, _ *Account, subject, reply string, rmsg []byte) {
@@ -5335,7 +5720,10 @@ func sparkbReplaceDeathTimestamp(msg []byte) []byte {
 
 // Common function to mqtt delivery callbacks to serialize and send the message
 // to the `cc` client.
-func (c *client) mqttEnqueuePublishMsgTo(cc *client, sub *subscription, pi uint16, qos byte, dup bool, topic, msg []byte) {
+//
+// `props` are the MQTT 5 properties (including their length) and must be nil
+// for MQTT 3.1.1 clients.
+func (c *client) mqttEnqueuePublishMsgTo(cc *client, sub *subscription, pi uint16, qos byte, dup bool, topic, msg, props []byte) {
 	// [tck-id-conformance-mqtt-aware-nbirth-mqtt-retain] A Sparkplug Aware
 	// MQTT Server MUST make NBIRTH messages available on the topic:
 	// $sparkplug/certificates/namespace/group_id/NBIRTH/edge_node_id with
@@ -5357,7 +5745,7 @@ func (c *client) mqttEnqueuePublishMsgTo(cc *client, sub *subscription, pi uint1
 		msg = sparkbReplaceDeathTimestamp(msg)
 	}
 
-	flags, headerBytes := mqttMakePublishHeader(pi, qos, dup, retain, topic, len(msg))
+	flags, headerBytes := mqttMakePublishHeaderWithProps(pi, qos, dup, retain, topic, props, len(msg))
 
 	cc.mu.Lock()
 	if sub.mqtt.prm != nil {
@@ -5385,8 +5773,14 @@ func (c *client) mqttEnqueuePublishMsgTo(cc *client, sub *subscription, pi uint1
 
 // Serializes to the given writer the message for the given subject.
 func (w *mqttWriter) WritePublishHeader(pi uint16, qos byte, dup, retained bool, topic []byte, msgLen int) byte {
+	return w.WritePublishHeaderWithProps(pi, qos, dup, retained, topic, nil, msgLen)
+}
+
+// Same as WritePublishHeader, but includes the given MQTT 5 properties, which
+// must be prefixed with their length.
+func (w *mqttWriter) WritePublishHeaderWithProps(pi uint16, qos byte, dup, retained bool, topic, props []byte, msgLen int) byte {
 	// Compute len (will have to add packet id if message is sent as QoS>=1)
-	pkLen := 2 + len(topic) + msgLen
+	pkLen := 2 + len(topic) + len(props) + msgLen
 	var flags byte
 
 	// Set flags for dup/retained/qos1
@@ -5407,14 +5801,20 @@ func (w *mqttWriter) WritePublishHeader(pi uint16, qos byte, dup, retained bool,
 	if qos > 0 {
 		w.WriteUint16(pi)
 	}
+	w.Write(props)
 
 	return flags
 }
 
 // Serializes to the given writer the message for the given subject.
 func mqttMakePublishHeader(pi uint16, qos byte, dup, retained bool, topic []byte, msgLen int) (byte, []byte) {
-	headerBuf := newMQTTWriter(mqttInitialPubHeader + len(topic))
-	flags := headerBuf.WritePublishHeader(pi, qos, dup, retained, topic, msgLen)
+	return mqttMakePublishHeaderWithProps(pi, qos, dup, retained, topic, nil, msgLen)
+}
+
+// Same as mqttMakePublishHeader, with MQTT 5 properties, see WritePublishHeaderWithProps.
+func mqttMakePublishHeaderWithProps(pi uint16, qos byte, dup, retained bool, topic, props []byte, msgLen int) (byte, []byte) {
+	headerBuf := newMQTTWriter(mqttInitialPubHeader + len(topic) + len(props))
+	flags := headerBuf.WritePublishHeaderWithProps(pi, qos, dup, retained, topic, props, msgLen)
 	return flags, headerBuf.Bytes()
 }
 
@@ -5555,8 +5955,13 @@ func (sess *mqttSession) ensurePubRelConsumerSubscription(c *client) error {
 //
 // Session lock is acquired and released as needed. Session is in the locked
 // map.
-func (sess *mqttSession) processJSConsumer(c *client, subject, sid string,
-	qos byte, fromSubProto bool) (*ConsumerConfig, *subscription, error) {
+//
+// For a MQTT 5 shared subscription (`queue` is not empty), the JS durable
+// consumer is shared by all sessions subscribed with the same group and
+// filter, and is delivered to a queue subscription so that each message is
+// delivered to a single session.
+func (sess *mqttSession) processJSConsumer(c *client, subject, queue, sid string,
+	qos byte, so *mqttSubOpts, fromSubProto bool) (*ConsumerConfig, *subscription, error) {
 
 	sess.mu.Lock()
 	cc, exists := sess.cons[sid]
@@ -5612,8 +6017,23 @@ func (sess *mqttSession) processJSConsumer(c *client, subject, sid string,
 		}
 		// If this is called when processing SUBSCRIBE protocol, then if
 		// the JS consumer already exists, we are done (it was created
-		// during the processing of CONNECT).
+		// during the processing of CONNECT), except for updating the
+		// MQTT 5 subscription options.
 		if fromSubProto {
+			c.mu.Lock()
+			sub := c.subs[cc.DeliverSubject]
+			c.mu.Unlock()
+			if sub != nil && sub.mqtt != nil {
+				sess.mu.Lock()
+				sess.subsMu.Lock()
+				if so != nil {
+					sub.mqtt.subID, sub.mqtt.noLocal = so.ID, so.NoLocal
+				} else {
+					sub.mqtt.subID, sub.mqtt.noLocal = 0, false
+				}
+				sess.subsMu.Unlock()
+				sess.mu.Unlock()
+			}
 			return nil, nil, nil
 		}
 	}
@@ -5627,7 +6047,15 @@ func (sess *mqttSession) processJSConsumer(c *client, subject, sid string,
 	if exists {
 		inbox = cc.DeliverSubject
 	} else {
-		inbox = mqttSubPrefix + nuid.Next()
+		var durName string
+		if queue == _EMPTY_ {
+			inbox = mqttSubPrefix + nuid.Next()
+			durName = idHash + "_" + nuid.Next()
+		} else {
+			hash := getHash(queue + " " + subject)
+			inbox = mqttShareDeliverySubjectPrefix + hash
+			durName = mqttShareConsumerDurablePrefix + hash
+		}
 		opts := c.srv.getOpts()
 		ackWait := opts.MQTT.AckWait
 		if ackWait == 0 {
@@ -5644,11 +6072,11 @@ func (sess *mqttSession) processJSConsumer(c *client, subject, sid string,
 				after, mqttMaxAckTotalLimit)
 		}
 
-		durName := idHash + "_" + nuid.Next()
 		ccr := &CreateConsumerRequest{
 			Stream: mqttStreamName,
 			Config: ConsumerConfig{
 				DeliverSubject: inbox,
+				DeliverGroup:   queue,
 				Durable:        durName,
 				AckPolicy:      AckExplicit,
 				DeliverPolicy:  DeliverNew,
@@ -5661,6 +6089,15 @@ func (sess *mqttSession) processJSConsumer(c *client, subject, sid string,
 		if opts.MQTT.ConsumerInactiveThreshold > 0 {
 			ccr.Config.InactiveThreshold = opts.MQTT.ConsumerInactiveThreshold
 		}
+		if queue != _EMPTY_ {
+			// Shared consumers are never deleted by a session, only when
+			// there is no longer any subscription in the group.
+			if ccr.Config.InactiveThreshold == 0 {
+				ccr.Config.InactiveThreshold = mqttDefaultShareInactiveThreshold
+			}
+		} else if it := sess.consumerInactiveThreshold(); it > ccr.Config.InactiveThreshold {
+			ccr.Config.InactiveThreshold = it
+		}
 		if _, err := sess.jsa.createDurableConsumer(ccr); err != nil {
 			c.Errorf("Unable to add JetStream consumer for subscription on %q: err=%v", subject, err)
 			return nil, nil, err
@@ -5673,8 +6110,12 @@ func (sess *mqttSession) processJSConsumer(c *client, subject, sid string,
 	// for the JS durable's deliver subject.
 	sess.mu.Lock()
 	sess.tmaxack = tmaxack
-	sub, err := sess.processQOS12Sub(c, []byte(inbox), []byte(inbox),
-		isMQTTReservedSubscription(subject), qos, cc.Durable, mqttDeliverMsgCbQoS12)
+	var bqueue []byte
+	if cc.DeliverGroup != _EMPTY_ {
+		bqueue = []byte(cc.DeliverGroup)
+	}
+	sub, err := sess.processQOS12Sub(c, []byte(inbox), bqueue, []byte(inbox),
+		isMQTTReservedSubscription(subject), qos, cc.Durable, mqttDeliverMsgCbQoS12, so)
 	sess.mu.Unlock()
 
 	if err != nil {
@@ -5702,11 +6143,19 @@ func (c *client) mqttSendRetainedMsgsToNewSubs(subs []*subscription) {
 }
 
 func (c *client) mqttEnqueueSubAck(pi uint16, filters []*mqttFilter) {
-	w := newMQTTWriter(7 + len(filters))
+	w := newMQTTWriter(8 + len(filters))
 	w.WriteByte(mqttPacketSubAck)
-	// packet length is 2 (for packet identifier) and 1 byte per filter.
-	w.WriteVarInt(2 + len(filters))
-	w.WriteUint16(pi)
+	if !c.mqtt.v5 {
+		// packet length is 2 (for packet identifier) and 1 byte per filter.
+		w.WriteVarInt(2 + len(filters))
+		w.WriteUint16(pi)
+	} else {
+		// MQTT 5 adds an empty property length, and the QoS values are also
+		// valid reason codes, as is mqttSubAckFailure (unspecified error).
+		w.WriteVarInt(3 + len(filters))
+		w.WriteUint16(pi)
+		w.WriteByte(0)
+	}
 	for _, f := range filters {
 		w.WriteByte(f.qos)
 	}
@@ -5780,15 +6229,20 @@ func (c *client) mqttProcessUnsubs(filters []*mqttFilter) error {
 		}
 	}
 	for _, f := range filters {
-		sid := f.filter
+		sid := mqttSessionSubKey(f.queue, f.filter)
+		// The filter's QoS is not used for UNSUBSCRIBE, it is used to hold
+		// the MQTT 5 UNSUBACK reason code.
+		if _, ok := sess.subs[sid]; !ok {
+			f.qos = mqttRCNoSubscriptionExisted
+		}
 		// Remove JS Consumer if one exists for this sid
 		removeJSCons(sid)
 		if err := c.processUnsub([]byte(sid)); err != nil {
 			c.Errorf("error unsubscribing from %q: %v", sid, err)
 		}
-		if mqttNeedSubForLevelUp(sid) {
-			subject := sid[:len(sid)-2]
-			sid = subject + mqttMultiLevelSidSuffix
+		if mqttNeedSubForLevelUp(f.filter) {
+			subject := f.filter[:len(f.filter)-2]
+			sid = mqttSessionSubKey(f.queue, subject+mqttMultiLevelSidSuffix)
 			removeJSCons(sid)
 			if err := c.processUnsub([]byte(sid)); err != nil {
 				c.Errorf("error unsubscribing from %q: %v", subject, err)
@@ -5798,11 +6252,21 @@ func (c *client) mqttProcessUnsubs(filters []*mqttFilter) error {
 	return sess.update(filters, false)
 }
 
-func (c *client) mqttEnqueueUnsubAck(pi uint16) {
-	w := newMQTTWriter(4)
+func (c *client) mqttEnqueueUnsubAck(pi uint16, filters []*mqttFilter) {
+	w := newMQTTWriter(5 + len(filters))
 	w.WriteByte(mqttPacketUnsubAck)
-	w.WriteVarInt(2)
-	w.WriteUint16(pi)
+	if !c.mqtt.v5 {
+		w.WriteVarInt(2)
+		w.WriteUint16(pi)
+	} else {
+		// Packet identifier, empty properties and a reason code per filter.
+		w.WriteVarInt(3 + len(filters))
+		w.WriteUint16(pi)
+		w.WriteByte(0)
+		for _, f := range filters {
+			w.WriteByte(f.qos)
+		}
+	}
 	c.mu.Lock()
 	c.enqueueProto(w.Bytes())
 	c.mu.Unlock()
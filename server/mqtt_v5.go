@@ -0,0 +1,961 @@
+// Copyright 2026 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// References to "spec" in this file are from
+// https://docs.oasis-open.org/mqtt/mqtt/v5.0/os/mqtt-v5.0-os.html
+
+const (
+	mqttProtoLevel5 = byte(0x5)
+
+	// Property identifiers, spec section 2.2.2.2
+	mqttPropPayloadFormat        = byte(0x01)
+	mqttPropMessageExpiry        = byte(0x02)
+	mqttPropContentType          = byte(0x03)
+	mqttPropResponseTopic        = byte(0x08)
+	mqttPropCorrelationData      = byte(0x09)
+	mqttPropSubscriptionID       = byte(0x0b)
+	mqttPropSessionExpiry        = byte(0x11)
+	mqttPropAssignedClientID     = byte(0x12)
+	mqttPropAuthMethod           = byte(0x15)
+	mqttPropAuthData             = byte(0x16)
+	mqttPropRequestProblemInfo   = byte(0x17)
+	mqttPropWillDelay            = byte(0x18)
+	mqttPropRequestResponseInfo  = byte(0x19)
+	mqttPropServerReference      = byte(0x1c)
+	mqttPropReasonString         = byte(0x1f)
+	mqttPropReceiveMaximum       = byte(0x21)
+	mqttPropTopicAliasMaximum    = byte(0x22)
+	mqttPropTopicAlias           = byte(0x23)
+	mqttPropMaximumQoS           = byte(0x24)
+	mqttPropRetainAvailable      = byte(0x25)
+	mqttPropUserProperty         = byte(0x26)
+	mqttPropMaximumPacketSize    = byte(0x27)
+	mqttPropWildcardSubAvailable = byte(0x28)
+	mqttPropSubIDAvailable       = byte(0x29)
+	mqttPropSharedSubAvailable   = byte(0x2a)
+
+	// Reason codes, spec section 2.4
+	mqttRCSuccess                = byte(0x00)
+	mqttRCDisconnectWithWill     = byte(0x04)
+	mqttRCNoMatchingSubscribers  = byte(0x10)
+	mqttRCNoSubscriptionExisted  = byte(0x11)
+	mqttRCUnspecifiedError       = byte(0x80)
+	mqttRCMalformedPacket        = byte(0x81)
+	mqttRCProtocolError          = byte(0x82)
+	mqttRCUnsupportedProtocol    = byte(0x84)
+	mqttRCClientIDNotValid       = byte(0x85)
+	mqttRCBadUserNameOrPassword  = byte(0x86)
+	mqttRCNotAuthorized          = byte(0x87)
+	mqttRCServerUnavailable      = byte(0x88)
+	mqttRCBadAuthMethod          = byte(0x8c)
+	mqttRCSessionTakenOver       = byte(0x8e)
+	mqttRCTopicFilterInvalid     = byte(0x8f)
+	mqttRCTopicAliasInvalid      = byte(0x94)
+	mqttRCPacketTooLarge         = byte(0x95)
+	mqttRCQoSNotSupported        = byte(0x9b)
+	mqttRCSharedSubNotSupported  = byte(0x9e)
+	mqttRCSubIDNotSupported      = byte(0xa1)
+	mqttRCWildcardSubUnsupported = byte(0xa2)
+
+	// Subscription options, spec section 3.8.3.1
+	mqttSubOptQoS            = byte(0x03)
+	mqttSubOptNoLocal        = byte(0x04)
+	mqttSubOptRetainAsPub    = byte(0x08)
+	mqttSubOptRetainHandling = byte(0x30)
+	mqttSubOptReserved       = byte(0xc0)
+
+	// Retain handling values (after shifting the option bits).
+	mqttRetainHandlingSendOnSubscribe = byte(0)
+	mqttRetainHandlingSendIfNew       = byte(1)
+	mqttRetainHandlingDoNotSend       = byte(2)
+
+	// A session expiry interval of this value means that the session does
+	// not expire, spec section 3.1.2.11.2.
+	mqttSessionExpiryNever = uint32(0xFFFFFFFF)
+
+	// The consumers of a session with a finite expiry interval are given an
+	// inactive threshold of the expiry plus this grace period, so that they
+	// are not removed before the session record itself.
+	mqttSessionExpiryGrace = 10 * time.Second
+
+	// The maximum number of topic aliases that we accept from a client.
+	mqttTopicAliasMaximum = uint16(0xFF)
+
+	// Prefix of a shared subscription topic filter: "$share/<group>/<filter>"
+	mqttSharePrefix = "$share/"
+
+	// Durable name prefix and delivery subject prefix of the JS consumers
+	// backing QoS 1 and 2 shared subscriptions.
+	mqttShareConsumerDurablePrefix = "$MQTT_SHARE_"
+	mqttShareDeliverySubjectPrefix = mqttSubPrefix + "share."
+
+	// Inactive threshold of a shared subscription consumer, used when the
+	// server is not configured with a consumer inactive threshold.
+	mqttDefaultShareInactiveThreshold = 5 * time.Minute
+)
+
+// Bit for each packet (or part of a packet) in which a property is allowed.
+const (
+	mqttPropCtxConnect = uint8(1 << iota)
+	mqttPropCtxWill
+	mqttPropCtxPublish
+	mqttPropCtxAck
+	mqttPropCtxSubscribe
+	mqttPropCtxUnsubscribe
+	mqttPropCtxDisconnect
+)
+
+// Where a property can be received from a client. Properties that only a
+// server may send are not in this map and are rejected.
+var mqttPropContexts = map[byte]uint8{
+	mqttPropPayloadFormat:       mqttPropCtxWill | mqttPropCtxPublish,
+	mqttPropMessageExpiry:       mqttPropCtxWill | mqttPropCtxPublish,
+	mqttPropContentType:         mqttPropCtxWill | mqttPropCtxPublish,
+	mqttPropResponseTopic:       mqttPropCtxWill | mqttPropCtxPublish,
+	mqttPropCorrelationData:     mqttPropCtxWill | mqttPropCtxPublish,
+	mqttPropSubscriptionID:      mqttPropCtxSubscribe,
+	mqttPropSessionExpiry:       mqttPropCtxConnect | mqttPropCtxDisconnect,
+	mqttPropAuthMethod:          mqttPropCtxConnect,
+	mqttPropAuthData:            mqttPropCtxConnect,
+	mqttPropRequestProblemInfo:  mqttPropCtxConnect,
+	mqttPropWillDelay:           mqttPropCtxWill,
+	mqttPropRequestResponseInfo: mqttPropCtxConnect,
+	mqttPropServerReference:     mqttPropCtxDisconnect,
+	mqttPropReasonString:        mqttPropCtxAck | mqttPropCtxDisconnect,
+	mqttPropReceiveMaximum:      mqttPropCtxConnect,
+	mqttPropTopicAliasMaximum:   mqttPropCtxConnect,
+	mqttPropTopicAlias:          mqttPropCtxPublish,
+	mqttPropUserProperty: mqttPropCtxConnect | mqttPropCtxWill | mqttPropCtxPublish |
+		mqttPropCtxAck | mqttPropCtxSubscribe | mqttPropCtxUnsubscribe | mqttPropCtxDisconnect,
+	mqttPropMaximumPacketSize: mqttPropCtxConnect,
+}
+
+var (
+	errMQTTTopicAliasInvalid     = errors.New("topic alias invalid")
+	errMQTTTopicAliasUnknown     = errors.New("topic alias not previously set")
+	errMQTTSessionExpiryFromZero = errors.New("session expiry interval cannot be set on disconnect when it was 0 on connect")
+)
+
+// mqttReasonCodeError is returned while parsing or processing packets of a
+// MQTT 5 connection when the server needs to send a DISCONNECT with a specific
+// reason code before closing the connection.
+type mqttReasonCodeError struct {
+	rc  byte
+	err error
+}
+
+func (e *mqttReasonCodeError) Error() string { return e.err.Error() }
+func (e *mqttReasonCodeError) Unwrap() error { return e.err }
+
+type mqttUserProperty struct {
+	key   []byte
+	value []byte
+}
+
+// mqttProperties holds the properties of a MQTT 5 packet received from a
+// client. Byte slices reference the read buffer and must be copied if they
+// are needed after the packet has been processed.
+type mqttProperties struct {
+	set             uint64 // bit (1 << identifier) of each received property
+	payloadFormat   byte
+	messageExpiry   uint32
+	contentType     []byte
+	responseTopic   []byte
+	correlationData []byte
+	subID           int
+	sessionExpiry   uint32
+	authMethod      []byte
+	receiveMaximum  uint16
+	topicAliasMax   uint16
+	topicAlias      uint16
+	maxPacketSize   uint32
+	userProps       []mqttUserProperty
+}
+
+func (p *mqttProperties) has(id byte) bool {
+	return p.set&(1<<id) != 0
+}
+
+// Options of a subscription that are specific to MQTT 5 and are persisted
+// with the session.
+type mqttSubOpts struct {
+	ID      int  `json:"id,omitempty"`
+	NoLocal bool `json:"nl,omitempty"`
+}
+
+// Reads the properties of a MQTT 5 packet. `ctx` is the mqttPropCtx* bit of
+// the packet, used to reject properties that are not allowed in it.
+func (r *mqttReader) readProperties(ctx uint8, props *mqttProperties) (err error) {
+	*props = mqttProperties{userProps: props.userProps[:0]}
+	defer func() {
+		if err != nil {
+			err = &mqttReasonCodeError{rc: mqttRCMalformedPacket, err: err}
+		}
+	}()
+
+	l, complete, err := r.readVarInt()
+	if err != nil {
+		return err
+	}
+	if !complete {
+		return fmt.Errorf("error reading properties length: %v", io.ErrUnexpectedEOF)
+	}
+	end := r.pos + l
+	if end > len(r.buf) {
+		return fmt.Errorf("error reading properties: %v", io.ErrUnexpectedEOF)
+	}
+	for r.pos < end {
+		id, err := r.readByte("property identifier")
+		if err != nil {
+			return err
+		}
+		if allowed := mqttPropContexts[id]; allowed&ctx == 0 {
+			return fmt.Errorf("property 0x%02x is not allowed in this packet", id)
+		}
+		// Spec [MQTT-2.2.2-1]: only user properties (and subscription
+		// identifiers in server PUBLISH) can be included more than once.
+		if id != mqttPropUserProperty && props.has(id) {
+			return fmt.Errorf("property 0x%02x included more than once", id)
+		}
+		props.set |= 1 << id
+
+		switch id {
+		case mqttPropPayloadFormat:
+			props.payloadFormat, err = r.readByte("payload format indicator")
+			if err == nil && props.payloadFormat > 1 {
+				err = fmt.Errorf("invalid payload format indicator %v", props.payloadFormat)
+			}
+		case mqttPropMessageExpiry:
+			props.messageExpiry, err = r.readUint32("message expiry interval")
+		case mqttPropContentType:
+			props.contentType, err = r.readUTF8Bytes("content type")
+		case mqttPropResponseTopic:
+			props.responseTopic, err = r.readUTF8Bytes("response topic")
+			if err == nil && len(props.responseTopic) == 0 {
+				err = errors.New("response topic cannot be empty")
+			}
+		case mqttPropCorrelationData:
+			props.correlationData, err = r.readBytes("correlation data", false)
+		case mqttPropSubscriptionID:
+			var complete bool
+			props.subID, complete, err = r.readVarInt()
+			if err == nil && !complete {
+				err = fmt.Errorf("error reading subscription identifier: %v", io.ErrUnexpectedEOF)
+			}
+			// Spec [MQTT-3.8.2.1.2]
+			if err == nil && props.subID == 0 {
+				err = errors.New("subscription identifier cannot be 0")
+			}
+		case mqttPropSessionExpiry:
+			props.sessionExpiry, err = r.readUint32("session expiry interval")
+		case mqttPropAuthMethod:
+			props.authMethod, err = r.readUTF8Bytes("authentication method")
+		case mqttPropAuthData:
+			_, err = r.readBytes("authentication data", false)
+		case mqttPropRequestProblemInfo, mqttPropRequestResponseInfo:
+			var b byte
+			if b, err = r.readByte("request information"); err == nil && b > 1 {
+				err = fmt.Errorf("invalid value %v for property 0x%02x", b, id)
+			}
+		case mqttPropWillDelay:
+			_, err = r.readUint32("will delay interval")
+		case mqttPropServerReference, mqttPropReasonString:
+			_, err = r.readUTF8Bytes("property")
+		case mqttPropReceiveMaximum:
+			props.receiveMaximum, err = r.readUint16("receive maximum")
+			if err == nil && props.receiveMaximum == 0 {
+				err = errors.New("receive maximum cannot be 0")
+			}
+		case mqttPropTopicAliasMaximum:
+			props.topicAliasMax, err = r.readUint16("topic alias maximum")
+		case mqttPropTopicAlias:
+			props.topicAlias, err = r.readUint16("topic alias")
+		case mqttPropMaximumPacketSize:
+			props.maxPacketSize, err = r.readUint32("maximum packet size")
+			if err == nil && props.maxPacketSize == 0 {
+				err = errors.New("maximum packet size cannot be 0")
+			}
+		case mqttPropUserProperty:
+			var up mqttUserProperty
+			if up.key, err = r.readUTF8Bytes("user property name"); err == nil {
+				up.value, err = r.readUTF8Bytes("user property value")
+			}
+			props.userProps = append(props.userProps, up)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if r.pos != end {
+		return fmt.Errorf("invalid properties length %v", l)
+	}
+	return nil
+}
+
+// Reads a UTF-8 encoded string and validates it per spec section 1.5.4.
+func (r *mqttReader) readUTF8Bytes(field string) ([]byte, error) {
+	b, err := r.readBytes(field, false)
+	if err != nil {
+		return nil, err
+	}
+	if err := mqttValidateTopic(b, field); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func (r *mqttReader) readUint32(field string) (uint32, error) {
+	if len(r.buf)-r.pos < 4 {
+		return 0, fmt.Errorf("error reading %s: %v", field, io.ErrUnexpectedEOF)
+	}
+	start := r.pos
+	r.pos += 4
+	return binary.BigEndian.Uint32(r.buf[start:r.pos]), nil
+}
+
+func (w *mqttWriter) WriteUint32(i uint32) {
+	w.WriteByte(byte(i >> 24))
+	w.WriteByte(byte(i >> 16))
+	w.WriteByte(byte(i >> 8))
+	w.WriteByte(byte(i))
+}
+
+// Returns the number of bytes needed to encode `v` as a variable byte integer.
+func mqttVarIntLen(v int) int {
+	n := 1
+	for v >= 0x80 {
+		v >>= 7
+		n++
+	}
+	return n
+}
+
+// Returns the given property block prefixed with its length.
+func mqttPropertiesWithLength(props []byte) []byte {
+	w := newMQTTWriter(len(props) + 4)
+	w.WriteVarInt(len(props))
+	w.Write(props)
+	return w.Bytes()
+}
+
+// Maps MQTT 3.1.1 CONNACK return codes to MQTT 5 reason codes.
+func mqttConnAckReasonCode(rc byte) byte {
+	switch rc {
+	case mqttConnAckRCConnectionAccepted:
+		return mqttRCSuccess
+	case mqttConnAckRCUnacceptableProtocolVersion:
+		return mqttRCUnsupportedProtocol
+	case mqttConnAckRCIdentifierRejected:
+		return mqttRCClientIDNotValid
+	case mqttConnAckRCServerUnavailable:
+		return mqttRCServerUnavailable
+	case mqttConnAckRCBadUserOrPassword:
+		return mqttRCBadUserNameOrPassword
+	case mqttConnAckRCNotAuthorized:
+		return mqttRCNotAuthorized
+	case mqttConnAckRCQoS2WillRejected:
+		return mqttRCQoSNotSupported
+	}
+	return rc
+}
+
+// Returns true if `key` can be used as a NATS header name and is not one of
+// the headers reserved for NATS or MQTT internal use.
+func mqttIsValidUserPropertyKey(key []byte) bool {
+	if len(key) == 0 || mqttIsReservedHeader(key) {
+		return false
+	}
+	for _, c := range key {
+		if c <= ' ' || c == ':' || c == 0x7f {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns true for headers that are not converted to MQTT 5 user properties
+// when delivering NATS messages to MQTT 5 clients.
+func mqttIsReservedHeader(key []byte) bool {
+	for _, pre := range [...]string{"Nmqtt-", "Nats-"} {
+		if len(key) >= len(pre) && strings.EqualFold(bytesToString(key[:len(pre)]), pre) {
+			return true
+		}
+	}
+	return false
+}
+
+// Invokes `f` for each key/value of the given NATS header.
+func mqttForEachHeader(hdr []byte, f func(key, val []byte)) {
+	// Skip the hdrLine
+	if !bytes.HasPrefix(hdr, stringToBytes(hdrLine)) {
+		return
+	}
+	crLFAsBytes := stringToBytes(CR_LF)
+	for i := len(hdrLine); i < len(hdr); {
+		// Search for key/val delimiter.
+		del := bytes.IndexByte(hdr[i:], ':')
+		// Not found or key is length 0, we stop.
+		if del <= 0 {
+			break
+		}
+		keyStart := i
+		// Walk back to remove spaces between the key and ':' if applicable.
+		index := keyStart + del - 1
+		for index > keyStart && hdr[index] == ' ' {
+			index--
+		}
+		key := hdr[keyStart : index+1]
+		// If what we had is only spaces, we stop.
+		if len(key) == 0 {
+			break
+		}
+		i += del + 1
+		valStart := i
+		// Search for `\r\n`.
+		nl := bytes.Index(hdr[valStart:], crLFAsBytes)
+		// If we don't find, we stop.
+		if nl < 0 {
+			break
+		}
+		index = valStart
+		// Remove possible spaces between the ':' and the value.
+		for index < valStart+nl && hdr[index] == ' ' {
+			index++
+		}
+		// Create a slice and limit capacity to the value range.
+		f(key, hdr[index:valStart+nl:valStart+nl])
+		// Reposition to past the `\r\n`.
+		i += nl + 2
+	}
+}
+
+// Converts the properties of a MQTT 5 PUBLISH (or Will) to the NATS header
+// lines that are added to the NATS message, the NATS reply subject (from the
+// response topic) and the message TTL in seconds (from the message expiry
+// interval, 0 if none). `origin` is the client ID hash of the publisher, used for the
+// "No Local" subscription option.
+func mqttPublishPropertiesToNATS(props *mqttProperties, origin string) (hdr, reply []byte, ttl int64, err error) {
+	var bb bytes.Buffer
+	writeHdr := func(key string, value []byte) {
+		bb.WriteString(key)
+		bb.WriteByte(':')
+		bb.Write(value)
+		bb.WriteString(_CRLF_)
+	}
+	if origin != _EMPTY_ {
+		writeHdr(mqttNatsHeaderOrigin, stringToBytes(origin))
+	}
+	if props.has(mqttPropPayloadFormat) {
+		writeHdr(mqttNatsHeaderFormat, []byte{'0' + props.payloadFormat})
+	}
+	// The expiration header is added when the NATS message is created, since
+	// the expiry interval of a will message starts when it is published.
+	if props.has(mqttPropMessageExpiry) {
+		ttl = max(int64(props.messageExpiry), 1)
+	}
+	if len(props.contentType) > 0 && bytes.IndexAny(props.contentType, "\r\n") < 0 {
+		writeHdr(mqttNatsHeaderContentType, props.contentType)
+	}
+	if len(props.responseTopic) > 0 {
+		// Spec [MQTT-3.3.2-14]: the response topic is a topic name.
+		if reply, err = mqttTopicToNATSPubSubject(props.responseTopic); err != nil {
+			return nil, nil, 0, err
+		}
+		reply = copyBytes(reply)
+		writeHdr(mqttNatsHeaderReply, reply)
+	}
+	if len(props.correlationData) > 0 {
+		writeHdr(mqttNatsHeaderCorrelation, []byte(base64.StdEncoding.EncodeToString(props.correlationData)))
+	}
+	for _, up := range props.userProps {
+		// User properties that can't be represented as NATS headers are dropped.
+		if !mqttIsValidUserPropertyKey(up.key) || bytes.IndexAny(up.value, "\r\n") >= 0 {
+			continue
+		}
+		writeHdr(bytesToString(up.key), up.value)
+	}
+	return bb.Bytes(), reply, ttl, nil
+}
+
+// Builds the properties, prefixed with their length, of a PUBLISH packet sent
+// to a MQTT 5 client, from the headers and reply subject of the NATS message
+// being delivered. Returns false if the message has expired and must not be
+// delivered, spec [MQTT-3.3.2-5].
+func mqttNATSToPublishProperties(hdr []byte, reply string, subID int) ([]byte, bool) {
+	w := newMQTTWriter(len(hdr) + 8)
+	expired := false
+	hasResponseTopic := false
+	mqttForEachHeader(hdr, func(key, val []byte) {
+		switch k := bytesToString(key); {
+		case k == mqttNatsHeaderFormat:
+			if len(val) == 1 && val[0] == '1' {
+				w.WriteByte(mqttPropPayloadFormat)
+				w.WriteByte(1)
+			}
+		case k == mqttNatsHeaderExpires:
+			expires, err := strconv.ParseInt(bytesToString(val), 10, 64)
+			if err != nil {
+				return
+			}
+			// Spec [MQTT-3.3.2-6]: send the remaining interval.
+			remaining := expires - time.Now().Unix()
+			if remaining <= 0 {
+				expired = true
+				return
+			}
+			w.WriteByte(mqttPropMessageExpiry)
+			w.WriteUint32(uint32(min(remaining, int64(mqttSessionExpiryNever))))
+		case strings.EqualFold(k, mqttNatsHeaderContentType):
+			w.WriteByte(mqttPropContentType)
+			w.WriteBytes(val)
+		case k == mqttNatsHeaderReply:
+			if len(val) > 0 {
+				hasResponseTopic = true
+				w.WriteByte(mqttPropResponseTopic)
+				w.WriteBytes(natsSubjectToMQTTTopic(val))
+			}
+		case k == mqttNatsHeaderCorrelation:
+			if cd, err := base64.StdEncoding.DecodeString(bytesToString(val)); err == nil {
+				w.WriteByte(mqttPropCorrelationData)
+				w.WriteBytes(cd)
+			}
+		case !mqttIsReservedHeader(key):
+			w.WriteByte(mqttPropUserProperty)
+			w.WriteBytes(key)
+			w.WriteBytes(val)
+		}
+	})
+	if expired {
+		return nil, false
+	}
+	// A NATS request is delivered with the reply subject as response topic.
+	if !hasResponseTopic && reply != _EMPTY_ {
+		w.WriteByte(mqttPropResponseTopic)
+		w.WriteBytes(natsSubjectStrToMQTTTopic(reply))
+	}
+	if subID > 0 {
+		w.WriteByte(mqttPropSubscriptionID)
+		w.WriteVarInt(subID)
+	}
+	return mqttPropertiesWithLength(w.Bytes()), true
+}
+
+// Returns the key under which a subscription is stored in the session for
+// the given (NATS) filter and shared subscription group (can be empty).
+func mqttSessionSubKey(queue, filter string) string {
+	if queue == _EMPTY_ {
+		return filter
+	}
+	return mqttSharePrefix + queue + "/" + filter
+}
+
+// Splits a topic filter of the form "$share/<group>/<filter>" into the group
+// and the filter. Returns false if `topic` is not a shared subscription.
+func mqttParseSharedFilter(topic []byte) (group, filter []byte, shared bool, err error) {
+	if !bytes.HasPrefix(topic, []byte(mqttSharePrefix)) {
+		return nil, topic, false, nil
+	}
+	rest := topic[len(mqttSharePrefix):]
+	i := bytes.IndexByte(rest, mqttTopicLevelSep)
+	// Spec [MQTT-4.8.2-1] and [MQTT-4.8.2-2]
+	if i <= 0 || i == len(rest)-1 {
+		return nil, nil, true, fmt.Errorf("invalid shared subscription %q", topic)
+	}
+	group, filter = rest[:i], rest[i+1:]
+	if bytes.ContainsAny(group, "+#") || !isValidName(string(group)) {
+		return nil, nil, true, fmt.Errorf("invalid shared subscription group %q", group)
+	}
+	return group, filter, true, nil
+}
+
+// Recreates a subscription filter from the key and options under which it
+// was stored in the session, see mqttSessionSubKey.
+func mqttFilterFromSessionSub(key string, qos byte, so *mqttSubOpts) *mqttFilter {
+	f := &mqttFilter{filter: key, qos: qos}
+	if strings.HasPrefix(key, mqttSharePrefix) {
+		rest := key[len(mqttSharePrefix):]
+		if i := strings.IndexByte(rest, mqttTopicLevelSep); i > 0 {
+			f.queue, f.filter = rest[:i], rest[i+1:]
+		}
+	}
+	if so != nil {
+		f.subID, f.noLocal = so.ID, so.NoLocal
+	}
+	return f
+}
+
+// Reads the MQTT 5 CONNECT properties. Returns a CONNACK reason code when
+// the connection is rejected with one.
+func (c *client) mqttParseConnectProperties(r *mqttReader, cp *mqttConnectProto) (byte, error) {
+	props := &c.mqtt.props
+	if err := r.readProperties(mqttPropCtxConnect, props); err != nil {
+		return 0, err
+	}
+	// Enhanced authentication is not supported, spec [MQTT-4.12.0-1].
+	if props.has(mqttPropAuthMethod) {
+		return mqttRCBadAuthMethod, fmt.Errorf("authentication method %q not supported", props.authMethod)
+	}
+	cp.expiry = props.sessionExpiry
+	cp.recvMax = props.receiveMaximum
+	c.mqtt.maxPacket = props.maxPacketSize
+	return 0, nil
+}
+
+// Enqueues a MQTT 5 CONNACK. `rc` can be a MQTT 3.1.1 return code.
+func (c *client) mqttEnqueueConnAckV5(rc byte, sessionPresent bool) {
+	rc = mqttConnAckReasonCode(rc)
+	props := newMQTTWriter(32)
+	if rc == mqttRCSuccess {
+		props.WriteByte(mqttPropTopicAliasMaximum)
+		props.WriteUint16(mqttTopicAliasMaximum)
+		if c.mqtt.rejectQoS2Pub {
+			props.WriteByte(mqttPropMaximumQoS)
+			props.WriteByte(1)
+		}
+		// Spec [MQTT-3.2.2-16]
+		if c.mqtt.cidAssigned {
+			props.WriteByte(mqttPropAssignedClientID)
+			props.WriteString(c.mqtt.cid)
+		}
+		// Let the client know if we do not use its session expiry interval.
+		if sess, cp := c.mqtt.sess, c.mqtt.cp; sess != nil && cp != nil {
+			sess.mu.Lock()
+			expiry := sess.expiry
+			sess.mu.Unlock()
+			if expiry != cp.expiry {
+				props.WriteByte(mqttPropSessionExpiry)
+				props.WriteUint32(expiry)
+			}
+		}
+	}
+	pb := props.Bytes()
+
+	w := newMQTTWriter(8 + len(pb))
+	w.WriteByte(mqttPacketConnectAck)
+	w.WriteVarInt(2 + mqttVarIntLen(len(pb)) + len(pb))
+	// Spec [MQTT-3.2.2-6]. If the reason code is not success, then session
+	// present flag must be set to 0.
+	if rc == mqttRCSuccess && sessionPresent {
+		w.WriteByte(1)
+	} else {
+		w.WriteByte(0)
+	}
+	w.WriteByte(rc)
+	w.WriteVarInt(len(pb))
+	w.Write(pb)
+	c.mu.Lock()
+	c.enqueueProto(w.Bytes())
+	c.mu.Unlock()
+}
+
+// Reads the properties of a MQTT 5 PUBLISH packet, resolves the topic alias
+// if any, and converts the properties to NATS headers in `pp`.
+func (c *client) mqttParsePublishProperties(r *mqttReader, pp *mqttPublish) error {
+	props := &c.mqtt.props
+	if err := r.readProperties(mqttPropCtxPublish, props); err != nil {
+		return err
+	}
+	if props.has(mqttPropTopicAlias) {
+		alias := props.topicAlias
+		// Spec [MQTT-3.3.2-8] and [MQTT-3.3.2-9]
+		if alias == 0 || alias > mqttTopicAliasMaximum {
+			return &mqttReasonCodeError{rc: mqttRCTopicAliasInvalid, err: errMQTTTopicAliasInvalid}
+		}
+		if len(pp.topic) > 0 {
+			if c.mqtt.aliases == nil {
+				c.mqtt.aliases = make(map[uint16][]byte)
+			}
+			c.mqtt.aliases[alias] = copyBytes(pp.topic)
+		} else if topic, ok := c.mqtt.aliases[alias]; ok {
+			pp.topic = topic
+		} else {
+			return &mqttReasonCodeError{rc: mqttRCProtocolError, err: errMQTTTopicAliasUnknown}
+		}
+	}
+	var origin string
+	if sess := c.mqtt.sess; sess != nil {
+		origin = sess.idHash
+	}
+	var err error
+	pp.hdr, pp.reply, pp.ttl, err = mqttPublishPropertiesToNATS(props, origin)
+	return err
+}
+
+// Parses a PUBACK, PUBREC, PUBREL or PUBCOMP packet. For MQTT 5, those may
+// include a reason code and properties, which are ignored.
+func (c *client) mqttParseAckPacket(r *mqttReader, pl int) (uint16, byte, error) {
+	start := r.pos
+	pi, err := mqttParsePIPacket(r)
+	if err != nil || pl <= 2 {
+		return pi, mqttRCSuccess, err
+	}
+	rc, err := r.readByte("reason code")
+	if err != nil {
+		return pi, rc, err
+	}
+	if pl > 3 {
+		if err := r.readProperties(mqttPropCtxAck, &c.mqtt.props); err != nil {
+			return pi, rc, err
+		}
+	}
+	if r.pos != start+pl {
+		return pi, rc, fmt.Errorf("invalid remaining length %d for acknowledgment packet", pl)
+	}
+	return pi, rc, nil
+}
+
+func mqttAckTrace(pi uint16, rc byte) string {
+	if rc == mqttRCSuccess {
+		return fmt.Sprintf("pi=%v", pi)
+	}
+	return fmt.Sprintf("pi=%v rc=0x%02x", pi, rc)
+}
+
+// Parses a MQTT 5 DISCONNECT packet and applies the session expiry interval
+// that it may contain. Returns the reason code.
+func (c *client) mqttParseDisconnect(r *mqttReader, pl int) (byte, error) {
+	if pl == 0 {
+		return mqttRCSuccess, nil
+	}
+	start := r.pos
+	rc, err := r.readByte("reason code")
+	if err != nil {
+		return rc, err
+	}
+	if pl > 1 {
+		props := &c.mqtt.props
+		if err := r.readProperties(mqttPropCtxDisconnect, props); err != nil {
+			return rc, err
+		}
+		if props.has(mqttPropSessionExpiry) {
+			// Spec [MQTT-3.14.2-2]
+			if c.mqtt.cp.expiry == 0 && props.sessionExpiry != 0 {
+				return rc, &mqttReasonCodeError{rc: mqttRCProtocolError, err: errMQTTSessionExpiryFromZero}
+			}
+			expiry := props.sessionExpiry
+			if expiry > 0 && !c.mqtt.asm.msgTTL {
+				expiry = mqttSessionExpiryNever
+			}
+			sess := c.mqtt.sess
+			sess.mu.Lock()
+			sess.expiry, sess.clean = expiry, expiry == 0
+			sess.mu.Unlock()
+		}
+	}
+	if r.pos != start+pl {
+		return rc, fmt.Errorf("invalid remaining length %d for DISCONNECT packet", pl)
+	}
+	return rc, nil
+}
+
+// Enqueues a DISCONNECT packet with the given reason code, if the client
+// uses MQTT 5. The caller is responsible for closing the connection.
+func (c *client) mqttEnqueueDisconnect(rc byte) {
+	if !c.mqtt.v5 {
+		return
+	}
+	c.mu.Lock()
+	c.enqueueProto([]byte{mqttPacketDisconnect, 1, rc})
+	c.mu.Unlock()
+}
+
+// Returns the reason code of the DISCONNECT sent to a MQTT 5 client when
+// the connection is closed due to `err`.
+func mqttReasonCodeForError(err error) byte {
+	var rce *mqttReasonCodeError
+	switch {
+	case errors.As(err, &rce):
+		return rce.rc
+	case errors.Is(err, ErrMaxPayload):
+		return mqttRCPacketTooLarge
+	case errors.Is(err, errMQTTPublishNotAuthorized):
+		return mqttRCNotAuthorized
+	}
+	return mqttRCUnspecifiedError
+}
+
+// Returns the PUBACK or PUBREC reason code for a failure to process a
+// PUBLISH from a MQTT 5 client.
+func mqttPubReasonCode(err error) byte {
+	if errors.Is(err, errMQTTPublishNotAuthorized) {
+		return mqttRCNotAuthorized
+	}
+	return mqttRCUnspecifiedError
+}
+
+// Sets the MQTT 5 subscription options from the SUBSCRIBE options byte.
+func (f *mqttFilter) setSubscriptionOptions(opts byte) error {
+	// Spec [MQTT-3.8.3-5]
+	if opts&mqttSubOptReserved != 0 {
+		return &mqttReasonCodeError{rc: mqttRCMalformedPacket,
+			err: fmt.Errorf("subscription options reserved bits must be 0, got %x", opts)}
+	}
+	f.qos = opts & mqttSubOptQoS
+	f.noLocal = opts&mqttSubOptNoLocal != 0
+	// Spec [MQTT-3.8.3-4]
+	if f.noLocal && f.queue != _EMPTY_ {
+		return &mqttReasonCodeError{rc: mqttRCProtocolError,
+			err: errors.New("no local option cannot be set on a shared subscription")}
+	}
+	// The retain as published option is not supported: messages forwarded
+	// to a subscription never have the RETAIN flag set.
+	f.rh = (opts & mqttSubOptRetainHandling) >> 4
+	if f.rh > mqttRetainHandlingDoNotSend {
+		return &mqttReasonCodeError{rc: mqttRCProtocolError,
+			err: fmt.Errorf("invalid retain handling %v", f.rh)}
+	}
+	return nil
+}
+
+// Returns the options of the subscription that need to be persisted with
+// the session, or nil if there are none.
+func (f *mqttFilter) subOpts() *mqttSubOpts {
+	if f.subID == 0 && !f.noLocal {
+		return nil
+	}
+	return &mqttSubOpts{ID: f.subID, NoLocal: f.noLocal}
+}
+
+func (so *mqttSubOpts) equal(o *mqttSubOpts) bool {
+	if so == nil || o == nil {
+		return so == o
+	}
+	return *so == *o
+}
+
+// Returns true if retained messages should be sent for the subscription
+// being created for filter `f`.
+//
+// Runs from the client's readLoop.
+// Lock not held on entry, but session is in the locked map.
+func (sess *mqttSession) sendRetainedOnSubscribe(f *mqttFilter) bool {
+	// Retained messages are not sent for shared subscriptions, spec
+	// section 4.8.2.
+	if f.queue != _EMPTY_ {
+		return false
+	}
+	switch f.rh {
+	case mqttRetainHandlingDoNotSend:
+		return false
+	case mqttRetainHandlingSendIfNew:
+		_, exists := sess.subs[f.filter]
+		return !exists
+	}
+	return true
+}
+
+// Returns the inactive threshold for the JS consumers of a MQTT 5 session
+// with a finite expiry interval, 0 otherwise.
+//
+// Lock not held on entry.
+func (sess *mqttSession) consumerInactiveThreshold() time.Duration {
+	sess.mu.Lock()
+	expiry := sess.expiry
+	sess.mu.Unlock()
+	if expiry == 0 || expiry == mqttSessionExpiryNever {
+		return 0
+	}
+	return time.Duration(expiry)*time.Second + mqttSessionExpiryGrace
+}
+
+// Returns true if this MQTT 5 session has expired since its client
+// disconnected.
+//
+// Lock not held on entry.
+func (sess *mqttSession) expired() bool {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	if sess.expiry == 0 || sess.expiry == mqttSessionExpiryNever || sess.disconnected.IsZero() {
+		return false
+	}
+	return time.Since(sess.disconnected) > time.Duration(sess.expiry)*time.Second
+}
+
+// Returns true if the message with the given header was published by a MQTT 5
+// client of the session with the given client ID hash.
+func mqttIsFromSession(hdr []byte, idHash string) bool {
+	origin := getHeader(mqttNatsHeaderOrigin, hdr)
+	return len(origin) > 0 && bytesToString(origin) == idHash
+}
+
+// Returns true if the PUBLISH packet would exceed the maximum packet size set
+// by the MQTT 5 client, in which case it must not be sent, spec
+// [MQTT-3.1.2-24].
+func (c *client) mqttExceedsMaxPacket(qos byte, topic, props, msg []byte) bool {
+	if c.mqtt.maxPacket == 0 {
+		return false
+	}
+	rl := 2 + len(topic) + len(props) + len(msg)
+	if qos > 0 {
+		rl += 2
+	}
+	return int64(1+mqttVarIntLen(rl)+rl) > int64(c.mqtt.maxPacket)
+}
+
+// Adds the JetStream message TTL header to the given NATS message, returning
+// the new message and header length.
+func mqttAddTTLHeader(natsMsg []byte, headerLen int, ttl int64) ([]byte, int) {
+	line := JSMessageTTL + ":" + strconv.FormatInt(ttl, 10) + _CRLF_
+	buf := make([]byte, 0, len(natsMsg)+len(line))
+	buf = append(buf, natsMsg[:len(hdrLine)]...)
+	buf = append(buf, line...)
+	buf = append(buf, natsMsg[len(hdrLine):]...)
+	return buf, headerLen + len(line)
+}
+
+// Restores the MQTT 5 fields of `pp` from the header of a stored QoS2
+// message. Returns false if the message has expired.
+func mqttRestorePublishHeaders(pp *mqttPublish, hdr []byte) bool {
+	var bb bytes.Buffer
+	ok := true
+	mqttForEachHeader(hdr, func(key, val []byte) {
+		switch bytesToString(key) {
+		case mqttNatsHeader, mqttNatsHeaderSubject, mqttNatsHeaderMapped:
+			return
+		case mqttNatsHeaderExpires:
+			// The expiration is set again when the message is released.
+			expires, err := strconv.ParseInt(bytesToString(val), 10, 64)
+			if err != nil {
+				return
+			}
+			if remaining := expires - time.Now().Unix(); remaining > 0 {
+				pp.ttl = remaining
+			} else {
+				ok = false
+			}
+			return
+		case mqttNatsHeaderReply:
+			pp.reply = val
+		}
+		bb.Write(key)
+		bb.WriteByte(':')
+		bb.Write(val)
+		bb.WriteString(_CRLF_)
+	})
+	pp.hdr = bb.Bytes()
+	return ok
+}
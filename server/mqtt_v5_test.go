@@ -0,0 +1,701 @@
+// Copyright 2026 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !skip_mqtt_tests
+
+package server
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// Properties received from the server, keyed by identifier. User properties
+// are collected separately since they can be repeated.
+type testMQTTV5Props struct {
+	vals map[byte]any
+	user [][2]string
+}
+
+func testMQTTV5ReadProps(t testing.TB, r *mqttReader) *testMQTTV5Props {
+	t.Helper()
+	l, _, err := r.readVarInt()
+	if err != nil {
+		t.Fatalf("Error reading properties length: %v", err)
+	}
+	props := &testMQTTV5Props{vals: make(map[byte]any)}
+	for end := r.pos + l; r.pos < end; {
+		id, err := r.readByte("property identifier")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var v any
+		switch id {
+		case mqttPropPayloadFormat, mqttPropMaximumQoS, mqttPropRetainAvailable,
+			mqttPropWildcardSubAvailable, mqttPropSubIDAvailable, mqttPropSharedSubAvailable:
+			v, err = r.readByte("byte property")
+		case mqttPropReceiveMaximum, mqttPropTopicAliasMaximum, mqttPropTopicAlias:
+			v, err = r.readUint16("two bytes property")
+		case mqttPropMessageExpiry, mqttPropSessionExpiry, mqttPropMaximumPacketSize:
+			v, err = r.readUint32("four bytes property")
+		case mqttPropSubscriptionID:
+			v, _, err = r.readVarInt()
+		case mqttPropUserProperty:
+			var k, uv string
+			if k, err = r.readString("user property name"); err == nil {
+				uv, err = r.readString("user property value")
+			}
+			props.user = append(props.user, [2]string{k, uv})
+			continue
+		default:
+			v, err = r.readString("string property")
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		props.vals[id] = v
+	}
+	return props
+}
+
+func testMQTTV5Connect(t testing.TB, ci *mqttConnInfo, props []byte, host string, port int) (net.Conn, *mqttReader) {
+	t.Helper()
+	c, err := net.Dial("tcp", net.JoinHostPort(host, fmt.Sprintf("%d", port)))
+	if err != nil {
+		t.Fatalf("Error creating mqtt connection: %v", err)
+	}
+	flags := byte(0)
+	if ci.cleanSess {
+		flags |= mqttConnFlagCleanSession
+	}
+	if ci.user != _EMPTY_ {
+		flags |= mqttConnFlagUsernameFlag
+	}
+	if ci.pass != _EMPTY_ {
+		flags |= mqttConnFlagPasswordFlag
+	}
+	vh := newMQTTWriter(0)
+	vh.WriteString(string(mqttProtoName))
+	vh.WriteByte(mqttProtoLevel5)
+	vh.WriteByte(flags)
+	vh.WriteUint16(ci.keepAlive)
+	vh.Write(mqttPropertiesWithLength(props))
+	vh.WriteString(ci.clientID)
+	if ci.user != _EMPTY_ {
+		vh.WriteString(ci.user)
+	}
+	if ci.pass != _EMPTY_ {
+		vh.WriteString(ci.pass)
+	}
+	w := newMQTTWriter(0)
+	w.WriteByte(mqttPacketConnect)
+	w.WriteVarInt(vh.Len())
+	w.Write(vh.Bytes())
+	if _, err := testMQTTWrite(c, w.Bytes()); err != nil {
+		t.Fatalf("Error writing connect: %v", err)
+	}
+	return c, &mqttReader{reader: c}
+}
+
+func testMQTTV5CheckConnAck(t testing.TB, r *mqttReader, rc byte, sessionPresent bool) *testMQTTV5Props {
+	t.Helper()
+	b, _ := testMQTTReadPacket(t, r)
+	if pt := b & mqttPacketMask; pt != mqttPacketConnectAck {
+		t.Fatalf("Expected ConnAck (%x), got %x", mqttPacketConnectAck, pt)
+	}
+	caf, err := r.readByte("connack flags")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sp := caf == 1; sp != sessionPresent {
+		t.Fatalf("Expected session present flag=%v got %v", sessionPresent, sp)
+	}
+	carc, err := r.readByte("connack reason code")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if carc != rc {
+		t.Fatalf("Expected reason code to be 0x%02x, got 0x%02x", rc, carc)
+	}
+	return testMQTTV5ReadProps(t, r)
+}
+
+// Sends a SUBSCRIBE with the given subscription options for each topic
+// filter and returns the reason codes of the SUBACK.
+func testMQTTV5Sub(t testing.TB, pi uint16, c net.Conn, r *mqttReader, props []byte, filters []string, opts []byte) []byte {
+	t.Helper()
+	vh := newMQTTWriter(0)
+	vh.WriteUint16(pi)
+	vh.Write(mqttPropertiesWithLength(props))
+	for i, f := range filters {
+		vh.WriteString(f)
+		vh.WriteByte(opts[i])
+	}
+	w := newMQTTWriter(0)
+	w.WriteByte(mqttPacketSub | mqttSubscribeFlags)
+	w.WriteVarInt(vh.Len())
+	w.Write(vh.Bytes())
+	if _, err := testMQTTWrite(c, w.Bytes()); err != nil {
+		t.Fatalf("Error writing SUBSCRIBE protocol: %v", err)
+	}
+	b, pl := testMQTTReadPacket(t, r)
+	if pt := b & mqttPacketMask; pt != mqttPacketSubAck {
+		t.Fatalf("Expected SUBACK packet %x, got %x", mqttPacketSubAck, pt)
+	}
+	start := r.pos
+	if rpi, err := r.readUint16("packet identifier"); err != nil || rpi != pi {
+		t.Fatalf("Error with packet identifier expected=%v got: %v err=%v", pi, rpi, err)
+	}
+	testMQTTV5ReadProps(t, r)
+	rcs := copyBytes(r.buf[r.pos : start+pl])
+	r.pos = start + pl
+	return rcs
+}
+
+func testMQTTV5Unsub(t testing.TB, pi uint16, c net.Conn, r *mqttReader, filters []string) []byte {
+	t.Helper()
+	vh := newMQTTWriter(0)
+	vh.WriteUint16(pi)
+	vh.WriteByte(0)
+	for _, f := range filters {
+		vh.WriteString(f)
+	}
+	w := newMQTTWriter(0)
+	w.WriteByte(mqttPacketUnsub | mqttUnsubscribeFlags)
+	w.WriteVarInt(vh.Len())
+	w.Write(vh.Bytes())
+	if _, err := testMQTTWrite(c, w.Bytes()); err != nil {
+		t.Fatalf("Error writing UNSUBSCRIBE protocol: %v", err)
+	}
+	b, pl := testMQTTReadPacket(t, r)
+	if pt := b & mqttPacketMask; pt != mqttPacketUnsubAck {
+		t.Fatalf("Expected UNSUBACK packet %x, got %x", mqttPacketUnsubAck, pt)
+	}
+	start := r.pos
+	if rpi, err := r.readUint16("packet identifier"); err != nil || rpi != pi {
+		t.Fatalf("Error with packet identifier expected=%v got: %v err=%v", pi, rpi, err)
+	}
+	testMQTTV5ReadProps(t, r)
+	rcs := copyBytes(r.buf[r.pos : start+pl])
+	r.pos = start + pl
+	return rcs
+}
+
+func testMQTTV5SendPublish(t testing.TB, c net.Conn, qos byte, topic string, pi uint16, props, payload []byte) {
+	t.Helper()
+	vh := newMQTTWriter(0)
+	vh.WriteString(topic)
+	if qos > 0 {
+		vh.WriteUint16(pi)
+	}
+	vh.Write(mqttPropertiesWithLength(props))
+	vh.Write(payload)
+	w := newMQTTWriter(0)
+	w.WriteByte(mqttPacketPub | qos<<1)
+	w.WriteVarInt(vh.Len())
+	w.Write(vh.Bytes())
+	if _, err := testMQTTWrite(c, w.Bytes()); err != nil {
+		t.Fatalf("Error writing PUBLISH protocol: %v", err)
+	}
+}
+
+func testMQTTV5ReadPub(t testing.TB, r *mqttReader) (flags byte, pi uint16, topic string, props *testMQTTV5Props, payload []byte) {
+	t.Helper()
+	b, pl := testMQTTReadPacket(t, r)
+	if pt := b & mqttPacketMask; pt != mqttPacketPub {
+		t.Fatalf("Expected PUBLISH packet %x, got %x", mqttPacketPub, pt)
+	}
+	flags = b & mqttPacketFlagMask
+	start := r.pos
+	topic, err := r.readString("topic name")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mqttGetQoS(flags) > 0 {
+		if pi, err = r.readUint16("packet identifier"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	props = testMQTTV5ReadProps(t, r)
+	payload = copyBytes(r.buf[r.pos : start+pl])
+	r.pos = start + pl
+	return flags, pi, topic, props, payload
+}
+
+func testMQTTV5ReadAck(t testing.TB, r *mqttReader, packetType byte, pi uint16) byte {
+	t.Helper()
+	b, pl := testMQTTReadPacket(t, r)
+	if pt := b & mqttPacketMask; pt != packetType {
+		t.Fatalf("Expected packet %x, got %x", packetType, pt)
+	}
+	start := r.pos
+	if rpi, err := r.readUint16("packet identifier"); err != nil || rpi != pi {
+		t.Fatalf("Error with packet identifier expected=%v got: %v err=%v", pi, rpi, err)
+	}
+	rc := mqttRCSuccess
+	if pl > 2 {
+		rc = r.buf[r.pos]
+	}
+	r.pos = start + pl
+	return rc
+}
+
+func testMQTTV5ReadDisconnect(t testing.TB, r *mqttReader) byte {
+	t.Helper()
+	b, pl := testMQTTReadPacket(t, r)
+	if pt := b & mqttPacketMask; pt != mqttPacketDisconnect {
+		t.Fatalf("Expected DISCONNECT packet %x, got %x", mqttPacketDisconnect, pt)
+	}
+	if pl == 0 {
+		return mqttRCSuccess
+	}
+	rc := r.buf[r.pos]
+	r.pos += pl
+	return rc
+}
+
+func TestMQTTV5ReadProperties(t *testing.T) {
+	w := newMQTTWriter(0)
+	w.WriteByte(mqttPropPayloadFormat)
+	w.WriteByte(1)
+	w.WriteByte(mqttPropMessageExpiry)
+	w.WriteUint32(30)
+	w.WriteByte(mqttPropContentType)
+	w.WriteString("text/plain")
+	w.WriteByte(mqttPropUserProperty)
+	w.WriteString("k1")
+	w.WriteString("v1")
+	w.WriteByte(mqttPropUserProperty)
+	w.WriteString("k2")
+	w.WriteString("v2")
+	w.WriteByte(mqttPropTopicAlias)
+	w.WriteUint16(3)
+
+	r := &mqttReader{}
+	r.reset(mqttPropertiesWithLength(w.Bytes()))
+	var props mqttProperties
+	require_NoError(t, r.readProperties(mqttPropCtxPublish, &props))
+	require_False(t, r.hasMore())
+	require_True(t, props.has(mqttPropPayloadFormat))
+	require_Equal(t, props.payloadFormat, 1)
+	require_Equal(t, props.messageExpiry, 30)
+	require_Equal(t, string(props.contentType), "text/plain")
+	require_Equal(t, props.topicAlias, 3)
+	require_Len(t, len(props.userProps), 2)
+	require_Equal(t, string(props.userProps[1].key), "k2")
+	require_Equal(t, string(props.userProps[1].value), "v2")
+	require_False(t, props.has(mqttPropSessionExpiry))
+
+	for _, test := range []struct {
+		name  string
+		ctx   uint8
+		props []byte
+	}{
+		{"not allowed in packet", mqttPropCtxPublish, []byte{mqttPropSessionExpiry, 0, 0, 0, 1}},
+		{"server only", mqttPropCtxConnect, []byte{mqttPropAssignedClientID, 0, 1, 'a'}},
+		{"duplicate", mqttPropCtxPublish, []byte{mqttPropPayloadFormat, 0, mqttPropPayloadFormat, 1}},
+		{"invalid payload format", mqttPropCtxPublish, []byte{mqttPropPayloadFormat, 2}},
+		{"zero subscription id", mqttPropCtxSubscribe, []byte{mqttPropSubscriptionID, 0}},
+		{"truncated", mqttPropCtxPublish, []byte{mqttPropMessageExpiry, 0, 0}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			r := &mqttReader{}
+			r.reset(mqttPropertiesWithLength(test.props))
+			err := r.readProperties(test.ctx, &props)
+			var rce *mqttReasonCodeError
+			if !errors.As(err, &rce) || rce.rc != mqttRCMalformedPacket {
+				t.Fatalf("Expected malformed packet error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestMQTTV5PublishPropertiesConversion(t *testing.T) {
+	props := &mqttProperties{
+		set:             1<<mqttPropPayloadFormat | 1<<mqttPropResponseTopic | 1<<mqttPropCorrelationData,
+		payloadFormat:   1,
+		responseTopic:   []byte("reply/to"),
+		correlationData: []byte{0, 1, 2},
+		userProps: []mqttUserProperty{
+			{key: []byte("a"), value: []byte("b")},
+			{key: []byte("Nats-Msg-Id"), value: []byte("reserved")},
+			{key: []byte("bad key"), value: []byte("dropped")},
+		},
+	}
+	hdr, reply, ttl, err := mqttPublishPropertiesToNATS(props, "origin")
+	require_NoError(t, err)
+	require_Equal(t, string(reply), "reply.to")
+	require_Equal(t, ttl, 0)
+
+	nhdr := append([]byte(hdrLine), hdr...)
+	nhdr = append(nhdr, _CRLF_...)
+	require_Equal(t, string(getHeader("a", nhdr)), "b")
+	require_True(t, getHeader("Nats-Msg-Id", nhdr) == nil)
+	require_True(t, mqttIsFromSession(nhdr, "origin"))
+	require_False(t, mqttIsFromSession(nhdr, "other"))
+
+	pb, ok := mqttNATSToPublishProperties(nhdr, _EMPTY_, 5)
+	require_True(t, ok)
+	r := &mqttReader{}
+	r.reset(pb)
+	back := testMQTTV5ReadProps(t, r)
+	require_Equal(t, back.vals[mqttPropPayloadFormat].(byte), 1)
+	require_Equal(t, back.vals[mqttPropResponseTopic].(string), "reply/to")
+	require_Equal(t, back.vals[mqttPropCorrelationData].(string), "\x00\x01\x02")
+	require_Equal(t, back.vals[mqttPropSubscriptionID].(int), 5)
+	require_Len(t, len(back.user), 1)
+	require_Equal(t, back.user[0], [2]string{"a", "b"})
+
+	// An expired message is not delivered.
+	expired := fmt.Appendf([]byte(hdrLine), "%s:%d\r\n\r\n", mqttNatsHeaderExpires, time.Now().Unix()-1)
+	_, ok = mqttNATSToPublishProperties(expired, _EMPTY_, 0)
+	require_False(t, ok)
+}
+
+func TestMQTTV5ConnAck(t *testing.T) {
+	o := testMQTTDefaultOptions()
+	s := testMQTTRunServer(t, o)
+	defer testMQTTShutdownServer(s)
+
+	// With MQTT 5, an empty client ID is assigned by the server even when
+	// the session is not clean.
+	mc, r := testMQTTV5Connect(t, &mqttConnInfo{}, nil, o.MQTT.Host, o.MQTT.Port)
+	defer mc.Close()
+	props := testMQTTV5CheckConnAck(t, r, mqttRCSuccess, false)
+	cid, ok := props.vals[mqttPropAssignedClientID].(string)
+	if !ok || cid == _EMPTY_ {
+		t.Fatalf("Expected an assigned client ID, got %+v", props.vals)
+	}
+	require_Equal(t, props.vals[mqttPropTopicAliasMaximum].(uint16), mqttTopicAliasMaximum)
+	testMQTTFlush(t, mc, nil, r)
+
+	// Enhanced authentication is not supported.
+	w := newMQTTWriter(0)
+	w.WriteByte(mqttPropAuthMethod)
+	w.WriteString("SCRAM-SHA-1")
+	mc2, r2 := testMQTTV5Connect(t, &mqttConnInfo{clientID: "auth", cleanSess: true}, w.Bytes(), o.MQTT.Host, o.MQTT.Port)
+	defer mc2.Close()
+	testMQTTV5CheckConnAck(t, r2, mqttRCBadAuthMethod, false)
+	testMQTTExpectDisconnect(t, mc2)
+}
+
+func TestMQTTV5UserPropertiesAndNATSHeaders(t *testing.T) {
+	o := testMQTTDefaultOptions()
+	s := testMQTTRunServer(t, o)
+	defer testMQTTShutdownServer(s)
+
+	nc := natsConnect(t, s.ClientURL())
+	defer nc.Close()
+	natsSub := natsSubSync(t, nc, "foo.bar")
+	natsFlush(t, nc)
+
+	mc, r := testMQTTV5Connect(t, &mqttConnInfo{clientID: "sub", cleanSess: true}, nil, o.MQTT.Host, o.MQTT.Port)
+	defer mc.Close()
+	testMQTTV5CheckConnAck(t, r, mqttRCSuccess, false)
+	rcs := testMQTTV5Sub(t, 1, mc, r, nil, []string{"foo/bar"}, []byte{0})
+	require_True(t, bytes.Equal(rcs, []byte{0}))
+	testMQTTFlush(t, mc, nil, r)
+
+	mp, rp := testMQTTV5Connect(t, &mqttConnInfo{clientID: "pub", cleanSess: true}, nil, o.MQTT.Host, o.MQTT.Port)
+	defer mp.Close()
+	testMQTTV5CheckConnAck(t, rp, mqttRCSuccess, false)
+
+	w := newMQTTWriter(0)
+	w.WriteByte(mqttPropUserProperty)
+	w.WriteString("Color")
+	w.WriteString("blue")
+	w.WriteByte(mqttPropContentType)
+	w.WriteString("text/plain")
+	testMQTTV5SendPublish(t, mp, 0, "foo/bar", 0, w.Bytes(), []byte("msg1"))
+
+	// The NATS subscriber gets the user property as a header.
+	msg := natsNexMsg(t, natsSub, time.Second)
+	require_Equal(t, string(msg.Data), "msg1")
+	require_Equal(t, msg.Header.Get("Color"), "blue")
+	require_Equal(t, msg.Header.Get(mqttNatsHeaderContentType), "text/plain")
+
+	// And so does the MQTT 5 subscriber.
+	_, _, topic, props, payload := testMQTTV5ReadPub(t, r)
+	require_Equal(t, topic, "foo/bar")
+	require_Equal(t, string(payload), "msg1")
+	require_Equal(t, props.vals[mqttPropContentType].(string), "text/plain")
+	require_Len(t, len(props.user), 1)
+	require_Equal(t, props.user[0], [2]string{"Color", "blue"})
+
+	// A NATS request is delivered with the reply subject as response topic,
+	// and the headers as user properties.
+	nmsg := nats.NewMsg("foo.bar")
+	nmsg.Reply = "my.inbox"
+	nmsg.Header.Set("Trace", "1")
+	nmsg.Data = []byte("msg2")
+	require_NoError(t, nc.PublishMsg(nmsg))
+	_, _, _, props, payload = testMQTTV5ReadPub(t, r)
+	require_Equal(t, string(payload), "msg2")
+	require_Equal(t, props.vals[mqttPropResponseTopic].(string), "my/inbox")
+	require_Len(t, len(props.user), 1)
+	require_Equal(t, props.user[0], [2]string{"Trace", "1"})
+}
+
+func TestMQTTV5TopicAlias(t *testing.T) {
+	o := testMQTTDefaultOptions()
+	s := testMQTTRunServer(t, o)
+	defer testMQTTShutdownServer(s)
+
+	mc, r := testMQTTV5Connect(t, &mqttConnInfo{clientID: "sub", cleanSess: true}, nil, o.MQTT.Host, o.MQTT.Port)
+	defer mc.Close()
+	testMQTTV5CheckConnAck(t, r, mqttRCSuccess, false)
+	testMQTTV5Sub(t, 1, mc, r, nil, []string{"foo"}, []byte{0})
+	testMQTTFlush(t, mc, nil, r)
+
+	mp, rp := testMQTTV5Connect(t, &mqttConnInfo{clientID: "pub", cleanSess: true}, nil, o.MQTT.Host, o.MQTT.Port)
+	defer mp.Close()
+	testMQTTV5CheckConnAck(t, rp, mqttRCSuccess, false)
+
+	alias := func(a uint16) []byte {
+		return []byte{mqttPropTopicAlias, byte(a >> 8), byte(a)}
+	}
+	// Set the alias, then use it with an empty topic.
+	testMQTTV5SendPublish(t, mp, 0, "foo", 0, alias(1), []byte("msg1"))
+	testMQTTV5SendPublish(t, mp, 0, _EMPTY_, 0, alias(1), []byte("msg2"))
+	for _, expected := range []string{"msg1", "msg2"} {
+		_, _, topic, _, payload := testMQTTV5ReadPub(t, r)
+		require_Equal(t, topic, "foo")
+		require_Equal(t, string(payload), expected)
+	}
+
+	// An alias that was not set is a protocol error.
+	testMQTTV5SendPublish(t, mp, 0, _EMPTY_, 0, alias(2), []byte("msg3"))
+	require_Equal(t, testMQTTV5ReadDisconnect(t, rp), mqttRCProtocolError)
+	testMQTTExpectDisconnect(t, mp)
+
+	// An alias above the maximum is invalid.
+	mp, rp = testMQTTV5Connect(t, &mqttConnInfo{clientID: "pub", cleanSess: true}, nil, o.MQTT.Host, o.MQTT.Port)
+	defer mp.Close()
+	testMQTTV5CheckConnAck(t, rp, mqttRCSuccess, false)
+	testMQTTV5SendPublish(t, mp, 0, "foo", 0, alias(mqttTopicAliasMaximum+1), []byte("msg4"))
+	require_Equal(t, testMQTTV5ReadDisconnect(t, rp), mqttRCTopicAliasInvalid)
+	testMQTTExpectDisconnect(t, mp)
+	testMQTTExpectNothing(t, r)
+}
+
+func TestMQTTV5SharedSubscriptions(t *testing.T) {
+	o := testMQTTDefaultOptions()
+	s := testMQTTRunServer(t, o)
+	defer testMQTTShutdownServer(s)
+
+	for _, qos := range []byte{0, 1} {
+		t.Run(fmt.Sprintf("qos %v", qos), func(t *testing.T) {
+			var conns []net.Conn
+			var readers []*mqttReader
+			for i := 0; i < 2; i++ {
+				cid := fmt.Sprintf("sub%d_%d", qos, i)
+				mc, r := testMQTTV5Connect(t, &mqttConnInfo{clientID: cid, cleanSess: true}, nil, o.MQTT.Host, o.MQTT.Port)
+				defer mc.Close()
+				testMQTTV5CheckConnAck(t, r, mqttRCSuccess, false)
+				rcs := testMQTTV5Sub(t, 1, mc, r, nil, []string{"$share/grp/foo/+"}, []byte{qos})
+				require_True(t, bytes.Equal(rcs, []byte{qos}))
+				testMQTTFlush(t, mc, nil, r)
+				conns = append(conns, mc)
+				readers = append(readers, r)
+			}
+
+			mp, rp := testMQTTV5Connect(t, &mqttConnInfo{clientID: "pub", cleanSess: true}, nil, o.MQTT.Host, o.MQTT.Port)
+			defer mp.Close()
+			testMQTTV5CheckConnAck(t, rp, mqttRCSuccess, false)
+			const total = 20
+			for i := 0; i < total; i++ {
+				testMQTTV5SendPublish(t, mp, qos, "foo/bar", uint16(i+1), nil, []byte("msg"))
+				if qos > 0 {
+					testMQTTV5ReadAck(t, rp, mqttPacketPubAck, uint16(i+1))
+				}
+			}
+
+			// Each message is delivered to a single member of the group.
+			received := 0
+			for i, r := range readers {
+				for {
+					r.reader.SetReadDeadline(time.Now().Add(250 * time.Millisecond))
+					if !r.hasMore() {
+						var buf [512]byte
+						n, err := r.reader.Read(buf[:])
+						if err != nil {
+							break
+						}
+						r.reset(copyBytes(buf[:n]))
+					}
+					r.reader.SetReadDeadline(time.Time{})
+					_, pi, topic, _, _ := testMQTTV5ReadPub(t, r)
+					require_Equal(t, topic, "foo/bar")
+					if qos > 0 {
+						testMQTTSendPIPacket(mqttPacketPubAck, t, conns[i], pi)
+					}
+					received++
+				}
+				r.reader.SetReadDeadline(time.Time{})
+			}
+			require_Equal(t, received, total)
+		})
+	}
+
+	// Shared subscriptions are not available with MQTT 3.1.1.
+	mc, r := testMQTTConnect(t, &mqttConnInfo{clientID: "v3", cleanSess: true}, o.MQTT.Host, o.MQTT.Port)
+	defer mc.Close()
+	testMQTTCheckConnAck(t, r, mqttConnAckRCConnectionAccepted, false)
+	testMQTTSub(t, 1, mc, r, []*mqttFilter{{filter: "$share/grp/foo", qos: 0}}, []byte{0})
+}
+
+func TestMQTTV5NoLocal(t *testing.T) {
+	o := testMQTTDefaultOptions()
+	s := testMQTTRunServer(t, o)
+	defer testMQTTShutdownServer(s)
+
+	mc, r := testMQTTV5Connect(t, &mqttConnInfo{clientID: "nolocal", cleanSess: true}, nil, o.MQTT.Host, o.MQTT.Port)
+	defer mc.Close()
+	testMQTTV5CheckConnAck(t, r, mqttRCSuccess, false)
+	testMQTTV5Sub(t, 1, mc, r, nil, []string{"foo", "bar"}, []byte{mqttSubOptNoLocal, 1 | mqttSubOptNoLocal})
+	testMQTTFlush(t, mc, nil, r)
+
+	testMQTTV5SendPublish(t, mc, 0, "foo", 0, nil, []byte("msg"))
+	testMQTTV5SendPublish(t, mc, 1, "bar", 1, nil, []byte("msg"))
+	testMQTTV5ReadAck(t, r, mqttPacketPubAck, 1)
+	testMQTTFlush(t, mc, nil, r)
+	testMQTTExpectNothing(t, r)
+
+	// Messages from other clients are still delivered.
+	mp, rp := testMQTTV5Connect(t, &mqttConnInfo{clientID: "pub", cleanSess: true}, nil, o.MQTT.Host, o.MQTT.Port)
+	defer mp.Close()
+	testMQTTV5CheckConnAck(t, rp, mqttRCSuccess, false)
+	testMQTTV5SendPublish(t, mp, 0, "foo", 0, nil, []byte("other"))
+	_, _, topic, _, payload := testMQTTV5ReadPub(t, r)
+	require_Equal(t, topic, "foo")
+	require_Equal(t, string(payload), "other")
+}
+
+func TestMQTTV5UnsubscribeReasonCodes(t *testing.T) {
+	o := testMQTTDefaultOptions()
+	s := testMQTTRunServer(t, o)
+	defer testMQTTShutdownServer(s)
+
+	mc, r := testMQTTV5Connect(t, &mqttConnInfo{clientID: "unsub", cleanSess: true}, nil, o.MQTT.Host, o.MQTT.Port)
+	defer mc.Close()
+	testMQTTV5CheckConnAck(t, r, mqttRCSuccess, false)
+	testMQTTV5Sub(t, 1, mc, r, nil, []string{"foo", "$share/grp/bar"}, []byte{1, 0})
+	rcs := testMQTTV5Unsub(t, 2, mc, r, []string{"foo", "baz", "$share/grp/bar"})
+	require_True(t, bytes.Equal(rcs, []byte{mqttRCSuccess, mqttRCNoSubscriptionExisted, mqttRCSuccess}))
+	rcs = testMQTTV5Unsub(t, 3, mc, r, []string{"foo"})
+	require_True(t, bytes.Equal(rcs, []byte{mqttRCNoSubscriptionExisted}))
+}
+
+func TestMQTTV5PubAckNotAuthorized(t *testing.T) {
+	o := testMQTTDefaultOptions()
+	o.Users = []*User{{
+		Username: "user",
+		Password: "pass",
+		Permissions: &Permissions{
+			Publish: &SubjectPermission{Deny: []string{"denied"}},
+		},
+	}}
+	s := testMQTTRunServer(t, o)
+	defer testMQTTShutdownServer(s)
+
+	mc, r := testMQTTV5Connect(t, &mqttConnInfo{clientID: "pub", cleanSess: true, user: "user", pass: "pass"}, nil, o.MQTT.Host, o.MQTT.Port)
+	defer mc.Close()
+	testMQTTV5CheckConnAck(t, r, mqttRCSuccess, false)
+
+	// The failure is reported in the acknowledgment and the connection stays up.
+	testMQTTV5SendPublish(t, mc, 1, "denied", 1, nil, []byte("msg"))
+	require_Equal(t, testMQTTV5ReadAck(t, r, mqttPacketPubAck, 1), mqttRCNotAuthorized)
+	testMQTTV5SendPublish(t, mc, 2, "denied", 2, nil, []byte("msg"))
+	require_Equal(t, testMQTTV5ReadAck(t, r, mqttPacketPubRec, 2), mqttRCNotAuthorized)
+	testMQTTV5SendPublish(t, mc, 1, "allowed", 3, nil, []byte("msg"))
+	require_Equal(t, testMQTTV5ReadAck(t, r, mqttPacketPubAck, 3), mqttRCSuccess)
+}
+
+func TestMQTTV5SessionExpiry(t *testing.T) {
+	o := testMQTTDefaultOptions()
+	s := testMQTTRunServer(t, o)
+	defer testMQTTShutdownServer(s)
+
+	expiry := func(secs uint32) []byte {
+		w := newMQTTWriter(0)
+		w.WriteByte(mqttPropSessionExpiry)
+		w.WriteUint32(secs)
+		return w.Bytes()
+	}
+	ci := &mqttConnInfo{clientID: "expiry"}
+
+	// A session expiry of 0 makes the session end with the connection, even
+	// though clean start is not set.
+	mc, r := testMQTTV5Connect(t, ci, nil, o.MQTT.Host, o.MQTT.Port)
+	testMQTTV5CheckConnAck(t, r, mqttRCSuccess, false)
+	testMQTTV5Sub(t, 1, mc, r, nil, []string{"foo"}, []byte{1})
+	testMQTTDisconnect(t, mc, nil)
+	mc.Close()
+
+	mc, r = testMQTTV5Connect(t, ci, expiry(1), o.MQTT.Host, o.MQTT.Port)
+	testMQTTV5CheckConnAck(t, r, mqttRCSuccess, false)
+	testMQTTV5Sub(t, 1, mc, r, nil, []string{"foo"}, []byte{1})
+	testMQTTDisconnect(t, mc, nil)
+	mc.Close()
+
+	// Reconnecting before the expiry finds the session.
+	mc, r = testMQTTV5Connect(t, ci, expiry(1), o.MQTT.Host, o.MQTT.Port)
+	testMQTTV5CheckConnAck(t, r, mqttRCSuccess, true)
+	testMQTTDisconnect(t, mc, nil)
+	mc.Close()
+
+	// But not after.
+	time.Sleep(1500 * time.Millisecond)
+	mc, r = testMQTTV5Connect(t, ci, expiry(mqttSessionExpiryNever), o.MQTT.Host, o.MQTT.Port)
+	defer mc.Close()
+	testMQTTV5CheckConnAck(t, r, mqttRCSuccess, false)
+
+	// Setting an expiry on DISCONNECT when it was 0 on CONNECT is an error.
+	mc2, r2 := testMQTTV5Connect(t, &mqttConnInfo{clientID: "zero"}, nil, o.MQTT.Host, o.MQTT.Port)
+	defer mc2.Close()
+	testMQTTV5CheckConnAck(t, r2, mqttRCSuccess, false)
+	props := expiry(10)
+	w := newMQTTWriter(0)
+	w.WriteByte(mqttPacketDisconnect)
+	w.WriteVarInt(1 + 1 + len(props))
+	w.WriteByte(mqttRCSuccess)
+	w.WriteVarInt(len(props))
+	w.Write(props)
+	testMQTTWrite(mc2, w.Bytes())
+	require_Equal(t, testMQTTV5ReadDisconnect(t, r2), mqttRCProtocolError)
+	testMQTTExpectDisconnect(t, mc2)
+}
+
+func TestMQTTV5SessionTakenOver(t *testing.T) {
+	o := testMQTTDefaultOptions()
+	s := testMQTTRunServer(t, o)
+	defer testMQTTShutdownServer(s)
+
+	ci := &mqttConnInfo{clientID: "takeover", cleanSess: true}
+	mc, r := testMQTTV5Connect(t, ci, nil, o.MQTT.Host, o.MQTT.Port)
+	defer mc.Close()
+	testMQTTV5CheckConnAck(t, r, mqttRCSuccess, false)
+
+	mc2, r2 := testMQTTV5Connect(t, ci, nil, o.MQTT.Host, o.MQTT.Port)
+	defer mc2.Close()
+	testMQTTV5CheckConnAck(t, r2, mqttRCSuccess, false)
+
+	require_Equal(t, testMQTTV5ReadDisconnect(t, r), mqttRCSessionTakenOver)
+	testMQTTExpectDisconnect(t, mc)
+}
@@ -471,6 +471,7 @@ type Options struct {
 	JetStreamUniqueTag         string
 	JetStreamLimits            JSLimitOpts
 	JetStreamTpm               JSTpmOpts
+	JetStreamColdTier          JSColdTierOpts
 	JetStreamMaxCatchup        int64
 	JetStreamRequestQueueLimit int64
 	JetStreamInfoQueueLimit    int64
@@ -478,6 +479,8 @@ type Options struct {
 	JetStreamMetaCompactSize   uint64
 	JetStreamMetaCompactSync   bool
 	JetStreamConcurrentIOs     int
+	JetStreamRaftMaxInflight   int
+	JetStreamScrubRate         int64
 	StreamMaxBufferedMsgs      int               `json:"-"`
 	StreamMaxBufferedSize      int64             `json:"-"`
 	StoreDir                   string            `json:"-"`
@@ -589,6 +592,8 @@ type Options struct {
 	// private fields, used for testing
 	gatewaysSolicitDelay time.Duration
 	overrideProto        int
+	raftTransport        newTransportFunc // Transport for JetStream raft groups, e.g. to simulate the network.
+	raftClock            raftClock        // Clock for JetStream raft groups, e.g. to simulate time.
 
 	// JetStream
 	maxMemSet   bool
@@ -2642,6 +2647,77 @@ func parseJetStreamTPM(v interface{}, opts *Options, errors *[]error) error {
 	return nil
 }
 
+// Parse the JetStream cold tier options.
+func parseJetStreamColdTier(v interface{}, opts *Options, errors *[]error) error {
+	var lt token
+	tk, v := unwrapValue(v, &lt)
+
+	opts.JetStreamColdTier = JSColdTierOpts{}
+
+	vv, ok := v.(map[string]interface{})
+	if !ok {
+		return &configErr{tk, fmt.Sprintf("Expected a map to define JetStream cold tier, got %T", v)}
+	}
+	for mk, mv := range vv {
+		tk, mv = unwrapValue(mv, &lt)
+		switch strings.ToLower(mk) {
+		case "dir", "store_dir":
+			dir, ok := mv.(string)
+			if !ok {
+				return &configErr{tk, fmt.Sprintf("Expected a string for JetStream cold tier directory, got %T", mv)}
+			}
+			opts.JetStreamColdTier.Dir = dir
+		case "s3":
+			m, ok := mv.(map[string]interface{})
+			if !ok {
+				return &configErr{tk, fmt.Sprintf("Expected a map to define JetStream cold tier S3, got %T", mv)}
+			}
+			s3 := &S3ColdTierOpts{}
+			for sk, sv := range m {
+				tk, sv = unwrapValue(sv, &lt)
+				str, ok := sv.(string)
+				if !ok {
+					return &configErr{tk, fmt.Sprintf("Expected a string for JetStream cold tier S3 %q, got %T", sk, sv)}
+				}
+				switch strings.ToLower(sk) {
+				case "endpoint":
+					s3.Endpoint = str
+				case "region":
+					s3.Region = str
+				case "bucket":
+					s3.Bucket = str
+				case "prefix":
+					s3.Prefix = str
+				case "access_key":
+					s3.AccessKey = str
+				case "secret_key":
+					s3.SecretKey = str
+				default:
+					if !tk.IsUsedVariable() {
+						*errors = append(*errors, &unknownConfigFieldErr{field: sk, configErr: configErr{token: tk}})
+					}
+				}
+			}
+			opts.JetStreamColdTier.S3 = s3
+		default:
+			if !tk.IsUsedVariable() {
+				err := &unknownConfigFieldErr{
+					field: mk,
+					configErr: configErr{
+						token: tk,
+					},
+				}
+				*errors = append(*errors, err)
+				continue
+			}
+		}
+	}
+	if opts.JetStreamColdTier.Dir != _EMPTY_ && opts.JetStreamColdTier.S3 != nil {
+		return &configErr{tk, "JetStream cold tier can not be both a directory and S3"}
+	}
+	return nil
+}
+
 func setJetStreamEkCipher(opts *Options, mv interface{}, tk token) error {
 	switch strings.ToLower(mv.(string)) {
 	case "chacha", "chachapoly":
@@ -2737,6 +2813,10 @@ func parseJetStream(v any, opts *Options, errors *[]error, warnings *[]error) er
 				if err := parseJetStreamTPM(tk, opts, errors); err != nil {
 					return err
 				}
+			case "cold_tier":
+				if err := parseJetStreamColdTier(tk, opts, errors); err != nil {
+					return err
+				}
 			case "unique_tag":
 				opts.JetStreamUniqueTag = strings.ToLower(strings.TrimSpace(mv.(string)))
 			case "max_outstanding_catchup":
@@ -2792,6 +2872,21 @@ func parseJetStream(v any, opts *Options, errors *[]error, warnings *[]error) er
 					return &configErr{tk, fmt.Sprintf("Expected an absolute size for %q between 4 and 8192, got %v", mk, mv)}
 				}
 				opts.JetStreamConcurrentIOs = int(dios)
+			case "raft_max_inflight":
+				inflight, ok := mv.(int64)
+				if !ok || inflight < 0 {
+					return &configErr{tk, fmt.Sprintf("Expected a non-negative number for %q, got %v", mk, mv)}
+				}
+				opts.JetStreamRaftMaxInflight = int(inflight)
+			case "scrub_rate":
+				rate, err := getStorageSize(mv)
+				if err != nil {
+					return &configErr{tk, fmt.Sprintf("%s %s", strings.ToLower(mk), err)}
+				}
+				if rate < 0 {
+					return &configErr{tk, fmt.Sprintf("Expected an absolute size for %q, got %v", mk, mv)}
+				}
+				opts.JetStreamScrubRate = rate
 			default:
 				if !tk.IsUsedVariable() {
 					err := &unknownConfigFieldErr{
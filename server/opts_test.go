@@ -4780,3 +4780,55 @@ func TestOptionsRemoteLeafNodeName(t *testing.T) {
 	r2 := &RemoteLeafOpts{URLs: []*url.URL{u1}, LocalAccount: `A", credentials="creds`}
 	require_False(t, r1.name() == r2.name())
 }
+
+func TestJetStreamRaftMaxInflightOption(t *testing.T) {
+	conf := createConfFile(t, []byte(`
+		jetstream: {
+			raft_max_inflight: 8
+		}
+	`))
+	opts, err := ProcessConfigFile(conf)
+	require_NoError(t, err)
+	require_Equal(t, opts.JetStreamRaftMaxInflight, 8)
+
+	// Disabled unless configured.
+	conf = createConfFile(t, []byte(`
+		jetstream: {
+			raft_max_inflight: 0
+		}
+	`))
+	opts, err = ProcessConfigFile(conf)
+	require_NoError(t, err)
+	require_Equal(t, opts.JetStreamRaftMaxInflight, 0)
+	setBaselineOptions(opts)
+	require_Equal(t, opts.JetStreamRaftMaxInflight, 0)
+
+	conf = createConfFile(t, []byte(`
+		jetstream: {
+			raft_max_inflight: -1
+		}
+	`))
+	_, err = ProcessConfigFile(conf)
+	require_Error(t, err)
+	require_Contains(t, err.Error(), "raft_max_inflight")
+}
+
+func TestJetStreamScrubRateOption(t *testing.T) {
+	conf := createConfFile(t, []byte(`
+		jetstream: {
+			scrub_rate: 10MB
+		}
+	`))
+	opts, err := ProcessConfigFile(conf)
+	require_NoError(t, err)
+	require_Equal(t, opts.JetStreamScrubRate, 10*1024*1024)
+
+	conf = createConfFile(t, []byte(`
+		jetstream: {
+			scrub_rate: -1
+		}
+	`))
+	_, err = ProcessConfigFile(conf)
+	require_Error(t, err)
+	require_Contains(t, err.Error(), "scrub_rate")
+}
@@ -21,7 +21,6 @@ import (
 	"fmt"
 	"iter"
 	"math"
-	"math/rand"
 	"os"
 	"path/filepath"
 	"runtime"
@@ -53,6 +52,8 @@ type RaftNode interface {
 	Progress() (index, commit, applied uint64)
 	Leader() bool
 	LeaderSince() *time.Time
+	Lease() bool
+	ReadIndex(timeout time.Duration) (uint64, error)
 	Quorum() bool
 	Current() bool
 	Healthy() bool
@@ -71,6 +72,7 @@ type RaftNode interface {
 	PeerNames() []string
 	VotingPeerNames() []string
 	LastHeardFromPeer(peer string) time.Time
+	ObservedPeer(peer string) *Peer
 	ProposeAddPeer(peer string) error
 	ProposeRemovePeer(peer string) error
 	EvictPeers(peers []string) ([]string, error)
@@ -186,12 +188,12 @@ type raft struct {
 	peers map[string]*lps // Other peers in the Raft group
 
 	removed  map[string]time.Time           // Peers that were removed from the group
-	observed map[string]time.Time           // Peers not in our peer set that we've heard from, only for managed groups
+	observed map[string]*lps                // Peers not in our peer set that we've heard from, only for managed groups
 	acks     map[uint64]map[string]struct{} // Append entry responses/acks, map of entry index -> peer ID
 	pae      map[uint64]*appendEntry        // Pending append entries
 
 	rescue *time.Timer // Non-nil while an unsafe quorum rescue is active (see RescueQuorum)
-	elect  *time.Timer // Election timer, normally accessed via electTimer
+	elect  raftTimer   // Election timer, normally accessed via electTimer
 	etlr   time.Time   // Election timer last reset time, for unit tests only
 	active time.Time   // Last activity time, i.e. for heartbeats
 	llqrt  time.Time   // Last quorum lost time
@@ -233,6 +235,7 @@ type raft struct {
 	areply string // Append entries responses subject
 
 	t     raftTransport // Transport that handles Raft messaging
+	clock raftClock     // Source of time for timers, the wall clock if nil
 	aesub *subscription // Subscription for handleAppendEntry callbacks
 
 	wtv []byte // Term and vote to be written
@@ -266,6 +269,33 @@ type raft struct {
 	overrunCount uint64 // Counter of how many times we were overrun, either as follower or as leader.
 
 	fastPathTerm atomic.Uint64 // Term accepting fast path proposals, zero when closed.
+
+	lease  bool                 // Whether leader leases are enabled (see Lease).
+	lsends []leaseSend          // Times we sent entries in our term, to renew our lease from acks.
+	lacks  map[string]time.Time // Per peer, the send time of the latest entry it acknowledged in our term.
+	lrenew chan struct{}        // Closed once our lease is renewed, while reads are waiting on it.
+	lrent  time.Time            // Last time we sent an entry to renew our lease.
+	lheard time.Time            // Last time we heard from the leader, we don't vote for others while its lease may be valid.
+	lstop  bool                 // Our lease was given up, as we're stepping down.
+
+	maxInflight int        // Append entries in flight to a quorum of our followers before we hold back proposals, zero if disabled.
+	asent       []uint64   // Last index of the append entries we sent in our term and that aren't committed yet.
+	batches     batchStats // Sizes of the append entries we sent for proposals.
+}
+
+// batchStats tracks the sizes of the append entries the leader sends for proposals.
+type batchStats struct {
+	count   uint64 // Append entries sent
+	entries uint64 // Entries sent in them
+	bytes   uint64 // Bytes of the entries
+	max     int    // Most entries in a single append entry
+	held    uint64 // Times proposals were held back, because the in-flight window was full
+}
+
+// leaseSend holds the time we sent the entry at the index.
+type leaseSend struct {
+	index uint64
+	ts    time.Time
 }
 
 type proposedEntry struct {
@@ -348,6 +378,15 @@ type RaftConfig struct {
 	// This is mainly for tests to inject a custom transport.
 	// If nil, the default transport is used.
 	NewTransport newTransportFunc
+
+	// Clock is the source of time for the timers of the Raft node.
+	// This is mainly for tests to simulate time.
+	// If nil, the wall clock is used.
+	Clock raftClock
+
+	// Lease enables leader leases, allowing the leader to serve linearizable reads
+	// without a round trip to its followers (see Lease and ReadIndex).
+	Lease bool
 }
 
 var (
@@ -382,6 +421,8 @@ var (
 	errNotManaged        = errors.New("raft: group membership is not managed")
 	errNotLeaderless     = errors.New("raft: group is not leaderless")
 	errQuorumPossible    = errors.New("raft: remaining peers could still reach quorum")
+	errLeaseDisabled     = errors.New("raft: leader lease not enabled")
+	errReadIndexTimeout  = errors.New("raft: timeout waiting for read index")
 )
 
 // This will bootstrap a raftNode by writing its config into the store directory.
@@ -497,7 +538,10 @@ func (s *Server) initRaftNode(accName string, cfg *RaftConfig, labels pprofLabel
 		accName:  accName,
 		leadc:    make(chan leadChange, 1),
 		observer: cfg.Observer,
+		lease:    cfg.Lease,
+		clock:    cfg.Clock,
 	}
+	n.maxInflight = s.getOpts().JetStreamRaftMaxInflight
 
 	if cfg.NewTransport != nil {
 		n.t = cfg.NewTransport(s, n)
@@ -639,7 +683,12 @@ func (s *Server) initRaftNode(accName string, cfg *RaftConfig, labels pprofLabel
 	// of the other nodes.
 	n.Lock()
 	n.resetElectionTimeout()
-	n.llqrt = time.Now()
+	n.llqrt = n.now()
+
+	// We may have heard from a leader right before we restarted, its lease could still be valid.
+	if n.lease && n.pindex > 0 {
+		n.lheard = n.now()
+	}
 
 	// If our log is empty, and we're initializing, relax the "empty log" checks temporarily.
 	if !cfg.Recovering && n.pindex == 0 {
@@ -1052,7 +1101,9 @@ func (n *raft) isLeaderOverrun() bool {
 	uncommittedThreshold := n.pindex > commit && n.pindex-commit > pauseQuorumThreshold
 	// Or, the number of in-memory committed but not yet applied entries is over the threshold: we're slow to apply.
 	unappliedThreshold := commit > applied && commit-applied > pauseQuorumThreshold
-	return uncommittedThreshold || unappliedThreshold
+	// Or, the number of proposals held back by a full in-flight window is: we're not getting responses from our followers.
+	heldThreshold := n.maxInflight > 0 && n.prop.len() > pauseQuorumThreshold
+	return uncommittedThreshold || unappliedThreshold || heldThreshold
 }
 
 // ForwardProposal will forward the proposal to the leader if known.
@@ -1342,7 +1393,7 @@ func (n *raft) RescueQuorum(qn int) (prev, cur int, err error) {
 	n.warn("Unsafe quorum rescue applied, quorum lowered %d -> %d for %v", prev, qn, rescueQuorumTimeout)
 
 	// Make sure an election can happen soon.
-	n.resetElect(randCampaignTimeout())
+	n.resetElect(n.randCampaignTimeout())
 	return prev, qn, nil
 }
 
@@ -2122,7 +2173,7 @@ func (n *raft) isCurrent(includeForwardProgress bool) bool {
 	// Check to see that we have heard from the current leader lately.
 	if n.leader != noLeader && n.leader != n.id && n.catchup == nil {
 		okInterval := hbInterval * 2
-		if ps := n.peers[n.leader]; ps == nil || time.Since(ps.ts) > okInterval {
+		if ps := n.peers[n.leader]; ps == nil || n.since(ps.ts) > okInterval {
 			n.debug("Not current, no recent leader contact")
 			return false
 		}
@@ -2270,7 +2321,7 @@ func (n *raft) StepDown(preferred ...string) error {
 		var isHealthy bool
 		if ps, ok := n.peers[maybeLeader]; ok {
 			si, ok := n.s.nodeToInfo.Load(maybeLeader)
-			isHealthy = ok && !si.(nodeInfo).offline && time.Since(ps.ts) < hbInterval*3
+			isHealthy = ok && !si.(nodeInfo).offline && n.since(ps.ts) < hbInterval*3
 		}
 		if !isHealthy {
 			maybeLeader = noLeader
@@ -2285,13 +2336,15 @@ func (n *raft) StepDown(preferred ...string) error {
 				continue
 			}
 			si, ok := n.s.nodeToInfo.Load(peer)
-			isHealthy := ok && !si.(nodeInfo).offline && time.Since(ps.ts) < hbInterval*3
+			isHealthy := ok && !si.(nodeInfo).offline && n.since(ps.ts) < hbInterval*3
 			if isHealthy {
 				maybeLeader = peer
 				break
 			}
 		}
 	}
+	// Give up our lease before the leader transfer allows a new leader to be elected.
+	n.lstop = true
 	n.Unlock()
 
 	if len(preferred) > 0 && maybeLeader == noLeader {
@@ -2318,7 +2371,7 @@ func (n *raft) StepDown(preferred ...string) error {
 func (n *raft) Campaign() error {
 	n.Lock()
 	defer n.Unlock()
-	return n.campaign(randCampaignTimeout())
+	return n.campaign(n.randCampaignTimeout())
 }
 
 // CampaignImmediately will have our node start a leadership vote after minimal delay.
@@ -2330,8 +2383,8 @@ func (n *raft) CampaignImmediately() error {
 	return n.campaign(minCampaignTimeout / 2)
 }
 
-func randCampaignTimeout() time.Duration {
-	delta := rand.Int63n(int64(maxCampaignTimeout - minCampaignTimeout))
+func (n *raft) randCampaignTimeout() time.Duration {
+	delta := n.getClock().Int63n(int64(maxCampaignTimeout - minCampaignTimeout))
 	return (minCampaignTimeout + time.Duration(delta))
 }
 
@@ -2417,7 +2470,7 @@ func (n *raft) Peers() []*Peer {
 			// This peer is the leader, we don't know our lag, but we can report
 			// on whether we've seen the leader recently.
 			okInterval := hbInterval * 2
-			current = time.Since(ps.ts) <= okInterval
+			current = n.since(ps.ts) <= okInterval
 		} else {
 			// The remaining condition is another follower that we're not in contact with.
 			// We intentionally leave current and lag as empty.
@@ -2492,6 +2545,24 @@ func (n *raft) shutdown() {
 	}
 }
 
+// resetLog discards the log and snapshots of this node when they are found to be corrupt,
+// keeping the term, vote and peer set, so the leader catches it up with a snapshot.
+func (n *raft) resetLog() {
+	n.Lock()
+	defer n.Unlock()
+
+	n.warn("Resetting log")
+	if n.State() == Leader {
+		n.stepdownLocked(n.selectNextLeader())
+	}
+	n.cancelCatchup()
+	n.snapshotting = false
+
+	// Reset the WAL, but reset these first to not trip the assertion.
+	n.commit, n.hcommit, n.applied, n.processed, n.papplied = 0, 0, 0, 0, 0
+	n.resetWAL()
+}
+
 // Reset discards this node's local raft state (log, snapshots, peer set,
 // term/vote) so it can be caught up cleanly by another group with the same
 // name. The caller is responsible for parking the node first (typically via
@@ -2619,29 +2690,29 @@ func (n *raft) createInternalSubs() error {
 	return nil
 }
 
-func randElectionTimeout() time.Duration {
-	delta := rand.Int63n(int64(maxElectionTimeout - minElectionTimeout))
+func (n *raft) randElectionTimeout() time.Duration {
+	delta := n.getClock().Int63n(int64(maxElectionTimeout - minElectionTimeout))
 	return (minElectionTimeout + time.Duration(delta))
 }
 
 // Lock should be held.
 func (n *raft) resetElectionTimeout() {
-	n.resetElect(randElectionTimeout())
+	n.resetElect(n.randElectionTimeout())
 }
 
 func (n *raft) resetElectionTimeoutWithLock() {
-	n.resetElectWithLock(randElectionTimeout())
+	n.resetElectWithLock(n.randElectionTimeout())
 }
 
 // Lock should be held.
 func (n *raft) resetElect(et time.Duration) {
-	n.etlr = time.Now()
+	n.etlr = n.now()
 	if n.elect == nil {
-		n.elect = time.NewTimer(et)
+		n.elect = n.getClock().NewTimer(et)
 	} else {
 		if !n.elect.Stop() {
 			select {
-			case <-n.elect.C:
+			case <-n.elect.C():
 			default:
 			}
 		}
@@ -2753,7 +2824,7 @@ func (n *raft) error(format string, args ...any) {
 	n.s.Errorf(nf, args...)
 }
 
-func (n *raft) electTimer() *time.Timer {
+func (n *raft) electTimer() raftTimer {
 	n.RLock()
 	defer n.RUnlock()
 	return n.elect
@@ -2784,7 +2855,7 @@ func (n *raft) setObserverLocked(isObserver bool, extSt extensionState) {
 	// If we're leaving observer state then reset the election timer or
 	// we might end up waiting for up to the observerModeInterval.
 	if wasObserver && !isObserver {
-		n.resetElect(randElectionTimeout())
+		n.resetElect(n.randElectionTimeout())
 	}
 }
 
@@ -2827,7 +2898,7 @@ func (n *raft) runAsFollower() {
 		case <-n.quit:
 			// The Raft node is shutting down.
 			return
-		case <-elect.C:
+		case <-elect.C():
 			// The election timer has fired so we think it's time to call an election.
 			// If we are out of resources we just want to stay in this state for the moment.
 			if n.outOfResources() {
@@ -3312,7 +3383,7 @@ func (n *raft) removePeer(peer string) {
 	if n.removed == nil {
 		n.removed = map[string]time.Time{}
 	}
-	n.removed[peer] = time.Now()
+	n.removed[peer] = n.now()
 
 	delete(n.peers, peer)
 	n.adjustClusterSizeAndQuorum()
@@ -3407,10 +3478,10 @@ func (n *raft) runAsLeader() {
 	}()
 	n.Unlock()
 
-	hb := time.NewTicker(hbInterval)
+	hb := n.getClock().NewTicker(hbInterval)
 	defer hb.Stop()
 
-	lq := time.NewTicker(lostQuorumCheck)
+	lq := n.getClock().NewTicker(lostQuorumCheck)
 	defer lq.Stop()
 
 	for n.State() == Leader {
@@ -3425,50 +3496,30 @@ func (n *raft) runAsLeader() {
 				n.processAppendEntryResponse(ar)
 			}
 			n.resp.recycle(&ars)
-		case <-n.prop.ch:
-			const maxBatch = 256 * 1024
-			const maxEntries = 4096 // larger batches showed no benefit
-			var entries []*Entry
-
-			es, sz := n.prop.pop(), 0
-			for _, b := range es {
-				if b.term != term {
-					continue
-				}
-				if b.ChangesMembership() {
-					n.sendMembershipChange(b.Entry)
-					continue
-				}
-				entries = append(entries, b.Entry)
-				// Increment size.
-				sz += len(b.Data) + 1
-				// If below thresholds go ahead and send.
-				if sz < maxBatch && len(entries) < maxEntries {
-					continue
-				}
-				n.sendAppendEntry(entries)
-				// Reset our sz and entries.
-				// We need to re-create `entries` because there is a reference
-				// to it in the node's pae map.
-				sz, entries = 0, nil
-			}
-			if len(entries) > 0 {
-				n.sendAppendEntry(entries)
+			// Send the proposals we held back, if our followers caught up.
+			if n.prop.len() > 0 && !n.inflightWindowFull() {
+				n.sendProposals(term)
 			}
-			// Respond to any proposals waiting for a confirmation.
-			for _, pe := range es {
-				if pe.term == term && pe.reply != _EMPTY_ {
-					n.sendReply(pe.reply, nil)
-				}
-				pe.returnToPool()
+		case <-n.prop.ch:
+			// Hold back the proposals while our followers have a full window in flight.
+			// They'll queue up meanwhile, and be sent in larger batches once they respond.
+			if n.inflightWindowFull() {
+				n.Lock()
+				n.batches.held++
+				n.Unlock()
+				continue
 			}
-			n.prop.recycle(&es)
+			n.sendProposals(term)
 
-		case <-hb.C:
+		case <-hb.C():
 			if n.notActive() {
 				n.sendHeartbeat()
 			}
-		case <-lq.C:
+			// Followers could have been removed while we held back proposals.
+			if n.prop.len() > 0 && !n.inflightWindowFull() {
+				n.sendProposals(term)
+			}
+		case <-lq.C():
 			if n.lostQuorum() {
 				n.stepdown(noLeader)
 				return
@@ -3494,6 +3545,102 @@ func (n *raft) runAsLeader() {
 	}
 }
 
+// sendProposals sends all queued proposals to our followers,
+// coalescing them into as few append entries as possible.
+func (n *raft) sendProposals(term uint64) {
+	const maxBatch = 256 * 1024
+	const maxEntries = 4096 // larger batches showed no benefit
+	var entries []*Entry
+
+	es, sz := n.prop.pop(), 0
+	for _, b := range es {
+		if b.term != term {
+			continue
+		}
+		if b.ChangesMembership() {
+			n.sendMembershipChange(b.Entry)
+			continue
+		}
+		entries = append(entries, b.Entry)
+		// Increment size.
+		sz += len(b.Data) + 1
+		// If below thresholds go ahead and send.
+		if sz < maxBatch && len(entries) < maxEntries {
+			continue
+		}
+		n.sendBatch(entries, sz)
+		// Reset our sz and entries.
+		// We need to re-create `entries` because there is a reference
+		// to it in the node's pae map.
+		sz, entries = 0, nil
+	}
+	if len(entries) > 0 {
+		n.sendBatch(entries, sz)
+	}
+	// Respond to any proposals waiting for a confirmation.
+	for _, pe := range es {
+		if pe.term == term && pe.reply != _EMPTY_ {
+			n.sendReply(pe.reply, nil)
+		}
+		pe.returnToPool()
+	}
+	n.prop.recycle(&es)
+}
+
+// sendBatch sends a batch of proposed entries in a single append entry.
+func (n *raft) sendBatch(entries []*Entry, sz int) {
+	n.Lock()
+	defer n.Unlock()
+	if err := n.sendAppendEntryLocked(entries, true); err != nil {
+		return
+	}
+	b := &n.batches
+	b.count++
+	b.entries += uint64(len(entries))
+	b.bytes += uint64(sz)
+	b.max = max(b.max, len(entries))
+}
+
+// inflightWindowFull returns whether a quorum of our followers has a full window of
+// append entries in flight, i.e. sent but not acknowledged yet.
+func (n *raft) inflightWindowFull() bool {
+	n.RLock()
+	defer n.RUnlock()
+	if n.maxInflight <= 0 || n.qn <= 1 {
+		return false
+	}
+	// We don't have to wait for ourselves, or for followers we don't know of yet.
+	open, full := 1, 0
+	for id, ps := range n.peers {
+		if id == n.id {
+			continue
+		}
+		if n.inflight(ps.li) < n.maxInflight {
+			open++
+		} else {
+			full++
+		}
+	}
+	return full > 0 && open < n.qn
+}
+
+// inflight returns the number of append entries we sent that a peer which replicated up to
+// the index didn't acknowledge yet. Responses acknowledge up to an index, so these are all
+// the append entries ending after it. Append entries that are committed are no longer
+// tracked, since a quorum acknowledged them.
+// Lock should be held.
+func (n *raft) inflight(index uint64) int {
+	i, _ := slices.BinarySearch(n.asent, index+1)
+	return len(n.asent) - i
+}
+
+// trackInflightSend tracks the append entry we just sent, up to our last index, until it's committed.
+// Lock should be held.
+func (n *raft) trackInflightSend() {
+	i, _ := slices.BinarySearch(n.asent, n.commit+1)
+	n.asent = append(n.asent[i:], n.pindex)
+}
+
 // Quorum reports the quorum status. Will be called on former leaders.
 func (n *raft) Quorum() bool {
 	n.RLock()
@@ -3501,7 +3648,44 @@ func (n *raft) Quorum() bool {
 
 	nc := 0
 	for id, peer := range n.peers {
-		if id == n.id || time.Since(peer.ts) < lostQuorumInterval {
+		if id == n.id || n.since(peer.ts) < lostQuorumInterval {
+			if nc++; nc >= n.qn {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Lease returns whether we are the leader and hold a valid leader lease.
+// A quorum of peers acknowledged us as leader recently enough that they
+// will not vote for another leader until our lease expires. This allows us
+// to serve reads linearizably without a round trip to our followers.
+func (n *raft) Lease() bool {
+	n.RLock()
+	defer n.RUnlock()
+	return n.leaseValidLocked()
+}
+
+// leaseTimeout returns for how long an acknowledgement of a peer extends our lease.
+// Followers don't vote for others for minElectionTimeout after they heard from us,
+// the difference is a safety margin for clock drift.
+func leaseTimeout() time.Duration {
+	return minElectionTimeout * 3 / 4
+}
+
+// Send times are only tracked this often, an ack is then attributed to the earlier send.
+const leaseSendInterval = 10 * time.Millisecond
+
+// Lock should be held.
+func (n *raft) leaseValidLocked() bool {
+	if !n.lease || n.lstop || n.State() != Leader || !n.leaderState.Load() {
+		return false
+	}
+	lt := leaseTimeout()
+	nc := 0
+	for id := range n.peers {
+		if id == n.id || n.since(n.lacks[id]) < lt {
 			if nc++; nc >= n.qn {
 				return true
 			}
@@ -3510,6 +3694,112 @@ func (n *raft) Quorum() bool {
 	return false
 }
 
+// trackLeaseSend tracks the time we sent the entry at our current index.
+// Lock should be held.
+func (n *raft) trackLeaseSend() {
+	now := n.now()
+	if l := len(n.lsends); l > 0 && now.Sub(n.lsends[l-1].ts) < leaseSendInterval {
+		return
+	}
+	// Sends that are too old can't extend our lease anymore.
+	lt, i := leaseTimeout(), 0
+	for i < len(n.lsends) && now.Sub(n.lsends[i].ts) >= lt {
+		i++
+	}
+	n.lsends = append(n.lsends[i:], leaseSend{n.pindex, now})
+}
+
+// trackLeaseAck extends the lease granted by the peer that acknowledged up to the index.
+// The peer had to receive the latest entry up to that index from us, so it heard from us
+// after we sent it. Since responses don't identify the append entry they're for, the send
+// time of that entry is the latest we can safely use.
+// Lock should be held.
+func (n *raft) trackLeaseAck(peer string, index uint64) {
+	var ts time.Time
+	for i := len(n.lsends) - 1; i >= 0; i-- {
+		if n.lsends[i].index <= index {
+			ts = n.lsends[i].ts
+			break
+		}
+	}
+	if ts.IsZero() || !ts.After(n.lacks[peer]) {
+		return
+	}
+	if n.lacks == nil {
+		n.lacks = make(map[string]time.Time)
+	}
+	n.lacks[peer] = ts
+	if n.lrenew != nil && n.leaseValidLocked() {
+		close(n.lrenew)
+		n.lrenew = nil
+	}
+}
+
+// ReadIndex returns the index reads can be served at linearizably, once it's processed.
+// If our lease is not valid, an entry is sent to renew it with the acknowledgements of
+// our followers. Blocks until our lease is valid and the index is processed, or returns
+// an error after the timeout.
+func (n *raft) ReadIndex(timeout time.Duration) (uint64, error) {
+	t := time.NewTimer(timeout)
+	defer t.Stop()
+
+	n.Lock()
+	if !n.lease {
+		n.Unlock()
+		return 0, errLeaseDisabled
+	}
+	// Acks might get lost, so retry sending if our lease isn't renewed in time.
+	retry := time.NewTicker(hbInterval)
+	defer retry.Stop()
+	for !n.leaseValidLocked() {
+		if !n.Leader() || n.lstop {
+			n.Unlock()
+			return 0, errNotLeader
+		}
+		// Without recent writes our lease expires, send a NOOP to be acknowledged.
+		if n.since(n.lrent) >= hbInterval {
+			n.lrent = n.now()
+			n.sendPeerState()
+		}
+		if n.lrenew == nil {
+			n.lrenew = make(chan struct{})
+		}
+		renewed := n.lrenew
+		n.Unlock()
+
+		select {
+		case <-renewed:
+		case <-retry.C:
+		case <-t.C:
+			return 0, errReadIndexTimeout
+		case <-n.quit:
+			return 0, errNodeClosed
+		}
+		n.Lock()
+	}
+	index := n.commit
+	n.Unlock()
+
+	// Wait for everything committed up to now to be processed by the upper layer.
+	ticker := time.NewTicker(5 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		n.RLock()
+		processed := n.processed
+		n.RUnlock()
+		if processed >= index {
+			return index, nil
+		}
+		select {
+		case <-ticker.C:
+		case <-t.C:
+			return 0, errReadIndexTimeout
+		case <-n.quit:
+			return 0, errNodeClosed
+		}
+	}
+}
+
 func (n *raft) lostQuorum() bool {
 	n.RLock()
 	defer n.RUnlock()
@@ -3520,13 +3810,13 @@ func (n *raft) lostQuorumLocked() bool {
 	// In order to avoid false positives that can happen in heavily loaded systems
 	// make sure nothing is queued up that we have not processed yet.
 	// Also make sure we let any scale up actions settle before deciding.
-	if n.resp.len() != 0 || (!n.lsut.IsZero() && time.Since(n.lsut) < lostQuorumInterval) {
+	if n.resp.len() != 0 || (!n.lsut.IsZero() && n.since(n.lsut) < lostQuorumInterval) {
 		return false
 	}
 
 	nc := 0
 	for id, peer := range n.peers {
-		if id == n.id || time.Since(peer.ts) < lostQuorumInterval {
+		if id == n.id || n.since(peer.ts) < lostQuorumInterval {
 			if nc++; nc >= n.qn {
 				return false
 			}
@@ -3540,7 +3830,7 @@ func (n *raft) lostQuorumLocked() bool {
 func (n *raft) notActive() bool {
 	n.RLock()
 	defer n.RUnlock()
-	return time.Since(n.active) > hbInterval
+	return n.since(n.active) > hbInterval
 }
 
 // Return our current term.
@@ -3625,10 +3915,10 @@ func (n *raft) runCatchup(ar *appendEntryResponse, indexUpdatesQ *ipQueue[uint64
 	}
 
 	const activityInterval = 2 * time.Second
-	timeout := time.NewTimer(activityInterval)
+	timeout := n.getClock().NewTimer(activityInterval)
 	defer timeout.Stop()
 
-	stepCheck := time.NewTicker(100 * time.Millisecond)
+	stepCheck := n.getClock().NewTicker(100 * time.Millisecond)
 	defer stepCheck.Stop()
 
 	// Run as long as we are leader and still not caught up.
@@ -3638,12 +3928,12 @@ func (n *raft) runCatchup(ar *appendEntryResponse, indexUpdatesQ *ipQueue[uint64
 			return
 		case <-n.quit:
 			return
-		case <-stepCheck.C:
+		case <-stepCheck.C():
 			if n.State() != Leader {
 				n.debug("Catching up canceled, no longer leader")
 				return
 			}
-		case <-timeout.C:
+		case <-timeout.C():
 			n.debug("Catching up for %q stalled", peer)
 			return
 		case <-indexUpdatesQ.ch:
@@ -3956,6 +4246,15 @@ func (n *raft) trackResponse(ar *appendEntryResponse) bool {
 	if ps != nil && ar.index > ps.li {
 		ps.li = ar.index
 	}
+	// Also for those following our log without being a peer, like learners.
+	if ops := n.observed[ar.peer]; ps == nil && ops != nil && ar.index > ops.li {
+		ops.li = ar.index
+	}
+
+	// The peer acknowledged our leadership, which renews our lease.
+	if n.lease && ps != nil && ar.term == n.term {
+		n.trackLeaseAck(ar.peer, ar.index)
+	}
 
 	// If we are tracking this peer as a catchup follower, update that here.
 	if indexUpdateQ := n.progress[ar.peer]; indexUpdateQ != nil {
@@ -3999,7 +4298,7 @@ func (n *raft) adjustClusterSizeAndQuorum() {
 
 	if ncsz > pcsz {
 		n.debug("Expanding our clustersize: %d -> %d", pcsz, ncsz)
-		n.lsut = time.Now()
+		n.lsut = n.now()
 	} else if ncsz < pcsz {
 		n.debug("Decreasing our clustersize: %d -> %d", pcsz, ncsz)
 		if n.State() == Leader {
@@ -4032,7 +4331,7 @@ func (n *raft) trackPeer(peer string) error {
 	if n.removed != nil {
 		rts, isRemoved = n.removed[peer]
 		// Removed peers can rejoin after timeout.
-		if isRemoved && time.Since(rts) >= peerRemoveTimeout {
+		if isRemoved && n.since(rts) >= peerRemoveTimeout {
 			isRemoved = false
 		}
 	}
@@ -4043,7 +4342,7 @@ func (n *raft) trackPeer(peer string) error {
 		}
 	}
 	if ps := n.peers[peer]; ps != nil {
-		ps.ts = time.Now()
+		ps.ts = n.now()
 		if n.observed != nil {
 			delete(n.observed, peer)
 			if len(n.observed) == 0 {
@@ -4055,9 +4354,13 @@ func (n *raft) trackPeer(peer string) error {
 		// added to our peer set. Track when we hear from them, so the upper layer
 		// can prefer adding peers that are demonstrably up.
 		if n.observed == nil {
-			n.observed = make(map[string]time.Time, 1)
+			n.observed = make(map[string]*lps, 1)
+		}
+		if ops := n.observed[peer]; ops != nil {
+			ops.ts = n.now()
+		} else {
+			n.observed[peer] = &lps{n.now(), 0}
 		}
-		n.observed[peer] = time.Now()
 	}
 	n.Unlock()
 
@@ -4076,7 +4379,30 @@ func (n *raft) LastHeardFromPeer(peer string) time.Time {
 	if ps := n.peers[peer]; ps != nil {
 		return ps.ts
 	}
-	return n.observed[peer]
+	if ops := n.observed[peer]; ops != nil {
+		return ops.ts
+	}
+	return time.Time{}
+}
+
+// ObservedPeer returns what we know about a peer that is not in our peer set, but
+// that follows our log, like the learners of a stream. Only the leader knows the lag.
+// Nil if we never heard from it.
+func (n *raft) ObservedPeer(peer string) *Peer {
+	n.RLock()
+	defer n.RUnlock()
+	ops := n.observed[peer]
+	if ops == nil || n.peers[peer] != nil {
+		return nil
+	}
+	p := &Peer{ID: peer, Last: ops.ts}
+	if n.id == n.leader {
+		if n.commit > ops.li {
+			p.Lag = n.commit - ops.li
+		}
+		p.Current = p.Lag == 0
+	}
+	return p
 }
 
 func (n *raft) runAsCandidate() {
@@ -4109,7 +4435,7 @@ func (n *raft) runAsCandidate() {
 			return
 		case <-n.quit:
 			return
-		case <-elect.C:
+		case <-elect.C():
 			n.switchToCandidate()
 			return
 		case <-n.votes.ch:
@@ -4206,10 +4532,10 @@ func (n *raft) catchupStalled() bool {
 		return false
 	}
 	if n.catchup.pindex == n.pindex {
-		return time.Since(n.catchup.active) > 2*time.Second
+		return n.since(n.catchup.active) > 2*time.Second
 	}
 	n.catchup.pindex = n.pindex
-	n.catchup.active = time.Now()
+	n.catchup.active = n.now()
 	return false
 }
 
@@ -4228,7 +4554,7 @@ func (n *raft) createCatchup(ae *appendEntry) string {
 		cindex: ae.pindex,
 		pterm:  n.pterm,
 		pindex: n.pindex,
-		active: time.Now(),
+		active: n.now(),
 	}
 	inbox := n.newCatchupInbox()
 	sub, _ := n.subscribe(inbox, n.handleAppendEntry)
@@ -4556,8 +4882,12 @@ func (n *raft) processAppendEntry(ae *appendEntry, sub *subscription) {
 	// Track leader directly
 	// But, do so after all consistency checks so we don't track an old leader.
 	if isNew && ae.leader != noLeader && ae.leader == n.leader {
+		now := n.now()
 		if ps := n.peers[ae.leader]; ps != nil {
-			ps.ts = time.Now()
+			ps.ts = now
+		}
+		if n.lease {
+			n.lheard = now
 		}
 	}
 
@@ -4773,6 +5103,8 @@ CONTINUE:
 		case EntryLeaderTransfer:
 			// Only process these if they are new, so no replays or catchups.
 			if isNew {
+				// The leader is stepping down, so its lease ends and we can vote for the new leader right away.
+				n.lheard = time.Time{}
 				maybeLeader := string(e.Data)
 				// This is us. We need to check if we can become the leader.
 				if maybeLeader == n.id {
@@ -4897,7 +5229,7 @@ func (n *raft) processPeerState(ps *peerState) {
 		if n.removed == nil {
 			n.removed = map[string]time.Time{}
 		}
-		now := time.Now()
+		now := n.now()
 		for peer := range old {
 			n.removed[peer] = now
 		}
@@ -5073,8 +5405,14 @@ func (n *raft) sendAppendEntryLocked(entries []*Entry, checkLeader bool) error {
 		if err := n.storeToWAL(ae); err != nil {
 			return err
 		}
-		n.active = time.Now()
+		n.active = n.now()
 		n.cachePendingEntry(ae)
+		if n.lease && !n.lstop && n.State() == Leader {
+			n.trackLeaseSend()
+		}
+		if n.maxInflight > 0 && n.State() == Leader {
+			n.trackInflightSend()
+		}
 	}
 	n.sendRPC(n.asubj, n.areply, ae.buf)
 	if !shouldStore {
@@ -5521,6 +5859,16 @@ func (n *raft) processVoteRequest(vr *voteRequest) error {
 		return nil
 	}
 
+	// With leader leases, we don't vote for another candidate while the leader we heard
+	// from could still hold its lease. We also don't take on the term, as the leader is
+	// still active and should not be disrupted.
+	if n.lease && n.State() == Follower && vr.candidate != n.leader && n.since(n.lheard) < minElectionTimeout {
+		n.debug("Not granting vote for %q, leader lease could still be valid", vr.candidate)
+		n.Unlock()
+		n.sendReply(vr.reply, vresp.encode())
+		return nil
+	}
+
 	// If this is a higher term go ahead and stepdown.
 	if vr.term > n.term {
 		if n.State() != Follower {
@@ -5563,7 +5911,7 @@ func (n *raft) processVoteRequest(vr *voteRequest) error {
 	} else if n.vote == noVote && n.State() != Candidate {
 		// We have a more up-to-date log, and haven't voted yet.
 		// Start campaigning earlier, but only if not candidate already, as that would short-circuit us.
-		n.resetElect(randCampaignTimeout())
+		n.resetElect(n.randCampaignTimeout())
 	}
 
 	// Term might have changed, make sure response has the most current
@@ -5730,6 +6078,13 @@ func (n *raft) switchToFollowerLocked(leader string) {
 	if len(n.acks) > 0 {
 		n.acks = make(map[uint64]map[string]struct{})
 	}
+	// Our lease ends, wake up any reads waiting for it to be renewed.
+	n.lsends, n.lacks = nil, nil
+	n.asent = nil
+	if n.lrenew != nil {
+		close(n.lrenew)
+		n.lrenew = nil
+	}
 	n.updateLeader(leader)
 	n.switchState(Follower)
 }
@@ -5771,10 +6126,10 @@ func (n *raft) switchToCandidate() {
 	if n.State() != Candidate {
 		n.debug("Switching to candidate")
 	} else {
-		if n.lostQuorumLocked() && time.Since(n.llqrt) > lostQuorumSignal {
+		if n.lostQuorumLocked() && n.since(n.llqrt) > lostQuorumSignal {
 			// We signal to the upper layers such that can alert on quorum lost.
 			n.updateLeadChange(false)
-			n.llqrt = time.Now()
+			n.llqrt = n.now()
 		}
 	}
 	// Increment the term.
@@ -5798,6 +6153,8 @@ func (n *raft) switchToLeader() {
 	n.debug("Switching to leader")
 
 	n.lxfer = false
+	n.lsends, n.lacks, n.lstop = nil, nil, false
+	n.asent = nil
 	n.updateLeader(n.id)
 	n.switchState(Leader)
 
@@ -0,0 +1,103 @@
+// Copyright 2026 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"math/rand"
+	"time"
+)
+
+// raftClock is the source of time for the timers of Raft nodes, like elections,
+// heartbeats and quorum checks, and of the randomness of election timeouts.
+type raftClock interface {
+	// Now returns the current time.
+	Now() time.Time
+
+	// NewTimer creates a timer that fires once after the duration.
+	NewTimer(d time.Duration) raftTimer
+
+	// NewTicker creates a timer that fires every duration.
+	NewTicker(d time.Duration) raftTimer
+
+	// Int63n returns a random number in [0,n).
+	Int63n(n int64) int64
+}
+
+// raftTimer is a timer or ticker created by a raftClock.
+type raftTimer interface {
+	// C returns the channel the timer fires on.
+	C() <-chan time.Time
+
+	// Stop stops the timer, returns false if it already fired or was stopped.
+	Stop() bool
+
+	// Reset changes the timer to fire after the duration.
+	Reset(d time.Duration)
+}
+
+// wallClock is the default implementation of the raftClock interface.
+type wallClock struct{}
+
+func (wallClock) Now() time.Time {
+	return time.Now()
+}
+
+func (wallClock) NewTimer(d time.Duration) raftTimer {
+	return wallTimer{time.NewTimer(d)}
+}
+
+func (wallClock) NewTicker(d time.Duration) raftTimer {
+	return wallTicker{time.NewTicker(d)}
+}
+
+func (wallClock) Int63n(n int64) int64 {
+	return rand.Int63n(n)
+}
+
+type wallTimer struct {
+	t *time.Timer
+}
+
+func (t wallTimer) C() <-chan time.Time   { return t.t.C }
+func (t wallTimer) Stop() bool            { return t.t.Stop() }
+func (t wallTimer) Reset(d time.Duration) { t.t.Reset(d) }
+
+type wallTicker struct {
+	t *time.Ticker
+}
+
+func (t wallTicker) C() <-chan time.Time   { return t.t.C }
+func (t wallTicker) Stop() bool            { t.t.Stop(); return true }
+func (t wallTicker) Reset(d time.Duration) { t.t.Reset(d) }
+
+// now returns the current time of our clock.
+func (n *raft) now() time.Time {
+	if n.clock == nil {
+		return time.Now()
+	}
+	return n.clock.Now()
+}
+
+// since returns the time elapsed since t on our clock.
+func (n *raft) since(t time.Time) time.Duration {
+	return n.now().Sub(t)
+}
+
+// getClock returns our clock, the wall clock if none was injected.
+func (n *raft) getClock() raftClock {
+	if n.clock == nil {
+		return wallClock{}
+	}
+	return n.clock
+}
@@ -138,6 +138,17 @@ func (c *cluster) createMockMemRaftGroup(name string, members int, smf smFactory
 	return hub, c.createRaftGroupEx(name, members, smf, hub.newTransport, MemoryStorage)
 }
 
+// Create a mock transport raft group with leader leases enabled on all members.
+func (c *cluster) createLeasedMockMemRaftGroup(name string, members int, smf smFactory) (*raftTransportHub, smGroup) {
+	hub, rg := c.createMockMemRaftGroup(name, members, smf)
+	rg.lockAll()
+	for _, sm := range rg {
+		sm.node().(*raft).lease = true
+	}
+	rg.unlockAll()
+	return hub, rg
+}
+
 func (c *cluster) createRaftGroupEx(name string, numMembers int, smf smFactory, rtf newTransportFunc, st StorageType) smGroup {
 	c.t.Helper()
 	if numMembers > len(c.servers) {
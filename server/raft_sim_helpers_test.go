@@ -0,0 +1,656 @@
+// Copyright 2026 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// This file contains a simulated raft transport and clock for seeded cluster simulation tests.
+// The `raftSim` carries all raft traffic between the servers it is used on, and
+// can drop, delay, reorder and partition messages between servers (`setFaults`,
+// `setLinkFaults`, `partition`). Its clock is also the clock of the raft nodes, so their
+// election, heartbeat and quorum timers only fire as it advances, and their election
+// timeouts are drawn from its seeded random generator. The clock is either advanced
+// manually (`step`) or follows real time once started (`start`).
+// The fate of every message is decided by a random generator per link that is
+// seeded from the seed of the simulation, so the same seed makes the same decisions
+// for the same messages. Goroutine scheduling is not simulated, so when the clock
+// follows real time, how much work the nodes get done between ticks can differ between
+// runs. Stepping the clock manually, and letting the nodes settle between steps, replays
+// the timers, election timeouts and message fates of a seed, only the order of messages
+// sent concurrently within a step can still differ.
+// The simulation can be used for raft groups directly (`createSimRaftGroup`), or
+// for all JetStream raft groups of a cluster (`createJetStreamClusterSim`). In the
+// latter case only raft is simulated, clients and stream catchups still use the
+// routes between the servers and wall-clock time.
+
+package server
+
+import (
+	"container/heap"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var (
+	testSimSeed  int64 // Only run simulation scenarios with this seed, if set.
+	testSimSeeds = 3   // Number of seeds to run simulation scenarios with.
+)
+
+// runSimScenarios runs the scenario as a subtest for every seed.
+// Use -sim_seed to rerun a single seed, and -sim_seeds to run more of them.
+func runSimScenarios(t *testing.T, scenario func(t *testing.T, seed int64)) {
+	seeds := make([]int64, 0, testSimSeeds)
+	if testSimSeed != 0 {
+		seeds = append(seeds, testSimSeed)
+	} else {
+		for seed := int64(1); seed <= int64(testSimSeeds); seed++ {
+			seeds = append(seeds, seed)
+		}
+	}
+	for _, seed := range seeds {
+		t.Run(fmt.Sprintf("seed=%d", seed), func(t *testing.T) {
+			scenario(t, seed)
+		})
+	}
+}
+
+// simClock is the clock messages are delivered by, and the raftClock of the raft nodes
+// using the simulation, so their election, heartbeat and quorum timers fire as it advances.
+type simClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	rng    *rand.Rand
+	timers []*simTimer
+	seq    uint64
+}
+
+func newSimClock(seed int64) *simClock {
+	return &simClock{now: time.Unix(0, 0), rng: rand.New(rand.NewSource(seed))}
+}
+
+func (c *simClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *simClock) NewTimer(d time.Duration) raftTimer {
+	return c.newTimer(d, 0)
+}
+
+func (c *simClock) NewTicker(d time.Duration) raftTimer {
+	return c.newTimer(d, d)
+}
+
+func (c *simClock) Int63n(n int64) int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.rng.Int63n(n)
+}
+
+func (c *simClock) newTimer(d, period time.Duration) *simTimer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.seq++
+	t := &simTimer{clock: c, ch: make(chan time.Time, 1), at: c.now.Add(d), seq: c.seq, period: period}
+	c.timers = append(c.timers, t)
+	return t
+}
+
+// advance moves the clock forward, and fires the timers that are due in the order they are due.
+func (c *simClock) advance(d time.Duration) time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	for {
+		var next *simTimer
+		for _, t := range c.timers {
+			if t.at.After(c.now) {
+				continue
+			}
+			if next == nil || t.at.Before(next.at) || (t.at.Equal(next.at) && t.seq < next.seq) {
+				next = t
+			}
+		}
+		if next == nil {
+			return c.now
+		}
+		// Like the timers of the time package, a tick is dropped if the last one wasn't received.
+		select {
+		case next.ch <- next.at:
+		default:
+		}
+		if next.period > 0 {
+			next.at = next.at.Add(next.period)
+		} else {
+			c.remove(next)
+		}
+	}
+}
+
+// Lock should be held.
+func (c *simClock) remove(t *simTimer) bool {
+	for i, ct := range c.timers {
+		if ct == t {
+			c.timers = append(c.timers[:i], c.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// simTimer is a timer or ticker of the simClock.
+type simTimer struct {
+	clock  *simClock
+	ch     chan time.Time
+	at     time.Time
+	seq    uint64
+	period time.Duration
+}
+
+func (t *simTimer) C() <-chan time.Time {
+	return t.ch
+}
+
+func (t *simTimer) Stop() bool {
+	c := t.clock
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.remove(t)
+}
+
+func (t *simTimer) Reset(d time.Duration) {
+	c := t.clock
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.remove(t)
+	t.at = c.now.Add(d)
+	if t.period > 0 {
+		t.period = d
+	}
+	c.timers = append(c.timers, t)
+}
+
+// simFaults are applied to messages sent from one server to another.
+type simFaults struct {
+	drop     float64       // Probability a message is dropped.
+	minDelay time.Duration // Minimum delay before a message is delivered.
+	maxDelay time.Duration // Maximum delay, each message gets a random delay up to it.
+	reorder  bool          // Whether a message can overtake messages sent before it.
+}
+
+// simLink identifies the messages of a raft group from one server to another.
+type simLink struct {
+	from, to, group string
+}
+
+type simMsg struct {
+	at      time.Time
+	seq     uint64
+	from    string
+	to      *simTransport
+	subject string
+	reply   string
+	msg     []byte
+}
+
+// simMsgs is a heap of messages ordered by delivery time.
+type simMsgs []*simMsg
+
+func (h simMsgs) Len() int { return len(h) }
+func (h simMsgs) Less(i, j int) bool {
+	if h[i].at.Equal(h[j].at) {
+		return h[i].seq < h[j].seq
+	}
+	return h[i].at.Before(h[j].at)
+}
+func (h simMsgs) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *simMsgs) Push(x any)   { *h = append(*h, x.(*simMsg)) }
+func (h *simMsgs) Pop() any {
+	old := *h
+	n := len(old)
+	m := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return m
+}
+
+type raftSim struct {
+	mu         sync.Mutex
+	seed       int64
+	clock      *simClock
+	transports map[*simTransport]struct{}
+	partitions map[string]int
+	faults     simFaults
+	links      map[[2]string]simFaults
+	rngs       map[simLink]*rand.Rand
+	last       map[simLink]time.Time
+	pending    simMsgs
+	seq        uint64
+	quit       chan struct{}
+	wg         sync.WaitGroup
+
+	sent      atomic.Uint64
+	dropped   atomic.Uint64
+	delivered atomic.Uint64
+}
+
+func newRaftSim(seed int64) *raftSim {
+	return &raftSim{
+		seed:       seed,
+		clock:      newSimClock(seed),
+		transports: make(map[*simTransport]struct{}),
+		partitions: make(map[string]int),
+		links:      make(map[[2]string]simFaults),
+		rngs:       make(map[simLink]*rand.Rand),
+		last:       make(map[simLink]time.Time),
+	}
+}
+
+// newTransport is a newTransportFunc for raft nodes that should use the simulation.
+func (sim *raftSim) newTransport(s *Server, n RaftNode) raftTransport {
+	return &simTransport{sim: sim, server: s, node: n, id: n.ID(), group: n.Group()}
+}
+
+// Set the faults for all messages between servers, unless set for their link.
+func (sim *raftSim) setFaults(f simFaults) {
+	sim.mu.Lock()
+	defer sim.mu.Unlock()
+	sim.faults = f
+}
+
+// Set the faults for messages sent by one server to another.
+func (sim *raftSim) setLinkFaults(from, to string, f simFaults) {
+	sim.mu.Lock()
+	defer sim.mu.Unlock()
+	sim.links[[2]string{from, to}] = f
+}
+
+// Remove all faults, messages are delivered right away again.
+func (sim *raftSim) clearFaults() {
+	sim.mu.Lock()
+	defer sim.mu.Unlock()
+	sim.faults = simFaults{}
+	clear(sim.links)
+}
+
+// Servers assigned to different partitions can't exchange messages, messages in flight
+// between them are dropped. By default, all servers are in partition 0.
+func (sim *raftSim) partition(nodeID string, partitionID int) {
+	sim.mu.Lock()
+	defer sim.mu.Unlock()
+	sim.partitions[nodeID] = partitionID
+}
+
+// Reassign all servers to the default partition 0.
+func (sim *raftSim) healPartitions() {
+	sim.mu.Lock()
+	defer sim.mu.Unlock()
+	clear(sim.partitions)
+}
+
+// Returns the random generator deciding the fate of messages on the link.
+// Lock should be held.
+func (sim *raftSim) rng(link simLink) *rand.Rand {
+	if rng := sim.rngs[link]; rng != nil {
+		return rng
+	}
+	h := fnv.New64a()
+	h.Write([]byte(link.from + "/" + link.to + "/" + link.group))
+	rng := rand.New(rand.NewSource(sim.seed ^ int64(h.Sum64())))
+	sim.rngs[link] = rng
+	return rng
+}
+
+func (sim *raftSim) publish(st *simTransport, subject, reply string, msg []byte) {
+	sim.mu.Lock()
+	defer sim.mu.Unlock()
+
+	now := sim.clock.Now()
+	for t := range sim.transports {
+		if t == st || t.sub == nil || !t.sub.HasInterest(subject) {
+			continue
+		}
+		sim.sent.Add(1)
+		if sim.partitions[st.id] != sim.partitions[t.id] {
+			sim.dropped.Add(1)
+			continue
+		}
+		f, ok := sim.links[[2]string{st.id, t.id}]
+		if !ok {
+			f = sim.faults
+		}
+		link := simLink{st.id, t.id, st.group}
+		rng := sim.rng(link)
+		if f.drop > 0 && rng.Float64() < f.drop {
+			sim.dropped.Add(1)
+			continue
+		}
+		at := now.Add(f.minDelay)
+		if f.maxDelay > f.minDelay {
+			at = at.Add(time.Duration(rng.Int63n(int64(f.maxDelay - f.minDelay))))
+		}
+		// Unless reordering, messages on a link are delivered in the order they were sent.
+		if !f.reorder {
+			if last := sim.last[link]; at.Before(last) {
+				at = last
+			}
+			sim.last[link] = at
+		}
+		sim.seq++
+		heap.Push(&sim.pending, &simMsg{at, sim.seq, st.id, t, subject, reply, copyBytes(msg)})
+	}
+}
+
+// step advances the clock, firing the raft timers and delivering the messages that are due.
+func (sim *raftSim) step(d time.Duration) {
+	now := sim.clock.advance(d)
+
+	sim.mu.Lock()
+	var due []*simMsg
+	for len(sim.pending) > 0 && !sim.pending[0].at.After(now) {
+		m := heap.Pop(&sim.pending).(*simMsg)
+		if sim.partitions[m.from] != sim.partitions[m.to.id] {
+			sim.dropped.Add(1)
+			continue
+		}
+		due = append(due, m)
+	}
+	sim.mu.Unlock()
+
+	// Deliver without holding the lock, handlers can send messages themselves.
+	for _, m := range due {
+		sim.mu.Lock()
+		sl, acc := m.to.sub, m.to.acc
+		sim.mu.Unlock()
+		if sl == nil {
+			sim.dropped.Add(1)
+			continue
+		}
+		sim.delivered.Add(1)
+		for _, sub := range sl.Match(m.subject).psubs {
+			sub.icb(sub, nil, acc, m.subject, m.reply, m.msg)
+		}
+	}
+}
+
+// start has the clock follow real time, delivering messages every tick.
+func (sim *raftSim) start(tick time.Duration) {
+	sim.mu.Lock()
+	defer sim.mu.Unlock()
+	if sim.quit != nil {
+		return
+	}
+	sim.quit = make(chan struct{})
+	sim.wg.Add(1)
+	go func(quit chan struct{}) {
+		defer sim.wg.Done()
+		ticker := time.NewTicker(tick)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				sim.step(tick)
+			case <-quit:
+				return
+			}
+		}
+	}(sim.quit)
+}
+
+func (sim *raftSim) stop() {
+	sim.mu.Lock()
+	quit := sim.quit
+	sim.quit = nil
+	sim.mu.Unlock()
+	if quit != nil {
+		close(quit)
+		sim.wg.Wait()
+	}
+}
+
+type simTransport struct {
+	sim    *raftSim
+	server *Server
+	node   RaftNode
+	id     string
+	group  string
+	sub    *Sublist
+	acc    *Account
+}
+
+func (t *simTransport) Reset(acc *Account) {
+	t.sim.mu.Lock()
+	defer t.sim.mu.Unlock()
+	t.acc = acc
+	t.sub = NewSublist(false)
+	t.sim.transports[t] = struct{}{}
+}
+
+func (t *simTransport) Close() {
+	t.sim.mu.Lock()
+	defer t.sim.mu.Unlock()
+	delete(t.sim.transports, t)
+	t.sub = nil
+}
+
+func (t *simTransport) Node() RaftNode {
+	return t.node
+}
+
+func (t *simTransport) Account() *Account {
+	t.sim.mu.Lock()
+	defer t.sim.mu.Unlock()
+	return t.acc
+}
+
+func (t *simTransport) Publish(subject string, reply string, msg []byte) {
+	t.sim.publish(t, subject, reply, msg)
+}
+
+func (t *simTransport) Subscribe(subject string, cb msgHandler) (*subscription, error) {
+	t.sim.mu.Lock()
+	sl := t.sub
+	t.sim.mu.Unlock()
+	if sl == nil {
+		return nil, errNoInternalClient
+	}
+	sub := &subscription{subject: []byte(subject), sid: nil, icb: cb}
+	if err := sl.Insert(sub); err != nil {
+		return nil, err
+	}
+	return sub, nil
+}
+
+func (t *simTransport) Unsubscribe(sub *subscription) {
+	t.sim.mu.Lock()
+	sl := t.sub
+	t.sim.mu.Unlock()
+	if sl != nil {
+		sl.Remove(sub)
+	}
+}
+
+// Create a raft group on the first servers of the cluster that uses the simulation
+// for its transport and clock.
+func (c *cluster) createSimRaftGroup(name string, members int, sim *raftSim, smf smFactory) smGroup {
+	c.t.Helper()
+	if members > len(c.servers) {
+		c.t.Fatalf("Members > Peers: %d vs  %d", members, len(c.servers))
+	}
+	var sg smGroup
+	servers := c.servers[:members]
+	peers := serverPeerNames(servers)
+	for _, s := range servers {
+		cfg := &RaftConfig{
+			Name:         name,
+			Store:        c.t.TempDir(),
+			Log:          c.createWAL(name, MemoryStorage),
+			NewTransport: sim.newTransport,
+			Clock:        sim.clock}
+		sg = append(sg, c.createStateMachine(s, cfg, peers, smf))
+	}
+
+	// Start campaigning early to speed up bootstrap leader election.
+	sg[0].node().CampaignImmediately()
+	return sg
+}
+
+// Create a JetStream cluster that uses the simulation for all its raft groups.
+// The simulation is started, as the servers need it to elect a meta leader.
+func createJetStreamClusterSim(t *testing.T, sim *raftSim, clusterName string, numServers int) *cluster {
+	t.Helper()
+	sim.start(time.Millisecond)
+	startPorts := []int{7_222, 9_222, 11_222, 15_222}
+	portStart := startPorts[rand.Intn(len(startPorts))]
+	var routes []string
+	for cp := portStart; cp < portStart+numServers; cp++ {
+		routes = append(routes, fmt.Sprintf("nats-route://127.0.0.1:%d", cp))
+	}
+	c := &cluster{t: t, name: clusterName}
+	for cp := portStart; cp < portStart+numServers; cp++ {
+		sn := fmt.Sprintf("S-%d", cp-portStart+1)
+		conf := fmt.Sprintf(jsClusterTempl, sn, t.TempDir(), clusterName, cp, strings.Join(routes, ","))
+		o := LoadConfig(createConfFile(t, []byte(conf)))
+		o.raftTransport, o.raftClock = sim.newTransport, sim.clock
+		c.servers = append(c.servers, RunServer(o))
+		c.opts = append(c.opts, o)
+	}
+	c.checkClusterFormed()
+	c.waitOnClusterReady()
+	return c
+}
+
+// simLeaderWatch checks that raft groups never have two leaders in the same term.
+type simLeaderWatch struct {
+	mu      sync.Mutex
+	nodes   func() []RaftNode
+	leaders map[string]map[uint64]string // Group to term to leader.
+	errs    []error
+	quit    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// watchLeaders samples the state of the nodes returned by the callback until stopped.
+func watchLeaders(nodes func() []RaftNode) *simLeaderWatch {
+	w := &simLeaderWatch{nodes: nodes, leaders: make(map[string]map[uint64]string), quit: make(chan struct{})}
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		ticker := time.NewTicker(2 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				w.sample()
+			case <-w.quit:
+				return
+			}
+		}
+	}()
+	return w
+}
+
+func (w *simLeaderWatch) sample() {
+	for _, rn := range w.nodes() {
+		n, ok := rn.(*raft)
+		if !ok {
+			continue
+		}
+		// Read both under the lock, the term changes when stepping down.
+		n.RLock()
+		isLeader, group, term, id := n.State() == Leader, n.group, n.term, n.id
+		n.RUnlock()
+		if !isLeader {
+			continue
+		}
+		w.mu.Lock()
+		terms := w.leaders[group]
+		if terms == nil {
+			terms = make(map[uint64]string)
+			w.leaders[group] = terms
+		}
+		if leader, ok := terms[term]; !ok {
+			terms[term] = id
+		} else if leader != id {
+			w.errs = append(w.errs, fmt.Errorf("group %q has leaders %q and %q in term %d", group, leader, id, term))
+		}
+		w.mu.Unlock()
+	}
+}
+
+// stop stops watching, and returns the errors for all detected split brains.
+func (w *simLeaderWatch) stop() error {
+	close(w.quit)
+	w.wg.Wait()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return errors.Join(w.errs...)
+}
+
+// jsRaftNodes returns the meta, stream and consumer raft nodes of the servers.
+func jsRaftNodes(servers []*Server) []RaftNode {
+	var nodes []RaftNode
+	for _, s := range servers {
+		js := s.getJetStream()
+		if js == nil {
+			continue
+		}
+		if n := js.getMetaGroup(); n != nil {
+			nodes = append(nodes, n)
+		}
+		for _, mset := range s.globalAccount().streams() {
+			if n := mset.raftNode(); n != nil {
+				nodes = append(nodes, n)
+			}
+			for _, o := range mset.getConsumers() {
+				if n := o.raftNode(); n != nil {
+					nodes = append(nodes, n)
+				}
+			}
+		}
+	}
+	return nodes
+}
+
+// randomSimFault applies a random fault to the servers, returns a description of it.
+func randomSimFault(sim *raftSim, rng *rand.Rand, ids []string) string {
+	switch rng.Intn(4) {
+	case 0:
+		id := ids[rng.Intn(len(ids))]
+		sim.partition(id, 1)
+		return fmt.Sprintf("partition %s", id)
+	case 1:
+		f := simFaults{drop: 0.1 + rng.Float64()*0.3}
+		sim.setFaults(f)
+		return fmt.Sprintf("drop %.2f", f.drop)
+	case 2:
+		f := simFaults{maxDelay: time.Duration(1+rng.Intn(50)) * time.Millisecond, reorder: true}
+		sim.setFaults(f)
+		return fmt.Sprintf("reorder up to %v", f.maxDelay)
+	default:
+		from, to := ids[rng.Intn(len(ids))], ids[rng.Intn(len(ids))]
+		sim.setLinkFaults(from, to, simFaults{drop: 1})
+		return fmt.Sprintf("one-way loss %s -> %s", from, to)
+	}
+}
+
+// healSim removes all faults and partitions.
+func healSim(sim *raftSim) {
+	sim.clearFaults()
+	sim.healPartitions()
+}
@@ -26,6 +26,7 @@ import (
 	"path/filepath"
 	"reflect"
 	"slices"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -3759,6 +3760,209 @@ func TestNRGTrackPeerObserved(t *testing.T) {
 	require_True(t, n.LastHeardFromPeer("C").IsZero())
 }
 
+func TestNRGObservedPeerLag(t *testing.T) {
+	n := &raft{managed: true, id: "A", leader: "A", commit: 10, peers: map[string]*lps{"A": {}}}
+	n.state.Store(int32(Leader))
+
+	// Never heard from.
+	require_True(t, n.ObservedPeer("B") == nil)
+
+	require_NoError(t, n.trackPeer("B"))
+	p := n.ObservedPeer("B")
+	require_NotNil(t, p)
+	require_Equal(t, p.Lag, 10)
+	require_False(t, p.Current)
+	require_False(t, p.Last.IsZero())
+
+	// Responses of observed peers update their index, without counting towards quorum.
+	n.trackResponse(&appendEntryResponse{peer: "B", index: 10, success: true})
+	p = n.ObservedPeer("B")
+	require_Equal(t, p.Lag, 0)
+	require_True(t, p.Current)
+
+	// Only the leader knows the lag.
+	n.leader = "C"
+	p = n.ObservedPeer("B")
+	require_Equal(t, p.Lag, 0)
+	require_False(t, p.Current)
+
+	// Peers are not observed.
+	require_True(t, n.ObservedPeer("A") == nil)
+}
+
+func TestNRGInflightWindowFull(t *testing.T) {
+	n := &raft{id: "A", qn: 2, pindex: 10, maxInflight: 4, peers: map[string]*lps{"A": {}, "B": {li: 5}, "C": {li: 5}}}
+	n.asent = []uint64{6, 7, 8, 9, 10}
+
+	// Both followers have a full window in flight.
+	require_True(t, n.inflightWindowFull())
+	require_Equal(t, n.inflight(5), 5)
+
+	// One follower is enough for quorum.
+	n.peers["B"].li = 7
+	require_False(t, n.inflightWindowFull())
+
+	// No window, or nobody to wait for.
+	n.peers["B"].li = 5
+	n.maxInflight = 0
+	require_False(t, n.inflightWindowFull())
+	n.maxInflight, n.qn = 4, 1
+	require_False(t, n.inflightWindowFull())
+
+	// Followers we don't know of yet are not waited on.
+	n.qn = 2
+	n.peers = map[string]*lps{"A": {}}
+	require_False(t, n.inflightWindowFull())
+	n.peers["B"], n.peers["C"] = &lps{li: 5}, &lps{li: 5}
+
+	// Larger groups need more followers with room.
+	n.qn = 3
+	n.peers["D"], n.peers["E"] = &lps{li: 10}, &lps{li: 8}
+	require_False(t, n.inflightWindowFull())
+	n.peers["D"].li, n.peers["E"].li = 5, 5
+	n.peers["C"].li = 9
+	require_True(t, n.inflightWindowFull())
+	n.peers["B"].li = 10
+	require_False(t, n.inflightWindowFull())
+
+	// The window counts append entries, not the entries in them.
+	n.peers["B"].li = 5
+	n.asent = []uint64{8, 10}
+	require_Equal(t, n.inflight(5), 2)
+	require_False(t, n.inflightWindowFull())
+
+	// Committed append entries are no longer tracked.
+	n.asent, n.commit, n.pindex = []uint64{6, 7, 8, 9, 10}, 8, 11
+	n.trackInflightSend()
+	require_Equal(t, len(n.asent), 3)
+	require_Equal(t, n.inflight(5), 3)
+}
+
+func TestNRGHoldProposalsWhenInflightWindowFull(t *testing.T) {
+	c := createJetStreamClusterExplicit(t, "R3S", 3)
+	defer c.shutdown()
+
+	hub, rg := c.createMockMemRaftGroup("MOCK", 3, newStateAdder)
+	defer hub.healPartitions()
+
+	leader := rg.waitOnLeader()
+	n := leader.node().(*raft)
+	n.Lock()
+	n.maxInflight = 1
+	n.Unlock()
+
+	// Without responses from our followers, the first proposal fills the window,
+	// and the others are held back.
+	for _, f := range rg.followers() {
+		hub.partition(f.node().ID(), 1)
+	}
+	const proposals = 100
+	leader.(*stateAdder).proposeDelta(1)
+	checkFor(t, 2*time.Second, 10*time.Millisecond, func() error {
+		n.RLock()
+		defer n.RUnlock()
+		if n.batches.count != 1 {
+			return errors.New("first proposal not sent yet")
+		}
+		return nil
+	})
+	for range proposals - 1 {
+		leader.(*stateAdder).proposeDelta(1)
+	}
+	checkFor(t, 2*time.Second, 10*time.Millisecond, func() error {
+		if l := n.prop.len(); l != proposals-1 {
+			return fmt.Errorf("expected %d held proposals, got %d", proposals-1, l)
+		}
+		n.RLock()
+		defer n.RUnlock()
+		if n.batches.held == 0 {
+			return errors.New("proposals not held yet")
+		}
+		return nil
+	})
+	raftz := func() RaftzGroup {
+		t.Helper()
+		rz := n.s.Raftz(&RaftzOptions{AccountFilter: n.accName, GroupFilter: "MOCK"})
+		require_NotNil(t, rz)
+		return (*rz)[n.accName]["MOCK"]
+	}
+	info := raftz()
+	require_Equal(t, info.MaxInflight, 1)
+	require_Equal(t, info.Inflight, 1)
+	require_Equal(t, info.Batches.Count, 1)
+	require_True(t, info.Batches.Held > 0)
+	for _, p := range info.Peers {
+		require_Equal(t, p.Inflight, 1)
+	}
+
+	// Once our followers respond, the held proposals are coalesced.
+	hub.healPartitions()
+	for _, sm := range rg {
+		checkFor(t, 5*time.Second, 50*time.Millisecond, func() error {
+			if total := sm.(*stateAdder).total(); total != proposals {
+				return fmt.Errorf("expected total %d, got %d", proposals, total)
+			}
+			return nil
+		})
+	}
+	info = raftz()
+	require_Equal(t, info.Batches.Count, 2)
+	require_Equal(t, info.Batches.Entries, proposals)
+	require_Equal(t, info.Batches.MaxEntries, proposals-1)
+	require_Equal(t, info.Batches.AvgEntries, proposals/2)
+}
+
+func TestNRGProposalsNotHeldByDefault(t *testing.T) {
+	c := createJetStreamClusterExplicit(t, "R3S", 3)
+	defer c.shutdown()
+
+	hub, rg := c.createMockMemRaftGroup("MOCK", 3, newStateAdder)
+	defer hub.healPartitions()
+
+	leader := rg.waitOnLeader()
+	n := leader.node().(*raft)
+	n.RLock()
+	require_Equal(t, n.maxInflight, 0)
+	n.RUnlock()
+
+	// Without responses from our followers, proposals are still sent right away.
+	for _, f := range rg.followers() {
+		hub.partition(f.node().ID(), 1)
+	}
+	const proposals = 100
+	for range proposals {
+		leader.(*stateAdder).proposeDelta(1)
+	}
+	checkFor(t, 2*time.Second, 10*time.Millisecond, func() error {
+		if l := n.prop.len(); l != 0 {
+			return fmt.Errorf("expected no held proposals, got %d", l)
+		}
+		return nil
+	})
+	require_False(t, n.inflightWindowFull())
+	n.RLock()
+	held, asent := n.batches.held, len(n.asent)
+	n.RUnlock()
+	require_Equal(t, held, 0)
+	require_Equal(t, asent, 0)
+
+	rz := n.s.Raftz(&RaftzOptions{AccountFilter: n.accName, GroupFilter: "MOCK"})
+	require_NotNil(t, rz)
+	info := (*rz)[n.accName]["MOCK"]
+	require_Equal(t, info.MaxInflight, 0)
+	require_Equal(t, info.Inflight, 0)
+
+	hub.healPartitions()
+	for _, sm := range rg {
+		checkFor(t, 5*time.Second, 50*time.Millisecond, func() error {
+			if total := sm.(*stateAdder).total(); total != proposals {
+				return fmt.Errorf("expected total %d, got %d", proposals, total)
+			}
+			return nil
+		})
+	}
+}
+
 func TestNRGTrackPeerAutoAddOnlyUnmanaged(t *testing.T) {
 	n, cleanup := initSingleMemRaftNode(t)
 	defer cleanup()
@@ -8331,3 +8535,346 @@ func TestNRGRescueQuorumEmptyVotesRequireRescue(t *testing.T) {
 	n.runAsCandidate()
 	require_NotEqual(t, n.State(), Leader)
 }
+
+func TestNRGLeaseReadIndex(t *testing.T) {
+	c := createJetStreamClusterExplicit(t, "R3S", 3)
+	defer c.shutdown()
+
+	// Leases must be enabled explicitly.
+	_, rg := c.createMockMemRaftGroup("PLAIN", 3, newStateAdder)
+	leader := rg.waitOnLeader()
+	require_NotNil(t, leader)
+	_, err := leader.node().ReadIndex(time.Second)
+	require_Error(t, err, errLeaseDisabled)
+	require_False(t, leader.node().Lease())
+
+	_, rg = c.createLeasedMockMemRaftGroup("MOCK", 3, newStateAdder)
+	leader = rg.waitOnLeader()
+	require_NotNil(t, leader)
+	leader.(*stateAdder).proposeDelta(22)
+	rg.waitOnTotal(t, 22)
+
+	index, err := leader.node().ReadIndex(time.Second)
+	require_NoError(t, err)
+	_, commit, _ := leader.node().Progress()
+	require_True(t, index > 0 && index <= commit)
+	require_True(t, leader.node().Lease())
+
+	// Only the leader holds a lease.
+	for _, f := range rg.followers() {
+		require_False(t, f.node().Lease())
+		_, err = f.node().ReadIndex(time.Second)
+		require_Error(t, err, errNotLeader)
+	}
+
+	// Heartbeats don't renew the lease, so without writes it expires.
+	checkFor(t, 2*leaseTimeout(), 50*time.Millisecond, func() error {
+		if leader.node().Lease() {
+			return errors.New("lease still valid")
+		}
+		return nil
+	})
+
+	// A read renews the lease.
+	_, err = leader.node().ReadIndex(time.Second)
+	require_NoError(t, err)
+	require_True(t, leader.node().Lease())
+}
+
+func TestNRGLeaseExpiresBeforeNewLeaderElected(t *testing.T) {
+	c := createJetStreamClusterExplicit(t, "R3S", 3)
+	defer c.shutdown()
+
+	hub, rg := c.createLeasedMockMemRaftGroup("MOCK", 3, newStateAdder)
+	leader := rg.waitOnLeader()
+	require_NotNil(t, leader)
+	leader.(*stateAdder).proposeDelta(1)
+	rg.waitOnTotal(t, 1)
+	_, err := leader.node().ReadIndex(time.Second)
+	require_NoError(t, err)
+
+	// Isolate the leader, it will keep thinking it's leader for a while.
+	followers := rg.followers()
+	hub.partition(leader.node().ID(), 1)
+	defer hub.healPartitions()
+
+	// The lease of the old leader must have expired before a new leader is elected.
+	checkFor(t, 10*time.Second, 5*time.Millisecond, func() error {
+		newLeader := followers.leader()
+		if leader.node().Lease() {
+			if newLeader != nil {
+				t.Fatalf("Old leader holds a lease while %q is leader", newLeader.node().ID())
+			}
+			return errors.New("lease still valid")
+		}
+		if newLeader == nil {
+			return errors.New("no new leader yet")
+		}
+		return nil
+	})
+
+	// The old leader can't serve reads, the new leader can.
+	_, err = leader.node().ReadIndex(250 * time.Millisecond)
+	require_Error(t, err, errReadIndexTimeout, errNotLeader)
+	_, err = followers.leader().node().ReadIndex(time.Second)
+	require_NoError(t, err)
+}
+
+func TestNRGLeaseDroppedAcks(t *testing.T) {
+	c := createJetStreamClusterExplicit(t, "R3S", 3)
+	defer c.shutdown()
+
+	hub, rg := c.createLeasedMockMemRaftGroup("MOCK", 3, newStateAdder)
+	leader := rg.waitOnLeader()
+	require_NotNil(t, leader)
+	_, err := leader.node().ReadIndex(time.Second)
+	require_NoError(t, err)
+
+	// Drop all responses to the leader's append entries, followers still hear from the leader.
+	ln := leader.node().(*raft)
+	ln.RLock()
+	areply := ln.areply
+	ln.RUnlock()
+	hub.setDropMsgFilter(func(from, to, subject string) bool {
+		return subject == areply
+	})
+
+	checkFor(t, 2*leaseTimeout(), 50*time.Millisecond, func() error {
+		if leader.node().Lease() {
+			return errors.New("lease still valid")
+		}
+		return nil
+	})
+	_, err = leader.node().ReadIndex(250 * time.Millisecond)
+	require_Error(t, err, errReadIndexTimeout)
+
+	// The followers still heard from the leader, so they don't vote for another candidate.
+	followers := rg.followers()
+	fn := followers[0].node().(*raft)
+	fn.RLock()
+	term, pterm, pindex := fn.term, fn.pterm, fn.pindex
+	fn.RUnlock()
+	candidate := followers[1].node().ID()
+	require_NoError(t, fn.processVoteRequest(&voteRequest{term: term + 1, lastTerm: pterm, lastIndex: pindex, candidate: candidate, reply: "$TEST.VR"}))
+	fn.RLock()
+	require_Equal(t, fn.term, term)
+	require_NotEqual(t, fn.vote, candidate)
+	fn.RUnlock()
+
+	// Once the leader hears back, reads can be served again.
+	hub.setDropMsgFilter(nil)
+	_, err = leader.node().ReadIndex(time.Second)
+	require_NoError(t, err)
+	require_True(t, leader.node().Lease())
+}
+
+func TestNRGLeaseStepDown(t *testing.T) {
+	c := createJetStreamClusterExplicit(t, "R3S", 3)
+	defer c.shutdown()
+
+	_, rg := c.createLeasedMockMemRaftGroup("MOCK", 3, newStateAdder)
+	leader := rg.waitOnLeader()
+	require_NotNil(t, leader)
+	_, err := leader.node().ReadIndex(time.Second)
+	require_NoError(t, err)
+	require_True(t, leader.node().Lease())
+
+	// The lease is given up right away, and the followers vote for the new leader.
+	require_NoError(t, leader.node().StepDown())
+	require_False(t, leader.node().Lease())
+
+	var newLeader stateMachine
+	checkFor(t, 5*time.Second, 10*time.Millisecond, func() error {
+		if newLeader = rg.leader(); newLeader == nil || newLeader == leader {
+			return errors.New("no new leader yet")
+		}
+		return nil
+	})
+	_, err = newLeader.node().ReadIndex(time.Second)
+	require_NoError(t, err)
+	require_True(t, newLeader.node().Lease())
+}
+
+func TestNRGSimTransportFaults(t *testing.T) {
+	newPair := func(sim *raftSim) (*simTransport, *[]string) {
+		a := &simTransport{sim: sim, id: "A", group: "G"}
+		a.Reset(nil)
+		b := &simTransport{sim: sim, id: "B", group: "G"}
+		b.Reset(nil)
+		var got []string
+		_, err := b.Subscribe("foo", func(_ *subscription, _ *client, _ *Account, _, _ string, msg []byte) {
+			got = append(got, string(msg))
+		})
+		require_NoError(t, err)
+		return a, &got
+	}
+	publish := func(a *simTransport, n int) []string {
+		var sent []string
+		for i := range n {
+			sent = append(sent, strconv.Itoa(i))
+			a.Publish("foo", _EMPTY_, []byte(sent[i]))
+		}
+		return sent
+	}
+
+	t.Run("Delay", func(t *testing.T) {
+		sim := newRaftSim(1)
+		a, got := newPair(sim)
+		sim.setFaults(simFaults{minDelay: 10 * time.Millisecond})
+		publish(a, 1)
+		sim.step(5 * time.Millisecond)
+		require_Len(t, len(*got), 0)
+		sim.step(5 * time.Millisecond)
+		require_Len(t, len(*got), 1)
+	})
+
+	t.Run("Reorder", func(t *testing.T) {
+		sim := newRaftSim(1)
+		a, got := newPair(sim)
+		sim.setFaults(simFaults{maxDelay: 50 * time.Millisecond})
+		sent := publish(a, 100)
+		sim.step(50 * time.Millisecond)
+		require_True(t, slices.Equal(*got, sent))
+
+		*got = nil
+		sim.setFaults(simFaults{maxDelay: 50 * time.Millisecond, reorder: true})
+		sent = publish(a, 100)
+		sim.step(50 * time.Millisecond)
+		require_Len(t, len(*got), 100)
+		require_False(t, slices.Equal(*got, sent))
+	})
+
+	t.Run("Drop", func(t *testing.T) {
+		run := func(seed int64) []string {
+			sim := newRaftSim(seed)
+			a, got := newPair(sim)
+			sim.setFaults(simFaults{drop: 0.5})
+			publish(a, 1000)
+			sim.step(0)
+			require_True(t, len(*got) > 0 && len(*got) < 1000)
+			require_Equal(t, sim.dropped.Load()+sim.delivered.Load(), 1000)
+			return *got
+		}
+		// The same seed drops the same messages.
+		require_True(t, slices.Equal(run(1), run(1)))
+		require_False(t, slices.Equal(run(1), run(2)))
+	})
+
+	t.Run("Partition", func(t *testing.T) {
+		sim := newRaftSim(1)
+		a, got := newPair(sim)
+		sim.setFaults(simFaults{minDelay: 10 * time.Millisecond})
+		publish(a, 1)
+		// Messages in flight are dropped as well.
+		sim.partition("B", 1)
+		sim.step(10 * time.Millisecond)
+		publish(a, 1)
+		sim.step(10 * time.Millisecond)
+		require_Len(t, len(*got), 0)
+
+		sim.healPartitions()
+		publish(a, 1)
+		sim.step(10 * time.Millisecond)
+		require_Len(t, len(*got), 1)
+	})
+}
+
+func TestNRGSimScenarios(t *testing.T) {
+	c := createJetStreamClusterExplicit(t, "R3S", 3)
+	defer c.shutdown()
+
+	runSimScenarios(t, func(t *testing.T, seed int64) {
+		sim := newRaftSim(seed)
+		sim.start(time.Millisecond)
+		defer sim.stop()
+
+		rg := c.createSimRaftGroup(fmt.Sprintf("SIM%d", seed), 3, sim, newStateAdder)
+		defer func() {
+			for _, sm := range rg {
+				sm.node().Stop()
+			}
+		}()
+		require_NotNil(t, rg.waitOnLeader())
+		w := watchLeaders(func() []RaftNode {
+			var nodes []RaftNode
+			for _, sm := range rg {
+				nodes = append(nodes, sm.node())
+			}
+			return nodes
+		})
+
+		rng := rand.New(rand.NewSource(seed))
+		ids := serverPeerNames(c.servers)
+		for round := range 3 {
+			t.Logf("Round %d: %s", round, randomSimFault(sim, rng, ids))
+			for deadline := time.Now().Add(time.Duration(500+rng.Intn(2000)) * time.Millisecond); time.Now().Before(deadline); {
+				rg[rng.Intn(len(rg))].(*stateAdder).proposeDelta(1)
+				time.Sleep(10 * time.Millisecond)
+			}
+			healSim(sim)
+		}
+
+		// Once healed, all members must end up with the same state.
+		require_NotNil(t, rg.waitOnLeader())
+		rg.leader().(*stateAdder).proposeDelta(1)
+		checkFor(t, 10*time.Second, 50*time.Millisecond, func() error {
+			expected := rg[0].(*stateAdder).total()
+			for _, sm := range rg[1:] {
+				if total := sm.(*stateAdder).total(); total != expected {
+					return fmt.Errorf("adder on %v has total %d, expected %d", sm.server(), total, expected)
+				}
+			}
+			if expected == 0 {
+				return errors.New("nothing applied")
+			}
+			return nil
+		})
+		require_NoError(t, w.stop())
+	})
+}
+
+func TestNRGSimClockDrivesTimers(t *testing.T) {
+	c := createJetStreamClusterExplicit(t, "R3S", 3)
+	defer c.shutdown()
+
+	sim := newRaftSim(1)
+	rg := c.createSimRaftGroup("SIMCLOCK", 3, sim, newStateAdder)
+	defer func() {
+		for _, sm := range rg {
+			sm.node().Stop()
+		}
+	}()
+
+	// Advance the clock in small steps, giving the nodes real time to process what's due.
+	stepUntil := func(max time.Duration, done func() bool) {
+		t.Helper()
+		for elapsed := time.Duration(0); !done(); elapsed += 10 * time.Millisecond {
+			if elapsed > max {
+				t.Fatalf("Not done after %v of simulated time", max)
+			}
+			sim.step(10 * time.Millisecond)
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	// Without the clock advancing, nobody campaigns.
+	time.Sleep(maxCampaignTimeout + 100*time.Millisecond)
+	require_True(t, rg.leader() == nil)
+	stepUntil(maxElectionTimeout, func() bool { return rg.leader() != nil })
+	leader := rg.leader()
+
+	// With the leader partitioned, the followers only elect a new one as the clock advances.
+	sim.partition(leader.node().ID(), 1)
+	time.Sleep(maxElectionTimeout)
+	for _, sm := range rg {
+		require_True(t, sm == leader || !sm.node().Leader())
+	}
+	stepUntil(2*maxElectionTimeout, func() bool {
+		for _, sm := range rg {
+			if sm != leader && sm.node().Leader() {
+				return true
+			}
+		}
+		return false
+	})
+}
@@ -13,10 +13,10 @@
 
 // This file contains mock raft transport implementations and helper functions
 // for testing. The `raftTransportHub` manages multiple `mockTransport` instances,
-// allowing for the simulation of network partitions (`partition`, `heal`)
-// and message interception (`setAfterMsgHook`). This setup is used to test
-// raft interactions without actual network communication, providing control
-// over message delivery and network conditions.
+// allowing for the simulation of network partitions (`partition`, `heal`),
+// message loss (`setDropMsgFilter`) and message interception (`setAfterMsgHook`).
+// This setup is used to test raft interactions without actual network
+// communication, providing control over message delivery and network conditions.
 
 package server
 
@@ -26,11 +26,14 @@ import (
 
 type msgHook func(subject, reply string, msg []byte)
 
+type msgFilter func(from, to, subject string) bool
+
 type raftTransportHub struct {
 	mu         sync.Mutex
 	transports map[string]*mockTransport
 	partitions map[string]int
 	afterMsg   msgHook
+	dropMsg    msgFilter
 }
 
 func newRaftTransportHub() *raftTransportHub {
@@ -96,6 +99,17 @@ func (h *raftTransportHub) setAfterMsgHook(hook msgHook) {
 	h.afterMsg = hook
 }
 
+// Set a filter that is called for every message before it is delivered from
+// one node to another. If the filter returns true the message is dropped,
+// simulating message loss between specific nodes, e.g. only for responses.
+// The filter is called with the raftTransportHub locked, so it must not
+// interact with the raftTransportHub. Set to nil to deliver all messages.
+func (h *raftTransportHub) setDropMsgFilter(filter msgFilter) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.dropMsg = filter
+}
+
 func (h *raftTransportHub) publish(t *mockTransport, subject, reply string, msg []byte) {
 	h.mu.Lock()
 	afterMsgHook := h.afterMsg
@@ -111,6 +125,10 @@ func (h *raftTransportHub) publish(t *mockTransport, subject, reply string, msg
 			continue
 		}
 
+		if h.dropMsg != nil && h.dropMsg(sender, id, subject) {
+			continue
+		}
+
 		res := transport.sub.Match(subject)
 		for _, sub := range res.psubs {
 			sub.icb(sub, nil, transport.acc, subject, reply, msg)
@@ -1569,6 +1569,7 @@ func imposeOrder(value any) error {
 		// explicitly skipped types
 	case *AuthCallout:
 	case JSTpmOpts:
+	case JSColdTierOpts:
 	default:
 		// this will fail during unit tests
 		return fmt.Errorf("OnReload, sort or explicitly skip type: %s",
@@ -1873,6 +1874,30 @@ func (s *Server) diffOptions(newOpts *Options) ([]option, error) {
 			} else {
 				newOpts.JetStreamConcurrentIOs = oldValue.(int)
 			}
+		case "jetstreamraftmaxinflight":
+			// Not reloadable at runtime, Raft nodes pick it up when created.
+			if newOpts.JetStream {
+				return nil, fmt.Errorf("config reload not supported for %s: old=%v, new=%v",
+					field.Name, oldValue, newValue)
+			} else {
+				newOpts.JetStreamRaftMaxInflight = oldValue.(int)
+			}
+		case "jetstreamscrubrate":
+			// Not reloadable at runtime, the scrubber is started with JetStream.
+			if newOpts.JetStream {
+				return nil, fmt.Errorf("config reload not supported for %s: old=%v, new=%v",
+					field.Name, oldValue, newValue)
+			} else {
+				newOpts.JetStreamScrubRate = oldValue.(int64)
+			}
+		case "jetstreamcoldtier":
+			// Not reloadable at runtime, stores pick up the cold tier when created.
+			if newOpts.JetStream {
+				return nil, fmt.Errorf("config reload not supported for %s: old=%v, new=%v",
+					field.Name, oldValue, newValue)
+			} else {
+				newOpts.JetStreamColdTier = oldValue.(JSColdTierOpts)
+			}
 		case "websocket":
 			// Similar to gateways
 			tmpOld := oldValue.(WebsocketOpts)
@@ -22,6 +22,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/nats-io/nats-server/v2/server/avl"
 	"github.com/nats-io/nats-server/v2/server/thw"
 )
 
@@ -381,3 +382,108 @@ func parseMsgSchedule(pattern string, loc *time.Location, ts int64) (time.Time,
 	}
 	return next, true, true
 }
+
+// msgDelays tracks messages a consumer is holding back until their
+// Nats-Delay or Nats-Deliver-At time is reached.
+// Not safe for concurrent use, the owner's lock must be held.
+type msgDelays struct {
+	run   func()
+	wheel *thw.HashWheel
+	timer *time.Timer
+	seqs  map[uint64]int64
+	due   avl.SequenceSet
+}
+
+func newMsgDelays(run func()) *msgDelays {
+	return &msgDelays{
+		run:   run,
+		wheel: thw.NewHashWheel(),
+		seqs:  make(map[uint64]int64),
+	}
+}
+
+// add holds back the message until the given timestamp.
+func (md *msgDelays) add(seq uint64, deliverAt int64) {
+	if ts, ok := md.seqs[seq]; ok {
+		md.wheel.Remove(seq, ts)
+	}
+	md.wheel.Add(seq, deliverAt)
+	md.seqs[seq] = deliverAt
+	md.resetTimer()
+}
+
+// remove stops holding back the message, for example when it was acked or removed.
+func (md *msgDelays) remove(seq uint64) {
+	if md == nil {
+		return
+	}
+	if ts, ok := md.seqs[seq]; ok {
+		md.wheel.Remove(seq, ts)
+		delete(md.seqs, seq)
+	}
+	md.due.Delete(seq)
+}
+
+// isDelayed returns whether the message is still being held back, or is due but not delivered yet.
+func (md *msgDelays) isDelayed(seq uint64) bool {
+	if md == nil {
+		return false
+	}
+	_, ok := md.seqs[seq]
+	return ok || md.due.Exists(seq)
+}
+
+// len returns the number of messages being held back, or due but not delivered yet.
+func (md *msgDelays) len() int {
+	if md == nil {
+		return 0
+	}
+	return len(md.seqs) + md.due.Size()
+}
+
+// expire calls cb for all messages that are due, and no longer holds them back.
+func (md *msgDelays) expire(cb func(seq uint64)) {
+	md.wheel.ExpireTasks(func(seq uint64, _ int64) bool {
+		delete(md.seqs, seq)
+		cb(seq)
+		return true
+	})
+	md.resetTimer()
+}
+
+// queueDue queues up a message that is due, it will be delivered as its first delivery.
+func (md *msgDelays) queueDue(seq uint64) {
+	md.due.Insert(seq)
+}
+
+// nextDue returns the oldest message that is due, and takes it off the queue.
+// Returns 0 if no messages are due.
+func (md *msgDelays) nextDue() uint64 {
+	if md == nil || md.due.IsEmpty() {
+		return 0
+	}
+	seq, _ := md.due.MinMax()
+	md.due.Delete(seq)
+	return seq
+}
+
+func (md *msgDelays) resetTimer() {
+	next := md.wheel.GetNextExpiration(math.MaxInt64)
+	if next == math.MaxInt64 {
+		clearTimer(&md.timer)
+		return
+	}
+	fireIn := max(time.Until(time.Unix(0, next)), 0)
+	if md.timer != nil {
+		md.timer.Reset(fireIn)
+	} else {
+		md.timer = time.AfterFunc(fireIn, md.run)
+	}
+}
+
+// stop stops the timer, messages will no longer be released.
+func (md *msgDelays) stop() {
+	if md != nil {
+		clearTimer(&md.timer)
+	}
+}
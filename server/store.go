@@ -107,6 +107,7 @@ type StreamStore interface {
 	LoadPrevMsgMulti(sl *gsl.SimpleSublist, start uint64, smp *StoreMsg) (sm *StoreMsg, skip uint64, err error)
 	RemoveMsg(seq uint64) (bool, error)
 	EraseMsg(seq uint64) (bool, error)
+	RedactMsg(seq uint64, hdr []byte) (bool, error)
 	Purge() (uint64, error)
 	PurgeEx(subject string, seq, keep uint64) (uint64, error)
 	Compact(seq uint64) (uint64, error)
@@ -132,7 +133,8 @@ type StreamStore interface {
 	RegisterStorageRemoveMsg(StorageRemoveMsgHandler)
 	RegisterProcessJetStreamMsg(ProcessJetStreamMsgHandler)
 	UpdateConfig(cfg *StreamConfig) error
-	Ready() // Only needed if store started in recovering mode.
+	HoldUpTo(seq uint64) // Messages up to and including seq are not removed by limits.
+	Ready()              // Only needed if store started in recovering mode.
 	Delete(inline bool) error
 	Stop() error
 	ConsumerStore(name string, created time.Time, cfg *ConsumerConfig) (ConsumerStore, error)
@@ -170,18 +172,36 @@ const (
 
 // StreamState is information about the given stream.
 type StreamState struct {
-	Msgs        uint64            `json:"messages"`
-	Bytes       uint64            `json:"bytes"`
-	FirstSeq    uint64            `json:"first_seq"`
-	FirstTime   time.Time         `json:"first_ts"`
-	LastSeq     uint64            `json:"last_seq"`
-	LastTime    time.Time         `json:"last_ts"`
-	NumSubjects int               `json:"num_subjects,omitempty"`
-	Subjects    map[string]uint64 `json:"subjects,omitempty"`
-	NumDeleted  int               `json:"num_deleted,omitempty"`
-	Deleted     []uint64          `json:"deleted,omitempty"`
-	Lost        *LostStreamData   `json:"lost,omitempty"`
-	Consumers   int               `json:"consumer_count"`
+	Msgs           uint64            `json:"messages"`
+	Bytes          uint64            `json:"bytes"`
+	FirstSeq       uint64            `json:"first_seq"`
+	FirstTime      time.Time         `json:"first_ts"`
+	LastSeq        uint64            `json:"last_seq"`
+	LastTime       time.Time         `json:"last_ts"`
+	NumSubjects    int               `json:"num_subjects,omitempty"`
+	Subjects       map[string]uint64 `json:"subjects,omitempty"`
+	NumDeleted     int               `json:"num_deleted,omitempty"`
+	Deleted        []uint64          `json:"deleted,omitempty"`
+	Lost           *LostStreamData   `json:"lost,omitempty"`
+	Consumers      int               `json:"consumer_count"`
+	RateLimited    uint64            `json:"rate_limited,omitempty"`
+	SchemaRejected uint64            `json:"schema_rejected,omitempty"`
+	ColdBytes      uint64            `json:"cold_bytes,omitempty"`
+	// Compaction reports the progress of last value compaction, if enabled.
+	Compaction *StreamCompactionState `json:"compaction,omitempty"`
+}
+
+// StreamCompactionState reports the progress of last value compaction.
+type StreamCompactionState struct {
+	// Seq is the sequence up to which the stream was compacted by the last completed run.
+	Seq uint64 `json:"seq"`
+	// Msgs and Bytes removed by compaction since the stream was loaded.
+	Msgs  uint64 `json:"messages"`
+	Bytes uint64 `json:"bytes"`
+	// Tombstones is the number of delete markers removed after the tombstone age.
+	Tombstones uint64 `json:"tombstones,omitempty"`
+	// Last is when the last run completed.
+	Last time.Time `json:"last,omitempty"`
 }
 
 // SimpleState for filtered subject specific state.
@@ -249,6 +269,14 @@ type StreamReplicatedState struct {
 	// streamStateVersionSources and above. It can't be derived from the messages
 	// alone, since it outlives the messages it was collected from.
 	Sources map[string]StreamSourceState
+	// Views are the stream's open views, only present in clustered snapshots
+	// of streams with open views, see stream_view.go.
+	Views []StreamViewInfo
+	// Decisions of transactions coordinated by the stream, only present in clustered
+	// snapshots of streams that keep any, see jetstream_batching_txn.go.
+	txnDecisions []*batchTxnDecision
+	// Prepared batch of a transaction not yet resolved, only present in clustered snapshots.
+	txnPrepared *batchTxnPrepared
 }
 
 // Determine if this is an encoded stream state.
@@ -1603,3 +1603,37 @@ func TestStoreSourcesOnlyTracksConfiguredSources(t *testing.T) {
 		},
 	)
 }
+
+func TestStoreHoldUpTo(t *testing.T) {
+	testAllStoreAllPermutations(
+		t, false,
+		StreamConfig{Name: "zzz", Subjects: []string{"foo.*"}, MaxMsgs: 5, MaxMsgsPer: 3},
+		func(t *testing.T, fs StreamStore) {
+			for i := 1; i <= 4; i++ {
+				_, _, err := fs.StoreMsg(fmt.Sprintf("foo.%d", i), nil, nil, 0)
+				require_NoError(t, err)
+			}
+			fs.HoldUpTo(2)
+
+			// Held messages are the oldest, so limits can't remove anything.
+			for i := 5; i <= 8; i++ {
+				_, _, err := fs.StoreMsg(fmt.Sprintf("foo.%d", i), nil, nil, 0)
+				require_NoError(t, err)
+			}
+			for range 4 {
+				_, _, err := fs.StoreMsg("foo.1", nil, nil, 0)
+				require_NoError(t, err)
+			}
+			state := fs.State()
+			require_Equal(t, state.Msgs, 12)
+			require_Equal(t, state.FirstSeq, 1)
+
+			// Releasing the hold enforces the limits again.
+			fs.HoldUpTo(0)
+			state = fs.State()
+			require_Equal(t, state.Msgs, 4)
+			require_Equal(t, state.FirstSeq, 8)
+			require_Equal(t, fs.SubjectsTotals("foo.1")["foo.1"], 3)
+		},
+	)
+}
@@ -16,6 +16,8 @@ package server
 import (
 	"archive/tar"
 	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -35,6 +37,7 @@ import (
 
 	"github.com/antithesishq/antithesis-sdk-go/assert"
 	"github.com/klauspost/compress/s2"
+	"github.com/nats-io/nats-server/v2/server/avl"
 	"github.com/nats-io/nats-server/v2/server/gsl"
 	"github.com/nats-io/nuid"
 )
@@ -71,6 +74,15 @@ type StreamConfig struct {
 	Compression  StoreCompression `json:"compression"`
 	FirstSeq     uint64           `json:"first_seq,omitempty"`
 
+	// CompressionLevel is the zstd compression level, from 1 (fastest) to 22 (best ratio).
+	// Zero uses the default level. The levels map to the four levels of the zstd encoder:
+	// 1-2 fastest, 3-5 default, 6-9 better and 10-22 best compression.
+	CompressionLevel int `json:"compression_level,omitempty"`
+
+	// ColdTierAge is how long a message block needs to be idle before it's offloaded to the
+	// configured cold tier. Only applies to file storage, zero keeps all blocks local.
+	ColdTierAge time.Duration `json:"cold_tier_age,omitempty"`
+
 	// Allow applying a subject transform to incoming messages before doing anything else
 	SubjectTransform *SubjectTransformConfig `json:"subject_transform,omitempty"`
 
@@ -85,6 +97,25 @@ type StreamConfig struct {
 	// Allow KV like semantics to also discard new on a per subject basis
 	DiscardNewPer bool `json:"discard_new_per_subject,omitempty"`
 
+	// IngestRateLimit optionally limits the rate at which the stream accepts new messages.
+	IngestRateLimit *StreamIngestRateLimit `json:"ingest_rate_limit,omitempty"`
+
+	// Schemas optionally validate message payloads before they are stored.
+	Schemas []*StreamSchema `json:"schemas,omitempty"`
+
+	// ContentDedupe enables duplicate detection based on the message contents
+	// for messages without a Nats-Msg-Id, within the Duplicates window.
+	ContentDedupe *StreamContentDedupe `json:"content_dedupe,omitempty"`
+
+	// Compaction enables last value compaction of older messages. File storage only.
+	Compaction *StreamCompaction `json:"compaction,omitempty"`
+
+	// Partitions splits the stream into a number of partitions, each with its own raft group.
+	// Messages are assigned to a partition based on a hash of their subject. Clustered only.
+	Partitions int `json:"partitions,omitempty"`
+	// Partition is the index of this partition, set by the server for the underlying streams.
+	Partition int `json:"partition,omitempty"`
+
 	// Optional qualifiers. These can not be modified after set to true.
 
 	// Sealed will seal a stream so no messages can get out or in.
@@ -119,6 +150,28 @@ type StreamConfig struct {
 	// AllowMsgSchedules allows the scheduling of messages.
 	AllowMsgSchedules bool `json:"allow_msg_schedules,omitempty"`
 
+	// AllowMsgDelay allows header initiated delayed delivery of messages to consumers.
+	AllowMsgDelay bool `json:"allow_msg_delay,omitempty"`
+
+	// AllowMsgPriority allows header initiated priority levels, used by consumers delivering by priority.
+	AllowMsgPriority bool `json:"allow_msg_priority,omitempty"`
+
+	// ConsumerSubjectPermissions restricts the filter subjects of consumers, and of streams sourcing from
+	// this stream, to the subjects the requesting user is allowed to subscribe to.
+	ConsumerSubjectPermissions bool `json:"consumer_subject_permissions,omitempty"`
+
+	// LinearizableReads has the stream leader serve info and message get requests under a
+	// leader lease, so reads never return stale data from a leader that was replaced.
+	LinearizableReads bool `json:"linearizable_reads,omitempty"`
+
+	// Learners is the number of non-voting replicas. Learners receive the stream and can serve
+	// direct gets, but don't count towards quorum. Can be promoted to a voting replica.
+	Learners int `json:"learners,omitempty"`
+
+	// LearnerPlacement is used to place the learners, the placement of the stream is used if not set.
+	// Learners are placed in the cluster of the stream, unless a cluster is set here.
+	LearnerPlacement *Placement `json:"learner_placement,omitempty"`
+
 	// PersistMode allows to opt-in to different persistence mode settings.
 	PersistMode PersistModeType `json:"persist_mode,omitempty"`
 
@@ -137,6 +190,10 @@ func (cfg *StreamConfig) clone() *StreamConfig {
 		placement := *cfg.Placement
 		clone.Placement = &placement
 	}
+	if cfg.LearnerPlacement != nil {
+		placement := *cfg.LearnerPlacement
+		clone.LearnerPlacement = &placement
+	}
 	if cfg.Mirror != nil {
 		mirror := *cfg.Mirror
 		clone.Mirror = &mirror
@@ -156,6 +213,31 @@ func (cfg *StreamConfig) clone() *StreamConfig {
 		rePublish := *cfg.RePublish
 		clone.RePublish = &rePublish
 	}
+	if cfg.IngestRateLimit != nil {
+		ingestRateLimit := *cfg.IngestRateLimit
+		ingestRateLimit.Subjects = slices.Clone(cfg.IngestRateLimit.Subjects)
+		clone.IngestRateLimit = &ingestRateLimit
+	}
+	if cfg.ContentDedupe != nil {
+		clone.ContentDedupe = &StreamContentDedupe{Headers: slices.Clone(cfg.ContentDedupe.Headers)}
+	}
+	if cfg.Compaction != nil {
+		compaction := *cfg.Compaction
+		clone.Compaction = &compaction
+	}
+	if cfg.Schemas != nil {
+		clone.Schemas = make([]*StreamSchema, len(cfg.Schemas))
+		for i, schema := range cfg.Schemas {
+			if schema == nil {
+				continue
+			}
+			clone.Schemas[i] = &StreamSchema{
+				Subjects:   slices.Clone(schema.Subjects),
+				Type:       schema.Type,
+				Definition: slices.Clone(schema.Definition),
+			}
+		}
+	}
 	if cfg.Metadata != nil {
 		clone.Metadata = make(map[string]string, len(cfg.Metadata))
 		for k, v := range cfg.Metadata {
@@ -183,6 +265,36 @@ type RePublish struct {
 	HeadersOnly bool   `json:"headers_only,omitempty"`
 }
 
+// StreamIngestRateLimit is a token bucket limit on the rate of messages published into a stream.
+// Messages over the limit are rejected when the stream uses DiscardNew, and silently dropped otherwise.
+// Messages received from mirrors or sources, and batch publishes, are not subject to this limit.
+type StreamIngestRateLimit struct {
+	// MaxMsgsPerSec is the maximum rate of messages for the stream as a whole.
+	MaxMsgsPerSec uint64 `json:"max_msgs_per_sec,omitempty"`
+	// MaxMsgsPerSubjectPerSec is the maximum rate of messages for each individual subject.
+	MaxMsgsPerSubjectPerSec uint64 `json:"max_msgs_per_subject_per_sec,omitempty"`
+	// Subjects restricts the per subject limit to subjects matching these filters. All subjects if empty.
+	Subjects []string `json:"subjects,omitempty"`
+	// Burst is the number of messages that may be accepted at once, defaults to the per second rate.
+	Burst uint64 `json:"burst,omitempty"`
+}
+
+// StreamContentDedupe configures duplicate detection on a hash of the message subject and payload.
+type StreamContentDedupe struct {
+	// Headers whose values are included in the hash, in addition to the subject and payload.
+	Headers []string `json:"headers,omitempty"`
+}
+
+// StreamCompaction configures last value compaction. Messages are kept with their full history
+// for the dirty age, after which only the last message for each subject is kept.
+type StreamCompaction struct {
+	// DirtyAge is how long messages are kept before they are compacted.
+	DirtyAge time.Duration `json:"dirty_age"`
+	// TombstoneAge is how long delete markers are kept once they are the last message for
+	// their subject, after which they are removed as well. Zero keeps them.
+	TombstoneAge time.Duration `json:"tombstone_age,omitempty"`
+}
+
 // PersistModeType determines what persistence mode the stream uses.
 type PersistModeType int
 
@@ -349,6 +461,9 @@ type StreamInfo struct {
 	Mirror     *StreamSourceInfo   `json:"mirror,omitempty"`
 	Sources    []*StreamSourceInfo `json:"sources,omitempty"`
 	Alternates []StreamAlternate   `json:"alternates,omitempty"`
+	// Partitions holds the state of each partition of a partitioned stream.
+	// State is aggregated across all partitions in that case.
+	Partitions []*StreamPartitionInfo `json:"partitions,omitempty"`
 	// TimeStamp indicates when the info was gathered
 	TimeStamp time.Time `json:"ts"`
 }
@@ -376,6 +491,7 @@ type ClusterInfo struct {
 	SystemAcc   bool                `json:"system_account,omitempty"`
 	TrafficAcc  string              `json:"traffic_account,omitempty"`
 	Replicas    []*PeerInfo         `json:"replicas,omitempty"`
+	Learners    []*PeerInfo         `json:"learners,omitempty"`
 	Desired     *DesiredClusterInfo `json:"desired,omitempty"`
 }
 
@@ -553,6 +669,13 @@ type stream struct {
 	// observe a prefix of an inflight batch.
 	isolateMu sync.RWMutex
 
+	// Set by the leader while a batch is prepared as part of a transaction, and closed once resolved.
+	// Writes from outside the ingest loop (sources, purges and deletes) wait for it without holding
+	// any lock, and hold txnMu read locked while writing, so the consistency checks of the prepared
+	// batch still hold when committing. The wait is bounded by maxBatchTxnWait.
+	txnMu   sync.RWMutex
+	txnGate chan struct{}
+
 	// The current last subscription ID for the subscriptions through `client`.
 	// Those subscriptions are for the subjects filters being listened to and captured by the stream.
 	sid atomic.Uint64
@@ -610,6 +733,40 @@ type stream struct {
 	// For republishing.
 	tr *subjectTransform
 
+	// For the optional ingest rate limit, only enforced by the leader.
+	irl atomic.Pointer[ingestLimiter]
+
+	// For the optional schema validation, only enforced by the leader.
+	schemas atomic.Pointer[streamSchemas]
+
+	// For the optional content based deduplication.
+	cdd atomic.Pointer[StreamContentDedupe]
+
+	// Partition of a partitioned stream, only set for partitioned streams.
+	part atomic.Pointer[streamPartitioner]
+
+	// Open point-in-time views, see stream_view.go.
+	viewsMu sync.Mutex
+	views   map[string]*streamView
+
+	// Decisions of transactions coordinated by this stream, and our prepared batch until resolved,
+	// see jetstream_batching_txn.go. Taken after txnMu if both are needed.
+	txnDecMu     sync.Mutex
+	txnDecisions map[string]*batchTxnDecision
+	txnPrep      *batchTxnPrepared
+	txnPrepWait  *batchTxnPrepared // Proposed by us as the leader, until applied.
+	txnResolving bool              // Our prepared batch is being resolved.
+
+	// Sequences of redacted messages, replayed to mirrors and sources, see stream_redact.go.
+	redactMu   sync.Mutex
+	redacted   *avl.SequenceSet
+	redactSnap atomic.Bool // Snapshot to compact the original payload out of the log.
+
+	// Direct gets waiting for their minimum last sequence, see stream_direct_wait.go.
+	dgwMu     sync.Mutex
+	dgWaits   map[*directGetWait]struct{}
+	dgWaiting atomic.Int32
+
 	// For processing consumers without main stream lock.
 	clsMu sync.RWMutex
 	cList []*consumer                    // Consumer list.
@@ -632,6 +789,7 @@ type stream struct {
 	catchup   atomic.Bool       // Used to signal we are in catchup mode.
 	catchups  map[string]uint64 // The number of messages that need to be caught per peer.
 	syncSub   *subscription     // Internal subscription for sync messages (on "$JSC.SYNC").
+	dgSub     *subscription     // Internal subscription for direct gets forwarded to the leader.
 	infoSub   *subscription     // Internal subscription for stream info requests.
 	clMu      sync.Mutex        // The mutex for clseq and clfs.
 	clseq     uint64            // The current last seq being proposed to the NRG layer.
@@ -742,12 +900,17 @@ const (
 	JSBatchId                 = "Nats-Batch-Id"
 	JSBatchSeq                = "Nats-Batch-Sequence"
 	JSBatchCommit             = "Nats-Batch-Commit"
+	JSBatchTxn                = "Nats-Batch-Txn"
+	JSBatchTxnStreams         = "Nats-Batch-Txn-Streams"
 	JSSchedulePattern         = "Nats-Schedule"
 	JSScheduleTimeZone        = "Nats-Schedule-Time-Zone"
 	JSScheduleTTL             = "Nats-Schedule-TTL"
 	JSScheduleRollup          = "Nats-Schedule-Rollup"
 	JSScheduleTarget          = "Nats-Schedule-Target"
 	JSScheduleSource          = "Nats-Schedule-Source"
+	JSMessageDelay            = "Nats-Delay"
+	JSMessageDeliverAt        = "Nats-Deliver-At"
+	JSMessagePriority         = "Nats-Priority"
 )
 
 // Headers for published KV messages.
@@ -774,6 +937,26 @@ const (
 	JSUpToSequence = "Nats-UpTo-Sequence"
 )
 
+// Headers for dead-lettered messages, next to the republished message headers.
+const (
+	JSDeadLetterConsumer   = "Nats-Dead-Letter-Consumer"
+	JSDeadLetterDeliveries = "Nats-Dead-Letter-Deliveries"
+	JSDeadLetterCause      = "Nats-Dead-Letter-Cause"
+	JSDeadLetterReason     = "Nats-Dead-Letter-Reason" // Last NAK reason, or the AckTerm reason.
+)
+
+// Headers for redacted messages.
+const (
+	JSRedacted        = "Nats-Redacted"         // Time the message was redacted.
+	JSRedactedHeaders = "Nats-Redacted-Headers" // Headers removed by the redaction.
+)
+
+// Causes for dead-lettering a message.
+const (
+	JSDeadLetterCauseMaxDeliveries = "MaxDeliveries"
+	JSDeadLetterCauseTerminated    = "Terminated"
+)
+
 // Rollups, can be subject only or all messages.
 const (
 	JSMsgRollupSubject = "sub"
@@ -981,7 +1164,7 @@ func (a *Account) addStreamWithAssignmentAndMode(config *StreamConfig, fsConfig
 
 	// Check for overlapping subjects with other streams.
 	// These are not allowed for now.
-	if jsa.subjectsOverlap(cfg.Subjects, nil) {
+	if jsa.subjectsOverlap(cfg, nil) {
 		jsa.mu.Unlock()
 		return nil, NewJSStreamSubjectOverlapError()
 	}
@@ -1054,6 +1237,30 @@ func (a *Account) addStreamWithAssignmentAndMode(config *StreamConfig, fsConfig
 		mset.itr = tr
 	}
 
+	// Check for an ingest rate limit.
+	mset.irl.Store(newIngestLimiter(cfg.IngestRateLimit))
+
+	// Check for content based deduplication.
+	mset.cdd.Store(cfg.ContentDedupe)
+
+	// Check for partitioning.
+	if cfg.Partitions > 1 {
+		if p, err := newStreamPartitioner(cfg); err != nil {
+			jsa.mu.Unlock()
+			return nil, fmt.Errorf("stream partition: %w", err)
+		} else {
+			mset.part.Store(p)
+		}
+	}
+
+	// Check for schemas.
+	if schemas, err := newStreamSchemas(cfg.Schemas); err != nil {
+		jsa.mu.Unlock()
+		return nil, fmt.Errorf("stream schemas: %w", err)
+	} else {
+		mset.schemas.Store(schemas)
+	}
+
 	// Check for RePublish.
 	if cfg.RePublish != nil {
 		tr, err := NewSubjectTransform(cfg.RePublish.Source, cfg.RePublish.Destination)
@@ -1087,6 +1294,8 @@ func (a *Account) addStreamWithAssignmentAndMode(config *StreamConfig, fsConfig
 	fsCfg.SyncInterval = s.getOpts().SyncInterval
 	fsCfg.SyncAlways = s.getOpts().SyncAlways
 	fsCfg.Compression = config.Compression
+	fsCfg.CompressionLevel = config.CompressionLevel
+	fsCfg.ColdTier = js.coldTierForStream(a.Name, config.Name)
 	// Async flushing is only allowed if the stream has a sync log backing it.
 	fsCfg.AsyncFlush = !fsCfg.SyncAlways && config.Replicas > 1
 
@@ -1109,6 +1318,9 @@ func (a *Account) addStreamWithAssignmentAndMode(config *StreamConfig, fsConfig
 		mset.stop(true, false)
 		return nil, NewJSStreamStoreFailedError(err)
 	}
+	mset.loadRedacted()
+	mset.loadBatchTxnDecisions()
+	mset.loadBatchTxnPrepared()
 
 	// Create our pubAck template here. Better than json marshal each time on success.
 	if domain := s.getOpts().JetStreamDomain; domain != _EMPTY_ {
@@ -1125,7 +1337,7 @@ func (a *Account) addStreamWithAssignmentAndMode(config *StreamConfig, fsConfig
 
 	// Possible race with consumer.setLeader during recovery.
 	mset.mu.Lock()
-	mset.lseq = state.LastSeq
+	mset.setLastSeq(state.LastSeq)
 
 	// Ensure dedupe state is loaded.
 	mset.ddMu.Lock()
@@ -1371,6 +1583,23 @@ func (mset *stream) isLeader() bool {
 	return true
 }
 
+// How long a read waits for the leader lease to be valid and all commits to be applied.
+const linearizableReadTimeout = time.Second
+
+// waitForLinearizableRead waits until reads served by the leader are linearizable.
+// That is when we hold a leader lease, so no other leader could have been elected,
+// and everything committed up to now was applied. Does not wait if not enabled.
+func (mset *stream) waitForLinearizableRead() error {
+	mset.mu.RLock()
+	node, enabled := mset.node, mset.cfg.LinearizableReads
+	mset.mu.RUnlock()
+	if !enabled || node == nil {
+		return nil
+	}
+	_, err := node.ReadIndex(linearizableReadTimeout)
+	return err
+}
+
 // isLeaderNodeState should NOT be used normally, use isLeader instead.
 // Returns whether the node thinks it is the leader, regardless of whether applies are up-to-date yet
 // (unlike isLeader, which requires applies to be caught up).
@@ -1450,6 +1679,11 @@ func (mset *stream) setLeader(isLeader bool, term uint64) error {
 	}
 	mset.mu.Unlock()
 
+	// Resolve a batch we still have prepared as part of a transaction.
+	if isLeader {
+		mset.resumeBatchTxn()
+	}
+
 	// If we are interest based make sure to check consumers.
 	// This is to make sure we process any outstanding acks.
 	mset.checkInterestState()
@@ -1481,6 +1715,10 @@ func (mset *stream) startClusterSubs() {
 	if mset.syncSub == nil {
 		mset.syncSub, _ = mset.srv.systemSubscribe(mset.sa.Sync, _EMPTY_, false, mset.sysc, mset.handleClusterSyncRequest)
 	}
+	if mset.dgSub == nil {
+		dsubj := fmt.Sprintf(clusterDirectGetT, mset.jsa.acc(), mset.cfg.Name)
+		mset.dgSub, _ = mset.srv.systemSubscribe(dsubj, _EMPTY_, false, mset.sysc, mset.handleClusterDirectGetRequest)
+	}
 }
 
 // Lock should be held.
@@ -1489,6 +1727,10 @@ func (mset *stream) stopClusterSubs() {
 		mset.srv.sysUnsubscribe(mset.syncSub)
 		mset.syncSub = nil
 	}
+	if mset.dgSub != nil {
+		mset.srv.sysUnsubscribe(mset.dgSub)
+		mset.dgSub = nil
+	}
 }
 
 // account gets the account for this stream.
@@ -1611,6 +1853,11 @@ func (mset *stream) rebuildDedupe() {
 				mset.storeMsgIdLocked(&ddentry{msgId, sm.seq, sm.ts})
 			}
 		}
+		if msgId == _EMPTY_ && mset.cfg.Mirror == nil {
+			if ddId := mset.contentDedupeId(sm.subj, sm.hdr, sm.msg); ddId != _EMPTY_ {
+				mset.storeMsgIdLocked(&ddentry{ddId, sm.seq, sm.ts})
+			}
+		}
 		if seq == state.LastSeq {
 			mset.lmsgId = msgId
 		}
@@ -1659,7 +1906,7 @@ func (mset *stream) prepareForWALReplay(snap *StreamReplicatedState) error {
 		mset.store.FastState(&state)
 	}
 
-	mset.lseq = state.LastSeq
+	mset.setLastSeq(state.LastSeq)
 	mset.setCLFS(clfs)
 
 	mset.ddMu.Lock()
@@ -1702,6 +1949,15 @@ func (mset *stream) lastSeq() uint64 {
 	return mset.lseq
 }
 
+// setLastSeq sets our last sequence, and releases the direct gets that were waiting for it.
+// Lock should be held.
+func (mset *stream) setLastSeq(lseq uint64) {
+	mset.lseq = lseq
+	if mset.dgWaiting.Load() > 0 {
+		mset.releaseDirectGetWaits(lseq)
+	}
+}
+
 func (mset *stream) sendCreateAdvisory() {
 	mset.mu.RLock()
 	name := mset.cfg.Name
@@ -1827,10 +2083,11 @@ func (mset *stream) setCreatedTime(created time.Time) {
 	mset.mu.Unlock()
 }
 
-// subjectsOverlap to see if these subjects overlap with existing subjects.
+// subjectsOverlap to see if the config's subjects overlap with existing subjects.
+// Partitions of the same partitioned stream share their subjects and do not overlap.
 // Use only for non-clustered JetStream
 // RLock minimum should be held.
-func (jsa *jsAccount) subjectsOverlap(subjects []string, self *stream) bool {
+func (jsa *jsAccount) subjectsOverlap(cfg *StreamConfig, self *stream) bool {
 	for _, mset := range jsa.streams {
 		if self != nil && mset == self {
 			continue
@@ -1838,9 +2095,13 @@ func (jsa *jsAccount) subjectsOverlap(subjects []string, self *stream) bool {
 		// Read the other stream's subjects under its cfgMu.
 		mset.cfgMu.RLock()
 		msubjects := mset.cfg.Subjects
+		sibling := samePartitionedStream(&mset.cfg, cfg)
 		mset.cfgMu.RUnlock()
+		if sibling {
+			continue
+		}
 		for _, subj := range msubjects {
-			for _, tsubj := range subjects {
+			for _, tsubj := range cfg.Subjects {
 				if SubjectsCollide(tsubj, subj) {
 					return true
 				}
@@ -1898,6 +2159,20 @@ func (s *Server) checkStreamCfgLocked(config *StreamConfig, acc *Account, pedant
 	if _, err := cfg.Compression.MarshalJSON(); err != nil {
 		return cfg, NewJSStreamInvalidConfigError(fmt.Errorf("invalid compression"))
 	}
+	if cfg.CompressionLevel != 0 {
+		if cfg.Compression != ZstdCompression {
+			return cfg, NewJSStreamInvalidConfigError(fmt.Errorf("compression level requires zstd compression"))
+		}
+		if cfg.CompressionLevel < 1 || cfg.CompressionLevel > 22 {
+			return cfg, NewJSStreamInvalidConfigError(fmt.Errorf("compression level must be between 1 and 22"))
+		}
+	}
+	if cfg.ColdTierAge < 0 {
+		return cfg, NewJSStreamInvalidConfigError(fmt.Errorf("cold tier age can not be negative"))
+	}
+	if cfg.ColdTierAge > 0 && cfg.Storage == MemoryStorage {
+		return cfg, NewJSStreamInvalidConfigError(fmt.Errorf("cold tier requires file storage"))
+	}
 
 	// Make file the default.
 	if cfg.Storage == 0 {
@@ -2015,6 +2290,81 @@ func (s *Server) checkStreamCfgLocked(config *StreamConfig, acc *Account, pedant
 		}
 	}
 
+	// Check the ingest rate limit, if set.
+	if irl := cfg.IngestRateLimit; irl != nil {
+		if cfg.Mirror != nil {
+			return StreamConfig{}, NewJSStreamInvalidConfigError(fmt.Errorf("stream mirrors can not have an ingest rate limit"))
+		}
+		if irl.MaxMsgsPerSec == 0 && irl.MaxMsgsPerSubjectPerSec == 0 {
+			return StreamConfig{}, NewJSStreamInvalidConfigError(fmt.Errorf("ingest rate limit requires max msgs per second or max msgs per subject per second > 0"))
+		}
+		if len(irl.Subjects) > 0 && irl.MaxMsgsPerSubjectPerSec == 0 {
+			return StreamConfig{}, NewJSStreamInvalidConfigError(fmt.Errorf("ingest rate limit subjects require max msgs per subject per second > 0"))
+		}
+		for _, filter := range irl.Subjects {
+			if !IsValidSubject(filter) {
+				return StreamConfig{}, NewJSStreamInvalidConfigError(fmt.Errorf("ingest rate limit subject %q is not a valid subject", filter))
+			}
+		}
+		if irl.Burst > math.MaxInt32 {
+			return StreamConfig{}, NewJSStreamInvalidConfigError(fmt.Errorf("ingest rate limit burst can not exceed %d", math.MaxInt32))
+		}
+	}
+
+	// Check content based deduplication, if set.
+	if cdd := cfg.ContentDedupe; cdd != nil {
+		if cfg.Mirror != nil {
+			return StreamConfig{}, NewJSStreamInvalidConfigError(fmt.Errorf("stream mirrors can not have content dedupe"))
+		}
+		if cfg.Duplicates <= 0 {
+			return StreamConfig{}, NewJSStreamInvalidConfigError(fmt.Errorf("content dedupe requires a duplicate window"))
+		}
+		for _, key := range cdd.Headers {
+			if key == _EMPTY_ || strings.ContainsAny(key, ": \t\r\n") {
+				return StreamConfig{}, NewJSStreamInvalidConfigError(fmt.Errorf("content dedupe header %q is not valid", key))
+			}
+		}
+	}
+
+	// Check last value compaction, if set.
+	if sc := cfg.Compaction; sc != nil {
+		if cfg.Storage != FileStorage {
+			return StreamConfig{}, NewJSStreamInvalidConfigError(fmt.Errorf("compaction requires file storage"))
+		}
+		if cfg.Retention != LimitsPolicy {
+			return StreamConfig{}, NewJSStreamInvalidConfigError(fmt.Errorf("compaction requires limits retention policy"))
+		}
+		if sc.DirtyAge <= 0 {
+			return StreamConfig{}, NewJSStreamInvalidConfigError(fmt.Errorf("compaction requires a dirty age"))
+		}
+		if sc.TombstoneAge < 0 {
+			return StreamConfig{}, NewJSStreamInvalidConfigError(fmt.Errorf("compaction tombstone age can not be negative"))
+		}
+	}
+
+	// Check the schemas compile, if set.
+	if len(cfg.Schemas) > 0 {
+		if cfg.Mirror != nil {
+			return StreamConfig{}, NewJSStreamInvalidConfigError(fmt.Errorf("stream mirrors can not have schemas"))
+		}
+		if cfg.AllowMsgCounter {
+			return StreamConfig{}, NewJSStreamInvalidConfigError(fmt.Errorf("counter streams can not have schemas"))
+		}
+		for _, schema := range cfg.Schemas {
+			if schema == nil {
+				continue
+			}
+			for _, filter := range schema.Subjects {
+				if !IsValidSubject(filter) {
+					return StreamConfig{}, NewJSStreamInvalidConfigError(fmt.Errorf("schema subject %q is not a valid subject", filter))
+				}
+			}
+		}
+		if _, err := newStreamSchemas(cfg.Schemas); err != nil {
+			return StreamConfig{}, NewJSStreamInvalidConfigError(fmt.Errorf("invalid schema: %v", err))
+		}
+	}
+
 	if cfg.SubjectDeleteMarkerTTL > 0 {
 		if cfg.SubjectDeleteMarkerTTL < time.Second {
 			return StreamConfig{}, NewJSStreamInvalidConfigError(fmt.Errorf("subject delete marker TTL must be at least 1 second"))
@@ -2059,6 +2409,35 @@ func (s *Server) checkStreamCfgLocked(config *StreamConfig, acc *Account, pedant
 		}
 	}
 
+	// Direct gets are answered without the subscribe permissions of the user, see consumer_perms.go.
+	if cfg.ConsumerSubjectPermissions && (cfg.AllowDirect || cfg.MirrorDirect) {
+		return StreamConfig{}, NewJSStreamInvalidConfigError(fmt.Errorf("consumer subject permissions can not be used with direct get"))
+	}
+
+	// Check partitioning, if set.
+	if cfg.Partitions != 0 || cfg.Partition != 0 {
+		if !s.JetStreamIsClustered() {
+			return StreamConfig{}, NewJSStreamInvalidConfigError(fmt.Errorf("partitioned streams require clustered mode"))
+		}
+		if cfg.Partitions < 2 || cfg.Partitions > maxStreamPartitions {
+			return StreamConfig{}, NewJSStreamInvalidConfigError(fmt.Errorf("stream partitions must be between 2 and %d", maxStreamPartitions))
+		}
+		if cfg.Partition < 0 || cfg.Partition >= cfg.Partitions {
+			return StreamConfig{}, NewJSStreamInvalidConfigError(fmt.Errorf("stream partition must be between 0 and %d", cfg.Partitions-1))
+		}
+		if cfg.Mirror != nil || len(cfg.Sources) > 0 {
+			return StreamConfig{}, NewJSStreamInvalidConfigError(fmt.Errorf("partitioned streams can not be a mirror or have sources"))
+		}
+		if strings.Contains(cfg.partitionedStreamName(), partitionSep) {
+			return StreamConfig{}, NewJSStreamInvalidConfigError(fmt.Errorf("partitioned stream name can not contain %q", partitionSep))
+		}
+	}
+
+	// Check learners, if set.
+	if err := checkStreamLearners(&cfg, s.JetStreamIsClustered()); err != nil {
+		return StreamConfig{}, NewJSStreamInvalidConfigError(err)
+	}
+
 	getStream := func(streamName string) (bool, StreamConfig) {
 		var exists bool
 		var cfg StreamConfig
@@ -2569,10 +2948,30 @@ func (jsa *jsAccount) configUpdateCheckLocked(old, new *StreamConfig, s *Server,
 		return nil, NewJSStreamInvalidConfigError(fmt.Errorf("message schedules can not be disabled"))
 	}
 
+	// Can't disable message delays setting.
+	if old.AllowMsgDelay && !cfg.AllowMsgDelay {
+		return nil, NewJSStreamInvalidConfigError(fmt.Errorf("message delays can not be disabled"))
+	}
+
+	// Can't disable message priority setting.
+	if old.AllowMsgPriority && !cfg.AllowMsgPriority {
+		return nil, NewJSStreamInvalidConfigError(fmt.Errorf("message priority can not be disabled"))
+	}
+
 	if old.PersistMode != cfg.PersistMode {
 		return nil, NewJSStreamInvalidConfigError(fmt.Errorf("stream configuration update can not change persist mode"))
 	}
 
+	// Can't change linearizable reads, the leader lease is part of the Raft group.
+	if cfg.LinearizableReads != old.LinearizableReads {
+		return nil, NewJSStreamInvalidConfigError(fmt.Errorf("stream configuration update can not change linearizable reads"))
+	}
+
+	// Can't change partitioning.
+	if cfg.Partitions != old.Partitions || cfg.Partition != old.Partition {
+		return nil, NewJSStreamInvalidConfigError(fmt.Errorf("stream configuration update can not change partitions"))
+	}
+
 	// Do some adjustments for being sealed.
 	// Pedantic mode will allow those changes to be made, as they are deterministic and important to get a sealed stream.
 	if cfg.Sealed {
@@ -2671,6 +3070,22 @@ func (mset *stream) updateWithAdvisory(config *StreamConfig, sendAdvisory bool,
 	updateLimits := (newInactiveThreshold > 0 && oldInactiveThreshold != newInactiveThreshold) ||
 		(newMaxAckPending > 0 && oldMaxAckPending != newMaxAckPending)
 
+	// Enabling message delays requires all consumers to ack explicitly.
+	// Only check if not clustered. The meta leader performs clustered checks.
+	if cfg.AllowMsgDelay && !ocfg.AllowMsgDelay && !mset.js.isClustered() {
+		var errorConsumers []string
+		for _, c := range mset.getConsumers() {
+			c.mu.RLock()
+			if !msgDelayConsumerOk(&c.cfg) {
+				errorConsumers = append(errorConsumers, c.name)
+			}
+			c.mu.RUnlock()
+		}
+		if len(errorConsumers) > 0 {
+			return fmt.Errorf("message delays require explicit ack policy for consumers: %s", strings.Join(errorConsumers, ", "))
+		}
+	}
+
 	// Only check if not clustered. The meta leader performs clustered checks.
 	if updateLimits && !mset.js.isClustered() {
 		var errorConsumers []string
@@ -2697,7 +3112,7 @@ func (mset *stream) updateWithAdvisory(config *StreamConfig, sendAdvisory bool,
 	}
 
 	jsa.mu.RLock()
-	if jsa.subjectsOverlap(cfg.Subjects, mset) {
+	if jsa.subjectsOverlap(cfg, mset) {
 		jsa.mu.RUnlock()
 		return NewJSStreamSubjectOverlapError()
 	}
@@ -2716,15 +3131,16 @@ func (mset *stream) updateWithAdvisory(config *StreamConfig, sendAdvisory bool,
 		}
 
 		// Now check for subject interest differences.
-		current := make(map[string]struct{}, len(ocfg.Subjects))
-		for _, s := range ocfg.Subjects {
+		osubjects := mset.ingestSubjects(&ocfg)
+		current := make(map[string]struct{}, len(osubjects))
+		for _, s := range osubjects {
 			current[s] = struct{}{}
 		}
 		// Update config with new values. The store update will enforce any stricter limits.
 
 		// Now walk new subjects. All of these need to be added, but we will check
 		// the originals first, since if it is in there we can skip, already added.
-		for _, s := range cfg.Subjects {
+		for _, s := range mset.ingestSubjects(cfg) {
 			if _, ok := current[s]; !ok {
 				if _, err := mset.subscribeInternal(s, mset.processInboundJetStreamMsg); err != nil {
 					mset.mu.Unlock()
@@ -2891,6 +3307,38 @@ func (mset *stream) updateWithAdvisory(config *StreamConfig, sendAdvisory bool,
 		mset.itr = nil
 	}
 
+	// Check for changes to the ingest rate limit, keeping the count of limited messages.
+	if !reflect.DeepEqual(ocfg.IngestRateLimit, cfg.IngestRateLimit) {
+		irl := newIngestLimiter(cfg.IngestRateLimit)
+		if irl != nil {
+			irl.limited.Store(mset.irl.Load().numLimited())
+		}
+		mset.irl.Store(irl)
+	}
+
+	// Check for changes to content based deduplication.
+	if !reflect.DeepEqual(ocfg.ContentDedupe, cfg.ContentDedupe) {
+		mset.cdd.Store(cfg.ContentDedupe)
+	}
+
+	// Check for changes to the subjects of a partition.
+	if cfg.isPartitioned() && !slices.Equal(ocfg.Subjects, cfg.Subjects) {
+		// Already checked when the partition was created.
+		if p, _ := newStreamPartitioner(cfg); p != nil {
+			mset.part.Store(p)
+		}
+	}
+
+	// Check for changes to the schemas, keeping the count of rejected messages.
+	if !reflect.DeepEqual(ocfg.Schemas, cfg.Schemas) {
+		// Already checked to compile as part of the config check.
+		schemas, _ := newStreamSchemas(cfg.Schemas)
+		if schemas != nil {
+			schemas.rejected.Store(mset.schemas.Load().numRejected())
+		}
+		mset.schemas.Store(schemas)
+	}
+
 	js := mset.js
 
 	if targetTier := tierName(cfg.Replicas); mset.tier != targetTier {
@@ -3066,6 +3514,13 @@ func (mset *stream) getCfgName() string {
 
 // Purge will remove all messages from the stream and underlying store based on the request.
 func (mset *stream) purge(preq *JSApiStreamPurgeRequest) (purged uint64, err error) {
+	// Wait for a prepared batch to be resolved, clustered streams wait before proposing.
+	if !mset.IsClustered() {
+		if err := mset.lockBatchTxnGate(); err != nil {
+			return 0, err
+		}
+		defer mset.txnMu.RUnlock()
+	}
 	// Purges mutate message state, so hold the isolation lock like any other
 	// write so direct get requests don't observe a partially applied purge.
 	mset.isolateMu.Lock()
@@ -3102,7 +3557,7 @@ func (mset *stream) purgeLocked(preq *JSApiStreamPurgeRequest, needLock bool) (p
 
 	// Check if our last has moved past what our original last sequence was, if so reset.
 	if lseq > mlseq {
-		mset.lseq = lseq
+		mset.setLastSeq(lseq)
 	}
 
 	// Clear any pending acks below first seq.
@@ -3160,6 +3615,13 @@ func (mset *stream) deleteMsg(seq uint64) (bool, error) {
 	if mset.closed.Load() {
 		return false, errStreamClosed
 	}
+	// Wait for a prepared batch to be resolved, clustered streams wait before proposing.
+	if !mset.IsClustered() {
+		if err := mset.lockBatchTxnGate(); err != nil {
+			return false, err
+		}
+		defer mset.txnMu.RUnlock()
+	}
 	// Deletes mutate message state, so hold the isolation lock like any other write.
 	mset.isolateMu.Lock()
 	defer mset.isolateMu.Unlock()
@@ -3178,6 +3640,13 @@ func (mset *stream) eraseMsg(seq uint64) (bool, error) {
 	if mset.closed.Load() {
 		return false, errStreamClosed
 	}
+	// Wait for a prepared batch to be resolved, clustered streams wait before proposing.
+	if !mset.IsClustered() {
+		if err := mset.lockBatchTxnGate(); err != nil {
+			return false, err
+		}
+		defer mset.txnMu.RUnlock()
+	}
 	// Deletes mutate message state, so hold the isolation lock like any other write.
 	mset.isolateMu.Lock()
 	defer mset.isolateMu.Unlock()
@@ -3418,6 +3887,12 @@ func (mset *stream) processInboundMirrorMsg(m *inMsg) bool {
 
 	// Check for heartbeats and flow control messages.
 	if isControl {
+		// Redaction of a message we already received.
+		if m.isRedactedControlMsg() {
+			mset.mu.Unlock()
+			mset.redactFromUpstream(m.hdr, _EMPTY_)
+			return true
+		}
 		var needsRetry bool
 		// Flow controls have reply subjects.
 		if m.rply != _EMPTY_ {
@@ -3598,7 +4073,7 @@ func (mset *stream) skipMsgs(start, end uint64) error {
 		if err := store.SkipMsgs(start, end-start+1); err != nil {
 			return err
 		}
-		mset.lseq = end
+		mset.setLastSeq(end)
 		return nil
 	}
 
@@ -4041,7 +4516,7 @@ func (mset *stream) setupMirrorConsumer() error {
 						failSetup(err)
 						return
 					}
-					mset.lseq = ccr.ConsumerInfo.Delivered.Stream
+					mset.setLastSeq(ccr.ConsumerInfo.Delivered.Stream)
 				} else if err := mset.skipMsgs(state.LastSeq+1, ccr.ConsumerInfo.Delivered.Stream); err != nil {
 					failSetup(err)
 					return
@@ -4741,6 +5216,13 @@ func (mset *stream) processInboundSourceMsg(si *sourceInfo, m *inMsg) bool {
 
 	// Check for heartbeats and flow control messages.
 	if isControl {
+		// Redaction of a message we already received.
+		if m.isRedactedControlMsg() {
+			iname := si.iname
+			mset.mu.Unlock()
+			mset.redactFromUpstream(m.hdr, iname)
+			return true
+		}
 		var needsRetry bool
 		// Flow controls have reply subjects.
 		if m.rply != _EMPTY_ {
@@ -4833,8 +5315,10 @@ func (mset *stream) processInboundSourceMsg(si *sourceInfo, m *inMsg) bool {
 	// If we are clustered we need to propose this message to the underlying raft group.
 	if node != nil {
 		err = mset.processClusteredInboundMsg(m.subj, _EMPTY_, hdr, msg, nil, true)
-	} else {
+	} else if err = mset.lockBatchTxnGate(); err == nil {
+		// Sourced messages don't come through the ingest loop, so wait for a prepared batch to be resolved.
 		err = mset.processJetStreamMsg(m.subj, _EMPTY_, hdr, msg, 0, 0, nil, true, true)
+		mset.txnMu.RUnlock()
 	}
 	if err != nil {
 		s := mset.srv
@@ -5286,7 +5770,7 @@ func (mset *stream) subscribeToStream() error {
 	if mset.active {
 		return nil
 	}
-	for _, subject := range mset.cfg.Subjects {
+	for _, subject := range mset.ingestSubjects(&mset.cfg) {
 		if _, err := mset.subscribeInternal(subject, mset.processInboundJetStreamMsg); err != nil {
 			return err
 		}
@@ -5438,7 +5922,7 @@ func (mset *stream) removeInternalConsumer(si *sourceInfo) {
 // Will unsubscribe from the stream.
 // Lock should be held.
 func (mset *stream) unsubscribeToStream(stopping, shuttingDown bool) error {
-	for _, subject := range mset.cfg.Subjects {
+	for _, subject := range mset.ingestSubjects(&mset.cfg) {
 		mset.unsubscribeInternal(subject)
 	}
 	if mset.mirror != nil {
@@ -5595,6 +6079,19 @@ func (mset *stream) setupStore(fsCfg *FileStoreConfig, recovering bool) error {
 			return err
 		}
 		mset.store = fs
+		// Compaction is proposed by the leader, so all replicas remove the same messages.
+		fs.registerCompaction(func(seq uint64, tcutoff int64) {
+			if mset.IsClustered() {
+				mset.mu.RLock()
+				if mset.isLeader() {
+					sc := streamCompact{Seq: seq, TombstoneCutoff: tcutoff}
+					mset.node.Propose(mset.term, encodeStreamCompact(&sc))
+				}
+				mset.mu.RUnlock()
+			} else {
+				fs.compactLastValuesUpTo(seq, tcutoff)
+			}
+		})
 	}
 	// This will fire the callback but we do not require the lock since md will be 0 here.
 	mset.store.RegisterStorageUpdates(mset.storeUpdates)
@@ -5615,8 +6112,9 @@ func (mset *stream) setupStore(fsCfg *FileStoreConfig, recovering bool) error {
 			if mset.IsLeader() {
 				mset.processClusteredInboundMsg(im.subj, im.rply, im.hdr, im.msg, im.mt, true)
 			}
-		} else {
+		} else if mset.lockBatchTxnGate() == nil {
 			mset.processJetStreamMsg(im.subj, im.rply, im.hdr, im.msg, 0, 0, im.mt, true, true)
+			mset.txnMu.RUnlock()
 		}
 	})
 	mset.mu.Unlock()
@@ -5755,6 +6253,30 @@ func getMsgId(hdr []byte) string {
 	return string(getHeader(JSMsgId, hdr))
 }
 
+// Prefix of the ids used for content based deduplication.
+const contentDedupeIdPrefix = "$CDD."
+
+// contentDedupeId returns the id used for duplicate detection of a message without a msgId,
+// or an empty string if content based deduplication is not enabled.
+func (mset *stream) contentDedupeId(subject string, hdr, msg []byte) string {
+	cdd := mset.cdd.Load()
+	if cdd == nil {
+		return _EMPTY_
+	}
+	h := sha256.New()
+	h.Write(stringToBytes(subject))
+	h.Write([]byte{0})
+	for _, key := range cdd.Headers {
+		h.Write(stringToBytes(key))
+		h.Write([]byte{':'})
+		h.Write(sliceHeader(key, hdr))
+		h.Write([]byte{0})
+	}
+	h.Write(msg)
+	var sum [sha256.Size]byte
+	return contentDedupeIdPrefix + base64.RawURLEncoding.EncodeToString(h.Sum(sum[:0]))
+}
+
 // Fast lookup of expected last msgId.
 func getExpectedLastMsgId(hdr []byte) string {
 	return string(getHeader(JSExpectedLastMsgId, hdr))
@@ -5834,6 +6356,50 @@ func parseMessageTTL(ttl string) (int64, error) {
 	return t, nil
 }
 
+// Fast lookup of the time a message can be delivered to consumers from headers:
+// - Positive return value: timestamp in nanoseconds.
+// - Zero return value: no delay.
+// The Nats-Delay header is relative to the given message timestamp.
+func getMessageDeliverAt(hdr []byte, ts int64) (int64, error) {
+	if len(hdr) == 0 {
+		return 0, nil
+	}
+	delay, deliverAt := sliceHeader(JSMessageDelay, hdr), sliceHeader(JSMessageDeliverAt, hdr)
+	switch {
+	case len(delay) > 0 && len(deliverAt) > 0:
+		return 0, NewJSMessageDelayInvalidError()
+	case len(delay) > 0:
+		dur, err := time.ParseDuration(bytesToString(delay))
+		if err != nil || dur <= 0 {
+			return 0, NewJSMessageDelayInvalidError()
+		}
+		return ts + int64(dur), nil
+	case len(deliverAt) > 0:
+		t, err := time.Parse(time.RFC3339Nano, bytesToString(deliverAt))
+		if err != nil || t.UnixNano() <= 0 {
+			return 0, NewJSMessageDelayInvalidError()
+		}
+		return t.UnixNano(), nil
+	}
+	return 0, nil
+}
+
+// Fast lookup of the priority level of a message from headers.
+// Returns -1 if the message has no priority.
+func getMessagePriority(hdr []byte) (int, error) {
+	if len(hdr) == 0 {
+		return -1, nil
+	}
+	prio := sliceHeader(JSMessagePriority, hdr)
+	if len(prio) == 0 {
+		return -1, nil
+	}
+	if len(prio) != 1 || prio[0] < '0' || prio[0] > '0'+JSMessagePriorityMax {
+		return -1, NewJSMessagePriorityInvalidError()
+	}
+	return int(prio[0] - '0'), nil
+}
+
 // Fast lookup of the message Incr from headers.
 // Return includes the value or nil, and success.
 func getMessageIncr(hdr []byte) (*big.Int, bool) {
@@ -6194,6 +6760,11 @@ func (mset *stream) processDirectGetRequest(_ *subscription, c *client, _ *Accou
 		return
 	}
 
+	// Wait until we applied the minimum last sequence, if requested.
+	if !mset.checkDirectGetMinSeq(&req, reply, false) {
+		return
+	}
+
 	inlineOk := c.kind != ROUTER && c.kind != GATEWAY && c.kind != LEAF
 	if !inlineOk {
 		dg := dgPool.Get().(*directGetReq)
@@ -6257,6 +6828,11 @@ func (mset *stream) processDirectGetLastBySubjectRequest(_ *subscription, c *cli
 		req.LastFor = key
 	}
 
+	// Wait until we applied the minimum last sequence, if requested.
+	if !mset.checkDirectGetMinSeq(&req, reply, false) {
+		return
+	}
+
 	inlineOk := c.kind != ROUTER && c.kind != GATEWAY && c.kind != LEAF
 	if !inlineOk {
 		dg := dgPool.Get().(*directGetReq)
@@ -6275,6 +6851,47 @@ const (
 	eobm = "NATS/1.0 204 EOB\r\nNats-Num-Pending: %d\r\nNats-Last-Sequence: %d\r\nNats-UpTo-Sequence: %d\r\n\r\n"
 )
 
+// getDirectUpToSeq returns the last sequence a direct get request is allowed to return,
+// zero if not bounded. Will respond and return false if nothing can be returned.
+func (mset *stream) getDirectUpToSeq(req *JSApiMsgGetRequest, reply string) (uint64, bool) {
+	store := mset.store
+	upToSeq := req.UpToSeq
+	// If we have UpToTime set get the proper sequence.
+	if req.UpToTime != nil {
+		upToSeq = store.GetSeqFromTime((*req.UpToTime).UTC())
+		var state StreamState
+		store.FastState(&state)
+		// Avoid selecting a first sequence that will take us to before the stream first
+		// sequence, otherwise we can return messages after the supplied UpToTime.
+		if upToSeq <= state.FirstSeq {
+			hdr := []byte("NATS/1.0 404 No Results\r\n\r\n")
+			mset.outq.send(newJSPubMsg(reply, _EMPTY_, _EMPTY_, hdr, nil, nil, 0))
+			return 0, false
+		}
+		// We need to back off one since this is used to determine start sequence normally,
+		// whereas here we want it to be the ceiling.
+		upToSeq--
+	}
+	// If bound to a view, messages after the view's sequence are not visible.
+	if req.View != _EMPTY_ {
+		vseq, ok := mset.lookupView(req.View)
+		if !ok {
+			hdr := []byte("NATS/1.0 404 View Not Found\r\n\r\n")
+			mset.outq.send(newJSPubMsg(reply, _EMPTY_, _EMPTY_, hdr, nil, nil, 0))
+			return 0, false
+		}
+		if vseq == 0 {
+			hdr := []byte("NATS/1.0 404 No Results\r\n\r\n")
+			mset.outq.send(newJSPubMsg(reply, _EMPTY_, _EMPTY_, hdr, nil, nil, 0))
+			return 0, false
+		}
+		if upToSeq == 0 || vseq < upToSeq {
+			upToSeq = vseq
+		}
+	}
+	return upToSeq, true
+}
+
 // Handle a multi request.
 func (mset *stream) getDirectMulti(req *JSApiMsgGetRequest, reply string) {
 	// TODO(dlc) - Make configurable?
@@ -6294,22 +6911,9 @@ func (mset *stream) getDirectMulti(req *JSApiMsgGetRequest, reply string) {
 		mb = int(s.opts.MaxPending)
 	}
 
-	upToSeq := req.UpToSeq
-	// If we have UpToTime set get the proper sequence.
-	if req.UpToTime != nil {
-		upToSeq = store.GetSeqFromTime((*req.UpToTime).UTC())
-		var state StreamState
-		store.FastState(&state)
-		// Avoid selecting a first sequence that will take us to before the stream first
-		// sequence, otherwise we can return messages after the supplied UpToTime.
-		if upToSeq <= state.FirstSeq {
-			hdr := []byte("NATS/1.0 404 No Results\r\n\r\n")
-			mset.outq.send(newJSPubMsg(reply, _EMPTY_, _EMPTY_, hdr, nil, nil, 0))
-			return
-		}
-		// We need to back off one since this is used to determine start sequence normally,
-		// whereas here we want it to be the ceiling.
-		upToSeq--
+	upToSeq, ok := mset.getDirectUpToSeq(req, reply)
+	if !ok {
+		return
 	}
 	// If not set, set to the last sequence and remember that for EOB.
 	if upToSeq == 0 {
@@ -6392,6 +6996,24 @@ func (mset *stream) getDirectRequest(req *JSApiMsgGetRequest, reply string) {
 	mset.isolateMu.RLock()
 	defer mset.isolateMu.RUnlock()
 
+	upToSeq, ok := mset.getDirectUpToSeq(req, reply)
+	if !ok {
+		return
+	}
+	// Num pending for batch requests, not counting messages after upToSeq.
+	numPending := func(seq uint64) (uint64, uint64, error) {
+		np, validThrough, err := store.NumPending(seq, req.NextFor, false)
+		if err == nil && upToSeq > 0 && validThrough > upToSeq {
+			var after uint64
+			if after, _, err = store.NumPending(upToSeq+1, req.NextFor, false); after < np {
+				np -= after
+			} else {
+				np = 0
+			}
+		}
+		return np, validThrough, err
+	}
+
 	var seq uint64
 	// Lookup start seq if AsOfTime is set.
 	if req.StartTime != nil {
@@ -6411,7 +7033,7 @@ func (mset *stream) getDirectRequest(req *JSApiMsgGetRequest, reply string) {
 		// This is a batch request, capture initial numPending.
 		isBatchRequest = true
 		var err error
-		if np, validThrough, err = store.NumPending(seq, req.NextFor, false); err != nil {
+		if np, validThrough, err = numPending(seq); err != nil {
 			return
 		}
 	}
@@ -6445,10 +7067,17 @@ func (mset *stream) getDirectRequest(req *JSApiMsgGetRequest, reply string) {
 		} else if req.NextFor != _EMPTY_ {
 			sm, seq, err = store.LoadNextMsg(req.NextFor, wc, seq, &svp)
 			seq++
+		} else if upToSeq > 0 {
+			// Batch is not applicable here, this is checked before we get here.
+			sm, _, err = store.LoadPrevMsg(req.LastFor, subjectHasWildcard(req.LastFor), upToSeq, &svp)
 		} else {
 			// Batch is not applicable here, this is checked before we get here.
 			sm, err = store.LoadLastMsg(req.LastFor, &svp)
 		}
+		// Messages after upToSeq are not visible to this request.
+		if err == nil && upToSeq > 0 && sm.seq > upToSeq {
+			err = ErrStoreEOF
+		}
 		if err != nil {
 			// For batches, if we stop early we want to do EOB logic below.
 			if batch > 1 && i > 0 {
@@ -6509,7 +7138,7 @@ func (mset *stream) getDirectRequest(req *JSApiMsgGetRequest, reply string) {
 		store.FastState(&state)
 		if state.LastSeq > validThrough {
 			var err error
-			if np, _, err = store.NumPending(seq, req.NextFor, false); err != nil {
+			if np, _, err = numPending(seq); err != nil {
 				return
 			}
 		}
@@ -6518,8 +7147,27 @@ func (mset *stream) getDirectRequest(req *JSApiMsgGetRequest, reply string) {
 	}
 }
 
+// ingestSubjects returns the subjects the stream receives messages on.
+func (mset *stream) ingestSubjects(cfg *StreamConfig) []string {
+	if p := mset.part.Load(); p != nil {
+		return p.ingestSubjects(cfg)
+	}
+	return cfg.Subjects
+}
+
 // processInboundJetStreamMsg handles processing messages bound for a stream.
 func (mset *stream) processInboundJetStreamMsg(_ *subscription, c *client, _ *Account, subject, reply string, rmsg []byte) {
+	// Messages for other partitions are routed to their partition, which stores and acknowledges them.
+	if p := mset.part.Load(); p != nil {
+		var ok bool
+		if subject, ok = p.route(subject); !ok {
+			if subject != _EMPTY_ {
+				hdr, msg := c.msgParts(rmsg)
+				mset.outq.send(newJSPubMsg(subject, _EMPTY_, reply, hdr, msg, nil, 0))
+			}
+			return
+		}
+	}
 	hdr, msg := c.msgParts(copyBytes(rmsg)) // Need to copy.
 	hdr = removeHeaderStatusIfPresent(hdr)
 	if mt, traceOnly := c.isMsgTraceEnabled(); mt != nil {
@@ -6539,12 +7187,15 @@ func (mset *stream) processInboundJetStreamMsg(_ *subscription, c *client, _ *Ac
 }
 
 var (
-	errLastSeqMismatch   = errors.New("last sequence mismatch")
-	errMsgIdDuplicate    = errors.New("msgid is duplicate")
-	errStreamClosed      = errors.New("stream closed")
-	errInvalidMsgHandler = errors.New("undefined message handler")
-	errStreamMismatch    = errors.New("expected stream does not match")
-	errMsgTTLDisabled    = errors.New("message TTL disabled")
+	errLastSeqMismatch     = errors.New("last sequence mismatch")
+	errMsgIdDuplicate      = errors.New("msgid is duplicate")
+	errStreamClosed        = errors.New("stream closed")
+	errInvalidMsgHandler   = errors.New("undefined message handler")
+	errStreamMismatch      = errors.New("expected stream does not match")
+	errMsgTTLDisabled      = errors.New("message TTL disabled")
+	errIngestRateLimited   = errors.New("ingest rate limit exceeded")
+	errMsgDelayDisabled    = errors.New("message delay disabled")
+	errMsgPriorityDisabled = errors.New("message priority disabled")
 )
 
 // processJetStreamMsg is where we try to actually process the stream msg.
@@ -6676,6 +7327,37 @@ func (mset *stream) processJetStreamMsgWithBatch(subject, reply string, hdr, msg
 		return nil
 	}
 
+	// Check the ingest rate limit if this message did not come through the clustered proposal path,
+	// which already checked it. Sourced messages and batches are exempt.
+	if lseq == 0 && ts == 0 && !traceOnly && !sourced && batchId == _EMPTY_ && !mset.irl.Load().allow(subject) {
+		// With discard old we drop the message without responding.
+		if mset.cfg.Discard != DiscardNew {
+			return errIngestRateLimited
+		}
+		apiErr := NewJSStreamIngestRateExceededError()
+		if canRespond && outq != nil {
+			resp.PubAck = &PubAck{Stream: name}
+			resp.Error = apiErr
+			b, _ := json.Marshal(resp)
+			outq.sendMsg(reply, b)
+		}
+		return apiErr
+	}
+
+	// Validate against the schemas under the same conditions as the ingest rate limit.
+	if lseq == 0 && ts == 0 && !traceOnly && !sourced && batchId == _EMPTY_ {
+		if err := mset.schemas.Load().validate(subject, msg); err != nil {
+			apiErr := NewJSStreamSchemaValidationFailedError(err)
+			if canRespond && outq != nil {
+				resp.PubAck = &PubAck{Stream: name}
+				resp.Error = apiErr
+				b, _ := json.Marshal(resp)
+				outq.sendMsg(reply, b)
+			}
+			return apiErr
+		}
+	}
+
 	// For clustering the lower layers will pass our expected lseq. If it is present check for that here.
 	var clfs uint64
 	if lseq > 0 {
@@ -6691,7 +7373,7 @@ func (mset *stream) processJetStreamMsgWithBatch(subject, reply string, hdr, msg
 					if _, err := mset.store.Compact(lseq + 1); err != nil {
 						return err
 					}
-					mset.lseq = lseq
+					mset.setLastSeq(lseq)
 					isMisMatch = false
 				}
 			}
@@ -6807,6 +7489,36 @@ func (mset *stream) processJetStreamMsgWithBatch(subject, reply string, hdr, msg
 				return errMsgTTLDisabled
 			}
 
+			// Delayed messages are rejected entirely if delays are not enabled on the stream, or if the delay is invalid.
+			if deliverAt, err := getMessageDeliverAt(hdr, time.Now().UnixNano()); !sourced && ((deliverAt != 0 && !mset.cfg.AllowMsgDelay) || err != nil) {
+				apiErr, rerr := NewJSMessageDelayInvalidError(), err
+				if !mset.cfg.AllowMsgDelay {
+					apiErr, rerr = NewJSMessageDelayDisabledError(), errMsgDelayDisabled
+				}
+				if canRespond {
+					resp.PubAck = &PubAck{Stream: name}
+					resp.Error = apiErr
+					b, _ := json.Marshal(resp)
+					outq.sendMsg(reply, b)
+				}
+				return rerr
+			}
+
+			// Messages with a priority are rejected entirely if priorities are not enabled on the stream, or if the level is invalid.
+			if prio, err := getMessagePriority(hdr); !sourced && ((prio >= 0 && !mset.cfg.AllowMsgPriority) || err != nil) {
+				apiErr, rerr := NewJSMessagePriorityInvalidError(), err
+				if !mset.cfg.AllowMsgPriority {
+					apiErr, rerr = NewJSMessagePriorityDisabledError(), errMsgPriorityDisabled
+				}
+				if canRespond {
+					resp.PubAck = &PubAck{Stream: name}
+					resp.Error = apiErr
+					b, _ := json.Marshal(resp)
+					outq.sendMsg(reply, b)
+				}
+				return rerr
+			}
+
 			// Expected last sequence per subject.
 			if seq, exists := getExpectedLastSeqPerSubject(hdr); exists {
 				// Allow override of the subject used for the check.
@@ -7120,6 +7832,28 @@ func (mset *stream) processJetStreamMsgWithBatch(subject, reply string, hdr, msg
 		}
 	}
 
+	// Without a msgId we may dedupe on the message contents instead.
+	// Like for msgIds this is done at the cluster level if clustered.
+	ddId := msgId
+	if ddId == _EMPTY_ && !isMirror {
+		if ddId = mset.contentDedupeId(subject, hdr, msg); ddId != _EMPTY_ && canConsistencyCheck {
+			var seq uint64
+			mset.ddMu.Lock()
+			if dde := mset.checkMsgId(ddId); dde != nil {
+				seq = dde.seq
+			}
+			mset.ddMu.Unlock()
+			if seq > 0 {
+				if canRespond {
+					response := append(pubAck, strconv.FormatUint(seq, 10)...)
+					response = append(response, ",\"duplicate\": true}"...)
+					outq.sendMsg(reply, response)
+				}
+				return errMsgIdDuplicate
+			}
+		}
+	}
+
 	if canConsistencyCheck && incr == nil && allowMsgCounter {
 		apiErr := NewJSMessageIncrMissingError()
 		if canRespond {
@@ -7309,8 +8043,8 @@ func (mset *stream) processJetStreamMsgWithBatch(subject, reply string, hdr, msg
 		mset.lseq, _ = store.SkipMsgNoInterest(0)
 		mset.lmsgId = msgId
 		// If we have a msgId make sure to save.
-		if msgId != _EMPTY_ {
-			mset.storeMsgId(&ddentry{msgId, mset.lseq, ts})
+		if ddId != _EMPTY_ {
+			mset.storeMsgId(&ddentry{ddId, mset.lseq, ts})
 		}
 		if allowRollupPurge {
 			if err = mset.processJetStreamMsgWithRollup(subject, rollupSub, rollupAll, hdr, 0); err != nil {
@@ -7452,7 +8186,7 @@ func (mset *stream) processJetStreamMsgWithBatch(subject, reply string, hdr, msg
 	}
 
 	// Check for preAcks and the need to clear it.
-	if mset.hasAllPreAcks(seq, subject) {
+	if mset.hasAllPreAcks(seq, subject, hdr) {
 		mset.clearAllPreAcks(seq)
 		// If we're clustered and the stream leader, we can now propose deleting this message.
 		// We still store it below, so we remain properly synchronized with our followers.
@@ -7465,21 +8199,21 @@ func (mset *stream) processJetStreamMsgWithBatch(subject, reply string, hdr, msg
 
 	// If here we succeeded in storing the message.
 	mset.lmsgId = msgId
-	mset.lseq = seq
+	mset.setLastSeq(seq)
 
 	// If we have a msgId make sure to save.
 	// This will replace our estimate from the cluster layer if we are clustered.
-	if msgId != _EMPTY_ {
+	if ddId != _EMPTY_ {
 		mset.ddMu.Lock()
 		if isClustered && isLeader && mset.ddmap != nil {
-			if dde := mset.ddmap[msgId]; dde != nil {
+			if dde := mset.ddmap[ddId]; dde != nil {
 				dde.seq, dde.ts = seq, ts
 			} else {
-				mset.storeMsgIdLocked(&ddentry{msgId, seq, ts})
+				mset.storeMsgIdLocked(&ddentry{ddId, seq, ts})
 			}
 		} else {
 			// R1 or not leader..
-			mset.storeMsgIdLocked(&ddentry{msgId, seq, ts})
+			mset.storeMsgIdLocked(&ddentry{ddId, seq, ts})
 		}
 		mset.ddMu.Unlock()
 	}
@@ -7595,7 +8329,7 @@ func (mset *stream) processJetStreamAtomicBatchMsg(batchId, subject, reply strin
 	discard, discardNewPer, maxMsgs, maxMsgsPer, maxBytes := mset.cfg.Discard, mset.cfg.DiscardNewPer, mset.cfg.MaxMsgs, mset.cfg.MaxMsgsPer, mset.cfg.MaxBytes
 	s, js, jsa, r, tierName, outq, node := mset.srv, mset.js, mset.jsa, mset.cfg.Replicas, mset.tier, mset.outq, mset.node
 	maxMsgSize, lseq := int(mset.cfg.MaxMsgSize), mset.lseq
-	isLeader, isClustered, isSealed, allowRollup, denyPurge, allowTTL, allowMsgCounter, allowMsgSchedules, allowAtomicPublish := mset.isLeader(), mset.isClustered(), mset.cfg.Sealed, mset.cfg.AllowRollup, mset.cfg.DenyPurge, mset.cfg.AllowMsgTTL, mset.cfg.AllowMsgCounter, mset.cfg.AllowMsgSchedules, mset.cfg.AllowAtomicPublish
+	isLeader, isClustered, isSealed, allowRollup, denyPurge, allowTTL, allowMsgCounter, allowMsgSchedules, allowMsgDelay, allowMsgPriority, allowAtomicPublish := mset.isLeader(), mset.isClustered(), mset.cfg.Sealed, mset.cfg.AllowRollup, mset.cfg.DenyPurge, mset.cfg.AllowMsgTTL, mset.cfg.AllowMsgCounter, mset.cfg.AllowMsgSchedules, mset.cfg.AllowMsgDelay, mset.cfg.AllowMsgPriority, mset.cfg.AllowAtomicPublish
 	mset.mu.RUnlock()
 
 	// If message tracing (with message delivery), we will need to send the
@@ -7682,10 +8416,41 @@ func (mset *stream) processJetStreamAtomicBatchMsg(batchId, subject, reply strin
 		commit = true
 	}
 
-	// If not clustered, the commit message runs the consistency checks and
-	// commits straight to the store below, so hold the isolation lock across
-	// that whole section.
-	if !isClustered && commit {
+	// Parse the transaction the batch is part of, if any.
+	var txn *batchTxn
+	var txnErr error
+	var txnVoted bool
+	if commit {
+		txn, txnErr = getBatchTxn(hdr, name)
+	}
+	// Let the coordinator know if we could not prepare our batch, so the transaction aborts right away.
+	if txn != nil {
+		defer func() {
+			if !txnVoted {
+				err := retErr
+				if err == nil {
+					err = errors.New("batch not prepared")
+				}
+				js.sendBatchTxnVote(jsa.acc().Name, name, txn, err)
+			}
+		}()
+	}
+
+	// If part of a transaction, hold other writes until our batch is resolved. If it could not be prepared,
+	// they continue once we return. No locks are held while waiting for the decision.
+	// Otherwise if not clustered, the commit message runs the consistency checks and
+	// commits straight to the store below, so hold the isolation lock across that whole section.
+	var txnPrep *batchTxnPrepared
+	if txn != nil {
+		if err := mset.closeBatchTxnGate(); err != nil {
+			return respondError(NewJSStreamGeneralError(err))
+		}
+		defer func() {
+			if txnPrep == nil {
+				mset.openBatchTxnGate()
+			}
+		}()
+	} else if !isClustered && commit {
 		mset.isolateMu.Lock()
 		defer mset.isolateMu.Unlock()
 	}
@@ -7775,6 +8540,14 @@ func (mset *stream) processJetStreamAtomicBatchMsg(batchId, subject, reply strin
 		return respondError(err)
 	}
 
+	// Reject the batch if the transaction is not valid.
+	if txnErr != nil {
+		b.cleanupLocked(batchId, batches)
+		batches.mu.Unlock()
+		mset.mu.Unlock()
+		return respondError(NewJSAtomicPublishInvalidTxnError(txnErr))
+	}
+
 	// The required API level can have the batch be rejected. But the header is always removed.
 	if len(sliceHeader(JSRequiredApiLevel, hdr)) != 0 {
 		if errorOnRequiredApiLevel(hdr) {
@@ -7941,7 +8714,7 @@ func (mset *stream) processJetStreamAtomicBatchMsg(batchId, subject, reply strin
 			return errorOnUnsupported(JSExpectedLastMsgId)
 		}
 
-		if bhdr, bmsg, _, apiErr, err = checkMsgHeadersPreClusteredProposal(diff, mset, csubj, bsubj, bhdr, bmsg, false, name, jsa, allowRollup, denyPurge, allowTTL, allowMsgCounter, allowMsgSchedules, discard, discardNewPer, maxMsgSize, maxMsgs, maxMsgsPer, maxBytes); err != nil {
+		if bhdr, bmsg, _, apiErr, err = checkMsgHeadersPreClusteredProposal(diff, mset, csubj, bsubj, bhdr, bmsg, false, name, jsa, allowRollup, denyPurge, allowTTL, allowMsgCounter, allowMsgSchedules, allowMsgDelay, allowMsgPriority, discard, discardNewPer, maxMsgSize, maxMsgs, maxMsgsPer, maxBytes); err != nil {
 			rollback()
 			b.cleanupLocked(batchId, batches)
 			batches.mu.Unlock()
@@ -7950,7 +8723,7 @@ func (mset *stream) processJetStreamAtomicBatchMsg(batchId, subject, reply strin
 			return err
 		}
 
-		if isClustered {
+		if isClustered && txn == nil {
 			var _reply string
 			isCommit := seq == batchSeq
 			if isCommit {
@@ -7972,6 +8745,64 @@ func (mset *stream) processJetStreamAtomicBatchMsg(batchId, subject, reply strin
 		mset.clseq++
 	}
 
+	// If part of a transaction, our batch is prepared. Keep its record, release the locks and wait for
+	// the coordinator to decide whether all streams commit. Inbound messages for this stream are queued
+	// in the meantime, and other writes are held until our batch is resolved.
+	if txn != nil {
+		p := &batchTxnPrepared{Txn: txn.id, Streams: txn.streams, Batch: batchId}
+		for i, cm := range checked {
+			// If committed by EOB, the last message must get the normal commit header.
+			if i == len(checked)-1 && commitEob {
+				cm.hdr = genHeader(cm.hdr, JSBatchCommit, "1")
+			}
+			p.Msgs = append(p.Msgs, &batchTxnMsg{Subj: cm.subj, Hdr: cm.hdr, Msg: cm.msg})
+		}
+		if !isClustered {
+			p.Seq = oclseq + 1
+			mset.clseq, mset.clfs = 0, 0
+		}
+		qch := mset.qch
+		rollback()
+		b.cleanupLocked(batchId, batches)
+		batches.mu.Unlock()
+		mset.mu.Unlock()
+
+		if err = mset.prepareBatchTxn(p); err != nil {
+			mset.sendStreamBatchAbandonedAdvisory(batchId, BatchTxnFailed)
+			return respondError(NewJSAtomicPublishTxnAbortedError(fmt.Errorf("%w: %v", errBatchTxnNotKept, err)))
+		}
+		txnPrep, txnVoted = p, true
+		if err = js.awaitBatchTxn(jsa.acc().Name, name, txn, nil, qch); err == errStreamClosed {
+			// Resolved once the stream is back, from the record of our batch.
+			return respondError(NewJSStreamGeneralError(err))
+		} else if err == errBatchTxnUnknown {
+			// Keep resolving our batch in the background, inbound messages are rejected meanwhile.
+			mset.startBatchTxnResolver(p)
+			return respondError(NewJSStreamGeneralError(err))
+		}
+		p.decided, p.err = true, err
+		if err != nil {
+			mset.sendStreamBatchAbandonedAdvisory(batchId, BatchTxnAborted)
+			_ = respondError(NewJSAtomicPublishTxnAbortedError(err))
+			reply = _EMPTY_
+		}
+		// The decision is final, so if our batch can't be resolved right away, keep trying in the background.
+		// The response is sent once committed.
+		if rerr := mset.resolveBatchTxn(p, reply, diff); rerr != nil {
+			if rerr != errStreamClosed && rerr != errNotLeader {
+				mset.startBatchTxnResolver(p)
+			} else {
+				mset.txnDecMu.Lock()
+				mset.txnResolving = false
+				mset.txnDecMu.Unlock()
+			}
+			if err == nil {
+				return respondError(NewJSStreamGeneralError(rerr))
+			}
+		}
+		return err
+	}
+
 	// Commit batch.
 	if !isClustered {
 		// Reset, we only used this to do the batching checks.
@@ -8040,7 +8871,7 @@ func (mset *stream) processJetStreamFastBatchMsg(batch *FastBatch, subject, repl
 	discard, discardNewPer, maxMsgs, maxMsgsPer, maxBytes := mset.cfg.Discard, mset.cfg.DiscardNewPer, mset.cfg.MaxMsgs, mset.cfg.MaxMsgsPer, mset.cfg.MaxBytes
 	s, js, jsa, st, r, tierName, outq, node, term := mset.srv, mset.js, mset.jsa, mset.cfg.Storage, mset.cfg.Replicas, mset.tier, mset.outq, mset.node, mset.term
 	maxMsgSize, lseq := int(mset.cfg.MaxMsgSize), mset.lseq
-	isLeader, isClustered, isSealed, allowRollup, denyPurge, allowTTL, allowMsgCounter, allowMsgSchedules, allowBatchPublish := mset.isLeader(), mset.isClustered(), mset.cfg.Sealed, mset.cfg.AllowRollup, mset.cfg.DenyPurge, mset.cfg.AllowMsgTTL, mset.cfg.AllowMsgCounter, mset.cfg.AllowMsgSchedules, mset.cfg.AllowBatchPublish
+	isLeader, isClustered, isSealed, allowRollup, denyPurge, allowTTL, allowMsgCounter, allowMsgSchedules, allowMsgDelay, allowMsgPriority, allowBatchPublish := mset.isLeader(), mset.isClustered(), mset.cfg.Sealed, mset.cfg.AllowRollup, mset.cfg.DenyPurge, mset.cfg.AllowMsgTTL, mset.cfg.AllowMsgCounter, mset.cfg.AllowMsgSchedules, mset.cfg.AllowMsgDelay, mset.cfg.AllowMsgPriority, mset.cfg.AllowBatchPublish
 
 	// Apply the input subject transform if any
 	csubject := subject
@@ -8297,7 +9128,7 @@ func (mset *stream) processJetStreamFastBatchMsg(batch *FastBatch, subject, repl
 		err    error
 	)
 	diff := &batchStagedDiff{}
-	if hdr, msg, dseq, apiErr, err = checkMsgHeadersPreClusteredProposal(diff, mset, csubject, subject, hdr, msg, false, name, jsa, allowRollup, denyPurge, allowTTL, allowMsgCounter, allowMsgSchedules, discard, discardNewPer, maxMsgSize, maxMsgs, maxMsgsPer, maxBytes); err != nil {
+	if hdr, msg, dseq, apiErr, err = checkMsgHeadersPreClusteredProposal(diff, mset, csubject, subject, hdr, msg, false, name, jsa, allowRollup, denyPurge, allowTTL, allowMsgCounter, allowMsgSchedules, allowMsgDelay, allowMsgPriority, discard, discardNewPer, maxMsgSize, maxMsgs, maxMsgsPer, maxBytes); err != nil {
 		mset.clMu.Unlock()
 
 		// If the message is a duplicate, and we have no pending messages, we should check if we need to
@@ -8664,6 +9495,12 @@ func (mset *stream) internalLoop() {
 			isClustered := mset.IsClustered()
 			ims := msgs.pop()
 			for _, im := range ims {
+				// Other writes could invalidate a prepared batch that is being resolved.
+				if mset.batchTxnInDoubt() {
+					mset.rejectBatchTxnInDoubt(im.rply, im.mt)
+					im.returnToPool()
+					continue
+				}
 				// If we are clustered we need to propose this message to the underlying raft group.
 				if batch, err := getFastBatch(im.rply, im.hdr); batch != nil || err {
 					mset.processJetStreamFastBatchMsg(batch, im.subj, im.rply, im.hdr, im.msg, im.mt)
@@ -8863,6 +9700,10 @@ func (mset *stream) stop(deleteFlag, advisory bool) error {
 	}
 	mset.ddMu.Unlock()
 
+	// Cleanup view timers.
+	mset.stopViews()
+	mset.stopDirectGetWaits()
+
 	sysc := mset.sysc
 	mset.sysc = nil
 
@@ -9166,13 +10007,16 @@ func (mset *stream) stateWithDetail(details bool) StreamState {
 		return StreamState{}
 	}
 
+	var state StreamState
 	// Currently rely on store for details.
 	if details {
-		return store.State()
+		state = store.State()
+	} else {
+		// Here we do the fast version.
+		store.FastState(&state)
 	}
-	// Here we do the fast version.
-	var state StreamState
-	store.FastState(&state)
+	state.RateLimited = mset.irl.Load().numLimited()
+	state.SchemaRejected = mset.schemas.Load().numRejected()
 	return state
 }
 
@@ -9224,6 +10068,17 @@ func (mset *stream) potentialFilteredConsumers() bool {
 	return false
 }
 
+// Returns true if any of our consumers has a header filter.
+// Lock should be held.
+func (mset *stream) headerFilteredConsumers() bool {
+	for _, o := range mset.consumers {
+		if o.hasHeaderFilter() {
+			return true
+		}
+	}
+	return false
+}
+
 // Check if there is no interest in this sequence number across our consumers.
 // The consumer passed is optional if we are processing the ack for that consumer.
 // Write lock should be held.
@@ -9234,14 +10089,15 @@ func (mset *stream) noInterest(seq uint64, obs *consumer) bool {
 // Check if there is no interest in this sequence number and subject across our consumers.
 // The consumer passed is optional if we are processing the ack for that consumer.
 // Write lock should be held.
-func (mset *stream) noInterestWithSubject(seq uint64, subj string, obs *consumer) bool {
-	return !mset.checkForInterestWithSubject(seq, subj, obs)
+func (mset *stream) noInterestWithSubject(seq uint64, subj string, hdr []byte, obs *consumer) bool {
+	return !mset.checkForInterestWithSubject(seq, subj, hdr, obs)
 }
 
 // Write lock should be held here for the stream to avoid race conditions on state.
 func (mset *stream) checkForInterest(seq uint64, obs *consumer) bool {
 	var subj string
-	if mset.potentialFilteredConsumers() {
+	var hdr []byte
+	if mset.potentialFilteredConsumers() || mset.headerFilteredConsumers() {
 		pmsg := getJSPubMsgFromPool()
 		defer pmsg.returnToPool()
 		sm, err := mset.store.LoadMsg(seq, &pmsg.StoreMsg)
@@ -9254,20 +10110,20 @@ func (mset *stream) checkForInterest(seq uint64, obs *consumer) bool {
 			mset.clearAllPreAcks(seq)
 			return false
 		}
-		subj = sm.subj
+		subj, hdr = sm.subj, sm.hdr
 	}
-	return mset.checkForInterestWithSubject(seq, subj, obs)
+	return mset.checkForInterestWithSubject(seq, subj, hdr, obs)
 }
 
-// Checks for interest given a sequence and subject.
-func (mset *stream) checkForInterestWithSubject(seq uint64, subj string, obs *consumer) bool {
+// Checks for interest given a sequence and subject, and the headers if we have the message.
+func (mset *stream) checkForInterestWithSubject(seq uint64, subj string, hdr []byte, obs *consumer) bool {
 	for _, o := range mset.consumers {
 		// If this is us or we have a registered preAck for this consumer continue inspecting.
 		if o == obs || mset.hasPreAck(o, seq) {
 			continue
 		}
 		// Check if we need an ack.
-		if o.needAck(seq, subj) {
+		if o.needAck(seq, subj, hdr) {
 			return true
 		}
 	}
@@ -9291,13 +10147,13 @@ func (mset *stream) hasPreAck(o *consumer, seq uint64) bool {
 
 // Check if we have all consumers pre-acked for this sequence and subject.
 // Write lock should be held.
-func (mset *stream) hasAllPreAcks(seq uint64, subj string) bool {
+func (mset *stream) hasAllPreAcks(seq uint64, subj string, hdr []byte) bool {
 	if len(mset.preAcks) == 0 || len(mset.preAcks[seq]) == 0 {
 		return false
 	}
 	// Since these can be filtered and mutually exclusive,
 	// if we have some preAcks we need to check all interest here.
-	return mset.noInterestWithSubject(seq, subj, nil)
+	return mset.noInterestWithSubject(seq, subj, hdr, nil)
 }
 
 // Check if we have all consumers pre-acked.
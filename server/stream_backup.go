@@ -375,7 +375,7 @@ func (a *Account) RestoreStreamV2(ncfg *StreamConfig, r io.Reader) (retMset *str
 		var state StreamState
 		mset.store.FastState(&state)
 		mset.mu.Lock()
-		mset.lseq = state.LastSeq
+		mset.setLastSeq(state.LastSeq)
 		mset.mu.Unlock()
 		if err := mset.completeRestore(); err != nil {
 			if err = fmt.Errorf("failed to activate stream %q: %w", cfg.Name, err); retErr == nil {
@@ -0,0 +1,157 @@
+// Copyright 2026 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Direct get requests can set a minimum last sequence, for example the sequence of a PubAck the client
+// just received. A replica that has not applied that sequence yet waits for it to be applied.
+// If it is still behind after a short wait, the request is forwarded to the stream leader.
+// The leader, or a replica that can not forward, responds with a 412 once the wait is over.
+
+const (
+	// How long a direct get waits for the minimum last sequence to be applied.
+	directGetMinSeqWait = 250 * time.Millisecond
+	// Maximum number of direct gets waiting per stream, further requests skip the wait.
+	maxDirectGetWaits = 1024
+
+	clusterDirectGetT = "$JSC.DG.%s.%s"
+)
+
+// directGetWait is a direct get request waiting for its minimum last sequence to be applied.
+type directGetWait struct {
+	req       JSApiMsgGetRequest
+	reply     string
+	forwarded bool
+	timer     *time.Timer
+}
+
+// directGetForward is a direct get request forwarded by a replica to the stream leader.
+type directGetForward struct {
+	Request JSApiMsgGetRequest `json:"req"`
+	Reply   string             `json:"reply"`
+}
+
+// checkDirectGetMinSeq returns whether the direct get request can be served now.
+// If the stream did not apply the minimum last sequence yet, the request is held until
+// it does, or the wait is over, and false is returned.
+func (mset *stream) checkDirectGetMinSeq(req *JSApiMsgGetRequest, reply string, forwarded bool) bool {
+	if req.MinLastSeq == 0 || mset.lastSeq() >= req.MinLastSeq {
+		return true
+	}
+	w := &directGetWait{req: *req, reply: reply, forwarded: forwarded}
+	mset.dgwMu.Lock()
+	if len(mset.dgWaits) >= maxDirectGetWaits {
+		mset.dgwMu.Unlock()
+		mset.directGetMinSeqExpired(w)
+		return false
+	}
+	if mset.dgWaits == nil {
+		mset.dgWaits = make(map[*directGetWait]struct{})
+	}
+	mset.dgWaits[w] = struct{}{}
+	mset.dgWaiting.Add(1)
+	w.timer = time.AfterFunc(directGetMinSeqWait, func() {
+		if mset.removeDirectGetWait(w) {
+			mset.directGetMinSeqExpired(w)
+		}
+	})
+	mset.dgwMu.Unlock()
+
+	// We could have applied the sequence in the meantime.
+	if mset.lastSeq() >= req.MinLastSeq && mset.removeDirectGetWait(w) {
+		w.timer.Stop()
+		return true
+	}
+	return false
+}
+
+// removeDirectGetWait removes a waiting request, returns whether it was still waiting.
+func (mset *stream) removeDirectGetWait(w *directGetWait) bool {
+	mset.dgwMu.Lock()
+	defer mset.dgwMu.Unlock()
+	if _, ok := mset.dgWaits[w]; !ok {
+		return false
+	}
+	delete(mset.dgWaits, w)
+	mset.dgWaiting.Add(-1)
+	return true
+}
+
+// releaseDirectGetWaits queues the waiting requests whose minimum last sequence was applied.
+// Called when the last sequence moves, stream lock can be held.
+func (mset *stream) releaseDirectGetWaits(lseq uint64) {
+	mset.dgwMu.Lock()
+	defer mset.dgwMu.Unlock()
+	for w := range mset.dgWaits {
+		if w.req.MinLastSeq <= lseq {
+			w.timer.Stop()
+			delete(mset.dgWaits, w)
+			mset.dgWaiting.Add(-1)
+			mset.queueDirectGet(&w.req, w.reply)
+		}
+	}
+}
+
+// stopDirectGetWaits stops all waiting requests, used when the stream is stopped.
+func (mset *stream) stopDirectGetWaits() {
+	mset.dgwMu.Lock()
+	defer mset.dgwMu.Unlock()
+	for w := range mset.dgWaits {
+		w.timer.Stop()
+	}
+	mset.dgWaits = nil
+	mset.dgWaiting.Store(0)
+}
+
+// directGetMinSeqExpired is called once a request waited for its minimum last sequence.
+// A replica forwards the request to the leader, otherwise we respond that we are behind.
+func (mset *stream) directGetMinSeqExpired(w *directGetWait) {
+	if mset.lastSeq() >= w.req.MinLastSeq {
+		mset.queueDirectGet(&w.req, w.reply)
+		return
+	}
+	mset.mu.RLock()
+	canForward := !w.forwarded && mset.isClustered() && !mset.isLeader() && mset.cfg.Mirror == nil
+	subj := fmt.Sprintf(clusterDirectGetT, mset.jsa.acc(), mset.cfg.Name)
+	mset.mu.RUnlock()
+	if canForward {
+		mset.srv.sendInternalMsgLocked(subj, _EMPTY_, nil, &directGetForward{Request: w.req, Reply: w.reply})
+		return
+	}
+	hdr := []byte("NATS/1.0 412 Min Last Sequence\r\n\r\n")
+	mset.outq.send(newJSPubMsg(w.reply, _EMPTY_, _EMPTY_, hdr, nil, nil, 0))
+}
+
+// queueDirectGet queues a direct get request to be served by the stream's internal loop.
+func (mset *stream) queueDirectGet(req *JSApiMsgGetRequest, reply string) {
+	dg := dgPool.Get().(*directGetReq)
+	dg.req, dg.reply = *req, reply
+	mset.gets.push(dg)
+}
+
+// handleClusterDirectGetRequest handles direct gets forwarded to us as the leader.
+func (mset *stream) handleClusterDirectGetRequest(_ *subscription, _ *client, _ *Account, _, _ string, msg []byte) {
+	var fwd directGetForward
+	if err := json.Unmarshal(msg, &fwd); err != nil || fwd.Reply == _EMPTY_ {
+		return
+	}
+	if mset.checkDirectGetMinSeq(&fwd.Request, fwd.Reply, true) {
+		mset.queueDirectGet(&fwd.Request, fwd.Reply)
+	}
+}
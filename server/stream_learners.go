@@ -0,0 +1,218 @@
+// Copyright 2026 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+)
+
+// Learners of a stream follow the log of its Raft group without being a peer of it. They don't
+// vote and don't count towards quorum, so they add read capacity for direct gets, or a copy in
+// another cluster, without making writes any slower. Learners are only part of the assignment,
+// the group leader never adds them to the peer set. Promoting a learner scales the stream up,
+// with the learner as the peer to add, after which it's no longer a learner.
+
+// checkStreamLearners checks the learner settings of a stream config.
+func checkStreamLearners(cfg *StreamConfig, clustered bool) error {
+	if cfg.Learners == 0 {
+		if cfg.LearnerPlacement != nil {
+			return errors.New("learner placement requires learners")
+		}
+		return nil
+	}
+	if !clustered {
+		return errors.New("learners require clustered mode")
+	}
+	if cfg.Learners < 0 || cfg.Learners > StreamMaxReplicas {
+		return fmt.Errorf("learners must be between 0 and %d", StreamMaxReplicas)
+	}
+	if cfg.Replicas < 2 {
+		return errors.New("learners require a replicated stream")
+	}
+	// Messages are removed by the consumers on each replica, and learners have none.
+	if cfg.Retention != LimitsPolicy {
+		return errors.New("learners require limits retention")
+	}
+	if cfg.Partitions != 0 {
+		return errors.New("partitioned streams can not have learners")
+	}
+	return nil
+}
+
+// isLearner returns whether the peer is a learner of the group.
+// A learner that is being promoted stays one until it's part of the peers.
+func (rg *raftGroup) isLearner(id string) bool {
+	if rg == nil {
+		return false
+	}
+	return slices.Contains(rg.Learners, id) && !slices.Contains(rg.Peers, id)
+}
+
+// isMemberOrLearner returns whether the peer runs the group, as a member or a learner.
+func (rg *raftGroup) isMemberOrLearner(id string) bool {
+	return rg.isMember(id) || rg.isLearner(id)
+}
+
+// learners returns the learners of the group, without those that are being promoted.
+func (rg *raftGroup) learners() []string {
+	if rg == nil {
+		return nil
+	}
+	var learners []string
+	for _, peer := range rg.Learners {
+		if !slices.Contains(rg.Peers, peer) && (rg.Desired == nil || !slices.Contains(rg.Desired.Peers, peer)) {
+			learners = append(learners, peer)
+		}
+	}
+	return learners
+}
+
+// selectStreamLearners selects the learners of the group, keeping the existing learners where possible.
+// Learners are placed with the learner placement if set, and always apart from the peers of the group.
+// Lock should be held.
+func (cc *jetStreamCluster) selectStreamLearners(cfg *StreamConfig, rg *raftGroup, existing []string, ignore ...string) ([]string, *selectPeerError) {
+	if cfg.Learners <= 0 {
+		return nil, nil
+	}
+	lcfg := cfg
+	cluster := rg.Cluster
+	if cfg.LearnerPlacement != nil {
+		lcfg = cfg.clone()
+		lcfg.Placement = cfg.LearnerPlacement
+		if cfg.LearnerPlacement.Cluster != _EMPTY_ {
+			cluster = cfg.LearnerPlacement.Cluster
+		}
+	}
+	ignore = append(ignore, rg.Peers...)
+	if rg.Desired != nil {
+		ignore = append(ignore, rg.Desired.Peers...)
+	}
+	var keep []string
+	for _, peer := range existing {
+		if !slices.Contains(ignore, peer) {
+			keep = append(keep, peer)
+		}
+	}
+	peers, err := cc.selectPeerGroup(cfg.Learners, cluster, lcfg, keep, 0, ignore)
+	if len(peers) < cfg.Learners {
+		if err == nil {
+			err = &selectPeerError{misc: true}
+		}
+		return nil, err
+	}
+	return peers, nil
+}
+
+// updateStreamLearners updates the learners of the group if the config changed them.
+// Learners are kept where possible, unless their placement changed.
+// Lock should be held.
+func (cc *jetStreamCluster) updateStreamLearners(ocfg, cfg *StreamConfig, orig, rg *raftGroup) *ApiError {
+	placementChanged := !reflect.DeepEqual(ocfg.LearnerPlacement, cfg.LearnerPlacement)
+	if cfg.Learners == ocfg.Learners && !placementChanged {
+		return nil
+	}
+	// A learner could be in the middle of being promoted.
+	if orig.Desired != nil {
+		return NewJSStreamReconfigureInProgressError()
+	}
+	var existing []string
+	if !placementChanged {
+		existing = orig.learners()
+	}
+	learners, err := cc.selectStreamLearners(cfg, rg, existing)
+	if err != nil {
+		return NewJSClusterNoPeersError(err)
+	}
+	rg.Learners = learners
+	return nil
+}
+
+// replaceStreamLearnerLocked replaces a learner of the stream that is removed or evacuated.
+// The learner is dropped, even if there's no replacement for it.
+// Lock should be held.
+func (js *jetStream) replaceStreamLearnerLocked(sa *streamAssignment, peer string) bool {
+	cc := js.cluster
+	if cc == nil || cc.meta == nil || !sa.Group.isLearner(peer) {
+		return false
+	}
+	csa := sa.copyGroup()
+	csa.Subject, csa.Reply = _EMPTY_, _EMPTY_
+	rg := csa.Group
+	existing := slices.DeleteFunc(rg.learners(), func(learner string) bool { return learner == peer })
+	learners, err := cc.selectStreamLearners(csa.Config, rg, existing, peer)
+	if err != nil {
+		cc.s.Warnf("JetStream cluster could not replace learner for stream '%s > %s'", sa.Client.serviceAccount(), sa.Config.Name)
+		learners = existing
+	}
+	rg.Learners = learners
+	if err := cc.meta.Propose(cc.term, encodeUpdateStreamAssignment(csa)); err != nil {
+		return false
+	}
+	cc.trackInflightStreamProposal(sa.Client.serviceAccount(), csa, false)
+	return true
+}
+
+// promoteStreamLearnerLocked promotes a learner of the stream to a voting replica.
+// The stream is scaled up, with the learner as the peer to add.
+// Lock should be held.
+func (js *jetStream) promoteStreamLearnerLocked(acc *Account, sa *streamAssignment, peer string) *ApiError {
+	cc := js.cluster
+	if cc == nil || cc.meta == nil {
+		return NewJSClusterNotActiveError()
+	}
+	if !sa.Group.isLearner(peer) {
+		return NewJSClusterPeerNotLearnerError()
+	}
+	// Promoting goes through desired state, so it can't be combined with another reconfiguration.
+	if sa.moveInFlight() {
+		return NewJSStreamMoveInProgressError()
+	}
+	if sa.Group.Desired != nil {
+		return NewJSStreamReconfigureInProgressError()
+	}
+	if sa.Config.Replicas >= StreamMaxReplicas {
+		return NewJSStreamInvalidConfigError(fmt.Errorf("maximum replicas is %d", StreamMaxReplicas))
+	}
+
+	cfg := sa.Config.clone()
+	cfg.Replicas++
+	cfg.Learners--
+	if cfg.Learners == 0 {
+		cfg.LearnerPlacement = nil
+	}
+	if apiErr := js.jsClusteredStreamLimitsCheck(acc, cfg); apiErr != nil {
+		return apiErr
+	}
+
+	rg := sa.copyGroup().Group
+	rg.ScaleUp = false
+	rg.Preferred = _EMPTY_
+	rg.Peers = append(rg.Peers, peer)
+	rg = sa.Group.withDesired(rg)
+	rg.populateOrigin(sa)
+
+	syncSubject := sa.Sync
+	if syncSubject == _EMPTY_ {
+		syncSubject = syncSubjForStream()
+	}
+	nsa := &streamAssignment{Group: rg, Sync: syncSubject, Created: sa.Created, Config: cfg, Client: sa.Client}
+	if err := cc.meta.Propose(cc.term, encodeUpdateStreamAssignment(nsa)); err != nil {
+		return NewJSClusterNotAvailError()
+	}
+	cc.trackInflightStreamProposal(acc.Name, nsa, false)
+	return nil
+}
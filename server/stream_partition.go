@@ -0,0 +1,254 @@
+// Copyright 2026 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A partitioned stream is made up of a number of streams, each with its own raft group.
+// The first partition keeps the name of the partitioned stream, the others are named
+// <name>#<partition>. All partitions share the subjects of the partitioned stream and
+// each stores the messages whose subject hashes to it, using the partition subject transform.
+// Stream and consumer requests for the partitioned stream are applied to all partitions.
+// Sequences are assigned per partition, so message requests apply to the partition they are sent to.
+// Since partitions are decided by a hash of the subject, the subjects a partition stores can't be
+// expressed as a subscription. The leader of the first partition subscribes to the subjects of the
+// stream, and routes the messages of the other partitions with the partition subject transform to
+// $JS.PART.<name>.<partition>.<subject>, which the leaders of the other partitions subscribe to.
+// The partition storing a message acknowledges it. All messages are received by the leader of the
+// first partition, so ingest is bound by what a single server can route, while storing and
+// replicating the messages is spread across the partitions.
+// Consumers are created on every partition. Push consumers fan in through their shared deliver
+// subject, pull consumers through their shared pull request subject, each partition delivering in order.
+// A pull request is split across the partitions, each serving its share of the batch, so the client
+// never gets more messages than it asked for. One of them replies with the status of the request,
+// after the others expired.
+
+const (
+	// Separator between the partitioned stream name and the partition.
+	partitionSep = "#"
+	// Prefix of the subjects messages are routed to partitions on, followed by the
+	// partitioned stream name, the partition and the subject of the message.
+	jsPartitionPre = "$JS.PART"
+	// Maximum number of partitions of a stream.
+	maxStreamPartitions = 64
+	// How much earlier than the partition replying with the status of a pull request the others expire.
+	partitionPullMargin = 100 * time.Millisecond
+)
+
+// StreamPartitionInfo shows information about a single partition of a partitioned stream.
+type StreamPartitionInfo struct {
+	Name    string       `json:"name"`
+	State   StreamState  `json:"state"`
+	Cluster *ClusterInfo `json:"cluster,omitempty"`
+}
+
+// partitionStreamName returns the name of the stream for the partition.
+func partitionStreamName(name string, partition int) string {
+	if partition == 0 {
+		return name
+	}
+	return name + partitionSep + strconv.Itoa(partition)
+}
+
+// partitionedStreamName returns the name of the partitioned stream this config belongs to.
+func (cfg *StreamConfig) partitionedStreamName() string {
+	if cfg.Partition == 0 {
+		return cfg.Name
+	}
+	return strings.TrimSuffix(cfg.Name, partitionSep+strconv.Itoa(cfg.Partition))
+}
+
+// isPartitioned returns whether this config belongs to a partitioned stream.
+func (cfg *StreamConfig) isPartitioned() bool {
+	return cfg.Partitions > 1
+}
+
+// samePartitionedStream returns whether both configs are partitions of the same partitioned stream.
+func samePartitionedStream(a, b *StreamConfig) bool {
+	return a != nil && b != nil && a.isPartitioned() && b.isPartitioned() &&
+		a.partitionedStreamName() == b.partitionedStreamName()
+}
+
+// partitionConfig returns the config for a partition, based on the config of the partitioned stream.
+func (cfg *StreamConfig) partitionConfig(partition int) *StreamConfig {
+	pcfg := cfg.clone()
+	pcfg.Name = partitionStreamName(cfg.partitionedStreamName(), partition)
+	pcfg.Partition = partition
+	return pcfg
+}
+
+// streamPartitioner routes messages to the partition that stores them.
+type streamPartitioner struct {
+	tr       *subjectTransform
+	pre      string
+	subjects []string
+}
+
+func newStreamPartitioner(cfg *StreamConfig) (*streamPartitioner, error) {
+	tr, err := NewSubjectTransform(fwcs, fmt.Sprintf("%s.%s.{{partition(%d)}}.%s", jsPartitionPre, cfg.partitionedStreamName(), cfg.Partitions, fwcs))
+	if err != nil {
+		return nil, err
+	}
+	pre := fmt.Sprintf("%s.%s.%d.", jsPartitionPre, cfg.partitionedStreamName(), cfg.Partition)
+	return &streamPartitioner{tr: tr, pre: pre, subjects: copyStrings(cfg.Subjects)}, nil
+}
+
+// ingestSubjects returns the subjects the partition receives messages on. The first partition
+// receives the messages on the subjects of the stream, the others only the messages routed to them.
+func (p *streamPartitioner) ingestSubjects(cfg *StreamConfig) []string {
+	if cfg.Partition == 0 {
+		return cfg.Subjects
+	}
+	return []string{p.pre + fwcs}
+}
+
+// route returns the subject of the message and true if it's stored by our partition.
+// Otherwise returns the subject to route the message to its partition on.
+func (p *streamPartitioner) route(subject string) (string, bool) {
+	if strings.HasPrefix(subject, p.pre) {
+		// Routed to us, only store it if it's one of ours.
+		subject = subject[len(p.pre):]
+		for _, subj := range p.subjects {
+			if subjectIsSubsetMatch(subject, subj) && strings.HasPrefix(p.tr.TransformSubject(subject), p.pre) {
+				return subject, true
+			}
+		}
+		return _EMPTY_, false
+	}
+	if rsubj := p.tr.TransformSubject(subject); !strings.HasPrefix(rsubj, p.pre) {
+		return rsubj, false
+	}
+	return subject, true
+}
+
+// pullRequestStart returns the partition a pull request is split from, picked by its reply
+// subject so that small requests are spread across partitions.
+func pullRequestStart(reply string, partitions int) int {
+	h := fnv.New32a()
+	h.Write([]byte(reply))
+	return int(h.Sum32() % uint32(partitions))
+}
+
+// pullRequestShare returns the number of messages and bytes of a pull request our partition serves.
+// The partition the split starts at serves at least one message.
+// Lock should be held.
+func (o *consumer) pullRequestShare(reply string, batch, maxBytes int) (int, int) {
+	k := (o.partition - pullRequestStart(reply, o.partitions) + o.partitions) % o.partitions
+	n := batch / o.partitions
+	if k < batch%o.partitions {
+		n++
+	}
+	if maxBytes > 0 && n > 0 {
+		maxBytes = max(maxBytes*n/batch, 1)
+	}
+	return n, maxBytes
+}
+
+// repliesToPull returns whether we reply with the status of the pull request.
+// Only the partition a request is split from does for partitioned streams.
+// Lock should be held.
+func (o *consumer) repliesToPull(reply string) bool {
+	return o.partitions == 0 || pullRequestStart(reply, o.partitions) == o.partition
+}
+
+// proposeAll proposes the entries to the meta layer at once, so that changes to all the
+// partitions of a partitioned stream either are all made or none are.
+// Lock should be held.
+func (cc *jetStreamCluster) proposeAll(entries [][]byte) error {
+	if len(entries) == 1 {
+		return cc.meta.Propose(cc.term, entries[0])
+	}
+	es := make([]*Entry, 0, len(entries))
+	for _, e := range entries {
+		es = append(es, newEntry(EntryNormal, e))
+	}
+	return cc.meta.ProposeMulti(cc.term, es)
+}
+
+// partitionAssignments returns the stream assignments of the other partitions, indexed by partition.
+// The entry for our own partition and partitions that are not assigned are nil.
+// Lock should be held.
+func (js *jetStream) partitionAssignments(accName string, cfg *StreamConfig) []*streamAssignment {
+	if !cfg.isPartitioned() {
+		return nil
+	}
+	name := cfg.partitionedStreamName()
+	sas := make([]*streamAssignment, cfg.Partitions)
+	for i := range sas {
+		if i != cfg.Partition {
+			sas[i] = js.streamAssignmentOrInflight(accName, partitionStreamName(name, i))
+		}
+	}
+	return sas
+}
+
+// addPartitionsInfo adds the state of the other partitions to the stream info of the
+// first partition, and aggregates the state across all partitions.
+// Sequences are assigned per partition, so the aggregated state does not include them.
+func (s *Server) addPartitionsInfo(acc *Account, si *StreamInfo) {
+	cfg := &si.Config
+	if !cfg.isPartitioned() || cfg.Partition != 0 {
+		return
+	}
+	infos := make([]*StreamInfo, cfg.Partitions)
+	var wg sync.WaitGroup
+	for i := 1; i < cfg.Partitions; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			infos[i], _ = sysRequest[StreamInfo](s, clusterStreamInfoT, acc.Name, partitionStreamName(cfg.Name, i))
+		}(i)
+	}
+	wg.Wait()
+
+	state := si.State
+	state.Subjects, state.Deleted = nil, nil
+	si.Partitions = append(si.Partitions, &StreamPartitionInfo{Name: cfg.Name, State: state, Cluster: si.Cluster})
+
+	agg := &si.State
+	agg.FirstSeq, agg.LastSeq = 0, 0
+	agg.Deleted = nil
+	if agg.Msgs == 0 {
+		agg.FirstTime = time.Time{}
+	}
+	for i := 1; i < cfg.Partitions; i++ {
+		pi := &StreamPartitionInfo{Name: partitionStreamName(cfg.Name, i)}
+		si.Partitions = append(si.Partitions, pi)
+		psi := infos[i]
+		if psi == nil {
+			continue
+		}
+		pi.State, pi.Cluster = psi.State, psi.Cluster
+		pst := &psi.State
+		agg.Msgs += pst.Msgs
+		agg.Bytes += pst.Bytes
+		agg.NumDeleted += pst.NumDeleted
+		agg.NumSubjects += pst.NumSubjects
+		if pst.Msgs > 0 {
+			if agg.FirstTime.IsZero() || pst.FirstTime.Before(agg.FirstTime) {
+				agg.FirstTime = pst.FirstTime
+			}
+			if pst.LastTime.After(agg.LastTime) {
+				agg.LastTime = pst.LastTime
+			}
+		}
+	}
+}
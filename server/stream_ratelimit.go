@@ -0,0 +1,158 @@
+// Copyright 2026 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// How often we will sweep the per subject limiters that have been idle long enough to be full again.
+const ingestLimiterPruneInterval = 10 * time.Second
+
+// Most per subject limiters we keep. Once reached, new subjects share a single overflow limiter,
+// so a high number of subjects can't use up memory in between sweeps.
+const ingestLimiterMaxSubjects = 100_000
+
+// How often we will sweep early when the per subject limiters are at the maximum.
+const ingestLimiterFullPruneInterval = time.Second
+
+// ingestLimiter enforces a StreamIngestRateLimit. This is soft state that is
+// only kept by the leader, it is not replicated and starts out full.
+type ingestLimiter struct {
+	mu       sync.Mutex
+	stream   *rate.Limiter            // Stream wide limiter, if any.
+	srate    rate.Limit               // Per subject rate, zero if not limiting per subject.
+	sburst   int                      // Per subject burst.
+	filters  []string                 // Subject filters for the per subject limit, all subjects if empty.
+	subjects map[string]*rate.Limiter // Per subject limiters.
+	overflow *rate.Limiter            // Shared by subjects that don't fit in the per subject limiters.
+	lprune   time.Time                // Last time we pruned the per subject limiters.
+	limited  atomic.Uint64            // Number of messages that were rejected or dropped.
+}
+
+// ingestLimiterBurst returns the bucket size for the given per second rate.
+func ingestLimiterBurst(perSec, burst uint64) int {
+	if burst == 0 {
+		burst = perSec
+	}
+	return int(min(max(burst, 1), math.MaxInt32))
+}
+
+// newIngestLimiter returns a limiter for the given config, or nil if not limited.
+func newIngestLimiter(cfg *StreamIngestRateLimit) *ingestLimiter {
+	if cfg == nil || (cfg.MaxMsgsPerSec == 0 && cfg.MaxMsgsPerSubjectPerSec == 0) {
+		return nil
+	}
+	il := &ingestLimiter{filters: copyStrings(cfg.Subjects), lprune: time.Now()}
+	if cfg.MaxMsgsPerSec > 0 {
+		il.stream = rate.NewLimiter(rate.Limit(cfg.MaxMsgsPerSec), ingestLimiterBurst(cfg.MaxMsgsPerSec, cfg.Burst))
+	}
+	if cfg.MaxMsgsPerSubjectPerSec > 0 {
+		il.srate = rate.Limit(cfg.MaxMsgsPerSubjectPerSec)
+		il.sburst = ingestLimiterBurst(cfg.MaxMsgsPerSubjectPerSec, cfg.Burst)
+		il.subjects = make(map[string]*rate.Limiter)
+	}
+	return il
+}
+
+// allow reports whether a message on this subject can be accepted, and takes
+// a token from both the stream and the subject bucket if so.
+func (il *ingestLimiter) allow(subject string) bool {
+	if il == nil {
+		return true
+	}
+	now := time.Now()
+
+	il.mu.Lock()
+	defer il.mu.Unlock()
+
+	var sl *rate.Limiter
+	if il.subjects != nil && il.matches(subject) {
+		if sl = il.subjects[subject]; sl == nil {
+			if len(il.subjects) >= ingestLimiterMaxSubjects && now.Sub(il.lprune) >= ingestLimiterFullPruneInterval {
+				il.lprune = time.Time{}
+				il.pruneLocked(now)
+			}
+			if len(il.subjects) < ingestLimiterMaxSubjects {
+				sl = rate.NewLimiter(il.srate, il.sburst)
+				il.subjects[subject] = sl
+			} else {
+				if il.overflow == nil {
+					il.overflow = rate.NewLimiter(il.srate, il.sburst)
+				}
+				sl = il.overflow
+			}
+		}
+	}
+	// Only take tokens if both buckets allow it, otherwise a rejected
+	// message would still drain the bucket that did have room.
+	if (sl != nil && sl.TokensAt(now) < 1) || (il.stream != nil && il.stream.TokensAt(now) < 1) {
+		il.limited.Add(1)
+		return false
+	}
+	if sl != nil {
+		sl.AllowN(now, 1)
+	}
+	if il.stream != nil {
+		il.stream.AllowN(now, 1)
+	}
+	il.pruneLocked(now)
+	return true
+}
+
+// matches returns whether the per subject limit applies to this subject.
+// Lock should be held.
+func (il *ingestLimiter) matches(subject string) bool {
+	if len(il.filters) == 0 {
+		return true
+	}
+	for _, filter := range il.filters {
+		if subjectIsSubsetMatch(subject, filter) {
+			return true
+		}
+	}
+	return false
+}
+
+// pruneLocked removes per subject limiters that are full again, since
+// a new limiter would behave exactly the same.
+// Lock should be held.
+func (il *ingestLimiter) pruneLocked(now time.Time) {
+	if len(il.subjects) == 0 || now.Sub(il.lprune) < ingestLimiterPruneInterval {
+		return
+	}
+	il.lprune = now
+	burst := float64(il.sburst)
+	for subj, sl := range il.subjects {
+		if sl.TokensAt(now) >= burst {
+			delete(il.subjects, subj)
+		}
+	}
+	if il.overflow != nil && il.overflow.TokensAt(now) >= burst {
+		il.overflow = nil
+	}
+}
+
+// numLimited returns the number of messages that were rejected or dropped.
+func (il *ingestLimiter) numLimited() uint64 {
+	if il == nil {
+		return 0
+	}
+	return il.limited.Load()
+}
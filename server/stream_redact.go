@@ -0,0 +1,385 @@
+// Copyright 2026 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server/avl"
+	"github.com/nats-io/nuid"
+)
+
+// A redacted message keeps its sequence, subject and timestamp, but its payload and the
+// requested headers are removed. The Nats-Redacted header is set to the time of the redaction,
+// and Nats-Redacted-Headers lists the headers that were removed.
+// Mirrors and sources that already received the message are sent a control message through
+// their consumer, so they redact their copy as well instead of deleting it.
+// The sequences of redacted messages are kept with the stream, and the control messages are
+// sent again whenever a mirror or source connects, so redactions are not lost while they were
+// not connected. Everything else is taken from the redacted message itself.
+// In clustered mode the original payload is also in our log, so a redaction triggers a snapshot
+// to compact the log past it.
+
+const (
+	// Status line of the control message sent to mirrors and sources for a redacted message.
+	redactedCtrlStatus = "NATS/1.0 100 Redacted\r\n"
+	// Maximum number of headers that can be redacted in a single request.
+	maxRedactHeaders = 64
+	// File with the sequences of redacted messages, for file based streams.
+	redactedStateFile = "redacted.idx"
+)
+
+var redactedCtrlHdr = []byte(redactedCtrlStatus)
+
+// checkRedactHeaders checks the names of the headers to be redacted.
+// JetStream headers can not be redacted, since the stream relies on them.
+func checkRedactHeaders(names []string) error {
+	if len(names) > maxRedactHeaders {
+		return fmt.Errorf("can not redact more than %d headers", maxRedactHeaders)
+	}
+	for _, name := range names {
+		if name == _EMPTY_ || strings.ContainsAny(name, ":, \t\r\n") {
+			return fmt.Errorf("header %q is invalid", name)
+		}
+		if len(name) >= 5 && strings.EqualFold(name[:5], "Nats-") {
+			return fmt.Errorf("header %q can not be redacted", name)
+		}
+	}
+	return nil
+}
+
+// redactedHeader returns the headers of a redacted message, based on the original headers.
+// Redacting a message again keeps track of the headers removed before.
+func redactedHeader(hdr []byte, names []string, ts time.Time) []byte {
+	hdr = copyBytes(hdr)
+	var removed []string
+	if prev := sliceHeader(JSRedactedHeaders, hdr); len(prev) > 0 {
+		removed = strings.Split(string(prev), ",")
+	}
+	for _, name := range names {
+		hdr = removeHeaderIfPresent(hdr, name)
+		if !slices.Contains(removed, name) {
+			removed = append(removed, name)
+		}
+	}
+	hdr = removeHeaderIfPresent(hdr, JSRedacted)
+	hdr = removeHeaderIfPresent(hdr, JSRedactedHeaders)
+	hdr = genHeader(hdr, JSRedacted, ts.UTC().Format(time.RFC3339Nano))
+	if len(removed) > 0 {
+		hdr = genHeader(hdr, JSRedactedHeaders, strings.Join(removed, ","))
+	}
+	return hdr
+}
+
+// redactMsg redacts a message in the store.
+// Returns the subject of the message, and whether it was found.
+func (mset *stream) redactMsg(r *streamMsgRedact) (string, bool, error) {
+	if mset.closed.Load() {
+		return _EMPTY_, false, errStreamClosed
+	}
+	// Redactions mutate message state, so hold the isolation lock like any other write.
+	mset.isolateMu.Lock()
+	defer mset.isolateMu.Unlock()
+
+	var smv StoreMsg
+	sm, err := mset.store.LoadMsg(r.Seq, &smv)
+	if err != nil {
+		if err == ErrStoreMsgNotFound || err == errDeletedMsg || err == ErrStoreEOF {
+			err = nil
+		}
+		return _EMPTY_, false, err
+	}
+	subj := copyString(sm.subj)
+	hdr := redactedHeader(sm.hdr, r.Headers, r.Time)
+	// Already redacted, for example when replaying.
+	if len(sm.msg) == 0 && bytes.Equal(hdr, sm.hdr) {
+		return subj, true, nil
+	}
+	ok, err := mset.store.RedactMsg(r.Seq, hdr)
+	return subj, ok, err
+}
+
+// applyRedaction redacts a message, and as the leader lets our mirrors, sources
+// and anyone interested in the advisory know about it.
+func (mset *stream) applyRedaction(r *streamMsgRedact, isLeader bool) (bool, error) {
+	subj, ok, err := mset.redactMsg(r)
+	if err != nil || !ok {
+		return ok, err
+	}
+	mset.trackRedacted(r.Seq)
+	if mset.IsClustered() {
+		mset.redactSnap.Store(true)
+	}
+	if !isLeader {
+		return true, nil
+	}
+	hdr := redactedCtrlHeader(r.Seq, r.Time.UTC().Format(time.RFC3339Nano), strings.Join(r.Headers, ","))
+	for _, o := range mset.getDirectConsumers() {
+		o.sendRedactedMsg(r.Seq, subj, hdr)
+	}
+	mset.sendStreamMsgRedactedAdvisory(r, subj)
+	return true, nil
+}
+
+// redactedCtrlHeader returns the header of the control message for a redacted message.
+func redactedCtrlHeader(seq uint64, ts, names string) []byte {
+	hdr := fmt.Appendf(nil, "%s%s: %d\r\n%s: %s\r\n", redactedCtrlStatus, JSSequence, seq, JSRedacted, ts)
+	if names != _EMPTY_ {
+		hdr = fmt.Appendf(hdr, "%s: %s\r\n", JSRedactedHeaders, names)
+	}
+	return append(hdr, CR_LF...)
+}
+
+// Returns where the sequences of redacted messages are kept, empty for memory based streams.
+func (mset *stream) redactedStatePath() string {
+	mset.mu.RLock()
+	defer mset.mu.RUnlock()
+	if mset.cfg.Storage != FileStorage || mset.jsa == nil {
+		return _EMPTY_
+	}
+	return filepath.Join(mset.jsa.storeDir, streamsDir, mset.cfg.Name, redactedStateFile)
+}
+
+// loadRedacted loads the sequences of redacted messages, when kept on disk.
+func (mset *stream) loadRedacted() {
+	fn := mset.redactedStatePath()
+	if fn == _EMPTY_ {
+		return
+	}
+	buf, err := os.ReadFile(fn)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			mset.srv.Warnf("Error reading redacted messages for '%s > %s': %v", mset.account(), mset.name(), err)
+		}
+		return
+	}
+	ss, _, err := avl.Decode(buf)
+	if err != nil {
+		mset.srv.Warnf("Error decoding redacted messages for '%s > %s': %v", mset.account(), mset.name(), err)
+		return
+	}
+	mset.redactMu.Lock()
+	mset.redacted = ss
+	mset.redactMu.Unlock()
+}
+
+// trackRedacted keeps track of a redacted message, so it can be replayed to mirrors and sources.
+// Messages that are no longer in the stream are dropped at the same time.
+func (mset *stream) trackRedacted(seq uint64) {
+	var state StreamState
+	mset.store.FastState(&state)
+	fn := mset.redactedStatePath()
+
+	mset.redactMu.Lock()
+	defer mset.redactMu.Unlock()
+	if mset.redacted == nil {
+		mset.redacted = &avl.SequenceSet{}
+	}
+	if mset.redacted.Exists(seq) {
+		return
+	}
+	mset.redacted.Insert(seq)
+	if min, _ := mset.redacted.MinMax(); min < state.FirstSeq {
+		var gone []uint64
+		mset.redacted.Range(func(seq uint64) bool {
+			if seq >= state.FirstSeq {
+				return false
+			}
+			gone = append(gone, seq)
+			return true
+		})
+		for _, seq := range gone {
+			mset.redacted.Delete(seq)
+		}
+	}
+	if fn == _EMPTY_ {
+		return
+	}
+	if err := writeFileWithSync(mset.srv.diskIOSemaphore(), fn, mset.redacted.Encode(nil), defaultFilePerms); err != nil {
+		mset.srv.Warnf("Error writing redacted messages for '%s > %s': %v", mset.account(), mset.name(), err)
+	}
+}
+
+// replayRedactions sends the control message for all redacted messages that the direct consumer
+// of a mirror or source already passed on, since they could have missed them.
+// Called when the consumer is created, and whenever the mirror or source subscribes again.
+func (mset *stream) replayRedactions(o *consumer) {
+	mset.redactMu.Lock()
+	var seqs []uint64
+	if mset.redacted != nil {
+		seqs = make([]uint64, 0, mset.redacted.Size())
+		mset.redacted.Range(func(seq uint64) bool {
+			seqs = append(seqs, seq)
+			return true
+		})
+	}
+	mset.redactMu.Unlock()
+
+	var smv StoreMsg
+	for _, seq := range seqs {
+		sm, err := mset.store.LoadMsg(seq, &smv)
+		if err != nil || len(sm.msg) > 0 {
+			continue
+		}
+		ts := sliceHeader(JSRedacted, sm.hdr)
+		if len(ts) == 0 {
+			continue
+		}
+		hdr := redactedCtrlHeader(seq, string(ts), string(sliceHeader(JSRedactedHeaders, sm.hdr)))
+		o.sendRedactedMsg(seq, sm.subj, hdr)
+	}
+}
+
+// sendRedactedMsg lets the mirror or source behind this direct consumer know
+// that a message it already received was redacted.
+func (o *consumer) sendRedactedMsg(seq uint64, subj string, hdr []byte) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	if o.outq == nil || o.dsubj == _EMPTY_ || !o.active || seq >= o.sseq || !o.isFilteredMatch(subj) {
+		return
+	}
+	o.outq.send(newJSPubMsg(o.dsubj, _EMPTY_, _EMPTY_, hdr, nil, nil, 0))
+}
+
+func (mset *stream) sendStreamMsgRedactedAdvisory(r *streamMsgRedact, subj string) {
+	s := mset.srv
+	stream, acc := mset.name(), mset.account()
+	asubj := JSAdvisoryStreamMsgRedactedPre + "." + stream
+	adv := &JSStreamMsgRedactedAdvisory{
+		TypedEvent: TypedEvent{
+			Type: JSStreamMsgRedactedAdvisoryType,
+			ID:   nuid.Next(),
+			Time: time.Now().UTC(),
+		},
+		Stream:   stream,
+		Sequence: r.Seq,
+		Subject:  subj,
+		Headers:  r.Headers,
+		Reason:   r.Reason,
+		Client:   r.Client.forAdvisory(),
+		Domain:   s.getOpts().JetStreamDomain,
+	}
+
+	// Send to the user's account if not the system account.
+	if acc != s.SystemAccount() {
+		s.publishAdvisory(acc, asubj, adv)
+	}
+	// Now do system level one. Place account info in adv, and nil account means system.
+	adv.Account = acc.GetName()
+	s.publishAdvisory(nil, asubj, adv)
+}
+
+// isRedactedControlMsg returns whether the control message is for a redacted upstream message.
+func (m *inMsg) isRedactedControlMsg() bool {
+	return bytes.HasPrefix(m.hdr, redactedCtrlHdr)
+}
+
+// redactFromUpstream redacts our copy of a message redacted by the stream we mirror or source from.
+// For a mirror the sequences match, for a source we look up the message by its source header.
+// No locks should be held.
+func (mset *stream) redactFromUpstream(hdr []byte, iname string) {
+	seq := parseInt64(sliceHeader(JSSequence, hdr))
+	ts, err := time.Parse(time.RFC3339Nano, string(sliceHeader(JSRedacted, hdr)))
+	if seq <= 0 || err != nil {
+		return
+	}
+	r := &streamMsgRedact{Seq: uint64(seq), Time: ts}
+	if names := sliceHeader(JSRedactedHeaders, hdr); len(names) > 0 {
+		r.Headers = strings.Split(string(names), ",")
+		if checkRedactHeaders(r.Headers) != nil {
+			return
+		}
+	}
+	if iname != _EMPTY_ {
+		if r.Seq = mset.sourcedMsgSeq(iname, r.Seq); r.Seq == 0 {
+			return
+		}
+	}
+	// Already redacted, for example when the stream replays its redactions once we reconnect.
+	if mset.isRedacted(r) {
+		return
+	}
+
+	mset.mu.RLock()
+	node, term := mset.node, mset.term
+	r.Stream = mset.cfg.Name
+	mset.mu.RUnlock()
+	if node != nil {
+		node.Propose(term, encodeMsgRedact(r))
+		return
+	}
+	if _, err := mset.applyRedaction(r, true); err != nil {
+		mset.srv.RateLimitWarnf("Failed to redact message %d from upstream for '%s > %s': %v",
+			r.Seq, mset.account(), mset.name(), err)
+	}
+}
+
+// isRedacted returns whether the message was already redacted like requested.
+func (mset *stream) isRedacted(r *streamMsgRedact) bool {
+	var smv StoreMsg
+	sm, err := mset.store.LoadMsg(r.Seq, &smv)
+	return err == nil && len(sm.msg) == 0 && bytes.Equal(redactedHeader(sm.hdr, r.Headers, r.Time), sm.hdr)
+}
+
+// sourcedMsgSeq returns our sequence for the message with the given sequence in the source, 0 if not found.
+// Messages from a single source are stored in order, so we binary search our sequences, and
+// at each step look for the next message from the source, up to the end of the range.
+func (mset *stream) sourcedMsgSeq(iname string, sseq uint64) uint64 {
+	var state StreamState
+	mset.store.FastState(&state)
+	if state.Msgs == 0 {
+		return 0
+	}
+	var smv StoreMsg
+	// Returns our sequence and the one in the source for the next message from the source, from start up to end.
+	next := func(start, end uint64) (uint64, uint64) {
+		for seq := start; seq <= end; {
+			sm, nseq, err := mset.store.LoadNextMsg(fwcs, true, seq, &smv)
+			if err != nil || sm == nil || nseq > end {
+				return 0, 0
+			}
+			seq = nseq + 1
+			ss := sliceHeader(JSStreamSource, sm.hdr)
+			if len(ss) == 0 {
+				continue
+			}
+			if _, name, ssseq, _ := streamAndSeq(bytesToString(ss)); name == iname {
+				return nseq, ssseq
+			}
+		}
+		return 0, 0
+	}
+	for lo, hi := state.FirstSeq, state.LastSeq; lo <= hi; {
+		mid := lo + (hi-lo)/2
+		seq, ssseq := next(mid, hi)
+		switch {
+		case seq == 0 || ssseq > sseq:
+			if mid == 0 {
+				return 0
+			}
+			hi = mid - 1
+		case ssseq < sseq:
+			lo = seq + 1
+		default:
+			return seq
+		}
+	}
+	return 0
+}
@@ -0,0 +1,694 @@
+// Copyright 2026 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"unicode/utf8"
+)
+
+// JSONSchemaType is the schema type for JSON Schema definitions.
+const JSONSchemaType = "json_schema"
+
+// StreamSchema binds a schema to the subjects of a stream. Messages published
+// to a matching subject are rejected by the leader if they don't validate.
+type StreamSchema struct {
+	// Subjects restricts the schema to subjects matching these filters. All subjects if empty.
+	Subjects []string `json:"subjects,omitempty"`
+	// Type of the schema, e.g. json_schema. Other types can be registered with RegisterSchemaType.
+	Type string `json:"type"`
+	// Definition of the schema, the format depends on the type.
+	Definition json.RawMessage `json:"definition"`
+}
+
+// SchemaValidator validates message payloads against a compiled schema.
+// Implementations must be safe for concurrent use.
+type SchemaValidator interface {
+	Validate(msg []byte) error
+}
+
+// SchemaCompiler compiles a schema definition into a validator.
+type SchemaCompiler func(definition []byte) (SchemaValidator, error)
+
+var schemaTypes = struct {
+	sync.RWMutex
+	compilers map[string]SchemaCompiler
+}{compilers: map[string]SchemaCompiler{JSONSchemaType: compileJSONSchema}}
+
+// RegisterSchemaType registers a compiler for the given schema type, for example
+// to support Protobuf or Avro descriptors. Registering an existing type replaces it.
+func RegisterSchemaType(typ string, compile SchemaCompiler) {
+	schemaTypes.Lock()
+	defer schemaTypes.Unlock()
+	if compile == nil {
+		delete(schemaTypes.compilers, typ)
+	} else {
+		schemaTypes.compilers[typ] = compile
+	}
+}
+
+// compileSchema compiles the schema using the compiler registered for its type.
+func compileSchema(schema *StreamSchema) (SchemaValidator, error) {
+	schemaTypes.RLock()
+	compile := schemaTypes.compilers[schema.Type]
+	schemaTypes.RUnlock()
+	if compile == nil {
+		return nil, fmt.Errorf("unknown schema type %q", schema.Type)
+	}
+	return compile(schema.Definition)
+}
+
+// streamSchemas holds the compiled schemas for a stream.
+type streamSchemas struct {
+	schemas  []boundSchema
+	rejected atomic.Uint64 // Number of messages that failed validation.
+}
+
+type boundSchema struct {
+	filters []string
+	v       SchemaValidator
+}
+
+// newStreamSchemas compiles the schemas, returns nil if there are none.
+func newStreamSchemas(cfgs []*StreamSchema) (*streamSchemas, error) {
+	if len(cfgs) == 0 {
+		return nil, nil
+	}
+	ss := &streamSchemas{schemas: make([]boundSchema, 0, len(cfgs))}
+	for i, cfg := range cfgs {
+		if cfg == nil {
+			return nil, fmt.Errorf("schema %d is empty", i)
+		}
+		v, err := compileSchema(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("schema %d: %v", i, err)
+		}
+		ss.schemas = append(ss.schemas, boundSchema{filters: copyStrings(cfg.Subjects), v: v})
+	}
+	return ss, nil
+}
+
+// validate checks the message against all schemas bound to its subject.
+func (ss *streamSchemas) validate(subject string, msg []byte) error {
+	if ss == nil {
+		return nil
+	}
+	for _, bs := range ss.schemas {
+		if !bs.matches(subject) {
+			continue
+		}
+		if err := bs.v.Validate(msg); err != nil {
+			ss.rejected.Add(1)
+			return err
+		}
+	}
+	return nil
+}
+
+// numRejected returns the number of messages that failed validation.
+func (ss *streamSchemas) numRejected() uint64 {
+	if ss == nil {
+		return 0
+	}
+	return ss.rejected.Load()
+}
+
+func (bs *boundSchema) matches(subject string) bool {
+	if len(bs.filters) == 0 {
+		return true
+	}
+	for _, filter := range bs.filters {
+		if subjectIsSubsetMatch(subject, filter) {
+			return true
+		}
+	}
+	return false
+}
+
+////////////////////////////////////////////////////////////////////////////////
+// JSON Schema
+////////////////////////////////////////////////////////////////////////////////
+
+// jsonSchema is a compiled JSON Schema. The validation keywords of draft 2020-12
+// are supported, except for references and format assertions. Unknown keywords are ignored.
+type jsonSchema struct {
+	always  *bool // Set for the boolean schemas true and false.
+	types   []string
+	enum    []any
+	konst   any
+	isConst bool
+
+	// Numbers.
+	minimum, maximum                   *float64
+	exclusiveMinimum, exclusiveMaximum *float64
+	multipleOf                         *float64
+
+	// Strings.
+	minLength, maxLength int
+	pattern              *regexp.Regexp
+
+	// Arrays.
+	items              *jsonSchema
+	prefixItems        []*jsonSchema
+	minItems, maxItems int
+	uniqueItems        bool
+
+	// Objects.
+	properties           map[string]*jsonSchema
+	patternProperties    map[*regexp.Regexp]*jsonSchema
+	additionalProperties *jsonSchema
+	required             []string
+	minProps, maxProps   int
+
+	// Composition.
+	allOf, anyOf, oneOf []*jsonSchema
+	not                 *jsonSchema
+}
+
+// compileJSONSchema is the SchemaCompiler for JSONSchemaType.
+func compileJSONSchema(definition []byte) (SchemaValidator, error) {
+	v, err := decodeJSONValue(definition)
+	if err != nil {
+		return nil, fmt.Errorf("invalid JSON schema: %v", err)
+	}
+	return compileJSONSchemaValue(v, "#")
+}
+
+func decodeJSONValue(data []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	if dec.More() {
+		return nil, errors.New("unexpected data after top-level value")
+	}
+	return v, nil
+}
+
+func compileJSONSchemaValue(v any, path string) (*jsonSchema, error) {
+	if b, ok := v.(bool); ok {
+		return &jsonSchema{always: &b}, nil
+	}
+	m, ok := v.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("%s: schema must be an object or boolean", path)
+	}
+	js := &jsonSchema{minLength: -1, maxLength: -1, minItems: -1, maxItems: -1, minProps: -1, maxProps: -1}
+
+	schema := func(key string) (*jsonSchema, error) {
+		return compileJSONSchemaValue(m[key], path+"/"+key)
+	}
+	schemas := func(key string) ([]*jsonSchema, error) {
+		a, ok := m[key].([]any)
+		if !ok || len(a) == 0 {
+			return nil, fmt.Errorf("%s/%s: must be a non-empty array", path, key)
+		}
+		out := make([]*jsonSchema, 0, len(a))
+		for i, sv := range a {
+			s, err := compileJSONSchemaValue(sv, fmt.Sprintf("%s/%s/%d", path, key, i))
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, s)
+		}
+		return out, nil
+	}
+	number := func(key string) (*float64, error) {
+		n, ok := m[key].(json.Number)
+		if !ok {
+			return nil, fmt.Errorf("%s/%s: must be a number", path, key)
+		}
+		f, err := n.Float64()
+		if err != nil {
+			return nil, fmt.Errorf("%s/%s: invalid number", path, key)
+		}
+		return &f, nil
+	}
+	count := func(key string) (int, error) {
+		f, err := number(key)
+		if err != nil || *f != math.Trunc(*f) || *f < 0 || *f > math.MaxInt32 {
+			return 0, fmt.Errorf("%s/%s: must be a non-negative integer", path, key)
+		}
+		return int(*f), nil
+	}
+
+	var err error
+	for key := range m {
+		switch key {
+		case "$ref", "$dynamicRef", "$recursiveRef":
+			return nil, fmt.Errorf("%s/%s: references are not supported", path, key)
+		case "type":
+			switch t := m[key].(type) {
+			case string:
+				js.types = []string{t}
+			case []any:
+				for _, tv := range t {
+					s, ok := tv.(string)
+					if !ok {
+						return nil, fmt.Errorf("%s/type: must be a string or array of strings", path)
+					}
+					js.types = append(js.types, s)
+				}
+			default:
+				return nil, fmt.Errorf("%s/type: must be a string or array of strings", path)
+			}
+			for _, t := range js.types {
+				switch t {
+				case "null", "boolean", "object", "array", "number", "integer", "string":
+				default:
+					return nil, fmt.Errorf("%s/type: unknown type %q", path, t)
+				}
+			}
+		case "enum":
+			a, ok := m[key].([]any)
+			if !ok {
+				return nil, fmt.Errorf("%s/enum: must be an array", path)
+			}
+			js.enum = a
+		case "const":
+			js.konst, js.isConst = m[key], true
+		case "minimum":
+			js.minimum, err = number(key)
+		case "maximum":
+			js.maximum, err = number(key)
+		case "exclusiveMinimum":
+			js.exclusiveMinimum, err = number(key)
+		case "exclusiveMaximum":
+			js.exclusiveMaximum, err = number(key)
+		case "multipleOf":
+			if js.multipleOf, err = number(key); err == nil && *js.multipleOf <= 0 {
+				err = fmt.Errorf("%s/multipleOf: must be greater than 0", path)
+			}
+		case "minLength":
+			js.minLength, err = count(key)
+		case "maxLength":
+			js.maxLength, err = count(key)
+		case "pattern":
+			s, ok := m[key].(string)
+			if !ok {
+				return nil, fmt.Errorf("%s/pattern: must be a string", path)
+			}
+			if js.pattern, err = regexp.Compile(s); err != nil {
+				err = fmt.Errorf("%s/pattern: %v", path, err)
+			}
+		case "items":
+			js.items, err = schema(key)
+		case "prefixItems":
+			js.prefixItems, err = schemas(key)
+		case "minItems":
+			js.minItems, err = count(key)
+		case "maxItems":
+			js.maxItems, err = count(key)
+		case "uniqueItems":
+			js.uniqueItems, _ = m[key].(bool)
+		case "properties", "patternProperties":
+			pm, ok := m[key].(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("%s/%s: must be an object", path, key)
+			}
+			for name, pv := range pm {
+				ps, err := compileJSONSchemaValue(pv, path+"/"+key+"/"+name)
+				if err != nil {
+					return nil, err
+				}
+				if key == "properties" {
+					if js.properties == nil {
+						js.properties = make(map[string]*jsonSchema, len(pm))
+					}
+					js.properties[name] = ps
+					continue
+				}
+				re, err := regexp.Compile(name)
+				if err != nil {
+					return nil, fmt.Errorf("%s/patternProperties: %v", path, err)
+				}
+				if js.patternProperties == nil {
+					js.patternProperties = make(map[*regexp.Regexp]*jsonSchema, len(pm))
+				}
+				js.patternProperties[re] = ps
+			}
+		case "additionalProperties":
+			js.additionalProperties, err = schema(key)
+		case "required":
+			a, ok := m[key].([]any)
+			if !ok {
+				return nil, fmt.Errorf("%s/required: must be an array of strings", path)
+			}
+			for _, rv := range a {
+				s, ok := rv.(string)
+				if !ok {
+					return nil, fmt.Errorf("%s/required: must be an array of strings", path)
+				}
+				js.required = append(js.required, s)
+			}
+		case "minProperties":
+			js.minProps, err = count(key)
+		case "maxProperties":
+			js.maxProps, err = count(key)
+		case "allOf":
+			js.allOf, err = schemas(key)
+		case "anyOf":
+			js.anyOf, err = schemas(key)
+		case "oneOf":
+			js.oneOf, err = schemas(key)
+		case "not":
+			js.not, err = schema(key)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return js, nil
+}
+
+// Validate implements SchemaValidator.
+func (js *jsonSchema) Validate(msg []byte) error {
+	v, err := decodeJSONValue(msg)
+	if err != nil {
+		return fmt.Errorf("invalid JSON: %v", err)
+	}
+	return js.validate(v, "$")
+}
+
+func (js *jsonSchema) validate(v any, path string) error {
+	if js.always != nil {
+		if !*js.always {
+			return fmt.Errorf("%s: not allowed", path)
+		}
+		return nil
+	}
+
+	if len(js.types) > 0 {
+		var ok bool
+		for _, t := range js.types {
+			if jsonValueIsType(v, t) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return fmt.Errorf("%s: expected %s, got %s", path, jsonTypeList(js.types), jsonTypeOf(v))
+		}
+	}
+	if js.isConst && !jsonValuesEqual(v, js.konst) {
+		return fmt.Errorf("%s: does not match const value", path)
+	}
+	if js.enum != nil {
+		var ok bool
+		for _, ev := range js.enum {
+			if jsonValuesEqual(v, ev) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return fmt.Errorf("%s: not one of the enumerated values", path)
+		}
+	}
+
+	var err error
+	switch tv := v.(type) {
+	case json.Number:
+		err = js.validateNumber(tv, path)
+	case string:
+		err = js.validateString(tv, path)
+	case []any:
+		err = js.validateArray(tv, path)
+	case map[string]any:
+		err = js.validateObject(tv, path)
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, s := range js.allOf {
+		if err := s.validate(v, path); err != nil {
+			return err
+		}
+	}
+	if len(js.anyOf) > 0 {
+		var ok bool
+		for _, s := range js.anyOf {
+			if s.validate(v, path) == nil {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return fmt.Errorf("%s: does not match any schema of anyOf", path)
+		}
+	}
+	if len(js.oneOf) > 0 {
+		var n int
+		for _, s := range js.oneOf {
+			if s.validate(v, path) == nil {
+				n++
+			}
+		}
+		if n != 1 {
+			return fmt.Errorf("%s: matches %d schemas of oneOf, expected exactly 1", path, n)
+		}
+	}
+	if js.not != nil && js.not.validate(v, path) == nil {
+		return fmt.Errorf("%s: must not match schema of not", path)
+	}
+	return nil
+}
+
+func (js *jsonSchema) validateNumber(n json.Number, path string) error {
+	if js.minimum == nil && js.maximum == nil && js.exclusiveMinimum == nil && js.exclusiveMaximum == nil && js.multipleOf == nil {
+		return nil
+	}
+	f, err := n.Float64()
+	if err != nil {
+		return fmt.Errorf("%s: invalid number", path)
+	}
+	if js.minimum != nil && f < *js.minimum {
+		return fmt.Errorf("%s: must be >= %v", path, *js.minimum)
+	}
+	if js.maximum != nil && f > *js.maximum {
+		return fmt.Errorf("%s: must be <= %v", path, *js.maximum)
+	}
+	if js.exclusiveMinimum != nil && f <= *js.exclusiveMinimum {
+		return fmt.Errorf("%s: must be > %v", path, *js.exclusiveMinimum)
+	}
+	if js.exclusiveMaximum != nil && f >= *js.exclusiveMaximum {
+		return fmt.Errorf("%s: must be < %v", path, *js.exclusiveMaximum)
+	}
+	if js.multipleOf != nil {
+		// Allow for floating point error, e.g. 0.3 is a multiple of 0.1.
+		q := f / *js.multipleOf
+		if math.IsInf(q, 0) || math.Abs(q-math.Round(q)) > 1e-9*max(1, math.Abs(q)) {
+			return fmt.Errorf("%s: must be a multiple of %v", path, *js.multipleOf)
+		}
+	}
+	return nil
+}
+
+func (js *jsonSchema) validateString(s, path string) error {
+	if js.minLength >= 0 || js.maxLength >= 0 {
+		n := utf8.RuneCountInString(s)
+		if js.minLength >= 0 && n < js.minLength {
+			return fmt.Errorf("%s: length must be >= %d", path, js.minLength)
+		}
+		if js.maxLength >= 0 && n > js.maxLength {
+			return fmt.Errorf("%s: length must be <= %d", path, js.maxLength)
+		}
+	}
+	if js.pattern != nil && !js.pattern.MatchString(s) {
+		return fmt.Errorf("%s: does not match pattern %q", path, js.pattern.String())
+	}
+	return nil
+}
+
+func (js *jsonSchema) validateArray(a []any, path string) error {
+	if js.minItems >= 0 && len(a) < js.minItems {
+		return fmt.Errorf("%s: must have at least %d items", path, js.minItems)
+	}
+	if js.maxItems >= 0 && len(a) > js.maxItems {
+		return fmt.Errorf("%s: must have at most %d items", path, js.maxItems)
+	}
+	for i, iv := range a {
+		ipath := path + "[" + strconv.Itoa(i) + "]"
+		if i < len(js.prefixItems) {
+			if err := js.prefixItems[i].validate(iv, ipath); err != nil {
+				return err
+			}
+		} else if js.items != nil {
+			if err := js.items.validate(iv, ipath); err != nil {
+				return err
+			}
+		}
+	}
+	if js.uniqueItems {
+		for i := 1; i < len(a); i++ {
+			for j := 0; j < i; j++ {
+				if jsonValuesEqual(a[i], a[j]) {
+					return fmt.Errorf("%s: items must be unique", path)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (js *jsonSchema) validateObject(m map[string]any, path string) error {
+	if js.minProps >= 0 && len(m) < js.minProps {
+		return fmt.Errorf("%s: must have at least %d properties", path, js.minProps)
+	}
+	if js.maxProps >= 0 && len(m) > js.maxProps {
+		return fmt.Errorf("%s: must have at most %d properties", path, js.maxProps)
+	}
+	for _, name := range js.required {
+		if _, ok := m[name]; !ok {
+			return fmt.Errorf("%s: missing required property %q", path, name)
+		}
+	}
+	// Validate in a stable order so errors are deterministic.
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		pv, ppath := m[name], path+"."+name
+		var matched bool
+		if ps, ok := js.properties[name]; ok {
+			matched = true
+			if err := ps.validate(pv, ppath); err != nil {
+				return err
+			}
+		}
+		for re, ps := range js.patternProperties {
+			if re.MatchString(name) {
+				matched = true
+				if err := ps.validate(pv, ppath); err != nil {
+					return err
+				}
+			}
+		}
+		if !matched && js.additionalProperties != nil {
+			if err := js.additionalProperties.validate(pv, ppath); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func jsonValueIsType(v any, t string) bool {
+	switch t {
+	case "null":
+		return v == nil
+	case "boolean":
+		_, ok := v.(bool)
+		return ok
+	case "object":
+		_, ok := v.(map[string]any)
+		return ok
+	case "array":
+		_, ok := v.([]any)
+		return ok
+	case "string":
+		_, ok := v.(string)
+		return ok
+	case "number":
+		_, ok := v.(json.Number)
+		return ok
+	case "integer":
+		n, ok := v.(json.Number)
+		if !ok {
+			return false
+		}
+		f, err := n.Float64()
+		return err == nil && f == math.Trunc(f)
+	}
+	return false
+}
+
+func jsonTypeOf(v any) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	case string:
+		return "string"
+	case json.Number:
+		return "number"
+	}
+	return "unknown"
+}
+
+func jsonTypeList(types []string) string {
+	if len(types) == 1 {
+		return types[0]
+	}
+	return fmt.Sprintf("one of %v", types)
+}
+
+// jsonValuesEqual compares decoded JSON values, numbers are compared by value.
+func jsonValuesEqual(a, b any) bool {
+	if an, ok := a.(json.Number); ok {
+		bn, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		af, aerr := an.Float64()
+		bf, berr := bn.Float64()
+		return aerr == nil && berr == nil && af == bf
+	}
+	switch at := a.(type) {
+	case []any:
+		bt, ok := b.([]any)
+		if !ok || len(at) != len(bt) {
+			return false
+		}
+		for i := range at {
+			if !jsonValuesEqual(at[i], bt[i]) {
+				return false
+			}
+		}
+		return true
+	case map[string]any:
+		bt, ok := b.(map[string]any)
+		if !ok || len(at) != len(bt) {
+			return false
+		}
+		for k, av := range at {
+			bv, ok := bt[k]
+			if !ok || !jsonValuesEqual(av, bv) {
+				return false
+			}
+		}
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
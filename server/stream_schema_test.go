@@ -0,0 +1,124 @@
+// Copyright 2026 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestJSONSchemaValidate(t *testing.T) {
+	const schema = `{
+		"type": "object",
+		"required": ["id", "kind"],
+		"properties": {
+			"id": {"type": "integer", "minimum": 1},
+			"kind": {"enum": ["a", "b"]},
+			"name": {"type": "string", "minLength": 2, "maxLength": 5, "pattern": "^[a-z]+$"},
+			"price": {"type": "number", "exclusiveMaximum": 100, "multipleOf": 0.01},
+			"tags": {"type": "array", "items": {"type": "string"}, "maxItems": 2, "uniqueItems": true},
+			"ref": {"oneOf": [{"type": "string"}, {"type": "null"}]},
+			"version": {"const": 2}
+		},
+		"patternProperties": {"^x-": {"type": "boolean"}},
+		"additionalProperties": false
+	}`
+	v, err := compileJSONSchema([]byte(schema))
+	require_NoError(t, err)
+
+	for _, test := range []struct {
+		msg string
+		err string
+	}{
+		{msg: `{"id": 1, "kind": "a"}`},
+		{msg: `{"id": 2, "kind": "b", "name": "abc", "price": 9.99, "tags": ["x", "y"], "ref": null, "version": 2.0, "x-test": true}`},
+		{msg: `not json`, err: "invalid JSON: invalid character 'o' in literal null (expecting 'u')"},
+		{msg: `[]`, err: "$: expected object, got array"},
+		{msg: `{"id": 1}`, err: `$: missing required property "kind"`},
+		{msg: `{"id": 1.5, "kind": "a"}`, err: "$.id: expected integer, got number"},
+		{msg: `{"id": 0, "kind": "a"}`, err: "$.id: must be >= 1"},
+		{msg: `{"id": 1, "kind": "c"}`, err: "$.kind: not one of the enumerated values"},
+		{msg: `{"id": 1, "kind": "a", "name": "a"}`, err: "$.name: length must be >= 2"},
+		{msg: `{"id": 1, "kind": "a", "name": "ABC"}`, err: `$.name: does not match pattern "^[a-z]+$"`},
+		{msg: `{"id": 1, "kind": "a", "price": 100}`, err: "$.price: must be < 100"},
+		{msg: `{"id": 1, "kind": "a", "price": 1.001}`, err: "$.price: must be a multiple of 0.01"},
+		{msg: `{"id": 1, "kind": "a", "tags": ["x", 1]}`, err: "$.tags[1]: expected string, got number"},
+		{msg: `{"id": 1, "kind": "a", "tags": ["x", "x"]}`, err: "$.tags: items must be unique"},
+		{msg: `{"id": 1, "kind": "a", "ref": 1}`, err: "$.ref: matches 0 schemas of oneOf, expected exactly 1"},
+		{msg: `{"id": 1, "kind": "a", "version": 1}`, err: "$.version: does not match const value"},
+		{msg: `{"id": 1, "kind": "a", "x-test": "yes"}`, err: "$.x-test: expected boolean, got string"},
+		{msg: `{"id": 1, "kind": "a", "other": 1}`, err: "$.other: not allowed"},
+	} {
+		err := v.Validate([]byte(test.msg))
+		if test.err == _EMPTY_ {
+			require_NoError(t, err)
+		} else {
+			require_Error(t, err)
+			require_Equal(t, err.Error(), test.err)
+		}
+	}
+}
+
+func TestJSONSchemaCompileErrors(t *testing.T) {
+	for _, test := range []struct {
+		schema string
+		err    string
+	}{
+		{schema: `{`, err: "invalid JSON schema: unexpected EOF"},
+		{schema: `1`, err: "#: schema must be an object or boolean"},
+		{schema: `{"type": "foo"}`, err: `#/type: unknown type "foo"`},
+		{schema: `{"properties": {"a": {"minLength": -1}}}`, err: "#/properties/a/minLength: must be a non-negative integer"},
+		{schema: `{"pattern": "("}`, err: "#/pattern: error parsing regexp: missing closing ): `(`"},
+		{schema: `{"anyOf": []}`, err: "#/anyOf: must be a non-empty array"},
+		{schema: `{"items": {"$ref": "#/defs/a"}}`, err: "#/items/$ref: references are not supported"},
+	} {
+		_, err := compileJSONSchema([]byte(test.schema))
+		require_Error(t, err)
+		require_Equal(t, err.Error(), test.err)
+	}
+}
+
+type testSchemaValidator struct{}
+
+func (testSchemaValidator) Validate(msg []byte) error {
+	if string(msg) != "ok" {
+		return errors.New("not ok")
+	}
+	return nil
+}
+
+func TestStreamSchemasSubjectsAndRegistry(t *testing.T) {
+	RegisterSchemaType("test", func(definition []byte) (SchemaValidator, error) {
+		return testSchemaValidator{}, nil
+	})
+	defer RegisterSchemaType("test", nil)
+
+	ss, err := newStreamSchemas([]*StreamSchema{
+		{Subjects: []string{"orders.>"}, Type: JSONSchemaType, Definition: []byte(`{"type": "object"}`)},
+		{Subjects: []string{"raw.*"}, Type: "test"},
+	})
+	require_NoError(t, err)
+
+	require_NoError(t, ss.validate("orders.new", []byte(`{}`)))
+	require_Error(t, ss.validate("orders.new", []byte(`[]`)))
+	require_NoError(t, ss.validate("raw.a", []byte("ok")))
+	require_Error(t, ss.validate("raw.a", []byte("{}")))
+	// Subjects without a schema are not validated.
+	require_NoError(t, ss.validate("other", []byte("anything")))
+	require_Equal(t, ss.numRejected(), 2)
+
+	_, err = newStreamSchemas([]*StreamSchema{{Type: "protobuf"}})
+	require_Error(t, err)
+	require_Equal(t, err.Error(), `schema 0: unknown schema type "protobuf"`)
+}
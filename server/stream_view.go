@@ -0,0 +1,269 @@
+// Copyright 2026 The NATS Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nuid"
+)
+
+const (
+	// Default time a view stays open when no TTL was requested.
+	defaultStreamViewTTL = 5 * time.Minute
+	// Maximum time a view can stay open.
+	maxStreamViewTTL = 24 * time.Hour
+	// Maximum number of views open on a single stream.
+	maxStreamViews = 64
+	// Identifies a clustered stream snapshot that is prefixed with the open views.
+	streamViewsSnapshotMagic = uint8(43)
+)
+
+// StreamViewInfo describes a point-in-time view of a stream.
+// Consumers and direct gets bound to a view will not see messages after Seq,
+// and messages up to and including Seq are not removed by limits while the view is open.
+type StreamViewInfo struct {
+	ID      string    `json:"id"`
+	Seq     uint64    `json:"seq"`
+	Created time.Time `json:"created"`
+	Expires time.Time `json:"expires"`
+}
+
+type streamView struct {
+	StreamViewInfo
+	timer *time.Timer
+}
+
+// newView validates the request and returns a new view, not yet added.
+// Should only be called by the stream leader, since it resolves the sequence from our store.
+func (mset *stream) newView(req *JSApiStreamViewCreateRequest) (*StreamViewInfo, error) {
+	mset.cfgMu.RLock()
+	retention := mset.cfg.Retention
+	mset.cfgMu.RUnlock()
+	if retention != LimitsPolicy {
+		return nil, errors.New("views require limits retention policy")
+	}
+	if req.Seq > 0 && req.Time != nil {
+		return nil, errors.New("view can be created by sequence or time, not both")
+	}
+	ttl := req.TTL
+	if ttl < 0 || ttl > maxStreamViewTTL {
+		return nil, fmt.Errorf("view ttl must be between 0 and %v", maxStreamViewTTL)
+	} else if ttl == 0 {
+		ttl = defaultStreamViewTTL
+	}
+	mset.viewsMu.Lock()
+	nviews := len(mset.views)
+	mset.viewsMu.Unlock()
+	if nviews >= maxStreamViews {
+		return nil, fmt.Errorf("maximum number of views (%d) reached", maxStreamViews)
+	}
+
+	var state StreamState
+	mset.store.FastState(&state)
+	seq := state.LastSeq
+	if req.Seq > 0 {
+		seq = min(req.Seq, seq)
+	} else if req.Time != nil {
+		// The view ends right before the first message at or after the requested time.
+		if fseq := mset.store.GetSeqFromTime(*req.Time); fseq > 0 {
+			seq = min(fseq-1, seq)
+		}
+	}
+	now := time.Now().UTC()
+	return &StreamViewInfo{ID: nuid.Next(), Seq: seq, Created: now, Expires: now.Add(ttl)}, nil
+}
+
+// addView adds an open view, views that already expired are ignored.
+// Returns whether the view was added.
+func (mset *stream) addView(vi *StreamViewInfo) bool {
+	ttl := time.Until(vi.Expires)
+	if ttl <= 0 {
+		return false
+	}
+	mset.viewsMu.Lock()
+	defer mset.viewsMu.Unlock()
+	if mset.views == nil {
+		mset.views = make(map[string]*streamView)
+	}
+	if v := mset.views[vi.ID]; v != nil {
+		v.timer.Stop()
+	}
+	id := vi.ID
+	mset.views[id] = &streamView{
+		StreamViewInfo: *vi,
+		timer:          time.AfterFunc(ttl, func() { mset.expireView(id) }),
+	}
+	mset.updateViewHold()
+	return true
+}
+
+// removeView removes an open view and releases the messages it was holding.
+// Returns whether the view was open.
+func (mset *stream) removeView(id string) bool {
+	mset.viewsMu.Lock()
+	defer mset.viewsMu.Unlock()
+	v := mset.views[id]
+	if v == nil {
+		return false
+	}
+	v.timer.Stop()
+	delete(mset.views, id)
+	mset.updateViewHold()
+	return true
+}
+
+// expireView removes a view once it expires. In clustered mode the leader proposes the removal,
+// so all replicas stop holding messages for it at the same point in the log.
+// A new leader proposes the removal of views that expired in the meantime.
+func (mset *stream) expireView(id string) {
+	mset.mu.RLock()
+	node, term, isLeader, stream := mset.node, mset.term, mset.isLeader(), mset.cfg.Name
+	mset.mu.RUnlock()
+	if node == nil {
+		mset.removeView(id)
+		return
+	}
+	if !isLeader {
+		return
+	}
+	mset.viewsMu.Lock()
+	v := mset.views[id]
+	mset.viewsMu.Unlock()
+	if v != nil {
+		node.Propose(term, encodeStreamViewUpdate(removeStreamViewOp, &streamViewUpdate{View: v.StreamViewInfo, Stream: stream}))
+	}
+}
+
+// expireViews expires all views that are past their expiration, called when we become the leader.
+func (mset *stream) expireViews() {
+	now := time.Now()
+	var expired []string
+	mset.viewsMu.Lock()
+	for id, v := range mset.views {
+		if !v.Expires.After(now) {
+			expired = append(expired, id)
+		}
+	}
+	mset.viewsMu.Unlock()
+	for _, id := range expired {
+		mset.expireView(id)
+	}
+}
+
+// viewInfos returns all open views, sorted by their ID.
+func (mset *stream) viewInfos() []StreamViewInfo {
+	mset.viewsMu.Lock()
+	defer mset.viewsMu.Unlock()
+	if len(mset.views) == 0 {
+		return nil
+	}
+	views := make([]StreamViewInfo, 0, len(mset.views))
+	for _, v := range mset.views {
+		views = append(views, v.StreamViewInfo)
+	}
+	slices.SortFunc(views, func(a, b StreamViewInfo) int { return strings.Compare(a.ID, b.ID) })
+	return views
+}
+
+// restoreViews replaces our open views with the ones from a snapshot.
+func (mset *stream) restoreViews(views []StreamViewInfo) {
+	mset.viewsMu.Lock()
+	for id, v := range mset.views {
+		if !slices.ContainsFunc(views, func(vi StreamViewInfo) bool { return vi.ID == id }) {
+			v.timer.Stop()
+			delete(mset.views, id)
+		}
+	}
+	mset.updateViewHold()
+	mset.viewsMu.Unlock()
+
+	for i := range views {
+		mset.addView(&views[i])
+	}
+}
+
+// encodeViewsSnapshot prefixes a clustered stream snapshot with the open views,
+// since they are not part of the store's state.
+func encodeViewsSnapshot(views []StreamViewInfo, snap []byte) []byte {
+	b, _ := json.Marshal(views)
+	buf := make([]byte, 0, 1+binary.MaxVarintLen64+len(b)+len(snap))
+	buf = append(buf, streamViewsSnapshotMagic)
+	buf = binary.AppendUvarint(buf, uint64(len(b)))
+	buf = append(buf, b...)
+	return append(buf, snap...)
+}
+
+// decodeViewsSnapshot returns the open views from a clustered stream snapshot if any,
+// and the remaining snapshot.
+func decodeViewsSnapshot(data []byte) ([]StreamViewInfo, []byte, error) {
+	if len(data) == 0 || data[0] != streamViewsSnapshotMagic {
+		return nil, data, nil
+	}
+	l, n := binary.Uvarint(data[1:])
+	if n <= 0 || uint64(len(data)-1-n) < l {
+		return nil, nil, ErrCorruptStreamState
+	}
+	var views []StreamViewInfo
+	start := 1 + n
+	if err := json.Unmarshal(data[start:start+int(l)], &views); err != nil {
+		return nil, nil, ErrCorruptStreamState
+	}
+	return views, data[start+int(l):], nil
+}
+
+// lookupView returns the last sequence visible through an open view.
+func (mset *stream) lookupView(id string) (uint64, bool) {
+	mset.viewsMu.Lock()
+	defer mset.viewsMu.Unlock()
+	if v := mset.views[id]; v != nil {
+		return v.Seq, true
+	}
+	return 0, false
+}
+
+// hasViews returns whether there are any open views.
+func (mset *stream) hasViews() bool {
+	mset.viewsMu.Lock()
+	defer mset.viewsMu.Unlock()
+	return len(mset.views) > 0
+}
+
+// stopViews stops all view timers, used when the stream is stopped.
+func (mset *stream) stopViews() {
+	mset.viewsMu.Lock()
+	defer mset.viewsMu.Unlock()
+	for _, v := range mset.views {
+		v.timer.Stop()
+	}
+	mset.views = nil
+}
+
+// updateViewHold makes sure our store holds messages for the view with the highest sequence.
+// Views lock should be held.
+func (mset *stream) updateViewHold() {
+	var hseq uint64
+	for _, v := range mset.views {
+		hseq = max(hseq, v.Seq)
+	}
+	if mset.store != nil {
+		mset.store.HoldUpTo(hseq)
+	}
+}
@@ -1611,6 +1611,8 @@ var benchSublistSl = NewSublistWithCache()
 func TestMain(m *testing.M) {
 	flag.StringVar(&testDefaultClusterCompression, "cluster_compression", _EMPTY_, "Test with this compression level as the default")
 	flag.StringVar(&testDefaultLeafNodeCompression, "leafnode_compression", _EMPTY_, "Test with this compression level as the default")
+	flag.Int64Var(&testSimSeed, "sim_seed", 0, "Only run simulation scenarios with this seed")
+	flag.IntVar(&testSimSeeds, "sim_seeds", testSimSeeds, "Number of seeds to run simulation scenarios with")
 	flag.Parse()
 	initSublist := false
 	flag.Visit(func(f *flag.Flag) {